@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Client is a typed client for the mailroom API, for use by other Go services
+type Client struct {
+	baseURL    string
+	authToken  string
+	httpClient *http.Client
+}
+
+// NewClient creates a new client for the mailroom instance at the passed in URL, e.g. http://localhost:8090, which
+// authenticates with the passed in auth token if it isn't empty
+func NewClient(baseURL string, authToken string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		authToken:  authToken,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetHTTPClient sets the HTTP client used to make requests
+func (c *Client) SetHTTPClient(httpClient *http.Client) { c.httpClient = httpClient }
+
+// Error is an error response from mailroom
+type Error struct {
+	Status    int               `json:"-"`
+	Message   string            `json:"error"`
+	Code      string            `json:"code"`
+	Details   map[string]string `json:"details"`
+	Retryable bool              `json:"retryable"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mailroom returned %d: %s", e.Status, e.Message)
+}
+
+// posts the passed in request to the passed in path, reading the response into the passed in response
+func (c *Client) post(ctx context.Context, path string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return errors.Wrapf(err, "error marshalling request")
+	}
+
+	return c.postBody(ctx, path, body, response)
+}
+
+// posts the passed in body to the passed in path, reading the response into the passed in response
+func (c *Client) postBody(ctx context.Context, path string, body []byte, response interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "error creating request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Token "+c.authToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error making request to %s", path)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "error reading response from %s", path)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &Error{Status: resp.StatusCode}
+		if err := json.Unmarshal(respBody, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(respBody))
+		}
+		return apiErr
+	}
+
+	if err := json.Unmarshal(respBody, response); err != nil {
+		return errors.Wrapf(err, "error unmarshalling response from %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nyaruka/mailroom/client"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	var lastPath, lastAuth string
+	var lastBody map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPath = r.URL.EscapedPath()
+		lastAuth = r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		lastBody = nil
+		json.Unmarshal(body, &lastBody)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch lastPath {
+		case "/mr/contact/search":
+			w.Write([]byte(`{"query": "age > 10", "contact_ids": [10000, 10001], "fields": ["age"], "total": 2, "offset": 0, "sort": "-created_on"}`))
+		case "/mr/contact/parse_query":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "can't resolve 'xyz' to a field or URN scheme", "code": "query_syntax", "details": {"query": "xyz"}}`))
+		case "/mr/expression/migrate":
+			w.Write([]byte(`{"migrated": "@contact.name"}`))
+		case "/mr/flow/inspect":
+			w.Write([]byte(`{"results": []}`))
+		case "/mr/trigger/conflicts":
+			w.Write([]byte(`{"conflicts": [{"trigger_id": 23, "flow_id": 4, "type": "ambiguous"}]}`))
+		case "/mr/surveyor/submit":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"session": {"id": 12, "status": "C"}, "contact": {"id": 10000, "uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf"}}`))
+		case "/mr/session/callback/abc%2F123":
+			w.Write([]byte(`{"status": "queued"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`boom`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := client.NewClient(server.URL+"/", "sesame")
+
+	searched, err := c.SearchContacts(ctx, &client.ContactSearchRequest{OrgID: 1, GroupUUID: "985a83fe-2e9f-478d-a3ec-fa602d5e7ddd", Query: "age>10"})
+	require.NoError(t, err)
+	assert.Equal(t, "/mr/contact/search", lastPath)
+	assert.Equal(t, "Token sesame", lastAuth)
+	assert.Equal(t, map[string]interface{}{"org_id": 1.0, "group_uuid": "985a83fe-2e9f-478d-a3ec-fa602d5e7ddd", "query": "age>10", "offset": 0.0}, lastBody)
+	assert.Equal(t, "age > 10", searched.Query)
+	assert.Equal(t, []int64{10000, 10001}, searched.ContactIDs)
+	assert.Equal(t, int64(2), searched.Total)
+
+	migrated, err := c.MigrateExpression(ctx, &client.ExpressionMigrateRequest{Expression: "@contact.full_name"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"expression": "@contact.full_name"}, lastBody)
+	assert.Equal(t, "@contact.name", migrated.Migrated)
+
+	inspected, err := c.InspectFlow(ctx, &client.FlowInspectRequest{Flow: json.RawMessage(`{"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0"}`)})
+	require.NoError(t, err)
+	assert.Equal(t, "/mr/flow/inspect", lastPath)
+	assert.JSONEq(t, `{"results": []}`, string(inspected))
+
+	conflicts, err := c.CheckTriggerConflicts(ctx, &client.TriggerConflictsRequest{OrgID: 1, TriggerType: "K", Keyword: "join", MatchType: "F", GroupIDs: []int{12}})
+	require.NoError(t, err)
+	assert.Equal(t, "/mr/trigger/conflicts", lastPath)
+	assert.Equal(t, []*client.TriggerConflict{{TriggerID: 23, FlowID: 4, Type: "ambiguous"}}, conflicts.Conflicts)
+
+	// any 2XX response is a success
+	submitted, err := c.SubmitSurveyorSession(ctx, &client.SurveyorSubmitRequest{Session: json.RawMessage(`{}`)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), submitted.Session.ID)
+	assert.Equal(t, "C", submitted.Session.Status)
+
+	// callback bodies are sent as is, and tokens are escaped in the path
+	callback, err := c.SendSessionCallback(ctx, "abc/123", []byte(`{"foo": "bar"}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, lastBody)
+	assert.Equal(t, "queued", callback.Status)
+
+	// error responses are read into an error with their code and details
+	_, err = c.ParseQuery(ctx, &client.ContactParseQueryRequest{OrgID: 1, Query: "xyz = 1"})
+	require.Error(t, err)
+	apiErr, isAPIErr := err.(*client.Error)
+	require.True(t, isAPIErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, "query_syntax", apiErr.Code)
+	assert.Equal(t, map[string]string{"query": "xyz"}, apiErr.Details)
+	assert.EqualError(t, err, "mailroom returned 400: can't resolve 'xyz' to a field or URN scheme")
+
+	// as are responses which aren't JSON
+	_, err = c.CloneFlow(ctx, &client.FlowCloneRequest{Flow: json.RawMessage(`{}`)})
+	assert.EqualError(t, err, "mailroom returned 500: boom")
+
+	// no auth header is sent if we don't have a token
+	c = client.NewClient(server.URL, "")
+	_, err = c.MigrateExpression(ctx, &client.ExpressionMigrateRequest{Expression: "@contact.full_name"})
+	require.NoError(t, err)
+	assert.Equal(t, "", lastAuth)
+}
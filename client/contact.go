@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/utils/uuids"
+)
+
+// ContactSearchRequest searches the contacts of an org. If include_contacts is set, summaries of the contacts on the
+// returned page are included, e.g. to preview who a flow start query will hit.
+//
+//   {
+//     "org_id": 1,
+//     "group_uuid": "985a83fe-2e9f-478d-a3ec-fa602d5e7ddd",
+//     "query": "age > 10",
+//     "sort": "-age",
+//     "include_contacts": true
+//   }
+//
+type ContactSearchRequest struct {
+	OrgID           int              `json:"org_id"     validate:"required"`
+	GroupUUID       assets.GroupUUID `json:"group_uuid" validate:"required"`
+	Query           string           `json:"query"`
+	PageSize        int              `json:"page_size,omitempty"`
+	Offset          int              `json:"offset"`
+	Sort            string           `json:"sort,omitempty"`
+	IncludeContacts bool             `json:"include_contacts,omitempty"`
+}
+
+// ContactSummary is a summary of a contact matched by a search, without its URN if the org is anonymous
+//
+//   {"id": 5, "uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf", "name": "Cathy", "urn": "tel:+250700000001"}
+//
+type ContactSummary struct {
+	ID   int64      `json:"id"`
+	UUID uuids.UUID `json:"uuid"`
+	Name string     `json:"name"`
+	URN  string     `json:"urn,omitempty"`
+}
+
+// ContactQueryMetadata is what a contact query refers to, split into contact attributes, URN schemes and fields
+//
+//   {"attributes": ["name"], "schemes": ["tel"], "fields": ["age"]}
+//
+type ContactQueryMetadata struct {
+	Attributes []string `json:"attributes"`
+	Schemes    []string `json:"schemes"`
+	Fields     []string `json:"fields"`
+}
+
+// ContactSearchResponse is the response for a contact search
+//
+//   {
+//     "query": "age > 10",
+//     "contact_ids": [5,10,15],
+//     "contacts": [{"id": 5, "uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf", "name": "Cathy", "urn": "tel:+250700000001"}, ...],
+//     "fields": ["age"],
+//     "metadata": {"attributes": [], "schemes": [], "fields": ["age"]},
+//     "total": 3,
+//     "offset": 0,
+//     "sort": "-age"
+//   }
+//
+type ContactSearchResponse struct {
+	Query      string                `json:"query"`
+	ContactIDs []int64               `json:"contact_ids"`
+	Contacts   []*ContactSummary     `json:"contacts,omitempty"`
+	Fields     []string              `json:"fields"`
+	Metadata   *ContactQueryMetadata `json:"metadata"`
+	Total      int64                 `json:"total"`
+	Offset     int                   `json:"offset"`
+	Sort       string                `json:"sort"`
+}
+
+// ContactParseQueryRequest parses a contact query without running it. If the query is invalid, the error response
+// has the query_syntax code, and if the problem can be located, start and end details which are the character offsets
+// of it in the query, e.g. {"start": "0", "end": "8"} for "birthday = tomorrow" when there is no birthday field.
+//
+//   {
+//     "org_id": 1,
+//     "query": "age > 10"
+//   }
+//
+type ContactParseQueryRequest struct {
+	OrgID int    `json:"org_id" validate:"required"`
+	Query string `json:"query"  validate:"required"`
+}
+
+// ContactParseQueryResponse is the response for a parse query request
+//
+//   {
+//     "query": "age > 10",
+//     "fields": ["age"],
+//     "metadata": {"attributes": [], "schemes": [], "fields": ["age"]}
+//   }
+//
+type ContactParseQueryResponse struct {
+	Query    string                `json:"query"`
+	Fields   []string              `json:"fields"`
+	Metadata *ContactQueryMetadata `json:"metadata"`
+}
+
+// ContactAddNoteRequest adds a note to a contact on behalf of a user
+//
+//   {
+//     "org_id": 1,
+//     "contact_id": 12,
+//     "user_id": 3,
+//     "text": "Called back about their refund, waiting on finance"
+//   }
+//
+type ContactAddNoteRequest struct {
+	OrgID     int    `json:"org_id"     validate:"required"`
+	ContactID int64  `json:"contact_id" validate:"required"`
+	UserID    int64  `json:"user_id"    validate:"required"`
+	Text      string `json:"text"       validate:"required,max=10000"`
+}
+
+// ContactNotesRequest lists the notes on a contact, or searches the notes of all contacts in an org if no contact
+// is specified. Notes can be filtered to those containing some text, and are returned newest first.
+//
+//   {
+//     "org_id": 1,
+//     "contact_id": 12,
+//     "text": "refund"
+//   }
+//
+type ContactNotesRequest struct {
+	OrgID     int    `json:"org_id"               validate:"required"`
+	ContactID int64  `json:"contact_id,omitempty"`
+	Text      string `json:"text,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+// ContactNote is a note on a contact, in the shape of a contact history event
+//
+//   {
+//     "type": "note_added",
+//     "uuid": "0e9a5a1e-5f1d-4d5c-9a8f-2e6d3c1b7a40",
+//     "created_on": "2020-05-04T12:30:00Z",
+//     "contact_id": 12,
+//     "user_id": 3,
+//     "text": "Called back about their refund, waiting on finance"
+//   }
+//
+type ContactNote struct {
+	Type      string     `json:"type"`
+	UUID      uuids.UUID `json:"uuid"`
+	CreatedOn time.Time  `json:"created_on"`
+	ContactID int64      `json:"contact_id"`
+	UserID    int64      `json:"user_id"`
+	Text      string     `json:"text"`
+}
+
+// ContactNotesResponse is the response for a contact notes request
+//
+//   {
+//     "notes": [{"type": "note_added", "uuid": "0e9a5a1e-5f1d-4d5c-9a8f-2e6d3c1b7a40", ...}]
+//   }
+//
+type ContactNotesResponse struct {
+	Notes []*ContactNote `json:"notes"`
+}
+
+// SearchContacts searches the contacts of an org
+func (c *Client) SearchContacts(ctx context.Context, request *ContactSearchRequest) (*ContactSearchResponse, error) {
+	response := &ContactSearchResponse{}
+	if err := c.post(ctx, "/mr/contact/search", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ParseQuery parses and normalizes a contact query
+func (c *Client) ParseQuery(ctx context.Context, request *ContactParseQueryRequest) (*ContactParseQueryResponse, error) {
+	response := &ContactParseQueryResponse{}
+	if err := c.post(ctx, "/mr/contact/parse_query", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// AddContactNote adds a note to a contact, returning the added note
+func (c *Client) AddContactNote(ctx context.Context, request *ContactAddNoteRequest) (*ContactNote, error) {
+	response := &ContactNote{}
+	if err := c.post(ctx, "/mr/contact/add_note", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ContactNotes lists or searches contact notes
+func (c *Client) ContactNotes(ctx context.Context, request *ContactNotesRequest) (*ContactNotesResponse, error) {
+	response := &ContactNotesResponse{}
+	if err := c.post(ctx, "/mr/contact/notes", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
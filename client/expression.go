@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nyaruka/goflow/flows"
+)
+
+// ExpressionMigrateRequest migrates a legacy expression to the new flow definition specification
+//
+//   {
+//     "expression": "@contact.age"
+//   }
+//
+type ExpressionMigrateRequest struct {
+	Expression string `json:"expression" validate:"required"`
+}
+
+// ExpressionMigrateResponse is the response for an expression migration
+//
+//   {
+//     "migrated": "@fields.age"
+//   }
+//
+type ExpressionMigrateResponse struct {
+	Migrated string `json:"migrated"`
+}
+
+// MigrateExpression migrates a legacy expression
+func (c *Client) MigrateExpression(ctx context.Context, request *ExpressionMigrateRequest) (*ExpressionMigrateResponse, error) {
+	response := &ExpressionMigrateResponse{}
+	if err := c.post(ctx, "/mr/expression/migrate", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ExpressionEvaluateRequest evaluates each template against each contact, who are either existing contacts in the
+// org or contacts given in the goflow format, so that content can be checked against representative contacts. Templates
+// can reference @contact, @fields, @globals and @urns.
+//
+//   {
+//     "org_id": 1,
+//     "templates": ["Hi @contact.name", "You are @fields.age years old"],
+//     "contact_ids": [12, 34],
+//     "contacts": [
+//       {"uuid": "ba96bf7f-bc2a-4873-a7c7-254d1927c4e3", "name": "Ann", "fields": {"age": {"text": "32", "number": 32}}}
+//     ]
+//   }
+//
+type ExpressionEvaluateRequest struct {
+	OrgID      int               `json:"org_id"    validate:"required"`
+	Templates  []string          `json:"templates" validate:"required"`
+	ContactIDs []int64           `json:"contact_ids,omitempty"`
+	Contacts   []json.RawMessage `json:"contacts,omitempty"`
+}
+
+// ExpressionEvaluateOutput is the result of evaluating a template for a contact
+type ExpressionEvaluateOutput struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ExpressionEvaluateResult is the result of evaluating every template for a contact, outputs are in template order
+type ExpressionEvaluateResult struct {
+	ContactUUID flows.ContactUUID           `json:"contact_uuid"`
+	ContactName string                      `json:"contact_name"`
+	Outputs     []*ExpressionEvaluateOutput `json:"outputs"`
+}
+
+// ExpressionEvaluateResponse is the response for an expression evaluation, with a result for each contact in the
+// order they were requested, existing contacts first
+//
+//   {
+//     "results": [
+//       {
+//         "contact_uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf",
+//         "contact_name": "Cathy",
+//         "outputs": [{"output": "Hi Cathy"}, {"output": "You are  years old"}]
+//       }
+//     ]
+//   }
+//
+type ExpressionEvaluateResponse struct {
+	Results []*ExpressionEvaluateResult `json:"results"`
+}
+
+// EvaluateExpressions evaluates templates against contacts
+func (c *Client) EvaluateExpressions(ctx context.Context, request *ExpressionEvaluateRequest) (*ExpressionEvaluateResponse, error) {
+	response := &ExpressionEvaluateResponse{}
+	if err := c.post(ctx, "/mr/expression/evaluate", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
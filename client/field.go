@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// FieldUsageRequest fetches the usage statistics for the contact fields of an org
+//
+//   {
+//     "org_id": 1
+//   }
+//
+type FieldUsageRequest struct {
+	OrgID int `json:"org_id" validate:"required"`
+}
+
+// GetFieldUsage fetches field usage statistics, returning them as JSON. Fill counts are recalculated every fifteen
+// minutes for orgs which have had fields set, and counted_on is when they were last calculated, e.g.
+//
+//   {
+//     "fields": [
+//       {
+//         "key": "age",
+//         "name": "Age",
+//         "value_type": "number",
+//         "filled": 12,
+//         "fill_rate": 0.4,
+//         "last_used_on": "2019-10-01T12:30:00Z",
+//         "abandoned": false
+//       }
+//     ],
+//     "suggestions": ["nickname"],
+//     "counted_on": "2019-10-01T12:15:00.123456Z"
+//   }
+//
+func (c *Client) GetFieldUsage(ctx context.Context, request *FieldUsageRequest) (json.RawMessage, error) {
+	var usage json.RawMessage
+	err := c.post(ctx, "/mr/field/usage", request, &usage)
+	return usage, err
+}
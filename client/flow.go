@@ -0,0 +1,613 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+)
+
+// FlowMigrateRequest migrates a legacy flow to the new flow definition specification. If no version is specified but
+// an org is, the flow is migrated to the version that org has pinned, if any.
+//
+//   {
+//     "flow": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "action_sets": [], ...},
+//     "to_version": "13.0.0",
+//     "org_id": 1
+//   }
+//
+type FlowMigrateRequest struct {
+	Flow      json.RawMessage `json:"flow"       validate:"required"`
+	ToVersion *semver.Version `json:"to_version,omitempty"`
+	OrgID     int             `json:"org_id,omitempty"`
+}
+
+// FlowMigrateBulkRequest migrates many legacy flows at once. Like a single migration, if no version is specified but
+// an org is, the flows are migrated to the version that org has pinned, if any.
+//
+//   {
+//     "flows": [{"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "action_sets": [], ...}, ...],
+//     "to_version": "13.0.0",
+//     "org_id": 1
+//   }
+//
+type FlowMigrateBulkRequest struct {
+	Flows     []json.RawMessage `json:"flows"      validate:"required,min=1,max=500"`
+	ToVersion *semver.Version   `json:"to_version,omitempty"`
+	OrgID     int               `json:"org_id,omitempty"`
+}
+
+// FlowMigrateBulkResponse is the response for a bulk migration, with a result for each flow in the same order as
+// the request. Each result has either the migrated flow or the error which prevented it being migrated.
+//
+//   {
+//     "results": [
+//       {"flow": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [], ...}},
+//       {"error": "unable to read migrated flow: unable to read node: field 'uuid' is required"}
+//     ]
+//   }
+//
+type FlowMigrateBulkResponse struct {
+	Results []*FlowMigrateResult `json:"results"`
+}
+
+// FlowMigrateResult is the result of migrating one flow in a bulk migration
+type FlowMigrateResult struct {
+	Flow  json.RawMessage `json:"flow,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// FlowInspectRequest inspects a flow, and returns metadata including the possible results generated by the flow,
+// and dependencies in the flow. If `validate_with_org_id` is specified then the flow is first migrated to the flow
+// spec version pinned by that org and validated against the assets of that org, and the inspection includes whether
+// each dependency exists in that org and how many other flows depend on it. If `check_msg_lengths` is specified then the inspection also includes the SMS encoding and
+// segment count of each message in each language, with warnings for messages which are long, or which will be
+// truncated on any of the org's channels.
+//
+//   {
+//     "flow": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]},
+//     "validate_with_org_id": 1,
+//     "check_msg_lengths": true
+//   }
+//
+type FlowInspectRequest struct {
+	Flow              json.RawMessage `json:"flow"                 validate:"required"`
+	ValidateWithOrgID int             `json:"validate_with_org_id,omitempty"`
+	CheckMsgLengths   bool            `json:"check_msg_lengths,omitempty"`
+}
+
+// FlowValidateRequest validates a flow, returning all the problems found in it with the nodes and actions where they
+// were found, rather than just the first. If `validate_with_org_id` is specified then the dependencies of each node
+// are also checked against the assets of that org.
+//
+//   {
+//     "flow": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]},
+//     "validate_with_org_id": 1
+//   }
+//
+type FlowValidateRequest struct {
+	Flow              json.RawMessage `json:"flow"                 validate:"required"`
+	ValidateWithOrgID int             `json:"validate_with_org_id,omitempty"`
+}
+
+// FlowCloneRequest clones a flow, replacing all UUIDs with either the given mapping or new random UUIDs. If
+// `validate_with_org_id` is specified then the flow is first migrated to the flow spec version pinned by that org,
+// and the cloned flow will be validated against the assets of that org.
+//
+//   {
+//     "dependency_mapping": {
+//       "4ee4189e-0c06-4b00-b54f-5621329de947": "db31d23f-65b8-4518-b0f6-45638bfbbbf2",
+//       "723e62d8-a544-448f-8590-1dfd0fccfcd4": "f1fd861c-9e75-4376-a829-dcf76db6e721"
+//     },
+//     "flow": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]},
+//     "validate_with_org_id": 1
+//   }
+//
+type FlowCloneRequest struct {
+	DependencyMapping map[uuids.UUID]uuids.UUID `json:"dependency_mapping,omitempty"`
+	Flow              json.RawMessage           `json:"flow"                 validate:"required"`
+	ValidateWithOrgID int                       `json:"validate_with_org_id,omitempty"`
+}
+
+// FlowDiffRequest compares two revisions of a flow, returning the nodes which were added, removed or changed, and
+// any results which were renamed. Legacy definitions are migrated before being compared.
+//
+//   {
+//     "from": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]},
+//     "to": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]}
+//   }
+//
+type FlowDiffRequest struct {
+	From json.RawMessage `json:"from" validate:"required"`
+	To   json.RawMessage `json:"to"   validate:"required"`
+}
+
+// FlowTemplatesRequest extracts all the templated strings in a flow, e.g. message text, including translations, with
+// where each is found and the expressions it references. Legacy definitions are migrated first.
+//
+//   {
+//     "flow": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]}
+//   }
+//
+type FlowTemplatesRequest struct {
+	Flow json.RawMessage `json:"flow" validate:"required"`
+}
+
+// FlowDeleteRequest soft deletes a flow so that it can no longer be started or triggered. If interrupt is set, the
+// sessions currently waiting in the flow are interrupted, otherwise they are left to finish.
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "interrupt": true
+//   }
+//
+type FlowDeleteRequest struct {
+	OrgID     int             `json:"org_id"    validate:"required"`
+	FlowUUID  assets.FlowUUID `json:"flow_uuid" validate:"required"`
+	Interrupt bool            `json:"interrupt"`
+}
+
+// FlowDeleteResponse is the response for a flow delete request
+//
+//   {
+//     "interrupted": 23
+//   }
+//
+type FlowDeleteResponse struct {
+	Interrupted int `json:"interrupted"`
+}
+
+// FlowRestoreRequest restores a soft deleted flow so that it can be started and triggered again
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0"
+//   }
+//
+type FlowRestoreRequest struct {
+	OrgID    int             `json:"org_id"    validate:"required"`
+	FlowUUID assets.FlowUUID `json:"flow_uuid" validate:"required"`
+}
+
+// FlowChangelogRequest fetches a page of the revisions of a flow, newest first, with who saved each and what changed
+// from the revision before it. The next page is fetched by passing the revision returned as next as before.
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "before": 34,
+//     "limit": 20
+//   }
+//
+type FlowChangelogRequest struct {
+	OrgID    int             `json:"org_id"    validate:"required"`
+	FlowUUID assets.FlowUUID `json:"flow_uuid" validate:"required"`
+	Before   int             `json:"before"`
+	Limit    int             `json:"limit"`
+}
+
+// FlowChangelogAuthor is the user who saved a revision
+type FlowChangelogAuthor struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// FlowChangelogEntry is a revision of a flow and its difference from the revision before it, which is null for the
+// oldest revision, or if either revision can't be read
+type FlowChangelogEntry struct {
+	Revision    int                  `json:"revision"`
+	SpecVersion string               `json:"spec_version"`
+	CreatedOn   time.Time            `json:"created_on"`
+	CreatedBy   *FlowChangelogAuthor `json:"created_by"`
+	Diff        json.RawMessage      `json:"diff"`
+}
+
+// FlowChangelogResponse is the response for a flow changelog request. Pruned revisions don't appear so entries are
+// diffed against the revision before them which still exists.
+//
+//   {
+//     "revisions": [
+//       {
+//         "revision": 33,
+//         "spec_version": "13.1.0",
+//         "created_on": "2020-04-15T12:00:00Z",
+//         "created_by": {"id": 3, "email": "bob@nyaruka.com", "name": "Bob McFlow"},
+//         "diff": {"added_nodes": [], "removed_nodes": [], "changed_nodes": [...], "renamed_results": []}
+//       }
+//     ],
+//     "next": 33
+//   }
+//
+type FlowChangelogResponse struct {
+	Revisions []*FlowChangelogEntry `json:"revisions"`
+	Next      int                   `json:"next,omitempty"`
+}
+
+// FlowStartRequest starts contacts in a flow. Contacts can be given by ID, URN, group or a query, and are resolved
+// and started in batches by a queued task. Unless restart_participants is set, contacts who have been in the flow
+// before are skipped, and unless include_active is set, contacts who are currently in a flow are skipped. Contact IDs
+// which don't belong to the org are ignored.
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "contact_ids": [12, 34],
+//     "group_ids": [56],
+//     "urns": ["tel:+250788123123"],
+//     "query": "age > 18",
+//     "restart_participants": true,
+//     "include_active": false,
+//     "extra": {"campaign": "vaccines"}
+//   }
+//
+type FlowStartRequest struct {
+	OrgID               int             `json:"org_id"    validate:"required"`
+	FlowUUID            assets.FlowUUID `json:"flow_uuid" validate:"required"`
+	ContactIDs          []int64         `json:"contact_ids,omitempty"`
+	GroupIDs            []int64         `json:"group_ids,omitempty"`
+	URNs                []urns.URN      `json:"urns,omitempty"`
+	Query               string          `json:"query,omitempty"`
+	RestartParticipants bool            `json:"restart_participants"`
+	IncludeActive       bool            `json:"include_active"`
+	Extra               json.RawMessage `json:"extra,omitempty"`
+}
+
+// FlowStartResponse is the response for a flow start request
+//
+//   {
+//     "start_id": 123,
+//     "start_uuid": "2f969340-704a-4aa2-a1bd-2f832a21d257"
+//   }
+//
+type FlowStartResponse struct {
+	StartID   int64      `json:"start_id"`
+	StartUUID uuids.UUID `json:"start_uuid"`
+}
+
+// FlowCheckSessionsRequest queues a check of whether the sessions in a flow can continue in its latest revision after
+// it has been saved. Sessions whose runs are at nodes which no longer exist, or no longer wait, can't continue and are
+// reported, and if interrupt is set, are interrupted. The result is fetched with a FlowCheckSessionsResultRequest once the
+// check has run.
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "interrupt": true
+//   }
+//
+type FlowCheckSessionsRequest struct {
+	OrgID     int             `json:"org_id"    validate:"required"`
+	FlowUUID  assets.FlowUUID `json:"flow_uuid" validate:"required"`
+	Interrupt bool            `json:"interrupt"`
+}
+
+// FlowCheckSessionsResultRequest fetches the result of the last check of the sessions in a flow
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0"
+//   }
+//
+type FlowCheckSessionsResultRequest struct {
+	OrgID    int             `json:"org_id"    validate:"required"`
+	FlowUUID assets.FlowUUID `json:"flow_uuid" validate:"required"`
+}
+
+// FlowCheckSessionsResultResponse is the result of the last check of the sessions in a flow
+//
+//   {
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "compatible": 120,
+//     "incompatible": [
+//       {"session_id": 2345, "contact_id": 12, "node_uuid": "3dcccbb4-d29c-41dd-a01f-16d814c9ab82", "reason": "node no longer exists"}
+//     ],
+//     "interrupted": 1,
+//     "checked_on": "2020-09-15T10:31:12.123456Z"
+//   }
+//
+type FlowCheckSessionsResultResponse struct {
+	FlowUUID     assets.FlowUUID        `json:"flow_uuid"`
+	Compatible   int                    `json:"compatible"`
+	Incompatible []*IncompatibleSession `json:"incompatible"`
+	Interrupted  int                    `json:"interrupted"`
+	CheckedOn    time.Time              `json:"checked_on"`
+}
+
+// IncompatibleSession is a session which can't continue in the latest revision of a flow
+type IncompatibleSession struct {
+	SessionID int64  `json:"session_id"`
+	ContactID int64  `json:"contact_id"`
+	NodeUUID  string `json:"node_uuid"`
+	Reason    string `json:"reason"`
+}
+
+// FlowSplitStatsRequest fetches the assignment and completion counts for each arm of the random splits in a flow,
+// which can be used to read the results of experiments.
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0"
+//   }
+//
+type FlowSplitStatsRequest struct {
+	OrgID    int             `json:"org_id"    validate:"required"`
+	FlowUUID assets.FlowUUID `json:"flow_uuid" validate:"required"`
+}
+
+// FlowResultsSummaryRequest fetches the count of runs in each category of each result of a flow, the count of runs by
+// how they exited and how many times contacts went along each segment of the flow. These can be limited to a time
+// window, in which case categories and runs are counted for runs created in it and segments for steps taken in it.
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "since": "2020-04-01T00:00:00Z",
+//     "until": "2020-05-01T00:00:00Z"
+//   }
+//
+type FlowResultsSummaryRequest struct {
+	OrgID    int             `json:"org_id"    validate:"required"`
+	FlowUUID assets.FlowUUID `json:"flow_uuid" validate:"required"`
+	Since    *time.Time      `json:"since,omitempty"`
+	Until    *time.Time      `json:"until,omitempty"`
+}
+
+// FlowFunnelRequest fetches how many of the runs of a flow started in a date range entered it, reached each of the
+// passed in nodes (having reached those before it) and then completed. If a second date range is given, the funnel of
+// the runs started in it is also returned for comparison.
+//
+//   {
+//     "org_id": 1,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "node_uuids": ["cd2b9e8e-6b1a-4e70-a5b7-1b9e5f6c6f1e", "b7bb5e7c-ad49-4e65-9e24-bf7f1e4ff00a"],
+//     "since": "2020-05-01T00:00:00Z",
+//     "until": "2020-06-01T00:00:00Z",
+//     "compare_since": "2020-04-01T00:00:00Z",
+//     "compare_until": "2020-05-01T00:00:00Z"
+//   }
+//
+type FlowFunnelRequest struct {
+	OrgID        int              `json:"org_id"        validate:"required"`
+	FlowUUID     assets.FlowUUID  `json:"flow_uuid"     validate:"required"`
+	NodeUUIDs    []flows.NodeUUID `json:"node_uuids"`
+	Since        time.Time        `json:"since"         validate:"required"`
+	Until        time.Time        `json:"until"         validate:"required"`
+	CompareSince *time.Time       `json:"compare_since,omitempty"`
+	CompareUntil *time.Time       `json:"compare_until,omitempty"`
+}
+
+// FlowScheduleStartRequest schedules a one-off start of a flow for the passed in contacts and groups at a time in the
+// future. The start is stored as a schedule and trigger, so it can be paused or viewed like any other schedule until
+// the schedules cron fires it. Contact IDs which don't belong to the org are ignored.
+//
+//   {
+//     "org_id": 1,
+//     "user_id": 3,
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "contact_ids": [12, 34],
+//     "group_ids": [56],
+//     "fire_on": "2020-06-01T09:00:00+02:00"
+//   }
+//
+type FlowScheduleStartRequest struct {
+	OrgID      int             `json:"org_id"      validate:"required"`
+	UserID     int64           `json:"user_id"     validate:"required"`
+	FlowUUID   assets.FlowUUID `json:"flow_uuid"   validate:"required"`
+	ContactIDs []int64         `json:"contact_ids,omitempty"`
+	GroupIDs   []int64         `json:"group_ids,omitempty"`
+	FireOn     time.Time       `json:"fire_on"     validate:"required"`
+}
+
+// FlowScheduleStartResponse is the response for a schedule start request
+//
+//   {
+//     "schedule_id": 123,
+//     "trigger_id": 456,
+//     "fire_on": "2020-06-01T07:00:00Z"
+//   }
+//
+type FlowScheduleStartResponse struct {
+	ScheduleID int64     `json:"schedule_id"`
+	TriggerID  int64     `json:"trigger_id"`
+	FireOn     time.Time `json:"fire_on"`
+}
+
+// MigrateFlow migrates a legacy flow, returning the migrated definition
+func (c *Client) MigrateFlow(ctx context.Context, request *FlowMigrateRequest) (json.RawMessage, error) {
+	var migrated json.RawMessage
+	err := c.post(ctx, "/mr/flow/migrate", request, &migrated)
+	return migrated, err
+}
+
+// MigrateFlows migrates many legacy flows, returning a result for each
+func (c *Client) MigrateFlows(ctx context.Context, request *FlowMigrateBulkRequest) (*FlowMigrateBulkResponse, error) {
+	response := &FlowMigrateBulkResponse{}
+	if err := c.post(ctx, "/mr/flow/migrate_bulk", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// InspectFlow inspects a flow, returning its inspection as JSON
+func (c *Client) InspectFlow(ctx context.Context, request *FlowInspectRequest) (json.RawMessage, error) {
+	var inspection json.RawMessage
+	err := c.post(ctx, "/mr/flow/inspect", request, &inspection)
+	return inspection, err
+}
+
+// ValidateFlow validates a flow, returning the problems found as JSON
+//
+//   {
+//     "problems": [
+//       {
+//         "type": "invalid",
+//         "node_uuid": "9d1741b5-b2b0-4726-8196-42121fcce844",
+//         "action_uuid": "5463514e-d96e-4539-bdab-0f1286e6dae6",
+//         "description": "unable to read node: unable to read action: field 'text' is required"
+//       }
+//     ]
+//   }
+//
+func (c *Client) ValidateFlow(ctx context.Context, request *FlowValidateRequest) (json.RawMessage, error) {
+	var problems json.RawMessage
+	err := c.post(ctx, "/mr/flow/validate", request, &problems)
+	return problems, err
+}
+
+// CloneFlow clones a flow, returning the cloned definition
+func (c *Client) CloneFlow(ctx context.Context, request *FlowCloneRequest) (json.RawMessage, error) {
+	var clone json.RawMessage
+	err := c.post(ctx, "/mr/flow/clone", request, &clone)
+	return clone, err
+}
+
+// DiffFlows compares two revisions of a flow, returning the diff as JSON
+func (c *Client) DiffFlows(ctx context.Context, request *FlowDiffRequest) (json.RawMessage, error) {
+	var diff json.RawMessage
+	err := c.post(ctx, "/mr/flow/diff", request, &diff)
+	return diff, err
+}
+
+// ExtractFlowTemplates extracts the templated strings in a flow, returning them as JSON
+//
+//   {
+//     "templates": [
+//       {
+//         "node_uuid": "9d1741b5-b2b0-4726-8196-42121fcce844",
+//         "action_uuid": "0d432023-b932-4aaa-ab9a-ebe17b825239",
+//         "field": "text",
+//         "template": "Hi @contact.name, your balance is @(format_number(fields.balance))",
+//         "expressions": ["contact.name", "format_number(fields.balance)"]
+//       }
+//     ]
+//   }
+//
+func (c *Client) ExtractFlowTemplates(ctx context.Context, request *FlowTemplatesRequest) (json.RawMessage, error) {
+	var templates json.RawMessage
+	err := c.post(ctx, "/mr/flow/templates", request, &templates)
+	return templates, err
+}
+
+// DeleteFlow soft deletes a flow, returning how many of its sessions were interrupted
+func (c *Client) DeleteFlow(ctx context.Context, request *FlowDeleteRequest) (*FlowDeleteResponse, error) {
+	response := &FlowDeleteResponse{}
+	if err := c.post(ctx, "/mr/flow/delete", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// StartFlow queues a start of contacts in a flow, returning the start which was created
+func (c *Client) StartFlow(ctx context.Context, request *FlowStartRequest) (*FlowStartResponse, error) {
+	response := &FlowStartResponse{}
+	if err := c.post(ctx, "/mr/flow/start", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// CheckFlowSessions queues a check of whether the sessions in a flow can continue in its latest revision
+func (c *Client) CheckFlowSessions(ctx context.Context, request *FlowCheckSessionsRequest) error {
+	return c.post(ctx, "/mr/flow/check_sessions", request, &struct{}{})
+}
+
+// CheckFlowSessionsResult fetches the result of the last check of the sessions in a flow
+func (c *Client) CheckFlowSessionsResult(ctx context.Context, request *FlowCheckSessionsResultRequest) (*FlowCheckSessionsResultResponse, error) {
+	response := &FlowCheckSessionsResultResponse{}
+	if err := c.post(ctx, "/mr/flow/check_sessions_result", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// FlowChangelog fetches a page of the revisions of a flow
+func (c *Client) FlowChangelog(ctx context.Context, request *FlowChangelogRequest) (*FlowChangelogResponse, error) {
+	response := &FlowChangelogResponse{}
+	if err := c.post(ctx, "/mr/flow/changelog", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// RestoreFlow restores a soft deleted flow
+func (c *Client) RestoreFlow(ctx context.Context, request *FlowRestoreRequest) error {
+	return c.post(ctx, "/mr/flow/restore", request, &struct{}{})
+}
+
+// GetFlowSplitStats fetches the stats of the random splits in a flow, returning them as JSON
+//
+//   {
+//     "splits": [
+//       {
+//         "node_uuid": "cd2b9e8e-6b1a-4e70-a5b7-1b9e5f6c6f1e",
+//         "result_name": "Arm",
+//         "arms": [
+//           {"uuid": "...", "name": "A", "exit_uuid": "...", "assigned": 120, "completed": 30, "conversion_rate": 0.25},
+//           {"uuid": "...", "name": "B", "exit_uuid": "...", "assigned": 118, "completed": 41, "conversion_rate": 0.347}
+//         ]
+//       }
+//     ]
+//   }
+//
+func (c *Client) GetFlowSplitStats(ctx context.Context, request *FlowSplitStatsRequest) (json.RawMessage, error) {
+	var stats json.RawMessage
+	err := c.post(ctx, "/mr/flow/split_stats", request, &stats)
+	return stats, err
+}
+
+// GetFlowResultsSummary fetches the results summary of a flow, returning it as JSON
+//
+//   {
+//     "results": [
+//       {"key": "color", "name": "Color", "categories": [{"name": "Blue", "count": 12}, {"name": "Red", "count": 8}], "total": 20}
+//     ],
+//     "runs": {"active": 3, "completed": 20, "interrupted": 1, "expired": 2, "failed": 0, "total": 26, "completion_rate": 0.769},
+//     "segments": [
+//       {"from_uuid": "37d8813f-1402-4ad2-9cc2-e9054a96525b", "to_uuid": "fc156f6e-6e8a-4b8d-9f1e-fb9b2ba1e5d0", "count": 24}
+//     ]
+//   }
+//
+func (c *Client) GetFlowResultsSummary(ctx context.Context, request *FlowResultsSummaryRequest) (json.RawMessage, error) {
+	var summary json.RawMessage
+	err := c.post(ctx, "/mr/flow/results_summary", request, &summary)
+	return summary, err
+}
+
+// GetFlowFunnel fetches the funnel of a flow, returning it as JSON. Conversions are of the runs which entered and
+// step conversions are of the runs which reached the step before.
+//
+//   {
+//     "funnel": {
+//       "since": "2020-05-01T00:00:00Z",
+//       "until": "2020-06-01T00:00:00Z",
+//       "steps": [
+//         {"type": "entered", "count": 200, "conversion": 1, "step_conversion": 1},
+//         {"type": "node", "node_uuid": "cd2b9e8e-6b1a-4e70-a5b7-1b9e5f6c6f1e", "count": 150, "conversion": 0.75, "step_conversion": 0.75},
+//         {"type": "node", "node_uuid": "b7bb5e7c-ad49-4e65-9e24-bf7f1e4ff00a", "count": 90, "conversion": 0.45, "step_conversion": 0.6},
+//         {"type": "completed", "count": 80, "conversion": 0.4, "step_conversion": 0.889}
+//       ]
+//     },
+//     "comparison": {...}
+//   }
+//
+func (c *Client) GetFlowFunnel(ctx context.Context, request *FlowFunnelRequest) (json.RawMessage, error) {
+	var funnel json.RawMessage
+	err := c.post(ctx, "/mr/flow/funnel", request, &funnel)
+	return funnel, err
+}
+
+// ScheduleFlowStart schedules a start of contacts in a flow, returning the schedule and trigger which were created
+func (c *Client) ScheduleFlowStart(ctx context.Context, request *FlowScheduleStartRequest) (*FlowScheduleStartResponse, error) {
+	response := &FlowScheduleStartResponse{}
+	if err := c.post(ctx, "/mr/flow/schedule_start", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/utils/uuids"
+)
+
+// MsgBroadcastTranslation is the content of a broadcast in a single language
+type MsgBroadcastTranslation struct {
+	Text         string   `json:"text"`
+	Attachments  []string `json:"attachments,omitempty"`
+	QuickReplies []string `json:"quick_replies,omitempty"`
+}
+
+// MsgBroadcastRequest sends a broadcast to contacts given by ID, URN or group. Each contact is sent the translation
+// for their language, falling back to the org's default language and then the base language. Text is evaluated as a
+// template which can reference @contact, @fields, @globals, @urns and the passed in @variables. If a channel is given,
+// it's used to send to any contact with a URN it supports, and other contacts are sent to with their usual channel.
+// Contacts are created for any URNs which don't belong to a contact yet.
+//
+//   {
+//     "org_id": 1,
+//     "translations": {
+//       "eng": {"text": "Hi @contact.name, your appointment is on @variables.date"},
+//       "fra": {"text": "Bonjour @contact.name, votre rendez-vous est le @variables.date"}
+//     },
+//     "base_language": "eng",
+//     "contact_ids": [12, 34],
+//     "group_ids": [56],
+//     "urns": ["tel:+250788123123"],
+//     "channel_uuid": "ac4c718a-db3f-4d8a-ae43-321f1a5bd44a",
+//     "variables": {"date": "Monday"}
+//   }
+//
+type MsgBroadcastRequest struct {
+	OrgID        int                                        `json:"org_id"        validate:"required"`
+	Translations map[envs.Language]*MsgBroadcastTranslation `json:"translations"  validate:"required"`
+	BaseLanguage envs.Language                              `json:"base_language" validate:"required"`
+	ContactIDs   []int64                                    `json:"contact_ids,omitempty"`
+	GroupIDs     []int64                                    `json:"group_ids,omitempty"`
+	URNs         []urns.URN                                 `json:"urns,omitempty"`
+	ChannelUUID  assets.ChannelUUID                         `json:"channel_uuid,omitempty"`
+	Variables    map[string]string                          `json:"variables,omitempty"`
+}
+
+// MsgBroadcastResponse is the response for a broadcast request
+//
+//   {
+//     "broadcast_id": 123
+//   }
+//
+type MsgBroadcastResponse struct {
+	BroadcastID int64 `json:"broadcast_id"`
+}
+
+// MsgFilter is a filter on the messages of an org, which must match all of the conditions which are given
+type MsgFilter struct {
+	Text      string     `json:"text,omitempty"`
+	LabelIDs  []int64    `json:"label_ids,omitempty"`
+	FlowID    int64      `json:"flow_id,omitempty"`
+	GroupIDs  []int64    `json:"group_ids,omitempty"`
+	After     *time.Time `json:"after,omitempty"`
+	Before    *time.Time `json:"before,omitempty"`
+	Unhandled bool       `json:"unhandled,omitempty"`
+}
+
+// MsgView is a saved filter on the messages of an org, with the count of messages it matches
+type MsgView struct {
+	UUID   uuids.UUID `json:"uuid"`
+	Name   string     `json:"name"`
+	Filter *MsgFilter `json:"filter"`
+	Count  int        `json:"count"`
+}
+
+// MsgViewSaveRequest saves a message view for an org, replacing any existing view with the same UUID. A UUID is
+// generated if one isn't provided. The view is returned with its current count.
+//
+//   {
+//     "org_id": 1,
+//     "uuid": "0e9a5a1e-5f1d-4d5c-9a8f-2e6d3c1b7a40",
+//     "name": "VIP Unhandled",
+//     "filter": {"group_ids": [12], "unhandled": true}
+//   }
+//
+type MsgViewSaveRequest struct {
+	OrgID  int        `json:"org_id" validate:"required"`
+	UUID   uuids.UUID `json:"uuid,omitempty"`
+	Name   string     `json:"name"   validate:"required"`
+	Filter *MsgFilter `json:"filter" validate:"required"`
+}
+
+// MsgViewDeleteRequest deletes a message view from an org
+//
+//   {
+//     "org_id": 1,
+//     "uuid": "0e9a5a1e-5f1d-4d5c-9a8f-2e6d3c1b7a40"
+//   }
+//
+type MsgViewDeleteRequest struct {
+	OrgID int        `json:"org_id" validate:"required"`
+	UUID  uuids.UUID `json:"uuid"   validate:"required"`
+}
+
+// MsgViewListRequest lists the message views of an org with their counts, which are kept up to date every minute
+//
+//   {
+//     "org_id": 1
+//   }
+//
+type MsgViewListRequest struct {
+	OrgID int `json:"org_id" validate:"required"`
+}
+
+// MsgViewListResponse is the response for a list views request
+//
+//   {
+//     "views": [
+//       {
+//         "uuid": "0e9a5a1e-5f1d-4d5c-9a8f-2e6d3c1b7a40",
+//         "name": "VIP Unhandled",
+//         "filter": {"group_ids": [12], "unhandled": true},
+//         "count": 23
+//       }
+//     ]
+//   }
+//
+type MsgViewListResponse struct {
+	Views []*MsgView `json:"views"`
+}
+
+// MsgViewMsgsRequest fetches a page of the ids of the messages in a view, newest first. To get the next page, pass
+// the last id of the previous page as before_id.
+//
+//   {
+//     "org_id": 1,
+//     "uuid": "0e9a5a1e-5f1d-4d5c-9a8f-2e6d3c1b7a40",
+//     "before_id": 12345,
+//     "limit": 50
+//   }
+//
+type MsgViewMsgsRequest struct {
+	OrgID    int        `json:"org_id"              validate:"required"`
+	UUID     uuids.UUID `json:"uuid"                validate:"required"`
+	BeforeID int64      `json:"before_id,omitempty"`
+	Limit    int        `json:"limit,omitempty"     validate:"omitempty,min=1,max=500"`
+}
+
+// MsgViewMsgsResponse is the response for a view msgs request
+//
+//   {
+//     "msg_ids": [12344, 12340, 12338]
+//   }
+//
+type MsgViewMsgsResponse struct {
+	MsgIDs []int64 `json:"msg_ids"`
+}
+
+// MsgCheckLengthRequest checks how each translation of a message, e.g. a broadcast being composed, will be sent as
+// SMS, warning if it's long or will be truncated on any of the org's channels. The org is optional, without it
+// channels aren't checked.
+//
+//   {
+//     "org_id": 1,
+//     "translations": {"eng": "Hello @contact.name", "fra": "Bonjour @contact.name"}
+//   }
+//
+type MsgCheckLengthRequest struct {
+	OrgID        int               `json:"org_id,omitempty"`
+	Translations map[string]string `json:"translations" validate:"required,min=1"`
+}
+
+// SendBroadcast queues a broadcast for sending, returning the id of the broadcast which was created
+func (c *Client) SendBroadcast(ctx context.Context, request *MsgBroadcastRequest) (*MsgBroadcastResponse, error) {
+	response := &MsgBroadcastResponse{}
+	if err := c.post(ctx, "/mr/msg/broadcast", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// SaveMsgView saves a message view, returning the saved view with its count
+func (c *Client) SaveMsgView(ctx context.Context, request *MsgViewSaveRequest) (*MsgView, error) {
+	response := &MsgView{}
+	if err := c.post(ctx, "/mr/msg/view/save", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// DeleteMsgView deletes a message view
+func (c *Client) DeleteMsgView(ctx context.Context, request *MsgViewDeleteRequest) error {
+	return c.post(ctx, "/mr/msg/view/delete", request, &struct{}{})
+}
+
+// ListMsgViews lists the message views of an org
+func (c *Client) ListMsgViews(ctx context.Context, request *MsgViewListRequest) (*MsgViewListResponse, error) {
+	response := &MsgViewListResponse{}
+	if err := c.post(ctx, "/mr/msg/view/list", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetMsgViewMsgs fetches a page of the ids of the messages in a view
+func (c *Client) GetMsgViewMsgs(ctx context.Context, request *MsgViewMsgsRequest) (*MsgViewMsgsResponse, error) {
+	response := &MsgViewMsgsResponse{}
+	if err := c.post(ctx, "/mr/msg/view/msgs", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// CheckMsgLength checks how the translations of a message will be sent as SMS, returning the result as JSON
+//
+//   {
+//     "translations": {
+//       "eng": {"encoding": "gsm7", "length": 19, "segments": 1, "warnings": []},
+//       "fra": {"encoding": "gsm7", "length": 21, "segments": 1, "warnings": []}
+//     }
+//   }
+//
+func (c *Client) CheckMsgLength(ctx context.Context, request *MsgCheckLengthRequest) (json.RawMessage, error) {
+	var lengths json.RawMessage
+	err := c.post(ctx, "/mr/msg/check_length", request, &lengths)
+	return lengths, err
+}
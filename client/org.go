@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// OrgPauseSendingRequest pauses or unpauses all automated outgoing messages for an org. If no org is specified then
+// sending is paused or unpaused globally. Messages created while sending is paused are recorded as failed.
+//
+//   {
+//     "org_id": 1,
+//     "paused": true
+//   }
+//
+type OrgPauseSendingRequest struct {
+	OrgID  int  `json:"org_id,omitempty"`
+	Paused bool `json:"paused"`
+}
+
+// OrgPauseSendingResponse is the response for a pause sending request, with the effective state of sending for the
+// org, which may still be paused if sending is paused globally
+//
+//   {
+//     "org_id": 1,
+//     "paused": true
+//   }
+//
+type OrgPauseSendingResponse struct {
+	OrgID  int  `json:"org_id"`
+	Paused bool `json:"paused"`
+}
+
+// OrgPauseSchedulesRequest pauses or resumes schedules for an org. If no schedules are specified then all of the org's
+// schedules are paused or resumed. Paused schedules which repeat skip any fires while paused, one-off schedules fire
+// when resumed.
+//
+//   {
+//     "org_id": 1,
+//     "schedule_ids": [12, 34],
+//     "paused": true
+//   }
+//
+type OrgPauseSchedulesRequest struct {
+	OrgID       int     `json:"org_id"       validate:"required"`
+	ScheduleIDs []int64 `json:"schedule_ids,omitempty"`
+	Paused      bool    `json:"paused"`
+}
+
+// OrgPauseSchedulesResponse is the response for a pause schedules request
+//
+//   {
+//     "org_id": 1,
+//     "schedule_ids": [12, 34],
+//     "paused": true
+//   }
+//
+type OrgPauseSchedulesResponse struct {
+	OrgID       int     `json:"org_id"`
+	ScheduleIDs []int64 `json:"schedule_ids,omitempty"`
+	Paused      bool    `json:"paused"`
+}
+
+// OrgUsageRequest fetches the usage counters of an org for a period, which is a calendar month in UTC. If no period is
+// specified then the current month is used.
+//
+//   {
+//     "org_id": 1,
+//     "period": "2020-03"
+//   }
+//
+type OrgUsageRequest struct {
+	OrgID  int    `json:"org_id"  validate:"required"`
+	Period string `json:"period,omitempty"`
+}
+
+// OrgUsageResponse is the response for a usage request
+//
+//   {
+//     "org_id": 1,
+//     "period": "2020-03",
+//     "usage": {
+//       "msgs_handled": 1234,
+//       "sessions_run": 567,
+//       "ivr_minutes": 89,
+//       "classifier_calls": 12,
+//       "airtime_transfers": 3
+//     }
+//   }
+//
+type OrgUsageResponse struct {
+	OrgID  int            `json:"org_id"`
+	Period string         `json:"period"`
+	Usage  map[string]int `json:"usage"`
+}
+
+// OrgWebhookHealthRequest fetches how the calls made to webhooks by an org's flows fared on a day in UTC, by host,
+// those with the most failures first. If no day is specified then today is used. Health is kept for a week.
+//
+//   {
+//     "org_id": 1,
+//     "day": "2020-03-15"
+//   }
+//
+type OrgWebhookHealthRequest struct {
+	OrgID int    `json:"org_id"  validate:"required"`
+	Day   string `json:"day,omitempty"`
+}
+
+// OrgExportPromotionRequest exports the flows, globals, campaigns and triggers of an org which changed since a point in
+// time, as a package which can be applied to another org, e.g. to promote changes made in a staging org to a
+// production org. Campaigns only include events which start flows, and schedule triggers aren't included.
+//
+//   {
+//     "org_id": 1,
+//     "since": "2020-03-01T00:00:00Z"
+//   }
+//
+type OrgExportPromotionRequest struct {
+	OrgID int       `json:"org_id"  validate:"required"`
+	Since time.Time `json:"since"   validate:"required"`
+}
+
+// OrgApplyPromotionRequest applies a promotion package exported from another org to an org. Anything in the package
+// which has also changed in the org since the package's since time, or which depends on something the org doesn't
+// have, is a conflict and if there are any conflicts nothing is applied. If dry_run is true then nothing is applied
+// regardless. Flows and campaigns are matched with those of the org by name, and those created are given new UUIDs.
+//
+//   {
+//     "org_id": 2,
+//     "user_id": 3,
+//     "package": {"source_org_id": 1, "since": "2020-03-01T00:00:00Z", "flows": [...], ...},
+//     "dry_run": true
+//   }
+//
+type OrgApplyPromotionRequest struct {
+	OrgID   int             `json:"org_id"   validate:"required"`
+	UserID  int64           `json:"user_id"  validate:"required"`
+	Package json.RawMessage `json:"package"  validate:"required"`
+	DryRun  bool            `json:"dry_run"`
+}
+
+// PauseOrgSending pauses or unpauses sending, returning the effective state of sending
+func (c *Client) PauseOrgSending(ctx context.Context, request *OrgPauseSendingRequest) (*OrgPauseSendingResponse, error) {
+	response := &OrgPauseSendingResponse{}
+	if err := c.post(ctx, "/mr/org/pause_sending", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// PauseOrgSchedules pauses or resumes the schedules of an org
+func (c *Client) PauseOrgSchedules(ctx context.Context, request *OrgPauseSchedulesRequest) (*OrgPauseSchedulesResponse, error) {
+	response := &OrgPauseSchedulesResponse{}
+	if err := c.post(ctx, "/mr/org/pause_schedules", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetOrgUsage fetches the usage counters of an org for a period
+func (c *Client) GetOrgUsage(ctx context.Context, request *OrgUsageRequest) (*OrgUsageResponse, error) {
+	response := &OrgUsageResponse{}
+	if err := c.post(ctx, "/mr/org/usage", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetOrgWebhookHealth fetches the webhook health of an org for a day, returning it as JSON
+//
+//   {
+//     "org_id": 1,
+//     "day": "2020-03-15",
+//     "hosts": [
+//       {"host": "api.example.com", "calls": 120, "failures": 30, "failure_rate": 0.25, "mean_elapsed_ms": 850}
+//     ]
+//   }
+//
+func (c *Client) GetOrgWebhookHealth(ctx context.Context, request *OrgWebhookHealthRequest) (json.RawMessage, error) {
+	var health json.RawMessage
+	err := c.post(ctx, "/mr/org/webhook_health", request, &health)
+	return health, err
+}
+
+// ExportOrgPromotion exports a promotion package from an org, returning the package as JSON which can be passed to
+// ApplyOrgPromotion for another org
+func (c *Client) ExportOrgPromotion(ctx context.Context, request *OrgExportPromotionRequest) (json.RawMessage, error) {
+	var pkg json.RawMessage
+	err := c.post(ctx, "/mr/org/export_promotion", request, &pkg)
+	return pkg, err
+}
+
+// ApplyOrgPromotion applies a promotion package to an org, returning the changes made, or which would have been made
+// if there are conflicts or it's a dry run, as JSON
+//
+//   {
+//     "conflicts": [
+//       {"type": "flow", "key": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "reason": "missing dependency group[uuid=...,name=Testers]"}
+//     ],
+//     "changes": [
+//       {"type": "flow", "key": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "action": "updated"},
+//       {"type": "global", "key": "org_name", "action": "created"}
+//     ],
+//     "applied": false
+//   }
+//
+func (c *Client) ApplyOrgPromotion(ctx context.Context, request *OrgApplyPromotionRequest) (json.RawMessage, error) {
+	var result json.RawMessage
+	err := c.post(ctx, "/mr/org/apply_promotion", request, &result)
+	return result, err
+}
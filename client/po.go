@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nyaruka/goflow/envs"
+)
+
+// POExportRequest extracts the translatable strings in a set of flows into a gettext PO file for translating into
+// the given language. Each string appears once with a reference to every place it's used, and the msgstr of each is
+// its existing translation, if it has one.
+//
+//   {
+//     "flows": [{"uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "spec_version": "13.0.0", ...}],
+//     "language": "spa"
+//   }
+//
+type POExportRequest struct {
+	Flows    []json.RawMessage `json:"flows"    validate:"required"`
+	Language envs.Language     `json:"language" validate:"required"`
+}
+
+// POExportResponse is the response for a PO export
+//
+//   {
+//     "po": "# Generated by mailroom\nmsgid \"\"\nmsgstr \"\"\n..."
+//   }
+//
+type POExportResponse struct {
+	PO string `json:"po"`
+}
+
+// ExportPO exports the translatable strings in flows as a PO file
+func (c *Client) ExportPO(ctx context.Context, request *POExportRequest) (*POExportResponse, error) {
+	response := &POExportResponse{}
+	if err := c.post(ctx, "/mr/po/export", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// POImportRequest applies the translations in a PO file to a set of flows as the given language. Translations which
+// conflict with the flows, because the string they translate has changed or no longer exists, or already has a
+// different translation, aren't applied unless overwrite is set, in which case only the last of those is applied.
+//
+//   {
+//     "flows": [{"uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "spec_version": "13.0.0", ...}],
+//     "language": "spa",
+//     "po": "# Generated by mailroom\nmsgid \"\"\nmsgstr \"\"\n...",
+//     "overwrite": false
+//   }
+//
+type POImportRequest struct {
+	Flows     []json.RawMessage `json:"flows"    validate:"required"`
+	Language  envs.Language     `json:"language" validate:"required"`
+	PO        string            `json:"po"       validate:"required"`
+	Overwrite bool              `json:"overwrite"`
+}
+
+// POImportConflict is a translation which couldn't be applied
+type POImportConflict struct {
+	Reference string `json:"reference"`
+	MsgID     string `json:"msgid"`
+	MsgStr    string `json:"msgstr"`
+	Reason    string `json:"reason"`
+}
+
+// POImportResponse is the response for a PO import, with the updated flows in the order they were requested
+//
+//   {
+//     "flows": [{"uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "spec_version": "13.0.0", ...}],
+//     "applied": 12,
+//     "conflicts": [
+//       {
+//         "reference": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85/4c5b8e6b-3b7f-4b3a-9f7e-3d6c1a1b2c3d/text:0",
+//         "msgid": "What is your favorite color?",
+//         "msgstr": "¿Cuál es tu color favorito?",
+//         "reason": "string has changed"
+//       }
+//     ]
+//   }
+//
+type POImportResponse struct {
+	Flows     []json.RawMessage   `json:"flows"`
+	Applied   int                 `json:"applied"`
+	Conflicts []*POImportConflict `json:"conflicts"`
+}
+
+// ImportPO applies the translations in a PO file to flows
+func (c *Client) ImportPO(ctx context.Context, request *POImportRequest) (*POImportResponse, error) {
+	response := &POImportResponse{}
+	if err := c.post(ctx, "/mr/po/import", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/nyaruka/goflow/flows"
+)
+
+// SessionDebugRequest fetches a redacted view of a session for debugging, including its status, current wait and a
+// timeline of the events of its runs. Message text, URNs, result values and webhook payloads are not included. The
+// session can be identified by its UUID or by the UUID of one of its runs.
+//
+//   {
+//     "org_id": 1,
+//     "session_uuid": "c7a9e2a8-bcd4-4fb5-92ad-bd3fb5a0f1a3"
+//   }
+//
+type SessionDebugRequest struct {
+	OrgID       int               `json:"org_id"       validate:"required"`
+	SessionUUID flows.SessionUUID `json:"session_uuid,omitempty"`
+	RunUUID     flows.RunUUID     `json:"run_uuid,omitempty"`
+}
+
+// SessionInterruptRequest interrupts the waiting sessions of the passed in contacts, of calls on the passed in
+// channels and of the passed in flows. If dry_run is set, the sessions which would be interrupted are returned but
+// nothing is interrupted.
+//
+//   {
+//     "org_id": 1,
+//     "contact_ids": [12, 34],
+//     "flow_ids": [56],
+//     "dry_run": true
+//   }
+//
+type SessionInterruptRequest struct {
+	OrgID      int     `json:"org_id"      validate:"required"`
+	ContactIDs []int64 `json:"contact_ids,omitempty"`
+	ChannelIDs []int64 `json:"channel_ids,omitempty"`
+	FlowIDs    []int64 `json:"flow_ids,omitempty"`
+	DryRun     bool    `json:"dry_run,omitempty"`
+}
+
+// SessionInterruptResponse is the response for an interrupt request, with the sessions which are being interrupted,
+// or for a dry run, which would be
+//
+//   {
+//     "session_ids": [2345, 2346],
+//     "dry_run": true
+//   }
+//
+type SessionInterruptResponse struct {
+	SessionIDs []int64 `json:"session_ids"`
+	DryRun     bool    `json:"dry_run"`
+}
+
+// SessionCallbackResponse is the response for a callback, resuming happens asynchronously
+//
+//   {"status": "queued"}
+//
+type SessionCallbackResponse struct {
+	Status string `json:"status"`
+}
+
+// DebugSession fetches a debug view of a session, returning it as JSON
+func (c *Client) DebugSession(ctx context.Context, request *SessionDebugRequest) (json.RawMessage, error) {
+	var debug json.RawMessage
+	err := c.post(ctx, "/mr/session/debug", request, &debug)
+	return debug, err
+}
+
+// InterruptSessions interrupts the sessions of contacts, channels or flows, returning the sessions being interrupted
+func (c *Client) InterruptSessions(ctx context.Context, request *SessionInterruptRequest) (*SessionInterruptResponse, error) {
+	response := &SessionInterruptResponse{}
+	if err := c.post(ctx, "/mr/session/interrupt", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// SendSessionCallback posts the passed in body to the callback with the passed in token, which is the last part of
+// the callback URL sent to a webhook, to resume the run waiting for it
+func (c *Client) SendSessionCallback(ctx context.Context, token string, body []byte) (*SessionCallbackResponse, error) {
+	response := &SessionCallbackResponse{}
+	if err := c.postBody(ctx, "/mr/session/callback/"+url.PathEscape(token), body, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
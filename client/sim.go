@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nyaruka/goflow/assets"
+)
+
+// SimFlow is a flow definition to simulate in place of the org's saved revision, which can be a legacy definition
+type SimFlow struct {
+	UUID             assets.FlowUUID `json:"uuid"                        validate:"required"`
+	Definition       json.RawMessage `json:"definition,omitempty"`
+	LegacyDefinition json.RawMessage `json:"legacy_definition,omitempty"`
+}
+
+// SimStartRequest starts a new simulated session. Flow definitions and assets in the request are layered over the
+// org's real assets so that unsaved flow revisions, test channels and draft fields and groups can be simulated. Stubs
+// in the request are used as the responses of webhooks, classifiers and airtime transfers. Webhook calls and
+// classifications which aren't stubbed fail so that no external calls are made, unless passthrough is set.
+//
+//   {
+//     "org_id": 1,
+//     "flows": [{"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "definition": {...}}],
+//     "trigger": {...},
+//     "assets": {
+//       "channels": [...],
+//       "fields": [{"uuid": "f1b5aea6-6586-41c7-9020-1a6326cc6565", "key": "nickname", "name": "Nickname", "type": "text"}],
+//       "groups": [{"uuid": "5e9d8fab-5e7e-4f51-b533-261af5dea70d", "name": "VIPs", "query": "nickname != \"\""}]
+//     },
+//     "stubs": {
+//       "webhooks": {"http://example.com/lookup": {"status": 200, "body": "{\"name\": \"Bob\"}"}},
+//       "classifications": {"097e026c-ae79-4740-af67-656dbedf0263": {"intents": [{"name": "book_flight", "confidence": 0.9}]}},
+//       "airtime": {"error": "insufficient balance"},
+//       "passthrough": false
+//     }
+//   }
+//
+type SimStartRequest struct {
+	OrgID   int             `json:"org_id"  validate:"required"`
+	Flows   []*SimFlow      `json:"flows,omitempty"`
+	Trigger json.RawMessage `json:"trigger" validate:"required"`
+	Assets  json.RawMessage `json:"assets,omitempty"`
+	Stubs   json.RawMessage `json:"stubs,omitempty"`
+}
+
+// SimResumeRequest resumes a simulated session, with the same flows, assets and stubs as a start request
+//
+//   {
+//     "org_id": 1,
+//     "flows": [{"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "definition": {...}}],
+//     "session": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "runs": [...], ...},
+//     "resume": {...},
+//     "assets": {...},
+//     "stubs": {...}
+//   }
+//
+type SimResumeRequest struct {
+	OrgID   int             `json:"org_id"  validate:"required"`
+	Flows   []*SimFlow      `json:"flows,omitempty"`
+	Session json.RawMessage `json:"session" validate:"required"`
+	Resume  json.RawMessage `json:"resume"  validate:"required"`
+	Assets  json.RawMessage `json:"assets,omitempty"`
+	Stubs   json.RawMessage `json:"stubs,omitempty"`
+}
+
+// SimTranscriptRequest builds a transcript of a simulated session, as returned by a start or resume, with the messages
+// exchanged, results set and webhooks called. If html is true then the transcript is also rendered as a standalone
+// HTML document.
+//
+//   {
+//     "session": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "runs": [...], ...},
+//     "html": true
+//   }
+//
+type SimTranscriptRequest struct {
+	Session json.RawMessage `json:"session" validate:"required"`
+	HTML    bool            `json:"html"`
+}
+
+// StartSimulation starts a simulated session, returning the session, its events and its context as JSON
+//
+//   {
+//     "session": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "runs": [...], ...},
+//     "events": [...],
+//     "context": {...}
+//   }
+//
+func (c *Client) StartSimulation(ctx context.Context, request *SimStartRequest) (json.RawMessage, error) {
+	var simulation json.RawMessage
+	err := c.post(ctx, "/mr/sim/start", request, &simulation)
+	return simulation, err
+}
+
+// ResumeSimulation resumes a simulated session, returning the session, its new events and its context as JSON
+func (c *Client) ResumeSimulation(ctx context.Context, request *SimResumeRequest) (json.RawMessage, error) {
+	var simulation json.RawMessage
+	err := c.post(ctx, "/mr/sim/resume", request, &simulation)
+	return simulation, err
+}
+
+// SimulationTranscript builds a transcript of a simulated session, returning it as JSON
+//
+//   {
+//     "transcript": {
+//       "session_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//       "status": "completed",
+//       "contact": "Ben Haggerty",
+//       "entries": [
+//         {"type": "msg_out", "created_on": "2020-04-15T12:00:00Z", "flow": "Favorites", "text": "What is your favorite color?"},
+//         {"type": "msg_in", "created_on": "2020-04-15T12:00:05Z", "flow": "Favorites", "text": "red"}
+//       ],
+//       "results": [
+//         {"flow": "Favorites", "name": "Color", "value": "red", "category": "Red", "created_on": "2020-04-15T12:00:05Z"}
+//       ]
+//     },
+//     "html": "<!DOCTYPE html>..."
+//   }
+//
+func (c *Client) SimulationTranscript(ctx context.Context, request *SimTranscriptRequest) (json.RawMessage, error) {
+	var transcript json.RawMessage
+	err := c.post(ctx, "/mr/sim/transcript", request, &transcript)
+	return transcript, err
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nyaruka/goflow/flows"
+)
+
+// SurveyorSubmitRequest submits a session completed offline in Surveyor along with its events and modifiers
+//
+//   {
+//     "session": {...},
+//     "events": [{...}],
+//     "modifiers": [{...}]
+//   }
+//
+type SurveyorSubmitRequest struct {
+	Session   json.RawMessage   `json:"session"    validate:"required"`
+	Events    []json.RawMessage `json:"events"`
+	Modifiers []json.RawMessage `json:"modifiers"`
+}
+
+// SurveyorSubmitResponse is the response for a surveyor submission
+//
+//   {
+//     "session": {"id": 12, "status": "C"},
+//     "contact": {"id": 10000, "uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf"}
+//   }
+//
+type SurveyorSubmitResponse struct {
+	Session struct {
+		ID     int64  `json:"id"`
+		Status string `json:"status"`
+	} `json:"session"`
+	Contact struct {
+		ID   flows.ContactID   `json:"id"`
+		UUID flows.ContactUUID `json:"uuid"`
+	} `json:"contact"`
+}
+
+// SubmitSurveyorSession submits a surveyor session. Unlike other routes this requires a user API token rather than
+// the mailroom auth token, so the client should be created with the token of the submitting user.
+func (c *Client) SubmitSurveyorSession(ctx context.Context, request *SurveyorSubmitRequest) (*SurveyorSubmitResponse, error) {
+	response := &SurveyorSubmitResponse{}
+	if err := c.post(ctx, "/mr/surveyor/submit", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+)
+
+// TriggerConflictsRequest checks a prospective trigger for conflicts with the existing triggers of an org. Keywords are
+// only considered for keyword triggers, channels for new conversation and referral triggers, and groups for keyword,
+// catch all and call triggers, which is how they are matched.
+//
+//   {
+//     "org_id": 1,
+//     "trigger_type": "K",
+//     "keyword": "join",
+//     "match_type": "F",
+//     "group_ids": [12],
+//     "channel_id": null,
+//     "referrer_id": ""
+//   }
+//
+type TriggerConflictsRequest struct {
+	OrgID       int    `json:"org_id"       validate:"required"`
+	TriggerType string `json:"trigger_type" validate:"required"`
+	Keyword     string `json:"keyword"`
+	MatchType   string `json:"match_type"`
+	GroupIDs    []int  `json:"group_ids"`
+	ChannelID   int    `json:"channel_id"`
+	ReferrerID  string `json:"referrer_id"`
+}
+
+// TriggerConflict is an existing trigger which conflicts with a prospective one. A type of "ambiguous" means both
+// triggers would match the same messages or events with the same precedence, "overlaps" means they would match some
+// of the same messages or events with the same precedence, e.g. from contacts in both of their groups, "shadows" means
+// the new trigger would take precedence over the existing one for some contacts or channels, and "shadowed" means the
+// existing trigger would take precedence.
+type TriggerConflict struct {
+	TriggerID int    `json:"trigger_id"`
+	FlowID    int    `json:"flow_id"`
+	Type      string `json:"type"`
+}
+
+// TriggerConflictsResponse is the response for a trigger conflicts request
+//
+//   {
+//     "conflicts": [
+//       {"trigger_id": 23, "flow_id": 4, "type": "ambiguous"}
+//     ]
+//   }
+//
+type TriggerConflictsResponse struct {
+	Conflicts []*TriggerConflict `json:"conflicts"`
+}
+
+// CheckTriggerConflicts checks a prospective trigger for conflicts with existing triggers
+func (c *Client) CheckTriggerConflicts(ctx context.Context, request *TriggerConflictsRequest) (*TriggerConflictsResponse, error) {
+	response := &TriggerConflictsResponse{}
+	if err := c.post(ctx, "/mr/trigger/conflicts", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
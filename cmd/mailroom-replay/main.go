@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/ezconf"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	Redis   string `help:"URL for your Redis instance"`
+	TaskLog string `help:"path of the task log to replay tasks from"`
+	From    string `help:"the start of the window of tasks to replay, as an RFC3339 timestamp"`
+	To      string `help:"the end of the window of tasks to replay, as an RFC3339 timestamp, defaults to now"`
+	DryRun  bool   `help:"whether to only count the tasks which would be replayed"`
+}
+
+func main() {
+	options := &Config{
+		Redis: "redis://localhost:6379/15",
+	}
+
+	// use the same env prefix as mailroom itself so it can be run with the same environment
+	loader := ezconf.NewLoader(
+		options,
+		"mailroom", "Mailroom Replay - requeues tasks from a task log, e.g. after a Redis failure",
+		nil,
+	)
+	loader.MustLoad()
+
+	if options.TaskLog == "" || options.From == "" {
+		logrus.Fatal("task log and from must be specified")
+	}
+
+	from, err := time.Parse(time.RFC3339, options.From)
+	if err != nil {
+		logrus.WithError(err).Fatalf("invalid from: %s", options.From)
+	}
+	to := time.Now()
+	if options.To != "" {
+		to, err = time.Parse(time.RFC3339, options.To)
+		if err != nil {
+			logrus.WithError(err).Fatalf("invalid to: %s", options.To)
+		}
+	}
+
+	f, err := os.Open(options.TaskLog)
+	if err != nil {
+		logrus.WithError(err).Fatalf("unable to open task log: %s", options.TaskLog)
+	}
+	defer f.Close()
+
+	entries, err := queue.ReadTaskLog(f, from, to)
+	if err != nil {
+		logrus.WithError(err).Fatal("error reading task log")
+	}
+
+	if options.DryRun {
+		fmt.Printf("%d tasks would be replayed\n", len(entries))
+		return
+	}
+
+	rc, err := redis.DialURL(options.Redis)
+	if err != nil {
+		logrus.WithError(err).Fatalf("unable to connect to redis: %s", options.Redis)
+	}
+	defer rc.Close()
+
+	err = queue.ReplayTasks(rc, entries)
+	if err != nil {
+		logrus.WithError(err).Fatal("error replaying tasks")
+	}
+
+	fmt.Printf("%d tasks replayed\n", len(entries))
+}
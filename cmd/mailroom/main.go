@@ -11,26 +11,49 @@ import (
 	"github.com/nyaruka/logrus_sentry"
 	"github.com/nyaruka/mailroom"
 	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/models"
 	"github.com/sirupsen/logrus"
 
 	_ "github.com/nyaruka/mailroom/hooks"
+	_ "github.com/nyaruka/mailroom/tasks/anonymize"
+	_ "github.com/nyaruka/mailroom/tasks/audit"
 	_ "github.com/nyaruka/mailroom/tasks/broadcasts"
 	_ "github.com/nyaruka/mailroom/tasks/campaigns"
+	_ "github.com/nyaruka/mailroom/tasks/email"
 	_ "github.com/nyaruka/mailroom/tasks/expirations"
+	_ "github.com/nyaruka/mailroom/tasks/fields"
 	_ "github.com/nyaruka/mailroom/tasks/interrupts"
 	_ "github.com/nyaruka/mailroom/tasks/ivr"
+	_ "github.com/nyaruka/mailroom/tasks/monitoring"
+	_ "github.com/nyaruka/mailroom/tasks/msgviews"
+	_ "github.com/nyaruka/mailroom/tasks/pacing"
+	_ "github.com/nyaruka/mailroom/tasks/resultspush"
+	_ "github.com/nyaruka/mailroom/tasks/revisions"
+	_ "github.com/nyaruka/mailroom/tasks/routing"
 	_ "github.com/nyaruka/mailroom/tasks/schedules"
+	_ "github.com/nyaruka/mailroom/tasks/sessionchecks"
+	_ "github.com/nyaruka/mailroom/tasks/sheetsexport"
+	_ "github.com/nyaruka/mailroom/tasks/splits"
+	_ "github.com/nyaruka/mailroom/tasks/standby"
 	_ "github.com/nyaruka/mailroom/tasks/starts"
 	_ "github.com/nyaruka/mailroom/tasks/stats"
 	_ "github.com/nyaruka/mailroom/tasks/timeouts"
+	_ "github.com/nyaruka/mailroom/tasks/usage"
 
+	_ "github.com/nyaruka/mailroom/web/admin"
 	_ "github.com/nyaruka/mailroom/web/contact"
 	_ "github.com/nyaruka/mailroom/web/docs"
 	_ "github.com/nyaruka/mailroom/web/expression"
+	_ "github.com/nyaruka/mailroom/web/field"
 	_ "github.com/nyaruka/mailroom/web/flow"
 	_ "github.com/nyaruka/mailroom/web/ivr"
+	_ "github.com/nyaruka/mailroom/web/msg"
+	_ "github.com/nyaruka/mailroom/web/org"
+	_ "github.com/nyaruka/mailroom/web/po"
+	_ "github.com/nyaruka/mailroom/web/session"
 	_ "github.com/nyaruka/mailroom/web/simulation"
 	_ "github.com/nyaruka/mailroom/web/surveyor"
+	_ "github.com/nyaruka/mailroom/web/trigger"
 
 	_ "github.com/nyaruka/mailroom/ivr/nexmo"
 	_ "github.com/nyaruka/mailroom/ivr/twiml"
@@ -60,6 +83,9 @@ func main() {
 	}
 	logrus.SetLevel(level)
 
+	// mask PII in log entries for orgs which require it, this is added first so other hooks only see masked values
+	logrus.StandardLogger().Hooks.Add(&models.PIIRedactionHook{})
+
 	// if we have a DSN entry, try to initialize it
 	if config.SentryDSN != "" {
 		hook, err := logrus_sentry.NewSentryHook(config.SentryDSN, []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel})
@@ -9,33 +9,59 @@ func init() {
 
 // Config is our top level configuration object
 type Config struct {
-	SentryDSN  string `help:"the DSN used for logging errors to Sentry"`
-	DB         string `help:"URL for your Postgres database"`
-	DBPoolSize int    `help:"the size of our db pool"`
-	Redis      string `help:"URL for your Redis instance"`
-	Elastic    string `help:"URL for your ElasticSearch service"`
-	Version    string `help:"the version of this mailroom install"`
-	LogLevel   string `help:"the logging level courier should use"`
+	SentryDSN    string `help:"the DSN used for logging errors to Sentry"`
+	DB           string `help:"URL for your Postgres database"`
+	DBPoolSize   int    `help:"the size of our db pool"`
+	Redis        string `help:"URL for your Redis instance"`
+	StandbyRedis string `help:"URL for a standby Redis instance which queued and scheduled tasks are mirrored to"`
+	TaskLog      string `help:"path of a file which queued tasks are appended to so they can be replayed, none if empty"`
+	Elastic      string `help:"URL for your ElasticSearch service"`
+	Version      string `help:"the version of this mailroom install"`
+	LogLevel     string `help:"the logging level courier should use"`
 
 	BatchWorkers   int `help:"the number of go routines that will be used to handle batch events"`
 	HandlerWorkers int `help:"the number of go routines that will be used to handle messages"`
 
-	RetryPendingMessages bool `help:"whether to requeue pending messages older than five minutes to retry"`
+	Canary          bool   `help:"whether this instance is a canary which only handles tasks routed to canary instances"`
+	CanaryPercent   int    `help:"the percentage of orgs whose tasks are routed to canary instances, 0 for none"`
+	CanaryOrgs      string `help:"comma separated ids of orgs whose tasks are always routed to canary instances"`
+	CanaryTaskTypes string `help:"comma separated types of tasks which can be routed to canary instances, all types if empty"`
+
+	WorkerMemoryLimit      int `help:"the heap size in MB above which workers stop starting batch tasks until it drops, 0 for no limit"`
+	MaxFlowDefinitionBytes int `help:"the maximum size in bytes of a flow definition which will be loaded, 0 for no limit"`
+
+	RetryPendingMessages   bool `help:"whether to requeue pending messages older than five minutes to retry"`
+	MsgDedupeWindow        int  `help:"the number of seconds within which repeated incoming messages with the same external id are ignored as duplicates, 0 to disable"`
+	MsgDedupeHashWindow    int  `help:"the number of seconds within which repeated incoming messages without external ids but with the same URN and content are ignored as duplicates, 0 to disable"`
+	StartSuppressionWindow int  `help:"the number of seconds within which repeated keyword trigger or API starts of a contact in the same flow are ignored, 0 to disable"`
+	ContactCacheTTL        int  `help:"the number of seconds contacts loaded to handle messages are cached for, 0 to disable"`
+	SendingPaused          bool `help:"whether all automated outgoing messages are paused, incoming messages are still handled"`
 
 	WebhooksTimeout        int     `help:"the timeout in milliseconds for webhook calls from engine"`
 	WebhooksMaxRetries     int     `help:"the number of times to retry a failed webhook call"`
 	WebhooksMaxBodyBytes   int     `help:"the maximum size of bytes to a webhook call response body"`
 	WebhooksInitialBackoff int     `help:"the initial backoff in milliseconds when retrying a failed webhook call"`
 	WebhooksBackoffJitter  float64 `help:"the amount of jitter to apply to backoff times"`
+	WebhooksMaxLogBytes    int     `help:"the maximum size in bytes of the request and of the response stored in each webhook result, 0 for no limit"`
 	SMTPServer             string  `help:"the smtp configuration for sending emails ex: smtp://user%40password@server:port/?from=foo%40gmail.com"`
 	MaxStepsPerSprint      int     `help:"the maximum number of steps allowed per engine sprint"`
 	MaxValueLength         int     `help:"the maximum size in characters for contact field values and run result values"`
+	MsgSegmentsWarning     int     `help:"the number of SMS segments above which authors are warned that a message is long, 0 to disable"`
+	FlowRevisionsKeepLast  int     `help:"the number of most recent revisions of each flow which are kept when old revisions are pruned, 0 to disable pruning"`
+	FlowRevisionsKeepDays  int     `help:"the number of days for which the last revision of each day is also kept when old revisions are pruned"`
+	AuditOrgs              int     `help:"the number of randomly sampled orgs whose data is audited for consistency every hour, 0 to disable"`
+	AuditRepair            bool    `help:"whether group counts found to have drifted by org audits are repaired"`
 
 	LibratoUsername string `help:"the username that will be used to authenticate to Librato"`
 	LibratoToken    string `help:"the token that will be used to authenticate to Librato"`
 
+	LatencySLO        int    `help:"the milliseconds within which 95% of handler tasks must be started after being queued, 0 to disable SLO monitoring"`
+	LatencySLOMinutes int    `help:"the number of consecutive minutes the latency SLO must be breached for before an incident is opened"`
+	LatencySLOWebhook string `help:"a URL which latency SLO incidents are posted to when they are opened and resolved, none if empty"`
+
 	Domain           string `help:"the domain that mailroom is listening on"`
 	AttachmentDomain string `help:"the domain that will be used for relative attachment"`
+	CallbackSecret   string `help:"the secret used to sign the URLs which external systems call to resume waiting runs, callbacks are disabled if empty"`
 
 	S3Endpoint         string `help:"the S3 endpoint we will write attachments to"`
 	S3Region           string `help:"the S3 region we will write attachments to"`
@@ -46,11 +72,25 @@ type Config struct {
 	AWSAccessKeyID     string `help:"the access key id to use when authenticating S3"`
 	AWSSecretAccessKey string `help:"the secret access key id to use when authenticating S3"`
 
+	MsgGateway      string `help:"how outgoing messages are handed off for sending, either courier (queued in redis) or http"`
+	MsgGatewayURL   string `help:"the URL outgoing messages are pushed to when using the http msg gateway"`
+	MsgGatewayToken string `help:"the token sent with outgoing messages pushed to the http msg gateway"`
+
+	AssetSource      string `help:"where org assets are loaded from, either db, http (fetched from an asset server) or static (JSON bundles in a directory)"`
+	AssetServerURL   string `help:"the URL org asset bundles are fetched from, followed by the org id, when using the http asset source"`
+	AssetServerToken string `help:"the token sent with requests to the asset server when using the http asset source"`
+	AssetBundlesDir  string `help:"the directory of org asset bundles, named by org id like 1.json, when using the static asset source"`
+
+	RehostMediaChannelTypes string `help:"comma separated types of channels whose incoming attachments are downloaded and re-hosted on S3 as their URLs expire"`
+
 	FCMKey string `help:"the FCM API key used to notify Android relayers to sync"`
 
 	AuthToken string `help:"the token clients will need to authenticate web requests"`
 	Address   string `help:"the address to bind our web server to"`
 	Port      int    `help:"the port to bind our web server to"`
+
+	WebTokenRateLimit int `help:"the max number of web requests per minute to each route for each authorization token, or channel or remote address if unauthenticated, 0 for no limit"`
+	WebOrgRateLimit   int `help:"the max number of web requests per minute to each route for each org, 0 for no limit"`
 }
 
 // NewMailroomConfig returns a new default configuration object
@@ -65,14 +105,24 @@ func NewMailroomConfig() *Config {
 		LogLevel:       "error",
 		Version:        "Dev",
 
+		MaxFlowDefinitionBytes: 10 * 1024 * 1024, // 10MB
+
 		WebhooksTimeout:        15000,
 		WebhooksMaxRetries:     2,
 		WebhooksMaxBodyBytes:   1024 * 1024, // 1MB
 		WebhooksInitialBackoff: 5000,
 		WebhooksBackoffJitter:  0.5,
+		WebhooksMaxLogBytes:    10 * 1024, // 10KB
 		SMTPServer:             "",
 		MaxStepsPerSprint:      100,
 		MaxValueLength:         640,
+		MsgSegmentsWarning:     3,
+		FlowRevisionsKeepLast:  0,
+		FlowRevisionsKeepDays:  30,
+		AuditOrgs:              5,
+		AuditRepair:            false,
+
+		LatencySLOMinutes: 5,
 
 		S3Endpoint:         "https://s3.amazonaws.com",
 		S3Region:           "us-east-1",
@@ -83,7 +133,17 @@ func NewMailroomConfig() *Config {
 		AWSAccessKeyID:     "missing_aws_access_key_id",
 		AWSSecretAccessKey: "missing_aws_secret_access_key",
 
-		RetryPendingMessages: true,
+		RehostMediaChannelTypes: "WA,TG",
+
+		MsgGateway: "courier",
+
+		AssetSource: "db",
+
+		RetryPendingMessages:   true,
+		MsgDedupeWindow:        300,
+		MsgDedupeHashWindow:    5,
+		StartSuppressionWindow: 0,
+		ContactCacheTTL:        30,
 
 		Address: "localhost",
 		Port:    8090,
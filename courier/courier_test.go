@@ -0,0 +1,111 @@
+package courier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueMessages(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	org, err := models.GetOrgAssets(ctx, db, models.Org1)
+	require.NoError(t, err)
+	channel := org.ChannelByID(models.TwilioChannelID)
+
+	newMsg := func(text string, contactID models.ContactID, urn urns.URN, urnID models.URNID) *models.Msg {
+		out := flows.NewMsgOut(urns.URN(fmt.Sprintf("%s?id=%d", urn, urnID)), assets.NewChannelReference(models.TwilioChannelUUID, "Twilio"), text, nil, nil, nil, flows.NilMsgTopic)
+		msg, err := models.NewOutgoingMsg(models.Org1, channel, contactID, out, time.Now())
+		require.NoError(t, err)
+		return msg
+	}
+
+	courier := testsuite.NewFakeCourier(rp)
+	courier.AssertBatchSize(t, string(models.TwilioChannelUUID))
+
+	err = QueueMessages(rc, []*models.Msg{
+		newMsg("Hi Cathy", models.CathyID, models.CathyURN, models.CathyURNID),
+		newMsg("How are you?", models.CathyID, models.CathyURN, models.CathyURNID),
+	})
+	require.NoError(t, err)
+
+	err = QueueMessages(rc, []*models.Msg{newMsg("Hi Bob", models.BobID, models.BobURN, models.BobURNID)})
+	require.NoError(t, err)
+
+	courier.AssertMsgQueued(t, string(models.TwilioChannelUUID), "Hi Cathy")
+	courier.AssertMsgQueued(t, string(models.TwilioChannelUUID), "How are you?")
+	courier.AssertMsgQueued(t, string(models.TwilioChannelUUID), "Hi Bob")
+	courier.AssertBatchSize(t, string(models.TwilioChannelUUID), 2, 1)
+
+	// queued batches are consumed
+	count, err := redis.Int(rc.Do("zcard", fmt.Sprintf("msgs:%s|10/0", models.TwilioChannelUUID)))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	courier.Reset()
+	courier.AssertBatchSize(t, string(models.TwilioChannelUUID))
+}
+
+func TestHTTPGateway(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	var body, auth string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	org, err := models.GetOrgAssets(ctx, db, models.Org1)
+	require.NoError(t, err)
+	channel := org.ChannelByID(models.TwilioChannelID)
+
+	// url is required
+	_, err = newHTTPGateway(&config.Config{})
+	assert.EqualError(t, err, "msg gateway URL must be set to use the http msg gateway")
+
+	gateway, err := newHTTPGateway(&config.Config{MsgGatewayURL: server.URL, MsgGatewayToken: "sesame"})
+	require.NoError(t, err)
+
+	err = gateway.QueueBatch(rc, channel, []*models.Msg{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Token sesame", auth)
+	assert.JSONEq(t, fmt.Sprintf(`{"channel_uuid": "%s", "channel_type": "%s", "msgs": []}`, models.TwilioChannelUUID, channel.Type()), body)
+
+	status = http.StatusServiceUnavailable
+	err = gateway.QueueBatch(rc, channel, []*models.Msg{})
+	assert.EqualError(t, err, "msg gateway returned status 503")
+}
+
+func TestConfiguredGateway(t *testing.T) {
+	defer func() { config.Mailroom.MsgGateway = "courier" }()
+
+	gateway, err := configuredGateway()
+	assert.NoError(t, err)
+	assert.IsType(t, &redisGateway{}, gateway)
+
+	config.Mailroom.MsgGateway = "pigeon"
+	_, err = configuredGateway()
+	assert.EqualError(t, err, "unknown msg gateway: pigeon")
+}
@@ -0,0 +1,81 @@
+package courier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	RegisterGateway("http", newHTTPGateway)
+}
+
+var gatewayHTTPClient = &http.Client{Timeout: time.Duration(15 * time.Second)}
+
+// httpGateway pushes messages to an HTTP endpoint, as a POST with a body like:
+//
+//   {
+//     "channel_uuid": "74729f45-7f29-4868-9dc4-90e491e3c7d8",
+//     "channel_type": "T",
+//     "msgs": [{"id": 1234, "uuid": "2f969340-704a-4aa2-a1bd-2f832a21d257", "text": "Hi there", ...}]
+//   }
+//
+// Any response other than a 2XX is treated as a failure to queue the messages.
+type httpGateway struct {
+	url   string
+	token string
+}
+
+type httpGatewayPayload struct {
+	ChannelUUID assets.ChannelUUID `json:"channel_uuid"`
+	ChannelType models.ChannelType `json:"channel_type"`
+	Msgs        []*models.Msg      `json:"msgs"`
+}
+
+func newHTTPGateway(cfg *config.Config) (Gateway, error) {
+	if cfg.MsgGatewayURL == "" {
+		return nil, errors.Errorf("msg gateway URL must be set to use the http msg gateway")
+	}
+	return &httpGateway{url: cfg.MsgGatewayURL, token: cfg.MsgGatewayToken}, nil
+}
+
+// QueueBatch pushes the passed in messages to our endpoint
+func (g *httpGateway) QueueBatch(rc redis.Conn, channel *models.Channel, msgs []*models.Msg) error {
+	body, err := json.Marshal(&httpGatewayPayload{ChannelUUID: channel.UUID(), ChannelType: channel.Type(), Msgs: msgs})
+	if err != nil {
+		return errors.Wrapf(err, "error marshalling msgs")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "error creating msg gateway request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Token %s", g.token))
+	}
+
+	resp, err := gatewayHTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error pushing msgs to gateway")
+	}
+	defer resp.Body.Close()
+
+	// read the body so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("msg gateway returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -1,18 +1,31 @@
 package cron
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/mailroom/locker"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+const runsKey = "cron_runs"
+
 // Function is the function that will be called on our schedule
 type Function func(lockName string, lockValue string) error
 
+// Run is the last run of a cron by any process
+type Run struct {
+	Name    string        `json:"name"`
+	Started time.Time     `json:"started"`
+	Elapsed time.Duration `json:"elapsed"`
+	Error   string        `json:"error,omitempty"`
+}
+
 // StartCron calls the passed in function every minute, making sure it acquires a
 // lock so that only one process is running at once. Note that across processes
 // crons may be called more often than duration as there is no inter-process
@@ -55,6 +68,16 @@ func StartCron(quit chan bool, rp *redis.Pool, name string, interval time.Durati
 					log.WithError(err).Error("error while running cron")
 				}
 
+				// record this run so it can be seen when each cron last ran
+				run := &Run{Name: name, Started: lastFire, Elapsed: time.Since(lastFire)}
+				if err != nil {
+					run.Error = err.Error()
+				}
+				err = recordRun(rp, run)
+				if err != nil {
+					log.WithError(err).Error("error recording cron run")
+				}
+
 				// release our lock
 				err = locker.ReleaseLock(rp, lockName, lock)
 				if err != nil {
@@ -87,6 +110,40 @@ func fireCron(cronFunc Function, lockName string, lockValue string) error {
 	return cronFunc(lockName, lockValue)
 }
 
+// recordRun records the passed in run as the last run of its cron
+func recordRun(rp *redis.Pool, run *Run) error {
+	runJSON, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	_, err = rc.Do("hset", runsKey, run.Name, runJSON)
+	return err
+}
+
+// LastRuns returns the last run of each cron which has run, ordered by name
+func LastRuns(rc redis.Conn) ([]*Run, error) {
+	values, err := redis.StringMap(rc.Do("hgetall", runsKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading cron runs")
+	}
+
+	runs := make([]*Run, 0, len(values))
+	for _, v := range values {
+		run := &Run{}
+		if err := json.Unmarshal([]byte(v), run); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling cron run: %s", v)
+		}
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Name < runs[j].Name })
+	return runs, nil
+}
+
 // nextFire returns the next time we should fire based on the passed in time and interval
 func nextFire(last time.Time, interval time.Duration) time.Time {
 	if interval >= time.Second && interval < time.Minute {
@@ -34,6 +34,15 @@ func TestCron(t *testing.T) {
 	assert.Equal(t, 4, fired)
 
 	close(quit)
+
+	// and recorded when it last ran
+	runs, err := LastRuns(rc)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(runs)) {
+		assert.Equal(t, "test", runs[0].Name)
+		assert.Equal(t, "", runs[0].Error)
+		assert.WithinDuration(t, time.Now(), runs[0].Started, time.Second)
+	}
 }
 
 func TestNextFire(t *testing.T) {
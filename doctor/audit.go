@@ -0,0 +1,257 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+)
+
+const (
+	auditsKey = "org_audits"
+
+	// the search index lags behind the database so small differences in contact counts are expected
+	searchCountTolerance = 0.01
+	searchCountMinDiff   = 10
+)
+
+// Audit cross-checks one invariant of an org's data. Audits which can repair what they find are only given counts
+// which have drifted, as those can be corrected without losing anything.
+type Audit struct {
+	Name        string
+	Description string
+	Find        func(ctx context.Context, db *sqlx.DB, es *elastic.Client, orgID models.OrgID) ([]*Discrepancy, error)
+	Repair      func(ctx context.Context, db *sqlx.DB, orgID models.OrgID, found []*Discrepancy) error
+}
+
+// Discrepancy is a difference between what an org's data says and what it should say
+type Discrepancy struct {
+	Audit    string `json:"audit"`
+	Subject  string `json:"subject"`
+	Expected int64  `json:"expected"`
+	Actual   int64  `json:"actual"`
+	Repaired bool   `json:"repaired"`
+}
+
+// OrgAudit is the result of auditing an org
+type OrgAudit struct {
+	OrgID         models.OrgID   `json:"org_id"`
+	AuditedOn     time.Time      `json:"audited_on"`
+	Discrepancies []*Discrepancy `json:"discrepancies"`
+}
+
+// Audits are all our audits in the order they are run
+var Audits = []*Audit{
+	{
+		Name:        "group_counts",
+		Description: "group counts which differ from the number of contacts in the group",
+		Find:        findGroupCountDrift,
+		Repair:      repairGroupCountDrift,
+	},
+	{
+		Name:        "search_counts",
+		Description: "a number of contacts in the search index which differs from the database",
+		Find:        findSearchCountDrift,
+	},
+	{
+		Name:        "campaign_fires",
+		Description: "unfired campaign event fires for contacts no longer in the campaign's group",
+		Find:        findStrayFires,
+	},
+}
+
+// AuditOrg runs all our audits against the passed in org, repairing what can be repaired if repair is true. Audits
+// which need a search client are skipped if it's nil.
+func AuditOrg(ctx context.Context, db *sqlx.DB, es *elastic.Client, orgID models.OrgID, repair bool) (*OrgAudit, error) {
+	result := &OrgAudit{OrgID: orgID, AuditedOn: time.Now(), Discrepancies: make([]*Discrepancy, 0)}
+
+	for _, a := range Audits {
+		found, err := a.Find(ctx, db, es, orgID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error running audit %s for org %d", a.Name, orgID)
+		}
+
+		if repair && a.Repair != nil && len(found) > 0 {
+			err := a.Repair(ctx, db, orgID, found)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error repairing %s for org %d", a.Name, orgID)
+			}
+			for _, d := range found {
+				d.Repaired = true
+			}
+		}
+
+		result.Discrepancies = append(result.Discrepancies, found...)
+	}
+
+	return result, nil
+}
+
+// RecordOrgAudit records the passed in audit as the last audit of its org, only audits which found something are kept
+func RecordOrgAudit(rc redis.Conn, audit *OrgAudit) error {
+	field := strconv.Itoa(int(audit.OrgID))
+
+	if len(audit.Discrepancies) == 0 {
+		_, err := rc.Do("hdel", auditsKey, field)
+		return errors.Wrapf(err, "error clearing audit of org %d", audit.OrgID)
+	}
+
+	auditJSON, err := json.Marshal(audit)
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.Do("hset", auditsKey, field, auditJSON)
+	return errors.Wrapf(err, "error recording audit of org %d", audit.OrgID)
+}
+
+// LastOrgAudits returns the last audit of each org whose last audit found something
+func LastOrgAudits(rc redis.Conn) ([]*OrgAudit, error) {
+	values, err := redis.Strings(rc.Do("hvals", auditsKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading org audits")
+	}
+
+	audits := make([]*OrgAudit, 0, len(values))
+	for _, v := range values {
+		audit := &OrgAudit{}
+		if err := json.Unmarshal([]byte(v), audit); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling org audit: %s", v)
+		}
+		audits = append(audits, audit)
+	}
+	return audits, nil
+}
+
+// both counts are selected in the same statement so they're from the same snapshot
+const selectGroupCountDriftSQL = `
+SELECT
+	g.id AS group_id,
+	(SELECT count(*) FROM contacts_contactgroup_contacts gc WHERE gc.contactgroup_id = g.id) AS actual,
+	(SELECT COALESCE(SUM(c.count), 0) FROM contacts_contactgroupcount c WHERE c.group_id = g.id) AS recorded
+FROM
+	contacts_contactgroup g
+WHERE
+	g.org_id = $1 AND
+	g.is_active = TRUE
+ORDER BY
+	g.id
+`
+
+func findGroupCountDrift(ctx context.Context, db *sqlx.DB, es *elastic.Client, orgID models.OrgID) ([]*Discrepancy, error) {
+	rows, err := db.QueryxContext(ctx, selectGroupCountDriftSQL, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make([]*Discrepancy, 0)
+	for rows.Next() {
+		var groupID, actual, recorded int64
+		if err := rows.Scan(&groupID, &actual, &recorded); err != nil {
+			return nil, errors.Wrapf(err, "error scanning group counts")
+		}
+		if actual != recorded {
+			found = append(found, &Discrepancy{Audit: "group_counts", Subject: fmt.Sprintf("group:%d", groupID), Expected: actual, Actual: recorded})
+		}
+	}
+	return found, rows.Err()
+}
+
+// inserts a count row of the difference, calculated in a single statement so that memberships changed concurrently
+// are either already in both counts or in neither
+const repairGroupCountDriftSQL = `
+INSERT INTO
+	contacts_contactgroupcount(is_squashed, count, group_id)
+SELECT
+	FALSE,
+	(SELECT count(*) FROM contacts_contactgroup_contacts gc WHERE gc.contactgroup_id = $1) -
+	(SELECT COALESCE(SUM(c.count), 0) FROM contacts_contactgroupcount c WHERE c.group_id = $1),
+	$1
+`
+
+func repairGroupCountDrift(ctx context.Context, db *sqlx.DB, orgID models.OrgID, found []*Discrepancy) error {
+	for _, d := range found {
+		var groupID int64
+		if _, err := fmt.Sscanf(d.Subject, "group:%d", &groupID); err != nil {
+			return errors.Wrapf(err, "invalid group subject: %s", d.Subject)
+		}
+
+		_, err := db.ExecContext(ctx, repairGroupCountDriftSQL, groupID)
+		if err != nil {
+			return errors.Wrapf(err, "error repairing count of group %d", groupID)
+		}
+	}
+	return nil
+}
+
+func findSearchCountDrift(ctx context.Context, db *sqlx.DB, es *elastic.Client, orgID models.OrgID) ([]*Discrepancy, error) {
+	if es == nil {
+		return nil, nil
+	}
+
+	var actual int64
+	err := db.GetContext(ctx, &actual, `SELECT count(*) FROM contacts_contact WHERE org_id = $1 AND is_active = TRUE`, orgID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error counting contacts")
+	}
+
+	indexed, err := es.Count("contacts").Routing(strconv.Itoa(int(orgID))).Query(elastic.NewTermQuery("org_id", orgID)).Do(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error counting indexed contacts")
+	}
+
+	diff := indexed - actual
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff < searchCountMinDiff || float64(diff) < float64(actual)*searchCountTolerance {
+		return nil, nil
+	}
+
+	return []*Discrepancy{{Audit: "search_counts", Subject: "contacts", Expected: actual, Actual: indexed}}, nil
+}
+
+const selectStrayFiresSQL = `
+SELECT
+	f.event_id,
+	count(*)
+FROM
+	campaigns_eventfire f
+	JOIN campaigns_campaignevent e ON e.id = f.event_id
+	JOIN campaigns_campaign c ON c.id = e.campaign_id
+WHERE
+	c.org_id = $1 AND
+	f.fired IS NULL AND
+	e.is_active = TRUE AND
+	NOT EXISTS (SELECT 1 FROM contacts_contactgroup_contacts gc WHERE gc.contactgroup_id = c.group_id AND gc.contact_id = f.contact_id)
+GROUP BY
+	f.event_id
+ORDER BY
+	f.event_id
+`
+
+func findStrayFires(ctx context.Context, db *sqlx.DB, es *elastic.Client, orgID models.OrgID) ([]*Discrepancy, error) {
+	rows, err := db.QueryxContext(ctx, selectStrayFiresSQL, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make([]*Discrepancy, 0)
+	for rows.Next() {
+		var eventID, count int64
+		if err := rows.Scan(&eventID, &count); err != nil {
+			return nil, errors.Wrapf(err, "error scanning stray fires")
+		}
+		found = append(found, &Discrepancy{Audit: "campaign_fires", Subject: fmt.Sprintf("event:%d", eventID), Expected: 0, Actual: count})
+	}
+	return found, rows.Err()
+}
@@ -0,0 +1,75 @@
+package doctor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditOrg(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	// the test database may have discrepancies of its own
+	before, err := AuditOrg(ctx, db, nil, models.Org1, false)
+	require.NoError(t, err)
+
+	// drift the count of the doctors group and add a fire for a contact who isn't in the campaign's group
+	db.MustExec(`INSERT INTO contacts_contactgroupcount(is_squashed, count, group_id) VALUES(FALSE, 3, $1)`, models.DoctorsGroupID)
+	db.MustExec(`DELETE FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1 AND contact_id = $2`, models.DoctorsGroupID, models.BobID)
+	db.MustExec(`INSERT INTO campaigns_eventfire(scheduled, contact_id, event_id) VALUES(NOW(), $1, $2)`, models.BobID, models.RemindersEvent1ID)
+
+	audit, err := AuditOrg(ctx, db, nil, models.Org1, false)
+	require.NoError(t, err)
+	assert.Equal(t, models.Org1, audit.OrgID)
+
+	findDiscrepancy := func(a *OrgAudit, subject string) *Discrepancy {
+		for _, d := range a.Discrepancies {
+			if d.Subject == subject {
+				return d
+			}
+		}
+		return nil
+	}
+
+	groupSubject := fmt.Sprintf("group:%d", models.DoctorsGroupID)
+	drift := findDiscrepancy(audit, groupSubject)
+	require.NotNil(t, drift)
+	assert.Equal(t, "group_counts", drift.Audit)
+	assert.Equal(t, int64(3), drift.Actual-drift.Expected)
+	assert.False(t, drift.Repaired)
+
+	stray := findDiscrepancy(audit, fmt.Sprintf("event:%d", models.RemindersEvent1ID))
+	require.NotNil(t, stray)
+	assert.Equal(t, "campaign_fires", stray.Audit)
+
+	// record it
+	require.NoError(t, RecordOrgAudit(rc, audit))
+	audits, err := LastOrgAudits(rc)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(audits))
+	assert.Equal(t, len(audit.Discrepancies), len(audits[0].Discrepancies))
+
+	// repair what can be repaired, only count drift is
+	audit, err = AuditOrg(ctx, db, nil, models.Org1, true)
+	require.NoError(t, err)
+	assert.True(t, findDiscrepancy(audit, groupSubject).Repaired)
+	assert.False(t, findDiscrepancy(audit, fmt.Sprintf("event:%d", models.RemindersEvent1ID)).Repaired)
+
+	audit, err = AuditOrg(ctx, db, nil, models.Org1, false)
+	require.NoError(t, err)
+	assert.Nil(t, findDiscrepancy(audit, groupSubject))
+	assert.NotNil(t, findDiscrepancy(audit, fmt.Sprintf("event:%d", models.RemindersEvent1ID)))
+	assert.True(t, len(audit.Discrepancies) <= len(before.Discrepancies)+1)
+
+	// an audit which finds nothing clears the org's last audit
+	require.NoError(t, RecordOrgAudit(rc, &OrgAudit{OrgID: models.Org1}))
+	audits, err = LastOrgAudits(rc)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(audits))
+}
@@ -0,0 +1,338 @@
+package doctor
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Check finds and repairs one class of inconsistent state. Problems are identified by strings which are either
+// database ids or redis keys depending on the check.
+type Check struct {
+	Name        string
+	Description string
+	Find        func(ctx context.Context, db *sqlx.DB, rp *redis.Pool) ([]string, error)
+	Repair      func(ctx context.Context, db *sqlx.DB, rp *redis.Pool, ids []string) error
+}
+
+// Result is the result of running a single check
+type Result struct {
+	Check    *Check
+	Found    []string
+	Repaired bool
+}
+
+// Checks are all our checks in the order they are run
+var Checks = []*Check{
+	{
+		Name:        "stuck_sessions",
+		Description: "sessions waiting with no wait started, no timeout and no active run that will expire",
+		Find:        findStuckSessions,
+		Repair:      repairStuckSessions,
+	},
+	{
+		Name:        "orphaned_runs",
+		Description: "runs still active in sessions which have ended",
+		Find:        findOrphanedRuns,
+		Repair:      repairOrphanedRuns,
+	},
+	{
+		Name:        "orphaned_fires",
+		Description: "unfired campaign event fires for events which have been deleted",
+		Find:        findOrphanedFires,
+		Repair:      repairOrphanedFires,
+	},
+	{
+		Name:        "stale_contact_locks",
+		Description: "contact locks which will never expire",
+		Find:        findStaleContactLocks,
+		Repair:      repairStaleContactLocks,
+	},
+}
+
+// Run runs the checks with the passed in names, or all checks if none are passed in, repairing what they find if
+// repair is true
+func Run(ctx context.Context, db *sqlx.DB, rp *redis.Pool, names []string, repair bool) ([]*Result, error) {
+	checks, err := checksByName(names)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0, len(checks))
+	for _, c := range checks {
+		log := logrus.WithField("check", c.Name)
+		start := time.Now()
+
+		found, err := c.Find(ctx, db, rp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error running check %s", c.Name)
+		}
+		result := &Result{Check: c, Found: found}
+
+		if repair && len(found) > 0 {
+			err := c.Repair(ctx, db, rp, found)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error repairing %s", c.Name)
+			}
+			result.Repaired = true
+		}
+
+		log.WithField("found", len(found)).WithField("repaired", result.Repaired).WithField("elapsed", time.Since(start)).Debug("check complete")
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func checksByName(names []string) ([]*Check, error) {
+	if len(names) == 0 {
+		return Checks, nil
+	}
+
+	checks := make([]*Check, 0, len(names))
+	for _, name := range names {
+		var check *Check
+		for _, c := range Checks {
+			if c.Name == strings.TrimSpace(name) {
+				check = c
+			}
+		}
+		if check == nil {
+			return nil, errors.Errorf("no check named %s", name)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+const selectStuckSessionsSQL = `
+SELECT
+	s.id::text
+FROM
+	flows_flowsession s
+WHERE
+	s.status = 'W' AND
+	s.wait_started_on IS NULL AND
+	s.timeout_on IS NULL AND
+	NOT EXISTS (SELECT 1 FROM flows_flowrun r WHERE r.session_id = s.id AND r.is_active = TRUE AND r.expires_on IS NOT NULL)
+ORDER BY
+	s.id
+`
+
+func findStuckSessions(ctx context.Context, db *sqlx.DB, rp *redis.Pool) ([]string, error) {
+	ids := make([]string, 0)
+	err := db.SelectContext(ctx, &ids, selectStuckSessionsSQL)
+	return ids, err
+}
+
+const lockStuckSessionsSQL = `
+SELECT
+	s.id
+FROM
+	flows_flowsession s
+WHERE
+	s.id = ANY($1::int[]) AND
+	s.status = 'W' AND
+	s.wait_started_on IS NULL AND
+	s.timeout_on IS NULL AND
+	NOT EXISTS (SELECT 1 FROM flows_flowrun r WHERE r.session_id = s.id AND r.is_active = TRUE AND r.expires_on IS NOT NULL)
+ORDER BY
+	s.id
+FOR UPDATE OF s
+`
+
+// stuck sessions can't be resumed or expired so are interrupted
+func repairStuckSessions(ctx context.Context, db *sqlx.DB, rp *redis.Pool, ids []string) error {
+	return repairLocked(ctx, db, lockStuckSessionsSQL, ids, func(tx *sqlx.Tx, locked []int64) error {
+		sessionIDs := make([]models.SessionID, len(locked))
+		for i := range locked {
+			sessionIDs[i] = models.SessionID(locked[i])
+		}
+		return models.ExitSessions(ctx, tx, sessionIDs, models.ExitInterrupted, time.Now())
+	})
+}
+
+const selectOrphanedRunsSQL = `
+SELECT
+	r.id::text
+FROM
+	flows_flowrun r
+	JOIN flows_flowsession s ON s.id = r.session_id
+WHERE
+	r.is_active = TRUE AND
+	s.status != 'W'
+ORDER BY
+	r.id
+`
+
+func findOrphanedRuns(ctx context.Context, db *sqlx.DB, rp *redis.Pool) ([]string, error) {
+	ids := make([]string, 0)
+	err := db.SelectContext(ctx, &ids, selectOrphanedRunsSQL)
+	return ids, err
+}
+
+const repairOrphanedRunsSQL = `
+UPDATE
+	flows_flowrun r
+SET
+	is_active = FALSE,
+	exit_type = 'I',
+	status = 'I',
+	exited_on = COALESCE(s.ended_on, NOW()),
+	timeout_on = NULL,
+	modified_on = NOW()
+FROM
+	flows_flowsession s
+WHERE
+	s.id = r.session_id AND
+	r.id = ANY($1::int[])
+`
+
+const lockOrphanedRunsSQL = `
+SELECT
+	r.id
+FROM
+	flows_flowrun r
+	JOIN flows_flowsession s ON s.id = r.session_id
+WHERE
+	r.id = ANY($1::int[]) AND
+	r.is_active = TRUE AND
+	s.status != 'W'
+ORDER BY
+	r.id
+FOR UPDATE OF r
+`
+
+// runs in ended sessions are interrupted as of when their session ended
+func repairOrphanedRuns(ctx context.Context, db *sqlx.DB, rp *redis.Pool, ids []string) error {
+	return repairLocked(ctx, db, lockOrphanedRunsSQL, ids, func(tx *sqlx.Tx, locked []int64) error {
+		_, err := tx.ExecContext(ctx, repairOrphanedRunsSQL, pq.Array(locked))
+		return err
+	})
+}
+
+const selectOrphanedFiresSQL = `
+SELECT
+	f.id::text
+FROM
+	campaigns_eventfire f
+	JOIN campaigns_campaignevent e ON e.id = f.event_id
+WHERE
+	f.fired IS NULL AND
+	e.is_active = FALSE
+ORDER BY
+	f.id
+`
+
+func findOrphanedFires(ctx context.Context, db *sqlx.DB, rp *redis.Pool) ([]string, error) {
+	ids := make([]string, 0)
+	err := db.SelectContext(ctx, &ids, selectOrphanedFiresSQL)
+	return ids, err
+}
+
+const lockOrphanedFiresSQL = `
+SELECT
+	f.id
+FROM
+	campaigns_eventfire f
+	JOIN campaigns_campaignevent e ON e.id = f.event_id
+WHERE
+	f.id = ANY($1::int[]) AND
+	f.fired IS NULL AND
+	e.is_active = FALSE
+ORDER BY
+	f.id
+FOR UPDATE OF f
+`
+
+// fires for deleted events will never fire so are removed
+func repairOrphanedFires(ctx context.Context, db *sqlx.DB, rp *redis.Pool, ids []string) error {
+	return repairLocked(ctx, db, lockOrphanedFiresSQL, ids, func(tx *sqlx.Tx, locked []int64) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM campaigns_eventfire WHERE id = ANY($1::int[])`, pq.Array(locked))
+		return err
+	})
+}
+
+// repairs the problems with the passed in ids in a transaction, after re-selecting them with the passed in SQL, which
+// should lock them, so that only those which still have the problem are repaired, and anything which has changed since
+// they were found isn't overwritten
+func repairLocked(ctx context.Context, db *sqlx.DB, lockSQL string, ids []string, repair func(tx *sqlx.Tx, locked []int64) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error starting transaction")
+	}
+
+	locked := make([]int64, 0, len(ids))
+	if err := tx.SelectContext(ctx, &locked, lockSQL, pq.Array(ids)); err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "error re-selecting problems to repair")
+	}
+
+	if len(locked) > 0 {
+		if err := repair(tx, locked); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return errors.Wrapf(tx.Commit(), "error committing repairs")
+}
+
+// contact locks are always set with an expiration so any without one will never be released
+func findStaleContactLocks(ctx context.Context, db *sqlx.DB, rp *redis.Pool) ([]string, error) {
+	rc := rp.Get()
+	defer rc.Close()
+
+	keys := make([]string, 0)
+	cursor := 0
+	for {
+		values, err := redis.Values(rc.Do("scan", cursor, "match", "lock:c:*", "count", 1000))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error scanning contact locks")
+		}
+		cursor, _ = redis.Int(values[0], nil)
+		batch, _ := redis.Strings(values[1], nil)
+
+		for _, key := range batch {
+			ttl, err := redis.Int(rc.Do("ttl", key))
+			if err != nil {
+				return nil, errors.Wrapf(err, "error checking ttl of %s", key)
+			}
+			if ttl == -1 {
+				keys = append(keys, key)
+			}
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+	return keys, nil
+}
+
+// deletes the passed in keys which still have no expiration, so that locks which have since been released and
+// re-acquired aren't deleted
+var deleteStaleLocks = redis.NewScript(-1, `-- KEYS: [LockKey...]
+local deleted = 0
+for _, key in ipairs(KEYS) do
+	if redis.call("ttl", key) == -1 then
+		deleted = deleted + redis.call("del", key)
+	end
+end
+return deleted
+`)
+
+func repairStaleContactLocks(ctx context.Context, db *sqlx.DB, rp *redis.Pool, keys []string) error {
+	rc := rp.Get()
+	defer rc.Close()
+
+	_, err := deleteStaleLocks.Do(rc, redis.Args{len(keys)}.AddFlat(keys)...)
+	return err
+}
@@ -0,0 +1,96 @@
+package doctor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctor(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	insertSession := func(status string, waitStarted bool) models.SessionID {
+		var sessionID models.SessionID
+		err := db.Get(&sessionID,
+			`INSERT INTO flows_flowsession(uuid, status, responded, created_on, org_id, contact_id, current_flow_id, wait_started_on)
+			VALUES($1, $2, FALSE, NOW(), $3, $4, $5, CASE WHEN $6 THEN NOW() ELSE NULL END) RETURNING id`,
+			uuids.New(), status, models.Org1, models.CathyID, models.FavoritesFlowID, waitStarted)
+		require.NoError(t, err)
+		return sessionID
+	}
+
+	// the test database may have problems of its own
+	before, err := Run(ctx, db, rp, nil, false)
+	require.NoError(t, err)
+
+	// a stuck session, a healthy waiting session and a completed session with an active run
+	stuckID := insertSession("W", false)
+	insertSession("W", true)
+
+	// and a stuck session which will start waiting after it's found
+	changedID := insertSession("W", false)
+	completedID := insertSession("C", false)
+	db.MustExec(`INSERT INTO flows_flowrun(uuid, is_active, status, created_on, modified_on, responded, contact_id, flow_id, session_id, org_id)
+		VALUES($1, TRUE, 'W', NOW(), NOW(), FALSE, $2, $3, $4, $5)`, uuids.New(), models.CathyID, models.FavoritesFlowID, completedID, models.Org1)
+
+	// a fire for a deleted event
+	db.MustExec(`INSERT INTO campaigns_eventfire(scheduled, contact_id, event_id) VALUES(NOW(), $1, $2)`, models.CathyID, models.RemindersEvent2ID)
+	db.MustExec(`UPDATE campaigns_campaignevent SET is_active = FALSE WHERE id = $1`, models.RemindersEvent2ID)
+
+	// a contact lock without an expiration and one with
+	lockKey := fmt.Sprintf("lock:%s", models.ContactLock(models.Org1, models.CathyID))
+	rc.Do("set", lockKey, "abc")
+	rc.Do("set", fmt.Sprintf("lock:%s", models.ContactLock(models.Org1, models.BobID)), "def", "EX", 60)
+
+	_, err = Run(ctx, db, rp, []string{"xyz"}, false)
+	assert.EqualError(t, err, "no check named xyz")
+
+	// without repair things are just reported
+	results, err := Run(ctx, db, rp, nil, false)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(results))
+	assert.Contains(t, results[0].Found, fmt.Sprint(stuckID))
+	assert.Contains(t, results[0].Found, fmt.Sprint(changedID))
+	assert.Equal(t, len(before[0].Found)+2, len(results[0].Found))
+	assert.Equal(t, len(before[1].Found)+1, len(results[1].Found))
+	assert.Equal(t, len(before[2].Found)+1, len(results[2].Found))
+	assert.Equal(t, []string{lockKey}, results[3].Found)
+	for _, r := range results {
+		assert.False(t, r.Repaired)
+	}
+
+	db.MustExec(`UPDATE flows_flowsession SET wait_started_on = NOW() WHERE id = $1`, changedID)
+
+	// repairs only fix what still has a problem when they run
+	err = repairStuckSessions(ctx, db, rp, results[0].Found)
+	require.NoError(t, err)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE id = $1 AND status = 'I'`, []interface{}{stuckID}, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE id = $1 AND status = 'W'`, []interface{}{changedID}, 1)
+
+	results, err = Run(ctx, db, rp, []string{"orphaned_runs", "orphaned_fires", "stale_contact_locks"}, true)
+	require.NoError(t, err)
+	for _, r := range results {
+		assert.True(t, r.Repaired, "expected %s to be repaired", r.Check.Name)
+	}
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowrun WHERE session_id = $1 AND is_active = TRUE`, []interface{}{completedID}, 0)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1 AND fired IS NULL`, []interface{}{models.RemindersEvent2ID}, 0)
+
+	exists, _ := rc.Do("exists", lockKey)
+	assert.Equal(t, int64(0), exists)
+
+	// everything is now ok
+	results, err = Run(ctx, db, rp, nil, false)
+	require.NoError(t, err)
+	for _, r := range results {
+		assert.Equal(t, 0, len(r.Found), "expected nothing found for %s", r.Check.Name)
+	}
+}
@@ -0,0 +1,174 @@
+package goflow
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/goflow/flows/engine"
+	"github.com/nyaruka/mailroom/config"
+
+	"github.com/pkg/errors"
+)
+
+// CallbackHeader is the header which webhook calls can include to be told the URL which can be called to resume the
+// run which made the call. Flows opt in by giving the header any value on their call, which is replaced with the URL.
+const CallbackHeader = "X-Mailroom-Callback"
+
+// how long callbacks for runs which don't expire can be used for
+const callbackLifetime = time.Hour * 24 * 7
+
+// Callback is a promise to resume a run at the wait which follows the step where it made a webhook call. It can be
+// used once before it expires.
+type Callback struct {
+	RunUUID   flows.RunUUID
+	StepUUID  flows.StepUUID
+	ExpiresOn time.Time
+}
+
+// NewCallback creates a new callback for the passed in run, at its current step
+func NewCallback(run flows.FlowRun) *Callback {
+	var stepUUID flows.StepUUID
+	if path := run.Path(); len(path) > 0 {
+		stepUUID = path[len(path)-1].UUID()
+	}
+
+	expiresOn := time.Now().Add(callbackLifetime)
+	if run.ExpiresOn() != nil {
+		expiresOn = *run.ExpiresOn()
+	}
+
+	return &Callback{RunUUID: run.UUID(), StepUUID: stepUUID, ExpiresOn: expiresOn}
+}
+
+// Token returns the token which identifies this callback to the callback endpoint. It's the run UUID, step UUID and
+// expiry signed with our callback secret so that none of them can be changed.
+func (c *Callback) Token() string {
+	payload := fmt.Sprintf("%s.%s.%d", c.RunUUID, c.StepUUID, c.ExpiresOn.Unix())
+	return fmt.Sprintf("%s.%s", payload, callbackSignature(payload))
+}
+
+// URL returns the URL which external systems call to use this callback
+func (c *Callback) URL() string {
+	return fmt.Sprintf("https://%s/mr/session/callback/%s", config.Mailroom.Domain, c.Token())
+}
+
+// ParseCallbackToken checks the signature and expiry of the passed in callback token and returns the callback it is for
+func ParseCallbackToken(token string) (*Callback, error) {
+	if config.Mailroom.CallbackSecret == "" {
+		return nil, errors.New("callbacks are not enabled")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return nil, errors.New("invalid callback token")
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(callbackSignature(payload))) {
+		return nil, errors.New("invalid callback token")
+	}
+
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid callback token")
+	}
+	callback := &Callback{RunUUID: flows.RunUUID(parts[0]), StepUUID: flows.StepUUID(parts[1]), ExpiresOn: time.Unix(expires, 0).UTC()}
+	if time.Now().After(callback.ExpiresOn) {
+		return nil, errors.New("expired callback token")
+	}
+
+	return callback, nil
+}
+
+func callbackSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.Mailroom.CallbackSecret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// IsWaitingFor returns whether the passed in session is waiting for this callback, which is the case if the run which
+// made the call is the one waiting, and it hasn't waited or started another flow since making the call
+func (c *Callback) IsWaitingFor(session flows.Session) bool {
+	var waiting flows.FlowRun
+	for _, run := range session.Runs() {
+		if run.Status() == flows.RunStatusWaiting {
+			waiting = run
+		}
+	}
+	if waiting == nil || waiting.UUID() != c.RunUUID {
+		return false
+	}
+
+	path := waiting.Path()
+	called := -1
+	for i, step := range path {
+		if step.UUID() == c.StepUUID {
+			called = i
+		}
+	}
+	if called < 0 {
+		return false
+	}
+
+	// steps since the call, other than the one the run is waiting at, must not have waited or entered other flows
+	since := make(map[flows.StepUUID]bool, len(path)-called)
+	for _, step := range path[called : len(path)-1] {
+		since[step.UUID()] = true
+	}
+	for _, e := range waiting.Events() {
+		if (e.Type() == events.TypeMsgWait || e.Type() == events.TypeFlowEntered) && since[e.StepUUID()] {
+			return false
+		}
+	}
+	return true
+}
+
+// webhook service which tells the called system how to resume the run making the call, so that flows can wait for
+// systems which respond asynchronously, e.g. to confirm a payment
+type callbackWebhookService struct {
+	flows.WebhookService
+}
+
+func (s *callbackWebhookService) Call(session flows.Session, request *http.Request) (*flows.WebhookCall, error) {
+	if request.Header.Get(CallbackHeader) != "" {
+		request.Header.Del(CallbackHeader)
+
+		if run := CurrentRun(session); run != nil {
+			request.Header.Set(CallbackHeader, NewCallback(run).URL())
+		}
+	}
+	return s.WebhookService.Call(session, request)
+}
+
+// CurrentRun returns the run of the passed in session which is currently being executed
+func CurrentRun(session flows.Session) flows.FlowRun {
+	if session == nil {
+		return nil
+	}
+	runs := session.Runs()
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Status() == flows.RunStatusActive {
+			return runs[i]
+		}
+	}
+	return nil
+}
+
+// callbackWebhookFactory wraps the passed in factory so that its webhook calls include a callback URL if callbacks
+// are enabled
+func callbackWebhookFactory(factory engine.WebhookServiceFactory) engine.WebhookServiceFactory {
+	return func(session flows.Session) (flows.WebhookService, error) {
+		service, err := factory(session)
+		if err != nil || config.Mailroom.CallbackSecret == "" {
+			return service, err
+		}
+		return &callbackWebhookService{WebhookService: service}, nil
+	}
+}
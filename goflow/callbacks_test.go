@@ -0,0 +1,91 @@
+package goflow
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/httpx"
+	"github.com/nyaruka/mailroom/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackTokens(t *testing.T) {
+	callback := &Callback{
+		RunUUID:   flows.RunUUID("9688d21d-95aa-4bed-afc7-f31b35731a3d"),
+		StepUUID:  flows.StepUUID("5f6e9d2a-1c3b-4a7e-8d0f-2b4c6e8a0d1f"),
+		ExpiresOn: time.Now().Add(time.Hour).Truncate(time.Second).UTC(),
+	}
+
+	// callbacks are disabled without a secret
+	_, err := ParseCallbackToken(callback.Token())
+	assert.EqualError(t, err, "callbacks are not enabled")
+
+	config.Mailroom.CallbackSecret = "sesame"
+	config.Mailroom.Domain = "mailroom.io"
+	defer func() {
+		config.Mailroom.CallbackSecret = ""
+		config.Mailroom.Domain = ""
+	}()
+
+	token := callback.Token()
+	parsed, err := ParseCallbackToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, callback, parsed)
+	assert.Equal(t, "https://mailroom.io/mr/session/callback/"+token, callback.URL())
+
+	// tokens for other runs or steps, with other expiries or signed with other secrets don't parse
+	_, err = ParseCallbackToken("3a5b5e9b-8d1c-4c57-9dcb-1b8c1a8e8a4f" + token[36:])
+	assert.EqualError(t, err, "invalid callback token")
+	_, err = ParseCallbackToken(token[:37] + "3a5b5e9b-8d1c-4c57-9dcb-1b8c1a8e8a4f" + token[73:])
+	assert.EqualError(t, err, "invalid callback token")
+	_, err = ParseCallbackToken(strings.Replace(token, fmt.Sprintf(".%d.", callback.ExpiresOn.Unix()), fmt.Sprintf(".%d.", callback.ExpiresOn.Unix()+3600), 1))
+	assert.EqualError(t, err, "invalid callback token")
+	_, err = ParseCallbackToken(string(callback.RunUUID))
+	assert.EqualError(t, err, "invalid callback token")
+
+	// expired tokens don't parse
+	expired := &Callback{RunUUID: callback.RunUUID, StepUUID: callback.StepUUID, ExpiresOn: time.Now().Add(-time.Minute)}
+	_, err = ParseCallbackToken(expired.Token())
+	assert.EqualError(t, err, "expired callback token")
+
+	config.Mailroom.CallbackSecret = "open"
+	_, err = ParseCallbackToken(token)
+	assert.EqualError(t, err, "invalid callback token")
+}
+
+func TestCallbackWebhookService(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]httpx.MockResponse{
+		"http://temba.io": []httpx.MockResponse{httpx.NewMockResponse(200, nil, "OK", 1), httpx.NewMockResponse(200, nil, "OK", 1)},
+	}))
+
+	config.Mailroom.CallbackSecret = "sesame"
+	defer func() { config.Mailroom.CallbackSecret = "" }()
+
+	svc, err := Engine().Services().Webhook(nil)
+	require.NoError(t, err)
+	assert.IsType(t, &callbackWebhookService{}, svc)
+
+	// calls which don't ask for a callback aren't given one
+	request, err := http.NewRequest("GET", "http://temba.io", nil)
+	require.NoError(t, err)
+
+	_, err = svc.Call(nil, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "", request.Header.Get(CallbackHeader))
+
+	// and calls which ask for one without a run to resume have the header removed
+	request, err = http.NewRequest("GET", "http://temba.io", nil)
+	require.NoError(t, err)
+	request.Header.Set(CallbackHeader, "true")
+
+	_, err = svc.Call(nil, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "", request.Header.Get(CallbackHeader))
+}
@@ -0,0 +1,214 @@
+package goflow
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+// FlowDiff is the node level difference between two revisions of a flow
+type FlowDiff struct {
+	AddedNodes     []flows.NodeUUID `json:"added_nodes"`
+	RemovedNodes   []flows.NodeUUID `json:"removed_nodes"`
+	ChangedNodes   []*NodeDiff      `json:"changed_nodes"`
+	RenamedResults []*ResultRename  `json:"renamed_results"`
+}
+
+// NodeDiff is the difference between two revisions of a node which exists in both
+type NodeDiff struct {
+	UUID             flows.NodeUUID     `json:"uuid"`
+	AddedActions     []flows.ActionUUID `json:"added_actions"`
+	RemovedActions   []flows.ActionUUID `json:"removed_actions"`
+	ChangedActions   []flows.ActionUUID `json:"changed_actions"`
+	ActionsReordered bool               `json:"actions_reordered"`
+	RouterChanged    bool               `json:"router_changed"`
+	ExitsChanged     bool               `json:"exits_changed"`
+}
+
+// ResultRename is a result which is saved by the same router or action in both revisions but under a different name
+type ResultRename struct {
+	NodeUUID   flows.NodeUUID   `json:"node_uuid"`
+	ActionUUID flows.ActionUUID `json:"action_uuid,omitempty"`
+	From       string           `json:"from"`
+	To         string           `json:"to"`
+}
+
+// the parts of a flow definition we compare
+type diffFlow struct {
+	Nodes []*diffNode `json:"nodes"`
+}
+
+type diffNode struct {
+	UUID    flows.NodeUUID    `json:"uuid"`
+	Actions []json.RawMessage `json:"actions"`
+	Router  json.RawMessage   `json:"router"`
+	Exits   json.RawMessage   `json:"exits"`
+}
+
+type diffAction struct {
+	UUID flows.ActionUUID `json:"uuid"`
+	Type string           `json:"type"`
+	Name string           `json:"name"`
+}
+
+type diffRouter struct {
+	ResultName string `json:"result_name"`
+}
+
+// DiffFlows returns the difference between the passed in revisions of a flow. Nodes and actions are matched by
+// UUID, so the flows should already have been read, and so migrated, by the same version of the engine.
+func DiffFlows(from flows.Flow, to flows.Flow) (*FlowDiff, error) {
+	fromNodes, err := readDiffNodes(from)
+	if err != nil {
+		return nil, err
+	}
+	toNodes, err := readDiffNodes(to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &FlowDiff{
+		AddedNodes:     make([]flows.NodeUUID, 0),
+		RemovedNodes:   make([]flows.NodeUUID, 0),
+		ChangedNodes:   make([]*NodeDiff, 0),
+		RenamedResults: make([]*ResultRename, 0),
+	}
+
+	fromByUUID := make(map[flows.NodeUUID]*diffNode, len(fromNodes))
+	for _, n := range fromNodes {
+		fromByUUID[n.UUID] = n
+	}
+	toByUUID := make(map[flows.NodeUUID]*diffNode, len(toNodes))
+	for _, n := range toNodes {
+		toByUUID[n.UUID] = n
+	}
+
+	for _, n := range fromNodes {
+		if toByUUID[n.UUID] == nil {
+			diff.RemovedNodes = append(diff.RemovedNodes, n.UUID)
+		}
+	}
+
+	for _, toNode := range toNodes {
+		fromNode := fromByUUID[toNode.UUID]
+		if fromNode == nil {
+			diff.AddedNodes = append(diff.AddedNodes, toNode.UUID)
+			continue
+		}
+
+		nodeDiff, renames, err := diffNodes(fromNode, toNode)
+		if err != nil {
+			return nil, err
+		}
+		if nodeDiff != nil {
+			diff.ChangedNodes = append(diff.ChangedNodes, nodeDiff)
+		}
+		diff.RenamedResults = append(diff.RenamedResults, renames...)
+	}
+
+	return diff, nil
+}
+
+// compares two revisions of the same node, returning nil if they are the same
+func diffNodes(from *diffNode, to *diffNode) (*NodeDiff, []*ResultRename, error) {
+	d := &NodeDiff{
+		UUID:           to.UUID,
+		AddedActions:   make([]flows.ActionUUID, 0),
+		RemovedActions: make([]flows.ActionUUID, 0),
+		ChangedActions: make([]flows.ActionUUID, 0),
+		RouterChanged:  !bytes.Equal(from.Router, to.Router),
+		ExitsChanged:   !bytes.Equal(from.Exits, to.Exits),
+	}
+	renames := make([]*ResultRename, 0)
+
+	fromActions, err := readDiffActions(from.Actions)
+	if err != nil {
+		return nil, nil, err
+	}
+	toActions, err := readDiffActions(to.Actions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fromIndexes := make(map[flows.ActionUUID]int, len(fromActions))
+	for i, a := range fromActions {
+		fromIndexes[a.UUID] = i
+	}
+	toUUIDs := make(map[flows.ActionUUID]bool, len(toActions))
+	for _, a := range toActions {
+		toUUIDs[a.UUID] = true
+	}
+
+	for _, a := range fromActions {
+		if !toUUIDs[a.UUID] {
+			d.RemovedActions = append(d.RemovedActions, a.UUID)
+		}
+	}
+
+	// actions which exist in both revisions should keep their relative order
+	lastIndex := -1
+	for i, toAction := range toActions {
+		fromIndex, exists := fromIndexes[toAction.UUID]
+		if !exists {
+			d.AddedActions = append(d.AddedActions, toAction.UUID)
+			continue
+		}
+		if fromIndex < lastIndex {
+			d.ActionsReordered = true
+		}
+		lastIndex = fromIndex
+
+		fromAction := fromActions[fromIndex]
+		if !bytes.Equal(from.Actions[fromIndex], to.Actions[i]) {
+			d.ChangedActions = append(d.ChangedActions, toAction.UUID)
+		}
+		if fromAction.Type == "set_run_result" && toAction.Type == "set_run_result" && fromAction.Name != toAction.Name {
+			renames = append(renames, &ResultRename{NodeUUID: to.UUID, ActionUUID: toAction.UUID, From: fromAction.Name, To: toAction.Name})
+		}
+	}
+
+	if from.Router != nil && to.Router != nil {
+		fromRouter, toRouter := &diffRouter{}, &diffRouter{}
+		if err := json.Unmarshal(from.Router, fromRouter); err != nil {
+			return nil, nil, errors.Wrapf(err, "error reading router of node: %s", from.UUID)
+		}
+		if err := json.Unmarshal(to.Router, toRouter); err != nil {
+			return nil, nil, errors.Wrapf(err, "error reading router of node: %s", to.UUID)
+		}
+		if fromRouter.ResultName != "" && toRouter.ResultName != "" && fromRouter.ResultName != toRouter.ResultName {
+			renames = append(renames, &ResultRename{NodeUUID: to.UUID, From: fromRouter.ResultName, To: toRouter.ResultName})
+		}
+	}
+
+	if len(d.AddedActions) == 0 && len(d.RemovedActions) == 0 && len(d.ChangedActions) == 0 && !d.ActionsReordered && !d.RouterChanged && !d.ExitsChanged {
+		return nil, renames, nil
+	}
+	return d, renames, nil
+}
+
+// reads the nodes of the passed in flow in the form we compare them
+func readDiffNodes(flow flows.Flow) ([]*diffNode, error) {
+	definition, err := json.Marshal(flow)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling flow")
+	}
+
+	f := &diffFlow{}
+	if err := json.Unmarshal(definition, f); err != nil {
+		return nil, errors.Wrapf(err, "error reading flow nodes")
+	}
+	return f.Nodes, nil
+}
+
+func readDiffActions(actions []json.RawMessage) ([]*diffAction, error) {
+	read := make([]*diffAction, len(actions))
+	for i, a := range actions {
+		read[i] = &diffAction{}
+		if err := json.Unmarshal(a, read[i]); err != nil {
+			return nil, errors.Wrapf(err, "error reading action")
+		}
+	}
+	return read, nil
+}
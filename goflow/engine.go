@@ -9,7 +9,6 @@ import (
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/engine"
-	"github.com/nyaruka/goflow/services/webhooks"
 	"github.com/nyaruka/goflow/utils/httpx"
 	"github.com/nyaruka/mailroom/config"
 
@@ -55,10 +54,10 @@ func Engine() flows.Engine {
 		httpClient, httpRetries := webhooksHTTP()
 
 		eng = engine.NewBuilder().
-			WithWebhookServiceFactory(webhooks.NewServiceFactory(httpClient, httpRetries, webhookHeaders, config.Mailroom.WebhooksMaxBodyBytes)).
-			WithEmailServiceFactory(emailFactory).
-			WithClassificationServiceFactory(classificationFactory).
-			WithAirtimeServiceFactory(airtimeFactory).
+			WithWebhookServiceFactory(callbackWebhookFactory(webhookPluginFactory(internalServicesFactory(false, httpClient, httpRetries, webhookHeaders, config.Mailroom.WebhooksMaxBodyBytes)))).
+			WithEmailServiceFactory(emailPluginFactory(emailFactory)).
+			WithClassificationServiceFactory(classificationPluginFactory(classificationFactory)).
+			WithAirtimeServiceFactory(airtimePluginFactory(airtimeFactory)).
 			WithMaxStepsPerSprint(config.Mailroom.MaxStepsPerSprint).
 			Build()
 	})
@@ -77,10 +76,10 @@ func Simulator() flows.Engine {
 		httpClient, _ := webhooksHTTP() // don't do retries in simulator
 
 		simulator = engine.NewBuilder().
-			WithWebhookServiceFactory(webhooks.NewServiceFactory(httpClient, nil, webhookHeaders, config.Mailroom.WebhooksMaxBodyBytes)).
-			WithClassificationServiceFactory(classificationFactory).   // simulated sessions do real classification
-			WithEmailServiceFactory(simulatorEmailServiceFactory).     // but faked emails
-			WithAirtimeServiceFactory(simulatorAirtimeServiceFactory). // and faked airtime transfers
+			WithWebhookServiceFactory(internalServicesFactory(true, httpClient, nil, webhookHeaders, config.Mailroom.WebhooksMaxBodyBytes)).
+			WithClassificationServiceFactory(classificationPluginFactory(classificationFactory)). // simulated sessions do real classification
+			WithEmailServiceFactory(simulatorEmailServiceFactory).                                // but faked emails
+			WithAirtimeServiceFactory(simulatorAirtimeServiceFactory).                            // and faked airtime transfers
 			WithMaxStepsPerSprint(config.Mailroom.MaxStepsPerSprint).
 			Build()
 	})
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets/static/types"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/utils/httpx"
 
@@ -68,3 +69,81 @@ func TestSimulatorWebhook(t *testing.T) {
 	assert.Equal(t, "GET / HTTP/1.1\r\nHost: temba.io\r\nUser-Agent: RapidProMailroom/Dev\r\nX-Mailroom-Mode: simulation\r\nAccept-Encoding: gzip\r\n\r\n", string(call.RequestTrace))
 	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\nOK", string(call.ResponseTrace))
 }
+
+func TestStubbedSimulator(t *testing.T) {
+	// without any stubs, nothing is called for real
+	sim := StubbedSimulator(nil)
+	assert.NotEqual(t, Simulator(), sim)
+
+	webhookSvc, err := sim.Services().Webhook(nil)
+	assert.NoError(t, err)
+
+	request, err := http.NewRequest("GET", "http://temba.io/other", nil)
+	require.NoError(t, err)
+
+	call, err := webhookSvc.Call(nil, request)
+	assert.NoError(t, err)
+	assert.Nil(t, call.Response)
+
+	classifier := flows.NewClassifier(types.NewClassifier("097e026c-ae79-4740-af67-656dbedf0263", "Booking", "wit", []string{"book_flight"}))
+
+	_, err = sim.Services().Classification(nil, classifier)
+	assert.EqualError(t, err, "no stubbed classification for classifier 097e026c-ae79-4740-af67-656dbedf0263")
+
+	// unless we explicitly pass through to the real services
+	assert.Equal(t, Simulator(), StubbedSimulator(&SimulatorStubs{Passthrough: true}))
+
+	request, err = http.NewRequest("GET", "http://temba.io/other", nil)
+	require.NoError(t, err)
+
+	passthrough := &stubbedTransport{passthrough: &stubbedTransport{responses: map[string]*WebhookStub{"http://temba.io/other": {Body: "OK"}}}}
+	response, err := passthrough.RoundTrip(request)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	actualAmount := decimal.RequireFromString(`1.00`)
+	sim = StubbedSimulator(&SimulatorStubs{
+		Webhooks: map[string]*WebhookStub{
+			"http://temba.io/lookup": {Status: 201, Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"name": "Bob"}`},
+		},
+		Airtime: &AirtimeStub{ActualAmount: &actualAmount},
+	})
+
+	webhookSvc, err = sim.Services().Webhook(nil)
+	assert.NoError(t, err)
+
+	// stubbed URLs get the stubbed response
+	request, err = http.NewRequest("GET", "http://temba.io/lookup", nil)
+	require.NoError(t, err)
+
+	call, err = webhookSvc.Call(nil, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0 201 Created\r\nContent-Length: 15\r\nContent-Type: application/json\r\n\r\n{\"name\": \"Bob\"}", string(call.ResponseTrace))
+
+	// and other URLs aren't called
+	request, err = http.NewRequest("GET", "http://temba.io/other", nil)
+	require.NoError(t, err)
+
+	_, err = (&stubbedTransport{}).RoundTrip(request)
+	assert.EqualError(t, err, "no stubbed response for http://temba.io/other")
+
+	airtimeSvc, err := sim.Services().Airtime(nil)
+	assert.NoError(t, err)
+
+	amounts := map[string]decimal.Decimal{"USD": decimal.RequireFromString(`1.50`)}
+
+	transfer, err := airtimeSvc.Transfer(nil, urns.URN("tel:+593979111111"), urns.URN("tel:+593979222222"), amounts, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, decimal.RequireFromString(`1.50`), transfer.DesiredAmount)
+	assert.Equal(t, decimal.RequireFromString(`1.00`), transfer.ActualAmount)
+
+	// airtime transfers can also be stubbed to fail
+	sim = StubbedSimulator(&SimulatorStubs{Airtime: &AirtimeStub{Error: "insufficient balance"}})
+
+	airtimeSvc, err = sim.Services().Airtime(nil)
+	assert.NoError(t, err)
+
+	transfer, err = airtimeSvc.Transfer(nil, urns.URN("tel:+593979111111"), urns.URN("tel:+593979222222"), amounts, nil)
+	assert.EqualError(t, err, "insufficient balance")
+	assert.Equal(t, decimal.Zero, transfer.ActualAmount)
+}
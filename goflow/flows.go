@@ -21,6 +21,15 @@ func SpecVersion() *semver.Version {
 	return definition.CurrentSpecVersion
 }
 
+// MigrationTarget returns the version flows should be migrated to for an org which has pinned the passed in
+// version, which may be nil if the org hasn't pinned a version. Pinned versions newer than ours are ignored.
+func MigrationTarget(pinned *semver.Version) *semver.Version {
+	if pinned == nil || pinned.GreaterThan(definition.CurrentSpecVersion) {
+		return definition.CurrentSpecVersion
+	}
+	return pinned
+}
+
 // ReadFlow reads a flow from the given JSON definition, migrating it if necessary
 func ReadFlow(data json.RawMessage) (flows.Flow, error) {
 	return definition.ReadFlow(data, MigrationConfig())
@@ -1,6 +1,7 @@
 package goflow_test
 
 import (
+	"io/ioutil"
 	"testing"
 
 	"github.com/nyaruka/goflow/assets"
@@ -12,12 +13,19 @@ import (
 
 	"github.com/Masterminds/semver"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSpecVersion(t *testing.T) {
 	assert.Equal(t, semver.MustParse("13.1.0"), goflow.SpecVersion())
 }
 
+func TestMigrationTarget(t *testing.T) {
+	assert.Equal(t, semver.MustParse("13.1.0"), goflow.MigrationTarget(nil))
+	assert.Equal(t, semver.MustParse("13.0.0"), goflow.MigrationTarget(semver.MustParse("13.0.0")))
+	assert.Equal(t, semver.MustParse("13.1.0"), goflow.MigrationTarget(semver.MustParse("14.0.0")))
+}
+
 func TestReadFlow(t *testing.T) {
 	// try to read empty definition
 	flow, err := goflow.ReadFlow([]byte(`{}`))
@@ -55,3 +63,159 @@ func TestMigrateDefinition(t *testing.T) {
 	assert.NoError(t, err)
 	test.AssertEqualJSON(t, []byte(`{"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "New", "spec_version": "13.1.0", "type": "messaging", "language": "eng", "nodes": []}`), migrated, "migrated flow mismatch")
 }
+
+func TestDiffFlows(t *testing.T) {
+	readFlow := func(path string) flows.Flow {
+		definition, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		flow, err := goflow.ReadFlow(definition)
+		require.NoError(t, err)
+		return flow
+	}
+
+	from := readFlow("testdata/diff_from.json")
+	to := readFlow("testdata/diff_to.json")
+
+	diff, err := goflow.DiffFlows(from, to)
+	require.NoError(t, err)
+
+	assert.Equal(t, []flows.NodeUUID{"af2e8031-07f7-4cb9-9013-b9db532d31fc"}, diff.AddedNodes)
+	assert.Equal(t, []flows.NodeUUID{"c219c75c-b818-49a9-a1fc-6a7f7416e787"}, diff.RemovedNodes)
+	assert.Equal(t, []*goflow.NodeDiff{
+		{
+			UUID:             "9d1741b5-b2b0-4726-8196-42121fcce844",
+			AddedActions:     []flows.ActionUUID{"5463514e-d96e-4539-bdab-0f1286e6dae6"},
+			RemovedActions:   []flows.ActionUUID{},
+			ChangedActions:   []flows.ActionUUID{"d40207e9-559f-4df2-a05f-ac93e6561465"},
+			ActionsReordered: true,
+		},
+		{
+			UUID:           "26e499e4-60f5-43dd-97bd-f96660ca84fe",
+			AddedActions:   []flows.ActionUUID{},
+			RemovedActions: []flows.ActionUUID{},
+			ChangedActions: []flows.ActionUUID{},
+			RouterChanged:  true,
+			ExitsChanged:   true,
+		},
+	}, diff.ChangedNodes)
+	assert.Equal(t, []*goflow.ResultRename{
+		{NodeUUID: "9d1741b5-b2b0-4726-8196-42121fcce844", ActionUUID: "d40207e9-559f-4df2-a05f-ac93e6561465", From: "Color", To: "Colour"},
+		{NodeUUID: "26e499e4-60f5-43dd-97bd-f96660ca84fe", From: "Answer", To: "Response"},
+	}, diff.RenamedResults)
+
+	// no changes, no diff
+	diff, err = goflow.DiffFlows(from, from)
+	require.NoError(t, err)
+	assert.Equal(t, &goflow.FlowDiff{
+		AddedNodes:     []flows.NodeUUID{},
+		RemovedNodes:   []flows.NodeUUID{},
+		ChangedNodes:   []*goflow.NodeDiff{},
+		RenamedResults: []*goflow.ResultRename{},
+	}, diff)
+}
+
+func TestExtractTemplates(t *testing.T) {
+	definition, err := ioutil.ReadFile("testdata/templates.json")
+	require.NoError(t, err)
+	flow, err := goflow.ReadFlow(definition)
+	require.NoError(t, err)
+
+	templates, err := goflow.ExtractTemplates(flow)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*goflow.FlowTemplate{
+		{
+			NodeUUID:    "9d1741b5-b2b0-4726-8196-42121fcce844",
+			ActionUUID:  "0d432023-b932-4aaa-ab9a-ebe17b825239",
+			Field:       "text",
+			Template:    "Hi @contact.name, email us at help@example.com and pay @(format_number(fields.balance)) by @@noon",
+			Expressions: []string{"contact.name", "format_number(fields.balance)"},
+		},
+		{
+			NodeUUID:    "9d1741b5-b2b0-4726-8196-42121fcce844",
+			ActionUUID:  "0d432023-b932-4aaa-ab9a-ebe17b825239",
+			Field:       "text",
+			Language:    "spa",
+			Template:    "Hola @contact.name",
+			Expressions: []string{"contact.name"},
+		},
+		{NodeUUID: "9d1741b5-b2b0-4726-8196-42121fcce844", ActionUUID: "0d432023-b932-4aaa-ab9a-ebe17b825239", Field: "quick_replies[0]", Template: "Yes", Expressions: []string{}},
+		{NodeUUID: "9d1741b5-b2b0-4726-8196-42121fcce844", ActionUUID: "0d432023-b932-4aaa-ab9a-ebe17b825239", Field: "quick_replies[1]", Template: "No", Expressions: []string{}},
+		{NodeUUID: "9d1741b5-b2b0-4726-8196-42121fcce844", ActionUUID: "0d432023-b932-4aaa-ab9a-ebe17b825239", Field: "quick_replies[0]", Language: "spa", Template: "Si", Expressions: []string{}},
+		{NodeUUID: "9d1741b5-b2b0-4726-8196-42121fcce844", ActionUUID: "0d432023-b932-4aaa-ab9a-ebe17b825239", Field: "quick_replies[1]", Language: "spa", Template: "No", Expressions: []string{}},
+		{
+			NodeUUID:    "9d1741b5-b2b0-4726-8196-42121fcce844",
+			ActionUUID:  "c2a2a6c8-6bd5-4b5b-8b65-d0f5e7e3e4a1",
+			Field:       "url",
+			Template:    "http://example.com/?tel=@(urn_parts(urns.tel).path)",
+			Expressions: []string{"urn_parts(urns.tel).path"},
+		},
+		{
+			NodeUUID:    "9d1741b5-b2b0-4726-8196-42121fcce844",
+			ActionUUID:  "c2a2a6c8-6bd5-4b5b-8b65-d0f5e7e3e4a1",
+			Field:       "headers.Authorization",
+			Template:    "Token @globals.api_token",
+			Expressions: []string{"globals.api_token"},
+		},
+		{NodeUUID: "26e499e4-60f5-43dd-97bd-f96660ca84fe", Field: "operand", Template: "@input.text", Expressions: []string{"input.text"}},
+		{NodeUUID: "26e499e4-60f5-43dd-97bd-f96660ca84fe", CaseUUID: "b6d4e6b9-0c4c-4e0b-9b1a-3a1d7c9e9c61", Field: "arguments[0]", Template: "yes", Expressions: []string{}},
+		{NodeUUID: "26e499e4-60f5-43dd-97bd-f96660ca84fe", CaseUUID: "b6d4e6b9-0c4c-4e0b-9b1a-3a1d7c9e9c61", Field: "arguments[0]", Language: "spa", Template: "si", Expressions: []string{}},
+	}, templates)
+}
+
+func TestTemplateExpressions(t *testing.T) {
+	tcs := []struct {
+		template    string
+		expressions []string
+	}{
+		{"", []string{}},
+		{"Hi there", []string{}},
+		{"Hi @contact.name.", []string{"contact.name"}},
+		{"@CONTACT.NAME", []string{"CONTACT.NAME"}},
+		{"bob@example.com and @@contact", []string{}},
+		{"@(upper(contact.name)) and @( \"(\" & results.color.value )", []string{"upper(contact.name)", "\"(\" & results.color.value"}},
+		{"@(unclosed", []string{}},
+		{"@", []string{}},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expressions, goflow.TemplateExpressions(tc.template), "expressions mismatch for '%s'", tc.template)
+	}
+}
+
+func TestValidateDefinition(t *testing.T) {
+	definition, err := ioutil.ReadFile("testdata/validate.json")
+	require.NoError(t, err)
+
+	// every problem is found, not just the first
+	problems, err := goflow.ValidateDefinition(definition, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(problems))
+
+	assert.Equal(t, goflow.FlowProblemInvalid, problems[0].Type)
+	assert.Equal(t, flows.NodeUUID("9d1741b5-b2b0-4726-8196-42121fcce844"), problems[0].NodeUUID)
+	assert.Equal(t, flows.ActionUUID("5463514e-d96e-4539-bdab-0f1286e6dae6"), problems[0].ActionUUID)
+	assert.Contains(t, problems[0].Description, "field 'text' is required")
+
+	assert.Equal(t, goflow.FlowProblemInvalid, problems[1].Type)
+	assert.Equal(t, flows.NodeUUID("26e499e4-60f5-43dd-97bd-f96660ca84fe"), problems[1].NodeUUID)
+	assert.Equal(t, flows.ActionUUID(""), problems[1].ActionUUID)
+
+	assert.Equal(t, &goflow.FlowProblem{
+		Type:        goflow.FlowProblemInvalid,
+		NodeUUID:    "26e499e4-60f5-43dd-97bd-f96660ca84fe",
+		Description: "destination af2e8031-07f7-4cb9-9013-b9db532d31fc of exit[uuid=8e1e2b60-6998-40a1-92c1-41b68b28242b] isn't a known node",
+	}, problems[2])
+
+	// a valid flow has no problems
+	definition, err = ioutil.ReadFile("testdata/diff_to.json")
+	require.NoError(t, err)
+
+	problems, err = goflow.ValidateDefinition(definition, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*goflow.FlowProblem{}, problems)
+
+	// definitions which aren't flows at all are errors
+	_, err = goflow.ValidateDefinition([]byte(`[]`), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package goflow
+
+import (
+	"net/http"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/engine"
+
+	"github.com/pkg/errors"
+)
+
+// ServiceKind is the kind of engine service a plugin provides
+type ServiceKind string
+
+const (
+	// WebhookService is the kind for webhook plugins
+	WebhookService = ServiceKind("webhook")
+
+	// ClassificationService is the kind for classification plugins
+	ClassificationService = ServiceKind("classification")
+
+	// AirtimeService is the kind for airtime plugins
+	AirtimeService = ServiceKind("airtime")
+
+	// EmailService is the kind for email plugins
+	EmailService = ServiceKind("email")
+)
+
+// PluginSelector returns the name of the plugin which should provide the passed in kind of service
+// for the passed in session, or empty string to use the default service. Selecting a plugin which
+// hasn't been registered is an error rather than a fallback to the default service.
+type PluginSelector func(session flows.Session, kind ServiceKind) string
+
+var pluginSelector PluginSelector
+
+var webhookPlugins = make(map[string]engine.WebhookServiceFactory)
+var classificationPlugins = make(map[string]engine.ClassificationServiceFactory)
+var airtimePlugins = make(map[string]engine.AirtimeServiceFactory)
+var emailPlugins = make(map[string]engine.EmailServiceFactory)
+
+// RegisterPluginSelector registers the function used to decide which plugin, if any, provides each
+// service for a session
+func RegisterPluginSelector(selector PluginSelector) {
+	pluginSelector = selector
+}
+
+// RegisterWebhookPlugin registers a named webhook service factory which can be selected per org
+func RegisterWebhookPlugin(name string, factory engine.WebhookServiceFactory) {
+	webhookPlugins[name] = factory
+}
+
+// RegisterClassificationPlugin registers a named classification service factory which can be selected per org
+func RegisterClassificationPlugin(name string, factory engine.ClassificationServiceFactory) {
+	classificationPlugins[name] = factory
+}
+
+// RegisterAirtimePlugin registers a named airtime service factory which can be selected per org
+func RegisterAirtimePlugin(name string, factory engine.AirtimeServiceFactory) {
+	airtimePlugins[name] = factory
+}
+
+// RegisterEmailPlugin registers a named email service factory which can be selected per org
+func RegisterEmailPlugin(name string, factory engine.EmailServiceFactory) {
+	emailPlugins[name] = factory
+}
+
+// selectPlugin returns the name of the plugin selected for the passed in session and service kind
+func selectPlugin(session flows.Session, kind ServiceKind) string {
+	if pluginSelector == nil || session == nil {
+		return ""
+	}
+	return pluginSelector(session, kind)
+}
+
+// webhook service provided by a plugin, which hands calls to our internal services to the default service as only it
+// knows how to route them to mailroom
+type pluginWebhookService struct {
+	flows.WebhookService
+	def engine.WebhookServiceFactory
+}
+
+func (s *pluginWebhookService) Call(session flows.Session, request *http.Request) (*flows.WebhookCall, error) {
+	if s.def == nil || !isInternalServiceRequest(request) {
+		return s.WebhookService.Call(session, request)
+	}
+
+	internal, err := s.def(session)
+	if err != nil {
+		return nil, err
+	}
+	return internal.Call(session, request)
+}
+
+// webhookPluginFactory wraps the passed in default factory so that a selected plugin is used if there is one. Calls
+// to internal services are still made by the default service.
+func webhookPluginFactory(def engine.WebhookServiceFactory) engine.WebhookServiceFactory {
+	return func(session flows.Session) (flows.WebhookService, error) {
+		if name := selectPlugin(session, WebhookService); name != "" {
+			plugin, found := webhookPlugins[name]
+			if !found {
+				return nil, errors.Errorf("no webhook plugin registered with name: %s", name)
+			}
+			service, err := plugin(session)
+			if err != nil {
+				return nil, err
+			}
+			return &pluginWebhookService{WebhookService: service, def: def}, nil
+		}
+		if def == nil {
+			return nil, errors.New("no webhook service configured")
+		}
+		return def(session)
+	}
+}
+
+// classificationPluginFactory wraps the passed in default factory so that a selected plugin is used if there is one
+func classificationPluginFactory(def engine.ClassificationServiceFactory) engine.ClassificationServiceFactory {
+	return func(session flows.Session, classifier *flows.Classifier) (flows.ClassificationService, error) {
+		if name := selectPlugin(session, ClassificationService); name != "" {
+			plugin, found := classificationPlugins[name]
+			if !found {
+				return nil, errors.Errorf("no classification plugin registered with name: %s", name)
+			}
+			return plugin(session, classifier)
+		}
+		if def == nil {
+			return nil, errors.New("no classification service configured")
+		}
+		return def(session, classifier)
+	}
+}
+
+// airtimePluginFactory wraps the passed in default factory so that a selected plugin is used if there is one
+func airtimePluginFactory(def engine.AirtimeServiceFactory) engine.AirtimeServiceFactory {
+	return func(session flows.Session) (flows.AirtimeService, error) {
+		if name := selectPlugin(session, AirtimeService); name != "" {
+			plugin, found := airtimePlugins[name]
+			if !found {
+				return nil, errors.Errorf("no airtime plugin registered with name: %s", name)
+			}
+			return plugin(session)
+		}
+		if def == nil {
+			return nil, errors.New("no airtime service configured")
+		}
+		return def(session)
+	}
+}
+
+// emailPluginFactory wraps the passed in default factory so that a selected plugin is used if there is one
+func emailPluginFactory(def engine.EmailServiceFactory) engine.EmailServiceFactory {
+	return func(session flows.Session) (flows.EmailService, error) {
+		if name := selectPlugin(session, EmailService); name != "" {
+			plugin, found := emailPlugins[name]
+			if !found {
+				return nil, errors.Errorf("no email plugin registered with name: %s", name)
+			}
+			return plugin(session)
+		}
+		if def == nil {
+			return nil, errors.New("no email service configured")
+		}
+		return def(session)
+	}
+}
@@ -0,0 +1,153 @@
+package goflow
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/config"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a session which only needs to be non-nil for plugins to be selected for it
+type pluginTestSession struct {
+	flows.Session
+}
+
+func (s *pluginTestSession) Runs() []flows.FlowRun { return nil }
+
+// webhook service which records the requests it's asked to make
+type recordingWebhookService struct {
+	requests []*http.Request
+}
+
+func (s *recordingWebhookService) Call(session flows.Session, request *http.Request) (*flows.WebhookCall, error) {
+	s.requests = append(s.requests, request)
+	return &flows.WebhookCall{}, nil
+}
+
+func TestPluginFactories(t *testing.T) {
+	defer func() {
+		pluginSelector = nil
+		delete(webhookPlugins, "acme")
+		delete(classificationPlugins, "acme")
+		delete(airtimePlugins, "acme")
+		delete(emailPlugins, "acme")
+	}()
+
+	// services report where they were created through their errors
+	fromDefault := errors.New("from default")
+	fromPlugin := errors.New("from acme")
+
+	RegisterWebhookPlugin("acme", func(flows.Session) (flows.WebhookService, error) { return nil, fromPlugin })
+	RegisterClassificationPlugin("acme", func(flows.Session, *flows.Classifier) (flows.ClassificationService, error) { return nil, fromPlugin })
+	RegisterAirtimePlugin("acme", func(flows.Session) (flows.AirtimeService, error) { return nil, fromPlugin })
+	RegisterEmailPlugin("acme", func(flows.Session) (flows.EmailService, error) { return nil, fromPlugin })
+
+	webhooks := webhookPluginFactory(func(flows.Session) (flows.WebhookService, error) { return nil, fromDefault })
+	classification := classificationPluginFactory(func(flows.Session, *flows.Classifier) (flows.ClassificationService, error) { return nil, fromDefault })
+	airtime := airtimePluginFactory(func(flows.Session) (flows.AirtimeService, error) { return nil, fromDefault })
+	email := emailPluginFactory(func(flows.Session) (flows.EmailService, error) { return nil, fromDefault })
+
+	session := &pluginTestSession{}
+
+	// calls each of our wrapped factories, returning the errors they return
+	callAll := func(s flows.Session) []string {
+		_, err1 := webhooks(s)
+		_, err2 := classification(s, nil)
+		_, err3 := airtime(s)
+		_, err4 := email(s)
+		return []string{err1.Error(), err2.Error(), err3.Error(), err4.Error()}
+	}
+
+	// no selector means default services
+	assert.Equal(t, []string{"from default", "from default", "from default", "from default"}, callAll(session))
+
+	selected := map[ServiceKind]string{}
+	RegisterPluginSelector(func(s flows.Session, kind ServiceKind) string { return selected[kind] })
+
+	// nothing selected means default services
+	assert.Equal(t, []string{"from default", "from default", "from default", "from default"}, callAll(session))
+
+	// selected plugins are used
+	selected = map[ServiceKind]string{WebhookService: "acme", ClassificationService: "acme", AirtimeService: "acme", EmailService: "acme"}
+	assert.Equal(t, []string{"from acme", "from acme", "from acme", "from acme"}, callAll(session))
+
+	// but there is nothing to select them for without a session
+	assert.Equal(t, []string{"from default", "from default", "from default", "from default"}, callAll(nil))
+
+	// selecting plugins which aren't registered is an error
+	selected = map[ServiceKind]string{WebhookService: "xyz", ClassificationService: "xyz", AirtimeService: "xyz", EmailService: "xyz"}
+	assert.Equal(t, []string{
+		"no webhook plugin registered with name: xyz",
+		"no classification plugin registered with name: xyz",
+		"no airtime plugin registered with name: xyz",
+		"no email plugin registered with name: xyz",
+	}, callAll(session))
+
+	// as is having no default service
+	selected = map[ServiceKind]string{}
+	_, err := webhookPluginFactory(nil)(session)
+	assert.EqualError(t, err, "no webhook service configured")
+	_, err = classificationPluginFactory(nil)(session, nil)
+	assert.EqualError(t, err, "no classification service configured")
+	_, err = airtimePluginFactory(nil)(session)
+	assert.EqualError(t, err, "no airtime service configured")
+	_, err = emailPluginFactory(nil)(session)
+	assert.EqualError(t, err, "no email service configured")
+}
+
+func TestWebhookPluginWithInternalServices(t *testing.T) {
+	config.Mailroom.Domain = "mailroom.io"
+	config.Mailroom.CallbackSecret = "sesame"
+	defer func() {
+		config.Mailroom.Domain = ""
+		config.Mailroom.CallbackSecret = ""
+		pluginSelector = nil
+		delete(webhookPlugins, "acme")
+	}()
+
+	internalCalls := 0
+	RegisterInternalService("plugin_test", func(session flows.Session, request *http.Request, simulated bool) (*http.Response, error) {
+		internalCalls++
+		return NewInternalResponse(request, http.StatusOK, map[string]string{})
+	})
+	defer delete(internalServices, "plugin_test")
+
+	plugin := &recordingWebhookService{}
+	RegisterWebhookPlugin("acme", func(flows.Session) (flows.WebhookService, error) { return plugin, nil })
+	RegisterPluginSelector(func(s flows.Session, kind ServiceKind) string { return "acme" })
+
+	// wrapped the same way as the engine's webhook service factory
+	factory := callbackWebhookFactory(webhookPluginFactory(internalServicesFactory(false, &http.Client{}, nil, nil, 10000)))
+
+	session := &pluginTestSession{}
+	svc, err := factory(session)
+	require.NoError(t, err)
+
+	// calls to internal services still reach them
+	request, err := http.NewRequest("POST", InternalServiceURL("plugin_test"), nil)
+	require.NoError(t, err)
+
+	call, err := svc.Call(session, request)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, call.Response.StatusCode)
+	assert.Equal(t, 1, internalCalls)
+	assert.Equal(t, 0, len(plugin.requests))
+
+	// other calls are made by the plugin, and still go through the callback service which removes the callback header
+	// when there's no run to resume
+	request, err = http.NewRequest("POST", "https://acme.com/hook", nil)
+	require.NoError(t, err)
+	request.Header.Set(CallbackHeader, "true")
+
+	_, err = svc.Call(session, request)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, internalCalls)
+	require.Equal(t, 1, len(plugin.requests))
+	assert.Equal(t, "https://acme.com/hook", plugin.requests[0].URL.String())
+	assert.Equal(t, "", plugin.requests[0].Header.Get(CallbackHeader))
+}
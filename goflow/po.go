@@ -0,0 +1,181 @@
+package goflow
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// POEntry is a single translatable string in a PO file
+type POEntry struct {
+	References []string
+	Flags      []string
+	Context    string
+	MsgID      string
+	MsgStr     string
+}
+
+// PO is a gettext PO file of translations into a single language
+type PO struct {
+	Language string
+	Entries  []*POEntry
+}
+
+// Write writes this PO file to the passed in writer
+func (p *PO) Write(w io.Writer) error {
+	b := &strings.Builder{}
+
+	b.WriteString("# Generated by mailroom\n")
+	b.WriteString("msgid \"\"\n")
+	b.WriteString("msgstr \"\"\n")
+	b.WriteString("\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	if p.Language != "" {
+		b.WriteString(fmt.Sprintf("\"Language: %s\\n\"\n", p.Language))
+	}
+
+	for _, e := range p.Entries {
+		b.WriteString("\n")
+		for _, r := range e.References {
+			b.WriteString(fmt.Sprintf("#: %s\n", r))
+		}
+		if len(e.Flags) > 0 {
+			b.WriteString(fmt.Sprintf("#, %s\n", strings.Join(e.Flags, ", ")))
+		}
+		if e.Context != "" {
+			b.WriteString(fmt.Sprintf("msgctxt \"%s\"\n", escapePO(e.Context)))
+		}
+		b.WriteString(fmt.Sprintf("msgid \"%s\"\n", escapePO(e.MsgID)))
+		b.WriteString(fmt.Sprintf("msgstr \"%s\"\n", escapePO(e.MsgStr)))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ReadPO reads a PO file, ignoring its header and any entries without a msgid
+func ReadPO(r io.Reader) (*PO, error) {
+	po := &PO{Entries: make([]*POEntry, 0)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	entry := &POEntry{}
+	var current *string // the string which continuation lines are appended to
+	hasMsgStr := false
+	lineNum := 0
+
+	// finishes the current entry, which is the header if it has no msgid
+	finish := func() {
+		if entry.MsgID == "" {
+			for _, line := range strings.Split(entry.MsgStr, "\n") {
+				if strings.HasPrefix(line, "Language:") {
+					po.Language = strings.TrimSpace(strings.TrimPrefix(line, "Language:"))
+				}
+			}
+		} else {
+			po.Entries = append(po.Entries, entry)
+		}
+		entry = &POEntry{}
+		current = nil
+		hasMsgStr = false
+	}
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// anything but a msgstr or its continuation after a msgstr starts a new entry
+		if hasMsgStr && line != "" && !strings.HasPrefix(line, "\"") {
+			finish()
+		}
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#:"):
+			entry.References = append(entry.References, strings.Fields(strings.TrimPrefix(line, "#:"))...)
+		case strings.HasPrefix(line, "#,"):
+			for _, f := range strings.Split(strings.TrimPrefix(line, "#,"), ",") {
+				entry.Flags = append(entry.Flags, strings.TrimSpace(f))
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "msgctxt "), strings.HasPrefix(line, "msgid "), strings.HasPrefix(line, "msgstr "):
+			parts := strings.SplitN(line, " ", 2)
+			value, err := unquotePO(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, errors.Wrapf(err, "error on line %d", lineNum)
+			}
+
+			switch parts[0] {
+			case "msgctxt":
+				current = &entry.Context
+			case "msgid":
+				current = &entry.MsgID
+			default:
+				current = &entry.MsgStr
+				hasMsgStr = true
+			}
+			*current = value
+		case strings.HasPrefix(line, "\""):
+			if current == nil {
+				return nil, errors.Errorf("unexpected string on line %d", lineNum)
+			}
+			value, err := unquotePO(line)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error on line %d", lineNum)
+			}
+			*current += value
+		default:
+			return nil, errors.Errorf("unexpected content on line %d", lineNum)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "error reading PO file")
+	}
+	if hasMsgStr {
+		finish()
+	}
+
+	return po, nil
+}
+
+var poEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t", "\r", "\\r")
+
+func escapePO(s string) string {
+	return poEscaper.Replace(s)
+}
+
+// unquotes a quoted PO string
+func unquotePO(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", errors.Errorf("invalid string: %s", s)
+	}
+	s = s[1 : len(s)-1]
+
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 == len(s) {
+			return "", errors.New("string ends with an escape")
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,161 @@
+package goflow_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/goflow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPO(t *testing.T) {
+	po := &goflow.PO{
+		Language: "spa",
+		Entries: []*goflow.POEntry{
+			{References: []string{"a/b/text:0"}, MsgID: "Hi \"there\"\nfriend", MsgStr: "Hola"},
+			{References: []string{"a/c/name:0", "a/d/name:0"}, Flags: []string{"fuzzy"}, Context: "menu", MsgID: "Yes", MsgStr: ""},
+		},
+	}
+
+	b := &strings.Builder{}
+	err := po.Write(b)
+	require.NoError(t, err)
+	assert.Equal(t, `# Generated by mailroom
+msgid ""
+msgstr ""
+"Content-Type: text/plain; charset=UTF-8\n"
+"Language: spa\n"
+
+#: a/b/text:0
+msgid "Hi \"there\"\nfriend"
+msgstr "Hola"
+
+#: a/c/name:0
+#: a/d/name:0
+#, fuzzy
+msgctxt "menu"
+msgid "Yes"
+msgstr ""
+`, b.String())
+
+	read, err := goflow.ReadPO(strings.NewReader(b.String()))
+	require.NoError(t, err)
+	assert.Equal(t, po, read)
+
+	// strings can be split across lines
+	read, err = goflow.ReadPO(strings.NewReader("msgid \"\"\n\"Hello \"\n\"world\"\nmsgstr \"Hola \"\n\"mundo\"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []*goflow.POEntry{{MsgID: "Hello world", MsgStr: "Hola mundo"}}, read.Entries)
+
+	_, err = goflow.ReadPO(strings.NewReader("msgid \"Hello\nmsgstr \"Hola\"\n"))
+	assert.EqualError(t, err, "error on line 1: invalid string: \"Hello")
+
+	_, err = goflow.ReadPO(strings.NewReader("msgid \"Hello\"\nfoo\n"))
+	assert.EqualError(t, err, "unexpected content on line 2")
+}
+
+const translationsFlow = `{
+	"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52",
+	"name": "Translations",
+	"spec_version": "13.0.0",
+	"type": "messaging",
+	"language": "eng",
+	"nodes": [
+		{
+			"uuid": "9b9d4b8e-0a0e-4a2b-9b63-1f5d1b5d1e01",
+			"actions": [
+				{"uuid": "e97cd6d5-3354-4dbd-85bc-6c1f87849eec", "type": "send_msg", "text": "Hi there", "quick_replies": ["Yes", "No"]}
+			],
+			"exits": [{"uuid": "0fd3b2e2-6e53-4b2b-8b4e-2d0e8f2b3a01", "destination_uuid": "2b4b5c7d-8e9f-4a1b-8c2d-3e4f5a6b7c02"}]
+		},
+		{
+			"uuid": "2b4b5c7d-8e9f-4a1b-8c2d-3e4f5a6b7c02",
+			"actions": [],
+			"router": {
+				"type": "switch",
+				"operand": "@input.text",
+				"wait": {"type": "msg"},
+				"cases": [
+					{"uuid": "5b8d5e3a-1c2d-4e3f-9a4b-5c6d7e8f9a03", "type": "has_any_word", "arguments": ["yes"], "category_uuid": "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c04"}
+				],
+				"categories": [
+					{"uuid": "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c04", "name": "Yes", "exit_uuid": "c3d4e5f6-a7b8-4c9d-8e0f-2a3b4c5d6e06"},
+					{"uuid": "b2c3d4e5-f6a7-4b8c-9d0e-1f2a3b4c5d05", "name": "Other", "exit_uuid": "d4e5f6a7-b8c9-4d0e-9f1a-3b4c5d6e7f07"}
+				],
+				"default_category_uuid": "b2c3d4e5-f6a7-4b8c-9d0e-1f2a3b4c5d05"
+			},
+			"exits": [{"uuid": "c3d4e5f6-a7b8-4c9d-8e0f-2a3b4c5d6e06"}, {"uuid": "d4e5f6a7-b8c9-4d0e-9f1a-3b4c5d6e7f07"}]
+		}
+	],
+	"localization": {
+		"spa": {
+			"e97cd6d5-3354-4dbd-85bc-6c1f87849eec": {"text": ["Hola"]}
+		}
+	}
+}`
+
+func TestTranslations(t *testing.T) {
+	definitions := []json.RawMessage{json.RawMessage(translationsFlow)}
+
+	po, err := goflow.ExtractTranslations(definitions, envs.Language("spa"))
+	require.NoError(t, err)
+	assert.Equal(t, "spa", po.Language)
+	assert.Equal(t, []*goflow.POEntry{
+		{References: []string{"502c3ee4-3249-4dee-8e71-c62070667d52/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/text:0"}, MsgID: "Hi there", MsgStr: "Hola"},
+		{References: []string{"502c3ee4-3249-4dee-8e71-c62070667d52/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/quick_replies:0", "502c3ee4-3249-4dee-8e71-c62070667d52/a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c04/name:0"}, MsgID: "Yes"},
+		{References: []string{"502c3ee4-3249-4dee-8e71-c62070667d52/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/quick_replies:1"}, MsgID: "No"},
+		{References: []string{"502c3ee4-3249-4dee-8e71-c62070667d52/b2c3d4e5-f6a7-4b8c-9d0e-1f2a3b4c5d05/name:0"}, MsgID: "Other"},
+		{References: []string{"502c3ee4-3249-4dee-8e71-c62070667d52/5b8d5e3a-1c2d-4e3f-9a4b-5c6d7e8f9a03/arguments:0"}, MsgID: "yes"},
+	}, po.Entries)
+
+	// can't export translations into a flow's base language
+	_, err = goflow.ExtractTranslations(definitions, envs.Language("eng"))
+	assert.EqualError(t, err, "eng is the base language of flow 502c3ee4-3249-4dee-8e71-c62070667d52")
+
+	// translate some of the strings, change an existing translation and add one for a string which has since changed
+	po.Entries[0].MsgStr = "Hola!"
+	po.Entries[1].MsgStr = "Sí"
+	po.Entries[3].MsgStr = "Otro"
+	po.Entries = append(po.Entries, &goflow.POEntry{
+		References: []string{"502c3ee4-3249-4dee-8e71-c62070667d52/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/text:0", "8c6b1a2e-0f4e-4b8a-9d2c-6e7f8a9b0c1d/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/text:0"},
+		MsgID:      "Hi",
+		MsgStr:     "Hola amigo",
+	})
+
+	updated, applied, conflicts, err := goflow.ApplyTranslations(definitions, po, envs.Language("spa"), false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, applied)
+	assert.Equal(t, []*goflow.TranslationConflict{
+		{Reference: "502c3ee4-3249-4dee-8e71-c62070667d52/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/text:0", MsgID: "Hi there", MsgStr: "Hola!", Reason: "string already has a different translation"},
+		{Reference: "502c3ee4-3249-4dee-8e71-c62070667d52/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/text:0", MsgID: "Hi", MsgStr: "Hola amigo", Reason: "string has changed"},
+	}, conflicts)
+
+	localization := func(definition json.RawMessage) map[string]map[string][]string {
+		flow := &struct {
+			Localization map[string]map[string]map[string][]string `json:"localization"`
+		}{}
+		require.NoError(t, json.Unmarshal(definition, flow))
+		return flow.Localization["spa"]
+	}
+
+	assert.Equal(t, map[string]map[string][]string{
+		"e97cd6d5-3354-4dbd-85bc-6c1f87849eec": {"text": {"Hola"}, "quick_replies": {"Sí", "No"}},
+		"a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c04": {"name": {"Sí"}},
+		"b2c3d4e5-f6a7-4b8c-9d0e-1f2a3b4c5d05": {"name": {"Otro"}},
+	}, localization(updated[0]))
+
+	// updated flows are still valid
+	_, err = goflow.ReadFlow(updated[0])
+	assert.NoError(t, err)
+
+	// with overwrite, existing translations are replaced
+	updated, applied, conflicts, err = goflow.ApplyTranslations(definitions, po, envs.Language("spa"), true)
+	require.NoError(t, err)
+	assert.Equal(t, 4, applied)
+	assert.Equal(t, 1, len(conflicts))
+	assert.Equal(t, []string{"Hola!"}, localization(updated[0])["e97cd6d5-3354-4dbd-85bc-6c1f87849eec"]["text"])
+}
@@ -0,0 +1,96 @@
+package goflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/engine"
+	"github.com/nyaruka/goflow/services/webhooks"
+	"github.com/nyaruka/goflow/utils/httpx"
+	"github.com/nyaruka/mailroom/config"
+)
+
+const internalServicesPath = "/mr/services/"
+
+// InternalService is a service provided by mailroom itself which flows call like any other webhook. Calls never leave
+// mailroom but are otherwise retried, logged and routed on like calls to external systems. Services are told whether
+// the session is simulated by the engine which is running it, so that they can avoid any real side effects.
+type InternalService func(session flows.Session, request *http.Request, simulated bool) (*http.Response, error)
+
+var internalServices = make(map[string]InternalService)
+
+// RegisterInternalService registers an internal service which handles calls to its URL
+func RegisterInternalService(name string, service InternalService) {
+	internalServices[name] = service
+}
+
+// InternalServiceURL returns the URL which flows call to use the named internal service
+func InternalServiceURL(name string) string {
+	return fmt.Sprintf("https://%s%s%s", config.Mailroom.Domain, internalServicesPath, name)
+}
+
+// NewInternalResponse creates a JSON response to the passed in request to an internal service
+func NewInternalResponse(request *http.Request, status int, value interface{}) (*http.Response, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
+
+// transport which hands requests for internal services to those services and all other requests to the wrapped
+// transport
+type internalServicesTransport struct {
+	session   flows.Session
+	simulated bool
+	base      http.RoundTripper
+}
+
+func (t *internalServicesTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !isInternalServiceRequest(request) {
+		return t.base.RoundTrip(request)
+	}
+
+	service := internalServices[strings.TrimPrefix(request.URL.Path, internalServicesPath)]
+	if service == nil {
+		return NewInternalResponse(request, http.StatusNotFound, map[string]string{"error": "no such service"})
+	}
+	return service(t.session, request, t.simulated)
+}
+
+// returns whether the passed in request is a call to one of our internal services
+func isInternalServiceRequest(request *http.Request) bool {
+	return config.Mailroom.Domain != "" && request.URL.Host == config.Mailroom.Domain && strings.HasPrefix(request.URL.Path, internalServicesPath)
+}
+
+// internalServicesFactory creates webhook services for sessions which can also call internal services
+func internalServicesFactory(simulated bool, httpClient *http.Client, httpRetries *httpx.RetryConfig, headers map[string]string, maxBodyBytes int) engine.WebhookServiceFactory {
+	return func(session flows.Session) (flows.WebhookService, error) {
+		base := httpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+
+		sessionClient := &http.Client{
+			Transport: &internalServicesTransport{session: session, simulated: simulated, base: base},
+			Timeout:   httpClient.Timeout,
+		}
+		return webhooks.NewServiceFactory(sessionClient, httpRetries, headers, maxBodyBytes)(session)
+	}
+}
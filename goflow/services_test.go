@@ -0,0 +1,65 @@
+package goflow
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestInternalServices(t *testing.T) {
+	config.Mailroom.Domain = "mailroom.io"
+	defer func() { config.Mailroom.Domain = "" }()
+
+	RegisterInternalService("echo", func(session flows.Session, request *http.Request, simulated bool) (*http.Response, error) {
+		return NewInternalResponse(request, http.StatusOK, map[string]interface{}{"path": request.URL.Path, "simulated": simulated})
+	})
+
+	external := 0
+	transport := &internalServicesTransport{base: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		external++
+		return NewInternalResponse(r, http.StatusOK, map[string]string{})
+	})}
+
+	assert.Equal(t, "https://mailroom.io/mr/services/echo", InternalServiceURL("echo"))
+
+	call := func(url string) (int, string) {
+		request, _ := http.NewRequest("GET", url, nil)
+		response, err := transport.RoundTrip(request)
+		require.NoError(t, err)
+		body, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+
+	status, body := call("https://mailroom.io/mr/services/echo")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, `{"path":"/mr/services/echo","simulated":false}`, body)
+
+	// services are told when sessions are simulated, regardless of what headers the request has
+	transport.simulated = true
+	request, _ := http.NewRequest("GET", "https://mailroom.io/mr/services/echo", nil)
+	request.Header.Set("X-Mailroom-Mode", "normal")
+	response, err := transport.RoundTrip(request)
+	require.NoError(t, err)
+	simBody, _ := ioutil.ReadAll(response.Body)
+	assert.Equal(t, `{"path":"/mr/services/echo","simulated":true}`, string(simBody))
+	transport.simulated = false
+
+	status, body = call("https://mailroom.io/mr/services/xyz")
+	assert.Equal(t, 404, status)
+	assert.Equal(t, `{"error":"no such service"}`, body)
+
+	// other requests go out as normal
+	call("https://example.com/mr/services/echo")
+	call("https://mailroom.io/mr/other")
+	assert.Equal(t, 2, external)
+}
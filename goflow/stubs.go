@@ -0,0 +1,164 @@
+package goflow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/engine"
+	"github.com/nyaruka/mailroom/config"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// WebhookStub is a canned response to a webhook call
+//
+//   {"status": 200, "headers": {"Content-Type": "application/json"}, "body": "{\"name\": \"Bob\"}"}
+//
+type WebhookStub struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// AirtimeStub is the outcome of airtime transfers, which either fail with the given error or transfer the actual
+// amount, if given, or else the desired amount
+//
+//   {"actual_amount": 0.5, "error": ""}
+//
+type AirtimeStub struct {
+	ActualAmount *decimal.Decimal `json:"actual_amount,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// SimulatorStubs are canned responses for the services used by simulated sessions, so that flows can be tested
+// without making any external calls. Webhook responses are keyed by URL and classifications by classifier UUID.
+// Webhook calls and classifications which aren't stubbed fail, unless passthrough is set in which case they are made
+// for real like they are by the simulator.
+type SimulatorStubs struct {
+	Webhooks        map[string]*WebhookStub                         `json:"webhooks,omitempty"`
+	Classifications map[assets.ClassifierUUID]*flows.Classification `json:"classifications,omitempty"`
+	Airtime         *AirtimeStub                                    `json:"airtime,omitempty"`
+	Passthrough     bool                                            `json:"passthrough,omitempty"`
+}
+
+// StubbedSimulator returns an engine for simulated sessions which uses the passed in stubs instead of the simulator's
+// services. If stubs is nil then nothing is stubbed and no external calls are made at all.
+func StubbedSimulator(stubs *SimulatorStubs) flows.Engine {
+	if stubs == nil {
+		stubs = &SimulatorStubs{}
+	}
+
+	// nothing stubbed and everything passed through is just the simulator
+	if stubs.Passthrough && stubs.Webhooks == nil && stubs.Classifications == nil && stubs.Airtime == nil {
+		return Simulator()
+	}
+
+	// webhook calls to stubbed URLs get the stubbed response, and other calls are passed through to a real transport if
+	// allowed, but calls to internal services are always handled as they are by the simulator
+	realClient, _ := webhooksHTTP()
+	transport := &stubbedTransport{responses: stubs.Webhooks}
+	if stubs.Passthrough {
+		transport.passthrough = realClient.Transport
+	}
+	webhookHeaders := map[string]string{
+		"User-Agent":      "RapidProMailroom/" + config.Mailroom.Version,
+		"X-Mailroom-Mode": "simulation",
+	}
+	httpClient := &http.Client{Transport: transport, Timeout: realClient.Timeout}
+	webhookFactory := internalServicesFactory(true, httpClient, nil, webhookHeaders, config.Mailroom.WebhooksMaxBodyBytes)
+
+	classificationFactory := func(session flows.Session, classifier *flows.Classifier) (flows.ClassificationService, error) {
+		classification, found := stubs.Classifications[classifier.UUID()]
+		if found {
+			return &stubbedClassificationService{classification: classification}, nil
+		}
+		if stubs.Passthrough {
+			return Simulator().Services().Classification(session, classifier)
+		}
+		return nil, errors.Errorf("no stubbed classification for classifier %s", classifier.UUID())
+	}
+
+	airtimeFactory := engine.AirtimeServiceFactory(simulatorAirtimeServiceFactory)
+	if stubs.Airtime != nil {
+		airtimeFactory = func(session flows.Session) (flows.AirtimeService, error) {
+			return &stubbedAirtimeService{stub: stubs.Airtime}, nil
+		}
+	}
+
+	return engine.NewBuilder().
+		WithWebhookServiceFactory(webhookFactory).
+		WithClassificationServiceFactory(classificationFactory).
+		WithEmailServiceFactory(simulatorEmailServiceFactory).
+		WithAirtimeServiceFactory(airtimeFactory).
+		WithMaxStepsPerSprint(config.Mailroom.MaxStepsPerSprint).
+		Build()
+}
+
+// transport which returns stubbed responses rather than making requests, and either passes requests to any other URL
+// through to a real transport or fails them
+type stubbedTransport struct {
+	responses   map[string]*WebhookStub
+	passthrough http.RoundTripper
+}
+
+func (t *stubbedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	stub, found := t.responses[request.URL.String()]
+	if !found {
+		if t.passthrough != nil {
+			return t.passthrough.RoundTrip(request)
+		}
+		return nil, errors.Errorf("no stubbed response for %s", request.URL)
+	}
+
+	status := stub.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	header := make(http.Header, len(stub.Headers))
+	for k, v := range stub.Headers {
+		header.Set(k, v)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(stub.Body)),
+		ContentLength: int64(len(stub.Body)),
+		Request:       request,
+	}, nil
+}
+
+type stubbedClassificationService struct {
+	classification *flows.Classification
+}
+
+func (s *stubbedClassificationService) Classify(session flows.Session, input string, logHTTP flows.HTTPLogCallback) (*flows.Classification, error) {
+	return s.classification, nil
+}
+
+type stubbedAirtimeService struct {
+	stub *AirtimeStub
+}
+
+func (s *stubbedAirtimeService) Transfer(session flows.Session, sender urns.URN, recipient urns.URN, amounts map[string]decimal.Decimal, logHTTP flows.HTTPLogCallback) (*flows.AirtimeTransfer, error) {
+	transfer, _ := (&simulatorAirtimeService{}).Transfer(session, sender, recipient, amounts, logHTTP)
+
+	if s.stub.Error != "" {
+		transfer.ActualAmount = decimal.Zero
+		return transfer, errors.New(s.stub.Error)
+	}
+	if s.stub.ActualAmount != nil {
+		transfer.ActualAmount = *s.stub.ActualAmount
+	}
+	return transfer, nil
+}
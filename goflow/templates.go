@@ -0,0 +1,255 @@
+package goflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+// FlowTemplate is a templated string in a flow, e.g. the text of a message, with where it is found and the
+// expressions it references
+type FlowTemplate struct {
+	NodeUUID    flows.NodeUUID   `json:"node_uuid"`
+	ActionUUID  flows.ActionUUID `json:"action_uuid,omitempty"`
+	CaseUUID    string           `json:"case_uuid,omitempty"`
+	Field       string           `json:"field"`
+	Language    string           `json:"language,omitempty"`
+	Template    string           `json:"template"`
+	Expressions []string         `json:"expressions"`
+}
+
+// the fields of each action type which are evaluated as templates
+var actionTemplateFields = map[string][]string{
+	"add_contact_urn":      {"path"},
+	"call_webhook":         {"url", "headers", "body"},
+	"play_audio":           {"audio_url"},
+	"say_msg":              {"text"},
+	"send_broadcast":       {"text", "attachments", "quick_replies", "legacy_vars"},
+	"send_email":           {"addresses", "subject", "body"},
+	"send_msg":             {"text", "attachments", "quick_replies"},
+	"set_contact_field":    {"value"},
+	"set_contact_language": {"language"},
+	"set_contact_name":     {"name"},
+	"set_run_result":       {"value"},
+	"start_session":        {"contact_query", "legacy_vars"},
+}
+
+// the top level names in the context which a bare expression like @contact.name can start with, anything else
+// after an @ is literal text, e.g. an email address
+var contextTopLevels = map[string]bool{
+	"child":        true,
+	"contact":      true,
+	"fields":       true,
+	"globals":      true,
+	"input":        true,
+	"legacy_extra": true,
+	"parent":       true,
+	"results":      true,
+	"run":          true,
+	"trigger":      true,
+	"urns":         true,
+	"webhook":      true,
+}
+
+type templatesFlow struct {
+	Nodes        []*templatesNode                          `json:"nodes"`
+	Localization map[string]map[string]map[string][]string `json:"localization"`
+}
+
+type templatesNode struct {
+	UUID    flows.NodeUUID           `json:"uuid"`
+	Actions []map[string]interface{} `json:"actions"`
+	Router  *struct {
+		Operand string `json:"operand"`
+		Cases   []struct {
+			UUID      string   `json:"uuid"`
+			Arguments []string `json:"arguments"`
+		} `json:"cases"`
+	} `json:"router"`
+}
+
+// ExtractTemplates returns all the templated strings in the passed in flow, including their translations, in the
+// order they appear in the flow. Empty strings are ignored.
+func ExtractTemplates(flow flows.Flow) ([]*FlowTemplate, error) {
+	definition, err := json.Marshal(flow)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling flow")
+	}
+
+	f := &templatesFlow{}
+	if err := json.Unmarshal(definition, f); err != nil {
+		return nil, errors.Wrapf(err, "error reading flow nodes")
+	}
+
+	languages := make([]string, 0, len(f.Localization))
+	for lang := range f.Localization {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+
+	templates := make([]*FlowTemplate, 0)
+	addValues := func(t FlowTemplate, values []string, indexed bool) {
+		for i, v := range values {
+			if v == "" {
+				continue
+			}
+			tpl := t
+			if indexed {
+				tpl.Field = fmt.Sprintf("%s[%d]", t.Field, i)
+			}
+			tpl.Template = v
+			tpl.Expressions = TemplateExpressions(v)
+			templates = append(templates, &tpl)
+		}
+	}
+
+	// adds the passed in values and any translations of them, which are localized by the UUID of the action or case
+	add := func(t FlowTemplate, localizedBy string, values []string, indexed bool) {
+		addValues(t, values, indexed)
+
+		if localizedBy != "" {
+			for _, lang := range languages {
+				translated := f.Localization[lang][localizedBy][t.Field]
+				if len(translated) > 0 {
+					t.Language = lang
+					addValues(t, translated, indexed)
+				}
+			}
+		}
+	}
+
+	for _, node := range f.Nodes {
+		for _, action := range node.Actions {
+			actionType, _ := action["type"].(string)
+			actionUUID, _ := action["uuid"].(string)
+
+			for _, field := range actionTemplateFields[actionType] {
+				t := FlowTemplate{NodeUUID: node.UUID, ActionUUID: flows.ActionUUID(actionUUID), Field: field}
+
+				switch value := action[field].(type) {
+				case string:
+					add(t, actionUUID, []string{value}, false)
+				case []interface{}:
+					add(t, actionUUID, toStrings(value), true)
+				case map[string]interface{}:
+					// e.g. webhook headers, keyed by header name
+					keys := make([]string, 0, len(value))
+					for k := range value {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+
+					for _, k := range keys {
+						v, _ := value[k].(string)
+						add(FlowTemplate{NodeUUID: node.UUID, ActionUUID: t.ActionUUID, Field: field + "." + k}, "", []string{v}, false)
+					}
+				}
+			}
+		}
+
+		if node.Router != nil {
+			add(FlowTemplate{NodeUUID: node.UUID, Field: "operand"}, "", []string{node.Router.Operand}, false)
+
+			for _, c := range node.Router.Cases {
+				add(FlowTemplate{NodeUUID: node.UUID, CaseUUID: c.UUID, Field: "arguments"}, c.UUID, c.Arguments, true)
+			}
+		}
+	}
+
+	return templates, nil
+}
+
+// TemplateExpressions returns the expressions referenced by the passed in template, e.g. "Hi @contact.name" returns
+// ["contact.name"] and "@(upper(contact.name))" returns ["upper(contact.name)"]
+func TemplateExpressions(template string) []string {
+	expressions := make([]string, 0)
+	runes := []rune(template)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || i+1 == len(runes) {
+			continue
+		}
+
+		next := runes[i+1]
+
+		if next == '@' {
+			// escaped @
+			i++
+		} else if next == '(' {
+			end := closingParen(runes, i+1)
+			if end < 0 {
+				break
+			}
+			expressions = append(expressions, strings.TrimSpace(string(runes[i+2:end])))
+			i = end
+		} else if isIdentifierStart(next) {
+			end := i + 1
+			for end < len(runes) && (isIdentifierChar(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			identifier := strings.TrimRight(string(runes[i+1:end]), ".")
+			topLevel := strings.ToLower(strings.SplitN(identifier, ".", 2)[0])
+
+			if contextTopLevels[topLevel] {
+				expressions = append(expressions, identifier)
+			}
+			i = end - 1
+		}
+	}
+
+	return expressions
+}
+
+// returns the index of the paren which closes the one at start, ignoring any inside string literals, or -1
+func closingParen(runes []rune, start int) int {
+	depth := 0
+	inString := false
+
+	for i := start; i < len(runes); i++ {
+		r := runes[i]
+
+		if inString {
+			if r == '\\' {
+				i++
+			} else if r == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch r {
+		case '"':
+			inString = true
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isIdentifierStart(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_'
+}
+
+func isIdentifierChar(r rune) bool {
+	return isIdentifierStart(r) || (r >= '0' && r <= '9')
+}
+
+func toStrings(values []interface{}) []string {
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, isStr := v.(string); isStr {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
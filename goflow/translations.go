@@ -0,0 +1,313 @@
+package goflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/pkg/errors"
+)
+
+// TranslationConflict is a translation in a PO file which couldn't be applied to a flow
+type TranslationConflict struct {
+	Reference string `json:"reference"`
+	MsgID     string `json:"msgid"`
+	MsgStr    string `json:"msgstr"`
+	Reason    string `json:"reason"`
+}
+
+// the fields of each action type which can be translated
+var actionLocalizableFields = map[string][]string{
+	"play_audio":     {"audio_url"},
+	"say_msg":        {"text"},
+	"send_broadcast": {"text", "attachments", "quick_replies"},
+	"send_email":     {"subject", "body"},
+	"send_msg":       {"text", "attachments", "quick_replies"},
+}
+
+type translationsFlow struct {
+	UUID     string `json:"uuid"`
+	Language string `json:"language"`
+	Nodes    []struct {
+		Actions []map[string]interface{} `json:"actions"`
+		Router  *struct {
+			Categories []struct {
+				UUID string `json:"uuid"`
+				Name string `json:"name"`
+			} `json:"categories"`
+			Cases []struct {
+				UUID      string   `json:"uuid"`
+				Arguments []string `json:"arguments"`
+			} `json:"cases"`
+		} `json:"router"`
+	} `json:"nodes"`
+	Localization map[string]map[string]map[string][]string `json:"localization"`
+}
+
+// a translatable property of an action, category or case, whose translations are localized by its UUID
+type localizable struct {
+	UUID     string
+	Property string
+	Values   []string
+}
+
+// returns the translatable properties of the passed in flow in the order they appear in it
+func (f *translationsFlow) localizables() []*localizable {
+	items := make([]*localizable, 0)
+
+	for _, node := range f.Nodes {
+		for _, action := range node.Actions {
+			actionType, _ := action["type"].(string)
+			actionUUID, _ := action["uuid"].(string)
+
+			for _, field := range actionLocalizableFields[actionType] {
+				switch value := action[field].(type) {
+				case string:
+					items = append(items, &localizable{UUID: actionUUID, Property: field, Values: []string{value}})
+				case []interface{}:
+					items = append(items, &localizable{UUID: actionUUID, Property: field, Values: toStrings(value)})
+				}
+			}
+		}
+
+		if node.Router != nil {
+			for _, c := range node.Router.Categories {
+				items = append(items, &localizable{UUID: c.UUID, Property: "name", Values: []string{c.Name}})
+			}
+			for _, c := range node.Router.Cases {
+				items = append(items, &localizable{UUID: c.UUID, Property: "arguments", Values: c.Arguments})
+			}
+		}
+	}
+
+	return items
+}
+
+// reads the passed in flow, migrating it if necessary, into both our struct and a generic map which can be modified
+func readTranslationsFlow(definition json.RawMessage) (*translationsFlow, map[string]interface{}, error) {
+	flow, err := ReadFlow(definition)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrated, err := json.Marshal(flow)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error marshalling flow")
+	}
+
+	f := &translationsFlow{}
+	if err := json.Unmarshal(migrated, f); err != nil {
+		return nil, nil, errors.Wrapf(err, "error reading flow nodes")
+	}
+
+	generic := make(map[string]interface{})
+	if err := json.Unmarshal(migrated, &generic); err != nil {
+		return nil, nil, errors.Wrapf(err, "error reading flow")
+	}
+	return f, generic, nil
+}
+
+// the reference to a value of a localizable in a PO file, e.g. <flow uuid>/<action uuid>/quick_replies:1
+func translationReference(flowUUID string, item *localizable, index int) string {
+	return fmt.Sprintf("%s/%s/%s:%d", flowUUID, item.UUID, item.Property, index)
+}
+
+// ExtractTranslations extracts the translatable strings in the passed in flows into a PO file, with any existing
+// translations into the passed in language. Strings which appear more than once are a single entry with a reference
+// to each place they appear, which is marked fuzzy if those places have been translated differently.
+func ExtractTranslations(definitions []json.RawMessage, language envs.Language) (*PO, error) {
+	po := &PO{Language: string(language), Entries: make([]*POEntry, 0)}
+	entries := make(map[string]*POEntry)
+
+	for i, definition := range definitions {
+		f, _, err := readTranslationsFlow(definition)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read flow %d", i)
+		}
+		if envs.Language(f.Language) == language {
+			return nil, errors.Errorf("%s is the base language of flow %s", language, f.UUID)
+		}
+
+		for _, item := range f.localizables() {
+			translated := f.Localization[string(language)][item.UUID][item.Property]
+
+			for i, value := range item.Values {
+				if strings.TrimSpace(value) == "" {
+					continue
+				}
+
+				translation := ""
+				if i < len(translated) {
+					translation = translated[i]
+				}
+
+				entry := entries[value]
+				if entry == nil {
+					entry = &POEntry{MsgID: value, MsgStr: translation}
+					entries[value] = entry
+					po.Entries = append(po.Entries, entry)
+				} else if translation != "" {
+					if entry.MsgStr == "" {
+						entry.MsgStr = translation
+					} else if entry.MsgStr != translation && len(entry.Flags) == 0 {
+						entry.Flags = []string{"fuzzy"}
+					}
+				}
+				entry.References = append(entry.References, translationReference(f.UUID, item, i))
+			}
+		}
+	}
+
+	return po, nil
+}
+
+// ApplyTranslations applies the translations in the passed in PO file to the passed in flows as the passed in
+// language, returning the updated definitions, the number of translations applied, and any which couldn't be applied
+// because the string they translate has changed or no longer exists, they are fuzzy, or the string already has a
+// different translation and overwrite isn't set. References to flows which aren't included are ignored.
+func ApplyTranslations(definitions []json.RawMessage, po *PO, language envs.Language, overwrite bool) ([]json.RawMessage, int, []*TranslationConflict, error) {
+	type target struct {
+		flow    *translationsFlow
+		generic map[string]interface{}
+		items   map[string]*localizable
+	}
+
+	targets := make(map[string]*target, len(definitions))
+	ordered := make([]*target, len(definitions))
+
+	for i, definition := range definitions {
+		f, generic, err := readTranslationsFlow(definition)
+		if err != nil {
+			return nil, 0, nil, errors.Wrapf(err, "unable to read flow %d", i)
+		}
+		if envs.Language(f.Language) == language {
+			return nil, 0, nil, errors.Errorf("%s is the base language of flow %s", language, f.UUID)
+		}
+
+		t := &target{flow: f, generic: generic, items: make(map[string]*localizable)}
+		for _, item := range f.localizables() {
+			t.items[item.UUID+"/"+item.Property] = item
+		}
+		targets[f.UUID] = t
+		ordered[i] = t
+	}
+
+	applied := 0
+	conflicts := make([]*TranslationConflict, 0)
+	conflict := func(ref string, e *POEntry, reason string) {
+		conflicts = append(conflicts, &TranslationConflict{Reference: ref, MsgID: e.MsgID, MsgStr: e.MsgStr, Reason: reason})
+	}
+
+	for _, e := range po.Entries {
+		if e.MsgStr == "" {
+			continue
+		}
+
+		for _, ref := range e.References {
+			if hasFlag(e.Flags, "fuzzy") {
+				conflict(ref, e, "translation is fuzzy")
+				continue
+			}
+
+			flowUUID, key, index, err := parseTranslationReference(ref)
+			if err != nil {
+				conflict(ref, e, "invalid reference")
+				continue
+			}
+
+			t := targets[flowUUID]
+			if t == nil {
+				continue
+			}
+
+			item := t.items[key]
+			if item == nil || index >= len(item.Values) {
+				conflict(ref, e, "string no longer exists")
+				continue
+			}
+			if item.Values[index] != e.MsgID {
+				conflict(ref, e, "string has changed")
+				continue
+			}
+
+			existing := t.flow.Localization[string(language)][item.UUID][item.Property]
+			if index < len(existing) && existing[index] != "" && existing[index] != e.MsgStr && !overwrite {
+				conflict(ref, e, "string already has a different translation")
+				continue
+			}
+
+			setTranslation(t.generic, language, item, index, e.MsgStr)
+			applied++
+		}
+	}
+
+	updated := make([]json.RawMessage, len(ordered))
+	for i, t := range ordered {
+		definition, err := json.Marshal(t.generic)
+		if err != nil {
+			return nil, 0, nil, errors.Wrapf(err, "error marshalling flow")
+		}
+		updated[i] = definition
+	}
+
+	return updated, applied, conflicts, nil
+}
+
+// sets the translation of a value of a localizable in a generic flow definition. Translations of lists have to
+// include every value, so any which haven't been translated yet keep their untranslated values.
+func setTranslation(flow map[string]interface{}, language envs.Language, item *localizable, index int, translation string) {
+	localization := childMap(flow, "localization")
+	itemTranslations := childMap(childMap(localization, string(language)), item.UUID)
+
+	existing, _ := itemTranslations[item.Property].([]interface{})
+	values := make([]interface{}, len(item.Values))
+	for i := range values {
+		if i < len(existing) && existing[i] != "" {
+			values[i] = existing[i]
+		} else {
+			values[i] = item.Values[i]
+		}
+	}
+	values[index] = translation
+
+	itemTranslations[item.Property] = values
+}
+
+// returns the map under the passed in key of the passed in map, creating it if necessary
+func childMap(parent map[string]interface{}, key string) map[string]interface{} {
+	child, isMap := parent[key].(map[string]interface{})
+	if !isMap {
+		child = make(map[string]interface{})
+		parent[key] = child
+	}
+	return child
+}
+
+// parses a reference like <flow uuid>/<uuid>/<property>:<index> into the flow UUID, <uuid>/<property> and index
+func parseTranslationReference(ref string) (string, string, int, error) {
+	colon := strings.LastIndex(ref, ":")
+	if colon < 0 {
+		return "", "", 0, errors.New("missing index")
+	}
+	index, err := strconv.Atoi(ref[colon+1:])
+	if err != nil || index < 0 {
+		return "", "", 0, errors.New("invalid index")
+	}
+
+	parts := strings.SplitN(ref[:colon], "/", 2)
+	if len(parts) != 2 || strings.Count(parts[1], "/") != 1 {
+		return "", "", 0, errors.New("invalid path")
+	}
+	return parts[0], parts[1], index, nil
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package goflow
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/pkg/errors"
+)
+
+// FlowProblemType is the type of a problem found validating a flow
+type FlowProblemType string
+
+// the types of problems found validating a flow
+const (
+	FlowProblemInvalid           = FlowProblemType("invalid")
+	FlowProblemMissingDependency = FlowProblemType("missing_dependency")
+)
+
+// FlowProblem is a problem found validating a flow, located by the node and action where it was found if possible
+type FlowProblem struct {
+	Type        FlowProblemType  `json:"type"`
+	NodeUUID    flows.NodeUUID   `json:"node_uuid,omitempty"`
+	ActionUUID  flows.ActionUUID `json:"action_uuid,omitempty"`
+	Description string           `json:"description"`
+}
+
+type validateNode struct {
+	UUID    flows.NodeUUID           `json:"uuid"`
+	Actions []json.RawMessage        `json:"actions"`
+	Router  json.RawMessage          `json:"router"`
+	Exits   []map[string]interface{} `json:"exits"`
+}
+
+// ValidateDefinition validates the passed in flow definition, migrating it first if necessary, and returns all the
+// problems found rather than just the first. If session assets are passed in, the dependencies of each node are also
+// checked against them. Returns an error only if the definition can't be migrated or isn't a JSON object.
+//
+// Each action and router is read on its own in a copy of the flow with just that node, so that problems can be
+// located to where they are, and then exits are checked for destinations which aren't nodes in the flow.
+func ValidateDefinition(definition json.RawMessage, sa flows.SessionAssets) ([]*FlowProblem, error) {
+	migrated, err := MigrateDefinition(definition, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to migrate flow")
+	}
+
+	flow := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(migrated, &flow); err != nil {
+		return nil, errors.Wrapf(err, "unable to read flow")
+	}
+
+	nodes := make([]*validateNode, 0)
+	if err := json.Unmarshal(flow["nodes"], &nodes); err != nil && flow["nodes"] != nil {
+		return nil, errors.Wrapf(err, "unable to read flow nodes")
+	}
+
+	// nodes are read on their own so drop anything which refers across nodes
+	delete(flow, "_ui")
+	delete(flow, "localization")
+
+	problems := make([]*FlowProblem, 0)
+
+	// check the flow itself without any nodes
+	if _, err := readFlowWithNodes(flow); err != nil {
+		problems = append(problems, &FlowProblem{Type: FlowProblemInvalid, Description: err.Error()})
+		return problems, nil
+	}
+
+	nodeUUIDs := make(map[flows.NodeUUID]bool, len(nodes))
+	for _, node := range nodes {
+		nodeUUIDs[node.UUID] = true
+	}
+
+	for _, node := range nodes {
+		for _, action := range node.Actions {
+			a := &struct {
+				UUID flows.ActionUUID `json:"uuid"`
+			}{}
+			json.Unmarshal(action, a)
+
+			single := map[string]interface{}{
+				"uuid":    node.UUID,
+				"actions": []json.RawMessage{action},
+				"exits":   []map[string]interface{}{{"uuid": uuids.New()}},
+			}
+
+			if p := validateNodeInFlow(flow, single, sa); p != nil {
+				p.NodeUUID, p.ActionUUID = node.UUID, a.UUID
+				problems = append(problems, p)
+			}
+		}
+
+		exits := make([]map[string]interface{}, len(node.Exits))
+		for i, e := range node.Exits {
+			exits[i] = make(map[string]interface{}, len(e))
+			for k, v := range e {
+				if k != "destination_uuid" {
+					exits[i][k] = v
+				}
+			}
+		}
+
+		routerOnly := map[string]interface{}{"uuid": node.UUID, "actions": []json.RawMessage{}, "exits": exits}
+		if node.Router != nil {
+			routerOnly["router"] = node.Router
+		}
+
+		if p := validateNodeInFlow(flow, routerOnly, sa); p != nil {
+			p.NodeUUID = node.UUID
+			problems = append(problems, p)
+		}
+
+		for _, e := range node.Exits {
+			destination, _ := e["destination_uuid"].(string)
+			if destination != "" && !nodeUUIDs[flows.NodeUUID(destination)] {
+				problems = append(problems, &FlowProblem{
+					Type:        FlowProblemInvalid,
+					NodeUUID:    node.UUID,
+					Description: fmt.Sprintf("destination %s of exit[uuid=%v] isn't a known node", destination, e["uuid"]),
+				})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// reads the passed in node in a copy of the passed in flow, returning a problem if it's invalid, or if session assets
+// are passed in, has a missing dependency
+func validateNodeInFlow(flow map[string]json.RawMessage, node map[string]interface{}, sa flows.SessionAssets) *FlowProblem {
+	f, err := readFlowWithNodes(flow, node)
+	if err != nil {
+		return &FlowProblem{Type: FlowProblemInvalid, Description: err.Error()}
+	}
+
+	if sa != nil {
+		if err := f.CheckDependencies(sa, nil); err != nil {
+			return &FlowProblem{Type: FlowProblemMissingDependency, Description: err.Error()}
+		}
+	}
+	return nil
+}
+
+// reads the passed in flow with its nodes replaced by the passed in nodes
+func readFlowWithNodes(flow map[string]json.RawMessage, nodes ...map[string]interface{}) (flows.Flow, error) {
+	if nodes == nil {
+		nodes = []map[string]interface{}{}
+	}
+
+	nodesJSON, err := json.Marshal(nodes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling nodes")
+	}
+
+	copied := make(map[string]json.RawMessage, len(flow)+1)
+	for k, v := range flow {
+		copied[k] = v
+	}
+	copied["nodes"] = nodesJSON
+
+	definition, err := json.Marshal(copied)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling flow")
+	}
+
+	return ReadFlow(definition)
+}
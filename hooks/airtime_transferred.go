@@ -107,5 +107,10 @@ func handleAirtimeTransferred(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool,
 
 	session.AddPreCommitEvent(insertAirtimeTransfersHook, transfer)
 
+	// only transfers which went through are billable
+	if status == models.AirtimeTransferStatusSuccess {
+		session.AddUsage(models.UsageAirtimeTransfers, 1)
+	}
+
 	return nil
 }
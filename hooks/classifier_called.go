@@ -76,5 +76,7 @@ func handleClassifierCalled(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, or
 		session.AddPreCommitEvent(insertHTTPLogsHook, log)
 	}
 
+	session.AddUsage(models.UsageClassifierCalls, 1)
+
 	return nil
 }
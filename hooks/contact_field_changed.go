@@ -3,6 +3,7 @@ package hooks
 import (
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
@@ -56,8 +57,22 @@ func (h *CommitFieldChangesHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *red
 			}
 		}
 
+		// encrypt the values of any fields the org has designated as sensitive
+		values := make(map[assets.FieldUUID]interface{}, len(updates))
+		for k, v := range updates {
+			values[k] = v
+
+			if org.Org().IsEncryptedField(org.FieldByUUID(k).Key()) {
+				encrypted, err := org.Org().EncryptFieldValue(v)
+				if err != nil {
+					return errors.Wrapf(err, "error encrypting field value")
+				}
+				values[k] = encrypted
+			}
+		}
+
 		// marshal the rest of our updates to JSON
-		fieldJSON, err := json.Marshal(updates)
+		fieldJSON, err := json.Marshal(values)
 		if err != nil {
 			return errors.Wrapf(err, "error marshalling field values")
 		}
@@ -89,6 +104,35 @@ func (h *CommitFieldChangesHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *red
 	return nil
 }
 
+// RecordFieldUsageHook is our hook for recording when contact fields were last set
+type RecordFieldUsageHook struct{}
+
+var recordFieldUsageHook = &RecordFieldUsageHook{}
+
+// Apply records the last used time for all the fields that were changed
+func (h *RecordFieldUsageHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *models.OrgAssets, sessions map[*models.Session][]interface{}) error {
+	keys := make([]string, 0, len(sessions))
+	seen := make(map[string]bool)
+	for _, es := range sessions {
+		for _, e := range es {
+			key := e.(*events.ContactFieldChangedEvent).Field.Key
+			if !seen[key] && org.FieldByKey(key) != nil {
+				keys = append(keys, key)
+				seen[key] = true
+			}
+		}
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	err := models.RecordFieldUsage(rc, org.OrgID(), keys, time.Now())
+	if err != nil {
+		return errors.Wrapf(err, "error recording field usage")
+	}
+	return nil
+}
+
 // handleContactFieldChanged is called when a contact field changes
 func handleContactFieldChanged(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *models.OrgAssets, session *models.Session, e flows.Event) error {
 	event := e.(*events.ContactFieldChangedEvent)
@@ -102,6 +146,7 @@ func handleContactFieldChanged(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool,
 	// add our callback
 	session.AddPreCommitEvent(commitFieldChangesHook, event)
 	session.AddPreCommitEvent(updateCampaignEventsHook, event)
+	session.AddPostCommitEvent(recordFieldUsageHook, event)
 
 	return nil
 }
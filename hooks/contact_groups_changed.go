@@ -2,10 +2,10 @@ package hooks
 
 import (
 	"context"
+	"sort"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
-	"github.com/lib/pq"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
 	"github.com/nyaruka/mailroom/models"
@@ -22,40 +22,50 @@ type CommitGroupChangesHook struct{}
 
 var commitGroupChangesHook = &CommitGroupChangesHook{}
 
-// Apply squashes and adds or removes all our contact groups
+// Apply squashes and adds or removes all our contact groups. Changes are squashed to a single add or remove for each
+// contact and group across the whole batch, and written in a consistent order so that concurrent batches which touch
+// the same memberships lock them in the same order. Group counts are updated by database triggers and modified_on by
+// the contact modified hook.
 func (h *CommitGroupChangesHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *models.OrgAssets, sessions map[*models.Session][]interface{}) error {
-	// build up our list of all adds and removes
-	adds := make([]*models.GroupAdd, 0, len(sessions))
-	removes := make([]*models.GroupRemove, 0, len(sessions))
-	changed := make(map[models.ContactID]bool, len(sessions))
+	type membership struct {
+		contactID models.ContactID
+		groupID   models.GroupID
+	}
 
-	// we remove from our groups at once, build up our list
-	for _, events := range sessions {
-		// we use these sets to track what our final add or remove should be
-		seenAdds := make(map[models.GroupID]*models.GroupAdd)
-		seenRemoves := make(map[models.GroupID]*models.GroupRemove)
+	// we use these sets to track what our final add or remove should be for each membership
+	seenAdds := make(map[membership]*models.GroupAdd)
+	seenRemoves := make(map[membership]*models.GroupRemove)
 
+	for _, events := range sessions {
 		for _, e := range events {
 			switch event := e.(type) {
 			case *models.GroupAdd:
-				seenAdds[event.GroupID] = event
-				delete(seenRemoves, event.GroupID)
+				m := membership{event.ContactID, event.GroupID}
+				seenAdds[m] = event
+				delete(seenRemoves, m)
 			case *models.GroupRemove:
-				seenRemoves[event.GroupID] = event
-				delete(seenAdds, event.GroupID)
+				m := membership{event.ContactID, event.GroupID}
+				seenRemoves[m] = event
+				delete(seenAdds, m)
 			}
 		}
+	}
 
-		for _, add := range seenAdds {
-			adds = append(adds, add)
-			changed[add.ContactID] = true
-		}
+	adds := make([]*models.GroupAdd, 0, len(seenAdds))
+	for _, add := range seenAdds {
+		adds = append(adds, add)
+	}
+	sort.Slice(adds, func(i, j int) bool {
+		return adds[i].GroupID < adds[j].GroupID || (adds[i].GroupID == adds[j].GroupID && adds[i].ContactID < adds[j].ContactID)
+	})
 
-		for _, remove := range seenRemoves {
-			removes = append(removes, remove)
-			changed[remove.ContactID] = true
-		}
+	removes := make([]*models.GroupRemove, 0, len(seenRemoves))
+	for _, remove := range seenRemoves {
+		removes = append(removes, remove)
 	}
+	sort.Slice(removes, func(i, j int) bool {
+		return removes[i].GroupID < removes[j].GroupID || (removes[i].GroupID == removes[j].GroupID && removes[i].ContactID < removes[j].ContactID)
+	})
 
 	// do our updates
 	err := models.AddContactsToGroups(ctx, tx, adds)
@@ -68,18 +78,6 @@ func (h *CommitGroupChangesHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *red
 		return errors.Wrapf(err, "error removing contacts from groups")
 	}
 
-	// build the list of all contact ids changed, we'll update modified_on for them
-	changedIDs := make([]models.ContactID, 0, len(changed))
-	for c := range changed {
-		changedIDs = append(changedIDs, c)
-	}
-	if len(changedIDs) > 0 {
-		_, err = tx.ExecContext(ctx, `UPDATE contacts_contact SET modified_on = NOW() WHERE id = ANY($1)`, pq.Array(changedIDs))
-		if err != nil {
-			return errors.Wrapf(err, "error updating contacts modified_on")
-		}
-	}
-
 	return nil
 }
 
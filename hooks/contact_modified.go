@@ -7,6 +7,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // ContactModifiedHook is our hook for contact changes that require an update to modified_on
@@ -27,5 +28,34 @@ func (h *ContactModifiedHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.
 		return errors.Wrapf(err, "error updating modified_on on contacts")
 	}
 
+	// cached snapshots of these contacts are now stale
+	for session := range sessions {
+		session.AddPostCommitEvent(contactSnapshotHook, session.ContactID())
+	}
+
+	return nil
+}
+
+// ContactSnapshotHook is our hook for clearing cached snapshots of contacts once changes to them are committed
+type ContactSnapshotHook struct{}
+
+var contactSnapshotHook = &ContactSnapshotHook{}
+
+// Apply clears the cached snapshots of the contacts passed in
+func (h *ContactSnapshotHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *models.OrgAssets, sessions map[*models.Session][]interface{}) error {
+	contactIDs := make([]models.ContactID, 0, len(sessions))
+	for session := range sessions {
+		contactIDs = append(contactIDs, session.ContactID())
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	// snapshots are checked against modified_on when used so failing to clear them is logged but not returned
+	err := models.ClearContactSnapshots(rc, contactIDs)
+	if err != nil {
+		logrus.WithError(err).WithField("org_id", org.OrgID()).Error("error clearing contact snapshots")
+	}
+
 	return nil
 }
@@ -16,7 +16,8 @@ func init() {
 	models.RegisterEventHook(events.TypeEmailSent, handleEmailSent)
 }
 
-// goflow now sends email so this just logs the event
+// handleEmailSent queues the email to be sent once the session is committed if our email service only accepted it for
+// sending, rather than an email plugin having sent it
 func handleEmailSent(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *models.OrgAssets, session *models.Session, e flows.Event) error {
 
 	event := e.(*events.EmailSentEvent)
@@ -27,5 +28,7 @@ func handleEmailSent(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *mode
 		"to":           event.To,
 	}).Debug("email sent")
 
+	session.AddEmail(&models.EmailTask{To: event.To, Subject: event.Subject, Body: event.Body})
+
 	return nil
 }
@@ -0,0 +1,16 @@
+package hooks
+
+import (
+	"time"
+
+	"github.com/nyaruka/mailroom/models"
+)
+
+// handlers which take longer than this are logged
+const slowEventThreshold = time.Second
+
+func init() {
+	models.RegisterEventMiddleware(models.RecoverEvents)
+	models.RegisterEventMiddleware(models.TimeEvents(slowEventThreshold))
+	models.RegisterEventMiddleware(models.GateOrgEvents)
+}
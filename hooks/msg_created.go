@@ -34,6 +34,18 @@ func (h *SendMessagesHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Poo
 	rc := rp.Get()
 	defer rc.Close()
 
+	msgs := make([]*models.Msg, 0, len(sessions))
+	for _, args := range sessions {
+		for _, m := range args {
+			msgs = append(msgs, m.(*models.Msg))
+		}
+	}
+
+	// if sending is paused for this org, record our messages as failed instead of sending them
+	if paused, err := models.FailMessagesIfSendingPaused(ctx, tx, rc, org.OrgID(), msgs); paused || err != nil {
+		return err
+	}
+
 	// messages that need to be marked as pending
 	pending := make([]*models.Msg, 0, 1)
 
@@ -178,6 +190,7 @@ func handleMsgCreated(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *mod
 	event := e.(*events.MsgCreatedEvent)
 
 	logrus.WithFields(logrus.Fields{
+		"org_id":       org.OrgID(),
 		"contact_uuid": session.ContactUUID(),
 		"session_id":   session.ID(),
 		"text":         event.Msg.Text(),
@@ -212,6 +225,18 @@ func handleMsgCreated(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *mod
 		}
 	}
 
+	// if the channel has a region, this send may go out on another channel in that region, and if the channel is
+	// down it may go out on its backup channel
+	if channel != nil && session.SessionType() == models.MessagingFlow {
+		rc := rp.Get()
+		routed, err := models.SendChannel(rc, org, channel, event.Msg.URN().Scheme())
+		rc.Close()
+		if err != nil {
+			return errors.Wrapf(err, "error routing message")
+		}
+		channel = routed
+	}
+
 	msg, err := models.NewOutgoingMsg(org.OrgID(), channel, session.ContactID(), event.Msg, event.CreatedOn())
 	if err != nil {
 		return errors.Wrapf(err, "error creating outgoing message to %s", event.Msg.URN())
@@ -25,6 +25,7 @@ func handleMsgReceived(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *mo
 	}
 
 	logrus.WithFields(logrus.Fields{
+		"org_id":       org.OrgID(),
 		"contact_uuid": session.ContactUUID(),
 		"session_id":   session.ID(),
 		"text":         event.Msg.Text(),
@@ -0,0 +1,73 @@
+package hooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/actions"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaySessionEvents(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+
+	testers := assets.NewGroupReference(models.TestersGroupUUID, "Testers")
+	from := time.Now()
+
+	tcs := []HookTestCase{
+		HookTestCase{
+			Actions: ContactActionMap{
+				models.BobID: []flows.Action{
+					actions.NewAddContactGroups(newActionUUID(), []*assets.GroupReference{testers}),
+				},
+			},
+			SQLAssertions: []SQLAssertion{
+				SQLAssertion{
+					SQL:   "select count(*) from contacts_contactgroup_contacts where contact_id = $1 and contactgroup_id = $2",
+					Args:  []interface{}{models.BobID, models.TestersGroupID},
+					Count: 1,
+				},
+			},
+		},
+	}
+
+	RunActionTestCases(t, tcs)
+
+	// lose Bob's group membership as if the handler had a bug
+	db.MustExec(`DELETE FROM contacts_contactgroup_contacts WHERE contact_id = $1 AND contactgroup_id = $2`, models.BobID, models.TestersGroupID)
+
+	org, err := models.GetOrgAssets(ctx, db, models.Org1)
+	require.NoError(t, err)
+
+	replay := func(dryRun bool) int {
+		sessions, err := models.SelectReplaySessions(ctx, db, from, time.Now(), models.SessionID(0), 100)
+		require.NoError(t, err)
+		assert.Equal(t, 4, len(sessions))
+
+		total := 0
+		for _, s := range sessions {
+			count, err := models.ReplaySessionEvents(ctx, db, rp, org, s, map[string]bool{events.TypeContactGroupsChanged: true}, from, time.Now(), dryRun)
+			assert.NoError(t, err)
+			total += count
+		}
+		return total
+	}
+
+	// a dry run only counts the events
+	assert.Equal(t, 1, replay(true))
+	testsuite.AssertQueryCount(t, db, `select count(*) from contacts_contactgroup_contacts where contact_id = $1 and contactgroup_id = $2`, []interface{}{models.BobID, models.TestersGroupID}, 0)
+
+	assert.Equal(t, 1, replay(false))
+	testsuite.AssertQueryCount(t, db, `select count(*) from contacts_contactgroup_contacts where contact_id = $1 and contactgroup_id = $2`, []interface{}{models.BobID, models.TestersGroupID}, 1)
+
+	// sessions outside of our window aren't replayed
+	sessions, err := models.SelectReplaySessions(ctx, db, time.Now(), time.Now(), models.SessionID(0), 100)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(sessions))
+}
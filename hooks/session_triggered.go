@@ -76,6 +76,12 @@ func (h *InsertStartHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool
 
 			// look up our flow
 			f, err := org.Flow(event.Flow.UUID)
+
+			// soft deleted flows can't be started
+			if err == models.ErrNotFound {
+				logrus.WithField("session_id", s.ID).WithField("flow_uuid", event.Flow.UUID).Info("ignoring session trigger of inactive flow")
+				continue
+			}
 			if err != nil {
 				return errors.Wrapf(err, "unable to load flow with UUID: %s", event.Flow.UUID)
 			}
@@ -2,12 +2,14 @@ package hooks
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -63,6 +65,28 @@ func (h *InsertWebhookResultHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *re
 	return nil
 }
 
+// RecordPaymentTransfersHook is our hook for recording payment transfers made by flows
+type RecordPaymentTransfersHook struct{}
+
+var recordPaymentTransfersHook = &RecordPaymentTransfersHook{}
+
+// Apply records all the payment transfers that were made
+func (h *RecordPaymentTransfersHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *models.OrgAssets, sessions map[*models.Session][]interface{}) error {
+	transfers := make([]*models.PaymentTransfer, 0, len(sessions))
+	for _, ts := range sessions {
+		for _, t := range ts {
+			transfers = append(transfers, t.(*models.PaymentTransfer))
+		}
+	}
+
+	err := models.InsertPaymentTransfers(ctx, tx, org.OrgID(), transfers)
+	if err != nil {
+		return errors.Wrapf(err, "error recording payment transfers")
+	}
+
+	return nil
+}
+
 // handleWebhookCalled is called for each webhook call in a session
 func handleWebhookCalled(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *models.OrgAssets, session *models.Session, e flows.Event) error {
 	event := e.(*events.WebhookCalledEvent)
@@ -86,20 +110,46 @@ func handleWebhookCalled(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *
 		session.AddPreCommitEvent(unsubscribeResthookHook, unsub)
 	}
 
+	// calls to the payments service are recorded as transfers, from the body of the response
+	if event.URL == goflow.InternalServiceURL(models.PaymentsServiceName) {
+		parts := strings.SplitN(event.Response, "\r\n\r\n", 2)
+		if len(parts) == 2 {
+			if transfer := models.ReadPaymentTransfer([]byte(parts[1])); transfer != nil {
+				transfer.ContactID = session.ContactID()
+				session.AddPreCommitEvent(recordPaymentTransfersHook, transfer)
+			}
+		}
+	}
+
 	// if this is a connection error, use that as our response
 	response := event.Response
 	if event.Status == flows.CallStatusConnectionError {
 		response = "connection error"
 	}
 
+	// headers and JSON paths redacted by the org or flow have already been stripped from the event as the session was
+	// written, and orgs which redact PII don't store contact URNs or names in webhook results either
+	request := event.Request
+	if org.Org().RedactsPII() {
+		request = models.RedactContactPII(request, session.Contact())
+		response = models.RedactContactPII(response, session.Contact())
+	}
+
 	// create a result for this call
 	result := models.NewWebhookResult(
 		org.OrgID(), session.ContactID(),
-		event.URL, event.Request,
+		event.URL, request,
 		event.StatusCode, response,
 		time.Millisecond*time.Duration(event.ElapsedMS), event.CreatedOn(),
 	)
 	session.AddPreCommitEvent(insertWebhookResultHook, result)
 
+	// and count it towards the health of the webhook's host
+	session.AddWebhookCall(&models.WebhookCall{
+		URL:     event.URL,
+		Failed:  event.Status != flows.CallStatusSuccess,
+		Elapsed: time.Millisecond * time.Duration(event.ElapsedMS),
+	})
+
 	return nil
 }
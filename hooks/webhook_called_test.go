@@ -1,15 +1,23 @@
 package hooks
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/testsuite"
 
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/actions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type HookHandler struct{}
@@ -88,3 +96,121 @@ func TestWebhookCalled(t *testing.T) {
 
 	RunActionTestCases(t, tcs)
 }
+
+func TestPaymentTransfers(t *testing.T) {
+	testsuite.Reset()
+
+	config.Mailroom.Domain = "mailroom.io"
+	defer func() { config.Mailroom.Domain = "" }()
+
+	// our payment service declines transfers of 5000 and tracks the transfers it's asked to make, and which requests
+	// had an idempotency key header matching the key of their transfer
+	requests := make(map[string]int)
+	withHeader := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		transfer := &struct {
+			IdempotencyKey string `json:"idempotency_key"`
+			Amount         string `json:"amount"`
+		}{}
+		json.NewDecoder(r.Body).Decode(transfer)
+		requests[transfer.IdempotencyKey]++
+		if r.Header.Get("Idempotency-Key") == transfer.IdempotencyKey {
+			withHeader++
+		}
+
+		if transfer.Amount == "5000" {
+			w.Write([]byte(`{"category": "insufficient_funds", "message": "float too low"}`))
+		} else {
+			w.Write([]byte(fmt.Sprintf(`{"category": "success", "external_id": "TX%d"}`, len(requests))))
+		}
+	}))
+	defer server.Close()
+
+	testsuite.DB().MustExec(`UPDATE orgs_org SET config = $2 WHERE id = $1`, models.Org1, fmt.Sprintf(`{"payment_service": {"type": "http", "url": "%s"}}`, server.URL))
+
+	paymentsURL := goflow.InternalServiceURL(models.PaymentsServiceName)
+
+	assertTransfers := func(contactID models.ContactID, categories ...models.PaymentCategory) Assertion {
+		return func(t *testing.T, db *sqlx.DB, rc redis.Conn) error {
+			transfers, err := models.GetPaymentTransfers(testsuite.CTX(), db, models.Org1, contactID)
+			if err != nil {
+				return err
+			}
+			actual := make([]models.PaymentCategory, len(transfers))
+			for i := range transfers {
+				actual[i] = transfers[i].Category
+			}
+			assert.ElementsMatch(t, categories, actual, "transfer categories mismatch for contact %d", contactID)
+			return nil
+		}
+	}
+
+	tcs := []HookTestCase{
+		HookTestCase{
+			Actions: ContactActionMap{
+				// the same payment from the same node is only made once
+				models.CathyID: []flows.Action{
+					actions.NewCallWebhook(newActionUUID(), "POST", paymentsURL, nil, `{"amount": "100", "currency": "rwf"}`, "Payment"),
+					actions.NewCallWebhook(newActionUUID(), "POST", paymentsURL, nil, `{"amount": "100", "currency": "rwf"}`, "Payment"),
+				},
+				// unless it has different references
+				models.BobID: []flows.Action{
+					actions.NewCallWebhook(newActionUUID(), "POST", paymentsURL, nil, `{"amount": "100", "currency": "RWF", "reference": "1"}`, "Payment"),
+					actions.NewCallWebhook(newActionUUID(), "POST", paymentsURL, nil, `{"amount": "5000", "currency": "RWF", "reference": "2"}`, "Payment"),
+				},
+				// and invalid requests never reach the service
+				models.GeorgeID: []flows.Action{
+					actions.NewCallWebhook(newActionUUID(), "POST", paymentsURL, nil, `{"amount": "-5", "currency": "RWF"}`, "Payment"),
+				},
+			},
+			SQLAssertions: []SQLAssertion{
+				SQLAssertion{
+					SQL:   "select count(*) from api_webhookresult where contact_id = $1 AND status_code = 200",
+					Args:  []interface{}{models.CathyID},
+					Count: 2,
+				},
+				SQLAssertion{
+					SQL:   "select count(*) from api_webhookresult where contact_id = $1 AND status_code = 402",
+					Args:  []interface{}{models.BobID},
+					Count: 1,
+				},
+				SQLAssertion{
+					SQL:   "select count(*) from api_webhookresult where contact_id = $1 AND status_code = 400",
+					Args:  []interface{}{models.GeorgeID},
+					Count: 1,
+				},
+			},
+			Assertions: []Assertion{
+				assertTransfers(models.CathyID, models.PaymentCategorySuccess),
+				assertTransfers(models.BobID, models.PaymentCategorySuccess, models.PaymentCategoryInsufficientFunds),
+				assertTransfers(models.GeorgeID),
+			},
+		},
+	}
+
+	RunActionTestCases(t, tcs)
+
+	// our service was asked for Cathy's payment twice with the same idempotency key, and for each of Bob's once
+	counts := make([]int, 0, len(requests))
+	for _, count := range requests {
+		counts = append(counts, count)
+	}
+	assert.ElementsMatch(t, []int{2, 1, 1}, counts)
+
+	// every request, including the retry, had the transfer's idempotency key in its header as well as its body
+	assert.Equal(t, 4, withHeader)
+
+	// and one transfer recorded for each of those keys
+	var keys []string
+	err := testsuite.DB().Select(&keys, `SELECT idempotency_key FROM payments_transfer WHERE org_id = $1`, models.Org1)
+	require.NoError(t, err)
+
+	recorded := make(map[string]int)
+	for _, key := range keys {
+		recorded[key]++
+	}
+	assert.Equal(t, 3, len(keys))
+	for key := range requests {
+		assert.Equal(t, 1, recorded[key], "transfers mismatch for key %s", key)
+	}
+}
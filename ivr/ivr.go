@@ -14,9 +14,12 @@ import (
 
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/resumes"
+	"github.com/nyaruka/goflow/flows/routers/waits"
+	"github.com/nyaruka/goflow/flows/routers/waits/hints"
 	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/goflow/utils/uuids"
@@ -41,9 +44,6 @@ const (
 
 	// Our user agent
 	userAgent = "Mailroom/"
-
-	// ErrorMessage that is spoken to an IVR user if an error occurs
-	ErrorMessage = "An error has occurred, please try again later."
 )
 
 // WriteAttachments controls whether we write attachments, used during unit testing
@@ -81,10 +81,12 @@ type Client interface {
 
 	WriteSessionResponse(session *models.Session, resumeURL string, req *http.Request, w http.ResponseWriter) error
 
-	WriteErrorResponse(w http.ResponseWriter, err error) error
+	WriteErrorResponse(w http.ResponseWriter, msg string, err error) error
 
 	WriteEmptyResponse(w http.ResponseWriter, msg string) error
 
+	WriteRetryResponse(prompt string, resumeURL string, wait flows.ActivatedWait, w http.ResponseWriter) error
+
 	InputForRequest(r *http.Request) (string, utils.Attachment, error)
 
 	StatusForRequest(r *http.Request) (models.ConnectionStatus, int)
@@ -308,13 +310,27 @@ func RequestCallStartForConnection(ctx context.Context, config *config.Config, d
 	return nil
 }
 
+// ErrorMessage returns the message spoken to an IVR caller when an error occurs, in the language of the passed in
+// contact if the org has translated it. Either the org or contact can be nil if they haven't been loaded yet.
+func ErrorMessage(org *models.OrgAssets, contact *models.Contact) string {
+	if org == nil {
+		return models.DefaultSystemText(models.SystemTextIVRError)
+	}
+
+	lang := envs.NilLanguage
+	if contact != nil {
+		lang = contact.Language()
+	}
+	return org.Org().SystemText(models.SystemTextIVRError, lang)
+}
+
 // WriteErrorResponse marks the passed in connection as errored and writes the appropriate error response to our writer
-func WriteErrorResponse(ctx context.Context, db *sqlx.DB, client Client, conn *models.ChannelConnection, w http.ResponseWriter, rootErr error) error {
+func WriteErrorResponse(ctx context.Context, db *sqlx.DB, client Client, conn *models.ChannelConnection, w http.ResponseWriter, msg string, rootErr error) error {
 	err := conn.MarkFailed(ctx, db, time.Now())
 	if err != nil {
 		logrus.WithError(err).Error("error when trying to mark connection as errored")
 	}
-	return client.WriteErrorResponse(w, rootErr)
+	return client.WriteErrorResponse(w, msg, rootErr)
 }
 
 // StartIVRFlow takes care of starting the flow in the passed in start for the passed in contact and URN
@@ -325,7 +341,7 @@ func StartIVRFlow(
 
 	// connection isn't in a wired status, that's an error
 	if conn.Status() != models.ConnectionStatusWired && conn.Status() != models.ConnectionStatusInProgress {
-		return WriteErrorResponse(ctx, db, client, conn, w, errors.Errorf("connection in invalid state: %s", conn.Status()))
+		return WriteErrorResponse(ctx, db, client, conn, w, ErrorMessage(org, c), errors.Errorf("connection in invalid state: %s", conn.Status()))
 	}
 
 	// get the flow for our start
@@ -430,15 +446,15 @@ func ResumeIVRFlow(
 	}
 
 	if session == nil {
-		return WriteErrorResponse(ctx, db, client, conn, w, errors.Errorf("no active IVR session for contact"))
+		return WriteErrorResponse(ctx, db, client, conn, w, ErrorMessage(org, c), errors.Errorf("no active IVR session for contact"))
 	}
 
 	if session.ConnectionID() == nil {
-		return WriteErrorResponse(ctx, db, client, conn, w, errors.Errorf("active session: %d has no connection", session.ID()))
+		return WriteErrorResponse(ctx, db, client, conn, w, ErrorMessage(org, c), errors.Errorf("active session: %d has no connection", session.ID()))
 	}
 
 	if *session.ConnectionID() != conn.ID() {
-		return WriteErrorResponse(ctx, db, client, conn, w, errors.Errorf("active session: %d does not match connection: %d", session.ID(), *session.ConnectionID()))
+		return WriteErrorResponse(ctx, db, client, conn, w, ErrorMessage(org, c), errors.Errorf("active session: %d does not match connection: %d", session.ID(), *session.ConnectionID()))
 	}
 
 	// preprocess this request
@@ -462,7 +478,44 @@ func ResumeIVRFlow(
 			}
 		}
 
-		return WriteErrorResponse(ctx, db, client, conn, w, errors.Wrapf(err, "error finding input for request"))
+		return WriteErrorResponse(ctx, db, client, conn, w, ErrorMessage(org, c), errors.Wrapf(err, "error finding input for request"))
+	}
+
+	// callers who give no input or invalid input to a digits wait can be asked again if the flow allows it
+	if attachment == NilAttachment {
+		flow, err := org.SessionFlowByID(session.CurrentFlowID())
+		if err != nil {
+			return errors.Wrapf(err, "unable to load flow: %d", session.CurrentFlowID())
+		}
+
+		maxRetries := int(flow.IntConfigValue(models.FlowConfigIVRInputRetries, 0))
+		if maxRetries > 0 {
+			fsa, err := models.ResumeSessionAssets(org, flow)
+			if err != nil {
+				return errors.Wrapf(err, "unable to load assets")
+			}
+
+			fs, err := session.FlowSession(fsa, org.Env())
+			if err != nil {
+				return errors.Wrapf(err, "error reading flow session")
+			}
+
+			inputStatus := checkDigitsInput(fs.Wait(), input)
+			if inputStatus != inputValid {
+				retries, _ := strconv.Atoi(r.Form.Get("retry"))
+				if retries < maxRetries {
+					logrus.WithField("connection_id", conn.ID()).WithField("input_status", inputStatus).WithField("retries", retries).Info("asking IVR caller to retry input")
+
+					retryURL := fmt.Sprintf("%s&retry=%d", resumeURL, retries+1)
+					return client.WriteRetryResponse(inputRetryPrompt(org, flow, c, inputStatus), retryURL, fs.Wait(), w)
+				}
+
+				// retries are exhausted so rather than the caller's input, the flow is resumed with input which it can
+				// route to its own category, or which otherwise goes to its other category
+				logrus.WithField("connection_id", conn.ID()).WithField("input_status", inputStatus).Info("IVR caller ran out of input retries")
+				input = InputRetriesExhausted
+			}
+		}
 	}
 
 	// our msg UUID
@@ -487,17 +540,17 @@ func ResumeIVRFlow(
 		}
 
 		if err != nil {
-			return WriteErrorResponse(ctx, db, client, conn, w, errors.Wrapf(err, "error downloading attachment, ending call"))
+			return WriteErrorResponse(ctx, db, client, conn, w, ErrorMessage(org, c), errors.Wrapf(err, "error downloading attachment, ending call"))
 		}
 
 		if resp == nil {
-			return WriteErrorResponse(ctx, db, client, conn, w, errors.Errorf("unable to download attachment, ending call"))
+			return WriteErrorResponse(ctx, db, client, conn, w, ErrorMessage(org, c), errors.Errorf("unable to download attachment, ending call"))
 		}
 
 		// download our body
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return WriteErrorResponse(ctx, db, client, conn, w, errors.Wrapf(err, "unable to download attachment body, ending call"))
+			return WriteErrorResponse(ctx, db, client, conn, w, ErrorMessage(org, c), errors.Wrapf(err, "unable to download attachment body, ending call"))
 		}
 		resp.Body.Close()
 
@@ -555,6 +608,15 @@ func ResumeIVRFlow(
 	// create our msg resume event
 	resume := resumes.NewMsg(org.Env(), contact, msgIn)
 
+	return resumeIVRSession(ctx, db, rp, org, sa, session, resume, conn, client, resumeURL, r, w)
+}
+
+// resumes the passed in IVR session and writes the response for the next part of the call
+func resumeIVRSession(
+	ctx context.Context, db *sqlx.DB, rp *redis.Pool, org *models.OrgAssets, sa flows.SessionAssets,
+	session *models.Session, resume flows.Resume, conn *models.ChannelConnection, client Client, resumeURL string,
+	r *http.Request, w http.ResponseWriter) error {
+
 	// hook to set our connection on our session before our event hooks run
 	hook := func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *models.OrgAssets, sessions []*models.Session) error {
 		for _, session := range sessions {
@@ -572,7 +634,7 @@ func ResumeIVRFlow(
 		}
 	}
 
-	session, err = runner.ResumeFlow(ctx, db, rp, org, sa, session, resume, hook)
+	session, err := runner.ResumeFlow(ctx, db, rp, org, sa, session, resume, hook)
 	if err != nil {
 		return errors.Wrapf(err, "error resuming ivr flow")
 	}
@@ -595,6 +657,55 @@ func ResumeIVRFlow(
 	return nil
 }
 
+// the status of a caller's input to a wait
+type inputStatus string
+
+const (
+	inputValid   = inputStatus("valid")
+	inputNone    = inputStatus("no_input")
+	inputInvalid = inputStatus("invalid_input")
+)
+
+// checks the input given to the passed in wait, only digits waits are checked as any recording is valid
+func checkDigitsInput(wait flows.ActivatedWait, input string) inputStatus {
+	msgWait, isMsgWait := wait.(*waits.ActivatedMsgWait)
+	if !isMsgWait {
+		return inputValid
+	}
+	hint, isDigits := msgWait.Hint().(*hints.DigitsHint)
+	if !isDigits {
+		return inputValid
+	}
+
+	if input == "" {
+		return inputNone
+	}
+	if hint.Count != nil && len(input) != *hint.Count {
+		return inputInvalid
+	}
+	for _, r := range input {
+		if !strings.ContainsRune("0123456789*#", r) {
+			return inputInvalid
+		}
+	}
+	return inputValid
+}
+
+// InputRetriesExhausted is the input a flow is resumed with when a caller has run out of retries to give valid input
+// to a digits wait, so that flows can route these callers with a case like has_only_text(@input, "retries_exhausted")
+const InputRetriesExhausted = "retries_exhausted"
+
+// returns the prompt spoken to a caller before they are asked again for their input, which can be set on the flow
+// or otherwise is the org's system text in the contact's language
+func inputRetryPrompt(org *models.OrgAssets, flow *models.Flow, contact *models.Contact, status inputStatus) string {
+	configKey, textKey := models.FlowConfigIVRNoInputPrompt, models.SystemTextIVRNoInput
+	if status == inputInvalid {
+		configKey, textKey = models.FlowConfigIVRInvalidInputPrompt, models.SystemTextIVRInvalidInput
+	}
+
+	return flow.StringConfigValue(configKey, org.Org().SystemText(textKey, contact.Language()))
+}
+
 // HandleIVRStatus is called on status callbacks for an IVR call. We let the client decide whether the call has
 // ended for some reason and update the state of the call and session if so
 func HandleIVRStatus(ctx context.Context, db *sqlx.DB, rp *redis.Pool, org *models.OrgAssets, client Client, conn *models.ChannelConnection, r *http.Request, w http.ResponseWriter) error {
@@ -629,10 +740,20 @@ func HandleIVRStatus(ctx context.Context, db *sqlx.DB, rp *redis.Pool, org *mode
 		conn.MarkFailed(ctx, db, time.Now())
 	} else {
 		if status != conn.Status() || duration > 0 {
+			// calls are billed by the started minute, only count them the first time we learn their duration
+			billable := duration > 0 && conn.Duration() == 0
+
 			err := conn.UpdateStatus(ctx, db, status, duration, time.Now())
 			if err != nil {
 				return errors.Wrapf(err, "error updating call status")
 			}
+
+			if billable {
+				err = models.IncrementOrgUsage(ctx, db, org.OrgID(), models.UsageIVRMinutes, (duration+59)/60)
+				if err != nil {
+					logrus.WithError(err).WithField("connection_id", conn.ID()).Error("error incrementing ivr usage")
+				}
+			}
 		}
 	}
 
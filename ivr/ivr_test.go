@@ -0,0 +1,38 @@
+package ivr
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/flows/routers/waits"
+	"github.com/nyaruka/goflow/flows/routers/waits/hints"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDigitsInput(t *testing.T) {
+	fixed := waits.NewActivatedMsgWait(nil, hints.NewFixedDigitsHint(2))
+	terminated := waits.NewActivatedMsgWait(nil, hints.NewTerminatedDigitsHint("#"))
+	audio := waits.NewActivatedMsgWait(nil, hints.NewAudioHint())
+
+	tcs := []struct {
+		Wait     *waits.ActivatedMsgWait
+		Input    string
+		Expected inputStatus
+	}{
+		{fixed, "12", inputValid},
+		{fixed, "", inputNone},
+		{fixed, "1", inputInvalid},
+		{fixed, "123", inputInvalid},
+		{terminated, "12345", inputValid},
+		{terminated, "*9", inputValid},
+		{terminated, "", inputNone},
+		{terminated, "1a", inputInvalid},
+		{audio, "", inputValid},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.Expected, checkDigitsInput(tc.Wait, tc.Input), "unexpected status for input '%s'", tc.Input)
+	}
+
+	assert.Equal(t, inputValid, checkDigitsInput(nil, ""))
+}
@@ -503,11 +503,34 @@ func (c *client) WriteSessionResponse(session *models.Session, resumeURL string,
 	return nil
 }
 
+// WriteRetryResponse writes a NCCO response which says the passed in prompt and then waits again for input
+func (c *client) WriteRetryResponse(prompt string, resumeURL string, wait flows.ActivatedWait, w http.ResponseWriter) error {
+	waitActions, err := c.actionsForWait(resumeURL, wait)
+	if err != nil {
+		return errors.Wrap(err, "unable to build retry response for IVR call")
+	}
+
+	actions := []interface{}{Talk{Action: "talk", Text: prompt, BargeIn: true}}
+	actions = append(actions, waitActions...)
+
+	response, err := marshalActions(actions)
+	if err != nil {
+		return errors.Wrap(err, "unable to build retry response for IVR call")
+	}
+
+	_, err = w.Write([]byte(response))
+	if err != nil {
+		return errors.Wrap(err, "error writing IVR response")
+	}
+
+	return nil
+}
+
 // WriteErrorResponse writes an error / unavailable response
-func (c *client) WriteErrorResponse(w http.ResponseWriter, err error) error {
+func (c *client) WriteErrorResponse(w http.ResponseWriter, msg string, err error) error {
 	actions := []interface{}{Talk{
 		Action: "talk",
-		Text:   ivr.ErrorMessage,
+		Text:   msg,
 		Error:  err.Error(),
 	}}
 	body, err := json.Marshal(actions)
@@ -654,12 +677,51 @@ type Record struct {
 
 func (c *client) responseForSprint(resumeURL string, w flows.ActivatedWait, es []flows.Event) (string, error) {
 	actions := make([]interface{}, 0, 1)
+	waitActions, err := c.actionsForWait(resumeURL, w)
+	if err != nil {
+		return "", err
+	}
+
+	isWaitInput := false
+	if len(waitActions) > 0 {
+		_, isWaitInput = waitActions[0].(*Input)
+	}
+
+	for _, e := range es {
+		switch event := e.(type) {
+		case *events.IVRCreatedEvent:
+			if len(event.Msg.Attachments()) == 0 {
+				actions = append(actions, Talk{
+					Action:  "talk",
+					Text:    event.Msg.Text(),
+					BargeIn: isWaitInput,
+				})
+			} else {
+				for _, a := range event.Msg.Attachments() {
+					actions = append(actions, Stream{
+						Action:    "stream",
+						StreamURL: []string{a.URL()},
+					})
+				}
+			}
+		}
+	}
+
+	for _, w := range waitActions {
+		actions = append(actions, w)
+	}
+
+	return marshalActions(actions)
+}
+
+// builds the actions which wait for input for the passed in wait, if any
+func (c *client) actionsForWait(resumeURL string, w flows.ActivatedWait) ([]interface{}, error) {
 	waitActions := make([]interface{}, 0, 1)
 
 	if w != nil {
 		msgWait, isMsgWait := w.(*waits.ActivatedMsgWait)
 		if !isMsgWait {
-			return "", errors.Errorf("unable to use wait of type: %s in IVR call", w.Type())
+			return nil, errors.Errorf("unable to use wait of type: %s in IVR call", w.Type())
 		}
 
 		switch hint := msgWait.Hint().(type) {
@@ -718,39 +780,15 @@ func (c *client) responseForSprint(resumeURL string, w flows.ActivatedWait, es [
 			waitActions = append(waitActions, input)
 
 		default:
-			return "", errors.Errorf("unable to use wait in IVR call, unknow type: %s", msgWait.Hint().Type())
+			return nil, errors.Errorf("unable to use wait in IVR call, unknow type: %s", msgWait.Hint().Type())
 		}
 	}
 
-	isWaitInput := false
-	if len(waitActions) > 0 {
-		_, isWaitInput = waitActions[0].(*Input)
-	}
-
-	for _, e := range es {
-		switch event := e.(type) {
-		case *events.IVRCreatedEvent:
-			if len(event.Msg.Attachments()) == 0 {
-				actions = append(actions, Talk{
-					Action:  "talk",
-					Text:    event.Msg.Text(),
-					BargeIn: isWaitInput,
-				})
-			} else {
-				for _, a := range event.Msg.Attachments() {
-					actions = append(actions, Stream{
-						Action:    "stream",
-						StreamURL: []string{a.URL()},
-					})
-				}
-			}
-		}
-	}
-
-	for _, w := range waitActions {
-		actions = append(actions, w)
-	}
+	return waitActions, nil
+}
 
+// marshals the passed in actions as an NCCO body
+func marshalActions(actions []interface{}) (string, error) {
 	var body []byte
 	var err error
 	if indentMarshal {
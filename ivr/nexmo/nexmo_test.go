@@ -1,6 +1,7 @@
 package nexmo
 
 import (
+	"net/http/httptest"
 	"testing"
 
 	"github.com/nyaruka/gocommon/urns"
@@ -105,4 +106,10 @@ func TestResponseForSprint(t *testing.T) {
 		assert.NoError(t, err, "%d: unexpected error")
 		assert.Equal(t, tc.Expected, response, "%d: unexpected response", i)
 	}
+
+	// retries say their prompt and then wait again
+	w := httptest.NewRecorder()
+	err = client.WriteRetryResponse("Sorry, please try again.", resumeURL+"&retry=1", waits.NewActivatedMsgWait(nil, hints.NewFixedDigitsHint(1)), w)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"action":"talk","text":"Sorry, please try again.","bargeIn":true},{"action":"input","maxDigits":1,"submitOnHash":true,"timeOut":30,"eventUrl":["http://temba.io/resume?session=1\u0026retry=1\u0026wait_type=gather\u0026sig=hFW2tXYRJRgTKIdXP1cmGEUvGPY%3D"],"eventMethod":"POST"}]`, w.Body.String())
 }
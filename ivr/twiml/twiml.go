@@ -319,10 +319,25 @@ func (c *client) WriteSessionResponse(session *models.Session, resumeURL string,
 	return nil
 }
 
+// WriteRetryResponse writes a TWIML response which says the passed in prompt and then waits again for input
+func (c *client) WriteRetryResponse(prompt string, resumeURL string, wait flows.ActivatedWait, w http.ResponseWriter) error {
+	response, err := responseForCommands(resumeURL, wait, []interface{}{Say{Text: prompt}})
+	if err != nil {
+		return errors.Wrap(err, "unable to build retry response for IVR call")
+	}
+
+	_, err = w.Write([]byte(response))
+	if err != nil {
+		return errors.Wrap(err, "error writing IVR response")
+	}
+
+	return nil
+}
+
 // WriteErrorResponse writes an error / unavailable response
-func (c *client) WriteErrorResponse(w http.ResponseWriter, err error) error {
+func (c *client) WriteErrorResponse(w http.ResponseWriter, msg string, err error) error {
 	r := &Response{Message: strings.Replace(err.Error(), "--", "__", -1)}
-	r.Commands = append(r.Commands, Say{Text: ivr.ErrorMessage})
+	r.Commands = append(r.Commands, Say{Text: msg})
 	r.Commands = append(r.Commands, Hangup{})
 
 	body, err := xml.Marshal(r)
@@ -428,7 +443,6 @@ type Response struct {
 }
 
 func responseForSprint(resumeURL string, w flows.ActivatedWait, es []flows.Event) (string, error) {
-	r := &Response{}
 	commands := make([]interface{}, 0)
 
 	for _, e := range es {
@@ -445,6 +459,13 @@ func responseForSprint(resumeURL string, w flows.ActivatedWait, es []flows.Event
 		}
 	}
 
+	return responseForCommands(resumeURL, w, commands)
+}
+
+// builds a response which plays the passed in commands and then waits for input if there is a wait
+func responseForCommands(resumeURL string, w flows.ActivatedWait, commands []interface{}) (string, error) {
+	r := &Response{}
+
 	if w != nil {
 		msgWait, isMsgWait := w.(*waits.ActivatedMsgWait)
 		if !isMsgWait {
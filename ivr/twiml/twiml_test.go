@@ -80,4 +80,9 @@ func TestResponseForSprint(t *testing.T) {
 		assert.NoError(t, err, "%d: unexpected error")
 		assert.Equal(t, xml.Header+tc.Expected, response, "%d: unexpected response", i)
 	}
+
+	// retries say their prompt and then wait again
+	response, err := responseForCommands(resumeURL+"&retry=1", waits.NewActivatedMsgWait(nil, hints.NewFixedDigitsHint(1)), []interface{}{Say{Text: "Sorry, please try again."}})
+	assert.NoError(t, err)
+	assert.Equal(t, xml.Header+`<Response><Gather numDigits="1" timeout="30" action="http://temba.io/resume?session=1&amp;retry=1&amp;wait_type=gather"><Say>Sorry, please try again.</Say></Gather><Redirect>http://temba.io/resume?session=1&amp;retry=1&amp;wait_type=gather&amp;timeout=true</Redirect></Response>`, response)
 }
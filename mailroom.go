@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/nyaruka/mailroom/config"
 	"github.com/nyaruka/mailroom/queue"
 	"github.com/nyaruka/mailroom/s3utils"
+	"github.com/nyaruka/mailroom/schema"
 	"github.com/nyaruka/mailroom/web"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -61,8 +63,10 @@ type Mailroom struct {
 
 	batchForeman   *Foreman
 	handlerForeman *Foreman
+	memory         *memoryMonitor
 
 	webserver *web.Server
+	taskLog   *os.File
 }
 
 // NewMailroom creates and returns a new mailroom instance
@@ -73,8 +77,16 @@ func NewMailroom(config *config.Config) *Mailroom {
 		WaitGroup: &sync.WaitGroup{},
 	}
 	mr.CTX, mr.Cancel = context.WithCancel(context.Background())
-	mr.batchForeman = NewForeman(mr, queue.BatchQueue, config.BatchWorkers)
-	mr.handlerForeman = NewForeman(mr, queue.HandlerQueue, config.HandlerWorkers)
+
+	// canary instances only handle the tasks routed to them
+	batchQueue, handlerQueue := queue.BatchQueue, queue.HandlerQueue
+	if config.Canary {
+		batchQueue, handlerQueue = queue.CanaryQueue(batchQueue), queue.CanaryQueue(handlerQueue)
+	}
+
+	mr.batchForeman = NewForeman(mr, batchQueue, config.BatchWorkers)
+	mr.handlerForeman = NewForeman(mr, handlerQueue, config.HandlerWorkers)
+	mr.memory = newMemoryMonitor(config.WorkerMemoryLimit)
 
 	return mr
 }
@@ -115,6 +127,14 @@ func (mr *Mailroom) Start() error {
 		log.Error("db not reachable")
 	} else {
 		log.Info("db ok")
+
+		// create the tables we own if this is a new database or a new version of mailroom
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err = schema.Migrate(ctx, mr.DB)
+		cancel()
+		if err != nil {
+			return err
+		}
 	}
 
 	// parse and test our redis config
@@ -195,6 +215,26 @@ func (mr *Mailroom) Start() error {
 		log.Info("elastic ok")
 	}
 
+	// if we have a task log, open it for appending
+	if mr.Config.TaskLog != "" {
+		mr.taskLog, err = os.OpenFile(mr.Config.TaskLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to open task log '%s': %s", mr.Config.TaskLog, err)
+		}
+		queue.SetTaskLog(mr.taskLog)
+		log.Info("task log ok")
+	}
+
+	// if we route some tasks to canary instances, parse which
+	routing, err := canaryRouting(mr.Config)
+	if err != nil {
+		return err
+	}
+	queue.SetCanaryRouting(routing)
+	if routing != nil {
+		log.WithField("percent", routing.Percent).WithField("orgs", len(routing.OrgIDs)).WithField("task_types", len(routing.TaskTypes)).Info("canary routing ok")
+	}
+
 	for _, initFunc := range initFunctions {
 		initFunc(mr)
 	}
@@ -206,6 +246,9 @@ func (mr *Mailroom) Start() error {
 		librato.Start()
 	}
 
+	// start watching our memory usage before our workers start using it
+	mr.memory.Start(mr)
+
 	// init our foremen and start it
 	mr.batchForeman.Start()
 	mr.handlerForeman.Start()
@@ -233,6 +276,51 @@ func (mr *Mailroom) Stop() error {
 
 	mr.WaitGroup.Wait()
 	mr.ElasticClient.Stop()
+
+	if mr.taskLog != nil {
+		queue.SetTaskLog(nil)
+		mr.taskLog.Close()
+	}
+	queue.SetCanaryRouting(nil)
+
 	logrus.Info("mailroom stopped")
 	return nil
 }
+
+// canaryRouting returns the routing of tasks to canary instances described by the passed in config, nil if no tasks
+// are routed
+func canaryRouting(cfg *config.Config) (*queue.CanaryRouting, error) {
+	if cfg.CanaryPercent < 0 || cfg.CanaryPercent > 100 {
+		return nil, fmt.Errorf("invalid canary percent: %d, must be between 0 and 100", cfg.CanaryPercent)
+	}
+
+	routing := &queue.CanaryRouting{
+		Percent:   cfg.CanaryPercent,
+		OrgIDs:    make(map[int]bool),
+		TaskTypes: make(map[string]bool),
+	}
+
+	for _, o := range strings.Split(cfg.CanaryOrgs, ",") {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		orgID, err := strconv.Atoi(o)
+		if err != nil {
+			return nil, fmt.Errorf("invalid canary org id: '%s'", o)
+		}
+		routing.OrgIDs[orgID] = true
+	}
+
+	for _, t := range strings.Split(cfg.CanaryTaskTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			routing.TaskTypes[t] = true
+		}
+	}
+
+	if routing.Percent == 0 && len(routing.OrgIDs) == 0 {
+		return nil, nil
+	}
+	return routing, nil
+}
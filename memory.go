@@ -0,0 +1,97 @@
+package mailroom
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/nyaruka/librato"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// how often we check our memory usage against our limit
+	memoryCheckInterval = time.Second * 5
+
+	// how often we report our memory usage
+	memoryReportInterval = time.Minute
+)
+
+// memoryMonitor keeps track of how much memory this instance is using so that workers can stop taking new batch tasks
+// when it's above our limit, rather than being killed for running out of memory
+type memoryMonitor struct {
+	limitBytes uint64
+	high       int32
+}
+
+func newMemoryMonitor(limitMB int) *memoryMonitor {
+	return &memoryMonitor{limitBytes: uint64(limitMB) * 1024 * 1024}
+}
+
+// IsHigh returns whether our heap was above our limit when last checked
+func (m *memoryMonitor) IsHigh() bool {
+	return atomic.LoadInt32(&m.high) == 1
+}
+
+// Start starts checking and reporting our memory usage until the passed in channel is closed
+func (m *memoryMonitor) Start(mr *Mailroom) {
+	mr.WaitGroup.Add(1)
+
+	go func() {
+		defer mr.WaitGroup.Done()
+
+		checkTicker := time.NewTicker(memoryCheckInterval)
+		defer checkTicker.Stop()
+		reportTicker := time.NewTicker(memoryReportInterval)
+		defer reportTicker.Stop()
+
+		stats := &runtime.MemStats{}
+
+		for {
+			select {
+			case <-mr.Quit:
+				return
+			case <-checkTicker.C:
+				runtime.ReadMemStats(stats)
+				m.check(stats)
+			case <-reportTicker.C:
+				runtime.ReadMemStats(stats)
+				m.report(stats)
+			}
+		}
+	}()
+}
+
+// updates whether we're above our limit, logging when that changes
+func (m *memoryMonitor) check(stats *runtime.MemStats) {
+	if m.limitBytes == 0 {
+		return
+	}
+
+	log := logrus.WithField("comp", "memory_monitor").WithField("heap_alloc_mb", stats.HeapAlloc/(1024*1024)).WithField("limit_mb", m.limitBytes/(1024*1024))
+
+	if stats.HeapAlloc > m.limitBytes {
+		if atomic.CompareAndSwapInt32(&m.high, 0, 1) {
+			log.Warn("memory above limit, pausing batch tasks")
+		}
+	} else if atomic.CompareAndSwapInt32(&m.high, 1, 0) {
+		log.Info("memory back below limit, resuming batch tasks")
+	}
+}
+
+// logs our memory usage and sends it to librato
+func (m *memoryMonitor) report(stats *runtime.MemStats) {
+	goroutines := runtime.NumGoroutine()
+
+	logrus.WithFields(logrus.Fields{
+		"heap_alloc_mb": stats.HeapAlloc / (1024 * 1024),
+		"heap_sys_mb":   stats.HeapSys / (1024 * 1024),
+		"sys_mb":        stats.Sys / (1024 * 1024),
+		"num_gc":        stats.NumGC,
+		"goroutines":    goroutines,
+	}).Info("memory usage")
+
+	librato.Gauge("mr.mem_heap_alloc_mb", float64(stats.HeapAlloc/(1024*1024)))
+	librato.Gauge("mr.mem_sys_mb", float64(stats.Sys/(1024*1024)))
+	librato.Gauge("mr.goroutines", float64(goroutines))
+}
@@ -0,0 +1,383 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/config"
+	cache "github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	RegisterAssetSource("http", newHTTPAssetSource)
+	RegisterAssetSource("static", newStaticAssetSource)
+}
+
+// AssetBundle is all the assets of an org in a single JSON document, where each asset is in the same format as it's
+// read from the database, and locations are hierarchies in the goflow format, e.g.
+//
+//   {
+//     "org": {"id": 1, "name": "Nyaruka", "brand": "rapidpro", "config": {}, "environment": {"date_format": "DD-MM-YYYY", ...}},
+//     "channels": [{"id": 10, "uuid": "74729f45-7f29-4868-9dc4-90e491e3c7d8", "name": "Twilio", "channel_type": "T", ...}],
+//     "fields": [{"id": 6, "uuid": "d66a7823-eada-40e5-9a3a-57239d4690bf", "key": "age", "name": "Age", "field_type": "number"}],
+//     "flows": [{"id": 1, "uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "name": "Favorites", "flow_type": "M", "is_active": true, "definition": {...}}],
+//     ...
+//   }
+//
+type AssetBundle struct {
+	Org         *bundleOrg        `json:"org" validate:"required"`
+	Channels    []json.RawMessage `json:"channels"`
+	Classifiers []json.RawMessage `json:"classifiers"`
+	Fields      []json.RawMessage `json:"fields"`
+	Groups      []json.RawMessage `json:"groups"`
+	Labels      []json.RawMessage `json:"labels"`
+	Resthooks   []json.RawMessage `json:"resthooks"`
+	Campaigns   []json.RawMessage `json:"campaigns"`
+	Triggers    []json.RawMessage `json:"triggers"`
+	Templates   []json.RawMessage `json:"templates"`
+	Globals     []json.RawMessage `json:"globals"`
+	Locations   []json.RawMessage `json:"locations"`
+	Flows       []json.RawMessage `json:"flows"`
+}
+
+type bundleOrg struct {
+	ID          OrgID           `json:"id"          validate:"required"`
+	Name        string          `json:"name"`
+	Brand       string          `json:"brand"`
+	Config      json.RawMessage `json:"config"`
+	Environment json.RawMessage `json:"environment" validate:"required"`
+}
+
+// parsed bundles are cached for as long as org assets so that loading all the assets of an org fetches its bundle once
+var bundleCache = cache.New(cacheTimeout, time.Minute*5)
+
+// bundleAssetSource loads assets from the bundle of each org, which is fetched by the passed in func
+type bundleAssetSource struct {
+	name  string
+	fetch func(ctx context.Context, orgID OrgID) ([]byte, error)
+}
+
+// newStaticAssetSource creates a source which reads bundles from a directory of JSON files named by org id, e.g.
+// 1.json, which lets flows be simulated and tested without a database of assets
+func newStaticAssetSource(cfg *config.Config, db *sqlx.DB) (AssetSource, error) {
+	if cfg.AssetBundlesDir == "" {
+		return nil, errors.Errorf("asset bundles dir must be set to use the static asset source")
+	}
+
+	dir := cfg.AssetBundlesDir
+	fetch := func(ctx context.Context, orgID OrgID) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.json", orgID)))
+	}
+	return &bundleAssetSource{name: dir, fetch: fetch}, nil
+}
+
+var assetServerHTTPClient = &http.Client{Timeout: time.Duration(15 * time.Second)}
+
+// newHTTPAssetSource creates a source which fetches bundles from an asset server with a GET to the server URL followed
+// by the org id, e.g. https://assets.example.com/orgs/1
+func newHTTPAssetSource(cfg *config.Config, db *sqlx.DB) (AssetSource, error) {
+	if cfg.AssetServerURL == "" {
+		return nil, errors.Errorf("asset server URL must be set to use the http asset source")
+	}
+
+	baseURL, token := strings.TrimSuffix(cfg.AssetServerURL, "/"), cfg.AssetServerToken
+	fetch := func(ctx context.Context, orgID OrgID) ([]byte, error) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%d", baseURL, orgID), nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating asset server request")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
+		}
+
+		resp, err := assetServerHTTPClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error fetching assets from asset server")
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading asset server response")
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("asset server returned status %d", resp.StatusCode)
+		}
+		return body, nil
+	}
+	return &bundleAssetSource{name: baseURL, fetch: fetch}, nil
+}
+
+// returns the bundle for the passed in org, fetching it if it isn't cached
+func (s *bundleAssetSource) bundle(ctx context.Context, orgID OrgID) (*AssetBundle, error) {
+	key := fmt.Sprintf("%s|%d", s.name, orgID)
+	cached, found := bundleCache.Get(key)
+	if found {
+		return cached.(*AssetBundle), nil
+	}
+
+	data, err := s.fetch(ctx, orgID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching asset bundle for org %d", orgID)
+	}
+
+	bundle := &AssetBundle{}
+	if err := readJSON(data, bundle); err != nil {
+		return nil, errors.Wrapf(err, "error reading asset bundle for org %d", orgID)
+	}
+	if bundle.Org.ID != orgID {
+		return nil, errors.Errorf("asset bundle for org %d is for org %d", orgID, bundle.Org.ID)
+	}
+
+	bundleCache.Set(key, bundle, cache.DefaultExpiration)
+	return bundle, nil
+}
+
+func (s *bundleAssetSource) LoadOrg(ctx context.Context, orgID OrgID) (*Org, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	org := &Org{id: b.Org.ID, name: b.Org.Name, brand: b.Org.Brand}
+	if err := readOrgEnvironment(org, b.Org.Environment, b.Org.Config); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (s *bundleAssetSource) LoadChannels(ctx context.Context, orgID OrgID) ([]assets.Channel, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]assets.Channel, len(b.Channels))
+	for i, data := range b.Channels {
+		channel := &Channel{}
+		if err := readJSON(data, &channel.c); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling channel")
+		}
+		channels[i] = channel
+	}
+	return channels, nil
+}
+
+func (s *bundleAssetSource) LoadClassifiers(ctx context.Context, orgID OrgID) ([]assets.Classifier, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	classifiers := make([]assets.Classifier, len(b.Classifiers))
+	for i, data := range b.Classifiers {
+		classifier := &Classifier{}
+		if err := readJSON(data, &classifier.c); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling classifier")
+		}
+
+		// populate our intent names
+		classifier.c.intentNames = make([]string, len(classifier.c.Intents))
+		for j, intent := range classifier.c.Intents {
+			classifier.c.intentNames[j] = intent.Name
+		}
+
+		classifiers[i] = classifier
+	}
+	return classifiers, nil
+}
+
+func (s *bundleAssetSource) LoadFields(ctx context.Context, orgID OrgID) ([]assets.Field, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]assets.Field, len(b.Fields))
+	for i, data := range b.Fields {
+		field := &Field{}
+		if err := readJSON(data, &field.f); err != nil {
+			return nil, errors.Wrap(err, "error reading field")
+		}
+		fields[i] = field
+	}
+	return fields, nil
+}
+
+func (s *bundleAssetSource) LoadGroups(ctx context.Context, orgID OrgID) ([]assets.Group, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]assets.Group, len(b.Groups))
+	for i, data := range b.Groups {
+		group := &Group{}
+		if err := readJSON(data, &group.g); err != nil {
+			return nil, errors.Wrap(err, "error reading group")
+		}
+		groups[i] = group
+	}
+	return groups, nil
+}
+
+func (s *bundleAssetSource) LoadLabels(ctx context.Context, orgID OrgID) ([]assets.Label, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]assets.Label, len(b.Labels))
+	for i, data := range b.Labels {
+		label := &Label{}
+		if err := readJSON(data, &label.l); err != nil {
+			return nil, errors.Wrap(err, "error reading label")
+		}
+		labels[i] = label
+	}
+	return labels, nil
+}
+
+func (s *bundleAssetSource) LoadResthooks(ctx context.Context, orgID OrgID) ([]assets.Resthook, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	resthooks := make([]assets.Resthook, len(b.Resthooks))
+	for i, data := range b.Resthooks {
+		resthook := &Resthook{}
+		if err := readJSON(data, &resthook.r); err != nil {
+			return nil, errors.Wrap(err, "error reading resthook")
+		}
+		resthooks[i] = resthook
+	}
+	return resthooks, nil
+}
+
+func (s *bundleAssetSource) LoadCampaigns(ctx context.Context, orgID OrgID) ([]*Campaign, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	campaigns := make([]*Campaign, len(b.Campaigns))
+	for i, data := range b.Campaigns {
+		campaign := &Campaign{}
+		if err := readJSON(data, &campaign.c); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling campaign")
+		}
+
+		// populate the campaign pointer for each event
+		for _, e := range campaign.Events() {
+			e.campaign = campaign
+		}
+
+		campaigns[i] = campaign
+	}
+	return campaigns, nil
+}
+
+func (s *bundleAssetSource) LoadTriggers(ctx context.Context, orgID OrgID) ([]*Trigger, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	triggers := make([]*Trigger, len(b.Triggers))
+	for i, data := range b.Triggers {
+		trigger := &Trigger{}
+		if err := readJSON(data, &trigger.t); err != nil {
+			return nil, errors.Wrap(err, "error reading trigger")
+		}
+		triggers[i] = trigger
+	}
+	return triggers, nil
+}
+
+func (s *bundleAssetSource) LoadTemplates(ctx context.Context, orgID OrgID) ([]assets.Template, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]assets.Template, len(b.Templates))
+	for i, data := range b.Templates {
+		template := &Template{}
+		if err := readJSON(data, &template.t); err != nil {
+			return nil, errors.Wrap(err, "error reading template")
+		}
+		templates[i] = template
+	}
+	return templates, nil
+}
+
+func (s *bundleAssetSource) LoadGlobals(ctx context.Context, orgID OrgID) ([]assets.Global, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	globals := make([]assets.Global, len(b.Globals))
+	for i, data := range b.Globals {
+		global := &Global{}
+		if err := readJSON(data, &global.g); err != nil {
+			return nil, errors.Wrap(err, "error reading global")
+		}
+		globals[i] = global
+	}
+	return globals, nil
+}
+
+func (s *bundleAssetSource) LoadLocations(ctx context.Context, orgID OrgID) ([]assets.LocationHierarchy, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	hierarchies := make([]assets.LocationHierarchy, len(b.Locations))
+	for i, data := range b.Locations {
+		hierarchies[i], err = utils.ReadLocationHierarchy(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling hierarchy: %s", string(data))
+		}
+	}
+	return hierarchies, nil
+}
+
+func (s *bundleAssetSource) LoadFlowByUUID(ctx context.Context, orgID OrgID, flowUUID assets.FlowUUID) (*Flow, error) {
+	return s.loadFlow(ctx, orgID, func(f *Flow) bool { return f.UUID() == flowUUID })
+}
+
+func (s *bundleAssetSource) LoadFlowByID(ctx context.Context, orgID OrgID, flowID FlowID) (*Flow, error) {
+	return s.loadFlow(ctx, orgID, func(f *Flow) bool { return f.ID() == flowID })
+}
+
+// loads the first flow in the bundle which matches, or nil if there isn't one
+func (s *bundleAssetSource) loadFlow(ctx context.Context, orgID OrgID, matches func(*Flow) bool) (*Flow, error) {
+	b, err := s.bundle(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, data := range b.Flows {
+		flow := &Flow{}
+		if err := readJSON(data, &flow.f); err != nil {
+			return nil, errors.Wrapf(err, "error reading flow definition")
+		}
+		if matches(flow) {
+			return flow, nil
+		}
+	}
+	return nil, nil
+}
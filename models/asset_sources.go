@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	RegisterAssetSource("db", newDBAssetSource)
+}
+
+// AssetSource is where the assets of orgs are loaded from. Flows are loaded individually as they're needed and
+// should be nil if they don't exist.
+type AssetSource interface {
+	LoadOrg(ctx context.Context, orgID OrgID) (*Org, error)
+	LoadChannels(ctx context.Context, orgID OrgID) ([]assets.Channel, error)
+	LoadClassifiers(ctx context.Context, orgID OrgID) ([]assets.Classifier, error)
+	LoadFields(ctx context.Context, orgID OrgID) ([]assets.Field, error)
+	LoadGroups(ctx context.Context, orgID OrgID) ([]assets.Group, error)
+	LoadLabels(ctx context.Context, orgID OrgID) ([]assets.Label, error)
+	LoadResthooks(ctx context.Context, orgID OrgID) ([]assets.Resthook, error)
+	LoadCampaigns(ctx context.Context, orgID OrgID) ([]*Campaign, error)
+	LoadTriggers(ctx context.Context, orgID OrgID) ([]*Trigger, error)
+	LoadTemplates(ctx context.Context, orgID OrgID) ([]assets.Template, error)
+	LoadGlobals(ctx context.Context, orgID OrgID) ([]assets.Global, error)
+	LoadLocations(ctx context.Context, orgID OrgID) ([]assets.LocationHierarchy, error)
+	LoadFlowByUUID(ctx context.Context, orgID OrgID, flowUUID assets.FlowUUID) (*Flow, error)
+	LoadFlowByID(ctx context.Context, orgID OrgID, flowID FlowID) (*Flow, error)
+}
+
+// AssetSourceFactory creates an asset source from our configuration
+type AssetSourceFactory func(cfg *config.Config, db *sqlx.DB) (AssetSource, error)
+
+var assetSourceFactories = make(map[string]AssetSourceFactory)
+
+// RegisterAssetSource registers a new kind of asset source which can be selected by setting the asset source config
+// to its name
+func RegisterAssetSource(name string, factory AssetSourceFactory) {
+	assetSourceFactories[name] = factory
+}
+
+// returns the asset source selected in our config
+func configuredAssetSource(db *sqlx.DB) (AssetSource, error) {
+	factory := assetSourceFactories[config.Mailroom.AssetSource]
+	if factory == nil {
+		return nil, errors.Errorf("unknown asset source: %s", config.Mailroom.AssetSource)
+	}
+	return factory(config.Mailroom, db)
+}
+
+// dbAssetSource loads assets from our database, which is the default
+type dbAssetSource struct {
+	db *sqlx.DB
+}
+
+func newDBAssetSource(cfg *config.Config, db *sqlx.DB) (AssetSource, error) {
+	if db == nil {
+		return nil, errors.Errorf("nil db, cannot load org")
+	}
+	return &dbAssetSource{db: db}, nil
+}
+
+func (s *dbAssetSource) LoadOrg(ctx context.Context, orgID OrgID) (*Org, error) {
+	return loadOrg(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadChannels(ctx context.Context, orgID OrgID) ([]assets.Channel, error) {
+	return loadChannels(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadClassifiers(ctx context.Context, orgID OrgID) ([]assets.Classifier, error) {
+	return loadClassifiers(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadFields(ctx context.Context, orgID OrgID) ([]assets.Field, error) {
+	return loadFields(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadGroups(ctx context.Context, orgID OrgID) ([]assets.Group, error) {
+	return loadGroups(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadLabels(ctx context.Context, orgID OrgID) ([]assets.Label, error) {
+	return loadLabels(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadResthooks(ctx context.Context, orgID OrgID) ([]assets.Resthook, error) {
+	return loadResthooks(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadCampaigns(ctx context.Context, orgID OrgID) ([]*Campaign, error) {
+	return loadCampaigns(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadTriggers(ctx context.Context, orgID OrgID) ([]*Trigger, error) {
+	return loadTriggers(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadTemplates(ctx context.Context, orgID OrgID) ([]assets.Template, error) {
+	return loadTemplates(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadGlobals(ctx context.Context, orgID OrgID) ([]assets.Global, error) {
+	return loadGlobals(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadLocations(ctx context.Context, orgID OrgID) ([]assets.LocationHierarchy, error) {
+	return loadLocations(ctx, s.db, orgID)
+}
+
+func (s *dbAssetSource) LoadFlowByUUID(ctx context.Context, orgID OrgID, flowUUID assets.FlowUUID) (*Flow, error) {
+	return loadFlowByUUID(ctx, s.db, orgID, flowUUID)
+}
+
+func (s *dbAssetSource) LoadFlowByID(ctx context.Context, orgID OrgID, flowID FlowID) (*Flow, error) {
+	return loadFlowByID(ctx, s.db, orgID, flowID)
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAssetBundle = `{
+	"org": {
+		"id": 100,
+		"name": "Lite",
+		"brand": "rapidpro",
+		"config": {},
+		"environment": {"date_format": "DD-MM-YYYY", "time_format": "tt:mm", "timezone": "Africa/Kigali", "default_language": "eng", "allowed_languages": ["eng"], "redaction_policy": "none"}
+	},
+	"channels": [
+		{"id": 1000, "uuid": "2cc8f4ab-5e6e-4d3b-a4a2-6f9a7f1ad1a0", "name": "Test Channel", "address": "+250785551212", "channel_type": "T", "tps": 10, "schemes": ["tel"], "roles": ["send", "receive"], "config": {}}
+	],
+	"fields": [
+		{"id": 1000, "uuid": "1f9b1a1c-3fbf-4d1b-8a4e-0b1b2a36e5b0", "key": "age", "name": "Age", "field_type": "number"}
+	],
+	"groups": [
+		{"id": 1000, "uuid": "4c4a1e5d-3c1f-4b8f-9c9b-6a3b7d2e0f11", "name": "Testers", "query": ""}
+	],
+	"flows": [
+		{
+			"id": 1000,
+			"uuid": "8f1c1a2b-0f6e-4c2d-9b3a-7e5d4c3b2a10",
+			"name": "Lite Flow",
+			"config": {},
+			"version": "13.0.0",
+			"flow_type": "M",
+			"is_active": true,
+			"definition": {"uuid": "8f1c1a2b-0f6e-4c2d-9b3a-7e5d4c3b2a10", "name": "Lite Flow", "spec_version": "13.0.0", "language": "eng", "type": "messaging", "nodes": []}
+		}
+	]
+}`
+
+func TestStaticAssetSource(t *testing.T) {
+	ctx := testsuite.CTX()
+
+	dir, err := ioutil.TempDir("", "bundles")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "100.json"), []byte(testAssetBundle), 0644)
+	require.NoError(t, err)
+
+	config.Mailroom.AssetSource = "static"
+	config.Mailroom.AssetBundlesDir = dir
+	defer func() {
+		config.Mailroom.AssetSource = "db"
+		config.Mailroom.AssetBundlesDir = ""
+		FlushCache()
+	}()
+
+	// static bundles don't need a db
+	org, err := NewOrgAssets(ctx, nil, OrgID(100), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Lite", org.Org().Name())
+	assert.Equal(t, "Africa/Kigali", org.Env().Timezone().String())
+
+	channels, _ := org.Channels()
+	assert.Equal(t, 1, len(channels))
+	assert.Equal(t, "Test Channel", org.ChannelByID(ChannelID(1000)).Name())
+	assert.Equal(t, "Age", org.FieldByKey("age").Name())
+	assert.Equal(t, "Testers", org.GroupByID(GroupID(1000)).Name())
+
+	flow, err := org.Flow(assets.FlowUUID("8f1c1a2b-0f6e-4c2d-9b3a-7e5d4c3b2a10"))
+	require.NoError(t, err)
+	assert.Equal(t, "Lite Flow", flow.Name())
+
+	flowByID, err := org.FlowByID(FlowID(1000))
+	require.NoError(t, err)
+	assert.Equal(t, flow.UUID(), flowByID.UUID())
+
+	_, err = org.FlowByID(FlowID(1001))
+	assert.Equal(t, ErrNotFound, err)
+
+	// no bundle for this org
+	_, err = NewOrgAssets(ctx, nil, OrgID(101), nil)
+	assert.Error(t, err)
+
+	// static source needs a directory
+	config.Mailroom.AssetBundlesDir = ""
+	_, err = NewOrgAssets(ctx, nil, OrgID(100), nil)
+	assert.EqualError(t, err, "asset bundles dir must be set to use the static asset source")
+}
+
+func TestHTTPAssetSource(t *testing.T) {
+	ctx := testsuite.CTX()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token sesame" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/orgs/100" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(testAssetBundle))
+	}))
+	defer server.Close()
+
+	config.Mailroom.AssetSource = "http"
+	config.Mailroom.AssetServerURL = server.URL + "/orgs/"
+	config.Mailroom.AssetServerToken = "sesame"
+	defer func() {
+		config.Mailroom.AssetSource = "db"
+		config.Mailroom.AssetServerURL = ""
+		config.Mailroom.AssetServerToken = ""
+		FlushCache()
+	}()
+
+	org, err := NewOrgAssets(ctx, nil, OrgID(100), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Lite", org.Org().Name())
+	assert.Equal(t, "Age", org.FieldByKey("age").Name())
+
+	_, err = NewOrgAssets(ctx, nil, OrgID(101), nil)
+	assert.EqualError(t, err, "error loading environment for org 101: error fetching asset bundle for org 101: asset server returned status 404")
+
+	// unknown sources are an error
+	config.Mailroom.AssetSource = "carrier_pigeon"
+	_, err = NewOrgAssets(ctx, nil, OrgID(100), nil)
+	assert.EqualError(t, err, "unknown asset source: carrier_pigeon")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -22,13 +23,15 @@ import (
 // SessionAssets for the engine but also used to cache campaigns and other org level attributes
 type OrgAssets struct {
 	ctx     context.Context
-	db      *sqlx.DB
+	source  AssetSource
 	builtAt time.Time
 
 	orgID OrgID
 
 	env *Org
 
+	autoResponses []*AutoResponse
+
 	flowByUUID map[assets.FlowUUID]assets.Flow
 
 	flowByID      map[FlowID]assets.Flow
@@ -77,15 +80,62 @@ const locationCacheTimeout = time.Hour
 func FlushCache() {
 	orgCache.Flush()
 	assetCache.Flush()
+	bundleCache.Flush()
+}
+
+// CachedOrg is the state of the cached assets of an org
+type CachedOrg struct {
+	OrgID            OrgID
+	BuiltAt          time.Time
+	LocationsBuiltAt time.Time
+	FlowsLoaded      int
+}
+
+// CachedOrgs returns the state of each org whose assets are cached by this process, ordered by org id
+func CachedOrgs() []*CachedOrg {
+	items := orgCache.Items()
+	orgs := make([]*CachedOrg, 0, len(items))
+
+	for _, item := range items {
+		o := item.Object.(*OrgAssets)
+
+		o.flowCacheLock.RLock()
+		flowsLoaded := len(o.flowByUUID)
+		o.flowCacheLock.RUnlock()
+
+		orgs = append(orgs, &CachedOrg{
+			OrgID:            o.orgID,
+			BuiltAt:          o.builtAt,
+			LocationsBuiltAt: o.locationsBuiltAt,
+			FlowsLoaded:      flowsLoaded,
+		})
+	}
+
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].OrgID < orgs[j].OrgID })
+	return orgs
+}
+
+// FlushOrgCache removes the cached assets of the passed in org from this process so that they're rebuilt from scratch,
+// including locations, when next used
+func FlushOrgCache(orgID OrgID) {
+	key := fmt.Sprintf("%d", orgID)
+	orgCache.Delete(key)
+	assetCache.Delete(key)
 }
 
 // NewOrgAssets creates and returns a new org assets objects, potentially using the previous
-// org assets passed in to prevent refetching locations
+// org assets passed in to prevent refetching locations. Assets are loaded from the asset source
+// selected in our config, which by default is the passed in db.
 func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets) (*OrgAssets, error) {
+	source, err := configuredAssetSource(db)
+	if err != nil {
+		return nil, err
+	}
+
 	// build our new assets
 	o := &OrgAssets{
 		ctx:     ctx,
-		db:      db,
+		source:  source,
 		builtAt: time.Now(),
 
 		orgID: orgID,
@@ -112,14 +162,13 @@ func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets
 	}
 
 	// we load everything at once except for flows which are lazily loaded
-	var err error
-
-	o.env, err = loadOrg(ctx, db, orgID)
+	o.env, err = source.LoadOrg(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading environment for org %d", orgID)
 	}
+	o.autoResponses = orgAutoResponses(o.env)
 
-	o.channels, err = loadChannels(ctx, db, orgID)
+	o.channels, err = source.LoadChannels(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading channel assets for org %d", orgID)
 	}
@@ -129,7 +178,7 @@ func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets
 		o.channelsByUUID[channel.UUID()] = channel
 	}
 
-	o.classifiers, err = loadClassifiers(ctx, db, orgID)
+	o.classifiers, err = source.LoadClassifiers(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading classifier assets for org %d", orgID)
 	}
@@ -137,7 +186,7 @@ func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets
 		o.classifiersByUUID[c.UUID()] = c.(*Classifier)
 	}
 
-	o.fields, err = loadFields(ctx, db, orgID)
+	o.fields, err = source.LoadFields(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading field assets for org %d", orgID)
 	}
@@ -147,7 +196,7 @@ func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets
 		o.fieldsByKey[field.Key()] = field
 	}
 
-	o.groups, err = loadGroups(ctx, db, orgID)
+	o.groups, err = source.LoadGroups(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading group assets for org %d", orgID)
 	}
@@ -157,7 +206,7 @@ func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets
 		o.groupsByUUID[group.UUID()] = group
 	}
 
-	o.labels, err = loadLabels(ctx, db, orgID)
+	o.labels, err = source.LoadLabels(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading group labels for org %d", orgID)
 	}
@@ -165,12 +214,12 @@ func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets
 		o.labelsByUUID[l.UUID()] = l.(*Label)
 	}
 
-	o.resthooks, err = loadResthooks(ctx, db, orgID)
+	o.resthooks, err = source.LoadResthooks(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading resthooks for org %d", orgID)
 	}
 
-	o.campaigns, err = loadCampaigns(ctx, db, orgID)
+	o.campaigns, err = source.LoadCampaigns(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading campaigns for org %d", orgID)
 	}
@@ -182,27 +231,28 @@ func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets
 		}
 	}
 
-	o.triggers, err = loadTriggers(ctx, db, orgID)
+	o.triggers, err = source.LoadTriggers(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading triggers for org %d", orgID)
 	}
 
-	o.templates, err = loadTemplates(ctx, db, orgID)
+	o.templates, err = source.LoadTemplates(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading templates for org %d", orgID)
 	}
 
-	o.globals, err = loadGlobals(ctx, db, orgID)
+	o.globals, err = source.LoadGlobals(ctx, orgID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading globals for org %d", orgID)
 	}
+	o.globals = orgGlobals(o.env, o.globals)
 
 	// cache locations for an hour
 	if prev != nil && time.Since(prev.locationsBuiltAt) < locationCacheTimeout {
 		o.locations = prev.locations
 		o.locationsBuiltAt = prev.locationsBuiltAt
 	} else {
-		o.locations, err = loadLocations(ctx, db, orgID)
+		o.locations, err = source.LoadLocations(ctx, orgID)
 		o.locationsBuiltAt = time.Now()
 		if err != nil {
 			return nil, errors.Wrapf(err, "error loading group locations for org %d", orgID)
@@ -214,10 +264,6 @@ func NewOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID, prev *OrgAssets
 
 // GetOrgAssets creates or gets org assets for the passed in org
 func GetOrgAssets(ctx context.Context, db *sqlx.DB, orgID OrgID) (*OrgAssets, error) {
-	if db == nil {
-		return nil, errors.Errorf("nil db, cannot load org")
-	}
-
 	// do we have a recent cache?
 	key := fmt.Sprintf("%d", orgID)
 	var cached *OrgAssets
@@ -249,6 +295,29 @@ func NewSessionAssets(org *OrgAssets) (flows.SessionAssets, error) {
 	return engine.NewSessionAssets(org, goflow.MigrationConfig())
 }
 
+// ResumeSessionAssets returns the session assets to resume a session in the passed in flow with. That's the org's
+// usual session assets unless the flow has been soft deleted and its sessions are being left to finish, in which case
+// we create session assets which can load that flow, but only that flow, for the resumed session.
+func ResumeSessionAssets(org *OrgAssets, flow *Flow) (flows.SessionAssets, error) {
+	if flow.IsActive() {
+		return GetSessionAssets(org)
+	}
+	return engine.NewSessionAssets(&finishingFlowSource{OrgAssets: org, flow: flow}, goflow.MigrationConfig())
+}
+
+// asset source for sessions being left to finish in a soft deleted flow
+type finishingFlowSource struct {
+	*OrgAssets
+	flow *Flow
+}
+
+func (s *finishingFlowSource) Flow(flowUUID assets.FlowUUID) (assets.Flow, error) {
+	if flowUUID == s.flow.UUID() {
+		return s.flow, nil
+	}
+	return s.OrgAssets.Flow(flowUUID)
+}
+
 // GetSessionAssets returns a goflow session assets object for the passed in org assets
 func GetSessionAssets(org *OrgAssets) (flows.SessionAssets, error) {
 	key := fmt.Sprintf("%d", org.OrgID())
@@ -310,16 +379,70 @@ func (a *OrgAssets) FieldByKey(key string) *Field {
 	return a.fieldsByKey[key]
 }
 
+// AddTestField adds a draft field to our org, replacing any existing field with the same key, this is only used in
+// session assets during simulation
+func (a *OrgAssets) AddTestField(field assets.Field) {
+	f := &Field{}
+	f.f.UUID = field.UUID()
+	f.f.Key = field.Key()
+	f.f.Name = field.Name()
+	f.f.FieldType = field.Type()
+
+	// drafts of existing fields keep the existing identity so that contact values are still found
+	existing := a.fieldsByKey[f.Key()]
+	if existing != nil {
+		f.f.ID = existing.ID()
+		f.f.UUID = existing.UUID()
+
+		for i := range a.fields {
+			if a.fields[i] == existing {
+				a.fields[i] = f
+			}
+		}
+	} else {
+		a.fields = append(a.fields, f)
+	}
+
+	a.fieldsByUUID[f.UUID()] = f
+	a.fieldsByKey[f.Key()] = f
+}
+
+// Flow returns the active flow with the passed in UUID, or ErrNotFound if it doesn't exist or has been soft deleted.
+// As this is what the engine loads flows with, soft deleted flows can't be entered by sessions.
 func (a *OrgAssets) Flow(flowUUID assets.FlowUUID) (assets.Flow, error) {
+	flow, err := a.cachedFlowByUUID(flowUUID)
+	if err != nil {
+		return nil, err
+	}
+	if !flow.IsActive() {
+		return nil, ErrNotFound
+	}
+	return flow, nil
+}
+
+// SessionFlowByUUID returns the flow with the passed in UUID for sessions already in it, which includes soft deleted
+// flows whose sessions are being left to finish
+func (a *OrgAssets) SessionFlowByUUID(flowUUID assets.FlowUUID) (*Flow, error) {
+	flow, err := a.cachedFlowByUUID(flowUUID)
+	if err != nil {
+		return nil, err
+	}
+	if !flow.IsActive() && !flow.finishesSessions() {
+		return nil, ErrNotFound
+	}
+	return flow, nil
+}
+
+func (a *OrgAssets) cachedFlowByUUID(flowUUID assets.FlowUUID) (*Flow, error) {
 	a.flowCacheLock.RLock()
 	flow, found := a.flowByUUID[flowUUID]
 	a.flowCacheLock.RUnlock()
 
 	if found {
-		return flow, nil
+		return flow.(*Flow), nil
 	}
 
-	dbFlow, err := loadFlowByUUID(a.ctx, a.db, a.orgID, flowUUID)
+	dbFlow, err := a.source.LoadFlowByUUID(a.ctx, a.orgID, flowUUID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading flow: %s", flowUUID)
 	}
@@ -336,7 +459,32 @@ func (a *OrgAssets) Flow(flowUUID assets.FlowUUID) (assets.Flow, error) {
 	return dbFlow, nil
 }
 
+// FlowByID returns the active flow with the passed in ID, or ErrNotFound if it doesn't exist or has been soft deleted
 func (a *OrgAssets) FlowByID(flowID FlowID) (*Flow, error) {
+	flow, err := a.cachedFlowByID(flowID)
+	if err != nil {
+		return nil, err
+	}
+	if !flow.IsActive() {
+		return nil, ErrNotFound
+	}
+	return flow, nil
+}
+
+// SessionFlowByID returns the flow with the passed in ID for sessions already in it, which includes soft deleted
+// flows whose sessions are being left to finish
+func (a *OrgAssets) SessionFlowByID(flowID FlowID) (*Flow, error) {
+	flow, err := a.cachedFlowByID(flowID)
+	if err != nil {
+		return nil, err
+	}
+	if !flow.IsActive() && !flow.finishesSessions() {
+		return nil, ErrNotFound
+	}
+	return flow, nil
+}
+
+func (a *OrgAssets) cachedFlowByID(flowID FlowID) (*Flow, error) {
 	a.flowCacheLock.RLock()
 	flow, found := a.flowByID[flowID]
 	a.flowCacheLock.RUnlock()
@@ -345,7 +493,7 @@ func (a *OrgAssets) FlowByID(flowID FlowID) (*Flow, error) {
 		return flow.(*Flow), nil
 	}
 
-	dbFlow, err := loadFlowByID(a.ctx, a.db, a.orgID, flowID)
+	dbFlow, err := a.source.LoadFlowByID(a.ctx, a.orgID, flowID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading flow: %d", flowID)
 	}
@@ -378,6 +526,7 @@ func (a *OrgAssets) SetFlow(flowID FlowID, flow flows.Flow) (*Flow, error) {
 	f.f.Name = flow.Name()
 	f.f.ID = flowID
 	f.f.Definition = definition
+	f.f.IsActive = true
 
 	a.flowByID[flowID] = f
 	a.flowByUUID[flow.UUID()] = f
@@ -413,6 +562,31 @@ func (a *OrgAssets) GroupByUUID(groupUUID assets.GroupUUID) *Group {
 	return a.groupsByUUID[groupUUID]
 }
 
+// AddTestGroup adds a draft group to our org, replacing any existing group with the same UUID, this is only used in
+// session assets during simulation
+func (a *OrgAssets) AddTestGroup(group assets.Group) {
+	g := &Group{}
+	g.g.UUID = group.UUID()
+	g.g.Name = group.Name()
+	g.g.Query = group.Query()
+
+	existing := a.groupsByUUID[g.UUID()]
+	if existing != nil {
+		g.g.ID = existing.ID()
+		a.groupsByID[g.ID()] = g
+
+		for i := range a.groups {
+			if a.groups[i] == existing {
+				a.groups[i] = g
+			}
+		}
+	} else {
+		a.groups = append(a.groups, g)
+	}
+
+	a.groupsByUUID[g.UUID()] = g
+}
+
 func (a *OrgAssets) Labels() ([]assets.Label, error) {
 	return a.labels, nil
 }
@@ -421,6 +595,10 @@ func (a *OrgAssets) LabelByUUID(uuid assets.LabelUUID) *Label {
 	return a.labelsByUUID[uuid]
 }
 
+func (a *OrgAssets) AutoResponses() []*AutoResponse {
+	return a.autoResponses
+}
+
 func (a *OrgAssets) Triggers() []*Trigger {
 	return a.triggers
 }
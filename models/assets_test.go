@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/assets/static/types"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddTestAssets(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+
+	fields, _ := org.Fields()
+	numFields := len(fields)
+	groups, _ := org.Groups()
+	numGroups := len(groups)
+
+	// a new draft field and one which replaces the existing age field
+	newField, ageField := &types.Field{}, &types.Field{}
+	require.NoError(t, json.Unmarshal([]byte(`{"uuid": "f1b5aea6-6586-41c7-9020-1a6326cc6565", "key": "nickname", "name": "Nickname", "type": "text"}`), newField))
+	require.NoError(t, json.Unmarshal([]byte(`{"uuid": "1be0a9e5-93be-4e4e-bea5-a0c9c05e1b03", "key": "age", "name": "Age In Years", "type": "text"}`), ageField))
+
+	org.AddTestField(newField)
+	org.AddTestField(ageField)
+
+	fields, _ = org.Fields()
+	assert.Equal(t, numFields+1, len(fields))
+	assert.Equal(t, "Nickname", org.FieldByKey("nickname").Name())
+	assert.Equal(t, "Age In Years", org.FieldByKey("age").Name())
+	assert.Equal(t, assets.FieldTypeText, org.FieldByKey("age").Type())
+	assert.NotEqual(t, FieldID(0), org.FieldByKey("age").ID())
+	assert.Equal(t, "Age In Years", org.FieldByUUID(AgeFieldUUID).Name())
+
+	// a new draft group and one which replaces an existing group
+	newGroup, testers := &types.Group{}, &types.Group{}
+	require.NoError(t, json.Unmarshal([]byte(`{"uuid": "8c3b8a9b-8e0c-4b3e-9d2a-2f6a1d6c2f7e", "name": "VIPs", "query": "nickname != \"\""}`), newGroup))
+	require.NoError(t, json.Unmarshal([]byte(`{"uuid": "5e9d8fab-5e7e-4f51-b533-261af5dea70d", "name": "Beta Testers"}`), testers))
+
+	org.AddTestGroup(newGroup)
+	org.AddTestGroup(testers)
+
+	groups, _ = org.Groups()
+	assert.Equal(t, numGroups+1, len(groups))
+	assert.Equal(t, `nickname != ""`, org.GroupByUUID("8c3b8a9b-8e0c-4b3e-9d2a-2f6a1d6c2f7e").Query())
+	assert.Equal(t, "Beta Testers", org.GroupByUUID(TestersGroupUUID).Name())
+	assert.Equal(t, "Beta Testers", org.GroupByID(org.GroupByUUID(TestersGroupUUID).ID()).Name())
+}
+
+func TestCachedOrgs(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+	FlushCache()
+
+	assert.Equal(t, 0, len(CachedOrgs()))
+
+	org, err := GetOrgAssets(ctx, db, Org1)
+	require.NoError(t, err)
+	_, err = org.Flow(FavoritesFlowUUID)
+	require.NoError(t, err)
+
+	_, err = GetOrgAssets(ctx, db, Org2)
+	require.NoError(t, err)
+
+	cached := CachedOrgs()
+	require.Equal(t, 2, len(cached))
+	assert.Equal(t, Org1, cached[0].OrgID)
+	assert.Equal(t, 1, cached[0].FlowsLoaded)
+	assert.Equal(t, Org2, cached[1].OrgID)
+	assert.Equal(t, 0, cached[1].FlowsLoaded)
+
+	FlushOrgCache(Org1)
+
+	cached = CachedOrgs()
+	require.Equal(t, 1, len(cached))
+	assert.Equal(t, Org2, cached[0].OrgID)
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the org config key for the org's auto responses, which reply to single word messages without starting a flow, e.g.
+//
+//   "auto_responses": [
+//     {
+//       "keyword": "info",
+//       "base_language": "eng",
+//       "text": {"eng": "Visit example.com for more information.", "fra": "Visitez example.com pour plus d'informations."}
+//     }
+//   ]
+//
+const configAutoResponses = "auto_responses"
+
+// AutoResponse is a canned reply to messages consisting of a keyword. These are checked before triggers and are much
+// cheaper to handle than a flow for very high volume keywords.
+type AutoResponse struct {
+	Keyword      string                   `json:"keyword"`
+	BaseLanguage envs.Language            `json:"base_language"`
+	Text         map[envs.Language]string `json:"text"`
+}
+
+// reads the auto responses from the config of the passed in org, logging and ignoring them if they're invalid
+func orgAutoResponses(org *Org) []*AutoResponse {
+	raw, found := org.config[configAutoResponses]
+	if !found {
+		return nil
+	}
+
+	responses, err := readAutoResponses(raw)
+	if err != nil {
+		logrus.WithError(err).WithField("org_id", org.ID()).Error("ignoring invalid auto responses")
+		return nil
+	}
+	return responses
+}
+
+// reads and validates auto responses from the passed in config value
+func readAutoResponses(raw interface{}) ([]*AutoResponse, error) {
+	// our config has already been decoded so re-encode it to read it into our struct
+	responsesJSON, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]*AutoResponse, 0)
+	if err := json.Unmarshal(responsesJSON, &responses); err != nil {
+		return nil, errors.Wrapf(err, "error reading auto responses")
+	}
+
+	for _, r := range responses {
+		if words := utils.TokenizeString(r.Keyword); len(words) != 1 || words[0] != r.Keyword {
+			return nil, errors.Errorf("invalid auto response keyword: %s", r.Keyword)
+		}
+		if r.Text[r.BaseLanguage] == "" {
+			return nil, errors.Errorf("auto response for keyword %s has no text in its base language", r.Keyword)
+		}
+		r.Keyword = strings.ToLower(r.Keyword)
+	}
+	return responses, nil
+}
+
+// FindMatchingAutoResponse returns the auto response of this org whose keyword is the only word of the passed in
+// message text, or nil if there isn't one
+func (a *OrgAssets) FindMatchingAutoResponse(text string) *AutoResponse {
+	words := utils.TokenizeString(text)
+	if len(words) != 1 {
+		return nil
+	}
+	keyword := strings.ToLower(words[0])
+
+	for _, r := range a.autoResponses {
+		if r.Keyword == keyword {
+			return r
+		}
+	}
+	return nil
+}
+
+// Localize returns the text of this response in the passed in contact language if we have it, falling back to the
+// org's default language and then to our base language
+func (r *AutoResponse) Localize(contactLang envs.Language, defaultLang envs.Language) string {
+	for _, l := range []envs.Language{contactLang, defaultLang} {
+		if l != envs.NilLanguage && r.Text[l] != "" {
+			return r.Text[l]
+		}
+	}
+	return r.Text[r.BaseLanguage]
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoResponses(t *testing.T) {
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	// org without any auto responses
+	org, err := loadOrg(ctx, tx, Org1)
+	require.NoError(t, err)
+	oa := &OrgAssets{autoResponses: orgAutoResponses(org)}
+	assert.Nil(t, oa.AutoResponses())
+	assert.Nil(t, oa.FindMatchingAutoResponse("info"))
+
+	tx.MustExec(`UPDATE orgs_org SET config = '{"auto_responses": [
+		{"keyword": "INFO", "base_language": "eng", "text": {"eng": "Visit example.com", "fra": "Visitez example.com"}},
+		{"keyword": "stop", "base_language": "fra", "text": {"fra": "Au revoir"}}
+	]}' WHERE id = 1`)
+
+	org, err = loadOrg(ctx, tx, Org1)
+	require.NoError(t, err)
+	oa = &OrgAssets{autoResponses: orgAutoResponses(org)}
+	assert.Equal(t, 2, len(oa.AutoResponses()))
+
+	tcs := []struct {
+		Text    string
+		Keyword string
+	}{
+		{"info", "info"},
+		{" Info! ", "info"},
+		{"STOP", "stop"},
+		{"info please", ""},
+		{"information", ""},
+		{"", ""},
+	}
+
+	for _, tc := range tcs {
+		response := oa.FindMatchingAutoResponse(tc.Text)
+		if tc.Keyword == "" {
+			assert.Nil(t, response, "unexpected response for '%s'", tc.Text)
+		} else if assert.NotNil(t, response, "expected response for '%s'", tc.Text) {
+			assert.Equal(t, tc.Keyword, response.Keyword)
+		}
+	}
+
+	info := oa.FindMatchingAutoResponse("info")
+	assert.Equal(t, "Visitez example.com", info.Localize(envs.Language("fra"), envs.NilLanguage))
+	assert.Equal(t, "Visit example.com", info.Localize(envs.Language("kin"), envs.NilLanguage))
+	assert.Equal(t, "Visitez example.com", info.Localize(envs.Language("kin"), envs.Language("fra")))
+
+	// responses without text in their base language are invalid
+	tx.MustExec(`UPDATE orgs_org SET config = '{"auto_responses": [{"keyword": "info", "base_language": "eng", "text": {"fra": "Visitez example.com"}}]}' WHERE id = 1`)
+
+	org, err = loadOrg(ctx, tx, Org1)
+	require.NoError(t, err)
+	assert.Nil(t, orgAutoResponses(org))
+}
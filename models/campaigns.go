@@ -505,3 +505,65 @@ type FireAdd struct {
 	EventID   CampaignEventID `db:"event_id"`
 	Scheduled time.Time       `db:"scheduled"`
 }
+
+// how many contacts we load at once when scheduling an event for a whole campaign group
+const scheduleEventBatchSize = 500
+
+// ScheduleCampaignEvent replaces the unfired event fires of the passed in event with newly calculated ones for every
+// contact in its campaign's group, e.g. after the event has been created or its offset changed. It returns the number
+// of fires which were created.
+func ScheduleCampaignEvent(ctx context.Context, db *sqlx.DB, org *OrgAssets, sa flows.SessionAssets, event *CampaignEvent) (int, error) {
+	_, err := db.ExecContext(ctx, `DELETE FROM campaigns_eventfire WHERE event_id = $1 AND fired IS NULL`, event.ID())
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deleting unfired fires for event: %d", event.ID())
+	}
+
+	contactIDs, err := ContactIDsForGroupIDs(ctx, db, []GroupID{event.Campaign().GroupID()})
+	if err != nil {
+		return 0, errors.Wrapf(err, "error loading contacts for campaign group")
+	}
+
+	tz := org.Env().Timezone()
+	now := time.Now()
+	scheduled := 0
+
+	for i := 0; i < len(contactIDs); i += scheduleEventBatchSize {
+		end := i + scheduleEventBatchSize
+		if end > len(contactIDs) {
+			end = len(contactIDs)
+		}
+
+		contacts, err := LoadContacts(ctx, db, org, contactIDs[i:end])
+		if err != nil {
+			return scheduled, errors.Wrapf(err, "error loading contacts to schedule event for")
+		}
+
+		adds := make([]*FireAdd, 0, len(contacts))
+		for _, c := range contacts {
+			contact, err := c.FlowContact(org, sa)
+			if err != nil {
+				return scheduled, errors.Wrapf(err, "error creating flow contact")
+			}
+
+			fire, err := event.ScheduleForContact(tz, now, contact)
+			if err != nil {
+				return scheduled, errors.Wrapf(err, "error calculating offset")
+			}
+
+			// contacts without a value for the event's field, or for whom the event has passed, aren't scheduled
+			if fire != nil {
+				adds = append(adds, &FireAdd{ContactID: c.ID(), EventID: event.ID(), Scheduled: *fire})
+			}
+		}
+
+		err = AddEventFires(ctx, db, adds)
+		if err != nil {
+			return scheduled, errors.Wrapf(err, "error inserting event fires")
+		}
+		scheduled += len(adds)
+	}
+
+	logrus.WithField("org_id", org.OrgID()).WithField("event_id", event.ID()).WithField("scheduled", scheduled).Info("scheduled campaign event")
+
+	return scheduled, nil
+}
@@ -80,6 +80,7 @@ func (c *ChannelConnection) ContactID() ContactID     { return c.c.ContactID }
 func (c *ChannelConnection) ContactURNID() URNID      { return c.c.ContactURNID }
 func (c *ChannelConnection) ChannelID() ChannelID     { return c.c.ChannelID }
 func (c *ChannelConnection) StartID() StartID         { return c.c.StartID }
+func (c *ChannelConnection) Duration() int            { return c.c.Duration }
 
 const insertConnectionSQL = `
 INSERT INTO
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ChannelConfigBackupChannel is the config key for the UUID of the channel which sends are moved to while a channel
+	// has an open incident
+	ChannelConfigBackupChannel = "backup_channel_uuid"
+
+	channelIncidentsKey = "channel_incidents"
+)
+
+// ChannelIncident is an open problem with a channel, such as an Android phone which has stopped syncing
+type ChannelIncident struct {
+	ChannelID   ChannelID          `json:"channel_id"`
+	ChannelUUID assets.ChannelUUID `json:"channel_uuid"`
+	ChannelName string             `json:"channel_name"`
+	OrgID       OrgID              `json:"org_id"`
+	Reason      string             `json:"reason"`
+	OpenedOn    time.Time          `json:"opened_on"`
+}
+
+// OpenChannelIncident opens the passed in incident unless its channel already has one open. Returns whether the
+// incident was opened.
+func OpenChannelIncident(rc redis.Conn, incident *ChannelIncident) (bool, error) {
+	incidentJSON, err := json.Marshal(incident)
+	if err != nil {
+		return false, err
+	}
+
+	opened, err := redis.Bool(rc.Do("hsetnx", channelIncidentsKey, incident.ChannelID, incidentJSON))
+	if err != nil {
+		return false, errors.Wrapf(err, "error opening incident for channel: %d", incident.ChannelID)
+	}
+	return opened, nil
+}
+
+// ResolveChannelIncident resolves any open incident for the passed in channel
+func ResolveChannelIncident(rc redis.Conn, channelID ChannelID) error {
+	_, err := rc.Do("hdel", channelIncidentsKey, channelID)
+	return errors.Wrapf(err, "error resolving incident for channel: %d", channelID)
+}
+
+// GetChannelIncidents returns all open channel incidents, keyed by channel
+func GetChannelIncidents(rc redis.Conn) (map[ChannelID]*ChannelIncident, error) {
+	values, err := redis.StringMap(rc.Do("hgetall", channelIncidentsKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading channel incidents")
+	}
+
+	incidents := make(map[ChannelID]*ChannelIncident, len(values))
+	for _, v := range values {
+		incident := &ChannelIncident{}
+		if err := json.Unmarshal([]byte(v), incident); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling channel incident")
+		}
+		incidents[incident.ChannelID] = incident
+	}
+	return incidents, nil
+}
+
+// FailoverChannel returns the channel that a message to a URN with the passed in scheme should be sent on, given the
+// channel it would otherwise be sent on. If that channel has an open incident and a backup channel configured which
+// supports the scheme and doesn't have an incident of its own, sends are moved to the backup.
+func FailoverChannel(rc redis.Conn, org *OrgAssets, channel *Channel, scheme string) (*Channel, error) {
+	backupUUID := channel.ConfigValue(ChannelConfigBackupChannel, "")
+	if backupUUID == "" {
+		return channel, nil
+	}
+
+	backup := org.ChannelByUUID(assets.ChannelUUID(backupUUID))
+	if backup == nil || backup.ID() == channel.ID() || !backup.hasScheme(scheme) || !backup.hasRole(assets.ChannelRoleSend) {
+		return channel, nil
+	}
+
+	open, err := redis.Ints(rc.Do("eval", channelIncidentsScript, 1, channelIncidentsKey, channel.ID(), backup.ID()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error checking channel incidents")
+	}
+
+	if open[0] == 1 && open[1] == 0 {
+		return backup, nil
+	}
+	return channel, nil
+}
+
+// SendChannel returns the channel that a message to a URN with the passed in scheme should be sent on, given the channel
+// it would otherwise be sent on, by first routing within that channel's region and then failing over to a backup
+func SendChannel(rc redis.Conn, org *OrgAssets, channel *Channel, scheme string) (*Channel, error) {
+	routed, err := RouteChannel(rc, org, channel, scheme)
+	if err != nil {
+		return nil, err
+	}
+	return FailoverChannel(rc, org, routed, scheme)
+}
+
+// returns whether each of the passed in channels has an open incident
+const channelIncidentsScript = `
+local open = {}
+for i, channelID in ipairs(ARGV) do
+	open[i] = redis.call("hexists", KEYS[1], channelID)
+end
+return open
+`
+
+// ChannelProblem is a channel which appears to be dead
+type ChannelProblem struct {
+	ChannelID   ChannelID          `db:"channel_id"`
+	ChannelUUID assets.ChannelUUID `db:"channel_uuid"`
+	ChannelName string             `db:"channel_name"`
+	OrgID       OrgID              `db:"org_id"`
+	Reason      string             `db:"reason"`
+}
+
+const selectSilentAndroidChannelsSQL = `
+SELECT
+	c.id AS channel_id,
+	c.uuid AS channel_uuid,
+	COALESCE(c.name, '') AS channel_name,
+	c.org_id AS org_id,
+	'not seen since ' || TO_CHAR(c.last_seen AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI') || ' UTC' AS reason
+FROM
+	channels_channel c
+WHERE
+	c.is_active = TRUE AND
+	c.org_id IS NOT NULL AND
+	c.channel_type = 'A' AND
+	c.last_seen < $1
+`
+
+const selectFailingChannelsSQL = `
+SELECT
+	c.id AS channel_id,
+	c.uuid AS channel_uuid,
+	COALESCE(c.name, '') AS channel_name,
+	c.org_id AS org_id,
+	ROUND(100 * r.error_rate) || '% of recent messages failed' AS reason
+FROM
+	(` + channelErrorRatesSQL + `) r
+	JOIN channels_channel c ON c.id = r.channel_id
+WHERE
+	c.channel_type != 'A' AND
+	r.msg_count >= $2 AND
+	r.error_rate >= $3
+`
+
+// FindDeadChannels returns Android channels which haven't synced since lastSeenBefore, and other channels which have
+// sent at least minMsgs messages since errorsSince of which at least maxErrorRate failed
+func FindDeadChannels(ctx context.Context, db *sqlx.DB, lastSeenBefore time.Time, errorsSince time.Time, minMsgs int, maxErrorRate float64) ([]*ChannelProblem, error) {
+	silent := make([]*ChannelProblem, 0)
+	err := db.SelectContext(ctx, &silent, selectSilentAndroidChannelsSQL, lastSeenBefore)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting silent android channels")
+	}
+
+	failing := make([]*ChannelProblem, 0)
+	err = db.SelectContext(ctx, &failing, selectFailingChannelsSQL, errorsSince, minMsgs, maxErrorRate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting failing channels")
+	}
+
+	return append(silent, failing...), nil
+}
+
+const selectOrgAdminEmailsSQL = `
+SELECT
+	u.email
+FROM
+	orgs_org_administrators a
+	JOIN auth_user u ON u.id = a.user_id
+WHERE
+	a.org_id = $1 AND
+	u.is_active = TRUE AND
+	u.email != ''
+ORDER BY
+	u.email
+`
+
+// GetOrgAdminEmails returns the email addresses of the administrators of the passed in org
+func GetOrgAdminEmails(ctx context.Context, db *sqlx.DB, orgID OrgID) ([]string, error) {
+	emails := make([]string, 0)
+	err := db.SelectContext(ctx, &emails, selectOrgAdminEmailsSQL, orgID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting admin emails for org: %d", orgID)
+	}
+	return emails, nil
+}
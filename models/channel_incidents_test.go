@@ -0,0 +1,103 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelIncidents(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	// make nexmo an Android channel which hasn't synced in a while
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'A', last_seen = NOW() - INTERVAL '2 hours' WHERE id = $1`, NexmoChannelID)
+
+	// and give twilio a high error rate
+	for i := 0; i < 5; i++ {
+		status := "F"
+		if i == 0 {
+			status = "W"
+		}
+		db.MustExec(
+			`INSERT INTO msgs_msg(uuid, org_id, channel_id, contact_id, contact_urn_id, text, direction, status, created_on, visibility, msg_count, error_count, next_attempt)
+			VALUES($1, $2, $3, $4, $5, 'hi', 'O', $6, NOW(), 'V', 1, 0, NOW())`,
+			uuids.New(), Org1, TwilioChannelID, CathyID, CathyURNID, status)
+	}
+
+	findDead := func(minMsgs int) map[ChannelID]string {
+		problems, err := FindDeadChannels(ctx, db, time.Now().Add(-time.Hour), time.Now().Add(-time.Minute), minMsgs, 0.8)
+		require.NoError(t, err)
+
+		dead := make(map[ChannelID]string, len(problems))
+		for _, p := range problems {
+			dead[p.ChannelID] = p.Reason
+		}
+		return dead
+	}
+
+	dead := findDead(5)
+	assert.Contains(t, dead[NexmoChannelID], "not seen since")
+	assert.Equal(t, "80% of recent messages failed", dead[TwilioChannelID])
+	assert.NotContains(t, dead, TwitterChannelID)
+
+	// channels which haven't sent enough messages aren't considered dead
+	assert.NotContains(t, findDead(10), TwilioChannelID)
+
+	// open an incident for twilio
+	incident := &ChannelIncident{ChannelID: TwilioChannelID, ChannelUUID: TwilioChannelUUID, OrgID: Org1, Reason: "down", OpenedOn: time.Now()}
+	opened, err := OpenChannelIncident(rc, incident)
+	assert.NoError(t, err)
+	assert.True(t, opened)
+
+	// can't be opened again while it's open
+	opened, err = OpenChannelIncident(rc, incident)
+	assert.NoError(t, err)
+	assert.False(t, opened)
+
+	incidents, err := GetChannelIncidents(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(incidents))
+	assert.Equal(t, "down", incidents[TwilioChannelID].Reason)
+
+	// give twilio a backup channel
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'NX' WHERE id = $1`, NexmoChannelID)
+	db.MustExec(`UPDATE channels_channel SET config = (COALESCE(config, '{}')::jsonb || jsonb_build_object('backup_channel_uuid', $2::text))::text WHERE id = $1`, TwilioChannelID, NexmoChannelUUID)
+
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+
+	failover := func(channelID ChannelID, scheme string) ChannelID {
+		channel, err := FailoverChannel(rc, org, org.ChannelByID(channelID), scheme)
+		require.NoError(t, err)
+		return channel.ID()
+	}
+
+	// sends on twilio now go out on its backup, unless the backup doesn't support the scheme
+	assert.Equal(t, NexmoChannelID, failover(TwilioChannelID, "tel"))
+	assert.Equal(t, TwilioChannelID, failover(TwilioChannelID, "twitter"))
+
+	// channels without incidents or backups aren't affected
+	assert.Equal(t, NexmoChannelID, failover(NexmoChannelID, "tel"))
+	assert.Equal(t, TwitterChannelID, failover(TwitterChannelID, "twitter"))
+
+	// backups which are also down aren't used
+	_, err = OpenChannelIncident(rc, &ChannelIncident{ChannelID: NexmoChannelID, OrgID: Org1, Reason: "down", OpenedOn: time.Now()})
+	assert.NoError(t, err)
+	assert.Equal(t, TwilioChannelID, failover(TwilioChannelID, "tel"))
+
+	// once resolved, sends go back to twilio
+	assert.NoError(t, ResolveChannelIncident(rc, TwilioChannelID))
+	assert.NoError(t, ResolveChannelIncident(rc, NexmoChannelID))
+	assert.Equal(t, TwilioChannelID, failover(TwilioChannelID, "tel"))
+
+	incidents, err = GetChannelIncidents(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(incidents))
+}
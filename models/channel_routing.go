@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ChannelConfigRoutingRegion is the config key for the region of a channel, sends on a channel with a region are
+	// distributed across all the channels in that region which support the same scheme
+	ChannelConfigRoutingRegion = "routing_region"
+
+	// ChannelConfigRoutingWeight is the config key for the relative share of its region's sends a channel gets
+	ChannelConfigRoutingWeight = "routing_weight"
+
+	// channels with an error rate above this are skipped when routing unless all channels in the region are
+	channelRoutingMaxErrorRate = 0.5
+
+	channelRoutingCounterKey = "channel_routing:%d:%s"
+	channelErrorRatesKey     = "channel_error_rates"
+)
+
+// RouteChannel returns the channel that a message to a URN with the passed in scheme should be sent on, given the
+// channel it would otherwise be sent on. If that channel has a region, sends are distributed by weighted round
+// robin across the channels in that region, skipping those with high recent error rates.
+func RouteChannel(rc redis.Conn, org *OrgAssets, channel *Channel, scheme string) (*Channel, error) {
+	region := channel.ConfigValue(ChannelConfigRoutingRegion, "")
+	if region == "" {
+		return channel, nil
+	}
+
+	all, err := org.Channels()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading channels")
+	}
+
+	siblings := make([]*Channel, 0, len(all))
+	for _, a := range all {
+		c := a.(*Channel)
+		if c.ConfigValue(ChannelConfigRoutingRegion, "") == region && c.Type() != ChannelTypeAndroid && channelWeight(c) > 0 && c.hasScheme(scheme) && c.hasRole(assets.ChannelRoleSend) {
+			siblings = append(siblings, c)
+		}
+	}
+
+	healthy, err := healthyChannels(rc, siblings)
+	if err != nil {
+		return nil, err
+	}
+	if len(healthy) == 0 {
+		return channel, nil
+	}
+
+	total := 0
+	for _, c := range healthy {
+		total += channelWeight(c)
+	}
+
+	count, err := redis.Int(rc.Do("incr", fmt.Sprintf(channelRoutingCounterKey, org.OrgID(), region)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error incrementing routing counter")
+	}
+
+	slot := (count - 1) % total
+	for _, c := range healthy {
+		slot -= channelWeight(c)
+		if slot < 0 {
+			return c, nil
+		}
+	}
+	return channel, nil
+}
+
+// returns the passed in channels without those whose recent error rate is too high
+func healthyChannels(rc redis.Conn, channels []*Channel) ([]*Channel, error) {
+	if len(channels) == 0 {
+		return channels, nil
+	}
+
+	args := redis.Args{channelErrorRatesKey}
+	for _, c := range channels {
+		args = args.Add(c.ID())
+	}
+
+	rates, err := redis.Strings(rc.Do("hmget", args...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading channel error rates")
+	}
+
+	healthy := make([]*Channel, 0, len(channels))
+	for i, c := range channels {
+		rate, _ := strconv.ParseFloat(rates[i], 64)
+		if rate <= channelRoutingMaxErrorRate {
+			healthy = append(healthy, c)
+		}
+	}
+	return healthy, nil
+}
+
+// returns the routing weight of the passed in channel, which defaults to 1
+func channelWeight(c *Channel) int {
+	weight, err := strconv.Atoi(c.ConfigValue(ChannelConfigRoutingWeight, "1"))
+	if err != nil {
+		return 1
+	}
+	return weight
+}
+
+func (c *Channel) hasScheme(scheme string) bool {
+	for _, s := range c.c.Schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Channel) hasRole(role assets.ChannelRole) bool {
+	for _, r := range c.c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// selects the number of outgoing messages created on each active channel since $1 and the proportion of them which
+// errored or failed, used for both routing and finding dead channels
+const channelErrorRatesSQL = `
+SELECT
+	m.channel_id AS channel_id,
+	COUNT(*) AS msg_count,
+	COUNT(*) FILTER (WHERE m.status IN ('E', 'F'))::float / COUNT(*) AS error_rate
+FROM
+	msgs_msg m
+	JOIN channels_channel c ON c.id = m.channel_id
+WHERE
+	c.is_active = TRUE AND
+	m.direction = 'O' AND
+	m.created_on > $1
+GROUP BY
+	m.channel_id
+`
+
+const selectChannelErrorRatesSQL = `
+SELECT
+	r.channel_id,
+	r.error_rate
+FROM
+	(` + channelErrorRatesSQL + `) r
+	JOIN channels_channel c ON c.id = r.channel_id
+WHERE
+	c.config::json->>'routing_region' IS NOT NULL
+`
+
+// UpdateChannelErrorRates calculates the error rates of outgoing messages since the passed in time for all channels
+// with a region, and stores them for routing. Returns the number of channels updated.
+func UpdateChannelErrorRates(ctx context.Context, db *sqlx.DB, rc redis.Conn, since time.Time) (int, error) {
+	rows, err := db.QueryxContext(ctx, selectChannelErrorRatesSQL, since)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error querying channel error rates")
+	}
+	defer rows.Close()
+
+	args := redis.Args{channelErrorRatesKey}
+	updated := 0
+	for rows.Next() {
+		var channelID ChannelID
+		var rate float64
+		if err := rows.Scan(&channelID, &rate); err != nil {
+			return 0, errors.Wrapf(err, "error scanning channel error rate")
+		}
+		args = args.Add(channelID, strconv.FormatFloat(rate, 'f', 4, 64))
+		updated++
+	}
+
+	// replace our previous rates so channels which have recovered are routed to again
+	rc.Send("multi")
+	rc.Send("del", channelErrorRatesKey)
+	if updated > 0 {
+		rc.Send("hmset", args...)
+	}
+	_, err = rc.Do("exec")
+	if err != nil {
+		return 0, errors.Wrapf(err, "error storing channel error rates")
+	}
+
+	return updated, nil
+}
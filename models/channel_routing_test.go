@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteChannel(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	db.MustExec(`UPDATE channels_channel SET config = (COALESCE(config, '{}')::jsonb || '{"routing_region": "east", "routing_weight": 2}')::text WHERE id = $1`, TwilioChannelID)
+	db.MustExec(`UPDATE channels_channel SET config = (COALESCE(config, '{}')::jsonb || '{"routing_region": "east"}')::text WHERE id = $1`, NexmoChannelID)
+
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+
+	twilio := org.ChannelByID(TwilioChannelID)
+	nexmo := org.ChannelByID(NexmoChannelID)
+	twitter := org.ChannelByID(TwitterChannelID)
+
+	route := func(channel *Channel, scheme string) ChannelID {
+		routed, err := RouteChannel(rc, org, channel, scheme)
+		require.NoError(t, err)
+		return routed.ID()
+	}
+
+	// channels without a region aren't routed
+	assert.Equal(t, TwitterChannelID, route(twitter, "twitter"))
+
+	// sends are distributed by weight
+	routed := []ChannelID{route(twilio, "tel"), route(twilio, "tel"), route(nexmo, "tel"), route(twilio, "tel"), route(twilio, "tel"), route(nexmo, "tel")}
+	assert.Equal(t, []ChannelID{TwilioChannelID, TwilioChannelID, NexmoChannelID, TwilioChannelID, TwilioChannelID, NexmoChannelID}, routed)
+
+	// give twilio a high error rate
+	for _, status := range []string{"E", "F", "W"} {
+		db.MustExec(
+			`INSERT INTO msgs_msg(uuid, org_id, channel_id, contact_id, contact_urn_id, text, direction, status, created_on, visibility, msg_count, error_count, next_attempt)
+			VALUES($1, $2, $3, $4, $5, 'hi', 'O', $6, NOW(), 'V', 1, 0, NOW())`,
+			uuids.New(), Org1, TwilioChannelID, CathyID, CathyURNID, status)
+	}
+
+	updated, err := UpdateChannelErrorRates(ctx, db, rc, time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+
+	// so now all sends go to nexmo
+	assert.Equal(t, NexmoChannelID, route(twilio, "tel"))
+	assert.Equal(t, NexmoChannelID, route(twilio, "tel"))
+
+	// unless nexmo is also unhealthy, in which case we don't route
+	rc.Do("hset", channelErrorRatesKey, NexmoChannelID, "0.9")
+	assert.Equal(t, TwilioChannelID, route(twilio, "tel"))
+	assert.Equal(t, NexmoChannelID, route(nexmo, "tel"))
+
+	// recalculating clears rates of channels without recent errors
+	updated, err = UpdateChannelErrorRates(ctx, db, rc, time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	assert.Equal(t, NexmoChannelID, route(twilio, "tel"))
+}
@@ -0,0 +1,269 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// AnonymizedPlaceholder is what the text of messages and the values of results are replaced with when a contact is
+// anonymized
+const AnonymizedPlaceholder = "[redacted]"
+
+const selectWaitingSessionsForAnonymizeSQL = `
+SELECT
+	id
+FROM
+	flows_flowsession
+WHERE
+	org_id = $1 AND
+	contact_id = ANY($2) AND
+	status = 'W'
+`
+
+// contacts are also deactivated as the indexer removes inactive contacts from the index rather than indexing them
+// again when their modified_on changes, and they can no longer be started in flows which might write PII back
+const anonymizeContactsSQL = `
+UPDATE
+	contacts_contact
+SET
+	name = NULL,
+	fields = '{}'::jsonb,
+	is_active = FALSE,
+	modified_on = NOW()
+WHERE
+	org_id = $1 AND
+	id = ANY($2)
+`
+
+// URNs are kept so that messages can still reference them, but their identities are replaced with ones which can't
+// be traced back to the original URN and which will never match a new incoming URN
+const anonymizeContactURNsSQL = `
+UPDATE
+	contacts_contacturn
+SET
+	identity = 'deleted:' || id,
+	path = id::text,
+	scheme = 'deleted',
+	display = NULL,
+	auth = NULL,
+	channel_id = NULL
+WHERE
+	org_id = $1 AND
+	contact_id = ANY($2)
+`
+
+const anonymizeContactMsgsSQL = `
+UPDATE
+	msgs_msg
+SET
+	text = $3,
+	attachments = NULL,
+	metadata = NULL,
+	modified_on = NOW()
+WHERE
+	org_id = $1 AND
+	contact_id = ANY($2)
+`
+
+const anonymizeContactWebhookResultsSQL = `
+UPDATE
+	api_webhookresult
+SET
+	url = $3,
+	request = $3,
+	response = $3
+WHERE
+	org_id = $1 AND
+	contact_id = ANY($2)
+`
+
+// channel logs of messages and calls include the contact's URN in their requests and responses
+const anonymizeContactChannelLogsSQL = `
+UPDATE
+	channels_channellog l
+SET
+	url = $3,
+	request = $3,
+	response = $3
+WHERE
+	l.msg_id IN (SELECT id FROM msgs_msg WHERE org_id = $1 AND contact_id = ANY($2)) OR
+	l.connection_id IN (SELECT id FROM channels_channelconnection WHERE org_id = $1 AND contact_id = ANY($2))
+`
+
+const anonymizeContactSessionsSQL = `
+UPDATE
+	flows_flowsession
+SET
+	output = NULL
+WHERE
+	org_id = $1 AND
+	contact_id = ANY($2)
+`
+
+const selectRunsForAnonymizeSQL = `
+SELECT
+	id,
+	COALESCE(results, '{}') AS results,
+	COALESCE(events, '[]'::jsonb) AS events
+FROM
+	flows_flowrun
+WHERE
+	org_id = $1 AND
+	contact_id = ANY($2)
+`
+
+const anonymizeRunSQL = `
+UPDATE
+	flows_flowrun
+SET
+	results = $2,
+	events = $3,
+	modified_on = NOW()
+WHERE
+	id = $1
+`
+
+// AnonymizeContacts scrubs the names, URNs and field values of the passed in contacts and deactivates them, and
+// rewrites their messages, run results, webhook results and channel logs with placeholders. Rows are updated rather
+// than deleted so that message counts and result categories are preserved for analytics. Any waiting sessions for
+// these contacts are interrupted first. Callers should hold the locks of the contacts.
+func AnonymizeContacts(ctx context.Context, db *sqlx.DB, orgID OrgID, contactIDs []ContactID) error {
+	if len(contactIDs) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error starting transaction")
+	}
+
+	// interrupt any waiting sessions as these hold the contact in their state
+	sessionIDs := make([]SessionID, 0)
+	err = tx.SelectContext(ctx, &sessionIDs, selectWaitingSessionsForAnonymizeSQL, orgID, pq.Array(contactIDs))
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "error selecting waiting sessions")
+	}
+
+	err = ExitSessions(ctx, tx, sessionIDs, ExitInterrupted, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "error interrupting sessions")
+	}
+
+	for _, sql := range []string{anonymizeContactsSQL, anonymizeContactURNsSQL, anonymizeContactSessionsSQL} {
+		_, err = tx.ExecContext(ctx, sql, orgID, pq.Array(contactIDs))
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "error anonymizing contacts")
+		}
+	}
+
+	for _, sql := range []string{anonymizeContactChannelLogsSQL, anonymizeContactWebhookResultsSQL, anonymizeContactMsgsSQL} {
+		_, err = tx.ExecContext(ctx, sql, orgID, pq.Array(contactIDs), AnonymizedPlaceholder)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "error anonymizing messages and logs")
+		}
+	}
+
+	err = anonymizeContactRuns(ctx, tx, orgID, contactIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(err, "error committing anonymized contacts")
+	}
+
+	logrus.WithField("org_id", orgID).WithField("count", len(contactIDs)).WithField("elapsed", time.Since(start)).Info("anonymized contacts")
+	return nil
+}
+
+// rewrites the results and events of the runs of the passed in contacts with placeholders
+func anonymizeContactRuns(ctx context.Context, tx *sqlx.Tx, orgID OrgID, contactIDs []ContactID) error {
+	type runRow struct {
+		ID      FlowRunID `db:"id"`
+		Results string    `db:"results"`
+		Events  string    `db:"events"`
+	}
+
+	runs := make([]*runRow, 0)
+	err := tx.SelectContext(ctx, &runs, selectRunsForAnonymizeSQL, orgID, pq.Array(contactIDs))
+	if err != nil {
+		return errors.Wrapf(err, "error selecting runs")
+	}
+
+	for _, r := range runs {
+		results, err := anonymizeRunResults(r.Results)
+		if err != nil {
+			return errors.Wrapf(err, "error anonymizing results for run %d", r.ID)
+		}
+		events, err := anonymizeRunEvents(r.Events)
+		if err != nil {
+			return errors.Wrapf(err, "error anonymizing events for run %d", r.ID)
+		}
+
+		_, err = tx.ExecContext(ctx, anonymizeRunSQL, r.ID, results, events)
+		if err != nil {
+			return errors.Wrapf(err, "error updating run %d", r.ID)
+		}
+	}
+	return nil
+}
+
+// replaces the values and inputs of the passed in results, keeping their categories
+func anonymizeRunResults(resultsJSON string) (string, error) {
+	results := make(map[string]map[string]interface{})
+	if err := json.Unmarshal([]byte(resultsJSON), &results); err != nil {
+		return "", err
+	}
+
+	for _, result := range results {
+		result["value"] = AnonymizedPlaceholder
+		if _, found := result["input"]; found {
+			result["input"] = AnonymizedPlaceholder
+		}
+	}
+
+	anonymized, err := json.Marshal(results)
+	return string(anonymized), err
+}
+
+// replaces the message text, names, field values and URNs in the passed in events
+func anonymizeRunEvents(eventsJSON string) (string, error) {
+	events := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal([]byte(eventsJSON), &events); err != nil {
+		return "", err
+	}
+
+	for _, event := range events {
+		if msg, isMap := event["msg"].(map[string]interface{}); isMap {
+			msg["text"] = AnonymizedPlaceholder
+			delete(msg, "urn")
+			delete(msg, "attachments")
+		}
+
+		switch event["type"] {
+		case "contact_name_changed":
+			event["name"] = AnonymizedPlaceholder
+		case "contact_field_changed":
+			event["value"] = nil
+		case "contact_urns_changed":
+			event["urns"] = []string{}
+		}
+	}
+
+	anonymized, err := json.Marshal(events)
+	return string(anonymized), err
+}
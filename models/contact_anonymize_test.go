@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymizeContacts(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	db.MustExec(`UPDATE contacts_contact SET fields = jsonb_build_object($2::text, '{"text": "Female"}'::jsonb) WHERE id = $1`, CathyID, GenderFieldUUID)
+
+	db.MustExec(
+		`INSERT INTO msgs_msg(uuid, org_id, channel_id, contact_id, contact_urn_id, text, attachments, direction, status, created_on, visibility, msg_count, error_count, next_attempt)
+		VALUES($1, $2, $3, $4, $5, 'my secret', '{"image/jpeg:http://example.com/me.jpg"}', 'I', 'H', NOW(), 'V', 1, 0, NOW())`,
+		uuids.New(), Org1, TwilioChannelID, CathyID, CathyURNID)
+
+	db.MustExec(
+		`INSERT INTO api_webhookresult(org_id, contact_id, url, request, status_code, response, request_time, created_on)
+		VALUES($1, $2, 'http://example.com/?urn=tel:+250700000001', 'GET /?urn=tel:+250700000001', 200, 'ok', 10, NOW())`,
+		Org1, CathyID)
+
+	db.MustExec(
+		`INSERT INTO channels_channellog(description, is_error, url, method, request, response, response_status, created_on, request_time, channel_id, msg_id)
+		SELECT 'Message Sent', FALSE, 'http://example.com/send', 'POST', 'to=+250700000001', 'ok', 200, NOW(), 10, $1, id FROM msgs_msg WHERE contact_id = $2`,
+		TwilioChannelID, CathyID)
+
+	var sessionID SessionID
+	err := db.Get(&sessionID,
+		`INSERT INTO flows_flowsession(uuid, status, responded, created_on, org_id, contact_id, current_flow_id, output)
+		VALUES($1, 'W', TRUE, NOW(), $2, $3, $4, '{"contact": {"name": "Cathy"}}') RETURNING id`,
+		uuids.New(), Org1, CathyID, FavoritesFlowID)
+	require.NoError(t, err)
+
+	db.MustExec(
+		`INSERT INTO flows_flowrun(uuid, is_active, status, created_on, modified_on, responded, contact_id, flow_id, session_id, org_id, results, events)
+		VALUES($1, TRUE, 'W', NOW(), NOW(), TRUE, $2, $3, $4, $5, $6, $7)`,
+		uuids.New(), CathyID, FavoritesFlowID, sessionID, Org1,
+		`{"color": {"name": "Color", "value": "red", "category": "Red", "input": "my favorite is red", "node_uuid": "10c9c241-777f-4010-a841-6e87abed8520", "created_on": "2020-01-01T12:00:00Z"}}`,
+		`[{"type": "msg_received", "created_on": "2020-01-01T12:00:00Z", "msg": {"uuid": "1bd3bd61-1cb1-4fc4-a6ce-39a5cdab3a6b", "urn": "tel:+250700000001", "text": "my favorite is red"}}, {"type": "contact_name_changed", "created_on": "2020-01-01T12:00:00Z", "name": "Cathy"}]`)
+
+	// a contact in another org is ignored
+	err = AnonymizeContacts(ctx, db, Org2, []ContactID{CathyID})
+	require.NoError(t, err)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND name = 'Cathy'`, []interface{}{CathyID}, 1)
+
+	err = AnonymizeContacts(ctx, db, Org1, []ContactID{CathyID})
+	require.NoError(t, err)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND name IS NULL AND fields = '{}' AND is_active = FALSE`, []interface{}{CathyID}, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contacturn WHERE contact_id = $1 AND scheme != 'deleted'`, []interface{}{CathyID}, 0)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contacturn WHERE id = $1 AND identity = 'deleted:' || id`, []interface{}{CathyURNID}, 1)
+
+	// messages are kept but their content is replaced
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND text != '[redacted]'`, []interface{}{CathyID}, 0)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND attachments IS NOT NULL`, []interface{}{CathyID}, 0)
+
+	// as are webhook results and channel logs
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM api_webhookresult WHERE contact_id = $1 AND (url != '[redacted]' OR request != '[redacted]' OR response != '[redacted]')`, []interface{}{CathyID}, 0)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM channels_channellog WHERE msg_id IN (SELECT id FROM msgs_msg WHERE contact_id = $1) AND request != '[redacted]'`, []interface{}{CathyID}, 0)
+
+	// session is interrupted and its output cleared
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE id = $1 AND status = 'I' AND output IS NULL`, []interface{}{sessionID}, 1)
+
+	// result categories are kept
+	var results, events string
+	err = db.QueryRow(`SELECT results, events FROM flows_flowrun WHERE session_id = $1`, sessionID).Scan(&results, &events)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"color": {"name": "Color", "value": "[redacted]", "category": "Red", "input": "[redacted]", "node_uuid": "10c9c241-777f-4010-a841-6e87abed8520", "created_on": "2020-01-01T12:00:00Z"}}`, results)
+	assert.JSONEq(t, `[{"type": "msg_received", "created_on": "2020-01-01T12:00:00Z", "msg": {"uuid": "1bd3bd61-1cb1-4fc4-a6ce-39a5cdab3a6b", "text": "[redacted]"}}, {"type": "contact_name_changed", "created_on": "2020-01-01T12:00:00Z", "name": "[redacted]"}]`, events)
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/pkg/errors"
+)
+
+// ContactNoteAddedType is the type of the history event a contact note is stored as
+const ContactNoteAddedType = "note_added"
+
+// ContactNote is a note added to a contact by a user to give context to other users, stored in the same shape as the
+// other events in a contact's history
+//
+//   {
+//     "type": "note_added",
+//     "uuid": "0e9a5a1e-5f1d-4d5c-9a8f-2e6d3c1b7a40",
+//     "created_on": "2020-05-04T12:30:00Z",
+//     "contact_id": 12,
+//     "user_id": 3,
+//     "text": "Called back about their refund, waiting on finance"
+//   }
+//
+type ContactNote struct {
+	Type      string     `json:"type"`
+	UUID      uuids.UUID `json:"uuid"        db:"uuid"`
+	CreatedOn time.Time  `json:"created_on"  db:"created_on"`
+	ContactID ContactID  `json:"contact_id"  db:"contact_id"`
+	UserID    int64      `json:"user_id"     db:"user_id"`
+	Text      string     `json:"text"        db:"text"`
+}
+
+// NewContactNote creates a new note on the passed in contact by the passed in user
+func NewContactNote(contactID ContactID, userID int64, text string) *ContactNote {
+	return &ContactNote{
+		Type:      ContactNoteAddedType,
+		UUID:      uuids.New(),
+		CreatedOn: time.Now().UTC(),
+		ContactID: contactID,
+		UserID:    userID,
+		Text:      text,
+	}
+}
+
+// InsertContactNote inserts the passed in note for the passed in org, returning ErrNotFound if its contact isn't an
+// active contact in that org
+func InsertContactNote(ctx context.Context, db Queryer, orgID OrgID, note *ContactNote) error {
+	res, err := db.ExecContext(ctx, insertContactNoteSQL, note.UUID, orgID, note.ContactID, note.UserID, note.Text, note.CreatedOn)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting contact note")
+	}
+	if inserted, _ := res.RowsAffected(); inserted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const insertContactNoteSQL = `
+INSERT INTO contacts_contactnote(uuid, org_id, contact_id, user_id, text, created_on)
+     SELECT $1, $2, id, $4, $5, $6 FROM contacts_contact WHERE id = $3 AND org_id = $2 AND is_active = TRUE
+`
+
+// GetContactNotes returns the notes on the passed in contact, newest first
+func GetContactNotes(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID) ([]*ContactNote, error) {
+	return SearchContactNotes(ctx, db, orgID, contactID, "", -1)
+}
+
+// SearchContactNotes returns the notes on the passed in contact, or on any contact in the org if it is nil, which
+// contain the passed in text, case insensitive. Notes are returned newest first and up to the passed in limit, or all
+// of them if the limit is negative.
+func SearchContactNotes(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID, text string, limit int) ([]*ContactNote, error) {
+	var limitArg interface{}
+	if limit >= 0 {
+		limitArg = limit
+	}
+
+	rows, err := db.QueryxContext(ctx, searchContactNotesSQL, orgID, contactID, escapeLike(text), limitArg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error searching contact notes for org: %d", orgID)
+	}
+	defer rows.Close()
+
+	notes := make([]*ContactNote, 0)
+	for rows.Next() {
+		note := &ContactNote{Type: ContactNoteAddedType}
+		if err := rows.StructScan(note); err != nil {
+			return nil, errors.Wrapf(err, "error scanning contact note")
+		}
+		note.CreatedOn = note.CreatedOn.UTC()
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+const searchContactNotesSQL = `
+SELECT uuid, created_on, contact_id, user_id, text
+  FROM contacts_contactnote
+ WHERE org_id = $1 AND ($2 = 0 OR contact_id = $2) AND text ILIKE '%' || $3::text || '%'
+ ORDER BY created_on DESC, id DESC
+ LIMIT $4
+`
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactNotes(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	notes, err := GetContactNotes(ctx, db, Org1, CathyID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(notes))
+
+	note1 := NewContactNote(CathyID, 1, "Called back about their Refund")
+	note1.CreatedOn = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	note2 := NewContactNote(CathyID, 2, "Prefers calls in the morning")
+	note2.CreatedOn = time.Date(2020, 5, 2, 12, 0, 0, 0, time.UTC)
+	note3 := NewContactNote(BobID, 1, "Refund approved")
+	note3.CreatedOn = time.Date(2020, 5, 3, 12, 0, 0, 0, time.UTC)
+	note4 := NewContactNote(GeorgeID, 1, "Refund from another org")
+
+	for _, n := range []*ContactNote{note1, note2, note3} {
+		require.NoError(t, InsertContactNote(ctx, db, Org1, n))
+	}
+
+	// contacts can only be given notes by their own org
+	assert.Equal(t, ErrNotFound, InsertContactNote(ctx, db, Org2, note4))
+
+	assert.Equal(t, ContactNoteAddedType, note1.Type)
+
+	// a contact's notes are newest first
+	notes, err = GetContactNotes(ctx, db, Org1, CathyID)
+	require.NoError(t, err)
+	assert.Equal(t, []*ContactNote{note2, note1}, notes)
+
+	// search a contact's notes
+	notes, err = SearchContactNotes(ctx, db, Org1, CathyID, "refund", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*ContactNote{note1}, notes)
+
+	// search all the notes of an org
+	notes, err = SearchContactNotes(ctx, db, Org1, NilContactID, "REFUND", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*ContactNote{note3, note1}, notes)
+
+	notes, err = SearchContactNotes(ctx, db, Org1, NilContactID, "refund", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []*ContactNote{note3}, notes)
+
+	notes, err = SearchContactNotes(ctx, db, Org1, NilContactID, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*ContactNote{note3, note2, note1}, notes)
+}
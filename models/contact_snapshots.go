@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const contactSnapshotKey = "contact_snapshot:%d"
+
+// LoadCachedContact loads the contact with the passed in id, using a snapshot cached in redis by a load in the last
+// ttl if the contact's modified_on hasn't changed since, which saves a full load for bursts of activity on the same
+// contact. Returns nil if the contact doesn't exist or has been deleted. Snapshots are only cached if ttl is positive.
+func LoadCachedContact(ctx context.Context, db *sqlx.DB, rp *redis.Pool, org *OrgAssets, id ContactID, ttl time.Duration) (*Contact, error) {
+	if ttl <= 0 {
+		return loadContact(ctx, db, org, id)
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	key := fmt.Sprintf(contactSnapshotKey, id)
+
+	cached, err := redis.Bytes(rc.Do("get", key))
+	if err != nil && err != redis.ErrNil {
+		logrus.WithError(err).WithField("contact_id", id).Error("error reading contact snapshot, loading contact")
+		return loadContact(ctx, db, org, id)
+	}
+
+	if cached != nil {
+		e := &contactEnvelope{}
+		if err := json.Unmarshal(cached, e); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling contact snapshot")
+		}
+
+		// checking modified_on is much cheaper than loading the contact with its groups and URNs
+		var modifiedOn time.Time
+		err := db.GetContext(ctx, &modifiedOn, `SELECT modified_on FROM contacts_contact WHERE id = $1 AND is_active = TRUE`, id)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error checking modified_on of contact")
+		}
+
+		if modifiedOn.Equal(e.ModifiedOn) {
+			return newContactFromEnvelope(org, e), nil
+		}
+	}
+
+	envelopes, err := loadContactEnvelopes(ctx, db, []ContactID{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(envelopes) == 0 {
+		return nil, nil
+	}
+
+	snapshot, err := json.Marshal(envelopes[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling contact snapshot")
+	}
+
+	// the contact has been loaded at this point so failing to cache it is logged but not returned
+	_, err = rc.Do("set", key, snapshot, "EX", int(ttl/time.Second))
+	if err != nil {
+		logrus.WithError(err).WithField("contact_id", id).Error("error caching contact snapshot")
+	}
+
+	return newContactFromEnvelope(org, envelopes[0]), nil
+}
+
+// ClearContactSnapshots clears any cached snapshots of the passed in contacts
+func ClearContactSnapshots(rc redis.Conn, ids []ContactID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf(contactSnapshotKey, id)
+	}
+
+	_, err := rc.Do("del", keys...)
+	return err
+}
+
+// loads a single contact, returning nil if it doesn't exist
+func loadContact(ctx context.Context, db *sqlx.DB, org *OrgAssets, id ContactID) (*Contact, error) {
+	contacts, err := LoadContacts(ctx, db, org, []ContactID{id})
+	if err != nil || len(contacts) == 0 {
+		return nil, err
+	}
+	return contacts[0], nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCachedContact(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	org, err := GetOrgAssets(ctx, db, Org1)
+	require.NoError(t, err)
+
+	key := fmt.Sprintf(contactSnapshotKey, CathyID)
+
+	// without a ttl nothing is cached
+	contact, err := LoadCachedContact(ctx, db, rp, org, CathyID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Cathy", contact.Name())
+	exists, _ := redis.Bool(rc.Do("exists", key))
+	assert.False(t, exists)
+
+	// first load caches a snapshot
+	contact, err = LoadCachedContact(ctx, db, rp, org, CathyID, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "Cathy", contact.Name())
+	assert.Equal(t, 1, len(contact.URNs()))
+	exists, _ = redis.Bool(rc.Do("exists", key))
+	assert.True(t, exists)
+
+	// change the name without touching modified_on, next load comes from the snapshot
+	db.MustExec(`UPDATE contacts_contact SET name = 'Catherine' WHERE id = $1`, CathyID)
+
+	cached, err := LoadCachedContact(ctx, db, rp, org, CathyID, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "Cathy", cached.Name())
+	assert.Equal(t, contact.UUID(), cached.UUID())
+	assert.Equal(t, contact.URNs(), cached.URNs())
+	assert.Equal(t, len(contact.Groups()), len(cached.Groups()))
+	assert.Equal(t, contact.Fields(), cached.Fields())
+	assert.True(t, contact.ModifiedOn().Equal(cached.ModifiedOn()))
+
+	// once modified_on changes the snapshot is stale
+	db.MustExec(`UPDATE contacts_contact SET modified_on = NOW() WHERE id = $1`, CathyID)
+
+	contact, err = LoadCachedContact(ctx, db, rp, org, CathyID, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "Catherine", contact.Name())
+
+	// clearing snapshots removes them
+	err = ClearContactSnapshots(rc, []ContactID{CathyID, BobID})
+	require.NoError(t, err)
+	exists, _ = redis.Bool(rc.Do("exists", key))
+	assert.False(t, exists)
+
+	// deleted contacts aren't returned, even with a snapshot
+	LoadCachedContact(ctx, db, rp, org, BobID, time.Minute)
+	db.MustExec(`UPDATE contacts_contact SET is_active = FALSE WHERE id = $1`, BobID)
+
+	contact, err = LoadCachedContact(ctx, db, rp, org, BobID, time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, contact)
+}
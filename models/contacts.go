@@ -45,79 +45,106 @@ const (
 func LoadContacts(ctx context.Context, db Queryer, org *OrgAssets, ids []ContactID) ([]*Contact, error) {
 	start := time.Now()
 
+	envelopes, err := loadContactEnvelopes(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := make([]*Contact, 0, len(envelopes))
+	for _, e := range envelopes {
+		contacts = append(contacts, newContactFromEnvelope(org, e))
+	}
+
+	logrus.WithField("elapsed", time.Since(start)).WithField("count", len(contacts)).Debug("loaded contacts")
+
+	return contacts, nil
+}
+
+// loads the envelopes of the contacts with the passed in ids
+func loadContactEnvelopes(ctx context.Context, db Queryer, ids []ContactID) ([]*contactEnvelope, error) {
 	rows, err := db.QueryxContext(ctx, selectContactSQL, pq.Array(ids))
 	if err != nil {
 		return nil, errors.Wrap(err, "error selecting contacts")
 	}
 	defer rows.Close()
 
-	contacts := make([]*Contact, 0, len(ids))
+	envelopes := make([]*contactEnvelope, 0, len(ids))
 	for rows.Next() {
 		e := &contactEnvelope{}
 		err := readJSONRow(rows, e)
 		if err != nil {
 			return nil, errors.Wrap(err, "error scanning contact json")
 		}
+		envelopes = append(envelopes, e)
+	}
 
-		contact := &Contact{
-			id:         ContactID(e.ID),
-			uuid:       e.UUID,
-			name:       e.Name,
-			language:   e.Language,
-			isStopped:  e.IsStopped,
-			isBlocked:  e.IsBlocked,
-			modifiedOn: e.ModifiedOn,
-			createdOn:  e.CreatedOn,
-		}
+	return envelopes, nil
+}
 
-		// load our real groups
-		groups := make([]*Group, 0, len(e.GroupIDs))
-		for _, g := range e.GroupIDs {
-			group := org.GroupByID(g)
-			if group != nil {
-				groups = append(groups, group)
-			}
+// creates a new contact from the passed in envelope, resolving groups, fields and URNs against the org's assets
+func newContactFromEnvelope(org *OrgAssets, e *contactEnvelope) *Contact {
+	contact := &Contact{
+		id:         ContactID(e.ID),
+		uuid:       e.UUID,
+		name:       e.Name,
+		language:   e.Language,
+		isStopped:  e.IsStopped,
+		isBlocked:  e.IsBlocked,
+		modifiedOn: e.ModifiedOn,
+		createdOn:  e.CreatedOn,
+	}
+
+	// load our real groups
+	groups := make([]*Group, 0, len(e.GroupIDs))
+	for _, g := range e.GroupIDs {
+		group := org.GroupByID(g)
+		if group != nil {
+			groups = append(groups, group)
 		}
-		contact.groups = groups
-
-		// create our map of field values filtered by what we know exists
-		fields := make(map[string]*flows.Value)
-		orgFields, _ := org.Fields()
-		for _, f := range orgFields {
-			field := f.(*Field)
-			cv, found := e.Fields[field.UUID()]
-			if found {
-				value := flows.NewValue(
-					cv.Text,
-					cv.Datetime,
-					cv.Number,
-					cv.State,
-					cv.District,
-					cv.Ward,
-				)
-				fields[field.Key()] = value
-			}
-		}
-		contact.fields = fields
+	}
+	contact.groups = groups
 
-		// finally build up our URN objects
-		contactURNs := make([]urns.URN, 0, len(e.URNs))
-		for _, u := range e.URNs {
-			urn, err := u.AsURN(org)
-			if err != nil {
-				logrus.WithField("urn", u).WithField("org_id", org.OrgID()).WithField("contact_id", contact.id).Warn("invalid URN, ignoring")
+	// create our map of field values filtered by what we know exists
+	fields := make(map[string]*flows.Value)
+	orgFields, _ := org.Fields()
+	for _, f := range orgFields {
+		field := f.(*Field)
+		cv, found := e.Fields[field.UUID()]
+		if found && cv.Encrypted != "" {
+			decrypted := &fieldValueEnvelope{}
+			if err := org.Org().DecryptFieldValue(cv.Encrypted, decrypted); err != nil {
+				logrus.WithError(err).WithField("field_key", field.Key()).WithField("contact_id", e.ID).Error("unable to decrypt field value, ignoring")
 				continue
 			}
-			contactURNs = append(contactURNs, urn)
+			cv = decrypted
+		}
+		if found {
+			value := flows.NewValue(
+				cv.Text,
+				cv.Datetime,
+				cv.Number,
+				cv.State,
+				cv.District,
+				cv.Ward,
+			)
+			fields[field.Key()] = value
 		}
-		contact.urns = contactURNs
-
-		contacts = append(contacts, contact)
 	}
+	contact.fields = fields
 
-	logrus.WithField("elapsed", time.Since(start)).WithField("count", len(contacts)).Debug("loaded contacts")
+	// finally build up our URN objects
+	contactURNs := make([]urns.URN, 0, len(e.URNs))
+	for _, u := range e.URNs {
+		urn, err := u.AsURN(org)
+		if err != nil {
+			logrus.WithField("urn", u).WithField("org_id", org.OrgID()).WithField("contact_id", contact.id).Warn("invalid URN, ignoring")
+			continue
+		}
+		contactURNs = append(contactURNs, urn)
+	}
+	contact.urns = contactURNs
 
-	return contacts, nil
+	return contact
 }
 
 // ContactIDsFromReferences queries the contacts for the passed in org, returning the contact ids for the references
@@ -149,6 +176,34 @@ func ContactIDsFromReferences(ctx context.Context, tx Queryer, org *OrgAssets, r
 	return ids, nil
 }
 
+// FilterContactIDsByOrg returns those of the passed in contact ids which are active contacts in the passed in org, in
+// the order they were passed in
+func FilterContactIDsByOrg(ctx context.Context, tx Queryer, orgID OrgID, contactIDs []ContactID) ([]ContactID, error) {
+	ids := make([]ContactID, 0, len(contactIDs))
+	if len(contactIDs) == 0 {
+		return ids, nil
+	}
+
+	rows, err := tx.QueryxContext(ctx,
+		`SELECT c.id FROM UNNEST($2::int[]) WITH ORDINALITY AS r(id, ord) JOIN contacts_contact c ON c.id = r.id WHERE c.org_id = $1 AND c.is_active = TRUE ORDER BY r.ord`,
+		orgID, pq.Array(contactIDs),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting contact ids for org")
+	}
+	defer rows.Close()
+
+	var id ContactID
+	for rows.Next() {
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error scanning contact id")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // BuildFieldResolver builds a field resolver function for the passed in Org
 func BuildFieldResolver(org *OrgAssets) contactql.FieldResolverFunc {
 	return func(key string) assets.Field {
@@ -389,6 +444,9 @@ type fieldValueEnvelope struct {
 	State    utils.LocationPath `json:"state,omitempty"`
 	District utils.LocationPath `json:"district,omitempty"`
 	Ward     utils.LocationPath `json:"ward,omitempty"`
+
+	// set instead of the above if the value is encrypted
+	Encrypted string `json:"encrypted,omitempty"`
 }
 
 type ContactURN struct {
@@ -747,7 +805,9 @@ func URNForID(ctx context.Context, tx Queryer, org *OrgAssets, urnID URNID) (urn
 }
 
 // CalculateDynamicGroups recalculates all the dynamic groups for the passed in contact, recalculating
-// campaigns as necessary based on those group changes.
+// campaigns as necessary based on those group changes. As all unfired campaign events for the contact are
+// cleared, the fires for every campaign the contact is now part of are recreated, so that contacts who are
+// unstopped or re-enter a campaign group get their future events back.
 func CalculateDynamicGroups(ctx context.Context, tx Queryer, org *OrgAssets, contact *flows.Contact) error {
 	orgGroups, _ := org.Groups()
 	orgFields, _ := org.Fields()
@@ -768,11 +828,6 @@ func CalculateDynamicGroups(ctx context.Context, tx Queryer, org *OrgAssets, con
 			ContactID: ContactID(contact.ID()),
 			GroupID:   group.ID(),
 		})
-
-		// add in any campaigns we may qualify for
-		for _, c := range org.CampaignByGroupID(group.ID()) {
-			campaigns[c.ID()] = c
-		}
 	}
 	err := AddContactsToGroups(ctx, tx, groupAdds)
 	if err != nil {
@@ -795,6 +850,17 @@ func CalculateDynamicGroups(ctx context.Context, tx Queryer, org *OrgAssets, con
 		return errors.Wrapf(err, "error removing contact from group")
 	}
 
+	// add in the campaigns of every group we are now part of
+	for _, g := range contact.Groups().All() {
+		group := org.GroupByUUID(g.UUID())
+		if group == nil {
+			continue
+		}
+		for _, c := range org.CampaignByGroupID(group.ID()) {
+			campaigns[c.ID()] = c
+		}
+	}
+
 	// clear any unfired campaign events for this contact
 	err = DeleteUnfiredContactEvents(ctx, tx, ContactID(contact.ID()))
 	if err != nil {
@@ -292,6 +292,24 @@ func TestContactsFromURN(t *testing.T) {
 	}
 }
 
+func TestFilterContactIDsByOrg(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	db.MustExec(`UPDATE contacts_contact SET is_active = FALSE WHERE id = $1`, AlexandriaID)
+
+	ids, err := FilterContactIDsByOrg(ctx, db, Org1, []ContactID{GeorgeID, Org2FredID, AlexandriaID, CathyID, ContactID(123456789)})
+	assert.NoError(t, err)
+	assert.Equal(t, []ContactID{GeorgeID, CathyID}, ids)
+
+	ids, err = FilterContactIDsByOrg(ctx, db, Org2, []ContactID{GeorgeID, Org2FredID})
+	assert.NoError(t, err)
+	assert.Equal(t, []ContactID{Org2FredID}, ids)
+
+	ids, err = FilterContactIDsByOrg(ctx, db, Org1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ContactID{}, ids)
+}
+
 func TestCreateContact(t *testing.T) {
 	ctx := testsuite.CTX()
 	db := testsuite.DB()
@@ -334,3 +352,29 @@ func TestCreateContact(t *testing.T) {
 	// verify she's stopped
 	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND is_stopped = TRUE AND is_active = TRUE and is_blocked = FALSE`, []interface{}{CathyID}, 1)
 }
+
+func TestCalculateDynamicGroupsRecreatesFires(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	// put Bob in the doctors group with a joined date in the future, but with no fires, like after being unstopped
+	db.MustExec(`INSERT INTO contacts_contactgroup_contacts(contactgroup_id, contact_id) VALUES($1, $2)`, DoctorsGroupID, BobID)
+	db.MustExec(`UPDATE contacts_contact c SET fields = c.fields || jsonb_build_object(f.uuid::text, jsonb_build_object('text', '2029-09-15T12:00:00+00:00', 'datetime', '2029-09-15T12:00:00+00:00'))
+	               FROM contacts_contactfield f WHERE f.key = 'joined' AND f.org_id = $1 AND c.id = $2`, Org1, BobID)
+	db.MustExec(`DELETE FROM campaigns_eventfire WHERE contact_id = $1`, BobID)
+
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	assert.NoError(t, err)
+	session, err := NewSessionAssets(org)
+	assert.NoError(t, err)
+
+	contacts, err := LoadContacts(ctx, db, org, []ContactID{BobID})
+	assert.NoError(t, err)
+	contact, err := contacts[0].FlowContact(org, session)
+	assert.NoError(t, err)
+
+	err = CalculateDynamicGroups(ctx, db, org, contact)
+	assert.NoError(t, err)
+
+	// fires for the campaign of the group Bob was already in are recreated
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1 AND fired IS NULL`, []interface{}{BobID}, 3)
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the org config key for keeping an engagement score for each contact in a number field, so that it can be used in
+// contact queries and flows like any other field. Scores are recalculated from the activity of the last window_days
+// days whenever a contact responds or a run of theirs ends, e.g.
+//
+//   "engagement": {"field": "engagement", "window_days": 30}
+//
+const configEngagement = "engagement"
+
+const (
+	// the default number of days of activity scores are calculated from
+	defaultEngagementWindowDays = 30
+
+	// the number of responses in a window which counts as fully engaged
+	engagementTargetResponses = 10
+
+	// how much each part contributes to a score out of 100
+	engagementRecencyWeight    = 40
+	engagementFrequencyWeight  = 30
+	engagementCompletionWeight = 30
+)
+
+// Engagement is how an org keeps engagement scores for its contacts
+type Engagement struct {
+	FieldKey   string
+	WindowDays int
+}
+
+// Engagement returns how this org keeps engagement scores, or nil if it doesn't
+func (o *Org) Engagement() *Engagement {
+	engagement, _ := o.config[configEngagement].(map[string]interface{})
+	fieldKey, _ := engagement["field"].(string)
+	if fieldKey == "" {
+		return nil
+	}
+
+	windowDays := defaultEngagementWindowDays
+	if days, isNumber := engagement["window_days"].(float64); isNumber && days >= 1 {
+		windowDays = int(days)
+	}
+
+	return &Engagement{FieldKey: fieldKey, WindowDays: windowDays}
+}
+
+// ContactActivity is the activity of a contact in an engagement window
+type ContactActivity struct {
+	ContactID     ContactID  `db:"contact_id"`
+	LastResponse  *time.Time `db:"last_response"`
+	Responses     int        `db:"responses"`
+	Runs          int        `db:"runs"`
+	CompletedRuns int        `db:"completed_runs"`
+}
+
+// Score returns the engagement score out of 100 for the passed in activity. Recency halves with every quarter of the
+// window since the last response, frequency is the number of responses up to a target, and completion is the
+// fraction of runs which were completed.
+func (e *Engagement) Score(a *ContactActivity, now time.Time) int {
+	window := time.Duration(e.WindowDays) * 24 * time.Hour
+
+	recency := 0.0
+	if a.LastResponse != nil {
+		since := now.Sub(*a.LastResponse)
+		if since < 0 {
+			since = 0
+		}
+		recency = math.Pow(0.5, float64(since)/float64(window/4))
+	}
+
+	frequency := math.Min(float64(a.Responses)/engagementTargetResponses, 1)
+
+	completion := 0.0
+	if a.Runs > 0 {
+		completion = float64(a.CompletedRuns) / float64(a.Runs)
+	}
+
+	return int(math.Round(engagementRecencyWeight*recency + engagementFrequencyWeight*frequency + engagementCompletionWeight*completion))
+}
+
+// trackEngagement marks the contact of the passed in run as needing their engagement score recalculated if they've
+// responded or the run has ended since it was last written
+func (s *Session) trackEngagement(org *OrgAssets, fr flows.FlowRun) {
+	engagement := org.Org().Engagement()
+	if engagement == nil || org.FieldByKey(engagement.FieldKey) == nil {
+		return
+	}
+
+	since := s.seenRuns[fr.UUID()]
+	changed := fr.ExitedOn() != nil && fr.ExitedOn().After(since)
+
+	for _, e := range fr.Events() {
+		if e.Type() == events.TypeMsgReceived && e.CreatedOn().After(since) {
+			changed = true
+		}
+	}
+
+	if changed {
+		s.AddPreCommitEvent(engagementHook, s.ContactID())
+	}
+}
+
+// EngagementHook is our hook for recalculating the engagement scores of contacts
+type EngagementHook struct{}
+
+var engagementHook = &EngagementHook{}
+
+// Apply recalculates the engagement score of each contact, which is done before commit so that it includes the runs
+// and messages of the sessions being written
+func (h *EngagementHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, sessions map[*Session][]interface{}) error {
+	engagement := org.Org().Engagement()
+	if engagement == nil {
+		return nil
+	}
+	field := org.FieldByKey(engagement.FieldKey)
+	if field == nil {
+		return nil
+	}
+
+	contactIDs := make([]ContactID, 0, len(sessions))
+	for s := range sessions {
+		contactIDs = append(contactIDs, s.ContactID())
+	}
+
+	return UpdateEngagementScores(ctx, tx, org, engagement, field, contactIDs, time.Now())
+}
+
+const selectContactActivitySQL = `
+SELECT
+	c.id AS contact_id,
+	(SELECT max(m.created_on) FROM msgs_msg m WHERE m.contact_id = c.id AND m.direction = 'I' AND m.created_on > $2) AS last_response,
+	(SELECT count(*) FROM msgs_msg m WHERE m.contact_id = c.id AND m.direction = 'I' AND m.created_on > $2) AS responses,
+	(SELECT count(*) FROM flows_flowrun r WHERE r.contact_id = c.id AND r.created_on > $2 AND r.is_active = FALSE) AS runs,
+	(SELECT count(*) FROM flows_flowrun r WHERE r.contact_id = c.id AND r.created_on > $2 AND r.is_active = FALSE AND r.exit_type = 'C') AS completed_runs
+FROM
+	contacts_contact c
+WHERE
+	c.id = ANY($1)
+ORDER BY
+	c.id
+`
+
+type engagementUpdate struct {
+	ContactID ContactID `db:"contact_id"`
+	Updates   string    `db:"updates"`
+}
+
+const updateEngagementScoresSQL = `
+UPDATE
+	contacts_contact c
+SET
+	fields = COALESCE(fields,'{}'::jsonb) || r.updates::jsonb,
+	modified_on = NOW()
+FROM (
+	VALUES(:contact_id, :updates)
+) AS
+	r(contact_id, updates)
+WHERE
+	c.id = r.contact_id::int
+`
+
+// UpdateEngagementScores recalculates the engagement scores of the passed in contacts from their activity in the
+// window before the passed in time, writing them to the passed in field
+func UpdateEngagementScores(ctx context.Context, tx Queryer, org *OrgAssets, engagement *Engagement, field *Field, contactIDs []ContactID, now time.Time) error {
+	windowStart := now.Add(-time.Duration(engagement.WindowDays) * 24 * time.Hour)
+
+	rows, err := tx.QueryxContext(ctx, selectContactActivitySQL, pq.Array(contactIDs), windowStart)
+	if err != nil {
+		return errors.Wrapf(err, "error selecting contact activity")
+	}
+	defer rows.Close()
+
+	activities := make([]*ContactActivity, 0, len(contactIDs))
+	for rows.Next() {
+		a := &ContactActivity{}
+		if err := rows.StructScan(a); err != nil {
+			return errors.Wrapf(err, "error scanning contact activity")
+		}
+		activities = append(activities, a)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrapf(err, "error selecting contact activity")
+	}
+	rows.Close()
+
+	updates := make([]interface{}, 0, len(activities))
+	for _, a := range activities {
+		score := engagement.Score(a, now)
+
+		value, err := json.Marshal(map[string]interface{}{
+			string(field.UUID()): map[string]interface{}{"text": strconv.Itoa(score), "number": score},
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error marshalling engagement score")
+		}
+
+		updates = append(updates, &engagementUpdate{ContactID: a.ContactID, Updates: string(value)})
+	}
+
+	logrus.WithField("org_id", org.OrgID()).WithField("contacts", len(updates)).Debug("updating engagement scores")
+
+	return BulkSQL(ctx, "updating engagement scores", tx, updateEngagementScoresSQL, updates)
+}
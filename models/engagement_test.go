@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngagement(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	org, err := loadOrg(ctx, db, Org1)
+	require.NoError(t, err)
+	assert.Nil(t, org.Engagement())
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"engagement": {"field": "age", "window_days": 20}}' WHERE id = $1`, Org1)
+
+	org, err = loadOrg(ctx, db, Org1)
+	require.NoError(t, err)
+
+	engagement := org.Engagement()
+	assert.Equal(t, &Engagement{FieldKey: "age", WindowDays: 20}, engagement)
+
+	now := time.Date(2020, 4, 15, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	tcs := []struct {
+		activity *ContactActivity
+		score    int
+	}{
+		{&ContactActivity{}, 0},
+		{&ContactActivity{LastResponse: ago(0), Responses: 10, Runs: 2, CompletedRuns: 2}, 100},
+		{&ContactActivity{LastResponse: ago(0), Responses: 1}, 43},
+		{&ContactActivity{LastResponse: ago(time.Hour * 24 * 5), Responses: 1}, 23},   // a quarter of the window halves recency
+		{&ContactActivity{LastResponse: ago(time.Hour * 24 * 20), Responses: 20}, 33}, // responses over the target count as the target
+		{&ContactActivity{Runs: 4, CompletedRuns: 1}, 8},
+	}
+
+	for i, tc := range tcs {
+		assert.Equal(t, tc.score, engagement.Score(tc.activity, now), "score mismatch in test case %d", i)
+	}
+
+	// scores are written to the configured field
+	oa, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+	field := oa.FieldByKey("age")
+	require.NotNil(t, field)
+
+	err = UpdateEngagementScores(ctx, db, oa, engagement, field, []ContactID{CathyID, BobID}, time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contact WHERE id = ANY(ARRAY[$1, $2]::int[]) AND fields->$3->>'number' = '0' AND fields->$3->>'text' = '0'`,
+		[]interface{}{CathyID, BobID, AgeFieldUUID}, 2)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{}' WHERE id = $1`, Org1)
+}
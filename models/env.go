@@ -2,18 +2,20 @@ package models
 
 import (
 	"context"
+	"crypto/cipher"
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/services/airtime/dtone"
-	"github.com/nyaruka/goflow/services/email/smtp"
 	"github.com/nyaruka/goflow/utils/httpx"
 	"github.com/nyaruka/mailroom/config"
 	"github.com/nyaruka/mailroom/goflow"
 
+	"github.com/Masterminds/semver"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -36,6 +38,12 @@ func init() {
 			return orgFromSession(session).AirtimeService(airtimeHTTPClient, airtimeHTTPRetries)
 		},
 	)
+
+	goflow.RegisterPluginSelector(
+		func(session flows.Session, kind goflow.ServiceKind) string {
+			return orgFromSession(session).ServicePlugin(kind)
+		},
+	)
 }
 
 type OrgID int
@@ -44,6 +52,8 @@ const (
 	NilOrgID = OrgID(0)
 
 	configSMTPServer    = "smtp_server"
+	configPlugins       = "service_plugins"
+	configSpecVersion   = "flow_spec_version"
 	configDTOneLogin    = "TRANSFERTO_ACCOUNT_LOGIN"
 	configDTOneToken    = "TRANSFERTO_AIRTIME_API_TOKEN"
 	configDTOnecurrency = "TRANSFERTO_ACCOUNT_CURRENCY"
@@ -52,13 +62,25 @@ const (
 // Org is mailroom's type for RapidPro orgs. It also implements the envs.Environment interface for GoFlow
 type Org struct {
 	id     OrgID
+	name   string
+	brand  string
 	env    envs.Environment
 	config map[string]interface{}
+
+	// cipher for encrypted field values, loaded the first time it's needed and retried if that fails
+	fieldCipherLock sync.Mutex
+	fieldCipherAEAD cipher.AEAD
 }
 
 // ID returns the id of the org
 func (o *Org) ID() OrgID { return o.id }
 
+// Name returns the name of the org
+func (o *Org) Name() string { return o.name }
+
+// Brand returns the brand the org belongs to
+func (o *Org) Brand() string { return o.brand }
+
 // DateFormat returns the date format for this org
 func (o *Org) DateFormat() envs.DateFormat { return o.env.DateFormat() }
 
@@ -116,14 +138,46 @@ func (o *Org) ConfigValue(key string, def string) string {
 	return strVal
 }
 
-// EmailService returns the email service for this org
-func (o *Org) EmailService(httpClient *http.Client) (flows.EmailService, error) {
-	connectionURL := o.ConfigValue(configSMTPServer, config.Mailroom.SMTPServer)
+// ServicePlugin returns the name of the plugin which should provide the passed in kind of engine service
+// for this org, or empty string if the default service should be used. Plugins are selected in the org config, e.g.
+//
+//   "service_plugins": {"airtime": "acme_topups", "webhook": "signed"}
+//
+func (o *Org) ServicePlugin(kind goflow.ServiceKind) string {
+	plugins, isMap := o.config[configPlugins].(map[string]interface{})
+	if !isMap {
+		return ""
+	}
+
+	name, _ := plugins[string(kind)].(string)
+	return name
+}
+
+// FlowSpecVersion returns the flow spec version this org has pinned flow migrations to, or nil if it hasn't pinned
+// a version. This lets an org stay on an older version while it transitions, e.g.
+//
+//   "flow_spec_version": "13.0.0"
+//
+func (o *Org) FlowSpecVersion() *semver.Version {
+	version := o.ConfigValue(configSpecVersion, "")
+	if version == "" {
+		return nil
+	}
+
+	pinned, err := semver.NewVersion(version)
+	if err != nil {
+		logrus.WithField("org_id", o.id).WithField("version", version).Error("invalid pinned flow spec version")
+		return nil
+	}
+	return pinned
+}
 
-	if connectionURL == "" {
-		return nil, errors.New("missing SMTP configuration")
+// EmailService returns the email service for this org, which queues emails to be sent through its SMTP server
+func (o *Org) EmailService(httpClient *http.Client) (flows.EmailService, error) {
+	if _, err := o.SMTPConfig(); err != nil {
+		return nil, err
 	}
-	return smtp.NewServiceFromURL(connectionURL)
+	return &queuedEmailService{}, nil
 }
 
 // AirtimeService returns the airtime service for this org if one is configured
@@ -155,33 +209,48 @@ func loadOrg(ctx context.Context, db sqlx.Queryer, orgID OrgID) (*Org, error) {
 	}
 	defer rows.Close()
 	if !rows.Next() {
-		return nil, errors.Errorf("no org with id: %d", orgID)
+		return nil, errors.Wrapf(ErrNotFound, "no org with id: %d", orgID)
 	}
 
-	err = rows.Scan(&org.id, &orgConfig, &orgJSON)
+	err = rows.Scan(&org.id, &org.name, &org.brand, &orgConfig, &orgJSON)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error scanning org: %d", orgID)
 	}
 
+	if err := readOrgEnvironment(org, orgJSON, orgConfig); err != nil {
+		return nil, err
+	}
+
+	logrus.WithField("elapsed", time.Since(start)).WithField("org_id", orgID).Debug("loaded org environment")
+
+	return org, nil
+}
+
+// reads the environment and config of the passed in org from JSON
+func readOrgEnvironment(org *Org, orgJSON, orgConfig json.RawMessage) error {
+	var err error
 	org.env, err = envs.ReadEnvironment(orgJSON)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error unmarshalling org json: %s", orgJSON)
+		return errors.Wrapf(err, "error unmarshalling org json: %s", orgJSON)
 	}
 
 	org.config = make(map[string]interface{})
-	err = json.Unmarshal(orgConfig, &org.config)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error unmarshalling org config: %s", orgConfig)
+	if orgConfig != nil {
+		err = json.Unmarshal(orgConfig, &org.config)
+		if err != nil {
+			return errors.Wrapf(err, "error unmarshalling org config: %s", orgConfig)
+		}
 	}
 
-	logrus.WithField("elapsed", time.Since(start)).WithField("org_id", orgID).Debug("loaded org environment")
-
-	return org, nil
+	setPIIRedaction(org.id, org.RedactsPII())
+	return nil
 }
 
 const selectOrgEnvironment = `
-SELECT id, config, ROW_TO_JSON(o) FROM (SELECT
+SELECT id, name, brand, config, ROW_TO_JSON(o) FROM (SELECT
 	id,
+	name,
+	brand,
 	COALESCE(o.config::json,'{}'::json) as config,
 	(SELECT CASE date_format
 		WHEN 'D' THEN 'DD-MM-YYYY'
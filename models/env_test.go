@@ -5,8 +5,10 @@ import (
 	"time"
 
 	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/testsuite"
 
+	"github.com/Masterminds/semver"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,3 +51,51 @@ func TestOrgs(t *testing.T) {
 	_, err = loadOrg(ctx, tx, 99)
 	assert.Error(t, err)
 }
+
+func TestOrgServicePlugins(t *testing.T) {
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	assert.NoError(t, err)
+	defer tx.Rollback()
+
+	tx.MustExec(`UPDATE orgs_org SET config = '{"service_plugins": {"airtime": "acme", "email": 12}}' WHERE id = $1`, Org1)
+
+	org, err := loadOrg(ctx, tx, Org1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "acme", org.ServicePlugin(goflow.AirtimeService))
+	assert.Equal(t, "", org.ServicePlugin(goflow.EmailService)) // not a string
+	assert.Equal(t, "", org.ServicePlugin(goflow.WebhookService))
+
+	org, err = loadOrg(ctx, tx, Org2)
+	assert.NoError(t, err)
+	assert.Equal(t, "", org.ServicePlugin(goflow.AirtimeService))
+}
+
+func TestOrgFlowSpecVersion(t *testing.T) {
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	assert.NoError(t, err)
+	defer tx.Rollback()
+
+	tx.MustExec(`UPDATE orgs_org SET config = '{"flow_spec_version": "13.0.0"}' WHERE id = $1`, Org1)
+	tx.MustExec(`UPDATE orgs_org SET config = '{"flow_spec_version": "xyz"}' WHERE id = $1`, Org2)
+
+	org, err := loadOrg(ctx, tx, Org1)
+	assert.NoError(t, err)
+	assert.Equal(t, semver.MustParse("13.0.0"), org.FlowSpecVersion())
+
+	org, err = loadOrg(ctx, tx, Org2)
+	assert.NoError(t, err)
+	assert.Nil(t, org.FlowSpecVersion())
+
+	tx.MustExec(`UPDATE orgs_org SET config = '{}' WHERE id = $1`, Org1)
+
+	org, err = loadOrg(ctx, tx, Org1)
+	assert.NoError(t, err)
+	assert.Nil(t, org.FlowSpecVersion())
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the org config key for the event types whose handlers are skipped for the org, e.g.
+//
+//   "disabled_events": ["airtime_transferred", "classifier_called"]
+//
+const configDisabledEvents = "disabled_events"
+
+// EventMiddleware wraps an event handler to add behavior around the handling of events of every type
+type EventMiddleware func(EventHandler) EventHandler
+
+// RegisterEventMiddleware adds the passed in middleware to the chain which wraps all event handlers, including pre
+// write handlers. Middleware registered first is outermost, i.e. sees each event first.
+func RegisterEventMiddleware(middleware EventMiddleware) {
+	eventMiddleware = append(eventMiddleware, middleware)
+}
+
+// our chain of event middleware
+var eventMiddleware []EventMiddleware
+
+// wraps the passed in handler with the passed in middleware, the first being outermost
+func wrapEventHandler(handler EventHandler, middleware []EventMiddleware) EventHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// RecoverEvents is middleware which turns panics in handlers into errors, so that a bad event fails only the
+// session it belongs to
+func RecoverEvents(next EventHandler) EventHandler {
+	return func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, session *Session, e flows.Event) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = errors.Errorf("panic handling %s event: %v", e.Type(), r)
+			}
+		}()
+
+		return next(ctx, tx, rp, org, session, e)
+	}
+}
+
+// TimeEvents returns middleware which logs any handler that takes longer than the passed in threshold
+func TimeEvents(threshold time.Duration) EventMiddleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, session *Session, e flows.Event) error {
+			start := time.Now()
+			err := next(ctx, tx, rp, org, session, e)
+
+			if elapsed := time.Since(start); elapsed > threshold {
+				logrus.WithField("org_id", org.OrgID()).WithField("event_type", e.Type()).WithField("elapsed", elapsed).Warn("slow event handler")
+			}
+			return err
+		}
+	}
+}
+
+// FilterEvents returns middleware which only passes on events for which the passed in function returns true, other
+// events are skipped without error
+func FilterEvents(include func(*OrgAssets, *Session, flows.Event) bool) EventMiddleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, session *Session, e flows.Event) error {
+			if !include(org, session, e) {
+				return nil
+			}
+			return next(ctx, tx, rp, org, session, e)
+		}
+	}
+}
+
+// GateOrgEvents is middleware which skips events whose type the org has disabled
+var GateOrgEvents = FilterEvents(func(org *OrgAssets, session *Session, e flows.Event) bool {
+	return !org.Org().EventDisabled(e.Type())
+})
+
+// EventDisabled returns whether this org has disabled handling of events of the passed in type
+func (o *Org) EventDisabled(eventType string) bool {
+	disabled, _ := o.config[configDisabledEvents].([]interface{})
+	for _, t := range disabled {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventMiddleware(t *testing.T) {
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	org, err := GetOrgAssets(ctx, db, Org1)
+	require.NoError(t, err)
+
+	event := events.NewIVRCreated(flows.NewMsgOut(urns.URN("tel:+250788123123"), nil, "hello", nil, nil, nil, flows.NilMsgTopic))
+
+	// middleware which records the order it was called in
+	calls := make([]string, 0)
+	record := func(name string) EventMiddleware {
+		return func(next EventHandler) EventHandler {
+			return func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, session *Session, e flows.Event) error {
+				calls = append(calls, name)
+				return next(ctx, tx, rp, org, session, e)
+			}
+		}
+	}
+	handler := func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, session *Session, e flows.Event) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+
+	err = wrapEventHandler(handler, []EventMiddleware{record("first"), record("second")})(ctx, tx, nil, org, nil, event)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+
+	// filtered events never reach the handler
+	calls = make([]string, 0)
+	skipAll := FilterEvents(func(*OrgAssets, *Session, flows.Event) bool { return false })
+	err = wrapEventHandler(handler, []EventMiddleware{record("first"), skipAll, record("second")})(ctx, tx, nil, org, nil, event)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first"}, calls)
+
+	// panics become errors
+	panicky := func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, session *Session, e flows.Event) error {
+		panic("boom")
+	}
+	err = wrapEventHandler(panicky, []EventMiddleware{RecoverEvents, TimeEvents(time.Second)})(ctx, tx, nil, org, nil, event)
+	assert.EqualError(t, err, "panic handling ivr_created event: boom")
+
+	// orgs can disable event types
+	assert.False(t, org.Org().EventDisabled(events.TypeIVRCreated))
+
+	tx.MustExec(`UPDATE orgs_org SET config = '{"disabled_events": ["ivr_created"]}' WHERE id = 1`)
+	o, err := loadOrg(ctx, tx, Org1)
+	require.NoError(t, err)
+	assert.True(t, o.EventDisabled(events.TypeIVRCreated))
+	assert.False(t, o.EventDisabled(events.TypeMsgCreated))
+}
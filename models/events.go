@@ -79,6 +79,12 @@ func RegisterEventHook(eventType string, handler EventHandler) {
 	eventHandlers[eventType] = handler
 }
 
+// HasEventHandler returns whether a handler has been registered for the passed in event type
+func HasEventHandler(eventType string) bool {
+	_, found := eventHandlers[eventType]
+	return found
+}
+
 // RegisterPreWriteHook registers the passed in handler as being interested in the passed in type before session and run insertion
 func RegisterPreWriteHook(eventType string, handler EventHandler) {
 	// it's a bug if we try to register more than one handler for a type
@@ -101,7 +107,7 @@ func ApplyEvent(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets
 		return errors.Errorf("unable to find handler for event type: %s", e.Type())
 	}
 
-	return handler(ctx, tx, rp, org, session, e)
+	return wrapEventHandler(handler, eventMiddleware)(ctx, tx, rp, org, session, e)
 }
 
 // ApplyPreWriteEvent applies the passed in event before insertion or update, unlike normal event handlers it is not a requirement
@@ -117,7 +123,7 @@ func ApplyPreWriteEvent(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *O
 		return nil
 	}
 
-	return handler(ctx, tx, rp, org, session, e)
+	return wrapEventHandler(handler, eventMiddleware)(ctx, tx, rp, org, session, e)
 }
 
 // our map of event type to internal handlers
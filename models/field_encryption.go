@@ -0,0 +1,171 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// the org config key for the keys of the contact fields whose values are encrypted, e.g. ["national_id"]
+	configEncryptedFields = "encrypted_fields"
+
+	// the org config key for the org's data key, base64 encoded and itself encrypted with KMS
+	configFieldEncryptionKey = "field_encryption_key"
+)
+
+// KeyDecrypter decrypts the data keys that orgs' field values are encrypted with
+type KeyDecrypter interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+var keyDecrypter KeyDecrypter
+var keyDecrypterLock sync.Mutex
+
+// SetKeyDecrypter sets the decrypter used for org data keys, or nil to use the default which is AWS KMS
+func SetKeyDecrypter(d KeyDecrypter) {
+	keyDecrypterLock.Lock()
+	defer keyDecrypterLock.Unlock()
+
+	keyDecrypter = d
+}
+
+// getKeyDecrypter returns our key decrypter, creating the KMS one if none has been set. Failures to create it aren't
+// remembered so that a later call can succeed once KMS is reachable.
+func getKeyDecrypter() (KeyDecrypter, error) {
+	keyDecrypterLock.Lock()
+	defer keyDecrypterLock.Unlock()
+
+	if keyDecrypter == nil {
+		s, err := session.NewSession(&aws.Config{
+			Region:      aws.String(config.Mailroom.S3Region),
+			Credentials: credentials.NewStaticCredentials(config.Mailroom.AWSAccessKeyID, config.Mailroom.AWSSecretAccessKey, ""),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating KMS session")
+		}
+		keyDecrypter = &kmsDecrypter{client: kms.New(s)}
+	}
+	return keyDecrypter, nil
+}
+
+// kmsDecrypter decrypts keys using AWS KMS
+type kmsDecrypter struct {
+	client *kms.KMS
+}
+
+func (d *kmsDecrypter) Decrypt(ciphertext []byte) ([]byte, error) {
+	out, err := d.client.Decrypt(&kms.DecryptInput{CiphertextBlob: ciphertext})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// encryptedFieldValue is how the value of an encrypted field is stored on a contact, nothing from the value is
+// stored in plain text so it isn't indexed or searchable
+type encryptedFieldValue struct {
+	Encrypted string `json:"encrypted"`
+}
+
+// IsEncryptedField returns whether values of the field with the passed in key are encrypted for this org
+func (o *Org) IsEncryptedField(key string) bool {
+	keys, _ := o.config[configEncryptedFields].([]interface{})
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldCipher returns the cipher for this org's field values, decrypting its data key the first time it's needed.
+// Only a successfully loaded cipher is kept, so errors such as KMS being unreachable are retried on the next call.
+func (o *Org) fieldCipher() (cipher.AEAD, error) {
+	o.fieldCipherLock.Lock()
+	defer o.fieldCipherLock.Unlock()
+
+	if o.fieldCipherAEAD == nil {
+		aead, err := o.loadFieldCipher()
+		if err != nil {
+			return nil, err
+		}
+		o.fieldCipherAEAD = aead
+	}
+	return o.fieldCipherAEAD, nil
+}
+
+func (o *Org) loadFieldCipher() (cipher.AEAD, error) {
+	encryptedKey, err := base64.StdEncoding.DecodeString(o.ConfigValue(configFieldEncryptionKey, ""))
+	if err != nil || len(encryptedKey) == 0 {
+		return nil, errors.Errorf("org %d has no valid field encryption key", o.id)
+	}
+
+	decrypter, err := getKeyDecrypter()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := decrypter.Decrypt(encryptedKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decrypting field encryption key for org %d", o.id)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid field encryption key for org %d", o.id)
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptFieldValue encrypts the passed in field value, returning what should be stored on the contact
+func (o *Org) EncryptFieldValue(value interface{}) (json.RawMessage, error) {
+	aead, err := o.fieldCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling field value")
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrapf(err, "error generating nonce")
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return json.Marshal(&encryptedFieldValue{Encrypted: base64.StdEncoding.EncodeToString(sealed)})
+}
+
+// DecryptFieldValue decrypts the passed in encrypted field value into the passed in value
+func (o *Org) DecryptFieldValue(encrypted string, value interface{}) error {
+	aead, err := o.fieldCipher()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return errors.Errorf("invalid encrypted field value")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return errors.Wrapf(err, "error decrypting field value")
+	}
+
+	return json.Unmarshal(plaintext, value)
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/nyaruka/goflow/excellent/types"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a key decrypter for testing which treats keys as already decrypted
+type plainKeyDecrypter struct{}
+
+func (d *plainKeyDecrypter) Decrypt(ciphertext []byte) ([]byte, error) { return ciphertext, nil }
+
+func TestFieldEncryption(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+	SetKeyDecrypter(&plainKeyDecrypter{})
+	defer SetKeyDecrypter(nil)
+
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	db.MustExec(`UPDATE orgs_org SET config = $2 WHERE id = $1`, Org1, `{"encrypted_fields": ["gender"], "field_encryption_key": "`+key+`"}`)
+
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+
+	assert.True(t, org.Org().IsEncryptedField("gender"))
+	assert.False(t, org.Org().IsEncryptedField("age"))
+
+	encrypted, err := org.Org().EncryptFieldValue(flows.NewValue(types.NewXText("Female"), nil, nil, "", "", ""))
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "Female")
+
+	// store it for Cathy and check it's decrypted when she's loaded
+	db.MustExec(`UPDATE contacts_contact SET fields = jsonb_build_object($2::text, $3::jsonb) WHERE id = $1`, CathyID, GenderFieldUUID, string(encrypted))
+
+	contacts, err := LoadContacts(ctx, db, org, []ContactID{CathyID})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(contacts))
+	assert.Equal(t, "Female", contacts[0].Fields()["gender"].Text.Native())
+
+	// an org without a key can't encrypt or decrypt
+	org2, err := NewOrgAssets(ctx, db, Org2, nil)
+	require.NoError(t, err)
+
+	_, err = org2.Org().EncryptFieldValue("x")
+	assert.EqualError(t, err, "org 2 has no valid field encryption key")
+
+	// and values which can't be decrypted are ignored
+	db.MustExec(`UPDATE contacts_contact SET fields = jsonb_build_object($2::text, '{"encrypted": "bm9wZQ=="}'::jsonb) WHERE id = $1`, CathyID, GenderFieldUUID)
+
+	contacts, err = LoadContacts(ctx, db, org, []ContactID{CathyID})
+	require.NoError(t, err)
+	assert.Nil(t, contacts[0].Fields()["gender"])
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldLastUsedKey   = "field_last_used:%d"
+	fieldFillCountsKey = "field_fill_counts:%d"
+	fieldCountedOnKey  = "field_counted_on:%d"
+	fieldActiveOrgsKey = "field_usage_orgs"
+
+	// FieldAbandonedAfter is how long a field must go unused before we suggest it be removed
+	FieldAbandonedAfter = time.Hour * 24 * 90
+)
+
+// FieldUsage is the usage summary for a single contact field
+type FieldUsage struct {
+	Key        string     `json:"key"`
+	Name       string     `json:"name"`
+	Type       string     `json:"value_type"`
+	Filled     int        `json:"filled"`
+	FillRate   float64    `json:"fill_rate"`
+	LastUsedOn *time.Time `json:"last_used_on"`
+	Abandoned  bool       `json:"abandoned"`
+}
+
+// RecordFieldUsage records that the fields with the passed in keys were set at the passed in time
+func RecordFieldUsage(rc redis.Conn, orgID OrgID, keys []string, now time.Time) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	lastUsedKey := fmt.Sprintf(fieldLastUsedKey, orgID)
+	args := redis.Args{}.Add(lastUsedKey)
+	for _, k := range keys {
+		args = args.Add(k, now.Unix())
+	}
+
+	rc.Send("hmset", args...)
+	rc.Send("sadd", fieldActiveOrgsKey, orgID)
+	_, err := rc.Do("")
+	if err != nil {
+		return errors.Wrapf(err, "error recording field usage for org: %d", orgID)
+	}
+	return nil
+}
+
+// SquashFieldUsage recalculates the fill counts for the fields of every org which has had field usage
+// recorded since the last squash
+func SquashFieldUsage(ctx context.Context, db *sqlx.DB, rc redis.Conn) (int, error) {
+	orgIDs, err := redis.Ints(rc.Do("smembers", fieldActiveOrgsKey))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error reading orgs with field usage")
+	}
+
+	for _, orgID := range orgIDs {
+		// remove the org before counting so that any usage recorded while we count is picked up by the next squash
+		_, err := rc.Do("srem", fieldActiveOrgsKey, orgID)
+		if err != nil {
+			return 0, errors.Wrapf(err, "error removing org from orgs with field usage: %d", orgID)
+		}
+
+		countedOn := time.Now()
+		counts, err := calculateFieldFillCounts(ctx, db, OrgID(orgID))
+		if err != nil {
+			rc.Do("sadd", fieldActiveOrgsKey, orgID)
+			return 0, errors.Wrapf(err, "error calculating field fill counts for org: %d", orgID)
+		}
+
+		countsKey := fmt.Sprintf(fieldFillCountsKey, orgID)
+		args := redis.Args{}.Add(countsKey).AddFlat(counts)
+
+		rc.Send("multi")
+		rc.Send("del", countsKey)
+		if len(counts) > 0 {
+			rc.Send("hmset", args...)
+		}
+		rc.Send("set", fmt.Sprintf(fieldCountedOnKey, orgID), countedOn.UTC().Format(time.RFC3339Nano))
+		_, err = rc.Do("exec")
+		if err != nil {
+			rc.Do("sadd", fieldActiveOrgsKey, orgID)
+			return 0, errors.Wrapf(err, "error writing field fill counts for org: %d", orgID)
+		}
+	}
+
+	return len(orgIDs), nil
+}
+
+// calculateFieldFillCounts calculates how many active contacts have a value for each field in the passed in org
+func calculateFieldFillCounts(ctx context.Context, db *sqlx.DB, orgID OrgID) (map[string]int, error) {
+	rows, err := db.QueryxContext(ctx, selectFieldFillCountsSQL, orgID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying field fill counts")
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var key string
+		var count int
+		err := rows.Scan(&key, &count)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error scanning field fill count")
+		}
+		counts[key] = count
+	}
+
+	return counts, nil
+}
+
+const selectFieldFillCountsSQL = `
+SELECT
+	f.key,
+	COUNT(c.id)
+FROM
+	contacts_contactfield f
+	LEFT OUTER JOIN contacts_contact c ON c.org_id = f.org_id AND c.is_active = TRUE AND c.fields ? f.uuid::text
+WHERE
+	f.org_id = $1 AND
+	f.is_active = TRUE AND
+	f.field_type = 'U'
+GROUP BY
+	f.key
+`
+
+// GetFieldUsage returns the usage of all the fields for the passed in org, along with when their fill counts were counted
+func GetFieldUsage(ctx context.Context, db *sqlx.DB, rc redis.Conn, org *OrgAssets, now time.Time) ([]*FieldUsage, time.Time, error) {
+	lastUsed, err := redis.Int64Map(rc.Do("hgetall", fmt.Sprintf(fieldLastUsedKey, org.OrgID())))
+	if err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "error reading field last used times")
+	}
+
+	fillCounts, countedOn, err := getFieldFillCounts(ctx, db, rc, org.OrgID(), now)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var total int
+	err = db.GetContext(ctx, &total, `SELECT COUNT(*) FROM contacts_contact WHERE org_id = $1 AND is_active = TRUE`, org.OrgID())
+	if err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "error counting contacts for org: %d", org.OrgID())
+	}
+
+	orgFields, _ := org.Fields()
+	usages := make([]*FieldUsage, 0, len(orgFields))
+	for _, f := range orgFields {
+		field := f.(*Field)
+		usage := &FieldUsage{
+			Key:    field.Key(),
+			Name:   field.Name(),
+			Type:   string(field.Type()),
+			Filled: fillCounts[field.Key()],
+		}
+
+		if total > 0 {
+			usage.FillRate = float64(usage.Filled) / float64(total)
+		}
+
+		used, found := lastUsed[field.Key()]
+		if found {
+			t := time.Unix(used, 0).UTC()
+			usage.LastUsedOn = &t
+		}
+
+		usage.Abandoned = usage.Filled == 0 && (usage.LastUsedOn == nil || now.Sub(*usage.LastUsedOn) > FieldAbandonedAfter)
+		usages = append(usages, usage)
+	}
+
+	return usages, countedOn, nil
+}
+
+// gets the fill counts for the fields of the passed in org and when they were counted. These are those of the last
+// squash, even if fields have been set since, so that requests never wait on counting. Orgs which have never been
+// squashed have theirs calculated now and are added to the next squash.
+func getFieldFillCounts(ctx context.Context, db *sqlx.DB, rc redis.Conn, orgID OrgID, now time.Time) (map[string]int, time.Time, error) {
+	rc.Send("multi")
+	rc.Send("get", fmt.Sprintf(fieldCountedOnKey, orgID))
+	rc.Send("hgetall", fmt.Sprintf(fieldFillCountsKey, orgID))
+	replies, err := redis.Values(rc.Do("exec"))
+	if err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "error reading field fill counts")
+	}
+
+	countedOn, err := redis.String(replies[0], nil)
+	if err == redis.ErrNil {
+		counts, err := calculateFieldFillCounts(ctx, db, orgID)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		_, err = rc.Do("sadd", fieldActiveOrgsKey, orgID)
+		if err != nil {
+			return nil, time.Time{}, errors.Wrapf(err, "error adding org to orgs with field usage: %d", orgID)
+		}
+		return counts, now, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "error reading field fill counts time")
+	}
+
+	countedOnTime, err := time.Parse(time.RFC3339Nano, countedOn)
+	if err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "error parsing field fill counts time: %s", countedOn)
+	}
+
+	counts, err := redis.IntMap(replies[1], nil)
+	if err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "error reading field fill counts")
+	}
+
+	return counts, countedOnTime, nil
+}
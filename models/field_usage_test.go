@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldUsage(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	org, err := GetOrgAssets(ctx, db, Org1)
+	assert.NoError(t, err)
+
+	findUsage := func(usages []*FieldUsage, key string) *FieldUsage {
+		for _, u := range usages {
+			if u.Key == key {
+				return u
+			}
+		}
+		return nil
+	}
+
+	// give cathy an age
+	db.MustExec(`UPDATE contacts_contact SET fields = fields || '{"903f51da-2717-47c7-a0d3-f2f32877013d": {"text": "30", "number": 30}}'::jsonb WHERE id = $1`, CathyID)
+
+	now := time.Date(2019, 10, 1, 12, 30, 0, 0, time.UTC)
+
+	// org has never been squashed so counts are calculated now
+	usages, countedOn, err := GetFieldUsage(ctx, db, rc, org, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, findUsage(usages, "age").Filled)
+	assert.Equal(t, now, countedOn)
+
+	err = RecordFieldUsage(rc, Org1, []string{"age"}, now)
+	assert.NoError(t, err)
+
+	// give bob an age too
+	db.MustExec(`UPDATE contacts_contact SET fields = fields || '{"903f51da-2717-47c7-a0d3-f2f32877013d": {"text": "40", "number": 40}}'::jsonb WHERE id = $1`, BobID)
+
+	beforeSquash := time.Now()
+
+	squashed, err := SquashFieldUsage(ctx, db, rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, squashed)
+
+	// a second squash has nothing to do
+	squashed, err = SquashFieldUsage(ctx, db, rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, squashed)
+
+	// give george an age and record it, which isn't counted until the next squash
+	db.MustExec(`UPDATE contacts_contact SET fields = fields || '{"903f51da-2717-47c7-a0d3-f2f32877013d": {"text": "50", "number": 50}}'::jsonb WHERE id = $1`, GeorgeID)
+
+	err = RecordFieldUsage(rc, Org1, []string{"age"}, now)
+	assert.NoError(t, err)
+
+	usages, countedOn, err = GetFieldUsage(ctx, db, rc, org, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(usages))
+	assert.True(t, !countedOn.Before(beforeSquash) && !countedOn.After(time.Now()))
+
+	age := findUsage(usages, "age")
+	assert.Equal(t, 2, age.Filled)
+	assert.True(t, age.FillRate > 0)
+	assert.Equal(t, now, *age.LastUsedOn)
+	assert.False(t, age.Abandoned)
+
+	// until it's squashed again
+	squashed, err = SquashFieldUsage(ctx, db, rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, squashed)
+
+	usages, _, err = GetFieldUsage(ctx, db, rc, org, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, findUsage(usages, "age").Filled)
+}
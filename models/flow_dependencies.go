@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/pkg/errors"
+)
+
+// FlowDependencyType is a type of asset a flow can depend on
+type FlowDependencyType string
+
+// the types of dependency we can count the usage of
+const (
+	FlowDependencyChannels  = FlowDependencyType("channels")
+	FlowDependencyFields    = FlowDependencyType("fields")
+	FlowDependencyGroups    = FlowDependencyType("groups")
+	FlowDependencyLabels    = FlowDependencyType("labels")
+	FlowDependencyTemplates = FlowDependencyType("templates")
+)
+
+// FlowDependencyUsage is whether a dependency of a flow exists in an org and how many other active flows in the org
+// depend on it, e.g. to warn about the impact of deleting it. Dependencies are identified by UUID apart from fields
+// which are identified by key.
+type FlowDependencyUsage struct {
+	UUID      string `json:"uuid,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Name      string `json:"name"`
+	Exists    bool   `json:"exists"`
+	FlowCount int    `json:"flow_count"`
+}
+
+// LoadFlowDependencyUsage sets whether each of the passed in dependencies of the passed in flow exists in the org, and
+// how many other flows in the org depend on it, as counted from the dependencies saved with each flow.
+func LoadFlowDependencyUsage(ctx context.Context, db *sqlx.DB, org *OrgAssets, flowUUID assets.FlowUUID, deps map[FlowDependencyType][]*FlowDependencyUsage) error {
+	for depType, usages := range deps {
+		sql := selectFlowDependencyCountsSQL[depType]
+		if sql == "" || len(usages) == 0 {
+			continue
+		}
+
+		refs := make([]string, len(usages))
+		for i, u := range usages {
+			refs[i] = u.ref()
+			u.Exists = flowDependencyExists(org, depType, refs[i])
+		}
+
+		rows, err := db.QueryxContext(ctx, sql, org.OrgID(), flowUUID, pq.Array(refs))
+		if err != nil {
+			return errors.Wrapf(err, "error counting flows which depend on %s", depType)
+		}
+
+		counts := make(map[string]int, len(refs))
+		for rows.Next() {
+			var ref string
+			var count int
+			if err := rows.Scan(&ref, &count); err != nil {
+				rows.Close()
+				return errors.Wrapf(err, "error scanning flow dependency count")
+			}
+			counts[ref] = count
+		}
+		rows.Close()
+
+		for _, u := range usages {
+			u.FlowCount = counts[u.ref()]
+		}
+	}
+	return nil
+}
+
+func (u *FlowDependencyUsage) ref() string {
+	if u.Key != "" {
+		return u.Key
+	}
+	return u.UUID
+}
+
+// whether the dependency with the passed in type and UUID or key exists in the passed in org
+func flowDependencyExists(org *OrgAssets, depType FlowDependencyType, ref string) bool {
+	switch depType {
+	case FlowDependencyChannels:
+		return org.ChannelByUUID(assets.ChannelUUID(ref)) != nil
+	case FlowDependencyFields:
+		return org.FieldByKey(ref) != nil
+	case FlowDependencyGroups:
+		return org.GroupByUUID(assets.GroupUUID(ref)) != nil
+	case FlowDependencyLabels:
+		return org.LabelByUUID(assets.LabelUUID(ref)) != nil
+	case FlowDependencyTemplates:
+		templates, _ := org.Templates()
+		for _, t := range templates {
+			if string(t.UUID()) == ref {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var selectFlowDependencyCountsSQL = map[FlowDependencyType]string{
+	FlowDependencyChannels: `
+SELECT
+	c.uuid,
+	COUNT(DISTINCT f.id)
+FROM
+	flows_flow_channel_dependencies d
+	JOIN channels_channel c ON c.id = d.channel_id
+	JOIN flows_flow f ON f.id = d.flow_id
+WHERE
+	f.org_id = $1 AND
+	f.is_active = TRUE AND
+	f.uuid != $2 AND
+	c.uuid = ANY($3)
+GROUP BY
+	c.uuid
+`,
+
+	FlowDependencyFields: `
+SELECT
+	cf.key,
+	COUNT(DISTINCT f.id)
+FROM
+	flows_flow_field_dependencies d
+	JOIN contacts_contactfield cf ON cf.id = d.contactfield_id
+	JOIN flows_flow f ON f.id = d.flow_id
+WHERE
+	f.org_id = $1 AND
+	f.is_active = TRUE AND
+	f.uuid != $2 AND
+	cf.key = ANY($3)
+GROUP BY
+	cf.key
+`,
+
+	FlowDependencyGroups: `
+SELECT
+	g.uuid,
+	COUNT(DISTINCT f.id)
+FROM
+	flows_flow_group_dependencies d
+	JOIN contacts_contactgroup g ON g.id = d.contactgroup_id
+	JOIN flows_flow f ON f.id = d.flow_id
+WHERE
+	f.org_id = $1 AND
+	f.is_active = TRUE AND
+	f.uuid != $2 AND
+	g.uuid = ANY($3)
+GROUP BY
+	g.uuid
+`,
+
+	FlowDependencyLabels: `
+SELECT
+	l.uuid,
+	COUNT(DISTINCT f.id)
+FROM
+	flows_flow_label_dependencies d
+	JOIN msgs_label l ON l.id = d.label_id
+	JOIN flows_flow f ON f.id = d.flow_id
+WHERE
+	f.org_id = $1 AND
+	f.is_active = TRUE AND
+	f.uuid != $2 AND
+	l.uuid = ANY($3)
+GROUP BY
+	l.uuid
+`,
+
+	FlowDependencyTemplates: `
+SELECT
+	t.uuid::text,
+	COUNT(DISTINCT f.id)
+FROM
+	flows_flow_template_dependencies d
+	JOIN templates_template t ON t.id = d.template_id
+	JOIN flows_flow f ON f.id = d.flow_id
+WHERE
+	f.org_id = $1 AND
+	f.is_active = TRUE AND
+	f.uuid != $2 AND
+	t.uuid::text = ANY($3)
+GROUP BY
+	t.uuid
+`,
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFlowDependencyUsage(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	db.MustExec(`INSERT INTO flows_flow_group_dependencies(flow_id, contactgroup_id) VALUES($1, $2)`, FavoritesFlowID, DoctorsGroupID)
+	db.MustExec(`INSERT INTO flows_flow_group_dependencies(flow_id, contactgroup_id) VALUES($1, $2)`, PickNumberFlowID, DoctorsGroupID)
+	db.MustExec(`INSERT INTO flows_flow_label_dependencies(flow_id, label_id) VALUES($1, $2)`, FavoritesFlowID, ReportingLabelID)
+	db.MustExec(`INSERT INTO flows_flow_field_dependencies(flow_id, contactfield_id) SELECT $1, id FROM contacts_contactfield WHERE uuid = $2`, PickNumberFlowID, GenderFieldUUID)
+	db.MustExec(`INSERT INTO flows_flow_template_dependencies(flow_id, template_id) SELECT $1, id FROM templates_template WHERE org_id = $2 AND name = 'revive_issue'`, PickNumberFlowID, Org1)
+
+	var reviveUUID string
+	require.NoError(t, db.Get(&reviveUUID, `SELECT uuid::text FROM templates_template WHERE org_id = $1 AND name = 'revive_issue'`, Org1))
+
+	org, err := GetOrgAssets(ctx, db, Org1)
+	require.NoError(t, err)
+
+	deps := map[FlowDependencyType][]*FlowDependencyUsage{
+		FlowDependencyGroups: {
+			{UUID: string(DoctorsGroupUUID), Name: "Doctors"},
+			{UUID: "7bc07c0d-3a4c-4e8d-8c59-7a5a1c0d1b1a", Name: "Deleted"},
+		},
+		FlowDependencyLabels: {
+			{UUID: string(ReportingLabelUUID), Name: "Reporting"},
+			{UUID: string(TestingLabelUUID), Name: "Testing"},
+		},
+		FlowDependencyFields: {
+			{Key: "gender", Name: "Gender"},
+		},
+		FlowDependencyTemplates: {
+			{UUID: reviveUUID, Name: "revive_issue"},
+		},
+	}
+
+	// dependencies of the favorites flow are counted in other flows only
+	err = LoadFlowDependencyUsage(ctx, db, org, FavoritesFlowUUID, deps)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*FlowDependencyUsage{
+		{UUID: string(DoctorsGroupUUID), Name: "Doctors", Exists: true, FlowCount: 1},
+		{UUID: "7bc07c0d-3a4c-4e8d-8c59-7a5a1c0d1b1a", Name: "Deleted", Exists: false, FlowCount: 0},
+	}, deps[FlowDependencyGroups])
+	assert.Equal(t, []*FlowDependencyUsage{
+		{UUID: string(ReportingLabelUUID), Name: "Reporting", Exists: true, FlowCount: 0},
+		{UUID: string(TestingLabelUUID), Name: "Testing", Exists: true, FlowCount: 0},
+	}, deps[FlowDependencyLabels])
+	assert.Equal(t, []*FlowDependencyUsage{
+		{Key: "gender", Name: "Gender", Exists: true, FlowCount: 1},
+	}, deps[FlowDependencyFields])
+	assert.Equal(t, []*FlowDependencyUsage{
+		{UUID: reviveUUID, Name: "revive_issue", Exists: true, FlowCount: 1},
+	}, deps[FlowDependencyTemplates])
+
+	// inactive flows aren't counted
+	db.MustExec(`UPDATE flows_flow SET is_active = FALSE WHERE id = $1`, PickNumberFlowID)
+
+	err = LoadFlowDependencyUsage(ctx, db, org, FavoritesFlowUUID, deps)
+	require.NoError(t, err)
+	assert.Equal(t, 0, deps[FlowDependencyGroups][0].FlowCount)
+	assert.Equal(t, 0, deps[FlowDependencyFields][0].FlowCount)
+	assert.Equal(t, 0, deps[FlowDependencyTemplates][0].FlowCount)
+}
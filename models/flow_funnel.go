@@ -0,0 +1,109 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+const (
+	FunnelStepEntered   = "entered"
+	FunnelStepNode      = "node"
+	FunnelStepCompleted = "completed"
+)
+
+// FlowFunnel is how many of the runs of a flow started in a date range went on to reach each of a sequence of nodes,
+// and then to complete
+type FlowFunnel struct {
+	Since time.Time     `json:"since"`
+	Until time.Time     `json:"until"`
+	Steps []*FunnelStep `json:"steps"`
+}
+
+// FunnelStep is how many runs reached a step of a funnel, having reached all the steps before it
+type FunnelStep struct {
+	Type           string         `json:"type"`
+	NodeUUID       flows.NodeUUID `json:"node_uuid,omitempty"`
+	Count          int            `json:"count"`
+	Conversion     float64        `json:"conversion"`
+	StepConversion float64        `json:"step_conversion"`
+}
+
+// the runs started in the range are the cohort, and each step counts the runs of the cohort whose path includes its
+// node and the nodes of every step before it. The step after the last node counts those runs which also completed.
+const selectFlowFunnelSQL = `
+WITH cohort AS (
+	SELECT
+		r.exit_type,
+		ARRAY(SELECT DISTINCT s->>'node_uuid' FROM jsonb_array_elements(COALESCE(r.path, '[]')::jsonb) s) AS nodes
+	FROM
+		flows_flowrun r
+	WHERE
+		r.flow_id = $1 AND
+		r.created_on >= $2 AND
+		r.created_on < $3
+)
+SELECT
+	(
+		SELECT
+			count(*)
+		FROM
+			cohort c
+		WHERE
+			c.nodes @> ($4::text[])[1:steps.step] AND
+			(steps.step <= cardinality($4::text[]) OR c.exit_type = 'C')
+	) AS count
+FROM
+	generate_series(0, cardinality($4::text[]) + 1) AS steps(step)
+ORDER BY
+	steps.step
+`
+
+// GetFlowFunnel returns the funnel of the runs of the passed in flow started between since and until, i.e. how many
+// entered the flow, how many of those reached the first of the passed in nodes, how many of those reached the
+// second, and so on, and how many of those completed. Steps don't need to have been reached in order.
+func GetFlowFunnel(ctx context.Context, db *sqlx.DB, flowID FlowID, nodeUUIDs []flows.NodeUUID, since time.Time, until time.Time) (*FlowFunnel, error) {
+	nodes := make([]string, len(nodeUUIDs))
+	for i := range nodeUUIDs {
+		nodes[i] = string(nodeUUIDs[i])
+	}
+
+	counts := make([]int, 0, len(nodes)+2)
+	err := db.SelectContext(ctx, &counts, selectFlowFunnelSQL, flowID, since, until, pq.Array(nodes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting funnel for flow: %d", flowID)
+	}
+	if len(counts) != len(nodes)+2 {
+		return nil, errors.Errorf("expected %d funnel steps, got %d", len(nodes)+2, len(counts))
+	}
+
+	funnel := &FlowFunnel{Since: since, Until: until, Steps: make([]*FunnelStep, len(counts))}
+	for i, count := range counts {
+		step := &FunnelStep{Type: FunnelStepNode, Count: count}
+		switch i {
+		case 0:
+			step.Type = FunnelStepEntered
+		case len(counts) - 1:
+			step.Type = FunnelStepCompleted
+		default:
+			step.NodeUUID = nodeUUIDs[i-1]
+		}
+
+		if counts[0] > 0 {
+			step.Conversion = float64(count) / float64(counts[0])
+		}
+		if i == 0 {
+			step.StepConversion = step.Conversion
+		} else if counts[i-1] > 0 {
+			step.StepConversion = float64(count) / float64(counts[i-1])
+		}
+
+		funnel.Steps[i] = step
+	}
+
+	return funnel, nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowFunnel(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	node1 := flows.NodeUUID("cd2b9e8e-6b1a-4e70-a5b7-1b9e5f6c6f1e")
+	node2 := flows.NodeUUID("b7bb5e7c-ad49-4e65-9e24-bf7f1e4ff00a")
+
+	insertRun := func(contactID ContactID, createdOn time.Time, exitType ExitType, nodes ...flows.NodeUUID) {
+		path := `[`
+		for i, n := range nodes {
+			if i > 0 {
+				path += `,`
+			}
+			path += `{"uuid": "` + string(uuids.New()) + `", "node_uuid": "` + string(n) + `", "arrived_on": "2019-05-01T00:00:00Z"}`
+		}
+		path += `]`
+
+		db.MustExec(`INSERT INTO flows_flowrun(uuid, is_active, status, exit_type, created_on, modified_on, responded, contact_id, flow_id, org_id, path)
+		                               VALUES($1, FALSE, 'C', $2, $3, $3, TRUE, $4, $5, 1, $6)`,
+			uuids.New(), exitType, createdOn, contactID, FavoritesFlowID, path)
+	}
+
+	may := time.Date(2019, 5, 10, 12, 0, 0, 0, time.UTC)
+	april := time.Date(2019, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	// four runs in may, three reach the first node, two of those the second (one out of order), one of those completes
+	insertRun(CathyID, may, ExitCompleted, node1, node2)
+	insertRun(BobID, may, ExitInterrupted, node2, node1)
+	insertRun(GeorgeID, may, ExitExpired, node1)
+	insertRun(CathyID, may, ExitCompleted)
+
+	// one run in april which went all the way
+	insertRun(BobID, april, ExitCompleted, node1, node2)
+
+	funnel, err := GetFlowFunnel(ctx, db, FavoritesFlowID, []flows.NodeUUID{node1, node2}, time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []*FunnelStep{
+		{Type: FunnelStepEntered, Count: 4, Conversion: 1, StepConversion: 1},
+		{Type: FunnelStepNode, NodeUUID: node1, Count: 3, Conversion: 0.75, StepConversion: 0.75},
+		{Type: FunnelStepNode, NodeUUID: node2, Count: 2, Conversion: 0.5, StepConversion: float64(2) / float64(3)},
+		{Type: FunnelStepCompleted, Count: 1, Conversion: 0.25, StepConversion: 0.5},
+	}, funnel.Steps)
+
+	funnel, err = GetFlowFunnel(ctx, db, FavoritesFlowID, []flows.NodeUUID{node1, node2}, time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 1, 1}, []int{funnel.Steps[0].Count, funnel.Steps[1].Count, funnel.Steps[2].Count, funnel.Steps[3].Count})
+
+	// without nodes a funnel is just how many entered and completed
+	funnel, err = GetFlowFunnel(ctx, db, FavoritesFlowID, nil, time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(funnel.Steps))
+	assert.Equal(t, 4, funnel.Steps[0].Count)
+	assert.Equal(t, 2, funnel.Steps[1].Count)
+}
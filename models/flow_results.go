@@ -0,0 +1,236 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+// FlowResultsSummary is a summary of the results and runs of a flow, read from the count tables which are kept up
+// to date by database triggers as runs are written. Category and run counts aren't bucketed by time so are read from
+// the runs themselves when the summary is limited to a time window.
+type FlowResultsSummary struct {
+	Results  []*ResultSummary  `json:"results"`
+	Runs     *RunsSummary      `json:"runs"`
+	Segments []*SegmentSummary `json:"segments"`
+}
+
+// ResultSummary is the count of runs in each category of a result
+type ResultSummary struct {
+	Key        string             `json:"key"`
+	Name       string             `json:"name"`
+	Categories []*CategorySummary `json:"categories"`
+	Total      int                `json:"total"`
+}
+
+// CategorySummary is the count of runs in a single category of a result
+type CategorySummary struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// RunsSummary is the count of runs by how they exited
+type RunsSummary struct {
+	Active         int     `json:"active"`
+	Completed      int     `json:"completed"`
+	Interrupted    int     `json:"interrupted"`
+	Expired        int     `json:"expired"`
+	Failed         int     `json:"failed"`
+	Total          int     `json:"total"`
+	CompletionRate float64 `json:"completion_rate"`
+}
+
+// SegmentSummary is the number of times contacts went from an exit to a node
+type SegmentSummary struct {
+	FromUUID flows.ExitUUID `json:"from_uuid" db:"from_uuid"`
+	ToUUID   flows.NodeUUID `json:"to_uuid"   db:"to_uuid"`
+	Count    int            `json:"count"     db:"count"`
+}
+
+const selectFlowCategoryCountsSQL = `
+SELECT
+	result_key,
+	MAX(result_name) AS result_name,
+	category_name,
+	SUM(count) AS count
+FROM
+	flows_flowcategorycount
+WHERE
+	flow_id = $1
+GROUP BY
+	result_key, category_name
+HAVING
+	SUM(count) > 0
+ORDER BY
+	result_key, category_name
+`
+
+const selectFlowCategoryCountsInWindowSQL = `
+SELECT
+	r.key AS result_key,
+	MAX(r.value->>'name') AS result_name,
+	r.value->>'category' AS category_name,
+	COUNT(*) AS count
+FROM
+	flows_flowrun fr,
+	jsonb_each(fr.results::jsonb) r
+WHERE
+	fr.flow_id = $1 AND
+	($2::timestamptz IS NULL OR fr.created_on >= $2) AND
+	($3::timestamptz IS NULL OR fr.created_on < $3) AND
+	r.value->>'category' <> ''
+GROUP BY
+	r.key, r.value->>'category'
+ORDER BY
+	r.key, r.value->>'category'
+`
+
+const selectFlowRunCountsSQL = `
+SELECT
+	exit_type,
+	SUM(count) AS count
+FROM
+	flows_flowruncount
+WHERE
+	flow_id = $1
+GROUP BY
+	exit_type
+`
+
+const selectFlowRunCountsInWindowSQL = `
+SELECT
+	exit_type,
+	COUNT(*) AS count
+FROM
+	flows_flowrun
+WHERE
+	flow_id = $1 AND
+	($2::timestamptz IS NULL OR created_on >= $2) AND
+	($3::timestamptz IS NULL OR created_on < $3)
+GROUP BY
+	exit_type
+`
+
+const selectFlowPathCountsSQL = `
+SELECT
+	from_uuid,
+	to_uuid,
+	SUM(count) AS count
+FROM
+	flows_flowpathcount
+WHERE
+	flow_id = $1 AND
+	($2::timestamptz IS NULL OR period >= $2) AND
+	($3::timestamptz IS NULL OR period < $3)
+GROUP BY
+	from_uuid, to_uuid
+HAVING
+	SUM(count) > 0
+ORDER BY
+	from_uuid, to_uuid
+`
+
+// GetFlowResultsSummary returns a summary of the results and runs of the passed in flow, limited to the passed in
+// window if given. Segments are limited to path steps taken in the window, and results and runs to runs created in it.
+func GetFlowResultsSummary(ctx context.Context, db *sqlx.DB, flowID FlowID, since *time.Time, until *time.Time) (*FlowResultsSummary, error) {
+	results, err := getResultSummaries(ctx, db, flowID, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	runs, err := getRunsSummary(ctx, db, flowID, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]*SegmentSummary, 0)
+	err = db.SelectContext(ctx, &segments, selectFlowPathCountsSQL, flowID, since, until)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting path counts for flow: %d", flowID)
+	}
+
+	return &FlowResultsSummary{Results: results, Runs: runs, Segments: segments}, nil
+}
+
+// reads the category counts of the passed in flow, grouped by result
+func getResultSummaries(ctx context.Context, db *sqlx.DB, flowID FlowID, since *time.Time, until *time.Time) ([]*ResultSummary, error) {
+	query, args := selectFlowCategoryCountsSQL, []interface{}{flowID}
+	if since != nil || until != nil {
+		query, args = selectFlowCategoryCountsInWindowSQL, []interface{}{flowID, since, until}
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting category counts for flow: %d", flowID)
+	}
+	defer rows.Close()
+
+	results := make([]*ResultSummary, 0)
+	var result *ResultSummary
+
+	for rows.Next() {
+		var key, name, category string
+		var count int
+		if err := rows.Scan(&key, &name, &category, &count); err != nil {
+			return nil, errors.Wrapf(err, "error scanning category count")
+		}
+
+		// rows are ordered by key so a new key means a new result
+		if result == nil || result.Key != key {
+			result = &ResultSummary{Key: key, Name: name, Categories: make([]*CategorySummary, 0)}
+			results = append(results, result)
+		}
+
+		result.Categories = append(result.Categories, &CategorySummary{Name: category, Count: count})
+		result.Total += count
+	}
+
+	return results, rows.Err()
+}
+
+// reads the run counts of the passed in flow by exit type
+func getRunsSummary(ctx context.Context, db *sqlx.DB, flowID FlowID, since *time.Time, until *time.Time) (*RunsSummary, error) {
+	query, args := selectFlowRunCountsSQL, []interface{}{flowID}
+	if since != nil || until != nil {
+		query, args = selectFlowRunCountsInWindowSQL, []interface{}{flowID, since, until}
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting run counts for flow: %d", flowID)
+	}
+	defer rows.Close()
+
+	runs := &RunsSummary{}
+
+	for rows.Next() {
+		var exitType ExitType
+		var count int
+		if err := rows.Scan(&exitType, &count); err != nil {
+			return nil, errors.Wrapf(err, "error scanning run count")
+		}
+
+		switch exitType {
+		case ExitCompleted:
+			runs.Completed += count
+		case ExitInterrupted:
+			runs.Interrupted += count
+		case ExitExpired:
+			runs.Expired += count
+		case ExitFailed:
+			runs.Failed += count
+		default:
+			runs.Active += count
+		}
+		runs.Total += count
+	}
+
+	if runs.Total > 0 {
+		runs.CompletionRate = float64(runs.Completed) / float64(runs.Total)
+	}
+
+	return runs, rows.Err()
+}
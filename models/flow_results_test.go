@@ -0,0 +1,118 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFlowResultsSummary(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	db.MustExec(`DELETE FROM flows_flowcategorycount WHERE flow_id = $1`, FavoritesFlowID)
+	db.MustExec(`DELETE FROM flows_flowruncount WHERE flow_id = $1`, FavoritesFlowID)
+	db.MustExec(`DELETE FROM flows_flowpathcount WHERE flow_id = $1`, FavoritesFlowID)
+
+	// no counts at all
+	summary, err := GetFlowResultsSummary(ctx, db, FavoritesFlowID, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(summary.Results))
+	assert.Equal(t, &RunsSummary{}, summary.Runs)
+	assert.Equal(t, 0, len(summary.Segments))
+
+	addCategoryCount := func(key, name, category string, count int) {
+		db.MustExec(`INSERT INTO flows_flowcategorycount(is_squashed, node_uuid, result_key, result_name, category_name, count, flow_id)
+		VALUES(FALSE, 'f3d7f6a5-1d7c-4e1e-bd31-a3b1bc7e2d37', $1, $2, $3, $4, $5)`, key, name, category, count, FavoritesFlowID)
+	}
+	addRunCount := func(exitType interface{}, count int) {
+		db.MustExec(`INSERT INTO flows_flowruncount(is_squashed, exit_type, count, flow_id) VALUES(FALSE, $1, $2, $3)`, exitType, count, FavoritesFlowID)
+	}
+	addPathCount := func(from, to string, period time.Time, count int) {
+		db.MustExec(`INSERT INTO flows_flowpathcount(is_squashed, from_uuid, to_uuid, period, count, flow_id)
+		VALUES(FALSE, $1, $2, $3, $4, $5)`, from, to, period, count, FavoritesFlowID)
+	}
+
+	// counts aren't squashed so there can be several rows for a category, including decrements
+	addCategoryCount("color", "Color", "Red", 3)
+	addCategoryCount("color", "Color", "Red", 2)
+	addCategoryCount("color", "Color", "Blue", 4)
+	addCategoryCount("beer", "Beer", "Mutzig", 1)
+	addCategoryCount("beer", "Beer", "Primus", 1)
+	addCategoryCount("beer", "Beer", "Primus", -1)
+
+	addRunCount(nil, 2)
+	addRunCount("C", 5)
+	addRunCount("C", 1)
+	addRunCount("I", 1)
+	addRunCount("E", 2)
+
+	april := time.Date(2020, 4, 15, 12, 0, 0, 0, time.UTC)
+	may := time.Date(2020, 5, 15, 12, 0, 0, 0, time.UTC)
+	addPathCount("d5f2b0a4-8a8c-4f0d-a6c8-bb3d8d1d5e64", "a8f0ab5f-5ff3-4a9e-9c5d-0b7e0ab3ef1b", april, 4)
+	addPathCount("d5f2b0a4-8a8c-4f0d-a6c8-bb3d8d1d5e64", "a8f0ab5f-5ff3-4a9e-9c5d-0b7e0ab3ef1b", may, 3)
+	addPathCount("0d2a5f6e-2c43-4c7b-a8f4-3f7b0d4a1c9e", "a8f0ab5f-5ff3-4a9e-9c5d-0b7e0ab3ef1b", may, 2)
+
+	summary, err = GetFlowResultsSummary(ctx, db, FavoritesFlowID, nil, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*ResultSummary{
+		{Key: "beer", Name: "Beer", Categories: []*CategorySummary{{Name: "Mutzig", Count: 1}}, Total: 1},
+		{Key: "color", Name: "Color", Categories: []*CategorySummary{{Name: "Blue", Count: 4}, {Name: "Red", Count: 5}}, Total: 9},
+	}, summary.Results)
+
+	assert.Equal(t, &RunsSummary{Active: 2, Completed: 6, Interrupted: 1, Expired: 2, Total: 11, CompletionRate: 6.0 / 11.0}, summary.Runs)
+
+	assert.Equal(t, []*SegmentSummary{
+		{FromUUID: flows.ExitUUID("0d2a5f6e-2c43-4c7b-a8f4-3f7b0d4a1c9e"), ToUUID: flows.NodeUUID("a8f0ab5f-5ff3-4a9e-9c5d-0b7e0ab3ef1b"), Count: 2},
+		{FromUUID: flows.ExitUUID("d5f2b0a4-8a8c-4f0d-a6c8-bb3d8d1d5e64"), ToUUID: flows.NodeUUID("a8f0ab5f-5ff3-4a9e-9c5d-0b7e0ab3ef1b"), Count: 7},
+	}, summary.Segments)
+
+	// segments can be limited to a window
+	since := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	summary, err = GetFlowResultsSummary(ctx, db, FavoritesFlowID, &since, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*SegmentSummary{
+		{FromUUID: flows.ExitUUID("0d2a5f6e-2c43-4c7b-a8f4-3f7b0d4a1c9e"), ToUUID: flows.NodeUUID("a8f0ab5f-5ff3-4a9e-9c5d-0b7e0ab3ef1b"), Count: 2},
+		{FromUUID: flows.ExitUUID("d5f2b0a4-8a8c-4f0d-a6c8-bb3d8d1d5e64"), ToUUID: flows.NodeUUID("a8f0ab5f-5ff3-4a9e-9c5d-0b7e0ab3ef1b"), Count: 3},
+	}, summary.Segments)
+
+	summary, err = GetFlowResultsSummary(ctx, db, FavoritesFlowID, nil, &since)
+	require.NoError(t, err)
+	assert.Equal(t, []*SegmentSummary{
+		{FromUUID: flows.ExitUUID("d5f2b0a4-8a8c-4f0d-a6c8-bb3d8d1d5e64"), ToUUID: flows.NodeUUID("a8f0ab5f-5ff3-4a9e-9c5d-0b7e0ab3ef1b"), Count: 4},
+	}, summary.Segments)
+
+	// results and runs in a window are counted from runs created in it
+	insertRun := func(createdOn time.Time, exitType interface{}, results string) {
+		db.MustExec(`INSERT INTO flows_flowrun(uuid, is_active, status, exit_type, created_on, modified_on, responded, contact_id, flow_id, org_id, results)
+		                               VALUES($1, FALSE, 'C', $2, $3, $3, TRUE, $4, $5, 1, $6)`,
+			uuids.New(), exitType, createdOn, CathyID, FavoritesFlowID, results)
+	}
+	insertRun(april, "C", `{"color": {"name": "Color", "value": "red", "category": "Red"}}`)
+	insertRun(may, "C", `{"color": {"name": "Color", "value": "blue", "category": "Blue"}, "beer": {"name": "Beer", "value": "primus", "category": "Primus"}}`)
+	insertRun(may, "I", `{"color": {"name": "Color", "value": "red", "category": "Red"}}`)
+	insertRun(may, nil, `{}`)
+
+	summary, err = GetFlowResultsSummary(ctx, db, FavoritesFlowID, &since, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*ResultSummary{
+		{Key: "beer", Name: "Beer", Categories: []*CategorySummary{{Name: "Primus", Count: 1}}, Total: 1},
+		{Key: "color", Name: "Color", Categories: []*CategorySummary{{Name: "Blue", Count: 1}, {Name: "Red", Count: 1}}, Total: 2},
+	}, summary.Results)
+	assert.Equal(t, &RunsSummary{Active: 1, Completed: 1, Interrupted: 1, Total: 3, CompletionRate: 1.0 / 3.0}, summary.Runs)
+
+	summary, err = GetFlowResultsSummary(ctx, db, FavoritesFlowID, nil, &since)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*ResultSummary{
+		{Key: "color", Name: "Color", Categories: []*CategorySummary{{Name: "Red", Count: 1}}, Total: 1},
+	}, summary.Results)
+	assert.Equal(t, &RunsSummary{Completed: 1, Total: 1, CompletionRate: 1.0}, summary.Runs)
+}
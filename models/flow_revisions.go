@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/pkg/errors"
+)
+
+// FlowRevisionAuthor is the user who saved a revision of a flow
+type FlowRevisionAuthor struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// FlowRevision is a saved revision of a flow definition
+type FlowRevision struct {
+	Revision    int                 `json:"revision"`
+	SpecVersion string              `json:"spec_version"`
+	CreatedOn   time.Time           `json:"created_on"`
+	CreatedBy   *FlowRevisionAuthor `json:"created_by"`
+	Definition  json.RawMessage     `json:"-"`
+}
+
+const selectFlowRevisionsSQL = `
+SELECT
+	r.revision,
+	r.spec_version,
+	r.created_on,
+	r.definition,
+	COALESCE(u.id, 0) AS user_id,
+	COALESCE(u.email, '') AS user_email,
+	TRIM(CONCAT(u.first_name, ' ', u.last_name)) AS user_name
+FROM
+	flows_flowrevision r
+	JOIN flows_flow f ON f.id = r.flow_id
+	LEFT JOIN auth_user u ON u.id = r.created_by_id
+WHERE
+	f.org_id = $1 AND
+	f.uuid = $2 AND
+	f.is_active = TRUE AND
+	r.is_active = TRUE AND
+	r.revision < $3
+ORDER BY
+	r.revision DESC
+LIMIT
+	$4
+`
+
+// LoadFlowRevisions loads up to the passed in limit of the revisions of the passed in flow which are older than the
+// passed in revision, newest first. Pass 0 as before to start with the current revision.
+func LoadFlowRevisions(ctx context.Context, db *sqlx.DB, orgID OrgID, flowUUID assets.FlowUUID, before int, limit int) ([]*FlowRevision, error) {
+	if before <= 0 {
+		before = math.MaxInt32
+	}
+
+	rows, err := db.QueryxContext(ctx, selectFlowRevisionsSQL, orgID, flowUUID, before, limit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting revisions for flow: %s", flowUUID)
+	}
+	defer rows.Close()
+
+	revisions := make([]*FlowRevision, 0, limit)
+	for rows.Next() {
+		r := &FlowRevision{}
+		var definition string
+		author := &FlowRevisionAuthor{}
+
+		err := rows.Scan(&r.Revision, &r.SpecVersion, &r.CreatedOn, &definition, &author.ID, &author.Email, &author.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error scanning flow revision")
+		}
+
+		r.Definition = json.RawMessage(definition)
+		if author.ID != 0 {
+			r.CreatedBy = author
+		}
+		revisions = append(revisions, r)
+	}
+
+	return revisions, rows.Err()
+}
+
+// FlowRevisionRetention is how many revisions of each flow are kept when they are pruned. The most recent KeepLast
+// revisions are always kept, as is the last revision of each of the past KeepDays days.
+type FlowRevisionRetention struct {
+	KeepLast int
+	KeepDays int
+}
+
+// the number of flows whose revisions are pruned at a time
+const pruneFlowRevisionsBatchSize = 100
+
+const selectFlowsToPruneSQL = `
+SELECT
+	flow_id
+FROM
+	flows_flowrevision
+WHERE
+	flow_id > $1
+GROUP BY
+	flow_id
+HAVING
+	COUNT(*) > $2
+ORDER BY
+	flow_id
+LIMIT
+	$3
+`
+
+const deleteFlowRevisionsSQL = `
+DELETE FROM
+	flows_flowrevision
+WHERE
+	id IN (
+		SELECT id FROM (
+			SELECT
+				id,
+				created_on,
+				ROW_NUMBER() OVER (PARTITION BY flow_id ORDER BY revision DESC) AS recency,
+				ROW_NUMBER() OVER (PARTITION BY flow_id, DATE(created_on) ORDER BY revision DESC) AS day_recency
+			FROM
+				flows_flowrevision
+			WHERE
+				flow_id = ANY($1)
+		) r
+		WHERE
+			r.recency > $2 AND
+			NOT (r.day_recency = 1 AND r.created_on > NOW() - INTERVAL '1 day' * $3)
+	)
+`
+
+// PruneFlowRevisions deletes the revisions of every flow which aren't kept by the passed in retention policy, in
+// batches of flows. Returns the number of revisions deleted.
+func PruneFlowRevisions(ctx context.Context, db *sqlx.DB, retention *FlowRevisionRetention) (int, error) {
+	if retention.KeepLast < 1 {
+		return 0, errors.New("flow revision retention must keep at least one revision")
+	}
+
+	// plain ints rather than FlowIDs as a zero FlowID is written as NULL
+	deleted := 0
+	lastFlowID := int64(0)
+
+	for {
+		flowIDs := make([]int64, 0, pruneFlowRevisionsBatchSize)
+		err := db.SelectContext(ctx, &flowIDs, selectFlowsToPruneSQL, lastFlowID, retention.KeepLast, pruneFlowRevisionsBatchSize)
+		if err != nil {
+			return deleted, errors.Wrapf(err, "error selecting flows to prune revisions of")
+		}
+		if len(flowIDs) == 0 {
+			return deleted, nil
+		}
+
+		result, err := db.ExecContext(ctx, deleteFlowRevisionsSQL, pq.Array(flowIDs), retention.KeepLast, retention.KeepDays)
+		if err != nil {
+			return deleted, errors.Wrapf(err, "error deleting flow revisions")
+		}
+		count, _ := result.RowsAffected()
+		deleted += int(count)
+
+		lastFlowID = flowIDs[len(flowIDs)-1]
+	}
+}
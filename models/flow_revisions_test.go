@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowRevisions(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	var current int
+	err := db.Get(&current, `SELECT MAX(revision) FROM flows_flowrevision WHERE flow_id = $1`, FavoritesFlowID)
+	require.NoError(t, err)
+
+	// add revisions saved at various times in the past as copies of the current revision
+	addRevision := func(revision int, age string) {
+		db.MustExec(
+			`INSERT INTO flows_flowrevision(is_active, created_on, modified_on, definition, spec_version, revision, created_by_id, modified_by_id, flow_id)
+			SELECT TRUE, NOW() - $3::interval, NOW(), definition, spec_version, $2, 1, 1, flow_id FROM flows_flowrevision WHERE flow_id = $1 AND revision = $4`,
+			FavoritesFlowID, revision, age, current,
+		)
+	}
+	addRevision(current+1, "60 days")
+	addRevision(current+2, "10 days 1 second")
+	addRevision(current+3, "10 days")
+	addRevision(current+4, "1 hour")
+	addRevision(current+5, "0 seconds")
+
+	revisions, err := LoadFlowRevisions(ctx, db, Org1, FavoritesFlowUUID, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(revisions))
+	assert.Equal(t, current+5, revisions[0].Revision)
+	assert.Equal(t, current+4, revisions[1].Revision)
+	require.NotNil(t, revisions[0].CreatedBy)
+	assert.Equal(t, 1, revisions[0].CreatedBy.ID)
+	assert.NotEmpty(t, revisions[0].Definition)
+
+	// next page
+	revisions, err = LoadFlowRevisions(ctx, db, Org1, FavoritesFlowUUID, current+4, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(revisions))
+	assert.Equal(t, current+3, revisions[0].Revision)
+
+	// flows from other orgs aren't visible
+	revisions, err = LoadFlowRevisions(ctx, db, Org2, FavoritesFlowUUID, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(revisions))
+
+	_, err = PruneFlowRevisions(ctx, db, &FlowRevisionRetention{KeepLast: 0})
+	assert.EqualError(t, err, "flow revision retention must keep at least one revision")
+
+	var withoutRevisions int
+	err = db.Get(&withoutRevisions, `SELECT count(*) FROM flows_flow f WHERE NOT EXISTS (SELECT 1 FROM flows_flowrevision r WHERE r.flow_id = f.id)`)
+	require.NoError(t, err)
+
+	// keep the last two revisions and the last of each of the past 30 days
+	_, err = PruneFlowRevisions(ctx, db, &FlowRevisionRetention{KeepLast: 2, KeepDays: 30})
+	require.NoError(t, err)
+
+	revisions, err = LoadFlowRevisions(ctx, db, Org1, FavoritesFlowUUID, 0, 10)
+	require.NoError(t, err)
+
+	kept := make([]int, len(revisions))
+	for i, r := range revisions {
+		kept[i] = r.Revision
+	}
+	assert.Equal(t, []int{current + 5, current + 4, current + 3}, kept)
+
+	// every flow keeps at least its current revision
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flow f WHERE NOT EXISTS (SELECT 1 FROM flows_flowrevision r WHERE r.flow_id = f.id)`, nil, withoutRevisions)
+}
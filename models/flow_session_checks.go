@@ -0,0 +1,211 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/actions"
+	"github.com/nyaruka/mailroom/goflow"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// IncompatibleSession is a session which can't continue in the latest revision of a flow because one of its runs in
+// the flow is at a node which no longer exists or no longer does what the run is waiting on
+type IncompatibleSession struct {
+	SessionID SessionID      `json:"session_id"`
+	ContactID ContactID      `json:"contact_id"`
+	NodeUUID  flows.NodeUUID `json:"node_uuid"`
+	Reason    string         `json:"reason"`
+}
+
+// FlowSessionsCheck is the outcome of checking the sessions in a flow against its latest revision
+type FlowSessionsCheck struct {
+	FlowUUID     assets.FlowUUID        `json:"flow_uuid"`
+	Compatible   int                    `json:"compatible"`
+	Incompatible []*IncompatibleSession `json:"incompatible"`
+	Interrupted  int                    `json:"interrupted"`
+	CheckedOn    time.Time              `json:"checked_on"`
+}
+
+// the parts of a session we need to check whether its runs can continue in a new revision of a flow
+type checkedSession struct {
+	Runs []struct {
+		Flow   *assets.FlowReference `json:"flow"`
+		Status flows.RunStatus       `json:"status"`
+		Path   []struct {
+			NodeUUID flows.NodeUUID `json:"node_uuid"`
+		} `json:"path"`
+	} `json:"runs"`
+}
+
+// CheckFlowSessions checks whether the sessions with active runs in the passed in flow can continue in its latest
+// revision. Sessions always resume with the latest revision of a flow, so a session can continue if each of its runs in
+// the flow is at a node which still exists in that revision, by UUID, and still waits or enters a subflow as the run
+// expects. The sessions which can't are reported, and if interrupt is true, interrupted so that their contacts don't
+// fail to resume in the flow every time they reply.
+func CheckFlowSessions(ctx context.Context, db *sqlx.DB, orgID OrgID, flowUUID assets.FlowUUID, interrupt bool) (*FlowSessionsCheck, error) {
+	dbFlow, err := loadFlowByUUID(ctx, db, orgID, flowUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading flow: %s", flowUUID)
+	}
+	if dbFlow == nil || !dbFlow.IsActive() {
+		return nil, ErrNotFound
+	}
+
+	flow, err := goflow.ReadFlow(dbFlow.Definition())
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading latest revision of flow: %s", flowUUID)
+	}
+
+	rows, err := db.QueryxContext(ctx, selectSessionsInFlowSQL, orgID, dbFlow.ID())
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting sessions in flow: %s", flowUUID)
+	}
+	defer rows.Close()
+
+	check := &FlowSessionsCheck{FlowUUID: flowUUID, Incompatible: make([]*IncompatibleSession, 0)}
+
+	for rows.Next() {
+		var sessionID SessionID
+		var contactID ContactID
+		var output string
+		if err := rows.Scan(&sessionID, &contactID, &output); err != nil {
+			return nil, errors.Wrapf(err, "error scanning session")
+		}
+
+		session := &checkedSession{}
+		if err := json.Unmarshal([]byte(output), session); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling session: %d", sessionID)
+		}
+
+		nodeUUID, reason := checkSessionInFlow(session, flow)
+		if reason != "" {
+			check.Incompatible = append(check.Incompatible, &IncompatibleSession{SessionID: sessionID, ContactID: contactID, NodeUUID: nodeUUID, Reason: reason})
+		} else {
+			check.Compatible++
+		}
+	}
+	rows.Close()
+
+	if interrupt {
+		sessionIDs := make([]SessionID, len(check.Incompatible))
+		for i, s := range check.Incompatible {
+			sessionIDs[i] = s.SessionID
+		}
+
+		for i := 0; i < len(sessionIDs); i += interruptFlowSessionsBatchSize {
+			end := i + interruptFlowSessionsBatchSize
+			if end > len(sessionIDs) {
+				end = len(sessionIDs)
+			}
+
+			err = ExitSessions(ctx, db, sessionIDs[i:end], ExitInterrupted, time.Now())
+			if err != nil {
+				return check, errors.Wrapf(err, "error interrupting sessions which can't continue")
+			}
+			check.Interrupted = end
+		}
+	}
+
+	check.CheckedOn = time.Now()
+
+	logrus.WithField("org_id", orgID).WithField("flow_uuid", flowUUID).WithField("compatible", check.Compatible).WithField("incompatible", len(check.Incompatible)).Info("checked sessions against latest flow revision")
+
+	return check, nil
+}
+
+const (
+	flowSessionsCheckKey = "flow_sessions_check:%d:%s"
+
+	// how long we keep the result of a check around for
+	flowSessionsCheckExpiration = 24 * time.Hour
+)
+
+// SaveFlowSessionsCheck saves the result of checking the sessions in a flow so that it can be fetched once it's done
+func SaveFlowSessionsCheck(rc redis.Conn, orgID OrgID, check *FlowSessionsCheck) error {
+	checkJSON, err := json.Marshal(check)
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.Do("set", fmt.Sprintf(flowSessionsCheckKey, orgID, check.FlowUUID), checkJSON, "ex", int(flowSessionsCheckExpiration/time.Second))
+	return errors.Wrapf(err, "error saving sessions check for flow: %s", check.FlowUUID)
+}
+
+// GetFlowSessionsCheck returns the result of the last check of the sessions in the passed in flow, or nil if it hasn't
+// been checked recently
+func GetFlowSessionsCheck(rc redis.Conn, orgID OrgID, flowUUID assets.FlowUUID) (*FlowSessionsCheck, error) {
+	checkJSON, err := redis.Bytes(rc.Do("get", fmt.Sprintf(flowSessionsCheckKey, orgID, flowUUID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading sessions check for flow: %s", flowUUID)
+	}
+
+	check := &FlowSessionsCheck{}
+	if err := json.Unmarshal(checkJSON, check); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling sessions check for flow: %s", flowUUID)
+	}
+	return check, nil
+}
+
+// checks whether the active runs of the passed in session in the passed in flow can continue in it, returning the node
+// and reason if not
+func checkSessionInFlow(session *checkedSession, flow flows.Flow) (flows.NodeUUID, string) {
+	for _, run := range session.Runs {
+		if run.Flow == nil || run.Flow.UUID != flow.UUID() || len(run.Path) == 0 {
+			continue
+		}
+		if run.Status != flows.RunStatusWaiting && run.Status != flows.RunStatusActive {
+			continue
+		}
+
+		nodeUUID := run.Path[len(run.Path)-1].NodeUUID
+		node := flow.GetNode(nodeUUID)
+		if node == nil {
+			return nodeUUID, "node no longer exists"
+		}
+
+		if run.Status == flows.RunStatusWaiting {
+			if node.Router() == nil || node.Router().Wait() == nil {
+				return nodeUUID, "node no longer has a wait"
+			}
+		} else if !nodeEntersSubflow(node) {
+			return nodeUUID, "node no longer enters a subflow"
+		}
+	}
+	return "", ""
+}
+
+// whether the passed in node starts a subflow, which is where parent runs are while their child runs are active
+func nodeEntersSubflow(node flows.Node) bool {
+	for _, a := range node.Actions() {
+		if a.Type() == actions.TypeEnterFlow {
+			return true
+		}
+	}
+	return false
+}
+
+const selectSessionsInFlowSQL = `
+SELECT
+	s.id,
+	s.contact_id,
+	COALESCE(s.output, '{}')
+FROM
+	flows_flowsession s
+WHERE
+	s.org_id = $1 AND
+	s.status = 'W' AND
+	(s.current_flow_id = $2 OR s.id IN (SELECT session_id FROM flows_flowrun WHERE flow_id = $2 AND is_active = TRUE))
+ORDER BY
+	s.id
+`
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFlowSessions(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	insertSession := func(contactID ContactID, flowID FlowID, runStatus string, nodeUUID flows.NodeUUID) SessionID {
+		output := fmt.Sprintf(`{"runs": [{"flow": {"uuid": "%s", "name": "Favorites"}, "status": "%s", "path": [{"node_uuid": "%s"}]}]}`, FavoritesFlowUUID, runStatus, nodeUUID)
+
+		var sessionID SessionID
+		err := db.Get(&sessionID, `INSERT INTO flows_flowsession(uuid, session_type, org_id, contact_id, status, responded, created_on, current_flow_id, output) VALUES($1, 'M', $2, $3, 'W', FALSE, NOW(), $4, $5) RETURNING id`, uuids.New(), Org1, contactID, flowID, output)
+		require.NoError(t, err)
+		return sessionID
+	}
+
+	// waiting at the color question which still exists
+	insertSession(CathyID, FavoritesFlowID, "waiting", "8cc3371e-fc76-4fbb-9f7e-e2315ff49e07")
+
+	// waiting at a node which has since been removed
+	bobSessionID := insertSession(BobID, FavoritesFlowID, "waiting", "3dcccbb4-d29c-41dd-a01f-16d814c9ab82")
+
+	// a parent run at a node which no longer enters a subflow
+	georgeSessionID := insertSession(GeorgeID, FavoritesFlowID, "active", "8cc3371e-fc76-4fbb-9f7e-e2315ff49e07")
+
+	// in another flow entirely
+	insertSession(AlexandriaID, PickNumberFlowID, "waiting", "3dcccbb4-d29c-41dd-a01f-16d814c9ab82")
+
+	check, err := CheckFlowSessions(ctx, db, Org1, FavoritesFlowUUID, false)
+	require.NoError(t, err)
+	assert.False(t, check.CheckedOn.IsZero())
+
+	check.CheckedOn = time.Time{}
+	assert.Equal(t, &FlowSessionsCheck{
+		FlowUUID:   FavoritesFlowUUID,
+		Compatible: 1,
+		Incompatible: []*IncompatibleSession{
+			{SessionID: bobSessionID, ContactID: BobID, NodeUUID: "3dcccbb4-d29c-41dd-a01f-16d814c9ab82", Reason: "node no longer exists"},
+			{SessionID: georgeSessionID, ContactID: GeorgeID, NodeUUID: "8cc3371e-fc76-4fbb-9f7e-e2315ff49e07", Reason: "node no longer enters a subflow"},
+		},
+		Interrupted: 0,
+	}, check)
+
+	// nothing was interrupted
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE status = 'W'`, nil, 4)
+
+	// now interrupt the sessions which can't continue
+	check, err = CheckFlowSessions(ctx, db, Org1, FavoritesFlowUUID, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, check.Compatible)
+	assert.Equal(t, 2, len(check.Incompatible))
+	assert.Equal(t, 2, check.Interrupted)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE status = 'I' AND contact_id IN ($1, $2)`, []interface{}{BobID, GeorgeID}, 2)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE status = 'W'`, nil, 2)
+
+	// flows which don't exist can't be checked
+	_, err = CheckFlowSessions(ctx, db, Org1, "a45a1f63-6ecd-4b6c-9e3f-2cb4d0b7ac1f", false)
+	assert.Equal(t, ErrNotFound, err)
+
+	// nothing saved yet
+	saved, err := GetFlowSessionsCheck(rc, Org1, FavoritesFlowUUID)
+	assert.NoError(t, err)
+	assert.Nil(t, saved)
+
+	err = SaveFlowSessionsCheck(rc, Org1, check)
+	require.NoError(t, err)
+
+	saved, err = GetFlowSessionsCheck(rc, Org1, FavoritesFlowUUID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, saved.Compatible)
+	assert.Equal(t, 2, len(saved.Incompatible))
+	assert.Equal(t, bobSessionID, saved.Incompatible[0].SessionID)
+
+	// checks are saved per org
+	saved, err = GetFlowSessionsCheck(rc, Org2, FavoritesFlowUUID)
+	assert.NoError(t, err)
+	assert.Nil(t, saved)
+}
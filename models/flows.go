@@ -4,11 +4,13 @@ import (
 	"context"
 	"database/sql/driver"
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/config"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -27,6 +29,31 @@ const (
 
 	FlowConfigIVRRetryMinutes = "ivr_retry"
 
+	// FlowConfigIVRInputRetries is the flow config key for how many times a caller is prompted again when they give
+	// no input or invalid input to a digits wait, e.g. "ivr_input_retries": 2. Callers who run out of retries resume
+	// the flow with the input "retries_exhausted".
+	FlowConfigIVRInputRetries = "ivr_input_retries"
+
+	// FlowConfigIVRNoInputPrompt is the flow config key for what is said to a caller who gave no input before retrying
+	FlowConfigIVRNoInputPrompt = "ivr_no_input_prompt"
+
+	// FlowConfigIVRInvalidInputPrompt is the flow config key for what is said to a caller who gave invalid input before retrying
+	FlowConfigIVRInvalidInputPrompt = "ivr_invalid_input_prompt"
+
+	// FlowConfigOnExpire is the flow config key for what happens when a run of the flow which was started as a subflow
+	// expires, e.g. "on_expire": "exit"
+	FlowConfigOnExpire = "on_expire"
+
+	// FlowOnExpireContinue is the default, the parent run continues down the expired route of its subflow node
+	FlowOnExpireContinue = "continue"
+
+	// FlowOnExpireExit means the whole session is exited as expired, including parent runs
+	FlowOnExpireExit = "exit"
+
+	// FlowConfigFinishSessions is the flow config key set on soft deleted flows whose sessions are being left to
+	// finish rather than interrupted, e.g. "finish_sessions": true
+	FlowConfigFinishSessions = "finish_sessions"
+
 	NilFlowID = FlowID(0)
 )
 
@@ -47,7 +74,11 @@ type Flow struct {
 		FlowType       FlowType        `json:"flow_type"`
 		Definition     json.RawMessage `json:"definition"`
 		IgnoreTriggers bool            `json:"ignore_triggers"`
+		IsActive       bool            `json:"is_active"`
 	}
+
+	splits     map[flows.NodeUUID]*RandomSplit
+	splitsOnce sync.Once
 }
 
 // ID returns the ID for this flow
@@ -71,6 +102,15 @@ func (f *Flow) Version() string { return f.f.Version }
 // SetDefinition sets our definition from the passed in definition
 func (f *Flow) SetDefinition(definition json.RawMessage) {
 	f.f.Definition = definition
+	f.splitsOnce = sync.Once{}
+}
+
+// RandomSplits returns the random split nodes in this flow, keyed by node UUID
+func (f *Flow) RandomSplits() map[flows.NodeUUID]*RandomSplit {
+	f.splitsOnce.Do(func() {
+		f.splits = readRandomSplits(f.f.Definition)
+	})
+	return f.splits
 }
 
 // IntConfigValue returns the value for the key passed in as an int. If the value
@@ -93,6 +133,15 @@ func (f *Flow) StringConfigValue(key string, defaultValue string) string {
 // IgnoreTriggers returns whether this flow ignores triggers
 func (f *Flow) IgnoreTriggers() bool { return f.f.IgnoreTriggers }
 
+// IsActive returns whether this flow is active, i.e. hasn't been soft deleted
+func (f *Flow) IsActive() bool { return f.f.IsActive }
+
+// whether this flow has been soft deleted but sessions in it are being left to finish
+func (f *Flow) finishesSessions() bool {
+	finish, _ := f.f.Config.Get(FlowConfigFinishSessions, false).(bool)
+	return !f.f.IsActive && finish
+}
+
 // FlowReference return a flow reference for this flow
 func (f *Flow) FlowReference() *assets.FlowReference {
 	return assets.NewFlowReference(f.UUID(), f.Name())
@@ -111,6 +160,103 @@ func flowIDForUUID(ctx context.Context, tx *sqlx.Tx, org *OrgAssets, flowUUID as
 	return flowID, err
 }
 
+// SoftDeleteFlow marks the passed in flow as inactive so that it can no longer be started or triggered. If interrupt
+// is true, the sessions currently waiting in the flow are interrupted, otherwise they are left to finish. Returns
+// the number of sessions interrupted.
+func SoftDeleteFlow(ctx context.Context, db *sqlx.DB, orgID OrgID, flowUUID assets.FlowUUID, interrupt bool) (int, error) {
+	flowIDs := make([]FlowID, 0, 1)
+	err := db.SelectContext(ctx, &flowIDs, softDeleteFlowSQL, orgID, flowUUID, !interrupt)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deactivating flow: %s", flowUUID)
+	}
+	if len(flowIDs) == 0 {
+		return 0, ErrNotFound
+	}
+	flowID := flowIDs[0]
+
+	if !interrupt {
+		return 0, nil
+	}
+
+	sessionIDs := make([]SessionID, 0)
+	err = db.SelectContext(ctx, &sessionIDs, selectWaitingSessionsForFlowSQL, orgID, flowID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error selecting sessions in flow: %d", flowID)
+	}
+
+	for i := 0; i < len(sessionIDs); i += interruptFlowSessionsBatchSize {
+		end := i + interruptFlowSessionsBatchSize
+		if end > len(sessionIDs) {
+			end = len(sessionIDs)
+		}
+
+		err = ExitSessions(ctx, db, sessionIDs[i:end], ExitInterrupted, time.Now())
+		if err != nil {
+			return i, errors.Wrapf(err, "error interrupting sessions in flow: %d", flowID)
+		}
+	}
+
+	logrus.WithField("org_id", orgID).WithField("flow_id", flowID).WithField("sessions", len(sessionIDs)).Info("interrupted sessions of soft deleted flow")
+
+	return len(sessionIDs), nil
+}
+
+// RestoreFlow restores the passed in soft deleted flow so that it can be started and triggered again
+func RestoreFlow(ctx context.Context, db *sqlx.DB, orgID OrgID, flowUUID assets.FlowUUID) error {
+	res, err := db.ExecContext(ctx, restoreFlowSQL, orgID, flowUUID)
+	if err != nil {
+		return errors.Wrapf(err, "error restoring flow: %s", flowUUID)
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const softDeleteFlowSQL = `
+UPDATE
+	flows_flow
+SET
+	is_active = FALSE,
+	metadata = (COALESCE(metadata, '{}')::jsonb || jsonb_build_object('finish_sessions', $3::bool))::text,
+	modified_on = NOW()
+WHERE
+	org_id = $1 AND
+	uuid = $2 AND
+	is_active = TRUE
+RETURNING
+	id
+`
+
+const restoreFlowSQL = `
+UPDATE
+	flows_flow
+SET
+	is_active = TRUE,
+	metadata = (COALESCE(metadata, '{}')::jsonb - 'finish_sessions')::text,
+	modified_on = NOW()
+WHERE
+	org_id = $1 AND
+	uuid = $2 AND
+	is_active = FALSE
+`
+
+// how many sessions we interrupt at a time when soft deleting a flow
+const interruptFlowSessionsBatchSize = 100
+
+const selectWaitingSessionsForFlowSQL = `
+SELECT
+	id
+FROM
+	flows_flowsession
+WHERE
+	org_id = $1 AND
+	current_flow_id = $2 AND
+	status = 'W'
+ORDER BY
+	id
+`
+
 func loadFlowByUUID(ctx context.Context, db *sqlx.DB, orgID OrgID, flowUUID assets.FlowUUID) (*Flow, error) {
 	return loadFlow(ctx, db, selectFlowByUUIDSQL, orgID, flowUUID)
 }
@@ -135,7 +281,18 @@ func loadFlow(ctx context.Context, db *sqlx.DB, sql string, orgID OrgID, arg int
 		return nil, nil
 	}
 
-	err = readJSONRow(rows, &flow.f)
+	var flowJSON string
+	if err := rows.Scan(&flowJSON); err != nil {
+		return nil, errors.Wrapf(err, "error scanning flow by: %s", arg)
+	}
+
+	// huge definitions take many times their size in memory once read, so refuse them rather than risk running out
+	maxBytes := config.Mailroom.MaxFlowDefinitionBytes
+	if maxBytes > 0 && len(flowJSON) > maxBytes {
+		return nil, errors.Errorf("flow definition by: %s is %d bytes which exceeds the limit of %d", arg, len(flowJSON), maxBytes)
+	}
+
+	err = readJSON([]byte(flowJSON), &flow.f)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error reading flow definition by: %s", arg)
 	}
@@ -151,6 +308,7 @@ SELECT ROW_TO_JSON(r) FROM (SELECT
 	uuid, 
 	name,
 	ignore_triggers,
+	is_active,
 	flow_type,
 	fr.spec_version as version,
 	coalesce(metadata, '{}')::jsonb as config,
@@ -188,7 +346,6 @@ LEFT JOIN (
 WHERE
     org_id = $1 AND
 	uuid = $2 AND
-	is_active = TRUE AND
 	is_archived = FALSE
 ) r;`
 
@@ -198,6 +355,7 @@ SELECT ROW_TO_JSON(r) FROM (SELECT
 	uuid, 
 	name,
 	ignore_triggers,
+	is_active,
 	flow_type,
 	fr.spec_version as version,
 	coalesce(metadata, '{}')::jsonb as config,
@@ -235,7 +393,6 @@ LEFT JOIN (
 WHERE
     org_id = $1 AND
 	id = $2 AND
-	is_active = TRUE AND
 	is_archived = FALSE
 ) r;`
 
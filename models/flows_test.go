@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/config"
 	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/stretchr/testify/assert"
@@ -56,6 +58,14 @@ func TestFlows(t *testing.T) {
 			assert.Nil(t, flow)
 		}
 	}
+
+	// flows with definitions over our limit aren't loaded
+	config.Mailroom.MaxFlowDefinitionBytes = 100
+	defer func() { config.Mailroom.MaxFlowDefinitionBytes = 10 * 1024 * 1024 }()
+
+	_, err := loadFlowByUUID(ctx, db, Org1, FavoritesFlowUUID)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the limit of 100")
 }
 
 func TestGetFlowUUID(t *testing.T) {
@@ -86,3 +96,80 @@ func TestGetFlowUUID(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, FavoritesFlowID, id)
 }
+
+func TestSoftDeleteFlow(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	insertSession := func(contactID ContactID, flowID FlowID) {
+		db.MustExec(`INSERT INTO flows_flowsession(uuid, session_type, org_id, contact_id, status, responded, created_on, current_flow_id) VALUES($1, 'M', $2, $3, 'W', FALSE, NOW(), $4);`, uuids.New(), Org1, contactID, flowID)
+	}
+	insertSession(CathyID, FavoritesFlowID)
+	insertSession(BobID, FavoritesFlowID)
+	insertSession(GeorgeID, PickNumberFlowID)
+
+	// deleting a flow and leaving its sessions to finish
+	interrupted, err := SoftDeleteFlow(ctx, db, Org1, FavoritesFlowUUID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, interrupted)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE status = 'W'`, nil, 3)
+
+	// the flow can't be started but sessions in it can still load it
+	org, _ := NewOrgAssets(ctx, db, Org1, nil)
+	_, err = org.FlowByID(FavoritesFlowID)
+	assert.Equal(t, ErrNotFound, err)
+
+	flow, err := org.SessionFlowByID(FavoritesFlowID)
+	assert.NoError(t, err)
+	assert.False(t, flow.IsActive())
+
+	_, err = org.SessionFlowByUUID(FavoritesFlowUUID)
+	assert.NoError(t, err)
+
+	// but the engine can't load it to start new runs in it
+	_, err = org.Flow(FavoritesFlowUUID)
+	assert.Equal(t, ErrNotFound, err)
+
+	// except for sessions being resumed in it
+	sa, err := ResumeSessionAssets(org, flow)
+	assert.NoError(t, err)
+	f, err := sa.Flows().Get(FavoritesFlowUUID)
+	assert.NoError(t, err)
+	assert.Equal(t, FavoritesFlowUUID, f.UUID())
+	_, err = sa.Flows().Get(PickNumberFlowUUID)
+	assert.NoError(t, err)
+
+	// can't delete a flow twice
+	_, err = SoftDeleteFlow(ctx, db, Org1, FavoritesFlowUUID, true)
+	assert.Equal(t, ErrNotFound, err)
+
+	// restore it and delete it again but this time interrupting its sessions
+	err = RestoreFlow(ctx, db, Org1, FavoritesFlowUUID)
+	assert.NoError(t, err)
+
+	interrupted, err = SoftDeleteFlow(ctx, db, Org1, FavoritesFlowUUID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, interrupted)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE status = 'W'`, nil, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE status = 'I' AND current_flow_id = $1`, []interface{}{FavoritesFlowID}, 2)
+
+	// now sessions can't load it either
+	org, _ = NewOrgAssets(ctx, db, Org1, nil)
+	_, err = org.SessionFlowByID(FavoritesFlowID)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = org.SessionFlowByUUID(FavoritesFlowUUID)
+	assert.Equal(t, ErrNotFound, err)
+
+	// restoring makes it available again
+	err = RestoreFlow(ctx, db, Org1, FavoritesFlowUUID)
+	assert.NoError(t, err)
+
+	org, _ = NewOrgAssets(ctx, db, Org1, nil)
+	flow, err = org.FlowByID(FavoritesFlowID)
+	assert.NoError(t, err)
+	assert.True(t, flow.IsActive())
+	assert.Equal(t, "missing", flow.StringConfigValue(FlowConfigFinishSessions, "missing"))
+
+	// can't restore a flow which isn't deleted
+	err = RestoreFlow(ctx, db, Org1, FavoritesFlowUUID)
+	assert.Equal(t, ErrNotFound, err)
+}
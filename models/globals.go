@@ -3,6 +3,10 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nyaruka/goflow/assets"
@@ -30,6 +34,73 @@ func (g *Global) UnmarshalJSON(data []byte) error { return json.Unmarshal(data,
 // MarshalJSON is our marshaller for json data
 func (g *Global) MarshalJSON() ([]byte, error) { return json.Marshal(g.g) }
 
+// the org config key for custom metadata which is exposed to flows, e.g.
+//
+//   "metadata": {"support_hours": "9am - 5pm", "support_phone": "+250788123123"}
+//
+const configMetadata = "metadata"
+
+var orgGlobalKeyRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// newGlobal creates a new global which isn't backed by the database
+func newGlobal(key, name, value string) *Global {
+	g := &Global{}
+	g.g.Key = key
+	g.g.Name = name
+	g.g.Value = value
+	return g
+}
+
+// orgGlobals returns the attributes of the passed in org which are exposed to flows as globals, e.g. @globals.org_name.
+// These are the org's name, country, timezone and brand, whether its office is open if it has office hours, and any
+// custom metadata in its config. Globals defined by the org take precedence over these.
+func orgGlobals(org *Org, existing []assets.Global) []assets.Global {
+	keys := make(map[string]bool, len(existing))
+	for _, g := range existing {
+		keys[g.Key()] = true
+	}
+
+	globals := make([]assets.Global, 0, len(existing)+4)
+	globals = append(globals, existing...)
+
+	add := func(key, name, value string) {
+		if value != "" && !keys[key] {
+			globals = append(globals, newGlobal(key, name, value))
+			keys[key] = true
+		}
+	}
+
+	add("org_name", "Org Name", org.Name())
+	add("org_country", "Org Country", string(org.DefaultCountry()))
+	if org.Timezone() != nil {
+		add("org_timezone", "Org Timezone", org.Timezone().String())
+	}
+	add("org_brand", "Org Brand", org.Brand())
+
+	// assets are rebuilt every few seconds so this is only ever a few seconds stale
+	if hours := org.OfficeHours(); hours != nil {
+		add("org_office_open", "Org Office Open", strconv.FormatBool(hours.IsOpen(time.Now())))
+	}
+
+	metadata, _ := org.config[configMetadata].(map[string]interface{})
+	metadataKeys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		metadataKeys = append(metadataKeys, key)
+	}
+	sort.Strings(metadataKeys)
+
+	for _, key := range metadataKeys {
+		strValue, isStr := metadata[key].(string)
+		if !isStr || !orgGlobalKeyRegex.MatchString(key) {
+			logrus.WithField("org_id", org.ID()).WithField("key", key).Warn("ignoring invalid org metadata")
+			continue
+		}
+		add("org_"+key, "Org "+strings.Title(strings.Replace(key, "_", " ", -1)), strValue)
+	}
+
+	return globals
+}
+
 // loads the globals for the passed in org
 func loadGlobals(ctx context.Context, db sqlx.Queryer, orgID OrgID) ([]assets.Global, error) {
 	start := time.Now()
@@ -26,3 +26,36 @@ func TestGlobals(t *testing.T) {
 	assert.Equal(t, "Org Name", globals[1].Name())
 	assert.Equal(t, "Nyaruka", globals[1].Value())
 }
+
+func TestOrgGlobals(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	db.MustExec(`UPDATE orgs_org SET brand = 'rapidpro', config = '{"metadata": {"support_hours": "9am - 5pm", "Bad Key": "x", "count": 3}}' WHERE id = $1`, Org1)
+
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	assert.NoError(t, err)
+
+	globals, err := org.Globals()
+	assert.NoError(t, err)
+
+	values := make(map[string]string, len(globals))
+	for _, g := range globals {
+		values[g.Key()] = g.Value()
+	}
+
+	// org defined globals take precedence
+	assert.Equal(t, "Nyaruka", values["org_name"])
+	assert.Equal(t, "A213CD78", values["access_token"])
+
+	assert.Equal(t, "rapidpro", values["org_brand"])
+	assert.Equal(t, org.Org().Timezone().String(), values["org_timezone"])
+	assert.Equal(t, string(org.Org().DefaultCountry()), values["org_country"])
+	assert.Equal(t, "9am - 5pm", values["org_support_hours"])
+
+	// invalid metadata is ignored
+	assert.NotContains(t, values, "org_Bad Key")
+	assert.NotContains(t, values, "org_count")
+
+	// no office hours configured
+	assert.NotContains(t, values, "org_office_open")
+}
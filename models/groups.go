@@ -165,3 +165,52 @@ func ContactIDsForGroupIDs(ctx context.Context, tx Queryer, groupIDs []GroupID)
 
 	return contactIDs, nil
 }
+
+const selectContactIDsForGroupIDsSQL = `
+SELECT contact_id FROM contacts_contactgroup_contacts WHERE contactgroup_id = ANY($1)
+UNION
+SELECT unnest($2::int[])
+ORDER BY 1
+`
+
+const countContactIDsForGroupIDsSQL = `
+SELECT count(*) FROM (
+	SELECT contact_id FROM contacts_contactgroup_contacts WHERE contactgroup_id = ANY($1)
+	UNION
+	SELECT unnest($2::int[])
+) c
+`
+
+// CountContactIDsForGroupIDs returns the number of unique contacts that are in the passed in groups or are one of the
+// passed in other contacts
+func CountContactIDsForGroupIDs(ctx context.Context, tx Queryer, groupIDs []GroupID, otherIDs []ContactID) (int, error) {
+	var count int
+	err := tx.GetContext(ctx, &count, countContactIDsForGroupIDsSQL, pq.Array(groupIDs), pq.Array(otherIDs))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error counting contacts for groups")
+	}
+	return count, nil
+}
+
+// IterateContactIDsForGroupIDs calls the passed in function with each unique contact that is in the passed in groups
+// or is one of the passed in other contacts, in order of ID. Unlike ContactIDsForGroupIDs the contacts are read as
+// they are needed so large groups don't have to be held in memory.
+func IterateContactIDsForGroupIDs(ctx context.Context, tx Queryer, groupIDs []GroupID, otherIDs []ContactID, fn func(ContactID) error) error {
+	rows, err := tx.QueryxContext(ctx, selectContactIDsForGroupIDsSQL, pq.Array(groupIDs), pq.Array(otherIDs))
+	if err != nil {
+		return errors.Wrapf(err, "error selecting contacts for groups")
+	}
+	defer rows.Close()
+
+	var contactID ContactID
+	for rows.Next() {
+		if err := rows.Scan(&contactID); err != nil {
+			return errors.Wrapf(err, "error scanning contact id")
+		}
+		if err := fn(contactID); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrapf(rows.Err(), "error iterating contacts for groups")
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGroups(t *testing.T) {
@@ -34,3 +35,44 @@ func TestGroups(t *testing.T) {
 		assert.Equal(t, tc.Query, group.Query())
 	}
 }
+
+func TestContactIDsForGroupIDs(t *testing.T) {
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	var doctors int
+	err := db.Get(&doctors, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1`, DoctorsGroupID)
+	require.NoError(t, err)
+
+	// other contacts are only counted if they aren't already in the groups
+	var georgeIsDoctor bool
+	err = db.Get(&georgeIsDoctor, `SELECT EXISTS(SELECT 1 FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1 AND contact_id = $2)`, DoctorsGroupID, GeorgeID)
+	require.NoError(t, err)
+
+	expected := doctors
+	if !georgeIsDoctor {
+		expected++
+	}
+
+	count, err := CountContactIDsForGroupIDs(ctx, db, []GroupID{DoctorsGroupID}, []ContactID{GeorgeID})
+	require.NoError(t, err)
+	assert.Equal(t, expected, count)
+
+	iterated := make([]ContactID, 0)
+	err = IterateContactIDsForGroupIDs(ctx, db, []GroupID{DoctorsGroupID}, []ContactID{GeorgeID}, func(id ContactID) error {
+		iterated = append(iterated, id)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, count, len(iterated))
+	assert.Contains(t, iterated, GeorgeID)
+
+	// contacts are unique and in order
+	for i := 1; i < len(iterated); i++ {
+		assert.True(t, iterated[i] > iterated[i-1])
+	}
+
+	ids, err := ContactIDsForGroupIDs(ctx, db, []GroupID{DoctorsGroupID})
+	require.NoError(t, err)
+	assert.Equal(t, doctors, len(ids))
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/pkg/errors"
+)
+
+// the org config key for inferring the languages of contacts without one from their messages, e.g.
+//
+//   "language_detection": {"detector": "cld", "min_length": 20}
+//
+// where detector is the name of a registered detector, and messages shorter than min_length characters are ignored
+// as detection of short messages is unreliable. Only languages allowed by the org are ever set.
+const configLanguageDetection = "language_detection"
+
+// the default shortest message we try to detect the language of
+const defaultLanguageDetectionMinLength = 20
+
+// LanguageDetector detects the language of a message, returning envs.NilLanguage if it can't
+type LanguageDetector interface {
+	Detect(ctx context.Context, text string) (envs.Language, error)
+}
+
+var languageDetectors = make(map[string]LanguageDetector)
+
+// RegisterLanguageDetector registers a named language detector which can be selected per org
+func RegisterLanguageDetector(name string, detector LanguageDetector) {
+	languageDetectors[name] = detector
+}
+
+// LanguageDetection is how an org infers the languages of its contacts
+type LanguageDetection struct {
+	Detector  LanguageDetector
+	MinLength int
+}
+
+// LanguageDetection returns how this org infers the languages of its contacts, or nil if it doesn't
+func (o *Org) LanguageDetection() *LanguageDetection {
+	detection, _ := o.config[configLanguageDetection].(map[string]interface{})
+	name, _ := detection["detector"].(string)
+
+	detector := languageDetectors[name]
+	if detector == nil {
+		return nil
+	}
+
+	d := &LanguageDetection{Detector: detector, MinLength: defaultLanguageDetectionMinLength}
+	if minLength, isNumber := detection["min_length"].(float64); isNumber && minLength >= 0 {
+		d.MinLength = int(minLength)
+	}
+	return d
+}
+
+// InferContactLanguage sets the language of the passed in contact, if they don't have one, to the language detected
+// in the passed in message text. Returns the language changed event if their language was set, or nil if it wasn't.
+func InferContactLanguage(ctx context.Context, db *sqlx.DB, org *OrgAssets, contact *flows.Contact, text string) (*events.ContactLanguageChangedEvent, error) {
+	if contact.Language() != envs.NilLanguage {
+		return nil, nil
+	}
+
+	detection := org.Org().LanguageDetection()
+	text = strings.TrimSpace(text)
+	if detection == nil || text == "" || utf8.RuneCountInString(text) < detection.MinLength {
+		return nil, nil
+	}
+
+	lang, err := detection.Detector.Detect(ctx, text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error detecting language of message")
+	}
+	if lang == envs.NilLanguage || !isAllowedLanguage(org, lang) {
+		return nil, nil
+	}
+
+	_, err = db.ExecContext(ctx, `UPDATE contacts_contact SET language = $2, modified_on = NOW() WHERE id = $1`, contact.ID(), lang)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error updating language of contact: %d", contact.ID())
+	}
+	contact.SetLanguage(lang)
+
+	// dynamic groups can be based on language
+	err = CalculateDynamicGroups(ctx, db, org, contact)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error calculating dynamic groups of contact: %d", contact.ID())
+	}
+
+	return events.NewContactLanguageChanged(lang), nil
+}
+
+func isAllowedLanguage(org *OrgAssets, lang envs.Language) bool {
+	for _, l := range org.Org().AllowedLanguages() {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
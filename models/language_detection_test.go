@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLanguageDetector map[string]envs.Language
+
+func (d testLanguageDetector) Detect(ctx context.Context, text string) (envs.Language, error) {
+	return d[text], nil
+}
+
+func TestInferContactLanguage(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	RegisterLanguageDetector("test", testLanguageDetector{
+		"Bonjour, je voudrais des informations": envs.Language("fra"),
+		"Hola, quisiera más información":        envs.Language("spa"),
+		"Hi, I would like more information":     envs.Language("eng"),
+	})
+
+	db.MustExec(`INSERT INTO orgs_language(is_active, created_on, modified_on, name, iso_code, created_by_id, modified_by_id, org_id)
+									VALUES(TRUE, NOW(), NOW(), 'French', 'fra', 1, 1, $1), (TRUE, NOW(), NOW(), 'English', 'eng', 1, 1, $1);`, Org1)
+	db.MustExec(`UPDATE contacts_contact SET language = NULL WHERE id = $1`, CathyID)
+
+	loadContact := func(org *OrgAssets) *flows.Contact {
+		sa, err := GetSessionAssets(org)
+		require.NoError(t, err)
+		contacts, err := LoadContacts(ctx, db, org, []ContactID{CathyID})
+		require.NoError(t, err)
+		contact, err := contacts[0].FlowContact(org, sa)
+		require.NoError(t, err)
+		return contact
+	}
+
+	// org doesn't detect languages
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+	assert.Nil(t, org.Org().LanguageDetection())
+
+	contact := loadContact(org)
+	event, err := InferContactLanguage(ctx, db, org, contact, "Bonjour, je voudrais des informations")
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"language_detection": {"detector": "test"}}' WHERE id = $1`, Org1)
+	org, err = NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 20, org.Org().LanguageDetection().MinLength)
+
+	// too short to detect, or a language the org doesn't have
+	for _, text := range []string{"Bonjour", "Hola, quisiera más información"} {
+		event, err = InferContactLanguage(ctx, db, org, contact, text)
+		assert.NoError(t, err)
+		assert.Nil(t, event)
+	}
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND language IS NULL`, []interface{}{CathyID}, 1)
+
+	event, err = InferContactLanguage(ctx, db, org, contact, "Bonjour, je voudrais des informations")
+	assert.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, envs.Language("fra"), event.Language)
+	assert.Equal(t, envs.Language("fra"), contact.Language())
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND language = 'fra'`, []interface{}{CathyID}, 1)
+
+	// once a contact has a language it isn't changed
+	contact = loadContact(org)
+	event, err = InferContactLanguage(ctx, db, org, contact, "Hi, I would like more information")
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND language = 'fra'`, []interface{}{CathyID}, 1)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{}' WHERE id = $1`, Org1)
+	db.MustExec(`DELETE FROM orgs_language WHERE org_id = $1`, Org1)
+}
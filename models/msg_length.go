@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/gsm7"
+)
+
+const (
+	// ChannelConfigMaxLength is the config key for the maximum length of messages a channel can send, longer messages
+	// are truncated when sent, e.g. "max_length": 640
+	ChannelConfigMaxLength = "max_length"
+)
+
+// MsgEncoding is the encoding a message will be sent with as SMS
+type MsgEncoding string
+
+// the encodings a message can be sent with as SMS
+const (
+	MsgEncodingGSM7 = MsgEncoding("gsm7")
+	MsgEncodingUCS2 = MsgEncoding("ucs2")
+)
+
+// MsgLengthWarningType is the type of a warning about the length of a message
+type MsgLengthWarningType string
+
+// the types of warnings about the length of a message
+const (
+	MsgLengthWarningSegments  = MsgLengthWarningType("segments")
+	MsgLengthWarningTruncated = MsgLengthWarningType("truncated")
+)
+
+// MsgLengthWarning is a warning that a message will be split into more SMS segments than the passed in limit, or
+// truncated when sent on a channel with a maximum length
+type MsgLengthWarning struct {
+	Type    MsgLengthWarningType     `json:"type"`
+	Limit   int                      `json:"limit"`
+	Channel *assets.ChannelReference `json:"channel,omitempty"`
+}
+
+// MsgLength is how a message will be sent, i.e. how many SMS segments it will need and with which encoding, and any
+// warnings about its length
+type MsgLength struct {
+	Encoding MsgEncoding         `json:"encoding"`
+	Length   int                 `json:"length"`
+	Segments int                 `json:"segments"`
+	Warnings []*MsgLengthWarning `json:"warnings"`
+}
+
+// CheckMsgLength checks how the passed in text will be sent, warning if it will need more than maxSegments SMS
+// segments, or if it's longer than the maximum length of any of the org's sending channels. Org can be nil, in
+// which case only segments are checked, as can maxSegments be zero, in which case only channels are checked.
+func CheckMsgLength(org *OrgAssets, text string, maxSegments int) *MsgLength {
+	l := &MsgLength{
+		Encoding: MsgEncodingGSM7,
+		Length:   utf8.RuneCountInString(text),
+		Segments: gsm7.Segments(text),
+		Warnings: make([]*MsgLengthWarning, 0),
+	}
+	if !gsm7.IsValid(text) {
+		l.Encoding = MsgEncodingUCS2
+	}
+
+	if maxSegments > 0 && l.Segments > maxSegments {
+		l.Warnings = append(l.Warnings, &MsgLengthWarning{Type: MsgLengthWarningSegments, Limit: maxSegments})
+	}
+
+	if org != nil {
+		channels, _ := org.Channels()
+		for _, ch := range channels {
+			channel := ch.(*Channel)
+			maxLength := channelMaxLength(channel)
+
+			if maxLength > 0 && l.Length > maxLength && channel.hasRole(assets.ChannelRoleSend) {
+				l.Warnings = append(l.Warnings, &MsgLengthWarning{Type: MsgLengthWarningTruncated, Limit: maxLength, Channel: channel.ChannelReference()})
+			}
+		}
+	}
+
+	return l
+}
+
+// returns the maximum length of messages sent on the passed in channel, or zero if it has none
+func channelMaxLength(c *Channel) int {
+	maxLength, err := strconv.Atoi(c.ConfigValue(ChannelConfigMaxLength, "0"))
+	if err != nil {
+		return 0
+	}
+	return maxLength
+}
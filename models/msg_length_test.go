@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMsgLength(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	db.MustExec(`UPDATE channels_channel SET config = (COALESCE(config, '{}')::jsonb || '{"max_length": 320}')::text WHERE id = $1`, TwitterChannelID)
+
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+
+	// short GSM7 message, no warnings
+	l := CheckMsgLength(org, "Hi there", 3)
+	assert.Equal(t, &MsgLength{Encoding: MsgEncodingGSM7, Length: 8, Segments: 1, Warnings: []*MsgLengthWarning{}}, l)
+
+	// a single non-GSM7 character makes the whole message UCS-2
+	l = CheckMsgLength(org, "Hi there ☺", 3)
+	assert.Equal(t, MsgEncodingUCS2, l.Encoding)
+	assert.Equal(t, 10, l.Length)
+	assert.Equal(t, 1, l.Segments)
+
+	// UCS-2 messages are split into segments of 67 characters
+	l = CheckMsgLength(org, strings.Repeat("☺", 300), 3)
+	assert.Equal(t, 5, l.Segments)
+	assert.Equal(t, []*MsgLengthWarning{{Type: MsgLengthWarningSegments, Limit: 3}}, l.Warnings)
+
+	// and long enough messages are truncated on channels with a max length
+	l = CheckMsgLength(org, strings.Repeat("a", 400), 0)
+	assert.Equal(t, 3, l.Segments)
+	assert.Equal(t, []*MsgLengthWarning{
+		{Type: MsgLengthWarningTruncated, Limit: 320, Channel: assets.NewChannelReference(TwitterChannelUUID, "Twitter")},
+	}, l.Warnings)
+
+	// without an org, only segments are checked
+	l = CheckMsgLength(nil, strings.Repeat("a", 400), 2)
+	assert.Equal(t, []*MsgLengthWarning{{Type: MsgLengthWarningSegments, Limit: 2}}, l.Warnings)
+}
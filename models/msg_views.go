@@ -0,0 +1,312 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/pkg/errors"
+)
+
+const (
+	msgViewsKey      = "msg_views:%d"
+	msgViewCountsKey = "msg_view_counts:%d"
+	msgViewMarksKey  = "msg_view_marks:%d"
+	msgViewOrgsKey   = "msg_view_orgs"
+)
+
+// MsgFilter filters the visible incoming messages of an org, e.g. for an agent inbox. All conditions which are set
+// must match.
+//
+//   {
+//     "text": "refund",
+//     "label_ids": [12],
+//     "flow_id": 23,
+//     "group_ids": [34, 35],
+//     "after": "2020-01-01T00:00:00Z",
+//     "before": "2020-02-01T00:00:00Z",
+//     "unhandled": true
+//   }
+//
+type MsgFilter struct {
+	// text the message contains, case insensitive
+	Text string `json:"text,omitempty"`
+
+	// message has any of these labels
+	LabelIDs []LabelID `json:"label_ids,omitempty"`
+
+	// message was received while the contact was in a run of this flow
+	FlowID FlowID `json:"flow_id,omitempty"`
+
+	// contact is in any of these groups
+	GroupIDs []GroupID `json:"group_ids,omitempty"`
+
+	// message was received in this range
+	After  *time.Time `json:"after,omitempty"`
+	Before *time.Time `json:"before,omitempty"`
+
+	// message wasn't handled by a flow and so is waiting in the inbox
+	Unhandled bool `json:"unhandled,omitempty"`
+}
+
+// builds the SQL conditions and args for this filter for the passed in org
+func (f *MsgFilter) where(orgID OrgID) (string, []interface{}) {
+	conditions := []string{"m.org_id = $1", "m.direction = 'I'", "m.visibility = 'V'"}
+	args := []interface{}{orgID}
+
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Text != "" {
+		add("m.text ILIKE '%%' || $%d || '%%'", escapeLike(f.Text))
+	}
+	if len(f.LabelIDs) > 0 {
+		add("EXISTS (SELECT 1 FROM msgs_msg_labels l WHERE l.msg_id = m.id AND l.label_id = ANY($%d))", pq.Array(f.LabelIDs))
+	}
+	if f.FlowID != NilFlowID {
+		add("EXISTS (SELECT 1 FROM flows_flowrun r WHERE r.contact_id = m.contact_id AND r.flow_id = $%d AND m.created_on >= r.created_on AND (r.exited_on IS NULL OR m.created_on <= r.exited_on))", f.FlowID)
+	}
+	if len(f.GroupIDs) > 0 {
+		add("EXISTS (SELECT 1 FROM contacts_contactgroup_contacts g WHERE g.contact_id = m.contact_id AND g.contactgroup_id = ANY($%d))", pq.Array(f.GroupIDs))
+	}
+	if f.After != nil {
+		add("m.created_on >= $%d", *f.After)
+	}
+	if f.Before != nil {
+		add("m.created_on < $%d", *f.Before)
+	}
+	if f.Unhandled {
+		conditions = append(conditions, "m.msg_type = 'I'")
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// escapes the wildcards in the passed in text so it's matched literally by ILIKE
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
+
+// CountFilteredMsgs returns the number of messages in the passed in org which match the passed in filter
+func CountFilteredMsgs(ctx context.Context, db *sqlx.DB, orgID OrgID, filter *MsgFilter) (int, error) {
+	where, args := filter.where(orgID)
+
+	var count int
+	err := db.GetContext(ctx, &count, "SELECT COUNT(*) FROM msgs_msg m WHERE "+where, args...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error counting filtered msgs for org: %d", orgID)
+	}
+	return count, nil
+}
+
+// counts the messages in the passed in org which match the passed in filter and have ids in the range (afterID, upToID]
+func countFilteredMsgsBetween(ctx context.Context, db *sqlx.DB, orgID OrgID, filter *MsgFilter, afterID, upToID flows.MsgID) (int, error) {
+	where, args := filter.where(orgID)
+	args = append(args, afterID, upToID)
+	where += fmt.Sprintf(" AND m.id > $%d AND m.id <= $%d", len(args)-1, len(args))
+
+	var count int
+	err := db.GetContext(ctx, &count, "SELECT COUNT(*) FROM msgs_msg m WHERE "+where, args...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error counting filtered msgs for org: %d", orgID)
+	}
+	return count, nil
+}
+
+// returns the highest message id, which is the high-water mark up to which view counts are calculated
+func selectMaxMsgID(ctx context.Context, db *sqlx.DB) (flows.MsgID, error) {
+	var maxID flows.MsgID
+	err := db.GetContext(ctx, &maxID, `SELECT COALESCE(MAX(id), 0) FROM msgs_msg`)
+	return maxID, errors.Wrapf(err, "error selecting max msg id")
+}
+
+// SelectFilteredMsgIDs returns the ids of the most recent messages in the passed in org which match the passed in
+// filter, newest first. Pass the last id of a page as beforeID to get the next page.
+func SelectFilteredMsgIDs(ctx context.Context, db *sqlx.DB, orgID OrgID, filter *MsgFilter, beforeID flows.MsgID, limit int) ([]flows.MsgID, error) {
+	where, args := filter.where(orgID)
+	if beforeID != 0 {
+		args = append(args, beforeID)
+		where += fmt.Sprintf(" AND m.id < $%d", len(args))
+	}
+	args = append(args, limit)
+
+	ids := make([]flows.MsgID, 0, limit)
+	err := db.SelectContext(ctx, &ids, fmt.Sprintf("SELECT m.id FROM msgs_msg m WHERE %s ORDER BY m.id DESC LIMIT $%d", where, len(args)), args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting filtered msgs for org: %d", orgID)
+	}
+	return ids, nil
+}
+
+// MsgView is a saved message filter whose count is kept up to date, such as an agent inbox. Counts are kept up to date
+// incrementally by counting the matching messages newer than the highest message id already counted, so messages which
+// stop matching after they've been counted, e.g. because they're archived, are still included until the view is saved
+// again.
+type MsgView struct {
+	UUID   uuids.UUID `json:"uuid"`
+	Name   string     `json:"name"`
+	Filter *MsgFilter `json:"filter"`
+	Count  int        `json:"count"`
+
+	// the highest message id included in the count
+	countedTo flows.MsgID
+}
+
+// CountMsgView calculates the full count of the passed in view
+func CountMsgView(ctx context.Context, db *sqlx.DB, orgID OrgID, view *MsgView) error {
+	maxID, err := selectMaxMsgID(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	count, err := countFilteredMsgsBetween(ctx, db, orgID, view.Filter, 0, maxID)
+	if err != nil {
+		return err
+	}
+
+	view.Count = count
+	view.countedTo = maxID
+	return nil
+}
+
+// SaveMsgView saves the passed in view for the passed in org, replacing any existing view with the same UUID. Views
+// which haven't been counted by CountMsgView get a full count with the next update of counts.
+func SaveMsgView(rc redis.Conn, orgID OrgID, view *MsgView) error {
+	viewJSON, err := json.Marshal(view)
+	if err != nil {
+		return err
+	}
+
+	rc.Send("multi")
+	rc.Send("hset", fmt.Sprintf(msgViewsKey, orgID), view.UUID, viewJSON)
+	rc.Send("hset", fmt.Sprintf(msgViewCountsKey, orgID), view.UUID, view.Count)
+	rc.Send("hset", fmt.Sprintf(msgViewMarksKey, orgID), view.UUID, view.countedTo)
+	rc.Send("sadd", msgViewOrgsKey, orgID)
+	_, err = rc.Do("exec")
+	return errors.Wrapf(err, "error saving msg view")
+}
+
+// DeleteMsgView deletes the view with the passed in UUID from the passed in org
+func DeleteMsgView(rc redis.Conn, orgID OrgID, uuid uuids.UUID) error {
+	rc.Send("multi")
+	rc.Send("hdel", fmt.Sprintf(msgViewsKey, orgID), uuid)
+	rc.Send("hdel", fmt.Sprintf(msgViewCountsKey, orgID), uuid)
+	rc.Send("hdel", fmt.Sprintf(msgViewMarksKey, orgID), uuid)
+	_, err := rc.Do("exec")
+	return errors.Wrapf(err, "error deleting msg view")
+}
+
+// GetMsgViews returns the saved views for the passed in org, with their counts, ordered by name
+func GetMsgViews(rc redis.Conn, orgID OrgID) ([]*MsgView, error) {
+	values, err := redis.StringMap(rc.Do("hgetall", fmt.Sprintf(msgViewsKey, orgID)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading msg views for org: %d", orgID)
+	}
+	counts, err := redis.IntMap(rc.Do("hgetall", fmt.Sprintf(msgViewCountsKey, orgID)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading msg view counts for org: %d", orgID)
+	}
+	marks, err := redis.Int64Map(rc.Do("hgetall", fmt.Sprintf(msgViewMarksKey, orgID)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading msg view marks for org: %d", orgID)
+	}
+
+	views := make([]*MsgView, 0, len(values))
+	for uuid, v := range values {
+		view := &MsgView{}
+		if err := json.Unmarshal([]byte(v), view); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling msg view")
+		}
+		view.Count = counts[uuid]
+		view.countedTo = flows.MsgID(marks[uuid])
+		views = append(views, view)
+	}
+
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views, nil
+}
+
+// GetMsgView returns the saved view with the passed in UUID for the passed in org, or nil if it doesn't exist
+func GetMsgView(rc redis.Conn, orgID OrgID, uuid uuids.UUID) (*MsgView, error) {
+	views, err := GetMsgViews(rc, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range views {
+		if v.UUID == uuid {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// UpdateMsgViewCounts adds the messages received since the last update to the counts of all saved views, or calculates
+// the full count of views which haven't been counted yet. Returns the number of views updated.
+func UpdateMsgViewCounts(ctx context.Context, db *sqlx.DB, rc redis.Conn) (int, error) {
+	orgIDs, err := redis.Ints(rc.Do("smembers", msgViewOrgsKey))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error reading orgs with msg views")
+	}
+
+	maxID, err := selectMaxMsgID(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, id := range orgIDs {
+		orgID := OrgID(id)
+
+		views, err := GetMsgViews(rc, orgID)
+		if err != nil {
+			return updated, err
+		}
+
+		// org no longer has any views
+		if len(views) == 0 {
+			rc.Do("srem", msgViewOrgsKey, orgID)
+			continue
+		}
+
+		counts := redis.Args{fmt.Sprintf(msgViewCountsKey, orgID)}
+		marks := redis.Args{fmt.Sprintf(msgViewMarksKey, orgID)}
+		for _, v := range views {
+			// views without a mark haven't been counted so get a full count
+			if v.countedTo == 0 {
+				v.Count = 0
+			}
+
+			if v.countedTo < maxID {
+				count, err := countFilteredMsgsBetween(ctx, db, orgID, v.Filter, v.countedTo, maxID)
+				if err != nil {
+					return updated, err
+				}
+				v.Count += count
+			}
+
+			counts = counts.Add(v.UUID, v.Count)
+			marks = marks.Add(v.UUID, maxID)
+		}
+
+		rc.Send("multi")
+		rc.Send("hmset", counts...)
+		rc.Send("hmset", marks...)
+		_, err = rc.Do("exec")
+		if err != nil {
+			return updated, errors.Wrapf(err, "error storing msg view counts for org: %d", orgID)
+		}
+		updated += len(views)
+	}
+
+	return updated, nil
+}
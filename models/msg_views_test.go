@@ -0,0 +1,122 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgViews(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	insertMsg := func(contactID ContactID, urnID URNID, text string, msgType MsgType, createdOn time.Time) flows.MsgID {
+		var id flows.MsgID
+		err := db.Get(&id,
+			`INSERT INTO msgs_msg(uuid, org_id, channel_id, contact_id, contact_urn_id, text, direction, status, msg_type, created_on, visibility, msg_count, error_count, next_attempt)
+			VALUES($1, $2, $3, $4, $5, $6, 'I', 'H', $7, $8, 'V', 1, 0, NOW()) RETURNING id`,
+			uuids.New(), Org1, TwilioChannelID, contactID, urnID, text, msgType, createdOn)
+		require.NoError(t, err)
+		return id
+	}
+
+	// only consider messages created by this test
+	since := time.Now()
+
+	refund := insertMsg(CathyID, CathyURNID, "I want a REFUND", TypeInbox, time.Now())
+	thanks := insertMsg(CathyID, CathyURNID, "thanks", TypeFlow, time.Now())
+	bobRefund := insertMsg(BobID, BobURNID, "refund please", TypeInbox, time.Now())
+	percent := insertMsg(BobID, BobURNID, "100% sure", TypeInbox, time.Now())
+
+	db.MustExec(`INSERT INTO msgs_msg_labels(msg_id, label_id) VALUES($1, $2)`, thanks, ReportingLabelID)
+	db.MustExec(`INSERT INTO contacts_contactgroup_contacts(contactgroup_id, contact_id) VALUES($1, $2)`, DoctorsGroupID, BobID)
+
+	tcs := []struct {
+		Filter *MsgFilter
+		IDs    []flows.MsgID
+	}{
+		{&MsgFilter{After: &since}, []flows.MsgID{percent, bobRefund, thanks, refund}},
+		{&MsgFilter{After: &since, Text: "refund"}, []flows.MsgID{bobRefund, refund}},
+		{&MsgFilter{After: &since, Text: "%"}, []flows.MsgID{percent}},
+		{&MsgFilter{After: &since, LabelIDs: []LabelID{ReportingLabelID, TestingLabelID}}, []flows.MsgID{thanks}},
+		{&MsgFilter{After: &since, GroupIDs: []GroupID{DoctorsGroupID}, Text: "refund"}, []flows.MsgID{bobRefund}},
+		{&MsgFilter{After: &since, Unhandled: true}, []flows.MsgID{percent, bobRefund, refund}},
+	}
+
+	for i, tc := range tcs {
+		ids, err := SelectFilteredMsgIDs(ctx, db, Org1, tc.Filter, 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.IDs, ids, "%d: msg ids mismatch", i)
+
+		count, err := CountFilteredMsgs(ctx, db, Org1, tc.Filter)
+		assert.NoError(t, err)
+		assert.Equal(t, len(tc.IDs), count, "%d: count mismatch", i)
+	}
+
+	// pages continue from the last id of the previous page
+	ids, err := SelectFilteredMsgIDs(ctx, db, Org1, &MsgFilter{After: &since}, bobRefund, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []flows.MsgID{thanks, refund}, ids)
+
+	// save a view and check its count is maintained
+	view := &MsgView{UUID: uuids.New(), Name: "Refunds", Filter: &MsgFilter{After: &since, Text: "refund"}}
+	assert.NoError(t, CountMsgView(ctx, db, Org1, view))
+	assert.Equal(t, 2, view.Count)
+	assert.NoError(t, SaveMsgView(rc, Org1, view))
+
+	insertMsg(GeorgeID, GeorgeURNID, "refund me too", TypeInbox, time.Now())
+
+	updated, err := UpdateMsgViewCounts(ctx, db, rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+
+	views, err := GetMsgViews(rc, Org1)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(views))
+	assert.Equal(t, "Refunds", views[0].Name)
+	assert.Equal(t, 3, views[0].Count)
+
+	// messages already counted aren't counted again
+	_, err = UpdateMsgViewCounts(ctx, db, rc)
+	assert.NoError(t, err)
+
+	views, err = GetMsgViews(rc, Org1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, views[0].Count)
+
+	// views saved without being counted get a full count
+	uncounted := &MsgView{UUID: uuids.New(), Name: "All Refunds", Filter: &MsgFilter{After: &since, Text: "refund"}}
+	assert.NoError(t, SaveMsgView(rc, Org1, uncounted))
+
+	updated, err = UpdateMsgViewCounts(ctx, db, rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated)
+
+	found, err := GetMsgView(rc, Org1, uncounted.UUID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, found.Count)
+	assert.NoError(t, DeleteMsgView(rc, Org1, uncounted.UUID))
+
+	found, err = GetMsgView(rc, Org1, view.UUID)
+	assert.NoError(t, err)
+	assert.NotNil(t, found)
+
+	// delete it
+	assert.NoError(t, DeleteMsgView(rc, Org1, view.UUID))
+
+	views, err = GetMsgViews(rc, Org1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(views))
+
+	// and the org is no longer included in count updates
+	updated, err = UpdateMsgViewCounts(ctx, db, rc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updated)
+}
@@ -323,7 +323,7 @@ func NewOutgoingMsg(orgID OrgID, channel *Channel, contactID ContactID, out *flo
 	if len(out.QuickReplies()) > 0 || out.Templating() != nil || out.Topic() != flows.NilMsgTopic {
 		metadata := make(map[string]interface{})
 		if len(out.QuickReplies()) > 0 {
-			metadata["quick_replies"] = out.QuickReplies()
+			m.Text = addQuickReplies(channel, m.Text, out.QuickReplies(), metadata)
 		}
 		if out.Templating() != nil {
 			metadata["templating"] = out.Templating()
@@ -448,8 +448,23 @@ func UpdateMessage(ctx context.Context, tx Queryer, msgID flows.MsgID, status Ms
 	return nil
 }
 
+// UpdateMessageAttachments updates the attachments of the message with the passed in id
+func UpdateMessageAttachments(ctx context.Context, tx Queryer, msgID flows.MsgID, attachments []utils.Attachment) error {
+	urls := make(pq.StringArray, len(attachments))
+	for i, a := range attachments {
+		urls[i] = string(a)
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE msgs_msg SET attachments = $2, modified_on = NOW() WHERE id = $1`, msgID, urls)
+	if err != nil {
+		return errors.Wrapf(err, "error updating attachments of msg: %d", msgID)
+	}
+
+	return nil
+}
+
 // MarkMessagesPending marks the passed in messages as pending
-func MarkMessagesPending(ctx context.Context, tx *sqlx.Tx, msgs []*Msg) error {
+func MarkMessagesPending(ctx context.Context, tx Queryer, msgs []*Msg) error {
 	return updateMessageStatus(ctx, tx, msgs, MsgStatusPending)
 }
 
@@ -458,8 +473,13 @@ func MarkMessagesQueued(ctx context.Context, tx *sqlx.Tx, msgs []*Msg) error {
 	return updateMessageStatus(ctx, tx, msgs, MsgStatusQueued)
 }
 
-// MarkMessagesQueued marks the passed in messages as queued
-func updateMessageStatus(ctx context.Context, tx *sqlx.Tx, msgs []*Msg, status MsgStatus) error {
+// MarkMessagesFailed marks the passed in messages as failed
+func MarkMessagesFailed(ctx context.Context, tx Queryer, msgs []*Msg) error {
+	return updateMessageStatus(ctx, tx, msgs, MsgStatusFailed)
+}
+
+// updateMessageStatus updates the status of the passed in messages
+func updateMessageStatus(ctx context.Context, tx Queryer, msgs []*Msg, status MsgStatus) error {
 	is := make([]interface{}, len(msgs))
 	for i, msg := range msgs {
 		m := &msg.m
@@ -490,6 +510,17 @@ type BroadcastTranslation struct {
 	QuickReplies []string           `json:"quick_replies,omitempty"`
 }
 
+// BroadcastVariables are the variables which the templates of a broadcast can reference as @variables.*
+type BroadcastVariables map[string]string
+
+// Value returns the db value, which is null for no variables
+func (v BroadcastVariables) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
 // Broadcast represents a broadcast that needs to be sent
 type Broadcast struct {
 	b struct {
@@ -503,6 +534,9 @@ type Broadcast struct {
 		GroupIDs      []GroupID                               `json:"group_ids,omitempty"`
 		OrgID         OrgID                                   `json:"org_id"                 db:"org_id"`
 		ParentID      BroadcastID                             `json:"parent_id,omitempty"    db:"parent_id"`
+		ChannelID     ChannelID                               `json:"channel_id,omitempty"   db:"channel_id"`
+		Variables     BroadcastVariables                      `json:"variables,omitempty"    db:"variables"`
+		Pace          int                                     `json:"pace,omitempty"`
 	}
 }
 
@@ -514,6 +548,21 @@ func (b *Broadcast) OrgID() OrgID                                          { ret
 func (b *Broadcast) BaseLanguage() envs.Language                           { return b.b.BaseLanguage }
 func (b *Broadcast) Translations() map[envs.Language]*BroadcastTranslation { return b.b.Translations }
 func (b *Broadcast) TemplateState() TemplateState                          { return b.b.TemplateState }
+func (b *Broadcast) Pace() int                                             { return b.b.Pace }
+func (b *Broadcast) ChannelID() ChannelID                                  { return b.b.ChannelID }
+func (b *Broadcast) Variables() map[string]string                          { return b.b.Variables }
+
+// WithChannelID sets the channel this broadcast should be sent with where contacts have a URN it can send to
+func (b *Broadcast) WithChannelID(channelID ChannelID) *Broadcast {
+	b.b.ChannelID = channelID
+	return b
+}
+
+// WithVariables sets the variables which unevaluated templates in this broadcast can reference as @variables.*
+func (b *Broadcast) WithVariables(variables map[string]string) *Broadcast {
+	b.b.Variables = variables
+	return b
+}
 
 func (b *Broadcast) MarshalJSON() ([]byte, error)    { return json.Marshal(b.b) }
 func (b *Broadcast) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, &b.b) }
@@ -548,29 +597,60 @@ func InsertChildBroadcast(ctx context.Context, db Queryer, parent *Broadcast) (*
 		parent.b.ContactIDs,
 		parent.b.GroupIDs,
 	)
-	// populate our parent id
+	// populate our parent id, channel and variables
 	child.b.ParentID = parent.BroadcastID()
+	child.b.ChannelID = parent.b.ChannelID
+	child.b.Variables = parent.b.Variables
 
-	// populate text from our translations
-	child.b.Text.Map = make(map[string]sql.NullString)
-	for lang, t := range child.b.Translations {
-		child.b.Text.Map[string(lang)] = sql.NullString{String: t.Text, Valid: true}
+	for _, t := range child.b.Translations {
 		if len(t.Attachments) > 0 || len(t.QuickReplies) > 0 {
 			return nil, errors.Errorf("cannot clone broadcast with quick replies or attachments")
 		}
 	}
 
+	if err := insertBroadcast(ctx, db, child); err != nil {
+		return nil, errors.Wrapf(err, "error inserting child broadcast for broadcast: %d", parent.BroadcastID())
+	}
+
+	return child, nil
+}
+
+// InsertBroadcast inserts the passed in broadcast into the DB, setting its id. URNs must already exist and include
+// their ids as they are recorded against the broadcast by id.
+func InsertBroadcast(ctx context.Context, db Queryer, bcast *Broadcast) error {
+	if bcast.BroadcastID() != NilBroadcastID {
+		return errors.Errorf("broadcast has already been inserted: %d", bcast.BroadcastID())
+	}
+
+	return insertBroadcast(ctx, db, bcast)
+}
+
+// inserts the passed in broadcast and its contact, group and URN associations
+func insertBroadcast(ctx context.Context, db Queryer, bcast *Broadcast) error {
+	// URNs are recorded against the broadcast by id so must already exist
+	for _, urn := range bcast.b.URNs {
+		if GetURNID(urn) == NilURNID {
+			return errors.Errorf("attempt to insert new broadcast with URNs that do not have id: %s", urn)
+		}
+	}
+
+	// populate text from our translations
+	bcast.b.Text.Map = make(map[string]sql.NullString)
+	for lang, t := range bcast.b.Translations {
+		bcast.b.Text.Map[string(lang)] = sql.NullString{String: t.Text, Valid: true}
+	}
+
 	// insert our broadcast
-	err := BulkSQL(ctx, "inserting broadcast", db, insertBroadcastSQL, []interface{}{&child.b})
+	err := BulkSQL(ctx, "inserting broadcast", db, insertBroadcastSQL, []interface{}{&bcast.b})
 	if err != nil {
-		return nil, errors.Wrapf(err, "error inserting child broadcast for broadcast: %d", parent.BroadcastID())
+		return errors.Wrapf(err, "error inserting broadcast")
 	}
 
 	// build up all our contact associations
-	contacts := make([]interface{}, 0, len(child.b.ContactIDs))
-	for _, contactID := range child.b.ContactIDs {
+	contacts := make([]interface{}, 0, len(bcast.b.ContactIDs))
+	for _, contactID := range bcast.b.ContactIDs {
 		contacts = append(contacts, &broadcastContact{
-			BroadcastID: child.BroadcastID(),
+			BroadcastID: bcast.BroadcastID(),
 			ContactID:   contactID,
 		})
 	}
@@ -578,14 +658,14 @@ func InsertChildBroadcast(ctx context.Context, db Queryer, parent *Broadcast) (*
 	// insert our contacts
 	err = BulkSQL(ctx, "inserting broadcast contacts", db, insertBroadcastContactsSQL, contacts)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error inserting contacts for broadcast")
+		return errors.Wrapf(err, "error inserting contacts for broadcast")
 	}
 
 	// build up all our group associations
-	groups := make([]interface{}, 0, len(child.b.GroupIDs))
-	for _, groupID := range child.b.GroupIDs {
+	groups := make([]interface{}, 0, len(bcast.b.GroupIDs))
+	for _, groupID := range bcast.b.GroupIDs {
 		groups = append(groups, &broadcastGroup{
-			BroadcastID: child.BroadcastID(),
+			BroadcastID: bcast.BroadcastID(),
 			GroupID:     groupID,
 		})
 	}
@@ -593,29 +673,25 @@ func InsertChildBroadcast(ctx context.Context, db Queryer, parent *Broadcast) (*
 	// insert our groups
 	err = BulkSQL(ctx, "inserting broadcast groups", db, insertBroadcastGroupsSQL, groups)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error inserting groups for broadcast")
+		return errors.Wrapf(err, "error inserting groups for broadcast")
 	}
 
 	// finally our URNs
-	urns := make([]interface{}, 0, len(child.b.URNs))
-	for _, urn := range child.b.URNs {
-		urnID := GetURNID(urn)
-		if urnID == NilURNID {
-			return nil, errors.Errorf("attempt to insert new broadcast with URNs that do not have id: %s", urn)
-		}
+	urns := make([]interface{}, 0, len(bcast.b.URNs))
+	for _, urn := range bcast.b.URNs {
 		urns = append(urns, &broadcastURN{
-			BroadcastID: child.BroadcastID(),
-			URNID:       urnID,
+			BroadcastID: bcast.BroadcastID(),
+			URNID:       GetURNID(urn),
 		})
 	}
 
 	// insert our urns
 	err = BulkSQL(ctx, "inserting broadcast urns", db, insertBroadcastURNsSQL, urns)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error inserting URNs for broadcast")
+		return errors.Wrapf(err, "error inserting URNs for broadcast")
 	}
 
-	return child, nil
+	return nil
 }
 
 type broadcastURN struct {
@@ -635,8 +711,8 @@ type broadcastGroup struct {
 
 const insertBroadcastSQL = `
 INSERT INTO
-	msgs_broadcast( org_id,  parent_id, is_active, created_on, modified_on, status,  text,  base_language, send_all)
-			VALUES(:org_id, :parent_id, TRUE,      NOW()     , NOW(),       'Q',    :text, :base_language, FALSE)
+	msgs_broadcast( org_id,  parent_id,  channel_id, is_active, created_on, modified_on, status,  text,  base_language,  variables, send_all)
+			VALUES(:org_id, :parent_id, :channel_id, TRUE,      NOW()     , NOW(),       'Q',    :text, :base_language, :variables, FALSE)
 RETURNING
 	id
 `
@@ -696,6 +772,8 @@ func (b *Broadcast) CreateBatch(contactIDs []ContactID) *BroadcastBatch {
 	batch.b.Translations = b.b.Translations
 	batch.b.TemplateState = b.b.TemplateState
 	batch.b.OrgID = b.b.OrgID
+	batch.b.ChannelID = b.b.ChannelID
+	batch.b.Variables = b.b.Variables
 	batch.b.ContactIDs = contactIDs
 	return batch
 }
@@ -711,6 +789,8 @@ type BroadcastBatch struct {
 		ContactIDs    []ContactID                             `json:"contact_ids,omitempty"`
 		IsLast        bool                                    `json:"is_last"`
 		OrgID         OrgID                                   `json:"org_id"`
+		ChannelID     ChannelID                               `json:"channel_id,omitempty"`
+		Variables     map[string]string                       `json:"variables,omitempty"`
 	}
 }
 
@@ -726,6 +806,8 @@ func (b *BroadcastBatch) TemplateState() TemplateState { return b.b.TemplateStat
 func (b *BroadcastBatch) BaseLanguage() envs.Language  { return b.b.BaseLanguage }
 func (b *BroadcastBatch) IsLast() bool                 { return b.b.IsLast }
 func (b *BroadcastBatch) SetIsLast(last bool)          { b.b.IsLast = last }
+func (b *BroadcastBatch) ChannelID() ChannelID         { return b.b.ChannelID }
+func (b *BroadcastBatch) Variables() map[string]string { return b.b.Variables }
 
 func (b *BroadcastBatch) MarshalJSON() ([]byte, error)    { return json.Marshal(b.b) }
 func (b *BroadcastBatch) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, &b.b) }
@@ -764,9 +846,39 @@ func CreateBroadcastMessages(ctx context.Context, db Queryer, rp *redis.Pool, or
 
 	channels := sa.Channels()
 
+	// if the broadcast prefers a channel, we use it for any URN it can send to
+	var preferredChannel *flows.Channel
+	if bcast.ChannelID() != NilChannelID {
+		dbChannel := org.ChannelByID(bcast.ChannelID())
+		if dbChannel != nil {
+			preferredChannel = channels.Get(dbChannel.UUID())
+		}
+		if preferredChannel != nil && !preferredChannel.HasRole(assets.ChannelRoleSend) {
+			preferredChannel = nil
+		}
+	}
+
+	// utility method to get the channel to send to the passed in URN with
+	channelForURN := func(u *flows.ContactURN) *flows.Channel {
+		if preferredChannel != nil && preferredChannel.SupportsScheme(u.URN().Scheme()) {
+			return preferredChannel
+		}
+		return channels.GetForURN(u, assets.ChannelRoleSend)
+	}
+
 	// for each contact, build our message
 	msgs := make([]*Msg, 0, len(contacts))
 
+	// broadcast variables are the same for every contact
+	variables := make(map[string]types.XValue, len(bcast.Variables()))
+	for k, v := range bcast.Variables() {
+		variables[k] = types.NewXText(v)
+	}
+	variablesCtx := types.NewXObject(variables)
+
+	rc := rp.Get()
+	defer rc.Close()
+
 	// utility method to build up our message
 	buildMessage := func(c *Contact, forceURN urns.URN) (*Msg, error) {
 		if c.IsStopped() || c.IsBlocked() {
@@ -785,7 +897,7 @@ func CreateBroadcastMessages(ctx context.Context, db Queryer, rp *redis.Pool, or
 		if forceURN != urns.NilURN {
 			for _, u := range contact.URNs() {
 				if u.URN().Identity() == forceURN.Identity() {
-					c := channels.GetForURN(u, assets.ChannelRoleSend)
+					c := channelForURN(u)
 					if c == nil {
 						return nil, nil
 					}
@@ -795,56 +907,45 @@ func CreateBroadcastMessages(ctx context.Context, db Queryer, rp *redis.Pool, or
 				}
 			}
 		} else {
-			// no forced URN, find the first URN we can send to
-			for _, u := range contact.URNs() {
-				c := channels.GetForURN(u, assets.ChannelRoleSend)
-				if c != nil {
-					urn = u.URN()
-					channel = org.ChannelByUUID(c.UUID())
-					break
+			// no forced URN, find the first URN our preferred channel can send to, if any
+			if preferredChannel != nil {
+				for _, u := range contact.URNs() {
+					if preferredChannel.SupportsScheme(u.URN().Scheme()) {
+						urn = u.URN()
+						channel = org.ChannelByUUID(preferredChannel.UUID())
+						break
+					}
 				}
 			}
-		}
 
-		// no urn and channel? move on
-		if channel == nil {
-			return nil, nil
-		}
-
-		// resolve our translations, the order is:
-		//   1) valid contact language
-		//   2) org default language
-		//   3) broadcast base language
-		lang := contact.Language()
-		if lang != envs.NilLanguage {
-			found := false
-			for _, l := range org.Env().AllowedLanguages() {
-				if l == lang {
-					found = true
-					break
+			// otherwise find the first URN we can send to
+			if channel == nil {
+				for _, u := range contact.URNs() {
+					c := channels.GetForURN(u, assets.ChannelRoleSend)
+					if c != nil {
+						urn = u.URN()
+						channel = org.ChannelByUUID(c.UUID())
+						break
+					}
 				}
 			}
-			if !found {
-				lang = envs.NilLanguage
-			}
 		}
 
-		// have a valid contact language, try that
-		trans := bcast.Translations()
-		t := trans[lang]
-
-		// not found? try org default language
-		if t == nil {
-			t = trans[org.Env().DefaultLanguage()]
+		// no urn and channel? move on
+		if channel == nil {
+			return nil, nil
 		}
 
-		// not found? use broadcast base language
-		if t == nil {
-			t = trans[bcast.BaseLanguage()]
+		// if the channel has a region this send may go out on another channel in that region, and if the channel is down
+		// it may go out on its backup channel
+		channel, err = SendChannel(rc, org, channel, urn.Scheme())
+		if err != nil {
+			return nil, errors.Wrapf(err, "error routing broadcast message")
 		}
 
+		t := resolveBroadcastTranslation(bcast.Translations(), broadcastLanguages(org, contact, bcast.BaseLanguage()))
 		if t == nil {
-			logrus.WithField("base_language", bcast.BaseLanguage()).WithField("translations", trans).Error("unable to find translation for broadcast")
+			logrus.WithField("base_language", bcast.BaseLanguage()).WithField("translations", bcast.Translations()).Error("unable to find translation for broadcast")
 			return nil, nil
 		}
 
@@ -863,10 +964,11 @@ func CreateBroadcastMessages(ctx context.Context, db Queryer, rp *redis.Pool, or
 		if template != "" {
 			// build up the minimum viable context for templates
 			templateCtx := types.NewXObject(map[string]types.XValue{
-				"contact": flows.Context(org.Env(), contact),
-				"fields":  flows.Context(org.Env(), contact.Fields()),
-				"globals": flows.Context(org.Env(), sa.Globals()),
-				"urns":    flows.ContextFunc(org.Env(), contact.URNs().MapContext),
+				"contact":   flows.Context(org.Env(), contact),
+				"fields":    flows.Context(org.Env(), contact.Fields()),
+				"globals":   flows.Context(org.Env(), sa.Globals()),
+				"urns":      flows.ContextFunc(org.Env(), contact.URNs().MapContext),
+				"variables": variablesCtx,
 			})
 			text, _ = excellent.EvaluateTemplate(org.Env(), templateCtx, template, nil)
 		}
@@ -914,9 +1016,7 @@ func CreateBroadcastMessages(ctx context.Context, db Queryer, rp *redis.Pool, or
 	}
 
 	// get a topup to assign to our messages
-	rc := rp.Get()
 	topup, err := DecrementOrgCredits(ctx, db, rc, org.OrgID(), len(msgs))
-	rc.Close()
 	if err != nil {
 		return nil, errors.Wrapf(err, "error finding active topup")
 	}
@@ -937,6 +1037,52 @@ func CreateBroadcastMessages(ctx context.Context, db Queryer, rp *redis.Pool, or
 	return msgs, nil
 }
 
+// returns the languages a broadcast is sent to the passed in contact in, in order of preference, which are the contact's
+// language if it's one the org allows, then the org default language, then the broadcast base language
+func broadcastLanguages(org *OrgAssets, contact *flows.Contact, baseLanguage envs.Language) []envs.Language {
+	languages := make([]envs.Language, 0, 3)
+
+	if contact.Language() != envs.NilLanguage {
+		for _, l := range org.Env().AllowedLanguages() {
+			if l == contact.Language() {
+				languages = append(languages, l)
+				break
+			}
+		}
+	}
+
+	return append(languages, org.Env().DefaultLanguage(), baseLanguage)
+}
+
+// resolves the translation of a broadcast using the passed in languages in order of preference. Like the engine does
+// with localized actions, each of text, attachments and quick replies falls back separately, so a translation with only
+// text still gets the attachments of a language further down. Returns nil if the broadcast has no translation in any of
+// the languages.
+func resolveBroadcastTranslation(translations map[envs.Language]*BroadcastTranslation, languages []envs.Language) *BroadcastTranslation {
+	var resolved *BroadcastTranslation
+
+	for _, lang := range languages {
+		t := translations[lang]
+		if lang == envs.NilLanguage || t == nil {
+			continue
+		}
+		if resolved == nil {
+			resolved = &BroadcastTranslation{}
+		}
+		if resolved.Text == "" {
+			resolved.Text = t.Text
+		}
+		if len(resolved.Attachments) == 0 {
+			resolved.Attachments = t.Attachments
+		}
+		if len(resolved.QuickReplies) == 0 {
+			resolved.QuickReplies = t.QuickReplies
+		}
+	}
+
+	return resolved
+}
+
 // MarkBroadcastSent marks the passed in broadcast as sent
 func MarkBroadcastSent(ctx context.Context, db *sqlx.DB, id BroadcastID) error {
 	// noop if it is a nil id
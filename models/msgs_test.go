@@ -7,6 +7,7 @@ import (
 
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/mailroom/config"
@@ -143,3 +144,46 @@ func TestNormalizeAttachment(t *testing.T) {
 		assert.Equal(t, tc.normalized, string(NormalizeAttachment(utils.Attachment(tc.raw))))
 	}
 }
+
+func TestResolveBroadcastTranslation(t *testing.T) {
+	eng, fra, spa := envs.Language("eng"), envs.Language("fra"), envs.Language("spa")
+
+	translations := map[envs.Language]*BroadcastTranslation{
+		eng: {Text: "Hello", Attachments: []utils.Attachment{"image/jpeg:http://files.com/hello.jpg"}, QuickReplies: []string{"Yes", "No"}},
+		fra: {Text: "Bonjour", QuickReplies: []string{"Oui", "Non"}},
+		spa: {Text: "Hola"},
+	}
+
+	tcs := []struct {
+		languages []envs.Language
+		resolved  *BroadcastTranslation
+	}{
+		{
+			[]envs.Language{eng, eng, eng},
+			translations[eng],
+		},
+		{
+			// missing attachments fall back to the base language
+			[]envs.Language{fra, eng, eng},
+			&BroadcastTranslation{Text: "Bonjour", Attachments: []utils.Attachment{"image/jpeg:http://files.com/hello.jpg"}, QuickReplies: []string{"Oui", "Non"}},
+		},
+		{
+			// and missing quick replies to the org language before that
+			[]envs.Language{spa, fra, eng},
+			&BroadcastTranslation{Text: "Hola", Attachments: []utils.Attachment{"image/jpeg:http://files.com/hello.jpg"}, QuickReplies: []string{"Oui", "Non"}},
+		},
+		{
+			// contact without a valid language
+			[]envs.Language{spa, eng},
+			&BroadcastTranslation{Text: "Hola", Attachments: []utils.Attachment{"image/jpeg:http://files.com/hello.jpg"}, QuickReplies: []string{"Yes", "No"}},
+		},
+		{
+			[]envs.Language{"kin", envs.NilLanguage, "base"},
+			nil,
+		},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.resolved, resolveBroadcastTranslation(translations, tc.languages), "translation mismatch for languages %v", tc.languages)
+	}
+}
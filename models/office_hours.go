@@ -0,0 +1,144 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the org config key for the org's office hours, as ranges of local times for each day of the week, and any dates
+// on which the office is closed, e.g.
+//
+//   "office_hours": {
+//     "days": {
+//       "mon": [{"open": "09:00", "close": "12:30"}, {"open": "13:30", "close": "17:00"}],
+//       "sat": [{"open": "10:00", "close": "14:00"}]
+//     },
+//     "closed_dates": ["2020-12-25"]
+//   }
+//
+const configOfficeHours = "office_hours"
+
+// OfficeHours are the times at which an org's office is open, in the org's timezone
+type OfficeHours struct {
+	Days        map[string][]*OfficeHoursRange `json:"days"`
+	ClosedDates []string                       `json:"closed_dates"`
+
+	timezone *time.Location
+}
+
+// OfficeHoursRange is a range of local times during which the office is open, closing time being exclusive. Times
+// are written as H:MM or HH:MM, and a closing time of 24:00 is the end of the day.
+type OfficeHoursRange struct {
+	Open  string `json:"open"`
+	Close string `json:"close"`
+
+	// opening and closing times as minutes since midnight
+	open, close int
+}
+
+// OfficeHours returns the office hours of this org, or nil if it hasn't configured any
+func (o *Org) OfficeHours() *OfficeHours {
+	raw, found := o.config[configOfficeHours]
+	if !found {
+		return nil
+	}
+
+	hours, err := readOfficeHours(raw, o.Timezone())
+	if err != nil {
+		logrus.WithError(err).WithField("org_id", o.ID()).Error("ignoring invalid office hours")
+		return nil
+	}
+	return hours
+}
+
+// reads and validates office hours from the passed in config value
+func readOfficeHours(raw interface{}, timezone *time.Location) (*OfficeHours, error) {
+	// our config has already been decoded so re-encode it to read it into our struct
+	hoursJSON, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	hours := &OfficeHours{}
+	if err := json.Unmarshal(hoursJSON, hours); err != nil {
+		return nil, errors.Wrapf(err, "error reading office hours")
+	}
+
+	for day, ranges := range hours.Days {
+		if _, err := time.Parse("Mon", strings.Title(day)); err != nil {
+			return nil, errors.Errorf("invalid office hours day: %s", day)
+		}
+		for _, r := range ranges {
+			if r.open, err = parseOfficeHoursTime(r.Open); err != nil || r.open == minutesPerDay {
+				return nil, errors.Errorf("invalid office hours opening time: %s", r.Open)
+			}
+			if r.close, err = parseOfficeHoursTime(r.Close); err != nil {
+				return nil, errors.Errorf("invalid office hours closing time: %s", r.Close)
+			}
+			if r.close <= r.open {
+				return nil, errors.Errorf("office hours must close after they open: %s - %s", r.Open, r.Close)
+			}
+		}
+	}
+	for _, d := range hours.ClosedDates {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return nil, errors.Errorf("invalid office hours closed date: %s", d)
+		}
+	}
+
+	hours.timezone = timezone
+	if hours.timezone == nil {
+		hours.timezone = time.UTC
+	}
+	return hours, nil
+}
+
+const minutesPerDay = 24 * 60
+
+// parses a time like 9:00 or 17:30 into minutes since midnight, allowing 24:00 as the end of the day
+func parseOfficeHoursTime(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || len(parts[0]) < 1 || len(parts[0]) > 2 || len(parts[1]) != 2 {
+		return 0, errors.Errorf("invalid time: %s", s)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 {
+		return 0, errors.Errorf("invalid time: %s", s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, errors.Errorf("invalid time: %s", s)
+	}
+
+	minutes := hour*60 + minute
+	if minutes > minutesPerDay {
+		return 0, errors.Errorf("invalid time: %s", s)
+	}
+	return minutes, nil
+}
+
+// IsOpen returns whether the office is open at the passed in time
+func (h *OfficeHours) IsOpen(now time.Time) bool {
+	local := now.In(h.timezone)
+
+	date := local.Format("2006-01-02")
+	for _, d := range h.ClosedDates {
+		if d == date {
+			return false
+		}
+	}
+
+	day := strings.ToLower(local.Format("Mon"))
+	minutes := local.Hour()*60 + local.Minute()
+	for _, r := range h.Days[day] {
+		if minutes >= r.open && minutes < r.close {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfficeHours(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"office_hours": {
+		"days": {"mon": [{"open": "09:00", "close": "12:30"}, {"open": "13:30", "close": "17:00"}], "sat": [{"open": "10:00", "close": "14:00"}], "fri": [{"open": "9:00", "close": "10:00"}, {"open": "22:00", "close": "24:00"}]},
+		"closed_dates": ["2020-12-28"]
+	}}' WHERE id = $1`, Org1)
+
+	org, err := loadOrg(ctx, db, Org1)
+	require.NoError(t, err)
+
+	hours := org.OfficeHours()
+	require.NotNil(t, hours)
+
+	// times are in the org's timezone
+	tz := org.Timezone()
+	tcs := []struct {
+		Now  time.Time
+		Open bool
+	}{
+		{time.Date(2020, 12, 7, 8, 59, 0, 0, tz), false}, // monday
+		{time.Date(2020, 12, 7, 9, 0, 0, 0, tz), true},
+		{time.Date(2020, 12, 7, 12, 30, 0, 0, tz), false},
+		{time.Date(2020, 12, 7, 14, 0, 0, 0, tz), true},
+		{time.Date(2020, 12, 7, 17, 0, 0, 0, tz), false},
+		{time.Date(2020, 12, 8, 10, 0, 0, 0, tz), false},  // tuesday
+		{time.Date(2020, 12, 12, 11, 0, 0, 0, tz), true},  // saturday
+		{time.Date(2020, 12, 28, 10, 0, 0, 0, tz), false}, // closed monday
+		{time.Date(2020, 12, 11, 8, 59, 0, 0, tz), false}, // friday
+		{time.Date(2020, 12, 11, 9, 30, 0, 0, tz), true},
+		{time.Date(2020, 12, 11, 10, 0, 0, 0, tz), false},
+		{time.Date(2020, 12, 11, 23, 59, 0, 0, tz), true},
+		{time.Date(2020, 12, 12, 0, 0, 0, 0, tz), false},
+		{time.Date(2020, 12, 7, 9, 0, 0, 0, tz).UTC(), true},
+	}
+
+	for i, tc := range tcs {
+		assert.Equal(t, tc.Open, hours.IsOpen(tc.Now), "%d: open mismatch for %s", i, tc.Now)
+	}
+
+	// invalid office hours are ignored
+	for _, config := range []string{
+		`{"office_hours": {"days": {"monday": [{"open": "09:00", "close": "17:00"}]}}}`,
+		`{"office_hours": {"days": {"mon": [{"open": "9am", "close": "17:00"}]}}}`,
+		`{"office_hours": {"days": {"mon": [{"open": "17:00", "close": "09:00"}]}}}`,
+		`{"office_hours": {"days": {"mon": [{"open": "17:00", "close": "9:00"}]}}}`,
+		`{"office_hours": {"days": {"mon": [{"open": "09:00", "close": "24:30"}]}}}`,
+		`{"office_hours": {"days": {"mon": [{"open": "24:00", "close": "24:00"}]}}}`,
+		`{"office_hours": {"days": {"mon": [{"open": "09:5", "close": "17:00"}]}}}`,
+		`{"office_hours": {"closed_dates": ["25/12/2020"]}}`,
+	} {
+		db.MustExec(`UPDATE orgs_org SET config = $2 WHERE id = $1`, Org1, config)
+
+		org, err = loadOrg(ctx, db, Org1)
+		require.NoError(t, err)
+		assert.Nil(t, org.OfficeHours(), "expected office hours to be invalid: %s", config)
+	}
+
+	// orgs with office hours have a global for whether they're open
+	db.MustExec(`UPDATE orgs_org SET config = '{"office_hours": {"days": {}}}' WHERE id = $1`, Org1)
+
+	oa, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+
+	globals, err := oa.Globals()
+	require.NoError(t, err)
+
+	values := make(map[string]string, len(globals))
+	for _, g := range globals {
+		values[g.Key()] = g.Value()
+	}
+	assert.Equal(t, "false", values["org_office_open"])
+}
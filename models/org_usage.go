@@ -0,0 +1,146 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// UsageCounter is a billable count of something an org has used
+type UsageCounter string
+
+const (
+	UsageMsgsHandled      = UsageCounter("msgs_handled")
+	UsageSessionsRun      = UsageCounter("sessions_run")
+	UsageIVRMinutes       = UsageCounter("ivr_minutes")
+	UsageClassifierCalls  = UsageCounter("classifier_calls")
+	UsageAirtimeTransfers = UsageCounter("airtime_transfers")
+
+	// UsagePeriodLayout is the layout of usage periods, which are calendar months in UTC
+	UsagePeriodLayout = "2006-01"
+)
+
+// UsageCounters are all the counters we track for each org
+var UsageCounters = []UsageCounter{UsageMsgsHandled, UsageSessionsRun, UsageIVRMinutes, UsageClassifierCalls, UsageAirtimeTransfers}
+
+// UsagePeriod returns the usage period which the passed in time falls in
+func UsagePeriod(t time.Time) string {
+	return t.UTC().Format(UsagePeriodLayout)
+}
+
+const insertOrgUsageSQL = `
+INSERT INTO
+	orgs_orgusagecount(org_id, period, counter, count, is_squashed)
+	VALUES($1, $2, $3, $4, FALSE)
+`
+
+// IncrementOrgUsage increments the passed in usage counter for the passed in org in the current period. Increments are
+// written as new rows which are periodically squashed by SquashOrgUsage so that concurrent writers don't contend.
+func IncrementOrgUsage(ctx context.Context, db Queryer, orgID OrgID, counter UsageCounter, count int) error {
+	_, err := db.ExecContext(ctx, insertOrgUsageSQL, orgID, UsagePeriod(time.Now()), counter, count)
+	return errors.Wrapf(err, "error incrementing %s usage for org: %d", counter, orgID)
+}
+
+const selectOrgUsageSQL = `
+SELECT
+	counter,
+	SUM(count) AS count
+FROM
+	orgs_orgusagecount
+WHERE
+	org_id = $1 AND
+	period = $2
+GROUP BY
+	counter
+`
+
+// GetOrgUsage returns all the usage counters for the passed in org in the passed in period
+func GetOrgUsage(ctx context.Context, db Queryer, orgID OrgID, period string) (map[UsageCounter]int, error) {
+	usage := make(map[UsageCounter]int, len(UsageCounters))
+	for _, c := range UsageCounters {
+		usage[c] = 0
+	}
+
+	rows, err := db.QueryxContext(ctx, selectOrgUsageSQL, orgID, period)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading usage for org: %d", orgID)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var counter UsageCounter
+		var count int
+		if err := rows.Scan(&counter, &count); err != nil {
+			return nil, errors.Wrapf(err, "error scanning usage for org: %d", orgID)
+		}
+		usage[counter] = count
+	}
+	return usage, rows.Err()
+}
+
+const squashOrgUsageSQL = `
+WITH deleted AS (
+	DELETE FROM
+		orgs_orgusagecount
+	WHERE
+		(org_id, period, counter) IN (SELECT DISTINCT org_id, period, counter FROM orgs_orgusagecount WHERE is_squashed = FALSE)
+	RETURNING
+		org_id, period, counter, count
+)
+INSERT INTO
+	orgs_orgusagecount(org_id, period, counter, count, is_squashed)
+SELECT
+	org_id, period, counter, SUM(count), TRUE
+FROM
+	deleted
+GROUP BY
+	org_id, period, counter
+`
+
+// SquashOrgUsage replaces the usage rows of every counter which has been incremented since the last squash with a
+// single squashed row, returning the number of counters squashed
+func SquashOrgUsage(ctx context.Context, db *sqlx.DB) (int, error) {
+	res, err := db.ExecContext(ctx, squashOrgUsageSQL)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error squashing org usage")
+	}
+	count, _ := res.RowsAffected()
+	return int(count), nil
+}
+
+// UsageIncrement is a single increment of a usage counter
+type UsageIncrement struct {
+	Counter UsageCounter
+	Count   int
+}
+
+// AddUsage records usage by this session which will be counted once the session is committed
+func (s *Session) AddUsage(counter UsageCounter, count int) {
+	s.AddPostCommitEvent(orgUsageHook, &UsageIncrement{Counter: counter, Count: count})
+}
+
+// OrgUsageHook is our hook for incrementing usage counters once sessions are committed
+type OrgUsageHook struct{}
+
+var orgUsageHook = &OrgUsageHook{}
+
+// Apply increments the usage counters of the org for the passed in sessions
+func (h *OrgUsageHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, sessions map[*Session][]interface{}) error {
+	totals := make(map[UsageCounter]int)
+	for _, increments := range sessions {
+		for _, i := range increments {
+			increment := i.(*UsageIncrement)
+			totals[increment.Counter] += increment.Count
+		}
+	}
+
+	for counter, count := range totals {
+		if err := IncrementOrgUsage(ctx, tx, org.OrgID(), counter, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrgUsage(t *testing.T) {
+	testsuite.Reset()
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	assert.Equal(t, "2020-03", UsagePeriod(time.Date(2020, 3, 31, 23, 30, 0, 0, time.UTC)))
+	assert.Equal(t, "2020-03", UsagePeriod(time.Date(2020, 4, 1, 1, 30, 0, 0, time.FixedZone("CAT", 2*60*60))))
+
+	period := UsagePeriod(time.Now())
+
+	// org without any usage has zero for every counter
+	usage, err := GetOrgUsage(ctx, db, Org1, period)
+	assert.NoError(t, err)
+	assert.Equal(t, map[UsageCounter]int{
+		UsageMsgsHandled:      0,
+		UsageSessionsRun:      0,
+		UsageIVRMinutes:       0,
+		UsageClassifierCalls:  0,
+		UsageAirtimeTransfers: 0,
+	}, usage)
+
+	assert.NoError(t, IncrementOrgUsage(ctx, db, Org1, UsageMsgsHandled, 1))
+	assert.NoError(t, IncrementOrgUsage(ctx, db, Org1, UsageMsgsHandled, 1))
+	assert.NoError(t, IncrementOrgUsage(ctx, db, Org1, UsageIVRMinutes, 3))
+	assert.NoError(t, IncrementOrgUsage(ctx, db, Org2, UsageSessionsRun, 1))
+
+	assertUsage := func(orgID OrgID, period string, counter UsageCounter, expected int) {
+		usage, err := GetOrgUsage(ctx, db, orgID, period)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, usage[counter], "%s usage mismatch for org %d in %s", counter, orgID, period)
+	}
+
+	assertUsage(Org1, period, UsageMsgsHandled, 2)
+	assertUsage(Org1, period, UsageIVRMinutes, 3)
+	assertUsage(Org1, period, UsageSessionsRun, 0)
+	assertUsage(Org2, period, UsageSessionsRun, 1)
+
+	// other periods are counted separately
+	assertUsage(Org1, "2000-01", UsageMsgsHandled, 0)
+
+	// squashing leaves one row per counter without changing totals
+	squashed, err := SquashOrgUsage(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, squashed)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM orgs_orgusagecount`, nil, 3)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM orgs_orgusagecount WHERE is_squashed = FALSE`, nil, 0)
+
+	assertUsage(Org1, period, UsageMsgsHandled, 2)
+	assertUsage(Org1, period, UsageIVRMinutes, 3)
+	assertUsage(Org2, period, UsageSessionsRun, 1)
+
+	// squashed counts are included when we squash again
+	assert.NoError(t, IncrementOrgUsage(ctx, db, Org1, UsageMsgsHandled, 5))
+
+	squashed, err = SquashOrgUsage(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, squashed)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM orgs_orgusagecount`, nil, 3)
+	assertUsage(Org1, period, UsageMsgsHandled, 7)
+}
@@ -0,0 +1,382 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/goflow"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// PaymentsServiceName is the name of the internal service which flows call to make payment transfers
+const PaymentsServiceName = "payments"
+
+const (
+	configPaymentService = "payment_service"
+
+	paymentTransfersKey          = "payment_transfers:%d"
+	paymentTransfersByContactKey = "payment_transfers:%d:%s"
+)
+
+// PaymentCategory is the outcome of a payment transfer, which flows can route on
+type PaymentCategory string
+
+const (
+	PaymentCategorySuccess           = PaymentCategory("success")
+	PaymentCategoryInsufficientFunds = PaymentCategory("insufficient_funds")
+	PaymentCategoryInvalidRecipient  = PaymentCategory("invalid_recipient")
+	PaymentCategoryLimitExceeded     = PaymentCategory("limit_exceeded")
+	PaymentCategoryRejected          = PaymentCategory("rejected")
+	PaymentCategoryError             = PaymentCategory("error")
+)
+
+// PaymentRequest is the body of a flow's call to the payments service. The recipient defaults to the contact's
+// preferred URN. Each node in a run makes a transfer once, so a reference must be given to make more than one
+// transfer from the same node, e.g. in a loop.
+//
+//   {
+//     "recipient": "tel:+250788123123",
+//     "amount": "1500",
+//     "currency": "RWF",
+//     "reference": "refund-1234"
+//   }
+//
+type PaymentRequest struct {
+	Recipient urns.URN        `json:"recipient"`
+	Amount    decimal.Decimal `json:"amount"`
+	Currency  string          `json:"currency"`
+	Reference string          `json:"reference"`
+}
+
+// PaymentTransfer is a payment transfer made to a contact by a flow, which is also the response to the flow's call
+//
+//   {
+//     "uuid": "8f6f7b0a-7a2d-4c1f-9a4b-3c2e1d0f5a6b",
+//     "idempotency_key": "5b7e0c8f3a2d4e1f9c6b8a7d0e3f2c1b",
+//     "contact_uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf",
+//     "run_uuid": "1b6a3c5d-7e9f-4a2b-8c0d-2e4f6a8b0c1d",
+//     "service": "http",
+//     "recipient": "tel:+250788123123",
+//     "amount": "1500",
+//     "currency": "RWF",
+//     "reference": "refund-1234",
+//     "category": "success",
+//     "external_id": "TX98765",
+//     "created_on": "2020-05-04T12:30:00Z"
+//   }
+//
+type PaymentTransfer struct {
+	UUID           uuids.UUID        `json:"uuid"`
+	IdempotencyKey string            `json:"idempotency_key"`
+	ContactUUID    flows.ContactUUID `json:"contact_uuid"`
+	RunUUID        flows.RunUUID     `json:"run_uuid"`
+	Service        string            `json:"service"`
+	Recipient      urns.URN          `json:"recipient"`
+	Amount         decimal.Decimal   `json:"amount"`
+	Currency       string            `json:"currency"`
+	Reference      string            `json:"reference,omitempty"`
+	Category       PaymentCategory   `json:"category"`
+	ExternalID     string            `json:"external_id,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	CreatedOn      time.Time         `json:"created_on"`
+
+	// set when the transfer is recorded, from the session which made it
+	ContactID ContactID `json:"-"`
+}
+
+// PaymentService is a provider of payment transfers, e.g. a mobile money aggregator. Transfer sets the category of the
+// passed in transfer, and only returns an error if the outcome of the transfer couldn't be determined. Providers must
+// use the transfer's idempotency key so that retried transfers aren't paid twice.
+type PaymentService interface {
+	Transfer(ctx context.Context, transfer *PaymentTransfer) error
+}
+
+// PaymentServiceFactory creates a payment service from an org's configuration for it
+type PaymentServiceFactory func(config map[string]string, httpClient *http.Client) (PaymentService, error)
+
+var paymentServices = make(map[string]PaymentServiceFactory)
+
+// RegisterPaymentService registers a payment service which orgs can configure by name
+func RegisterPaymentService(name string, factory PaymentServiceFactory) {
+	paymentServices[name] = factory
+}
+
+func init() {
+	paymentHTTPClient := &http.Client{Timeout: time.Duration(60 * time.Second)}
+
+	RegisterPaymentService("http", newHTTPPaymentService)
+
+	goflow.RegisterInternalService(PaymentsServiceName, func(session flows.Session, request *http.Request, simulated bool) (*http.Response, error) {
+		return handlePaymentRequest(session, request, simulated, paymentHTTPClient)
+	})
+}
+
+// PaymentService returns the payment service for this org if one is configured, along with its name. Services are
+// configured in the org config with their credentials, e.g.
+//
+//   "payment_service": {"type": "http", "url": "https://payments.example.com/transfer", "token": "sesame"}
+//
+func (o *Org) PaymentService(httpClient *http.Client) (string, PaymentService, error) {
+	raw, isMap := o.config[configPaymentService].(map[string]interface{})
+	if !isMap {
+		return "", nil, errors.Errorf("no payment service configured for org: %d", o.ID())
+	}
+
+	config := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, isStr := v.(string); isStr {
+			config[k] = s
+		}
+	}
+
+	name := config["type"]
+	factory := paymentServices[name]
+	if factory == nil {
+		return "", nil, errors.Errorf("unknown payment service: %s", name)
+	}
+
+	service, err := factory(config, httpClient)
+	return name, service, err
+}
+
+// handles a flow's call to the payments service
+func handlePaymentRequest(session flows.Session, request *http.Request, simulated bool, httpClient *http.Client) (*http.Response, error) {
+	failed := func(status int, message string) (*http.Response, error) {
+		return goflow.NewInternalResponse(request, status, map[string]string{"category": string(PaymentCategoryError), "message": message})
+	}
+
+	if request.Body == nil {
+		return failed(http.StatusBadRequest, "missing request body")
+	}
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return failed(http.StatusBadRequest, "unable to read request body")
+	}
+
+	payment := &PaymentRequest{}
+	if err := json.Unmarshal(body, payment); err != nil {
+		return failed(http.StatusBadRequest, "request body isn't a valid payment request")
+	}
+	if payment.Amount.Sign() <= 0 || payment.Currency == "" {
+		return failed(http.StatusBadRequest, "payment requests must have a positive amount and a currency")
+	}
+
+	run := goflow.CurrentRun(session)
+	if run == nil {
+		return failed(http.StatusBadRequest, "payments can only be made from flows")
+	}
+
+	contact := session.Contact()
+	recipient := payment.Recipient
+	if recipient == urns.NilURN && contact != nil && len(contact.URNs()) > 0 {
+		preferred := contact.URNs()[0].URN()
+		recipient, _ = urns.NewURNFromParts(preferred.Scheme(), preferred.Path(), "", "")
+	}
+	if recipient == urns.NilURN {
+		return failed(http.StatusBadRequest, "payment request has no recipient")
+	}
+
+	transfer := &PaymentTransfer{
+		UUID:           uuids.New(),
+		IdempotencyKey: paymentIdempotencyKey(run, payment.Reference),
+		RunUUID:        run.UUID(),
+		Recipient:      recipient,
+		Amount:         payment.Amount,
+		Currency:       strings.ToUpper(payment.Currency),
+		Reference:      payment.Reference,
+		CreatedOn:      time.Now().UTC(),
+	}
+	if contact != nil {
+		transfer.ContactUUID = contact.UUID()
+	}
+
+	// simulated sessions get pretend transfers
+	if simulated {
+		transfer.Service = "simulator"
+		transfer.Category = PaymentCategorySuccess
+		return goflow.NewInternalResponse(request, http.StatusOK, transfer)
+	}
+
+	name, service, err := orgFromSession(session).PaymentService(httpClient)
+	if err != nil {
+		return failed(http.StatusNotImplemented, err.Error())
+	}
+	transfer.Service = name
+
+	if err := service.Transfer(request.Context(), transfer); err != nil {
+		logrus.WithError(err).WithField("idempotency_key", transfer.IdempotencyKey).WithField("service", name).Error("error making payment transfer")
+		return failed(http.StatusBadGateway, "payment service error")
+	}
+
+	status := http.StatusOK
+	if transfer.Category != PaymentCategorySuccess {
+		status = http.StatusPaymentRequired
+	}
+	return goflow.NewInternalResponse(request, status, transfer)
+}
+
+// the idempotency key of a transfer is the same every time the same node in the same run makes it, so that webhook
+// retries and sessions being reprocessed don't pay the recipient again
+func paymentIdempotencyKey(run flows.FlowRun, reference string) string {
+	var nodeUUID flows.NodeUUID
+	if path := run.Path(); len(path) > 0 {
+		nodeUUID = path[len(path)-1].NodeUUID()
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s", run.UUID(), nodeUUID, reference)))
+	return hex.EncodeToString(hash[:])[:32]
+}
+
+// ReadPaymentTransfer reads the transfer from the body of a response from the payments service, returning nil if
+// the response isn't for a transfer which was attempted
+func ReadPaymentTransfer(body []byte) *PaymentTransfer {
+	transfer := &PaymentTransfer{}
+	if err := json.Unmarshal(body, transfer); err != nil || transfer.IdempotencyKey == "" {
+		return nil
+	}
+	return transfer
+}
+
+// InsertPaymentTransfers inserts the passed in transfers, ignoring any with an idempotency key which has already been
+// recorded for the org, e.g. because the session which made them is being reprocessed
+func InsertPaymentTransfers(ctx context.Context, tx Queryer, orgID OrgID, transfers []*PaymentTransfer) error {
+	is := make([]interface{}, len(transfers))
+	for i, t := range transfers {
+		transferJSON, err := json.Marshal(t)
+		if err != nil {
+			return errors.Wrapf(err, "error marshalling payment transfer")
+		}
+		is[i] = &paymentTransferRow{
+			UUID:           t.UUID,
+			OrgID:          orgID,
+			ContactID:      t.ContactID,
+			IdempotencyKey: t.IdempotencyKey,
+			Transfer:       transferJSON,
+			CreatedOn:      t.CreatedOn,
+		}
+	}
+
+	return BulkSQL(ctx, "inserting payment transfers", tx, insertPaymentTransfersSQL, is)
+}
+
+type paymentTransferRow struct {
+	UUID           uuids.UUID      `db:"uuid"`
+	OrgID          OrgID           `db:"org_id"`
+	ContactID      ContactID       `db:"contact_id"`
+	IdempotencyKey string          `db:"idempotency_key"`
+	Transfer       json.RawMessage `db:"transfer"`
+	CreatedOn      time.Time       `db:"created_on"`
+}
+
+const insertPaymentTransfersSQL = `
+INSERT INTO
+payments_transfer( uuid,  org_id,  contact_id,  idempotency_key,  transfer,  created_on)
+           VALUES(:uuid, :org_id, :contact_id, :idempotency_key, :transfer, :created_on)
+ON CONFLICT (org_id, idempotency_key) DO NOTHING
+`
+
+// GetPaymentTransfers returns the payment transfers made to the passed in contact, newest first
+func GetPaymentTransfers(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID) ([]*PaymentTransfer, error) {
+	rows, err := db.QueryxContext(ctx, selectContactPaymentTransfersSQL, orgID, contactID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading payment transfers for contact: %d", contactID)
+	}
+	defer rows.Close()
+
+	transfers := make([]*PaymentTransfer, 0)
+	for rows.Next() {
+		var transferJSON json.RawMessage
+		if err := rows.Scan(&transferJSON); err != nil {
+			return nil, errors.Wrapf(err, "error scanning payment transfer")
+		}
+		transfer := &PaymentTransfer{ContactID: contactID}
+		if err := json.Unmarshal(transferJSON, transfer); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling payment transfer")
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+const selectContactPaymentTransfersSQL = `
+SELECT transfer FROM payments_transfer WHERE org_id = $1 AND contact_id = $2 ORDER BY created_on DESC, id DESC
+`
+
+// payment service which posts transfers to a URL, for aggregators or in-house systems which speak our format. The
+// response must have a category and optionally an external id and message, e.g.
+//
+//   {"category": "insufficient_funds", "message": "float balance too low"}
+//
+type httpPaymentService struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+func newHTTPPaymentService(config map[string]string, httpClient *http.Client) (PaymentService, error) {
+	if config["url"] == "" {
+		return nil, errors.New("missing url on http payment service configuration")
+	}
+	return &httpPaymentService{httpClient: httpClient, url: config["url"], token: config["token"]}, nil
+}
+
+func (s *httpPaymentService) Transfer(ctx context.Context, transfer *PaymentTransfer) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"idempotency_key": transfer.IdempotencyKey,
+		"recipient":       transfer.Recipient,
+		"amount":          transfer.Amount,
+		"currency":        transfer.Currency,
+		"reference":       transfer.Reference,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Idempotency-Key", transfer.IdempotencyKey)
+	if s.token != "" {
+		request.Header.Set("Authorization", "Token "+s.token)
+	}
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "error calling payment service")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 500 {
+		return errors.Errorf("payment service returned status %d", response.StatusCode)
+	}
+
+	outcome := &struct {
+		Category   PaymentCategory `json:"category"`
+		ExternalID string          `json:"external_id"`
+		Message    string          `json:"message"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(outcome); err != nil || outcome.Category == "" {
+		return errors.Errorf("payment service returned status %d without a category", response.StatusCode)
+	}
+
+	transfer.Category = outcome.Category
+	transfer.ExternalID = outcome.ExternalID
+	transfer.Message = outcome.Message
+	return nil
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the org config key for whether URNs and contact names should be masked in logs and stored payloads, e.g.
+//
+//   "redact_pii": true
+//
+const configRedactPII = "redact_pii"
+
+// the log fields which are masked for orgs which redact PII, which includes message text and the raw events that
+// carry it
+var piiLogFields = []string{"urn", "contact_name", "text", "event"}
+
+// matches URNs in free text such as error messages, e.g. "unable to load contact for urn: tel:+250700000001"
+var urnRegex = buildURNRegex()
+
+// orgs which redact PII, updated as orgs are loaded so that log entries can be checked without loading the org
+var piiRedactingOrgs sync.Map
+
+// RedactsPII returns whether this org masks URNs and contact names in logs and stored payloads
+func (o *Org) RedactsPII() bool {
+	redact, _ := o.config[configRedactPII].(bool)
+	return redact
+}
+
+// records whether the passed in org redacts PII
+func setPIIRedaction(orgID OrgID, redact bool) {
+	if redact {
+		piiRedactingOrgs.Store(orgID, true)
+	} else {
+		piiRedactingOrgs.Delete(orgID)
+	}
+}
+
+// RedactPII returns the masked form of the passed in value. This is a hash of the value so that the same URN or name
+// can still be correlated across log lines and payloads without being readable.
+func RedactPII(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return "redacted:" + hex.EncodeToString(hash[:])[:12]
+}
+
+// RedactURNs masks anything which looks like a URN in the passed in text
+func RedactURNs(text string) string {
+	return urnRegex.ReplaceAllStringFunc(text, RedactPII)
+}
+
+// builds a regex which matches URNs with any of the schemes we know about
+func buildURNRegex() *regexp.Regexp {
+	schemes := make([]string, 0, len(urns.ValidSchemes))
+	for scheme := range urns.ValidSchemes {
+		schemes = append(schemes, regexp.QuoteMeta(scheme))
+	}
+	sort.Strings(schemes)
+
+	return regexp.MustCompile(`\b(?:` + strings.Join(schemes, "|") + `):[^\s"',;]*[^\s"',;:.]`)
+}
+
+// RedactContactPII masks the URNs and name of the passed in contact wherever they appear in the passed in text
+func RedactContactPII(text string, contact *flows.Contact) string {
+	if contact == nil {
+		return text
+	}
+
+	for _, u := range contact.URNs() {
+		urn := u.URN()
+		text = strings.Replace(text, urn.Identity().String(), RedactPII(urn.Identity().String()), -1)
+		text = strings.Replace(text, urn.Path(), RedactPII(urn.Path()), -1)
+	}
+	if contact.Name() != "" {
+		text = strings.Replace(text, contact.Name(), RedactPII(contact.Name()), -1)
+	}
+	return text
+}
+
+// PIIRedactionHook is a logrus hook which masks URNs, contact names and message text in log entries for orgs which
+// redact PII, including URNs in errors and messages. Log entries need an org_id field for this to apply.
+type PIIRedactionHook struct{}
+
+// Levels returns the levels this hook applies to, which is all of them
+func (h *PIIRedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks any PII fields on the passed in entry if it's for an org which redacts PII
+func (h *PIIRedactionHook) Fire(entry *logrus.Entry) error {
+	var orgID OrgID
+	switch id := entry.Data["org_id"].(type) {
+	case OrgID:
+		orgID = id
+	case int:
+		orgID = OrgID(id)
+	default:
+		return nil
+	}
+
+	if _, redact := piiRedactingOrgs.Load(orgID); !redact {
+		return nil
+	}
+
+	for _, field := range piiLogFields {
+		if value, found := entry.Data[field]; found {
+			entry.Data[field] = RedactPII(fmt.Sprint(value))
+		}
+	}
+
+	// errors and messages often include the URN they were about
+	if err, isErr := entry.Data[logrus.ErrorKey].(error); isErr {
+		if redacted := RedactURNs(err.Error()); redacted != err.Error() {
+			entry.Data[logrus.ErrorKey] = errors.New(redacted)
+		}
+	}
+	entry.Message = RedactURNs(entry.Message)
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPIIRedaction(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+	defer setPIIRedaction(Org1, false)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"redact_pii": true}' WHERE id = $1`, Org1)
+
+	org, err := NewOrgAssets(ctx, db, Org1, nil)
+	require.NoError(t, err)
+	assert.True(t, org.Org().RedactsPII())
+
+	// same value always gives the same hash so it can be correlated
+	assert.Equal(t, RedactPII("tel:+250700000001"), RedactPII("tel:+250700000001"))
+	assert.NotEqual(t, RedactPII("tel:+250700000001"), RedactPII("tel:+250700000002"))
+	assert.Regexp(t, `^redacted:[0-9a-f]{12}$`, RedactPII("Cathy"))
+
+	hook := &PIIRedactionHook{}
+	entry := logrus.WithFields(logrus.Fields{"org_id": Org1, "urn": "tel:+250700000001", "contact_name": "Cathy", "text": "hi"})
+	assert.NoError(t, hook.Fire(entry))
+	assert.Equal(t, RedactPII("tel:+250700000001"), entry.Data["urn"])
+	assert.Equal(t, RedactPII("Cathy"), entry.Data["contact_name"])
+	assert.Equal(t, RedactPII("hi"), entry.Data["text"])
+
+	// as are URNs in errors and messages
+	entry = logrus.WithFields(logrus.Fields{"org_id": Org1}).WithError(errors.New("unable to load contact for urn: tel:+250700000001: no rows"))
+	entry.Message = "error handling whatsapp:250700000001"
+	assert.NoError(t, hook.Fire(entry))
+	assert.EqualError(t, entry.Data["error"].(error), "unable to load contact for urn: "+RedactPII("tel:+250700000001")+": no rows")
+	assert.Equal(t, "error handling "+RedactPII("whatsapp:250700000001"), entry.Message)
+
+	assert.Equal(t, "no urns here: 12:30", RedactURNs("no urns here: 12:30"))
+
+	// entries for other orgs or without an org are left alone
+	entry = logrus.WithFields(logrus.Fields{"org_id": Org2, "urn": "tel:+250700000001"})
+	assert.NoError(t, hook.Fire(entry))
+	assert.Equal(t, "tel:+250700000001", entry.Data["urn"])
+
+	entry = logrus.WithFields(logrus.Fields{"urn": "tel:+250700000001"})
+	assert.NoError(t, hook.Fire(entry))
+	assert.Equal(t, "tel:+250700000001", entry.Data["urn"])
+
+	// mask Cathy's URN and name in a payload
+	session, err := NewSessionAssets(org)
+	require.NoError(t, err)
+
+	contacts, err := LoadContacts(ctx, db, org, []ContactID{CathyID})
+	require.NoError(t, err)
+	contact, err := contacts[0].FlowContact(org, session)
+	require.NoError(t, err)
+
+	redacted := RedactContactPII(`{"name": "Cathy", "urn": "tel:+250700000001", "phone": "+250700000001"}`, contact)
+	assert.NotContains(t, redacted, "Cathy")
+	assert.NotContains(t, redacted, "250700000001")
+	assert.Contains(t, redacted, RedactPII("Cathy"))
+	assert.Contains(t, redacted, RedactPII("tel:+250700000001"))
+
+	// org no longer redacting once config is changed and it's reloaded
+	db.MustExec(`UPDATE orgs_org SET config = '{}' WHERE id = $1`, Org1)
+	_, err = loadOrg(ctx, db, Org1)
+	require.NoError(t, err)
+
+	entry = logrus.WithFields(logrus.Fields{"org_id": Org1, "urn": "tel:+250700000001"})
+	assert.NoError(t, hook.Fire(entry))
+	assert.Equal(t, "tel:+250700000001", entry.Data["urn"])
+}
@@ -0,0 +1,871 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/goflow"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PromotionPackage is the flows, globals, campaigns and triggers of an org which changed after a point in time, e.g.
+// since they were last promoted from a staging org to a production org. Flows and campaigns are matched between orgs by
+// name, as their UUIDs are unique across all orgs and those created by a promotion are given new UUIDs. Campaign events
+// are matched by field, offset, unit and flow, globals by key and triggers by type, keyword, referrer and channel.
+// Groups are referenced by name and fields by key. Campaigns only include events which start flows.
+type PromotionPackage struct {
+	SourceOrgID OrgID               `json:"source_org_id"`
+	Since       time.Time           `json:"since"`
+	ExportedOn  time.Time           `json:"exported_on"`
+	Flows       []*PromotedFlow     `json:"flows"`
+	Globals     []*PromotedGlobal   `json:"globals"`
+	Campaigns   []*PromotedCampaign `json:"campaigns"`
+	Triggers    []*PromotedTrigger  `json:"triggers"`
+}
+
+// PromotedFlow is a flow and the definition of its latest revision
+type PromotedFlow struct {
+	UUID                assets.FlowUUID `json:"uuid"`
+	Name                string          `json:"name"`
+	FlowType            FlowType        `json:"flow_type"`
+	ExpiresAfterMinutes int             `json:"expires_after_minutes"`
+	IgnoreTriggers      bool            `json:"ignore_triggers"`
+	SpecVersion         string          `json:"spec_version"`
+	Definition          json.RawMessage `json:"definition"`
+}
+
+// PromotedGlobal is a global
+type PromotedGlobal struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PromotedCampaign is a campaign and all its events which start flows
+type PromotedCampaign struct {
+	UUID   CampaignUUID             `json:"uuid"`
+	Name   string                   `json:"name"`
+	Group  string                   `json:"group"`
+	Events []*PromotedCampaignEvent `json:"events"`
+}
+
+// PromotedCampaignEvent is a campaign event which starts a flow
+type PromotedCampaignEvent struct {
+	UUID         CampaignEventUUID     `json:"uuid"`
+	RelativeTo   string                `json:"relative_to"`
+	Offset       int                   `json:"offset"`
+	Unit         string                `json:"unit"`
+	StartMode    string                `json:"start_mode"`
+	DeliveryHour int                   `json:"delivery_hour"`
+	Flow         *assets.FlowReference `json:"flow"`
+}
+
+// PromotedTrigger is a trigger which isn't for a schedule, as schedules are promoted by scheduling
+type PromotedTrigger struct {
+	TriggerType TriggerType           `json:"trigger_type"`
+	Keyword     *string               `json:"keyword"`
+	MatchType   *string               `json:"match_type"`
+	ReferrerID  *string               `json:"referrer_id"`
+	Channel     *assets.ChannelUUID   `json:"channel"`
+	Flow        *assets.FlowReference `json:"flow"`
+	Groups      []string              `json:"groups"`
+}
+
+// key returns how this trigger is matched with triggers in other orgs
+func (t *PromotedTrigger) key() string {
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	channel := ""
+	if t.Channel != nil {
+		channel = string(*t.Channel)
+	}
+	return fmt.Sprintf("%s|%s|%s|%s", t.TriggerType, str(t.Keyword), str(t.ReferrerID), channel)
+}
+
+// PromotionConflict is a reason an item of a promotion package can't be applied to an org
+type PromotionConflict struct {
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// PromotionChange is a change made, or which would be made, to an org by applying a promotion package
+type PromotionChange struct {
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+}
+
+// PromotionResult is the result of applying a promotion package to an org
+type PromotionResult struct {
+	Conflicts []*PromotionConflict `json:"conflicts"`
+	Changes   []*PromotionChange   `json:"changes"`
+	Applied   bool                 `json:"applied"`
+
+	// the campaign events created or changed, which need to be rescheduled
+	ScheduleEventIDs []CampaignEventID `json:"-"`
+}
+
+const (
+	promotionTypeFlow     = "flow"
+	promotionTypeGlobal   = "global"
+	promotionTypeCampaign = "campaign"
+	promotionTypeEvent    = "campaign_event"
+	promotionTypeTrigger  = "trigger"
+
+	promotionCreated     = "created"
+	promotionUpdated     = "updated"
+	promotionDeactivated = "deactivated"
+)
+
+const selectPromotedFlowsSQL = `
+SELECT ROW_TO_JSON(r) FROM (SELECT
+	f.uuid,
+	f.name,
+	f.flow_type,
+	f.expires_after_minutes,
+	f.ignore_triggers,
+	fr.spec_version,
+	fr.definition::jsonb || JSONB_BUILD_OBJECT(
+		'name', f.name,
+		'uuid', f.uuid,
+		'metadata', COALESCE(fr.definition::jsonb->'metadata', '{}'::jsonb) || JSONB_BUILD_OBJECT('uuid', f.uuid, 'name', f.name)
+	) AS definition
+FROM
+	flows_flow f
+	JOIN LATERAL (
+		SELECT spec_version, definition FROM flows_flowrevision WHERE flow_id = f.id AND is_active = TRUE ORDER BY revision DESC LIMIT 1
+	) fr ON TRUE
+WHERE
+	f.org_id = $1 AND
+	f.is_active = TRUE AND
+	f.is_archived = FALSE AND
+	f.is_system = FALSE AND
+	f.saved_on >= $2
+ORDER BY
+	f.name, f.uuid
+) r;`
+
+const selectPromotedGlobalsSQL = `
+SELECT ROW_TO_JSON(r) FROM (SELECT
+	key,
+	name,
+	value
+FROM
+	globals_global
+WHERE
+	org_id = $1 AND
+	is_active = TRUE AND
+	modified_on >= $2
+ORDER BY
+	key
+) r;`
+
+const selectPromotedCampaignsSQL = `
+SELECT ROW_TO_JSON(r) FROM (SELECT
+	c.uuid,
+	c.name,
+	g.name AS group,
+	(SELECT ARRAY_TO_JSON(ARRAY_AGG(ROW_TO_JSON(e) ORDER BY e.uuid)) FROM (
+		SELECT
+			ce.uuid,
+			fi.key AS relative_to,
+			ce."offset",
+			ce.unit,
+			ce.start_mode,
+			ce.delivery_hour,
+			JSON_BUILD_OBJECT('uuid', f.uuid, 'name', f.name) AS flow
+		FROM
+			campaigns_campaignevent ce
+			JOIN contacts_contactfield fi ON fi.id = ce.relative_to_id
+			JOIN flows_flow f ON f.id = ce.flow_id
+		WHERE
+			ce.campaign_id = c.id AND
+			ce.is_active = TRUE AND
+			ce.event_type = 'F'
+	) e) AS events
+FROM
+	campaigns_campaign c
+	JOIN contacts_contactgroup g ON g.id = c.group_id
+WHERE
+	c.org_id = $1 AND
+	c.is_active = TRUE AND
+	c.is_archived = FALSE AND
+	(c.modified_on >= $2 OR EXISTS (SELECT 1 FROM campaigns_campaignevent ce WHERE ce.campaign_id = c.id AND ce.modified_on >= $2))
+ORDER BY
+	c.name, c.uuid
+) r;`
+
+const selectPromotedTriggersSQL = `
+SELECT ROW_TO_JSON(r) FROM (SELECT
+	t.trigger_type,
+	t.keyword,
+	t.match_type,
+	t.referrer_id,
+	ch.uuid AS channel,
+	JSON_BUILD_OBJECT('uuid', f.uuid, 'name', f.name) AS flow,
+	(SELECT ARRAY_AGG(g.name ORDER BY g.name) FROM triggers_trigger_groups tg JOIN contacts_contactgroup g ON g.id = tg.contactgroup_id WHERE tg.trigger_id = t.id) AS groups
+FROM
+	triggers_trigger t
+	JOIN flows_flow f ON f.id = t.flow_id
+	LEFT JOIN channels_channel ch ON ch.id = t.channel_id
+WHERE
+	t.org_id = $1 AND
+	t.is_active = TRUE AND
+	t.is_archived = FALSE AND
+	t.trigger_type != 'S' AND
+	t.modified_on >= $2
+ORDER BY
+	t.trigger_type, t.keyword, t.id
+) r;`
+
+// ExportPromotion returns a package of the flows, globals, campaigns and triggers of the passed in org which changed
+// at or after the passed in time
+func ExportPromotion(ctx context.Context, db *sqlx.DB, orgID OrgID, since time.Time) (*PromotionPackage, error) {
+	pkg := &PromotionPackage{
+		SourceOrgID: orgID,
+		Since:       since,
+		ExportedOn:  time.Now(),
+		Flows:       make([]*PromotedFlow, 0),
+		Globals:     make([]*PromotedGlobal, 0),
+		Campaigns:   make([]*PromotedCampaign, 0),
+		Triggers:    make([]*PromotedTrigger, 0),
+	}
+
+	err := selectPromoted(ctx, db, selectPromotedFlowsSQL, orgID, since, func() interface{} {
+		f := &PromotedFlow{}
+		pkg.Flows = append(pkg.Flows, f)
+		return f
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting flows to promote")
+	}
+
+	err = selectPromoted(ctx, db, selectPromotedGlobalsSQL, orgID, since, func() interface{} {
+		g := &PromotedGlobal{}
+		pkg.Globals = append(pkg.Globals, g)
+		return g
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting globals to promote")
+	}
+
+	err = selectPromoted(ctx, db, selectPromotedCampaignsSQL, orgID, since, func() interface{} {
+		c := &PromotedCampaign{}
+		pkg.Campaigns = append(pkg.Campaigns, c)
+		return c
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting campaigns to promote")
+	}
+
+	err = selectPromoted(ctx, db, selectPromotedTriggersSQL, orgID, since, func() interface{} {
+		t := &PromotedTrigger{}
+		pkg.Triggers = append(pkg.Triggers, t)
+		return t
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting triggers to promote")
+	}
+
+	return pkg, nil
+}
+
+// selects rows of JSON, reading each into the item returned by next
+func selectPromoted(ctx context.Context, db *sqlx.DB, sql string, orgID OrgID, since time.Time, next func() interface{}) error {
+	rows, err := db.QueryxContext(ctx, sql, orgID, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := readJSONRow(rows, next()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// the state of an org which a promotion package is checked against and applied to. Flows and campaigns are by name, and
+// campaign events by campaign and eventMatchKey.
+type promotionTarget struct {
+	flows     map[string]*promotionTargetItem
+	globals   map[string]*promotionTargetItem
+	campaigns map[string]*promotionTargetItem
+	events    map[string]*promotionTargetItem
+	triggers  map[string]*promotionTargetItem
+	groups    map[string]*promotionTargetItem
+	fields    map[string]*promotionTargetItem
+	channels  map[assets.ChannelUUID]*promotionTargetItem
+}
+
+type promotionTargetItem struct {
+	ID         int64
+	UUID       string
+	Key        string
+	Name       string
+	ModifiedOn time.Time
+	ParentID   int64
+}
+
+// returns how a campaign event is matched with the events of a campaign in another org
+func eventMatchKey(relativeTo string, offset int, unit string, flowUUID assets.FlowUUID) string {
+	return fmt.Sprintf("%s|%d|%s|%s", relativeTo, offset, unit, flowUUID)
+}
+
+// returns the key of the event with the passed in key in the campaign with the passed in id in the target events
+func campaignEventKey(campaignID int64, key string) string {
+	return fmt.Sprintf("%d|%s", campaignID, key)
+}
+
+const selectPromotionTargetSQL = `
+SELECT 'flow' AS type, id, uuid::text, uuid::text AS key, name, saved_on AS modified_on, 0 AS parent_id FROM flows_flow WHERE org_id = $1 AND is_active = TRUE
+UNION ALL
+SELECT 'global', id, uuid::text, key, name, modified_on, 0 FROM globals_global WHERE org_id = $1 AND is_active = TRUE
+UNION ALL
+SELECT 'campaign', id, uuid::text, uuid::text, name, modified_on, 0 FROM campaigns_campaign WHERE org_id = $1 AND is_active = TRUE
+UNION ALL
+SELECT 'campaign_event', e.id, e.uuid::text, CONCAT_WS('|', fi.key, e."offset", e.unit, f.uuid), '', e.modified_on, e.campaign_id FROM campaigns_campaignevent e JOIN campaigns_campaign c ON c.id = e.campaign_id JOIN contacts_contactfield fi ON fi.id = e.relative_to_id JOIN flows_flow f ON f.id = e.flow_id WHERE c.org_id = $1 AND e.is_active = TRUE AND e.event_type = 'F'
+UNION ALL
+SELECT 'trigger', t.id, '', CONCAT_WS('|', t.trigger_type, COALESCE(t.keyword, ''), COALESCE(t.referrer_id, ''), COALESCE(ch.uuid, '')), '', t.modified_on, 0 FROM triggers_trigger t LEFT JOIN channels_channel ch ON ch.id = t.channel_id WHERE t.org_id = $1 AND t.is_active = TRUE AND t.is_archived = FALSE AND t.trigger_type != 'S'
+UNION ALL
+SELECT 'group', id, uuid::text, name, name, modified_on, 0 FROM contacts_contactgroup WHERE org_id = $1 AND is_active = TRUE
+UNION ALL
+SELECT 'field', id, uuid::text, key, label, modified_on, 0 FROM contacts_contactfield WHERE org_id = $1 AND is_active = TRUE
+UNION ALL
+SELECT 'channel', id, uuid::text, uuid::text, COALESCE(name, ''), modified_on, 0 FROM channels_channel WHERE org_id = $1 AND is_active = TRUE
+`
+
+func loadPromotionTarget(ctx context.Context, tx *sqlx.Tx, orgID OrgID) (*promotionTarget, error) {
+	target := &promotionTarget{
+		flows:     make(map[string]*promotionTargetItem),
+		globals:   make(map[string]*promotionTargetItem),
+		campaigns: make(map[string]*promotionTargetItem),
+		events:    make(map[string]*promotionTargetItem),
+		triggers:  make(map[string]*promotionTargetItem),
+		groups:    make(map[string]*promotionTargetItem),
+		fields:    make(map[string]*promotionTargetItem),
+		channels:  make(map[assets.ChannelUUID]*promotionTargetItem),
+	}
+
+	rows, err := tx.QueryxContext(ctx, selectPromotionTargetSQL, orgID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting assets of org: %d", orgID)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var itemType string
+		item := &promotionTargetItem{}
+		if err := rows.Scan(&itemType, &item.ID, &item.UUID, &item.Key, &item.Name, &item.ModifiedOn, &item.ParentID); err != nil {
+			return nil, errors.Wrapf(err, "error scanning asset of org: %d", orgID)
+		}
+
+		switch itemType {
+		case "flow":
+			target.flows[item.Name] = item
+		case "global":
+			target.globals[item.Key] = item
+		case "campaign":
+			target.campaigns[item.Name] = item
+		case "campaign_event":
+			target.events[campaignEventKey(item.ParentID, item.Key)] = item
+		case "trigger":
+			target.triggers[item.Key] = item
+		case "group":
+			target.groups[item.Key] = item
+		case "field":
+			target.fields[item.Key] = item
+		case "channel":
+			target.channels[assets.ChannelUUID(item.Key)] = item
+		}
+	}
+	return target, rows.Err()
+}
+
+// how a promotion package will be applied to an org
+type promotionPlan struct {
+	// the UUIDs the promoted flows have in the org, by their UUIDs in the source org
+	flowUUIDs map[assets.FlowUUID]assets.FlowUUID
+
+	// the definitions of the promoted flows with their references to flows and groups changed to those of the org, by
+	// their UUIDs in the source org
+	definitions map[assets.FlowUUID]json.RawMessage
+}
+
+// resolves a reference to a flow in the source org to the UUID of that flow in the target org, which is either a flow
+// being promoted or an existing flow with the same name
+func (p *promotionPlan) resolveFlow(target *promotionTarget, ref *assets.FlowReference) (assets.FlowUUID, bool) {
+	if ref == nil {
+		return "", false
+	}
+	if uuid, promoted := p.flowUUIDs[ref.UUID]; promoted {
+		return uuid, true
+	}
+	if existing := target.flows[ref.Name]; existing != nil {
+		return assets.FlowUUID(existing.UUID), true
+	}
+	return "", false
+}
+
+// returns a copy of the passed in definition with every string value which is a key of mapping replaced by its value
+func rewritePromotedDefinition(definition json.RawMessage, mapping map[string]string) (json.RawMessage, error) {
+	g, err := utils.JSONDecodeGeneric(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	var rewrite func(v interface{}) interface{}
+	rewrite = func(v interface{}) interface{} {
+		switch typed := v.(type) {
+		case map[string]interface{}:
+			for k, e := range typed {
+				typed[k] = rewrite(e)
+			}
+		case []interface{}:
+			for i, e := range typed {
+				typed[i] = rewrite(e)
+			}
+		case string:
+			if mapped, found := mapping[typed]; found {
+				return mapped
+			}
+		}
+		return v
+	}
+
+	return utils.JSONMarshal(rewrite(g))
+}
+
+// ApplyPromotion applies the passed in package to the passed in org, as the passed in user. Items which were changed
+// in the org after the package's since time, i.e. which have been changed in both orgs, and items whose dependencies
+// don't exist in the org are conflicts. If there are any conflicts, or if dryRun is true, nothing is applied and the
+// result lists the conflicts and the changes which would be made. Campaign events which are created or changed need
+// to be rescheduled by the caller once this returns.
+func ApplyPromotion(ctx context.Context, db *sqlx.DB, org *OrgAssets, userID int64, pkg *PromotionPackage, dryRun bool) (*PromotionResult, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error starting transaction")
+	}
+	defer tx.Rollback()
+
+	target, err := loadPromotionTarget(ctx, tx, org.OrgID())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PromotionResult{Conflicts: make([]*PromotionConflict, 0), Changes: make([]*PromotionChange, 0)}
+
+	plan, err := checkPromotion(org, target, pkg, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Conflicts) > 0 || dryRun {
+		return result, nil
+	}
+
+	if err := applyPromotion(ctx, tx, org.OrgID(), userID, target, plan, pkg, result); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrapf(err, "error committing promotion")
+	}
+	result.Applied = true
+
+	logrus.WithField("org_id", org.OrgID()).WithField("source_org_id", pkg.SourceOrgID).WithField("changes", len(result.Changes)).Info("promotion applied")
+
+	return result, nil
+}
+
+// checks the passed in package against the target org, adding conflicts and the changes which would be made to the
+// passed in result, and returns how the package will be applied
+func checkPromotion(org *OrgAssets, target *promotionTarget, pkg *PromotionPackage, result *PromotionResult) (*promotionPlan, error) {
+	conflict := func(itemType, key, reason string, args ...interface{}) {
+		result.Conflicts = append(result.Conflicts, &PromotionConflict{Type: itemType, Key: key, Reason: fmt.Sprintf(reason, args...)})
+	}
+	change := func(itemType, key string, existing bool) {
+		action := promotionCreated
+		if existing {
+			action = promotionUpdated
+		}
+		result.Changes = append(result.Changes, &PromotionChange{Type: itemType, Key: key, Action: action})
+	}
+	changedSince := func(item *promotionTargetItem) bool {
+		return item != nil && item.ModifiedOn.After(pkg.Since)
+	}
+
+	plan := &promotionPlan{
+		flowUUIDs:   make(map[assets.FlowUUID]assets.FlowUUID, len(pkg.Flows)),
+		definitions: make(map[assets.FlowUUID]json.RawMessage, len(pkg.Flows)),
+	}
+
+	// flows in the package can depend on each other so they all need UUIDs in the org before we check any of them
+	created := make(map[assets.FlowUUID]bool)
+	for _, f := range pkg.Flows {
+		if existing := target.flows[f.Name]; existing != nil {
+			plan.flowUUIDs[f.UUID] = assets.FlowUUID(existing.UUID)
+		} else {
+			plan.flowUUIDs[f.UUID] = assets.FlowUUID(uuids.New())
+			created[plan.flowUUIDs[f.UUID]] = true
+		}
+	}
+
+	sa, err := GetSessionAssets(org)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating session assets")
+	}
+
+	for _, f := range pkg.Flows {
+		key := string(f.UUID)
+		existing := target.flows[f.Name]
+		if changedSince(existing) {
+			conflict(promotionTypeFlow, key, "flow '%s' has been changed since %s", existing.Name, pkg.Since.Format(time.RFC3339))
+		}
+
+		flow, err := goflow.ReadFlow(f.Definition)
+		if err != nil {
+			conflict(promotionTypeFlow, key, "invalid definition: %s", err)
+			continue
+		}
+
+		// change references to this flow, other flows and groups to those of the org
+		mapping := map[string]string{string(f.UUID): string(plan.flowUUIDs[f.UUID]), string(flow.UUID()): string(plan.flowUUIDs[f.UUID])}
+		for _, ref := range flow.ExtractDependencies() {
+			switch typed := ref.(type) {
+			case *assets.FlowReference:
+				if uuid, found := plan.resolveFlow(target, typed); found {
+					mapping[string(typed.UUID)] = string(uuid)
+				}
+			case *assets.GroupReference:
+				if group := target.groups[typed.Name]; group != nil && typed.UUID != "" {
+					mapping[string(typed.UUID)] = group.UUID
+				}
+			}
+		}
+
+		definition, err := rewritePromotedDefinition(f.Definition, mapping)
+		if err != nil {
+			conflict(promotionTypeFlow, key, "invalid definition: %s", err)
+			continue
+		}
+		plan.definitions[f.UUID] = definition
+
+		flow, err = goflow.ReadFlow(definition)
+		if err != nil {
+			conflict(promotionTypeFlow, key, "invalid definition: %s", err)
+			continue
+		}
+		err = flow.CheckDependencies(sa, func(ref assets.Reference) {
+			if flowRef, isFlow := ref.(*assets.FlowReference); isFlow && created[flowRef.UUID] {
+				return
+			}
+			conflict(promotionTypeFlow, key, "missing dependency %s", ref)
+		})
+		if err != nil {
+			conflict(promotionTypeFlow, key, "invalid definition: %s", err)
+		}
+
+		change(promotionTypeFlow, key, existing != nil)
+	}
+
+	for _, g := range pkg.Globals {
+		existing := target.globals[g.Key]
+		if changedSince(existing) {
+			conflict(promotionTypeGlobal, g.Key, "global '%s' has been changed since %s", g.Key, pkg.Since.Format(time.RFC3339))
+		}
+		change(promotionTypeGlobal, g.Key, existing != nil)
+	}
+
+	for _, c := range pkg.Campaigns {
+		key := string(c.UUID)
+		existing := target.campaigns[c.Name]
+		if changedSince(existing) {
+			conflict(promotionTypeCampaign, key, "campaign '%s' has been changed since %s", existing.Name, pkg.Since.Format(time.RFC3339))
+		}
+		if existing != nil {
+			for _, e := range target.events {
+				if e.ParentID == existing.ID && changedSince(e) {
+					conflict(promotionTypeCampaign, key, "an event of campaign '%s' has been changed since %s", existing.Name, pkg.Since.Format(time.RFC3339))
+					break
+				}
+			}
+		}
+		if target.groups[c.Group] == nil {
+			conflict(promotionTypeCampaign, key, "missing group '%s'", c.Group)
+		}
+		change(promotionTypeCampaign, key, existing != nil)
+
+		for _, e := range c.Events {
+			eventKey := string(e.UUID)
+			if target.fields[e.RelativeTo] == nil {
+				conflict(promotionTypeEvent, eventKey, "missing field '%s'", e.RelativeTo)
+			}
+			flowUUID, flowFound := plan.resolveFlow(target, e.Flow)
+			if !flowFound {
+				conflict(promotionTypeEvent, eventKey, "missing flow %s", e.Flow)
+			}
+
+			var event *promotionTargetItem
+			if existing != nil && flowFound {
+				event = target.events[campaignEventKey(existing.ID, eventMatchKey(e.RelativeTo, e.Offset, e.Unit, flowUUID))]
+			}
+			change(promotionTypeEvent, eventKey, event != nil)
+		}
+	}
+
+	for _, t := range pkg.Triggers {
+		key := t.key()
+		existing := target.triggers[key]
+		if changedSince(existing) {
+			conflict(promotionTypeTrigger, key, "trigger has been changed since %s", pkg.Since.Format(time.RFC3339))
+		}
+		if _, found := plan.resolveFlow(target, t.Flow); !found {
+			conflict(promotionTypeTrigger, key, "missing flow %s", t.Flow)
+		}
+		if t.Channel != nil && target.channels[*t.Channel] == nil {
+			conflict(promotionTypeTrigger, key, "missing channel %s", *t.Channel)
+		}
+		for _, g := range t.Groups {
+			if target.groups[g] == nil {
+				conflict(promotionTypeTrigger, key, "missing group '%s'", g)
+			}
+		}
+		change(promotionTypeTrigger, key, existing != nil)
+	}
+
+	return plan, nil
+}
+
+const updatePromotedFlowSQL = `
+UPDATE
+	flows_flow
+SET
+	name = $2,
+	expires_after_minutes = $3,
+	ignore_triggers = $4,
+	version_number = $5,
+	saved_on = NOW(),
+	saved_by_id = $6,
+	modified_on = NOW(),
+	modified_by_id = $6
+WHERE
+	id = $1
+`
+
+const insertPromotedFlowSQL = `
+INSERT INTO
+	flows_flow(is_active, created_on, modified_on, uuid, name, is_archived, is_system, flow_type, metadata, expires_after_minutes, ignore_triggers, saved_on, version_number, created_by_id, modified_by_id, org_id, saved_by_id)
+	VALUES(TRUE, NOW(), NOW(), $1, $2, FALSE, FALSE, $3, '{}', $4, $5, NOW(), $6, $7, $7, $8, $7)
+RETURNING id
+`
+
+const insertPromotedFlowRevisionSQL = `
+INSERT INTO
+	flows_flowrevision(is_active, created_on, modified_on, definition, spec_version, revision, created_by_id, modified_by_id, flow_id)
+	VALUES(TRUE, NOW(), NOW(), $2, $3, (SELECT COALESCE(MAX(revision), 0) + 1 FROM flows_flowrevision WHERE flow_id = $1), $4, $4, $1)
+`
+
+const updatePromotedGlobalSQL = `UPDATE globals_global SET name = $2, value = $3, modified_on = NOW(), modified_by_id = $4 WHERE id = $1`
+
+const insertPromotedGlobalSQL = `
+INSERT INTO
+	globals_global(is_active, created_on, modified_on, uuid, key, name, value, created_by_id, modified_by_id, org_id)
+	VALUES(TRUE, NOW(), NOW(), $1, $2, $3, $4, $5, $5, $6)
+`
+
+const updatePromotedCampaignSQL = `UPDATE campaigns_campaign SET name = $2, group_id = $3, modified_on = NOW(), modified_by_id = $4 WHERE id = $1`
+
+const insertPromotedCampaignSQL = `
+INSERT INTO
+	campaigns_campaign(is_active, created_on, modified_on, uuid, name, is_archived, created_by_id, group_id, modified_by_id, org_id)
+	VALUES(TRUE, NOW(), NOW(), $1, $2, FALSE, $3, $4, $3, $5)
+RETURNING id
+`
+
+const updatePromotedEventSQL = `
+UPDATE
+	campaigns_campaignevent
+SET
+	"offset" = $2,
+	unit = $3,
+	start_mode = $4,
+	delivery_hour = $5,
+	flow_id = $6,
+	relative_to_id = $7,
+	modified_on = NOW(),
+	modified_by_id = $8
+WHERE
+	id = $1
+`
+
+const insertPromotedEventSQL = `
+INSERT INTO
+	campaigns_campaignevent(is_active, created_on, modified_on, uuid, "offset", unit, start_mode, event_type, delivery_hour, campaign_id, created_by_id, flow_id, modified_by_id, relative_to_id)
+	VALUES(TRUE, NOW(), NOW(), $1, $2, $3, $4, 'F', $5, $6, $7, $8, $7, $9)
+RETURNING id
+`
+
+const deactivatePromotedEventSQL = `UPDATE campaigns_campaignevent SET is_active = FALSE, modified_on = NOW(), modified_by_id = $2 WHERE id = $1`
+
+const updatePromotedTriggerSQL = `UPDATE triggers_trigger SET match_type = $2, flow_id = $3, modified_on = NOW(), modified_by_id = $4 WHERE id = $1`
+
+const insertPromotedTriggerSQL = `
+INSERT INTO
+	triggers_trigger(is_active, created_on, modified_on, keyword, referrer_id, is_archived, trigger_type, match_type, channel_id, created_by_id, flow_id, modified_by_id, org_id)
+	VALUES(TRUE, NOW(), NOW(), $1, $2, FALSE, $3, $4, $5, $6, $7, $6, $8)
+RETURNING id
+`
+
+// applies the passed in package to the target org, whose state has been checked and has no conflicts
+func applyPromotion(ctx context.Context, tx *sqlx.Tx, orgID OrgID, userID int64, target *promotionTarget, plan *promotionPlan, pkg *PromotionPackage, result *PromotionResult) error {
+	// flows are applied first so that campaign events and triggers can reference new flows
+	flowIDs := make(map[assets.FlowUUID]int64, len(target.flows)+len(pkg.Flows))
+	for _, f := range target.flows {
+		flowIDs[assets.FlowUUID(f.UUID)] = f.ID
+	}
+	flowID := func(ref *assets.FlowReference) int64 {
+		uuid, _ := plan.resolveFlow(target, ref)
+		return flowIDs[uuid]
+	}
+
+	for _, f := range pkg.Flows {
+		flowUUID := plan.flowUUIDs[f.UUID]
+		id, exists := flowIDs[flowUUID]
+		if exists {
+			_, err := tx.ExecContext(ctx, updatePromotedFlowSQL, id, f.Name, f.ExpiresAfterMinutes, f.IgnoreTriggers, f.SpecVersion, userID)
+			if err != nil {
+				return errors.Wrapf(err, "error updating flow %s", flowUUID)
+			}
+		} else {
+			err := tx.GetContext(ctx, &id, insertPromotedFlowSQL, flowUUID, f.Name, f.FlowType, f.ExpiresAfterMinutes, f.IgnoreTriggers, f.SpecVersion, userID, orgID)
+			if err != nil {
+				return errors.Wrapf(err, "error inserting flow %s", flowUUID)
+			}
+			flowIDs[flowUUID] = id
+		}
+
+		_, err := tx.ExecContext(ctx, insertPromotedFlowRevisionSQL, id, string(plan.definitions[f.UUID]), f.SpecVersion, userID)
+		if err != nil {
+			return errors.Wrapf(err, "error inserting revision of flow %s", flowUUID)
+		}
+	}
+
+	for _, g := range pkg.Globals {
+		var err error
+		if existing := target.globals[g.Key]; existing != nil {
+			_, err = tx.ExecContext(ctx, updatePromotedGlobalSQL, existing.ID, g.Name, g.Value, userID)
+		} else {
+			_, err = tx.ExecContext(ctx, insertPromotedGlobalSQL, uuids.New(), g.Key, g.Name, g.Value, userID, orgID)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error saving global %s", g.Key)
+		}
+	}
+
+	for _, c := range pkg.Campaigns {
+		groupID := target.groups[c.Group].ID
+
+		var campaignID int64
+		if existing := target.campaigns[c.Name]; existing != nil {
+			campaignID = existing.ID
+			_, err := tx.ExecContext(ctx, updatePromotedCampaignSQL, campaignID, c.Name, groupID, userID)
+			if err != nil {
+				return errors.Wrapf(err, "error updating campaign %s", existing.UUID)
+			}
+		} else {
+			campaignUUID := uuids.New()
+			err := tx.GetContext(ctx, &campaignID, insertPromotedCampaignSQL, campaignUUID, c.Name, userID, groupID, orgID)
+			if err != nil {
+				return errors.Wrapf(err, "error inserting campaign %s", campaignUUID)
+			}
+		}
+
+		promotedEvents := make(map[int64]bool, len(c.Events))
+		for _, e := range c.Events {
+			fieldID := target.fields[e.RelativeTo].ID
+			flowUUID, _ := plan.resolveFlow(target, e.Flow)
+
+			var eventID int64
+			if existing := target.events[campaignEventKey(campaignID, eventMatchKey(e.RelativeTo, e.Offset, e.Unit, flowUUID))]; existing != nil {
+				eventID = existing.ID
+				_, err := tx.ExecContext(ctx, updatePromotedEventSQL, eventID, e.Offset, e.Unit, e.StartMode, e.DeliveryHour, flowIDs[flowUUID], fieldID, userID)
+				if err != nil {
+					return errors.Wrapf(err, "error updating campaign event %s", existing.UUID)
+				}
+			} else {
+				eventUUID := uuids.New()
+				err := tx.GetContext(ctx, &eventID, insertPromotedEventSQL, eventUUID, e.Offset, e.Unit, e.StartMode, e.DeliveryHour, campaignID, userID, flowIDs[flowUUID], fieldID)
+				if err != nil {
+					return errors.Wrapf(err, "error inserting campaign event %s", eventUUID)
+				}
+			}
+			promotedEvents[eventID] = true
+			result.ScheduleEventIDs = append(result.ScheduleEventIDs, CampaignEventID(eventID))
+		}
+
+		// the package has all the flow events of the campaign, so any others have been removed
+		for _, e := range target.events {
+			if e.ParentID != campaignID || promotedEvents[e.ID] {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, deactivatePromotedEventSQL, e.ID, userID); err != nil {
+				return errors.Wrapf(err, "error deactivating campaign event %s", e.UUID)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM campaigns_eventfire WHERE event_id = $1 AND fired IS NULL`, e.ID); err != nil {
+				return errors.Wrapf(err, "error deleting fires of campaign event %s", e.UUID)
+			}
+			result.Changes = append(result.Changes, &PromotionChange{Type: promotionTypeEvent, Key: e.UUID, Action: promotionDeactivated})
+		}
+	}
+
+	for _, t := range pkg.Triggers {
+		var triggerID int64
+		if existing := target.triggers[t.key()]; existing != nil {
+			triggerID = existing.ID
+			_, err := tx.ExecContext(ctx, updatePromotedTriggerSQL, triggerID, t.MatchType, flowID(t.Flow), userID)
+			if err != nil {
+				return errors.Wrapf(err, "error updating trigger %s", t.key())
+			}
+		} else {
+			var channelID *int64
+			if t.Channel != nil {
+				channelID = &target.channels[*t.Channel].ID
+			}
+			err := tx.GetContext(ctx, &triggerID, insertPromotedTriggerSQL, t.Keyword, t.ReferrerID, t.TriggerType, t.MatchType, channelID, userID, flowID(t.Flow), orgID)
+			if err != nil {
+				return errors.Wrapf(err, "error inserting trigger %s", t.key())
+			}
+		}
+
+		groupIDs := make([]int64, len(t.Groups))
+		for i, g := range t.Groups {
+			groupIDs[i] = target.groups[g].ID
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM triggers_trigger_groups WHERE trigger_id = $1`, triggerID); err != nil {
+			return errors.Wrapf(err, "error clearing groups of trigger %s", t.key())
+		}
+		if len(groupIDs) > 0 {
+			_, err := tx.ExecContext(ctx, `INSERT INTO triggers_trigger_groups(trigger_id, contactgroup_id) SELECT $1, UNNEST($2::int[])`, triggerID, pq.Array(groupIDs))
+			if err != nil {
+				return errors.Wrapf(err, "error setting groups of trigger %s", t.key())
+			}
+		}
+	}
+
+	return nil
+}
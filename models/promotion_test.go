@@ -0,0 +1,149 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromotion(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	pkg, err := ExportPromotion(ctx, db, Org1, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, Org1, pkg.SourceOrgID)
+
+	var favorites *PromotedFlow
+	for _, f := range pkg.Flows {
+		if f.UUID == FavoritesFlowUUID {
+			favorites = f
+		}
+	}
+	require.NotNil(t, favorites)
+	assert.Equal(t, "Favorites", favorites.Name)
+	assert.NotEmpty(t, favorites.Definition)
+
+	// nothing has changed since now
+	pkg, err = ExportPromotion(ctx, db, Org1, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(pkg.Flows))
+	assert.Equal(t, 0, len(pkg.Globals))
+
+	org2, err := NewOrgAssets(ctx, db, Org2, nil)
+	require.NoError(t, err)
+
+	pkg = &PromotionPackage{
+		SourceOrgID: Org1,
+		Since:       time.Now(),
+		Globals:     []*PromotedGlobal{{Key: "promoted", Name: "Promoted", Value: "yes"}},
+	}
+
+	// a dry run makes no changes
+	result, err := ApplyPromotion(ctx, db, org2, 1, pkg, true)
+	require.NoError(t, err)
+	assert.False(t, result.Applied)
+	assert.Equal(t, []*PromotionChange{{Type: "global", Key: "promoted", Action: "created"}}, result.Changes)
+	assert.Equal(t, 0, len(result.Conflicts))
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM globals_global WHERE org_id = $1 AND key = 'promoted'`, []interface{}{Org2}, 0)
+
+	result, err = ApplyPromotion(ctx, db, org2, 1, pkg, false)
+	require.NoError(t, err)
+	assert.True(t, result.Applied)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM globals_global WHERE org_id = $1 AND key = 'promoted' AND value = 'yes'`, []interface{}{Org2}, 1)
+
+	// the global has now changed since a package exported in the past, and the campaign's group doesn't exist
+	pkg = &PromotionPackage{
+		SourceOrgID: Org1,
+		Since:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Globals:     []*PromotedGlobal{{Key: "promoted", Name: "Promoted", Value: "no"}},
+		Campaigns:   []*PromotedCampaign{{UUID: "3b1b4a0c-9d3c-4b4f-8a1e-2c7e9f0b5d6a", Name: "Reminders", Group: "Nobody"}},
+	}
+
+	result, err = ApplyPromotion(ctx, db, org2, 1, pkg, false)
+	require.NoError(t, err)
+	assert.False(t, result.Applied)
+	assert.Equal(t, 2, len(result.Conflicts))
+	assert.Equal(t, "global", result.Conflicts[0].Type)
+	assert.Equal(t, "campaign", result.Conflicts[1].Type)
+	assert.Equal(t, "missing group 'Nobody'", result.Conflicts[1].Reason)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM globals_global WHERE org_id = $1 AND key = 'promoted' AND value = 'yes'`, []interface{}{Org2}, 1)
+}
+
+func TestPromotionBetweenOrgs(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	pkg, err := ExportPromotion(ctx, db, Org1, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	// promote the flows and campaign which only depend on things org 2 has, once it has the campaign's field
+	flows := make([]*PromotedFlow, 0)
+	for _, f := range pkg.Flows {
+		if f.Name == "Favorites" || f.Name == "Pick a Number" {
+			flows = append(flows, f)
+		}
+	}
+	require.Equal(t, 2, len(flows))
+	pkg.Flows = flows
+	pkg.Globals = nil
+	pkg.Triggers = nil
+
+	require.Equal(t, 1, len(pkg.Campaigns))
+	require.Equal(t, 1, len(pkg.Campaigns[0].Events))
+	db.MustExec(`INSERT INTO contacts_contactfield(is_active, created_on, modified_on, uuid, label, key, value_type, show_in_table, priority, field_type, created_by_id, modified_by_id, org_id)
+		VALUES(TRUE, NOW(), NOW(), $1, 'Joined', 'joined', 'D', FALSE, 0, 'U', 1, 1, $2)`, uuids.New(), Org2)
+
+	// org 2 hasn't changed anything since the last promotion
+	pkg.Since = time.Now()
+
+	org2, err := NewOrgAssets(ctx, db, Org2, nil)
+	require.NoError(t, err)
+
+	result, err := ApplyPromotion(ctx, db, org2, 1, pkg, false)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(result.Conflicts), "unexpected conflicts: %v", result.Conflicts)
+	assert.True(t, result.Applied)
+	assert.Equal(t, []*PromotionChange{
+		{Type: "flow", Key: string(FavoritesFlowUUID), Action: "updated"},
+		{Type: "flow", Key: string(PickNumberFlowUUID), Action: "created"},
+		{Type: "campaign", Key: string(DoctorRemindersCampaignUUID), Action: "created"},
+		{Type: "campaign_event", Key: string(pkg.Campaigns[0].Events[0].UUID), Action: "created"},
+	}, result.Changes)
+
+	// org 2's favorites flow has a new revision, and the new flow, campaign and event have new UUIDs
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowrevision WHERE flow_id = $1`, []interface{}{Org2FavoritesFlowID}, 2)
+
+	var pickNumberUUID assets.FlowUUID
+	err = db.Get(&pickNumberUUID, `SELECT uuid FROM flows_flow WHERE org_id = $1 AND name = 'Pick a Number'`, Org2)
+	require.NoError(t, err)
+	assert.NotEqual(t, PickNumberFlowUUID, pickNumberUUID)
+
+	var definition string
+	err = db.Get(&definition, `SELECT r.definition FROM flows_flowrevision r JOIN flows_flow f ON f.id = r.flow_id WHERE f.uuid = $1`, pickNumberUUID)
+	require.NoError(t, err)
+	assert.Contains(t, definition, string(pickNumberUUID))
+	assert.NotContains(t, definition, string(PickNumberFlowUUID))
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM campaigns_campaign WHERE org_id = $1 AND name = 'Doctor Reminders' AND uuid != $2`, []interface{}{Org2, DoctorRemindersCampaignUUID}, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM campaigns_campaignevent e JOIN campaigns_campaign c ON c.id = e.campaign_id WHERE c.org_id = $1 AND e.is_active = TRUE AND e.flow_id = $2 AND e.uuid != $3`,
+		[]interface{}{Org2, Org2FavoritesFlowID, pkg.Campaigns[0].Events[0].UUID}, 1)
+	assert.Equal(t, 1, len(result.ScheduleEventIDs))
+
+	// promoting again updates what was created
+	pkg.Since = time.Now()
+	org2, err = NewOrgAssets(ctx, db, Org2, nil)
+	require.NoError(t, err)
+
+	result, err = ApplyPromotion(ctx, db, org2, 1, pkg, false)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(result.Conflicts), "unexpected conflicts: %v", result.Conflicts)
+	for _, c := range result.Changes {
+		assert.Equal(t, "updated", c.Action, "expected %s %s to be updated", c.Type, c.Key)
+	}
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flow WHERE org_id = $1 AND name = 'Pick a Number'`, []interface{}{Org2}, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM campaigns_campaign WHERE org_id = $1 AND name = 'Doctor Reminders'`, []interface{}{Org2}, 1)
+}
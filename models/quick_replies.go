@@ -0,0 +1,146 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ChannelConfigMaxQuickReplyButtons is the channel config key for the most quick replies a channel can send as
+	// buttons, overriding the default for its type. Zero means the channel can't send them as buttons.
+	ChannelConfigMaxQuickReplyButtons = "max_quick_reply_buttons"
+
+	// ChannelConfigMaxQuickReplyList is the channel config key for the most quick replies a channel can send as an
+	// interactive list, overriding the default for its type. Zero means the channel can't send lists.
+	ChannelConfigMaxQuickReplyList = "max_quick_reply_list"
+
+	// InteractiveTypeList is the type of interactive message which shows quick replies as a list
+	InteractiveTypeList = "list"
+)
+
+// QuickReplySupport is how many quick replies a channel can send in each way
+type QuickReplySupport struct {
+	Buttons int
+	List    int
+}
+
+// channel types whose quick reply limits we know, channels of other types are sent quick replies as they are and
+// their courier handlers do what they can with them
+var channelQuickReplySupport = map[ChannelType]QuickReplySupport{
+	"D3":  {Buttons: 3, List: 10}, // 360dialog
+	"FB":  {Buttons: 13},          // Facebook
+	"FBA": {Buttons: 13},          // Facebook App
+	"LN":  {Buttons: 13},          // Line
+	"TG":  {Buttons: 100},         // Telegram
+	"TWT": {Buttons: 20},          // Twitter Activity
+	"VP":  {Buttons: 24},          // Viber
+	"WA":  {Buttons: 3, List: 10}, // WhatsApp
+}
+
+// QuickReplySupport returns how many quick replies this channel can send in each way, or nil if we don't know
+func (c *Channel) QuickReplySupport() *QuickReplySupport {
+	support, known := channelQuickReplySupport[c.Type()]
+
+	if max, err := strconv.Atoi(c.ConfigValue(ChannelConfigMaxQuickReplyButtons, "")); err == nil {
+		support.Buttons = max
+		known = true
+	}
+	if max, err := strconv.Atoi(c.ConfigValue(ChannelConfigMaxQuickReplyList, "")); err == nil {
+		support.List = max
+		known = true
+	}
+
+	if !known {
+		return nil
+	}
+	return &support
+}
+
+// MsgInteractive is an interactive message payload passed to courier in a message's metadata
+type MsgInteractive struct {
+	Type  string   `json:"type"`
+	Items []string `json:"items"`
+}
+
+// addQuickReplies adds the passed in quick replies to the metadata of a message being sent on the passed in channel,
+// as buttons if the channel can send that many, otherwise as a list, otherwise as a numbered menu appended to the
+// text, and returns the text to send. Menus are also recorded in the metadata so that numbered replies can be
+// matched to them.
+func addQuickReplies(channel *Channel, text string, quickReplies []string, metadata map[string]interface{}) string {
+	var support *QuickReplySupport
+	if channel != nil {
+		support = channel.QuickReplySupport()
+	}
+
+	if support == nil || len(quickReplies) <= support.Buttons {
+		metadata["quick_replies"] = quickReplies
+	} else if len(quickReplies) <= support.List {
+		metadata["interactive"] = &MsgInteractive{Type: InteractiveTypeList, Items: quickReplies}
+	} else {
+		text = text + "\n\n" + numberedMenu(quickReplies)
+		metadata["menu"] = quickReplies
+	}
+	return text
+}
+
+// numberedMenu formats the passed in options as a menu of numbered lines
+func numberedMenu(options []string) string {
+	lines := make([]string, len(options))
+	for i, o := range options {
+		lines[i] = fmt.Sprintf("%d. %s", i+1, o)
+	}
+	return strings.Join(lines, "\n")
+}
+
+const selectLastOutgoingMetadataSQL = `
+SELECT
+	metadata
+FROM
+	msgs_msg
+WHERE
+	contact_id = $1 AND
+	direction = 'O'
+ORDER BY
+	created_on DESC,
+	id DESC
+LIMIT 1
+`
+
+// MenuChoice returns the option chosen by the passed in text if it's a number from the numbered menu of the last
+// message sent to the passed in contact, or an empty string if it isn't
+func MenuChoice(ctx context.Context, db Queryer, contactID ContactID, text string) (string, error) {
+	choice, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(text), "."))
+	if err != nil || choice < 1 {
+		return "", nil
+	}
+
+	var metadataJSON sql.NullString
+	err = db.GetContext(ctx, &metadataJSON, selectLastOutgoingMetadataSQL, contactID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "error selecting last outgoing message for contact: %d", contactID)
+	}
+	if !metadataJSON.Valid {
+		return "", nil
+	}
+
+	metadata := &struct {
+		Menu []string `json:"menu"`
+	}{}
+	if err := json.Unmarshal([]byte(metadataJSON.String), metadata); err != nil {
+		return "", nil
+	}
+
+	if choice > len(metadata.Menu) {
+		return "", nil
+	}
+	return metadata.Menu[choice-1], nil
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuickReplies(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	newChannel := func(channelType ChannelType, config map[string]interface{}) *Channel {
+		c := &Channel{}
+		c.c.ChannelType = channelType
+		c.c.Config = config
+		return c
+	}
+
+	whatsapp := newChannel("WA", nil)
+	twilio := newChannel("T", nil)
+	noButtons := newChannel("T", map[string]interface{}{ChannelConfigMaxQuickReplyButtons: float64(0)})
+
+	assert.Equal(t, &QuickReplySupport{Buttons: 3, List: 10}, whatsapp.QuickReplySupport())
+	assert.Nil(t, twilio.QuickReplySupport())
+	assert.Equal(t, &QuickReplySupport{Buttons: 0, List: 0}, noButtons.QuickReplySupport())
+
+	urn := urns.URN(fmt.Sprintf("tel:+250700000001?id=%d", CathyURNID))
+	options := []string{"red", "green", "blue", "yellow"}
+
+	tcs := []struct {
+		channel          *Channel
+		quickReplies     []string
+		expectedText     string
+		expectedMetadata map[string]interface{}
+	}{
+		{whatsapp, options[:3], "Color?", map[string]interface{}{"quick_replies": options[:3]}},
+		{whatsapp, options, "Color?", map[string]interface{}{"interactive": &MsgInteractive{Type: InteractiveTypeList, Items: options}}},
+		{twilio, options, "Color?", map[string]interface{}{"quick_replies": options}},
+		{noButtons, options[:2], "Color?\n\n1. red\n2. green", map[string]interface{}{"menu": options[:2]}},
+	}
+
+	for i, tc := range tcs {
+		out := flows.NewMsgOut(urn, assets.NewChannelReference(TwilioChannelUUID, "Test Channel"), "Color?", nil, tc.quickReplies, nil, flows.NilMsgTopic)
+		msg, err := NewOutgoingMsg(Org1, tc.channel, CathyID, out, time.Now())
+		require.NoError(t, err)
+
+		assert.Equal(t, tc.expectedText, msg.Text(), "text mismatch in test case %d", i)
+		assert.Equal(t, tc.expectedMetadata, msg.Metadata(), "metadata mismatch in test case %d", i)
+	}
+
+	// no menu sent to cathy yet
+	choice, err := MenuChoice(ctx, db, CathyID, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "", choice)
+
+	db.MustExec(
+		`INSERT INTO msgs_msg(uuid, org_id, channel_id, contact_id, contact_urn_id, text, direction, status, created_on, visibility, msg_count, error_count, next_attempt, metadata)
+					   VALUES($1,   $2,     $3,         $4,         $5,             $6,   'O',       'W',    NOW(),      'V',        1,         0,           NOW(),        $7)`,
+		uuids.New(), Org1, TwilioChannelID, CathyID, CathyURNID, "Color?\n\n1. red\n2. green", `{"menu": ["red", "green"]}`)
+
+	for text, expected := range map[string]string{"1": "red", " 2. ": "green", "3": "", "0": "", "red": ""} {
+		choice, err := MenuChoice(ctx, db, CathyID, text)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, choice, "choice mismatch for '%s'", text)
+	}
+}
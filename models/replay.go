@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+const selectReplaySessionsSQL = `
+SELECT
+	id,
+	uuid,
+	session_type,
+	status,
+	responded,
+	output,
+	contact_id,
+	org_id,
+	created_on,
+	ended_on,
+	timeout_on,
+	wait_started_on,
+	current_flow_id,
+	connection_id
+FROM
+	flows_flowsession fs
+WHERE
+	output IS NOT NULL AND
+	created_on < $2 AND
+	(ended_on IS NULL OR ended_on >= $1) AND
+	id > $3
+ORDER BY
+	id
+LIMIT $4
+`
+
+// SelectReplaySessions returns the next batch of sessions after the passed in id which were active at some point in
+// the passed in window, and so may have events from that window
+func SelectReplaySessions(ctx context.Context, db *sqlx.DB, from time.Time, to time.Time, afterID SessionID, limit int) ([]*Session, error) {
+	rows, err := db.QueryxContext(ctx, selectReplaySessionsSQL, from, to, afterID, limit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting sessions to replay")
+	}
+	defer rows.Close()
+
+	sessions := make([]*Session, 0, limit)
+	for rows.Next() {
+		session := &Session{
+			preCommits:  make(map[EventCommitHook][]interface{}),
+			postCommits: make(map[EventCommitHook][]interface{}),
+		}
+		err = rows.StructScan(&session.s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error scanning session")
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// ReplaySessionEvents applies the events of the passed in types in the passed in session which were created in the
+// passed in window through their handlers again, e.g. to repair data after a bug in a handler has been fixed. Handlers
+// aren't idempotent so only event types whose effects were lost should be replayed. If dryRun is true then events are
+// only counted. Returns the number of events replayed.
+func ReplaySessionEvents(ctx context.Context, db *sqlx.DB, rp *redis.Pool, org *OrgAssets, session *Session, eventTypes map[string]bool, from time.Time, to time.Time, dryRun bool) (int, error) {
+	sa, err := GetSessionAssets(org)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error loading session assets")
+	}
+
+	fs, err := session.FlowSession(sa, org.Env())
+	if err != nil {
+		return 0, errors.Wrapf(err, "error reading session: %d", session.ID())
+	}
+	session.contact = fs.Contact()
+
+	replay := make([]flows.Event, 0)
+	for _, r := range fs.Runs() {
+		for _, e := range r.Events() {
+			if eventTypes[e.Type()] && !e.CreatedOn().Before(from) && e.CreatedOn().Before(to) {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	if dryRun || len(replay) == 0 {
+		return len(replay), nil
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error starting transaction")
+	}
+
+	for _, e := range replay {
+		err := ApplyEvent(ctx, tx, rp, org, session, e)
+		if err != nil {
+			tx.Rollback()
+			return 0, errors.Wrapf(err, "error replaying event: %s", e.Type())
+		}
+	}
+
+	err = ApplyPreEventHooks(ctx, tx, rp, org, []*Session{session})
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrapf(err, "error applying pre commit hooks")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrapf(err, "error committing replayed events")
+	}
+
+	// post commit hooks get their own transaction like when sessions are written
+	tx, err = db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error starting transaction for post commit hooks")
+	}
+
+	err = ApplyPostEventHooks(ctx, tx, rp, org, []*Session{session})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrapf(err, "error applying post commit hooks")
+	}
+
+	return len(replay), nil
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/excellent"
+	"github.com/nyaruka/goflow/excellent/types"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the org config key for the flows whose results are pushed to an HTTP endpoint when runs complete, keyed by flow
+// UUID, e.g.
+//
+//   "results_push": {
+//     "9de3663f-c5c5-4c92-9f45-ecbc09abcc85": {
+//       "url": "https://example.com/results",
+//       "template": "{\"contact\": \"@contact.uuid\", \"age\": \"@results.age.value\"}"
+//     }
+//   }
+//
+// Pushes can instead use a profile which builds the body from the run, see results_push_fhir.go.
+const configResultsPush = "results_push"
+
+// ResultsPushProfileFHIR is the profile for pushes which post FHIR QuestionnaireResponse resources
+const ResultsPushProfileFHIR = "fhir"
+
+// ResultsPush is an HTTP endpoint which the results of completed runs in a flow are pushed to. The template is
+// evaluated against the run and should produce a JSON document, values are escaped to be valid inside JSON strings.
+type ResultsPush struct {
+	URL      string
+	Template string
+
+	// for pushes with a profile
+	Profile       string
+	Token         string
+	Questionnaire string
+	Items         []*ResultsPushItem
+}
+
+// ResultsPushItem maps a flow result to an item in a profile's body
+type ResultsPushItem struct {
+	LinkID string
+	Result string
+}
+
+// ResultsPush returns the results push configured for the passed in flow, or nil if there isn't one
+func (o *Org) ResultsPush(flowUUID assets.FlowUUID) *ResultsPush {
+	pushes, _ := o.config[configResultsPush].(map[string]interface{})
+	push, _ := pushes[string(flowUUID)].(map[string]interface{})
+
+	url, _ := push["url"].(string)
+	template, _ := push["template"].(string)
+	profile, _ := push["profile"].(string)
+
+	if profile == ResultsPushProfileFHIR {
+		return readFHIRResultsPush(url, push)
+	}
+	if url == "" || template == "" || profile != "" {
+		return nil
+	}
+
+	return &ResultsPush{URL: url, Template: template}
+}
+
+// escapes evaluated values so they can be included in JSON strings
+func escapeJSON(s string) string {
+	escaped, _ := json.Marshal(s)
+	return string(escaped[1 : len(escaped)-1])
+}
+
+// Render evaluates our template against the passed in run, or builds the body for our profile
+func (p *ResultsPush) Render(env envs.Environment, run flows.FlowRun) (string, error) {
+	if p.Profile == ResultsPushProfileFHIR {
+		return p.renderFHIR(run)
+	}
+	return excellent.EvaluateTemplate(env, runResultsContext(env, run), p.Template, escapeJSON)
+}
+
+// Headers returns the headers to be sent with the push of the passed in run, besides our defaults
+func (p *ResultsPush) Headers(run flows.FlowRun) map[string]string {
+	if p.Profile == ResultsPushProfileFHIR {
+		return p.fhirHeaders(run)
+	}
+	return nil
+}
+
+// builds the context which templates for the results of a run are evaluated against
+func runResultsContext(env envs.Environment, run flows.FlowRun) *types.XObject {
+	values := map[string]types.XValue{
+		"results": flows.Context(env, run.Results()),
+		"run":     flows.Context(env, run),
+	}
+	if run.Contact() != nil {
+		values["contact"] = flows.Context(env, run.Contact())
+		values["fields"] = flows.Context(env, run.Contact().Fields())
+	}
+	return types.NewXObject(values)
+}
+
+// whether the passed in run has completed since it was last written
+func (s *Session) runCompleted(fr flows.FlowRun) bool {
+	since := s.seenRuns[fr.UUID()]
+	return fr.Status() == flows.RunStatusCompleted && fr.ExitedOn() != nil && fr.ExitedOn().After(since)
+}
+
+// ResultsPushTask is the task queued to push the results of a completed run
+//
+//   {
+//     "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85",
+//     "run_uuid": "4f0a8a3f-2b6e-4a1f-9d7b-2a3c8e5f1d90",
+//     "url": "https://example.com/results",
+//     "body": "{\"contact\": \"6393abc0-283d-4c9b-a1b3-641a035c34bf\", \"age\": \"23\"}",
+//     "headers": {"Authorization": "Bearer sesame"}
+//   }
+//
+type ResultsPushTask struct {
+	FlowUUID assets.FlowUUID   `json:"flow_uuid"`
+	RunUUID  flows.RunUUID     `json:"run_uuid"`
+	URL      string            `json:"url"`
+	Body     string            `json:"body"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// trackResultsPush renders the results push for the passed in run if it has completed since it was last written and
+// its flow has one configured
+func (s *Session) trackResultsPush(org *OrgAssets, fr flows.FlowRun) {
+	push := org.Org().ResultsPush(fr.FlowReference().UUID)
+	if push == nil {
+		return
+	}
+
+	if !s.runCompleted(fr) {
+		return
+	}
+
+	body, err := push.Render(org.Env(), fr)
+	if err != nil {
+		// a bad template shouldn't stop the session being written
+		logrus.WithError(err).WithField("org_id", org.OrgID()).WithField("flow_uuid", fr.FlowReference().UUID).Error("error rendering results push")
+		return
+	}
+
+	s.AddPostCommitEvent(resultsPushHook, &ResultsPushTask{FlowUUID: fr.FlowReference().UUID, RunUUID: fr.UUID(), URL: push.URL, Body: body, Headers: push.Headers(fr)})
+}
+
+// ResultsPushHook is our hook for queuing results pushes once sessions are committed
+type ResultsPushHook struct{}
+
+var resultsPushHook = &ResultsPushHook{}
+
+// Apply queues a task for each results push
+func (h *ResultsPushHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, sessions map[*Session][]interface{}) error {
+	rc := rp.Get()
+	defer rc.Close()
+
+	for _, pushes := range sessions {
+		for _, p := range pushes {
+			err := queue.AddTask(rc, queue.BatchQueue, queue.PushFlowResults, int(org.OrgID()), p.(*ResultsPushTask), queue.DefaultPriority)
+			if err != nil {
+				return errors.Wrapf(err, "error queuing results push")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/shopspring/decimal"
+)
+
+// the FHIR profile pushes each completed run as a QuestionnaireResponse resource to a FHIR server, with an item for
+// each of the mapped results the run has, e.g.
+//
+//   "9de3663f-c5c5-4c92-9f45-ecbc09abcc85": {
+//     "profile": "fhir",
+//     "url": "https://fhir.example.com/fhir",
+//     "token": "sesame",
+//     "questionnaire": "https://example.com/Questionnaire/intake",
+//     "items": [
+//       {"link_id": "1.1", "result": "age"},
+//       {"link_id": "1.2", "result": "symptoms"}
+//     ]
+//   }
+//
+// The run and contact are identified by their UUIDs, and resources are created conditionally on the run's identifier
+// so that retried pushes don't create duplicates.
+
+const fhirUUIDSystem = "urn:ietf:rfc:3986"
+
+// reads the FHIR results push configured with the passed in URL and config
+func readFHIRResultsPush(url string, push map[string]interface{}) *ResultsPush {
+	token, _ := push["token"].(string)
+	questionnaire, _ := push["questionnaire"].(string)
+	rawItems, _ := push["items"].([]interface{})
+
+	items := make([]*ResultsPushItem, 0, len(rawItems))
+	for _, i := range rawItems {
+		item, _ := i.(map[string]interface{})
+		linkID, _ := item["link_id"].(string)
+		result, _ := item["result"].(string)
+		if linkID != "" && result != "" {
+			items = append(items, &ResultsPushItem{LinkID: linkID, Result: result})
+		}
+	}
+
+	if url == "" || questionnaire == "" || len(items) == 0 {
+		return nil
+	}
+
+	return &ResultsPush{
+		URL:           strings.TrimSuffix(url, "/") + "/QuestionnaireResponse",
+		Profile:       ResultsPushProfileFHIR,
+		Token:         token,
+		Questionnaire: questionnaire,
+		Items:         items,
+	}
+}
+
+type fhirIdentifier struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+type fhirAnswer struct {
+	ValueString  string          `json:"valueString,omitempty"`
+	ValueDecimal json.RawMessage `json:"valueDecimal,omitempty"`
+}
+
+type fhirItem struct {
+	LinkID string        `json:"linkId"`
+	Text   string        `json:"text,omitempty"`
+	Answer []*fhirAnswer `json:"answer"`
+}
+
+type fhirQuestionnaireResponse struct {
+	ResourceType  string         `json:"resourceType"`
+	Identifier    fhirIdentifier `json:"identifier"`
+	Questionnaire string         `json:"questionnaire"`
+	Status        string         `json:"status"`
+	Subject       *struct {
+		Identifier fhirIdentifier `json:"identifier"`
+	} `json:"subject,omitempty"`
+	Authored string      `json:"authored,omitempty"`
+	Item     []*fhirItem `json:"item"`
+}
+
+// builds the QuestionnaireResponse for the passed in run
+func (p *ResultsPush) renderFHIR(run flows.FlowRun) (string, error) {
+	response := &fhirQuestionnaireResponse{
+		ResourceType:  "QuestionnaireResponse",
+		Identifier:    fhirIdentifier{System: fhirUUIDSystem, Value: fmt.Sprintf("urn:uuid:%s", run.UUID())},
+		Questionnaire: p.Questionnaire,
+		Status:        "completed",
+		Item:          make([]*fhirItem, 0, len(p.Items)),
+	}
+
+	if run.Contact() != nil {
+		response.Subject = &struct {
+			Identifier fhirIdentifier `json:"identifier"`
+		}{Identifier: fhirIdentifier{System: fhirUUIDSystem, Value: fmt.Sprintf("urn:uuid:%s", run.Contact().UUID())}}
+	}
+	if run.ExitedOn() != nil {
+		response.Authored = run.ExitedOn().UTC().Format(time.RFC3339)
+	}
+
+	results := run.Results()
+	for _, i := range p.Items {
+		result := results[i.Result]
+		if result == nil || result.Value == "" {
+			continue
+		}
+
+		// numeric values are sent as decimals and everything else as strings
+		answer := &fhirAnswer{}
+		if number, err := decimal.NewFromString(result.Value); err == nil {
+			answer.ValueDecimal = json.RawMessage(number.String())
+		} else {
+			answer.ValueString = result.Value
+		}
+
+		response.Item = append(response.Item, &fhirItem{LinkID: i.LinkID, Text: result.Name, Answer: []*fhirAnswer{answer}})
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// returns the headers for pushing the passed in run to a FHIR server
+func (p *ResultsPush) fhirHeaders(run flows.FlowRun) map[string]string {
+	headers := map[string]string{
+		"Content-Type":  "application/fhir+json",
+		"If-None-Exist": fmt.Sprintf("identifier=%s|urn:uuid:%s", fhirUUIDSystem, run.UUID()),
+	}
+	if p.Token != "" {
+		headers["Authorization"] = "Bearer " + p.Token
+	}
+	return headers
+}
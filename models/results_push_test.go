@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultsPush(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"results_push": {
+		"9de3663f-c5c5-4c92-9f45-ecbc09abcc85": {"url": "https://example.com/results", "template": "{\"age\": \"@results.age.value\"}"},
+		"5890fe3a-f204-4661-b74d-025be4ee019c": {"url": "https://example.com/results"}
+	}}' WHERE id = $1`, Org1)
+
+	org, err := loadOrg(ctx, db, Org1)
+	require.NoError(t, err)
+
+	push := org.ResultsPush(assets.FlowUUID("9de3663f-c5c5-4c92-9f45-ecbc09abcc85"))
+	require.NotNil(t, push)
+	assert.Equal(t, "https://example.com/results", push.URL)
+	assert.Equal(t, `{"age": "@results.age.value"}`, push.Template)
+
+	// pushes without a template or for other flows aren't configured
+	assert.Nil(t, org.ResultsPush(assets.FlowUUID("5890fe3a-f204-4661-b74d-025be4ee019c")))
+	assert.Nil(t, org.ResultsPush(assets.FlowUUID("3e3e4a55-ae6b-4b8d-a6d4-0a3e3c6b4d2e")))
+
+	// pushes can use the FHIR profile instead of a template
+	db.MustExec(`UPDATE orgs_org SET config = '{"results_push": {
+		"9de3663f-c5c5-4c92-9f45-ecbc09abcc85": {
+			"profile": "fhir", "url": "https://fhir.example.com/fhir/", "token": "sesame",
+			"questionnaire": "https://example.com/Questionnaire/intake",
+			"items": [{"link_id": "1.1", "result": "age"}, {"link_id": "1.2"}, {"link_id": "1.3", "result": "color"}]
+		},
+		"5890fe3a-f204-4661-b74d-025be4ee019c": {"profile": "fhir", "url": "https://fhir.example.com/fhir", "items": [{"link_id": "1.1", "result": "age"}]},
+		"a7c11d68-f008-496f-b56d-2d5cf4cf16a5": {"profile": "pigeon", "url": "https://example.com/results", "template": "{}"}
+	}}' WHERE id = $1`, Org1)
+
+	org, err = loadOrg(ctx, db, Org1)
+	require.NoError(t, err)
+
+	push = org.ResultsPush(FavoritesFlowUUID)
+	require.NotNil(t, push)
+	assert.Equal(t, &ResultsPush{
+		URL:           "https://fhir.example.com/fhir/QuestionnaireResponse",
+		Profile:       ResultsPushProfileFHIR,
+		Token:         "sesame",
+		Questionnaire: "https://example.com/Questionnaire/intake",
+		Items:         []*ResultsPushItem{{LinkID: "1.1", Result: "age"}, {LinkID: "1.3", Result: "color"}},
+	}, push)
+
+	// FHIR pushes need a questionnaire, and unknown profiles aren't configured
+	assert.Nil(t, org.ResultsPush(PickNumberFlowUUID))
+	assert.Nil(t, org.ResultsPush(SingleMessageFlowUUID))
+
+	// evaluated values are escaped to be valid inside JSON strings
+	assert.Equal(t, `say \"hi\"\n`, escapeJSON("say \"hi\"\n"))
+}
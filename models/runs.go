@@ -292,6 +292,8 @@ type Step struct {
 // NewSession a session objects from the passed in flow session. It does NOT
 // commit said session to the database.
 func NewSession(ctx context.Context, tx *sqlx.Tx, org *OrgAssets, fs flows.Session, sprint flows.Sprint) (*Session, error) {
+	redactWebhookEvents(org, fs, sprint)
+
 	output, err := json.Marshal(fs)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error marshalling flow session")
@@ -474,6 +476,8 @@ func (s *Session) WriteUpdatedSession(ctx context.Context, tx *sqlx.Tx, rp *redi
 		return errors.Errorf("missing seen runs, cannot update session")
 	}
 
+	redactWebhookEvents(org, fs, sprint)
+
 	output, err := json.Marshal(fs)
 	if err != nil {
 		return errors.Wrapf(err, "error marshalling flow session")
@@ -662,6 +666,7 @@ func WriteSessions(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAss
 			return nil, errors.Wrapf(err, "error creating session objects")
 		}
 		sessions = append(sessions, session)
+		session.AddUsage(UsageSessionsRun, 1)
 
 		if session.Status() == SessionStatusCompleted {
 			completeSessionsI = append(completeSessionsI, &session.s)
@@ -834,6 +839,18 @@ func newRun(ctx context.Context, tx *sqlx.Tx, org *OrgAssets, session *Session,
 	}
 	r.Results = string(resultsJSON)
 
+	// track any experiment arms this run has been assigned to or completed
+	session.trackSplits(org, flowID, fr, path)
+
+	// and push its results if it has completed in a flow which has that configured
+	session.trackResultsPush(org, fr)
+
+	// and queue them for export to a sheet if its flow has one configured
+	session.trackSheetsExport(org, fr)
+
+	// and recalculate the engagement score of its contact if they've responded or it has ended
+	session.trackEngagement(org, fr)
+
 	// set our parent UUID if we have a parent
 	if fr.Parent() != nil {
 		uuid := fr.Parent().UUID()
@@ -897,6 +914,27 @@ func RunExpiration(ctx context.Context, db *sqlx.DB, runID FlowRunID) (*time.Tim
 	return &expiration, nil
 }
 
+// WaitingRun is a run which is waiting, and so can be resumed by a callback
+type WaitingRun struct {
+	ID        FlowRunID `db:"id"`
+	OrgID     OrgID     `db:"org_id"`
+	ContactID ContactID `db:"contact_id"`
+	SessionID SessionID `db:"session_id"`
+}
+
+// LoadWaitingRun loads the run with the passed in UUID if it is waiting, returning nil if not
+func LoadWaitingRun(ctx context.Context, db Queryer, runUUID flows.RunUUID) (*WaitingRun, error) {
+	run := &WaitingRun{}
+	err := db.GetContext(ctx, run, `SELECT id, org_id, contact_id, session_id FROM flows_flowrun WHERE uuid = $1 AND status = 'W' AND is_active = TRUE`, runUUID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to select waiting run: %s", runUUID)
+	}
+	return run, nil
+}
+
 // ExitSessions marks the passed in sessions as completed, also doing so for all associated runs
 func ExitSessions(ctx context.Context, tx Queryer, sessionIDs []SessionID, exitType ExitType, now time.Time) error {
 	if len(sessionIDs) == 0 {
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 )
@@ -85,6 +87,15 @@ func (s *Schedule) UpdateFires(ctx context.Context, tx Queryer, last time.Time,
 	return nil
 }
 
+// UpdateNextFire updates only the next fire for a schedule on the db, used when a fire is skipped
+func (s *Schedule) UpdateNextFire(ctx context.Context, tx Queryer, next *time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE schedules_schedule SET next_fire = $2 WHERE id = $1`, s.s.ID, next)
+	if err != nil {
+		return errors.Wrapf(err, "error updating schedule next fire for: %d", s.s.ID)
+	}
+	return nil
+}
+
 // GetNextFire returns the next fire for this schedule (if any)
 func (s *Schedule) GetNextFire(tz *time.Location, now time.Time) (*time.Time, error) {
 	// Never repeats? no next fire
@@ -197,6 +208,8 @@ SELECT ROW_TO_JSON(s) FROM (SELECT
 			(SELECT JSON_OBJECT_AGG(ts.key, ts.value) FROM (SELECT key, JSON_BUILD_OBJECT('text', t.value) as value FROM each(b.text) t) ts) as translations,
 			'unevaluated' as template_state,
 			b.base_language as base_language,
+			b.channel_id as channel_id,
+			b.variables as variables,
 			s.org_id as org_id,
 			(SELECT ARRAY_AGG(bc.contact_id) FROM (
 				SELECT
@@ -292,6 +305,80 @@ func GetUnfiredSchedules(ctx context.Context, db *sqlx.DB) ([]*Schedule, error)
 	return unfired, nil
 }
 
+const insertOneOffScheduleSQL = `
+INSERT INTO
+	schedules_schedule(is_active, repeat_period, created_on, modified_on, next_fire, created_by_id, modified_by_id, org_id)
+	VALUES(TRUE, 'O', NOW(), NOW(), $1, $2, $2, $3)
+RETURNING id
+`
+
+const insertScheduleTriggerSQL = `
+INSERT INTO
+	triggers_trigger(is_active, created_on, modified_on, is_archived, trigger_type, created_by_id, modified_by_id, org_id, flow_id, schedule_id)
+	VALUES(TRUE, NOW(), NOW(), FALSE, 'S', $1, $1, $2, $3, $4)
+RETURNING id
+`
+
+// contacts and groups are only added to the trigger if they belong to its org
+const insertScheduleTriggerContactsSQL = `
+INSERT INTO
+	triggers_trigger_contacts(trigger_id, contact_id)
+	SELECT $1, c.id FROM contacts_contact c WHERE c.org_id = $2 AND c.id = ANY($3) AND c.is_active = TRUE
+`
+
+const insertScheduleTriggerGroupsSQL = `
+INSERT INTO
+	triggers_trigger_groups(trigger_id, contactgroup_id)
+	SELECT $1, g.id FROM contacts_contactgroup g WHERE g.org_id = $2 AND g.id = ANY($3) AND g.is_active = TRUE
+`
+
+// InsertScheduledFlowStart creates a one-off schedule which fires at the passed in time, with a trigger that starts
+// the passed in contacts and groups in the passed in flow. The schedules cron creates the flow start when it fires.
+// Contacts and groups which don't belong to the passed in org are ignored.
+func InsertScheduledFlowStart(ctx context.Context, db *sqlx.DB, orgID OrgID, userID int64, flowID FlowID, fireOn time.Time, contactIDs []ContactID, groupIDs []GroupID) (ScheduleID, TriggerID, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return NilScheduleID, NilTriggerID, errors.Wrapf(err, "error starting transaction")
+	}
+
+	var scheduleID ScheduleID
+	err = tx.GetContext(ctx, &scheduleID, insertOneOffScheduleSQL, fireOn, userID, orgID)
+	if err != nil {
+		tx.Rollback()
+		return NilScheduleID, NilTriggerID, errors.Wrapf(err, "error inserting schedule")
+	}
+
+	var triggerID TriggerID
+	err = tx.GetContext(ctx, &triggerID, insertScheduleTriggerSQL, userID, orgID, flowID, scheduleID)
+	if err != nil {
+		tx.Rollback()
+		return NilScheduleID, NilTriggerID, errors.Wrapf(err, "error inserting schedule trigger")
+	}
+
+	if len(contactIDs) > 0 {
+		_, err = tx.ExecContext(ctx, insertScheduleTriggerContactsSQL, triggerID, orgID, pq.Array(contactIDs))
+		if err != nil {
+			tx.Rollback()
+			return NilScheduleID, NilTriggerID, errors.Wrapf(err, "error inserting schedule trigger contacts")
+		}
+	}
+
+	if len(groupIDs) > 0 {
+		_, err = tx.ExecContext(ctx, insertScheduleTriggerGroupsSQL, triggerID, orgID, pq.Array(groupIDs))
+		if err != nil {
+			tx.Rollback()
+			return NilScheduleID, NilTriggerID, errors.Wrapf(err, "error inserting schedule trigger groups")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return NilScheduleID, NilTriggerID, errors.Wrapf(err, "error committing scheduled flow start")
+	}
+
+	return scheduleID, triggerID, nil
+}
+
 // MarshalJSON marshals into JSON. 0 values will become null
 func (i ScheduleID) MarshalJSON() ([]byte, error) {
 	return null.Int(i).MarshalJSON()
@@ -311,3 +398,56 @@ func (i ScheduleID) Value() (driver.Value, error) {
 func (i *ScheduleID) Scan(value interface{}) error {
 	return null.ScanInt(value, (*null.Int)(i))
 }
+
+const (
+	schedulesPausedOrgsKey = "schedules_paused_orgs"
+	schedulesPausedKey     = "schedules_paused:%d"
+)
+
+var isSchedulePaused = redis.NewScript(2,
+	`-- KEYS: [OrgsKey, SchedulesKey], ARGV: [OrgID, ScheduleID]
+	 if redis.call("sismember", KEYS[1], ARGV[1]) == 1 then
+	   return 1
+	 end
+	 return redis.call("sismember", KEYS[2], ARGV[2])
+`)
+
+// IsSchedulePaused returns whether the passed in schedule is paused, either because all the schedules of its org
+// are paused or because it has been paused individually
+func IsSchedulePaused(rc redis.Conn, orgID OrgID, scheduleID ScheduleID) (bool, error) {
+	paused, err := redis.Bool(isSchedulePaused.Do(rc, schedulesPausedOrgsKey, fmt.Sprintf(schedulesPausedKey, orgID), orgID, scheduleID))
+	if err != nil {
+		return false, errors.Wrapf(err, "error checking whether schedule %d is paused", scheduleID)
+	}
+	return paused, nil
+}
+
+// SetSchedulesPaused pauses or resumes the passed in schedules for the passed in org, or all of the org's schedules
+// if none are passed in. Resuming all of an org's schedules also resumes any paused individually.
+func SetSchedulesPaused(rc redis.Conn, orgID OrgID, scheduleIDs []ScheduleID, paused bool) error {
+	var err error
+	schedulesKey := fmt.Sprintf(schedulesPausedKey, orgID)
+
+	if len(scheduleIDs) == 0 {
+		if paused {
+			_, err = rc.Do("sadd", schedulesPausedOrgsKey, orgID)
+		} else {
+			rc.Send("multi")
+			rc.Send("srem", schedulesPausedOrgsKey, orgID)
+			rc.Send("del", schedulesKey)
+			_, err = rc.Do("exec")
+		}
+	} else {
+		args := redis.Args{schedulesKey}.AddFlat(scheduleIDs)
+		if paused {
+			_, err = rc.Do("sadd", args...)
+		} else {
+			_, err = rc.Do("srem", args...)
+		}
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "error setting schedules paused for org: %d", orgID)
+	}
+	return nil
+}
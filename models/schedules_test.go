@@ -27,8 +27,8 @@ func TestGetExpired(t *testing.T) {
 	var b1 BroadcastID
 	err = db.Get(
 		&b1,
-		`INSERT INTO msgs_broadcast(status, text, base_language, is_active, created_on, modified_on, send_all, created_by_id, modified_by_id, org_id, schedule_id)
-			VALUES('P', hstore(ARRAY['eng','Test message', 'fra', 'Un Message']), 'eng', TRUE, NOW(), NOW(), TRUE, 1, 1, $1, $2) RETURNING id`,
+		`INSERT INTO msgs_broadcast(status, text, base_language, variables, is_active, created_on, modified_on, send_all, created_by_id, modified_by_id, org_id, schedule_id)
+			VALUES('P', hstore(ARRAY['eng','Test message', 'fra', 'Un Message']), 'eng', '{"day": "Monday"}', TRUE, NOW(), NOW(), TRUE, 1, 1, $1, $2) RETURNING id`,
 		Org1, s1,
 	)
 	assert.NoError(t, err)
@@ -107,6 +107,7 @@ func TestGetExpired(t *testing.T) {
 	assert.Equal(t, []ContactID{CathyID, GeorgeID}, bcast.ContactIDs())
 	assert.Equal(t, []GroupID{DoctorsGroupID}, bcast.GroupIDs())
 	assert.Equal(t, []urns.URN{urns.URN("tel:+250700000001?id=10000")}, bcast.URNs())
+	assert.Equal(t, map[string]string{"day": "Monday"}, bcast.Variables())
 }
 
 func TestNextFire(t *testing.T) {
@@ -395,3 +396,74 @@ tests:
 		}
 	}
 }
+
+func TestSchedulesPaused(t *testing.T) {
+	_, _, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	assertPaused := func(orgID OrgID, scheduleID ScheduleID, expected bool) {
+		paused, err := IsSchedulePaused(rc, orgID, scheduleID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, paused, "paused mismatch for org %d schedule %d", orgID, scheduleID)
+	}
+
+	assertPaused(Org1, ScheduleID(1), false)
+
+	// pause individual schedules
+	assert.NoError(t, SetSchedulesPaused(rc, Org1, []ScheduleID{1, 2}, true))
+	assertPaused(Org1, ScheduleID(1), true)
+	assertPaused(Org1, ScheduleID(2), true)
+	assertPaused(Org1, ScheduleID(3), false)
+	assertPaused(Org2, ScheduleID(1), false)
+
+	assert.NoError(t, SetSchedulesPaused(rc, Org1, []ScheduleID{2}, false))
+	assertPaused(Org1, ScheduleID(1), true)
+	assertPaused(Org1, ScheduleID(2), false)
+
+	// pause the whole org
+	assert.NoError(t, SetSchedulesPaused(rc, Org2, nil, true))
+	assertPaused(Org2, ScheduleID(4), true)
+	assertPaused(Org1, ScheduleID(4), false)
+
+	// resuming the whole org resumes individual schedules too
+	assert.NoError(t, SetSchedulesPaused(rc, Org1, nil, false))
+	assertPaused(Org1, ScheduleID(1), false)
+}
+
+func TestInsertScheduledFlowStart(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	// contacts in other orgs are ignored
+	fireOn := time.Now().Add(time.Hour)
+	scheduleID, triggerID, err := InsertScheduledFlowStart(ctx, db, Org1, 1, FavoritesFlowID, fireOn, []ContactID{CathyID, Org2FredID, GeorgeID}, []GroupID{DoctorsGroupID})
+	assert.NoError(t, err)
+	assert.NotEqual(t, NilScheduleID, scheduleID)
+	assert.NotEqual(t, NilTriggerID, triggerID)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM schedules_schedule WHERE id = $1 AND repeat_period = 'O' AND next_fire > NOW()`, []interface{}{scheduleID}, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM triggers_trigger WHERE id = $1 AND schedule_id = $2 AND trigger_type = 'S'`, []interface{}{triggerID, scheduleID}, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM triggers_trigger_contacts WHERE trigger_id = $1`, []interface{}{triggerID}, 2)
+
+	// not fired until its time comes
+	schedules, err := GetUnfiredSchedules(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(schedules))
+
+	db.MustExec(`UPDATE schedules_schedule SET next_fire = NOW() - INTERVAL '1 MINUTE' WHERE id = $1`, scheduleID)
+
+	schedules, err = GetUnfiredSchedules(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(schedules))
+
+	start := schedules[0].FlowStart()
+	assert.NotNil(t, start)
+	assert.Equal(t, FavoritesFlowID, start.FlowID())
+	assert.ElementsMatch(t, []ContactID{CathyID, GeorgeID}, start.ContactIDs())
+	assert.Equal(t, []GroupID{DoctorsGroupID}, start.GroupIDs())
+
+	// one-off schedules have no next fire
+	nextFire, err := schedules[0].GetNextFire(time.UTC, time.Now())
+	assert.NoError(t, err)
+	assert.Nil(t, nextFire)
+}
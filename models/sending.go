@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pausedOrgsKey   = "sending_paused_orgs"
+	pausedGlobalKey = "sending_paused_global"
+)
+
+var isSendingPaused = redis.NewScript(2,
+	`-- KEYS: [GlobalKey, OrgsKey], ARGV: [OrgID]
+	 if redis.call("exists", KEYS[1]) == 1 then
+	   return 1
+	 end
+	 return redis.call("sismember", KEYS[2], ARGV[1])
+`)
+
+// IsSendingPaused returns whether automated sending is currently paused for the passed in org, either because
+// it has been paused for that org specifically or because it has been paused globally
+func IsSendingPaused(rc redis.Conn, orgID OrgID) (bool, error) {
+	if config.Mailroom.SendingPaused {
+		return true, nil
+	}
+
+	paused, err := redis.Bool(isSendingPaused.Do(rc, pausedGlobalKey, pausedOrgsKey, orgID))
+	if err != nil {
+		return false, errors.Wrapf(err, "error checking whether sending is paused for org: %d", orgID)
+	}
+	return paused, nil
+}
+
+// FailMessagesIfSendingPaused marks the passed in messages as failed instead of sending them if sending is paused for the
+// passed in org, returning whether it is
+func FailMessagesIfSendingPaused(ctx context.Context, db Queryer, rc redis.Conn, orgID OrgID, msgs []*Msg) (bool, error) {
+	paused, err := IsSendingPaused(rc, orgID)
+	if err != nil || !paused {
+		return false, err
+	}
+
+	logrus.WithField("org_id", orgID).WithField("count", len(msgs)).Info("sending paused, not sending messages")
+
+	if err := MarkMessagesFailed(ctx, db, msgs); err != nil {
+		return true, errors.Wrapf(err, "error marking messages as failed")
+	}
+	return true, nil
+}
+
+// SetSendingPaused pauses or unpauses automated sending for the passed in org, or globally if no org is passed in
+func SetSendingPaused(rc redis.Conn, orgID OrgID, paused bool) error {
+	var err error
+	if orgID == NilOrgID {
+		if paused {
+			_, err = rc.Do("set", pausedGlobalKey, "1")
+		} else {
+			_, err = rc.Do("del", pausedGlobalKey)
+		}
+	} else {
+		if paused {
+			_, err = rc.Do("sadd", pausedOrgsKey, orgID)
+		} else {
+			_, err = rc.Do("srem", pausedOrgsKey, orgID)
+		}
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "error setting sending paused for org: %d", orgID)
+	}
+	return nil
+}
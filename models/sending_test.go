@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendingPaused(t *testing.T) {
+	testsuite.Reset()
+	rc := testsuite.RC()
+	defer rc.Close()
+
+	assertPaused := func(orgID OrgID, expected bool) {
+		paused, err := IsSendingPaused(rc, orgID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, paused, "paused mismatch for org %d", orgID)
+	}
+
+	assertPaused(Org1, false)
+	assertPaused(Org2, false)
+
+	// pause just org 1
+	assert.NoError(t, SetSendingPaused(rc, Org1, true))
+	assertPaused(Org1, true)
+	assertPaused(Org2, false)
+
+	// pause globally
+	assert.NoError(t, SetSendingPaused(rc, NilOrgID, true))
+	assertPaused(Org1, true)
+	assertPaused(Org2, true)
+
+	// unpause globally, org 1 is still paused
+	assert.NoError(t, SetSendingPaused(rc, NilOrgID, false))
+	assertPaused(Org1, true)
+	assertPaused(Org2, false)
+
+	// only messages of paused orgs are failed
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	paused, err := FailMessagesIfSendingPaused(ctx, db, rc, Org1, nil)
+	assert.NoError(t, err)
+	assert.True(t, paused)
+
+	paused, err = FailMessagesIfSendingPaused(ctx, db, rc, Org2, nil)
+	assert.NoError(t, err)
+	assert.False(t, paused)
+
+	assert.NoError(t, SetSendingPaused(rc, Org1, false))
+	assertPaused(Org1, false)
+}
@@ -0,0 +1,277 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/pkg/errors"
+)
+
+// SessionDebug is a redacted view of a session for support staff, which includes the state of the session and a
+// timeline of its events but leaves out message text, URNs, result values and webhook payloads
+type SessionDebug struct {
+	UUID          flows.SessionUUID    `json:"uuid"`
+	Status        SessionStatus        `json:"status"`
+	ContactID     ContactID            `json:"contact_id"`
+	CreatedOn     time.Time            `json:"created_on"`
+	EndedOn       *time.Time           `json:"ended_on"`
+	WaitStartedOn *time.Time           `json:"wait_started_on"`
+	TimeoutOn     *time.Time           `json:"timeout_on"`
+	Wait          json.RawMessage      `json:"wait"`
+	Runs          []*SessionDebugRun   `json:"runs"`
+	Timeline      []*SessionDebugEvent `json:"timeline"`
+}
+
+// SessionDebugRun is a run in a session debug view
+type SessionDebugRun struct {
+	UUID      flows.RunUUID   `json:"uuid"`
+	Flow      json.RawMessage `json:"flow"`
+	Status    string          `json:"status"`
+	CreatedOn time.Time       `json:"created_on"`
+	ExitedOn  *time.Time      `json:"exited_on"`
+}
+
+// SessionDebugEvent is an event in a session debug timeline, with only those fields which are safe to show
+type SessionDebugEvent struct {
+	Type      string                 `json:"type"`
+	CreatedOn time.Time              `json:"created_on"`
+	RunUUID   flows.RunUUID          `json:"run_uuid"`
+	StepUUID  string                 `json:"step_uuid,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// the fields of each event type which we include in a timeline, anything else is redacted
+var debugEventFields = map[string][]string{
+	events.TypeAirtimeTransferred:     {"currency", "desired_amount", "actual_amount"},
+	events.TypeClassifierCalled:       {"classifier", "http_logs"},
+	events.TypeContactFieldChanged:    {"field"},
+	events.TypeContactGroupsChanged:   {"groups_added", "groups_removed"},
+	events.TypeContactLanguageChanged: {"language"},
+	events.TypeError:                  {"text"},
+	events.TypeFlowEntered:            {"flow", "parent_run_uuid", "terminal"},
+	events.TypeMsgWait:                {"timeout_seconds", "timeout"},
+	events.TypeResthookCalled:         {"resthook"},
+	events.TypeRunExpired:             {"run_uuid"},
+	events.TypeRunResultChanged:       {"name", "category"},
+	events.TypeSessionTriggered:       {"flow"},
+	events.TypeWebhookCalled:          {"url", "status", "status_code", "elapsed_ms", "resthook"},
+}
+
+// the fields of an HTTP log which we include in a timeline
+var debugHTTPLogFields = []string{"url", "status", "created_on", "elapsed_ms"}
+
+// the fields of a message which we include in a timeline
+var debugMsgFields = []string{"uuid", "channel"}
+
+// the subset of a session's JSON output we need to build a debug view
+type sessionDebugOutput struct {
+	Wait json.RawMessage `json:"wait"`
+	Runs []struct {
+		UUID      flows.RunUUID            `json:"uuid"`
+		Flow      json.RawMessage          `json:"flow"`
+		Status    string                   `json:"status"`
+		CreatedOn time.Time                `json:"created_on"`
+		ExitedOn  *time.Time               `json:"exited_on"`
+		Events    []map[string]interface{} `json:"events"`
+	} `json:"runs"`
+}
+
+const selectSessionDebugSQL = `
+SELECT
+	uuid,
+	status,
+	contact_id,
+	created_on,
+	ended_on,
+	wait_started_on,
+	timeout_on,
+	output
+FROM
+	flows_flowsession fs
+WHERE
+	fs.org_id = $1 AND
+	fs.uuid = $2
+`
+
+const selectRunSessionUUIDSQL = `
+SELECT
+	fs.uuid
+FROM
+	flows_flowrun fr
+	JOIN flows_flowsession fs ON fr.session_id = fs.id
+WHERE
+	fr.org_id = $1 AND
+	fr.uuid = $2
+`
+
+// LoadSessionDebug loads a debug view of the session with the passed in UUID, or the session of the run with the
+// passed in UUID if no session UUID is given. Returns nil if no such session exists in the org.
+func LoadSessionDebug(ctx context.Context, db *sqlx.DB, orgID OrgID, sessionUUID flows.SessionUUID, runUUID flows.RunUUID) (*SessionDebug, error) {
+	if sessionUUID == "" {
+		err := db.GetContext(ctx, &sessionUUID, selectRunSessionUUIDSQL, orgID, runUUID)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error looking up session for run: %s", runUUID)
+		}
+	}
+
+	row := struct {
+		UUID          flows.SessionUUID `db:"uuid"`
+		Status        SessionStatus     `db:"status"`
+		ContactID     ContactID         `db:"contact_id"`
+		CreatedOn     time.Time         `db:"created_on"`
+		EndedOn       *time.Time        `db:"ended_on"`
+		WaitStartedOn *time.Time        `db:"wait_started_on"`
+		TimeoutOn     *time.Time        `db:"timeout_on"`
+		Output        sql.NullString    `db:"output"`
+	}{}
+
+	err := db.GetContext(ctx, &row, selectSessionDebugSQL, orgID, sessionUUID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading session: %s", sessionUUID)
+	}
+
+	debug, err := NewSessionDebug([]byte(row.Output.String))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading output of session: %s", sessionUUID)
+	}
+
+	debug.UUID = row.UUID
+	debug.Status = row.Status
+	debug.ContactID = row.ContactID
+	debug.CreatedOn = row.CreatedOn
+	debug.EndedOn = row.EndedOn
+	debug.WaitStartedOn = row.WaitStartedOn
+	debug.TimeoutOn = row.TimeoutOn
+	return debug, nil
+}
+
+// NewSessionDebug builds the runs, wait and redacted timeline of a session debug view from the passed in session output
+func NewSessionDebug(output []byte) (*SessionDebug, error) {
+	debug := &SessionDebug{
+		Runs:     make([]*SessionDebugRun, 0),
+		Timeline: make([]*SessionDebugEvent, 0),
+	}
+
+	// sessions which errored before being written may not have any output
+	if len(output) == 0 {
+		return debug, nil
+	}
+
+	session := &sessionDebugOutput{}
+	if err := json.Unmarshal(output, session); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling session output")
+	}
+
+	debug.Wait = session.Wait
+
+	for _, r := range session.Runs {
+		debug.Runs = append(debug.Runs, &SessionDebugRun{
+			UUID:      r.UUID,
+			Flow:      r.Flow,
+			Status:    r.Status,
+			CreatedOn: r.CreatedOn,
+			ExitedOn:  r.ExitedOn,
+		})
+
+		for _, e := range r.Events {
+			debug.Timeline = append(debug.Timeline, newSessionDebugEvent(r.UUID, e))
+		}
+	}
+
+	sort.SliceStable(debug.Timeline, func(i, j int) bool {
+		return debug.Timeline[i].CreatedOn.Before(debug.Timeline[j].CreatedOn)
+	})
+
+	return debug, nil
+}
+
+// creates a timeline event from the passed in raw event, keeping only the fields we know are safe to show
+func newSessionDebugEvent(runUUID flows.RunUUID, raw map[string]interface{}) *SessionDebugEvent {
+	e := &SessionDebugEvent{RunUUID: runUUID}
+	e.Type, _ = raw["type"].(string)
+	e.StepUUID, _ = raw["step_uuid"].(string)
+
+	createdOn, _ := raw["created_on"].(string)
+	e.CreatedOn, _ = time.Parse(time.RFC3339Nano, createdOn)
+
+	details := make(map[string]interface{})
+	for _, field := range debugEventFields[e.Type] {
+		value, found := raw[field]
+		if !found {
+			continue
+		}
+
+		switch field {
+		case "url":
+			value = redactURL(value)
+		case "http_logs":
+			value = redactHTTPLogs(value)
+		}
+		details[field] = value
+	}
+
+	// for message events we only include which message and channel, never the text or URN
+	if msg, isMap := raw["msg"].(map[string]interface{}); isMap {
+		details["msg"] = pickFields(msg, debugMsgFields)
+	}
+
+	if len(details) > 0 {
+		e.Details = details
+	}
+	return e
+}
+
+// strips any credentials and query string from the passed in URL as these can contain secrets
+func redactURL(value interface{}) interface{} {
+	s, _ := value.(string)
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// reduces the passed in HTTP logs to their URLs, statuses and timings
+func redactHTTPLogs(value interface{}) interface{} {
+	logs, _ := value.([]interface{})
+	redacted := make([]interface{}, 0, len(logs))
+	for _, l := range logs {
+		log, isMap := l.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		log = pickFields(log, debugHTTPLogFields)
+		if u, found := log["url"]; found {
+			log["url"] = redactURL(u)
+		}
+		redacted = append(redacted, log)
+	}
+	return redacted
+}
+
+// returns a copy of the passed in map with only the passed in fields
+func pickFields(m map[string]interface{}, fields []string) map[string]interface{} {
+	picked := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v, found := m[f]; found {
+			picked[f] = v
+		}
+	}
+	return picked
+}
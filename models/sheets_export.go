@@ -0,0 +1,245 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/excellent"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the org config key for exporting the results of completed runs to Google Sheets. The OAuth credentials are those
+// of the org's Google account, and each exported flow has the sheet its rows are appended to and a template for each
+// column, e.g.
+//
+//   "sheets_export": {
+//     "client_id": "1234.apps.googleusercontent.com",
+//     "client_secret": "sesame",
+//     "refresh_token": "1//0gabc",
+//     "flows": {
+//       "9de3663f-c5c5-4c92-9f45-ecbc09abcc85": {
+//         "spreadsheet_id": "1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+//         "sheet": "Favorites",
+//         "columns": ["@contact.uuid", "@contact.name", "@results.color.value"]
+//       }
+//     }
+//   }
+//
+const configSheetsExport = "sheets_export"
+
+const (
+	sheetsExportPendingKey = "sheets_export_pending"
+	sheetsExportRowsKey    = "sheets_export_rows:%d:%s"
+)
+
+// SheetsCredentials are the OAuth credentials an org's exports are made with
+type SheetsCredentials struct {
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+}
+
+// SheetsExport is a Google Sheet which the results of completed runs in a flow are appended to, one row per run
+type SheetsExport struct {
+	SpreadsheetID string
+	Sheet         string
+	Columns       []string
+}
+
+// SheetsCredentials returns the credentials configured for exporting to Google Sheets, or nil if there aren't any
+func (o *Org) SheetsCredentials() *SheetsCredentials {
+	export, _ := o.config[configSheetsExport].(map[string]interface{})
+
+	clientID, _ := export["client_id"].(string)
+	clientSecret, _ := export["client_secret"].(string)
+	refreshToken, _ := export["refresh_token"].(string)
+	if clientID == "" || clientSecret == "" || refreshToken == "" {
+		return nil
+	}
+
+	return &SheetsCredentials{ClientID: clientID, ClientSecret: clientSecret, RefreshToken: refreshToken}
+}
+
+// SheetsExport returns the sheets export configured for the passed in flow, or nil if there isn't one
+func (o *Org) SheetsExport(flowUUID assets.FlowUUID) *SheetsExport {
+	if o.SheetsCredentials() == nil {
+		return nil
+	}
+
+	export, _ := o.config[configSheetsExport].(map[string]interface{})
+	exported, _ := export["flows"].(map[string]interface{})
+	flow, _ := exported[string(flowUUID)].(map[string]interface{})
+
+	spreadsheetID, _ := flow["spreadsheet_id"].(string)
+	sheet, _ := flow["sheet"].(string)
+	rawColumns, _ := flow["columns"].([]interface{})
+
+	columns := make([]string, 0, len(rawColumns))
+	for _, c := range rawColumns {
+		if column, isStr := c.(string); isStr {
+			columns = append(columns, column)
+		}
+	}
+	if spreadsheetID == "" || len(columns) == 0 {
+		return nil
+	}
+
+	return &SheetsExport{SpreadsheetID: spreadsheetID, Sheet: sheet, Columns: columns}
+}
+
+// Render evaluates our column templates against the passed in run to give its row
+func (e *SheetsExport) Render(env envs.Environment, run flows.FlowRun) ([]string, error) {
+	runContext := runResultsContext(env, run)
+
+	row := make([]string, len(e.Columns))
+	for i, column := range e.Columns {
+		value, err := excellent.EvaluateTemplate(env, runContext, column, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error evaluating column %d", i)
+		}
+		row[i] = value
+	}
+	return row, nil
+}
+
+// Range returns the range in A1 notation which rows are appended after, which is the whole of our sheet, or of the
+// first sheet if we don't name one
+func (e *SheetsExport) Range() string {
+	if e.Sheet == "" {
+		return "A:A"
+	}
+	return fmt.Sprintf("'%s'!A:A", strings.Replace(e.Sheet, "'", "''", -1))
+}
+
+// SheetsExportRow is a row waiting to be appended to the sheet of its flow
+type SheetsExportRow struct {
+	OrgID    OrgID           `json:"org_id"`
+	FlowUUID assets.FlowUUID `json:"flow_uuid"`
+	RunUUID  flows.RunUUID   `json:"run_uuid"`
+	Values   []string        `json:"values"`
+}
+
+// trackSheetsExport renders the row for the passed in run if it has completed since it was last written and its flow
+// has a sheets export configured
+func (s *Session) trackSheetsExport(org *OrgAssets, fr flows.FlowRun) {
+	export := org.Org().SheetsExport(fr.FlowReference().UUID)
+	if export == nil || !s.runCompleted(fr) {
+		return
+	}
+
+	values, err := export.Render(org.Env(), fr)
+	if err != nil {
+		// a bad template shouldn't stop the session being written
+		logrus.WithError(err).WithField("org_id", org.OrgID()).WithField("flow_uuid", fr.FlowReference().UUID).Error("error rendering sheets export row")
+		return
+	}
+
+	s.AddPostCommitEvent(sheetsExportHook, &SheetsExportRow{OrgID: org.OrgID(), FlowUUID: fr.FlowReference().UUID, RunUUID: fr.UUID(), Values: values})
+}
+
+// SheetsExportHook is our hook for queuing rows for export once sessions are committed
+type SheetsExportHook struct{}
+
+var sheetsExportHook = &SheetsExportHook{}
+
+// Apply queues each row to be appended to its sheet
+func (h *SheetsExportHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, sessions map[*Session][]interface{}) error {
+	rc := rp.Get()
+	defer rc.Close()
+
+	for _, rows := range sessions {
+		for _, r := range rows {
+			err := QueueSheetsExportRow(rc, r.(*SheetsExportRow))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// QueueSheetsExportRow queues the passed in row to be appended to the sheet of its flow
+func QueueSheetsExportRow(rc redis.Conn, row *SheetsExportRow) error {
+	rowJSON, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	rc.Send("multi")
+	rc.Send("rpush", fmt.Sprintf(sheetsExportRowsKey, row.OrgID, row.FlowUUID), rowJSON)
+	rc.Send("sadd", sheetsExportPendingKey, fmt.Sprintf("%d:%s", row.OrgID, row.FlowUUID))
+	_, err = rc.Do("exec")
+	return errors.Wrapf(err, "error queuing sheets export row")
+}
+
+// PendingSheetsExports returns the org and flow of each export which has rows waiting to be appended
+func PendingSheetsExports(rc redis.Conn) (map[OrgID][]assets.FlowUUID, error) {
+	members, err := redis.Strings(rc.Do("smembers", sheetsExportPendingKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading pending sheets exports")
+	}
+
+	pending := make(map[OrgID][]assets.FlowUUID)
+	for _, m := range members {
+		parts := strings.SplitN(m, ":", 2)
+		orgID, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			continue
+		}
+		pending[OrgID(orgID)] = append(pending[OrgID(orgID)], assets.FlowUUID(parts[1]))
+	}
+	return pending, nil
+}
+
+// ReadSheetsExportRows returns up to the passed in limit of the oldest rows waiting to be appended for the passed in
+// flow. They remain queued until they are removed with TrimSheetsExportRows.
+func ReadSheetsExportRows(rc redis.Conn, orgID OrgID, flowUUID assets.FlowUUID, limit int) ([]*SheetsExportRow, error) {
+	values, err := redis.Strings(rc.Do("lrange", fmt.Sprintf(sheetsExportRowsKey, orgID, flowUUID), 0, limit-1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading sheets export rows")
+	}
+
+	rows := make([]*SheetsExportRow, len(values))
+	for i, v := range values {
+		rows[i] = &SheetsExportRow{}
+		if err := json.Unmarshal([]byte(v), rows[i]); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling sheets export row")
+		}
+	}
+	return rows, nil
+}
+
+// TrimSheetsExportRows removes the passed in number of the oldest rows waiting to be appended for the passed in flow,
+// and if that leaves none, the flow's export from the pending exports
+func TrimSheetsExportRows(rc redis.Conn, orgID OrgID, flowUUID assets.FlowUUID, count int) error {
+	key := fmt.Sprintf(sheetsExportRowsKey, orgID, flowUUID)
+
+	remaining, err := redis.Int(trimSheetsExportRowsScript.Do(rc, key, sheetsExportPendingKey, count, fmt.Sprintf("%d:%s", orgID, flowUUID)))
+	if err != nil {
+		return errors.Wrapf(err, "error trimming sheets export rows")
+	}
+
+	logrus.WithField("org_id", orgID).WithField("flow_uuid", flowUUID).WithField("remaining", remaining).Debug("trimmed sheets export rows")
+	return nil
+}
+
+// trims the rows and removes the export from the pending set if it's empty, atomically so that rows queued in the
+// meantime aren't orphaned
+var trimSheetsExportRowsScript = redis.NewScript(2, `
+redis.call("ltrim", KEYS[1], ARGV[1], -1)
+local remaining = redis.call("llen", KEYS[1])
+if remaining == 0 then
+	redis.call("srem", KEYS[2], ARGV[2])
+end
+return remaining
+`)
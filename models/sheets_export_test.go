@@ -0,0 +1,74 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSheetsExport(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"sheets_export": {
+		"client_id": "1234", "client_secret": "sesame", "refresh_token": "abcd",
+		"flows": {
+			"9de3663f-c5c5-4c92-9f45-ecbc09abcc85": {"spreadsheet_id": "sheet1", "sheet": "Bob''s Results", "columns": ["@contact.name", "@results.color.value"]},
+			"5890fe3a-f204-4661-b74d-025be4ee019c": {"spreadsheet_id": "sheet2"}
+		}
+	}}' WHERE id = $1`, Org1)
+
+	org, err := loadOrg(ctx, db, Org1)
+	require.NoError(t, err)
+
+	assert.Equal(t, &SheetsCredentials{ClientID: "1234", ClientSecret: "sesame", RefreshToken: "abcd"}, org.SheetsCredentials())
+
+	export := org.SheetsExport(FavoritesFlowUUID)
+	require.NotNil(t, export)
+	assert.Equal(t, "sheet1", export.SpreadsheetID)
+	assert.Equal(t, []string{"@contact.name", "@results.color.value"}, export.Columns)
+	assert.Equal(t, `'Bob''s Results'!A:A`, export.Range())
+
+	// exports without columns or for other flows aren't configured
+	assert.Nil(t, org.SheetsExport(PickNumberFlowUUID))
+	assert.Nil(t, org.SheetsExport(assets.FlowUUID("3e3e4a55-ae6b-4b8d-a6d4-0a3e3c6b4d2e")))
+
+	// exports without a sheet are appended to the first sheet
+	assert.Equal(t, "A:A", (&SheetsExport{}).Range())
+
+	// queue some rows
+	for _, values := range [][]string{{"Cathy", "red"}, {"Bob", "blue"}, {"George", "green"}} {
+		err = QueueSheetsExportRow(rc, &SheetsExportRow{OrgID: Org1, FlowUUID: FavoritesFlowUUID, RunUUID: "4f0a8a3f-2b6e-4a1f-9d7b-2a3c8e5f1d90", Values: values})
+		require.NoError(t, err)
+	}
+
+	pending, err := PendingSheetsExports(rc)
+	require.NoError(t, err)
+	assert.Equal(t, map[OrgID][]assets.FlowUUID{Org1: {FavoritesFlowUUID}}, pending)
+
+	// rows are read oldest first
+	rows, err := ReadSheetsExportRows(rc, Org1, FavoritesFlowUUID, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(rows))
+	assert.Equal(t, []string{"Cathy", "red"}, rows[0].Values)
+	assert.Equal(t, []string{"Bob", "blue"}, rows[1].Values)
+
+	// and stay queued until trimmed
+	require.NoError(t, TrimSheetsExportRows(rc, Org1, FavoritesFlowUUID, 2))
+
+	rows, err = ReadSheetsExportRows(rc, Org1, FavoritesFlowUUID, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(rows))
+	assert.Equal(t, []string{"George", "green"}, rows[0].Values)
+
+	// once there are no rows left, the export is no longer pending
+	require.NoError(t, TrimSheetsExportRows(rc, Org1, FavoritesFlowUUID, 1))
+
+	pending, err = PendingSheetsExports(rc)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(pending))
+}
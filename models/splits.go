@@ -0,0 +1,261 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+const (
+	splitAssigned  = "assigned"
+	splitCompleted = "completed"
+)
+
+// RandomSplit is a node in a flow which randomly assigns contacts to one of its categories, usually as part of an experiment
+type RandomSplit struct {
+	NodeUUID   flows.NodeUUID `json:"node_uuid"`
+	ResultName string         `json:"result_name,omitempty"`
+	Categories []*SplitArm    `json:"categories"`
+
+	byExit map[flows.ExitUUID]*SplitArm
+}
+
+// SplitArm is a single category of a random split
+type SplitArm struct {
+	UUID     flows.CategoryUUID `json:"uuid"`
+	Name     string             `json:"name"`
+	ExitUUID flows.ExitUUID     `json:"exit_uuid"`
+}
+
+// readRandomSplits reads all the random split nodes from the passed in flow definition
+func readRandomSplits(definition json.RawMessage) map[flows.NodeUUID]*RandomSplit {
+	def := &struct {
+		Nodes []struct {
+			UUID   flows.NodeUUID `json:"uuid"`
+			Router *struct {
+				Type       string      `json:"type"`
+				ResultName string      `json:"result_name"`
+				Categories []*SplitArm `json:"categories"`
+			} `json:"router"`
+		} `json:"nodes"`
+	}{}
+
+	splits := make(map[flows.NodeUUID]*RandomSplit)
+
+	// legacy or invalid definitions just have no splits
+	if err := json.Unmarshal(definition, def); err != nil {
+		return splits
+	}
+
+	for _, n := range def.Nodes {
+		if n.Router == nil || n.Router.Type != "random" {
+			continue
+		}
+
+		split := &RandomSplit{
+			NodeUUID:   n.UUID,
+			ResultName: n.Router.ResultName,
+			Categories: n.Router.Categories,
+			byExit:     make(map[flows.ExitUUID]*SplitArm, len(n.Router.Categories)),
+		}
+		for _, c := range n.Router.Categories {
+			split.byExit[c.ExitUUID] = c
+		}
+		splits[n.UUID] = split
+	}
+
+	return splits
+}
+
+// SplitStat is a single increment of a split stat counter
+type SplitStat struct {
+	FlowID       FlowID
+	NodeUUID     flows.NodeUUID
+	CategoryUUID flows.CategoryUUID
+	Counter      string
+}
+
+// trackSplits records assignments to, and completions of, any random splits in the passed in run path
+// which have happened since the run was last written
+func (s *Session) trackSplits(org *OrgAssets, flowID FlowID, fr flows.FlowRun, path []Step) {
+	flow, err := org.FlowByID(flowID)
+	if err != nil || flow == nil {
+		return
+	}
+
+	splits := flow.RandomSplits()
+	if len(splits) == 0 {
+		return
+	}
+
+	since := s.seenRuns[fr.UUID()]
+	completed := fr.Status() == flows.RunStatusCompleted && fr.ExitedOn() != nil && fr.ExitedOn().After(since)
+	counted := make(map[flows.NodeUUID]bool)
+
+	for _, step := range path {
+		split := splits[step.NodeUUID]
+		if split == nil || step.ExitUUID == "" {
+			continue
+		}
+		arm := split.byExit[step.ExitUUID]
+		if arm == nil {
+			continue
+		}
+
+		if step.ArrivedOn.After(since) {
+			s.AddPostCommitEvent(splitStatsHook, &SplitStat{flowID, split.NodeUUID, arm.UUID, splitAssigned})
+		}
+
+		// a completion is attributed once to the last arm the run took at each split
+		if completed && !counted[split.NodeUUID] {
+			counted[split.NodeUUID] = true
+			s.AddPostCommitEvent(splitStatsHook, &SplitStat{flowID, split.NodeUUID, arm.UUID, splitCompleted})
+		}
+	}
+}
+
+// SplitStatsHook is our hook for incrementing random split stats once sessions are committed
+type SplitStatsHook struct{}
+
+var splitStatsHook = &SplitStatsHook{}
+
+// a single row of the counts of a random split arm
+type splitCount struct {
+	FlowID       FlowID             `db:"flow_id"`
+	NodeUUID     flows.NodeUUID     `db:"node_uuid"`
+	CategoryUUID flows.CategoryUUID `db:"category_uuid"`
+	Counter      string             `db:"counter"`
+	Count        int                `db:"count"`
+}
+
+const insertSplitCountsSQL = `
+INSERT INTO
+	flows_flowsplitcount( flow_id,  node_uuid,  category_uuid,  counter,  count, is_squashed)
+	              VALUES(:flow_id, :node_uuid, :category_uuid, :counter, :count, FALSE)
+`
+
+// Apply increments all the split stat counters for the passed in sessions. Increments are written as new rows which are
+// periodically squashed by SquashSplitCounts so that concurrent writers don't contend.
+func (h *SplitStatsHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, sessions map[*Session][]interface{}) error {
+	totals := make(map[SplitStat]int)
+	for _, stats := range sessions {
+		for _, s := range stats {
+			totals[*s.(*SplitStat)]++
+		}
+	}
+
+	counts := make([]interface{}, 0, len(totals))
+	for stat, count := range totals {
+		counts = append(counts, &splitCount{FlowID: stat.FlowID, NodeUUID: stat.NodeUUID, CategoryUUID: stat.CategoryUUID, Counter: stat.Counter, Count: count})
+	}
+
+	return BulkSQL(ctx, "inserting split counts", tx, insertSplitCountsSQL, counts)
+}
+
+const squashSplitCountsSQL = `
+WITH deleted AS (
+	DELETE FROM
+		flows_flowsplitcount
+	WHERE
+		(flow_id, node_uuid, category_uuid, counter) IN (SELECT DISTINCT flow_id, node_uuid, category_uuid, counter FROM flows_flowsplitcount WHERE is_squashed = FALSE)
+	RETURNING
+		flow_id, node_uuid, category_uuid, counter, count
+)
+INSERT INTO
+	flows_flowsplitcount(flow_id, node_uuid, category_uuid, counter, count, is_squashed)
+SELECT
+	flow_id, node_uuid, category_uuid, counter, SUM(count), TRUE
+FROM
+	deleted
+GROUP BY
+	flow_id, node_uuid, category_uuid, counter
+`
+
+// SquashSplitCounts replaces the rows of every split counter which has been incremented since the last squash with a
+// single squashed row, returning the number of counters squashed
+func SquashSplitCounts(ctx context.Context, db *sqlx.DB) (int, error) {
+	res, err := db.ExecContext(ctx, squashSplitCountsSQL)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error squashing split counts")
+	}
+	count, _ := res.RowsAffected()
+	return int(count), nil
+}
+
+// SplitArmStats are the stats for a single arm of a random split
+type SplitArmStats struct {
+	SplitArm
+	Assigned       int     `json:"assigned"`
+	Completed      int     `json:"completed"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// SplitStats are the stats for a single random split in a flow
+type SplitStats struct {
+	NodeUUID   flows.NodeUUID   `json:"node_uuid"`
+	ResultName string           `json:"result_name,omitempty"`
+	Arms       []*SplitArmStats `json:"arms"`
+}
+
+const selectSplitCountsSQL = `
+SELECT
+	node_uuid,
+	category_uuid,
+	counter,
+	SUM(count) AS count
+FROM
+	flows_flowsplitcount
+WHERE
+	flow_id = $1
+GROUP BY
+	node_uuid, category_uuid, counter
+`
+
+// GetSplitStats returns the stats for all the random splits in the passed in flow
+func GetSplitStats(ctx context.Context, db Queryer, flow *Flow) ([]*SplitStats, error) {
+	rows, err := db.QueryxContext(ctx, selectSplitCountsSQL, flow.ID())
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading split stats for flow: %d", flow.ID())
+	}
+	defer rows.Close()
+
+	counts := make(map[SplitStat]int)
+	for rows.Next() {
+		stat := SplitStat{FlowID: flow.ID()}
+		var count int
+		if err := rows.Scan(&stat.NodeUUID, &stat.CategoryUUID, &stat.Counter, &count); err != nil {
+			return nil, errors.Wrapf(err, "error scanning split stats for flow: %d", flow.ID())
+		}
+		counts[stat] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "error reading split stats for flow: %d", flow.ID())
+	}
+
+	splits := flow.RandomSplits()
+	stats := make([]*SplitStats, 0, len(splits))
+	for _, split := range splits {
+		stat := &SplitStats{NodeUUID: split.NodeUUID, ResultName: split.ResultName, Arms: make([]*SplitArmStats, 0, len(split.Categories))}
+		for _, c := range split.Categories {
+			arm := &SplitArmStats{
+				SplitArm:  *c,
+				Assigned:  counts[SplitStat{flow.ID(), split.NodeUUID, c.UUID, splitAssigned}],
+				Completed: counts[SplitStat{flow.ID(), split.NodeUUID, c.UUID, splitCompleted}],
+			}
+			if arm.Assigned > 0 {
+				arm.ConversionRate = float64(arm.Completed) / float64(arm.Assigned)
+			}
+			stat.Arms = append(stat.Arms, arm)
+		}
+		stats = append(stats, stat)
+	}
+
+	// order consistently by node
+	sort.Slice(stats, func(i, j int) bool { return stats[i].NodeUUID < stats[j].NodeUUID })
+	return stats, nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const splitsTestDefinition = `{
+		"uuid": "a7c11d68-f008-496f-b56d-2d5cf4cf16a5",
+		"nodes": [
+			{
+				"uuid": "5c2e5c0d-b0a6-4a0a-86b3-3e3a1a2f2e32",
+				"router": {
+					"type": "random",
+					"result_name": "Arm",
+					"categories": [
+						{"uuid": "1b3b4a44-3a3b-4c59-95f5-9fa2c8b2c6b1", "name": "A", "exit_uuid": "e2b8d4a3-cf3b-4c38-9e07-cd6b5b47b1b0"},
+						{"uuid": "0d4e3c1b-9f7b-4b7e-a1ac-3f8b6c5f3e12", "name": "B", "exit_uuid": "c7b0a6d2-4a8f-4f0a-bb8e-2b5c1d4e6f78"}
+					]
+				}
+			},
+			{
+				"uuid": "8f1c5b1e-3a9c-4b0b-8c39-3d2a0f1c4b55",
+				"router": {"type": "switch", "categories": []}
+			},
+			{
+				"uuid": "d7a5c1b3-8b5d-4e7b-9b4d-1f2a6c3d5e98"
+			}
+		]
+	}`
+
+func TestReadRandomSplits(t *testing.T) {
+	splits := readRandomSplits([]byte(splitsTestDefinition))
+	assert.Equal(t, 1, len(splits))
+
+	split := splits[flows.NodeUUID("5c2e5c0d-b0a6-4a0a-86b3-3e3a1a2f2e32")]
+	assert.NotNil(t, split)
+	assert.Equal(t, "Arm", split.ResultName)
+	assert.Equal(t, 2, len(split.Categories))
+	assert.Equal(t, "B", split.byExit[flows.ExitUUID("c7b0a6d2-4a8f-4f0a-bb8e-2b5c1d4e6f78")].Name)
+
+	// legacy definitions have no splits
+	assert.Equal(t, 0, len(readRandomSplits([]byte(`{"action_sets": [], "rule_sets": []}`))))
+}
+
+func TestSplitStats(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+
+	org, err := GetOrgAssets(ctx, db, Org1)
+	require.NoError(t, err)
+
+	flow := &Flow{}
+	flow.f.ID = FavoritesFlowID
+	flow.f.Definition = []byte(splitsTestDefinition)
+
+	nodeUUID := flows.NodeUUID("5c2e5c0d-b0a6-4a0a-86b3-3e3a1a2f2e32")
+	armA := flows.CategoryUUID("1b3b4a44-3a3b-4c59-95f5-9fa2c8b2c6b1")
+	armB := flows.CategoryUUID("0d4e3c1b-9f7b-4b7e-a1ac-3f8b6c5f3e12")
+
+	applyStats := func(stats ...*SplitStat) {
+		events := make([]interface{}, len(stats))
+		for i := range stats {
+			events[i] = stats[i]
+		}
+
+		tx := db.MustBegin()
+		err := splitStatsHook.Apply(ctx, tx, rp, org, map[*Session][]interface{}{{}: events})
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+	}
+
+	applyStats(
+		&SplitStat{FavoritesFlowID, nodeUUID, armA, splitAssigned},
+		&SplitStat{FavoritesFlowID, nodeUUID, armA, splitAssigned},
+		&SplitStat{FavoritesFlowID, nodeUUID, armB, splitAssigned},
+		&SplitStat{FavoritesFlowID, nodeUUID, armA, splitCompleted},
+	)
+	applyStats(
+		&SplitStat{FavoritesFlowID, nodeUUID, armB, splitAssigned},
+		&SplitStat{FavoritesFlowID, nodeUUID, armA, splitAssigned},
+		&SplitStat{PickNumberFlowID, nodeUUID, armA, splitAssigned},
+	)
+
+	// counts for the same counter in each hook call are written as a single row
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsplitcount WHERE is_squashed = FALSE`, nil, 6)
+
+	assertStats := func() {
+		stats, err := GetSplitStats(ctx, db, flow)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(stats))
+		assert.Equal(t, nodeUUID, stats[0].NodeUUID)
+		assert.Equal(t, 2, len(stats[0].Arms))
+
+		assert.Equal(t, "A", stats[0].Arms[0].Name)
+		assert.Equal(t, 3, stats[0].Arms[0].Assigned)
+		assert.Equal(t, 1, stats[0].Arms[0].Completed)
+		assert.InDelta(t, 0.333, stats[0].Arms[0].ConversionRate, 0.001)
+
+		assert.Equal(t, "B", stats[0].Arms[1].Name)
+		assert.Equal(t, 2, stats[0].Arms[1].Assigned)
+		assert.Equal(t, 0, stats[0].Arms[1].Completed)
+		assert.Equal(t, 0.0, stats[0].Arms[1].ConversionRate)
+	}
+
+	assertStats()
+
+	// squashing leaves one row per counter but doesn't change the stats
+	squashed, err := SquashSplitCounts(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, 4, squashed)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsplitcount WHERE is_squashed = FALSE`, nil, 0)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsplitcount`, nil, 4)
+
+	assertStats()
+}
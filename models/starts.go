@@ -104,10 +104,14 @@ type FlowStart struct {
 
 		Extra         null.JSON `json:"extra,omitempty"          db:"extra"`
 		ParentSummary null.JSON `json:"parent_summary,omitempty" db:"parent_summary"`
+
+		// maximum number of contacts to start per minute, 0 meaning unlimited
+		Pace int `json:"pace,omitempty"`
 	}
 }
 
 func (s *FlowStart) ID() StartID        { return s.s.ID }
+func (s *FlowStart) UUID() uuids.UUID   { return s.s.UUID }
 func (s *FlowStart) OrgID() OrgID       { return s.s.OrgID }
 func (s *FlowStart) FlowID() FlowID     { return s.s.FlowID }
 func (s *FlowStart) FlowType() FlowType { return s.s.FlowType }
@@ -157,6 +161,12 @@ func (s *FlowStart) WithExtra(extra json.RawMessage) *FlowStart {
 	return s
 }
 
+func (s *FlowStart) Pace() int { return s.s.Pace }
+func (s *FlowStart) WithPace(pace int) *FlowStart {
+	s.s.Pace = pace
+	return s
+}
+
 func (s *FlowStart) MarshalJSON() ([]byte, error)    { return json.Marshal(s.s) }
 func (s *FlowStart) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, &s.s) }
 
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"github.com/nyaruka/goflow/envs"
+)
+
+// SystemTextKey is the key of a text which mailroom itself says or sends to contacts, outside of any flow
+type SystemTextKey string
+
+const (
+	// SystemTextIVRError is spoken to an IVR caller before hanging up when an error occurs
+	SystemTextIVRError = SystemTextKey("ivr_error")
+
+	// SystemTextIVRNoInput is spoken to an IVR caller who gave no input to a digits wait before they are asked again
+	SystemTextIVRNoInput = SystemTextKey("ivr_no_input")
+
+	// SystemTextIVRInvalidInput is spoken to an IVR caller who gave invalid input to a digits wait before they are asked again
+	SystemTextIVRInvalidInput = SystemTextKey("ivr_invalid_input")
+)
+
+// our built in English values for each system text
+var defaultSystemTexts = map[SystemTextKey]string{
+	SystemTextIVRError:        "An error has occurred, please try again later.",
+	SystemTextIVRNoInput:      "Sorry, we didn't receive a response, please try again.",
+	SystemTextIVRInvalidInput: "Sorry, that is not a valid response, please try again.",
+}
+
+// the org config key for the org's translations of system texts, keyed by text and then language, e.g.
+//
+//   "system_texts": {"ivr_error": {"eng": "Sorry, something went wrong.", "fra": "Désolé, une erreur est survenue."}}
+//
+const configSystemTexts = "system_texts"
+
+// DefaultSystemText returns the built in English value of the passed in system text
+func DefaultSystemText(key SystemTextKey) string {
+	return defaultSystemTexts[key]
+}
+
+// SystemText returns the value of the passed in system text for the passed in language. If the org doesn't have a
+// translation in that language, we fall back to its default language and then to the built in English value.
+func (o *Org) SystemText(key SystemTextKey, lang envs.Language) string {
+	texts, _ := o.config[configSystemTexts].(map[string]interface{})
+	translations, _ := texts[string(key)].(map[string]interface{})
+
+	for _, l := range []envs.Language{lang, o.DefaultLanguage()} {
+		if l == envs.NilLanguage {
+			continue
+		}
+		text, _ := translations[string(l)].(string)
+		if text != "" {
+			return text
+		}
+	}
+
+	return DefaultSystemText(key)
+}
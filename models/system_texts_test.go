@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemTexts(t *testing.T) {
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	// org without any translations gets our built in text
+	org, err := loadOrg(ctx, tx, Org1)
+	require.NoError(t, err)
+	assert.Equal(t, "An error has occurred, please try again later.", org.SystemText(SystemTextIVRError, envs.Language("fra")))
+	assert.Equal(t, DefaultSystemText(SystemTextIVRError), org.SystemText(SystemTextIVRError, envs.NilLanguage))
+
+	tx.MustExec(`INSERT INTO orgs_language(is_active, created_on, modified_on, name, iso_code, created_by_id, modified_by_id, org_id)
+									VALUES(TRUE, NOW(), NOW(), 'French', 'fra', 1, 1, 2);`)
+	tx.MustExec(`INSERT INTO orgs_language(is_active, created_on, modified_on, name, iso_code, created_by_id, modified_by_id, org_id)
+									VALUES(TRUE, NOW(), NOW(), 'English', 'eng', 1, 1, 2);`)
+	tx.MustExec("UPDATE orgs_org SET primary_language_id = 2 WHERE id = 2;")
+	tx.MustExec(`UPDATE orgs_org SET config = '{"system_texts": {"ivr_error": {"eng": "Sorry, please call back.", "fra": "Désolé, rappelez plus tard."}}}' WHERE id = 2`)
+
+	org, err = loadOrg(ctx, tx, Org2)
+	require.NoError(t, err)
+
+	// translation in the contact's language
+	assert.Equal(t, "Désolé, rappelez plus tard.", org.SystemText(SystemTextIVRError, envs.Language("fra")))
+
+	// falls back to the org's default language
+	assert.Equal(t, "Sorry, please call back.", org.SystemText(SystemTextIVRError, envs.Language("kin")))
+	assert.Equal(t, "Sorry, please call back.", org.SystemText(SystemTextIVRError, envs.NilLanguage))
+
+	// keys without a built in text are empty
+	assert.Equal(t, "", org.SystemText(SystemTextKey("unknown"), envs.Language("fra")))
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"strings"
+)
+
+// TriggerConflictType is how an existing trigger relates to a prospective one
+type TriggerConflictType string
+
+const (
+	// both triggers match the same messages or events with the same precedence so which one fires is undefined
+	TriggerConflictTypeAmbiguous = TriggerConflictType("ambiguous")
+
+	// both triggers match some of the same messages or events, e.g. from contacts in both of their groups, and which one
+	// fires for those is undefined
+	TriggerConflictTypeOverlaps = TriggerConflictType("overlaps")
+
+	// the prospective trigger would take precedence over the existing trigger for some contacts or channels
+	TriggerConflictTypeShadows = TriggerConflictType("shadows")
+
+	// the existing trigger would take precedence over the prospective trigger for some contacts or channels
+	TriggerConflictTypeShadowed = TriggerConflictType("shadowed")
+)
+
+// TriggerConflict is an existing trigger which overlaps with a prospective trigger
+type TriggerConflict struct {
+	TriggerID TriggerID           `json:"trigger_id"`
+	FlowID    FlowID              `json:"flow_id"`
+	Type      TriggerConflictType `json:"type"`
+}
+
+// NewTrigger creates a new trigger which isn't saved to the database, e.g. to check it for conflicts before creation
+func NewTrigger(triggerType TriggerType, keyword string, matchType MatchType, channelID ChannelID, referrerID string, groupIDs []GroupID) *Trigger {
+	t := &Trigger{}
+	t.t.TriggerType = triggerType
+	t.t.Keyword = strings.ToLower(keyword)
+	t.t.MatchType = matchType
+	t.t.ChannelID = channelID
+	t.t.ReferrerID = referrerID
+	t.t.GroupIDs = groupIDs
+	return t
+}
+
+// FindTriggerConflicts returns the existing triggers of the same type which the passed in trigger would overlap with,
+// using the same precedence as the FindMatching functions, i.e. group and channel specific triggers take precedence
+// over triggers without groups or a channel.
+func FindTriggerConflicts(org *OrgAssets, prospective *Trigger) []*TriggerConflict {
+	conflicts := make([]*TriggerConflict, 0)
+
+	for _, t := range org.Triggers() {
+		if t.TriggerType() != prospective.TriggerType() {
+			continue
+		}
+
+		var conflictType TriggerConflictType
+
+		switch t.TriggerType() {
+		case KeywordTriggerType:
+			if t.Keyword() == prospective.Keyword() {
+				conflictType = compareGroups(prospective.GroupIDs(), t.GroupIDs())
+
+				// first word and only word triggers for the same keyword only both match single word messages
+				if conflictType == TriggerConflictTypeAmbiguous && t.MatchType() != prospective.MatchType() {
+					conflictType = TriggerConflictTypeOverlaps
+				}
+			}
+		case CatchallTriggerType, CallTriggerType:
+			conflictType = compareGroups(prospective.GroupIDs(), t.GroupIDs())
+		case NewConversationTriggerType:
+			conflictType = compareChannels(prospective.ChannelID(), t.ChannelID())
+		case ReferralTriggerType:
+			conflictType = compareReferrers(prospective, t)
+		case MissedCallTriggerType:
+			conflictType = TriggerConflictTypeAmbiguous
+		}
+
+		if conflictType != "" {
+			conflicts = append(conflicts, &TriggerConflict{TriggerID: t.ID(), FlowID: t.FlowID(), Type: conflictType})
+		}
+	}
+
+	return conflicts
+}
+
+// compares triggers by their groups, where triggers with groups take precedence over those without
+func compareGroups(prospective []GroupID, existing []GroupID) TriggerConflictType {
+	if len(prospective) == 0 && len(existing) == 0 {
+		return TriggerConflictTypeAmbiguous
+	}
+	if len(existing) == 0 {
+		return TriggerConflictTypeShadows
+	}
+	if len(prospective) == 0 {
+		return TriggerConflictTypeShadowed
+	}
+
+	// both have groups, if they have the same groups they match the same contacts
+	if sameGroups(prospective, existing) {
+		return TriggerConflictTypeAmbiguous
+	}
+
+	// otherwise they overlap for contacts in a group they share, and even when their groups are disjoint a contact can
+	// be in a group of each
+	return TriggerConflictTypeOverlaps
+}
+
+// returns whether the two passed in lists of groups contain the same groups
+func sameGroups(groups1 []GroupID, groups2 []GroupID) bool {
+	set1 := make(map[GroupID]bool, len(groups1))
+	for _, g := range groups1 {
+		set1[g] = true
+	}
+	set2 := make(map[GroupID]bool, len(groups2))
+	for _, g := range groups2 {
+		if !set1[g] {
+			return false
+		}
+		set2[g] = true
+	}
+	return len(set1) == len(set2)
+}
+
+// compares triggers by their channels, where triggers with a channel take precedence over those without
+func compareChannels(prospective ChannelID, existing ChannelID) TriggerConflictType {
+	if prospective == existing {
+		return TriggerConflictTypeAmbiguous
+	}
+	if existing == NilChannelID {
+		return TriggerConflictTypeShadows
+	}
+	if prospective == NilChannelID {
+		return TriggerConflictTypeShadowed
+	}
+	return ""
+}
+
+// compares referral triggers, where triggers with a referrer id take precedence over those without regardless of channel
+func compareReferrers(prospective *Trigger, existing *Trigger) TriggerConflictType {
+	if prospective.ReferrerID() == "" && existing.ReferrerID() == "" {
+		return compareChannels(prospective.ChannelID(), existing.ChannelID())
+	}
+
+	// triggers must be able to match on the same channel to overlap
+	if prospective.ChannelID() != existing.ChannelID() && prospective.ChannelID() != NilChannelID && existing.ChannelID() != NilChannelID {
+		return ""
+	}
+
+	if prospective.ReferrerID() == existing.ReferrerID() {
+		return TriggerConflictTypeAmbiguous
+	}
+	if existing.ReferrerID() == "" {
+		return TriggerConflictTypeShadows
+	}
+	if prospective.ReferrerID() == "" {
+		return TriggerConflictTypeShadowed
+	}
+	return ""
+}
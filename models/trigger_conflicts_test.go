@@ -0,0 +1,83 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggerConflicts(t *testing.T) {
+	testsuite.Reset()
+	db := testsuite.DB()
+	ctx := testsuite.CTX()
+
+	joinID := insertTrigger(t, db, true, FavoritesFlowID, KeywordTriggerType, "join", MatchFirst, nil, "", NilChannelID)
+	doctorsJoinID := insertTrigger(t, db, true, SingleMessageFlowID, KeywordTriggerType, "join", MatchOnly, []GroupID{DoctorsGroupID}, "", NilChannelID)
+	fooID := insertTrigger(t, db, true, FavoritesFlowID, ReferralTriggerType, "", MatchFirst, nil, "foo", TwitterChannelID)
+	twitterReferralID := insertTrigger(t, db, true, FavoritesFlowID, ReferralTriggerType, "", MatchFirst, nil, "", TwitterChannelID)
+
+	FlushCache()
+
+	org, err := GetOrgAssets(ctx, db, Org1)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		Trigger   *Trigger
+		Conflicts map[TriggerID]TriggerConflictType
+	}{
+		{
+			NewTrigger(KeywordTriggerType, "JOIN", MatchFirst, NilChannelID, "", nil),
+			map[TriggerID]TriggerConflictType{joinID: TriggerConflictTypeAmbiguous, doctorsJoinID: TriggerConflictTypeShadowed},
+		},
+		{
+			NewTrigger(KeywordTriggerType, "join", MatchOnly, NilChannelID, "", nil),
+			map[TriggerID]TriggerConflictType{joinID: TriggerConflictTypeOverlaps, doctorsJoinID: TriggerConflictTypeShadowed},
+		},
+		{
+			NewTrigger(KeywordTriggerType, "join", MatchOnly, NilChannelID, "", []GroupID{DoctorsGroupID}),
+			map[TriggerID]TriggerConflictType{joinID: TriggerConflictTypeShadows, doctorsJoinID: TriggerConflictTypeAmbiguous},
+		},
+		{
+			NewTrigger(KeywordTriggerType, "join", MatchFirst, NilChannelID, "", []GroupID{DoctorsGroupID}),
+			map[TriggerID]TriggerConflictType{joinID: TriggerConflictTypeShadows, doctorsJoinID: TriggerConflictTypeOverlaps},
+		},
+		{
+			NewTrigger(KeywordTriggerType, "join", MatchOnly, NilChannelID, "", []GroupID{DoctorsGroupID, TestersGroupID}),
+			map[TriggerID]TriggerConflictType{joinID: TriggerConflictTypeShadows, doctorsJoinID: TriggerConflictTypeOverlaps},
+		},
+		{
+			NewTrigger(KeywordTriggerType, "join", MatchOnly, NilChannelID, "", []GroupID{TestersGroupID}),
+			map[TriggerID]TriggerConflictType{joinID: TriggerConflictTypeShadows, doctorsJoinID: TriggerConflictTypeOverlaps},
+		},
+		{
+			NewTrigger(KeywordTriggerType, "leave", MatchFirst, NilChannelID, "", nil),
+			map[TriggerID]TriggerConflictType{},
+		},
+		{
+			NewTrigger(ReferralTriggerType, "", MatchFirst, NilChannelID, "foo", nil),
+			map[TriggerID]TriggerConflictType{fooID: TriggerConflictTypeAmbiguous, twitterReferralID: TriggerConflictTypeShadows},
+		},
+		{
+			NewTrigger(ReferralTriggerType, "", MatchFirst, TwilioChannelID, "foo", nil),
+			map[TriggerID]TriggerConflictType{},
+		},
+		{
+			NewTrigger(ReferralTriggerType, "", MatchFirst, NilChannelID, "", nil),
+			map[TriggerID]TriggerConflictType{fooID: TriggerConflictTypeShadowed, twitterReferralID: TriggerConflictTypeShadowed},
+		},
+	}
+
+	for i, tc := range tcs {
+		conflicts := make(map[TriggerID]TriggerConflictType)
+		for _, c := range FindTriggerConflicts(org, tc.Trigger) {
+			conflicts[c.TriggerID] = c.Type
+		}
+
+		// only look at the triggers we created as the org may have others
+		for _, id := range []TriggerID{joinID, doctorsJoinID, fooID, twitterReferralID} {
+			assert.Equal(t, tc.Conflicts[id], conflicts[id], "%d: conflict mismatch for trigger %d", i, id)
+		}
+	}
+}
@@ -23,7 +23,12 @@ func readJSONRow(rows *sqlx.Rows, destination interface{}) error {
 		return errors.Wrap(err, "error scanning row json")
 	}
 
-	err = json.Unmarshal([]byte(jsonBlob), destination)
+	return readJSON([]byte(jsonBlob), destination)
+}
+
+// readJSON unmarshals and validates the passed in JSON, which is the same as a row read by readJSONRow
+func readJSON(data []byte, destination interface{}) error {
+	err := json.Unmarshal(data, destination)
 	if err != nil {
 		return errors.Wrap(err, "error unmarshalling row json")
 	}
@@ -31,7 +36,7 @@ func readJSONRow(rows *sqlx.Rows, destination interface{}) error {
 	// validate our final struct
 	err = validate.Struct(destination)
 	if err != nil {
-		return errors.Wrapf(err, "failed validation for json: %s", jsonBlob)
+		return errors.Wrapf(err, "failed validation for json: %s", data)
 	}
 
 	return nil
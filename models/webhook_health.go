@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// WebhookHealthDayLayout is the layout of the days webhook health is counted by, in UTC
+	WebhookHealthDayLayout = "2006-01-02"
+
+	webhookHealthKey = "webhook_health:%d:%s"
+
+	// how long we keep webhook health for
+	webhookHealthExpiration = 8 * 24 * time.Hour
+
+	webhookHealthCalls    = "calls"
+	webhookHealthFailures = "failures"
+	webhookHealthElapsed  = "elapsed_ms"
+)
+
+// WebhookCall is a call made to a webhook by a flow, which counts towards the health of the webhook's host
+type WebhookCall struct {
+	URL     string
+	Failed  bool
+	Elapsed time.Duration
+}
+
+// WebhookHealth is how calls to the webhooks of a host have fared over a day
+type WebhookHealth struct {
+	Host          string  `json:"host"`
+	Calls         int     `json:"calls"`
+	Failures      int     `json:"failures"`
+	FailureRate   float64 `json:"failure_rate"`
+	MeanElapsedMS int     `json:"mean_elapsed_ms"`
+}
+
+// webhooks are counted by host as URLs usually include paths and query strings which vary from call to call
+func webhookHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return "unknown"
+	}
+	return strings.ToLower(parsed.Host)
+}
+
+// RecordWebhookCalls counts the passed in calls towards the health of their hosts for the passed in org today
+func RecordWebhookCalls(rc redis.Conn, orgID OrgID, calls []*WebhookCall) error {
+	key := fmt.Sprintf(webhookHealthKey, orgID, time.Now().UTC().Format(WebhookHealthDayLayout))
+
+	rc.Send("multi")
+	for _, c := range calls {
+		host := webhookHost(c.URL)
+		rc.Send("hincrby", key, host+"|"+webhookHealthCalls, 1)
+		rc.Send("hincrby", key, host+"|"+webhookHealthElapsed, int(c.Elapsed/time.Millisecond))
+		if c.Failed {
+			rc.Send("hincrby", key, host+"|"+webhookHealthFailures, 1)
+		}
+	}
+	rc.Send("expire", key, int(webhookHealthExpiration/time.Second))
+	_, err := rc.Do("exec")
+	return errors.Wrapf(err, "error recording webhook calls for org: %d", orgID)
+}
+
+// GetWebhookHealth returns the health of each host whose webhooks the passed in org called on the passed in day,
+// those with the most failures first
+func GetWebhookHealth(rc redis.Conn, orgID OrgID, day string) ([]*WebhookHealth, error) {
+	counts, err := redis.IntMap(rc.Do("hgetall", fmt.Sprintf(webhookHealthKey, orgID, day)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading webhook health for org: %d", orgID)
+	}
+
+	byHost := make(map[string]*WebhookHealth)
+	elapsed := make(map[string]int)
+	for field, count := range counts {
+		parts := strings.SplitN(field, "|", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		host := parts[0]
+
+		health := byHost[host]
+		if health == nil {
+			health = &WebhookHealth{Host: host}
+			byHost[host] = health
+		}
+
+		switch parts[1] {
+		case webhookHealthCalls:
+			health.Calls = count
+		case webhookHealthFailures:
+			health.Failures = count
+		case webhookHealthElapsed:
+			elapsed[host] = count
+		}
+	}
+
+	healths := make([]*WebhookHealth, 0, len(byHost))
+	for host, health := range byHost {
+		if health.Calls > 0 {
+			health.FailureRate = float64(health.Failures) / float64(health.Calls)
+			health.MeanElapsedMS = elapsed[host] / health.Calls
+		}
+		healths = append(healths, health)
+	}
+
+	sort.Slice(healths, func(i, j int) bool {
+		if healths[i].Failures != healths[j].Failures {
+			return healths[i].Failures > healths[j].Failures
+		}
+		return healths[i].Host < healths[j].Host
+	})
+	return healths, nil
+}
+
+// AddWebhookCall records a webhook call by this session which will be counted once the session is committed
+func (s *Session) AddWebhookCall(call *WebhookCall) {
+	s.AddPostCommitEvent(webhookHealthHook, call)
+}
+
+// WebhookHealthHook is our hook for counting webhook calls once sessions are committed
+type WebhookHealthHook struct{}
+
+var webhookHealthHook = &WebhookHealthHook{}
+
+// Apply counts the webhook calls of the passed in sessions
+func (h *WebhookHealthHook) Apply(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, org *OrgAssets, sessions map[*Session][]interface{}) error {
+	calls := make([]*WebhookCall, 0, len(sessions))
+	for _, cs := range sessions {
+		for _, c := range cs {
+			calls = append(calls, c.(*WebhookCall))
+		}
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	err := RecordWebhookCalls(rc, org.OrgID(), calls)
+	if err != nil {
+		// health isn't worth failing our commit over, log and move on
+		logrus.WithError(err).WithField("org_id", org.OrgID()).Error("error recording webhook calls")
+	}
+	return nil
+}
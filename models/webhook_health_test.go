@@ -0,0 +1,58 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookHealth(t *testing.T) {
+	testsuite.Reset()
+	rc := testsuite.RC()
+	defer rc.Close()
+
+	today := time.Now().UTC().Format(WebhookHealthDayLayout)
+
+	// org without any calls has no hosts
+	health, err := GetWebhookHealth(rc, Org1, today)
+	assert.NoError(t, err)
+	assert.Equal(t, []*WebhookHealth{}, health)
+
+	err = RecordWebhookCalls(rc, Org1, []*WebhookCall{
+		{URL: "https://api.example.com/orders?id=1", Failed: false, Elapsed: 100 * time.Millisecond},
+		{URL: "https://API.example.com/orders?id=2", Failed: true, Elapsed: 300 * time.Millisecond},
+		{URL: "http://other.com/hook", Failed: false, Elapsed: 50 * time.Millisecond},
+		{URL: "not a url", Failed: true, Elapsed: 0},
+	})
+	assert.NoError(t, err)
+
+	err = RecordWebhookCalls(rc, Org2, []*WebhookCall{{URL: "http://other.com/hook", Failed: true}})
+	assert.NoError(t, err)
+
+	health, err = GetWebhookHealth(rc, Org1, today)
+	assert.NoError(t, err)
+	assert.Equal(t, []*WebhookHealth{
+		{Host: "api.example.com", Calls: 2, Failures: 1, FailureRate: 0.5, MeanElapsedMS: 200},
+		{Host: "unknown", Calls: 1, Failures: 1, FailureRate: 1, MeanElapsedMS: 0},
+		{Host: "other.com", Calls: 1, Failures: 0, FailureRate: 0, MeanElapsedMS: 50},
+	}, health)
+
+	// other days are counted separately
+	health, err = GetWebhookHealth(rc, Org1, "2020-01-01")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(health))
+}
+
+func TestWebhookResultTruncation(t *testing.T) {
+	assert.Equal(t, "hello", truncateLog("hello", 0))
+	assert.Equal(t, "hello", truncateLog("hello", 5))
+	assert.Equal(t, "hel", truncateLog("hello", 3))
+	assert.Equal(t, "a", truncateLog("aé", 2)) // é is 2 bytes so can't be split
+	assert.Equal(t, "aé", truncateLog("aéb", 3))
+
+	result := NewWebhookResult(Org1, CathyID, "http://example.com", "GET / HTTP/1.1", 200, strings.Repeat("x", 20000), time.Second, time.Now())
+	assert.Equal(t, 10*1024, len(result.r.Response))
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+)
+
+// the org and flow config key for headers and JSON paths which are stripped from webhook requests and responses before
+// they're stored in webhook results and session history, e.g.
+//
+//   "webhook_redaction": {"headers": ["Authorization"], "json_paths": ["token", "data.user.phone", "items.*.secret"]}
+//
+// JSON paths are keys separated by dots, where * matches any key and arrays are stepped into, e.g. "items.secret"
+// matches the secret of every item. Flows redact what their org does and what they declare themselves.
+const configWebhookRedaction = "webhook_redaction"
+
+// WebhookRedactedValue is what redacted headers and JSON values are replaced with
+const WebhookRedactedValue = "********"
+
+// WebhookRedaction is the headers and JSON paths stripped from webhook requests and responses before they're stored
+type WebhookRedaction struct {
+	Headers   []string
+	JSONPaths []string
+}
+
+// WebhookRedaction returns what this org redacts from stored webhook calls, or nil if nothing
+func (o *Org) WebhookRedaction() *WebhookRedaction {
+	return readWebhookRedaction(o.config[configWebhookRedaction])
+}
+
+// WebhookRedaction returns what this flow redacts from stored webhook calls in addition to its org, or nil if nothing
+func (f *Flow) WebhookRedaction() *WebhookRedaction {
+	return readWebhookRedaction(f.f.Config.Get(configWebhookRedaction, nil))
+}
+
+func readWebhookRedaction(value interface{}) *WebhookRedaction {
+	config, _ := value.(map[string]interface{})
+	strs := func(key string) []string {
+		items, _ := config[key].([]interface{})
+		s := make([]string, 0, len(items))
+		for _, i := range items {
+			if str, isStr := i.(string); isStr && str != "" {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+
+	r := &WebhookRedaction{Headers: strs("headers"), JSONPaths: strs("json_paths")}
+	if len(r.Headers) == 0 && len(r.JSONPaths) == 0 {
+		return nil
+	}
+	return r
+}
+
+// merges two redactions, either of which may be nil
+func mergeWebhookRedactions(r1, r2 *WebhookRedaction) *WebhookRedaction {
+	if r1 == nil {
+		return r2
+	}
+	if r2 == nil {
+		return r1
+	}
+	return &WebhookRedaction{
+		Headers:   append(append([]string{}, r1.Headers...), r2.Headers...),
+		JSONPaths: append(append([]string{}, r1.JSONPaths...), r2.JSONPaths...),
+	}
+}
+
+// Redact returns the passed in HTTP request or response trace with the values of matching headers and the values at
+// matching paths of a JSON body replaced. Traces which can't be parsed are left as they are.
+func (r *WebhookRedaction) Redact(trace string) string {
+	parts := strings.SplitN(trace, "\r\n\r\n", 2)
+
+	// the first line is the request or status line, the rest are headers
+	lines := strings.Split(parts[0], "\r\n")
+	for i := 1; i < len(lines); i++ {
+		colon := strings.Index(lines[i], ":")
+		if colon < 0 {
+			continue
+		}
+		name := strings.TrimSpace(lines[i][:colon])
+		for _, h := range r.Headers {
+			if strings.EqualFold(name, h) {
+				lines[i] = lines[i][:colon] + ": " + WebhookRedactedValue
+				break
+			}
+		}
+	}
+	parts[0] = strings.Join(lines, "\r\n")
+
+	if len(parts) == 2 && len(r.JSONPaths) > 0 {
+		parts[1] = r.redactJSON(parts[1])
+	}
+	return strings.Join(parts, "\r\n\r\n")
+}
+
+// redacts the passed in body if it's JSON, re-encoding it only if something was redacted
+func (r *WebhookRedaction) redactJSON(body string) string {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+
+	redacted := false
+	for _, path := range r.JSONPaths {
+		if redactJSONPath(value, strings.Split(path, ".")) {
+			redacted = true
+		}
+	}
+	if !redacted {
+		return body
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return body
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// replaces the values at the passed in path of the passed in JSON value, returning whether anything was replaced
+func redactJSONPath(value interface{}, path []string) bool {
+	redacted := false
+
+	switch typed := value.(type) {
+	case []interface{}:
+		for _, item := range typed {
+			if redactJSONPath(item, path) {
+				redacted = true
+			}
+		}
+	case map[string]interface{}:
+		for key, child := range typed {
+			if path[0] != "*" && path[0] != key {
+				continue
+			}
+			if len(path) == 1 {
+				typed[key] = WebhookRedactedValue
+				redacted = true
+			} else if redactJSONPath(child, path[1:]) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// redactWebhookEvents redacts, in place, the webhook calls made by the runs of the passed in session in the passed in
+// sprint, according to their org and flows, so that neither session history nor webhook results store what's redacted
+func redactWebhookEvents(org *OrgAssets, fs flows.Session, sprint flows.Sprint) {
+	orgRedaction := org.Org().WebhookRedaction()
+
+	// only events from this sprint, as earlier ones have already been redacted
+	inSprint := make(map[flows.Event]bool)
+	for _, e := range sprint.Events() {
+		if e.Type() == events.TypeWebhookCalled {
+			inSprint[e] = true
+		}
+	}
+	if len(inSprint) == 0 {
+		return
+	}
+
+	for _, r := range fs.Runs() {
+		redaction := orgRedaction
+		if flow, err := org.SessionFlowByUUID(r.FlowReference().UUID); err == nil {
+			redaction = mergeWebhookRedactions(orgRedaction, flow.WebhookRedaction())
+		}
+		if redaction == nil {
+			continue
+		}
+
+		for _, e := range r.Events() {
+			if inSprint[e] {
+				event := e.(*events.WebhookCalledEvent)
+				event.Request = redaction.Redact(event.Request)
+				event.Response = redaction.Redact(event.Response)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookRedaction(t *testing.T) {
+	readConfig := func(s string) *WebhookRedaction {
+		var config map[string]interface{}
+		json.Unmarshal([]byte(s), &config)
+		return readWebhookRedaction(config[configWebhookRedaction])
+	}
+
+	assert.Nil(t, readConfig(`{}`))
+	assert.Nil(t, readConfig(`{"webhook_redaction": {"headers": []}}`))
+
+	orgRedaction := readConfig(`{"webhook_redaction": {"headers": ["authorization"], "json_paths": ["token"]}}`)
+	assert.Equal(t, &WebhookRedaction{Headers: []string{"authorization"}, JSONPaths: []string{"token"}}, orgRedaction)
+
+	flowRedaction := readConfig(`{"webhook_redaction": {"json_paths": ["data.phone", "items.*.secret", 3]}}`)
+	assert.Equal(t, &WebhookRedaction{Headers: []string{}, JSONPaths: []string{"data.phone", "items.*.secret"}}, flowRedaction)
+
+	assert.Equal(t, orgRedaction, mergeWebhookRedactions(orgRedaction, nil))
+	redaction := mergeWebhookRedactions(orgRedaction, flowRedaction)
+	assert.Equal(t, &WebhookRedaction{Headers: []string{"authorization"}, JSONPaths: []string{"token", "data.phone", "items.*.secret"}}, redaction)
+
+	tcs := []struct {
+		trace    string
+		redacted string
+	}{
+		{
+			"POST /api HTTP/1.1\r\nHost: example.com\r\nAuthorization: Token 123456\r\n\r\n{\"name\": \"Bob\"}",
+			"POST /api HTTP/1.1\r\nHost: example.com\r\nAuthorization: ********\r\n\r\n{\"name\": \"Bob\"}",
+		},
+		{
+			"HTTP/1.0 200 OK\r\nContent-Type: application/json\r\n\r\n{\"token\": \"abc\", \"data\": {\"phone\": \"+250788123123\", \"age\": 32}, \"items\": [{\"a\": {\"secret\": 1}}, {\"b\": {\"secret\": 2.50}}]}",
+			"HTTP/1.0 200 OK\r\nContent-Type: application/json\r\n\r\n{\"data\":{\"age\":32,\"phone\":\"********\"},\"items\":[{\"a\":{\"secret\":\"********\"}},{\"b\":{\"secret\":\"********\"}}],\"token\":\"********\"}",
+		},
+		{
+			"HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\ntoken=abc",
+			"HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\ntoken=abc",
+		},
+		{
+			"connection error",
+			"connection error",
+		},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.redacted, redaction.Redact(tc.trace))
+	}
+}
@@ -3,6 +3,9 @@ package models
 import (
 	"context"
 	"time"
+	"unicode/utf8"
+
+	"github.com/nyaruka/mailroom/config"
 )
 
 type ResultID int64
@@ -35,15 +38,26 @@ func NewWebhookResult(
 	r.OrgID = orgID
 	r.ContactID = contactID
 	r.URL = url
-	r.Request = request
+	r.Request = truncateLog(request, config.Mailroom.WebhooksMaxLogBytes)
 	r.StatusCode = statusCode
-	r.Response = response
+	r.Response = truncateLog(response, config.Mailroom.WebhooksMaxLogBytes)
 	r.RequestTime = int(elapsed / time.Millisecond)
 	r.CreatedOn = createdOn
 
 	return result
 }
 
+// truncates the passed in request or response to at most max bytes, without splitting a character
+func truncateLog(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
 // InsertWebhookResults will insert the passed in webhook results, setting the ID parameter on each
 func InsertWebhookResults(ctx context.Context, db Queryer, results []*WebhookResult) error {
 	// convert to interface arrray
@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	canarySuffix = "_canary"
+
+	outcomesKey = "task_outcomes:%d"
+
+	// how long outcomes are kept for after their minute
+	outcomesRetention = time.Minute * 10
+)
+
+// CanaryRouting describes which tasks are routed to the canary queues, which are only handled by instances running a
+// new version, so that an upgrade can be tried on some orgs or task types before all of them
+type CanaryRouting struct {
+	// the percentage of orgs whose tasks are routed, chosen by org id so an org's tasks always go the same way
+	Percent int
+
+	// orgs whose tasks are always routed
+	OrgIDs map[int]bool
+
+	// the task types which are routed, all types if empty
+	TaskTypes map[string]bool
+}
+
+// Routes returns whether a task of the passed in type for the passed in org should be routed to the canary queues
+func (r *CanaryRouting) Routes(taskType string, orgID int) bool {
+	if len(r.TaskTypes) > 0 && !r.TaskTypes[taskType] {
+		return false
+	}
+	return r.OrgIDs[orgID] || orgID%100 < r.Percent
+}
+
+var canaryRouting *CanaryRouting
+var canaryMutex sync.RWMutex
+
+// SetCanaryRouting sets the routing of tasks to the canary queues, nil to route no tasks
+func SetCanaryRouting(r *CanaryRouting) {
+	canaryMutex.Lock()
+	defer canaryMutex.Unlock()
+
+	canaryRouting = r
+}
+
+// CanaryQueue returns the name of the canary version of the passed in queue
+func CanaryQueue(queue string) string {
+	return BaseQueue(queue) + canarySuffix
+}
+
+// BaseQueue returns the name of the queue which the passed in queue is the canary version of, or the queue itself
+func BaseQueue(queue string) string {
+	return strings.TrimSuffix(queue, canarySuffix)
+}
+
+// IsCanary returns whether the passed in queue is a canary queue
+func IsCanary(queue string) bool {
+	return strings.HasSuffix(queue, canarySuffix)
+}
+
+// routes the passed in task to the canary or base version of the passed in queue. Tasks are routed every time they
+// are queued, so retried and scheduled tasks go back to the base queue if routing is turned off.
+func routeTask(queue string, task *Task) string {
+	canaryMutex.RLock()
+	defer canaryMutex.RUnlock()
+
+	if canaryRouting != nil && canaryRouting.Routes(task.Type, task.OrgID) {
+		return CanaryQueue(queue)
+	}
+	return BaseQueue(queue)
+}
+
+// OutcomeStats are how many tasks of a type from a queue were handled in a minute, how many of those errored and how
+// long they took on average. Stats with no task type are for all the tasks in their queue.
+type OutcomeStats struct {
+	Queue       string
+	TaskType    string
+	Count       int
+	Errors      int
+	MeanElapsed time.Duration
+}
+
+// ErrorRate returns the fraction of tasks which errored
+func (s *OutcomeStats) ErrorRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Count)
+}
+
+// RecordOutcome records that a task of the passed in type from the passed in queue was handled in the minute of the
+// passed in time, how long it took and whether it errored
+func RecordOutcome(rc redis.Conn, queue string, taskType string, handledOn time.Time, elapsed time.Duration, failed bool) error {
+	key := fmt.Sprintf(outcomesKey, handledOn.Unix()/60)
+	field := queue + ":" + taskType
+
+	rc.Send("multi")
+	rc.Send("hincrby", key, field+":count", 1)
+	rc.Send("hincrby", key, field+":elapsed_ms", int64(elapsed/time.Millisecond))
+	if failed {
+		rc.Send("hincrby", key, field+":errors", 1)
+	}
+	rc.Send("expire", key, int(outcomesRetention.Seconds())+60)
+	_, err := rc.Do("exec")
+	return errors.Wrapf(err, "error recording outcome of %s task", taskType)
+}
+
+// ReadOutcomes returns the outcome stats for each task type which was handled in the minute of the passed in time,
+// followed by the stats for each queue
+func ReadOutcomes(rc redis.Conn, minuteOf time.Time) ([]*OutcomeStats, error) {
+	values, err := redis.Int64Map(rc.Do("hgetall", fmt.Sprintf(outcomesKey, minuteOf.Unix()/60)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading task outcomes")
+	}
+
+	byType := make(map[string]*OutcomeStats)
+	elapsed := make(map[string]int64)
+
+	for field, value := range values {
+		parts := strings.Split(field, ":")
+		if len(parts) != 3 {
+			continue
+		}
+		key := parts[0] + ":" + parts[1]
+
+		s := byType[key]
+		if s == nil {
+			s = &OutcomeStats{Queue: parts[0], TaskType: parts[1]}
+			byType[key] = s
+		}
+
+		switch parts[2] {
+		case "count":
+			s.Count = int(value)
+		case "errors":
+			s.Errors = int(value)
+		case "elapsed_ms":
+			elapsed[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(byType))
+	for k := range byType {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	stats := make([]*OutcomeStats, 0, len(keys))
+	queues := make([]string, 0)
+	byQueue := make(map[string]*OutcomeStats)
+	queueElapsed := make(map[string]int64)
+
+	for _, k := range keys {
+		s := byType[k]
+		if s.Count == 0 {
+			continue
+		}
+		s.MeanElapsed = time.Duration(elapsed[k]/int64(s.Count)) * time.Millisecond
+		stats = append(stats, s)
+
+		q := byQueue[s.Queue]
+		if q == nil {
+			q = &OutcomeStats{Queue: s.Queue}
+			byQueue[s.Queue] = q
+			queues = append(queues, s.Queue)
+		}
+		q.Count += s.Count
+		q.Errors += s.Errors
+		queueElapsed[s.Queue] += elapsed[k]
+	}
+
+	for _, queue := range queues {
+		q := byQueue[queue]
+		q.MeanElapsed = time.Duration(queueElapsed[queue]/int64(q.Count)) * time.Millisecond
+		stats = append(stats, q)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanaryRouting(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	require.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "test:2", "test:203", "test_canary:active", "test_canary:1", "test_canary:2", "test_canary:203")
+
+	assert.Equal(t, "test_canary", CanaryQueue("test"))
+	assert.Equal(t, "test_canary", CanaryQueue("test_canary"))
+	assert.Equal(t, "test", BaseQueue("test_canary"))
+	assert.True(t, IsCanary("test_canary"))
+	assert.False(t, IsCanary("test"))
+
+	// with no routing everything goes to the base queue
+	err = AddTask(rc, "test", "campaign", 1, "task1", DefaultPriority)
+	require.NoError(t, err)
+
+	SetCanaryRouting(&CanaryRouting{Percent: 5, OrgIDs: map[int]bool{2: true}, TaskTypes: map[string]bool{"campaign": true}})
+	defer SetCanaryRouting(nil)
+
+	routing := canaryRouting
+	assert.True(t, routing.Routes("campaign", 2))    // always routed
+	assert.True(t, routing.Routes("campaign", 203))  // in our percentage
+	assert.False(t, routing.Routes("campaign", 1))   // out of it
+	assert.False(t, routing.Routes("start_flow", 2)) // not a routed type
+
+	for _, orgID := range []int{1, 2, 203} {
+		err = AddTask(rc, "test", "campaign", orgID, "task2", DefaultPriority)
+		require.NoError(t, err)
+	}
+	err = AddTask(rc, "test", "start_flow", 2, "task3", DefaultPriority)
+	require.NoError(t, err)
+
+	size, err := Size(rc, "test")
+	require.NoError(t, err)
+	assert.Equal(t, 3, size)
+
+	size, err = Size(rc, "test_canary")
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	// tasks are routed again when requeued so a canary task goes back to the base queue if routing is turned off
+	SetCanaryRouting(nil)
+	err = addTask(rc, "test_canary", &Task{Type: "campaign", OrgID: 2, Task: []byte(`"task4"`), QueuedOn: time.Now()}, DefaultPriority)
+	require.NoError(t, err)
+
+	size, err = Size(rc, "test")
+	require.NoError(t, err)
+	assert.Equal(t, 4, size)
+}
+
+func TestOutcomes(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	require.NoError(t, err)
+
+	minute := time.Date(2020, 4, 15, 12, 30, 0, 0, time.UTC)
+	rc.Do("del", fmt.Sprintf(outcomesKey, minute.Unix()/60))
+
+	handled := minute.Add(time.Second * 10)
+	require.NoError(t, RecordOutcome(rc, "handler", "handle_contact_event", handled, time.Millisecond*10, false))
+	require.NoError(t, RecordOutcome(rc, "handler", "handle_contact_event", handled, time.Millisecond*30, true))
+	require.NoError(t, RecordOutcome(rc, "handler_canary", "handle_contact_event", handled, time.Millisecond*40, false))
+
+	// nothing recorded in the next minute
+	stats, err := ReadOutcomes(rc, minute.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(stats))
+
+	stats, err = ReadOutcomes(rc, minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []*OutcomeStats{
+		{Queue: "handler", TaskType: "handle_contact_event", Count: 2, Errors: 1, MeanElapsed: time.Millisecond * 20},
+		{Queue: "handler_canary", TaskType: "handle_contact_event", Count: 1, Errors: 0, MeanElapsed: time.Millisecond * 40},
+		{Queue: "handler", TaskType: "", Count: 2, Errors: 1, MeanElapsed: time.Millisecond * 20},
+		{Queue: "handler_canary", TaskType: "", Count: 1, Errors: 0, MeanElapsed: time.Millisecond * 40},
+	}, stats)
+	assert.Equal(t, 0.5, stats[0].ErrorRate())
+}
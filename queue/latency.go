@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	latencySamplesKey = "task_latency:%d:%s:%s"
+	latencyTypesKey   = "task_latency_types:%d"
+
+	// the most samples we keep for a task type in a minute, beyond which we keep the most recent
+	latencyMaxSamples = 10000
+
+	// how long samples are kept for after their minute
+	latencyRetention = time.Minute * 10
+)
+
+// LatencyStats are the percentiles of how long tasks of a type waited between being queued and being started in a
+// minute. Stats with no task type are for all the tasks in their queue.
+type LatencyStats struct {
+	Queue    string
+	TaskType string
+	Count    int
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+}
+
+// RecordLatency records how long a task of the passed in type waited in the passed in queue before being started, in
+// the minute it was started
+func RecordLatency(rc redis.Conn, queue string, taskType string, queuedOn time.Time, startedOn time.Time) error {
+	latency := startedOn.Sub(queuedOn)
+	if latency < 0 {
+		latency = 0
+	}
+
+	minute := startedOn.Unix() / 60
+	samplesKey := fmt.Sprintf(latencySamplesKey, minute, queue, taskType)
+	typesKey := fmt.Sprintf(latencyTypesKey, minute)
+	expiration := int(latencyRetention.Seconds()) + 60
+
+	rc.Send("multi")
+	rc.Send("rpush", samplesKey, int64(latency/time.Millisecond))
+	rc.Send("ltrim", samplesKey, -latencyMaxSamples, -1)
+	rc.Send("expire", samplesKey, expiration)
+	rc.Send("sadd", typesKey, queue+":"+taskType)
+	rc.Send("expire", typesKey, expiration)
+	_, err := rc.Do("exec")
+	return errors.Wrapf(err, "error recording latency of %s task", taskType)
+}
+
+// ReadLatencies returns the latency stats for each task type which was started in the minute of the passed in time,
+// followed by the stats for each queue
+func ReadLatencies(rc redis.Conn, minuteOf time.Time) ([]*LatencyStats, error) {
+	minute := minuteOf.Unix() / 60
+
+	members, err := redis.Strings(rc.Do("smembers", fmt.Sprintf(latencyTypesKey, minute)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading task types with latencies")
+	}
+	sort.Strings(members)
+
+	stats := make([]*LatencyStats, 0, len(members))
+	queueSamples := make(map[string][]int64)
+	queues := make([]string, 0)
+
+	for _, m := range members {
+		parts := strings.SplitN(m, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		queue, taskType := parts[0], parts[1]
+
+		samples, err := redis.Int64s(rc.Do("lrange", fmt.Sprintf(latencySamplesKey, minute, queue, taskType), 0, -1))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading latencies of %s tasks", taskType)
+		}
+		if len(samples) == 0 {
+			continue
+		}
+
+		stats = append(stats, newLatencyStats(queue, taskType, samples))
+
+		if _, seen := queueSamples[queue]; !seen {
+			queues = append(queues, queue)
+		}
+		queueSamples[queue] = append(queueSamples[queue], samples...)
+	}
+
+	for _, queue := range queues {
+		stats = append(stats, newLatencyStats(queue, "", queueSamples[queue]))
+	}
+
+	return stats, nil
+}
+
+func newLatencyStats(queue string, taskType string, samples []int64) *LatencyStats {
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	return &LatencyStats{
+		Queue:    queue,
+		TaskType: taskType,
+		Count:    len(samples),
+		P50:      percentile(samples, 50),
+		P95:      percentile(samples, 95),
+		P99:      percentile(samples, 99),
+	}
+}
+
+// returns the nearest rank percentile of the passed in sorted millisecond samples
+func percentile(sorted []int64, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return time.Duration(sorted[rank-1]) * time.Millisecond
+}
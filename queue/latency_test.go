@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencies(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	require.NoError(t, err)
+
+	minute := time.Date(2020, 4, 15, 12, 30, 0, 0, time.UTC)
+	m := minute.Unix() / 60
+	rc.Do("del", fmt.Sprintf(latencyTypesKey, m), fmt.Sprintf(latencySamplesKey, m, "handler", "handle_contact_event"), fmt.Sprintf(latencySamplesKey, m, "handler", "start_flow"))
+
+	// record 100 contact events which waited 1ms to 100ms and a flow start which waited a second
+	for i := 1; i <= 100; i++ {
+		started := minute.Add(time.Second * 10)
+		err := RecordLatency(rc, "handler", "handle_contact_event", started.Add(-time.Duration(i)*time.Millisecond), started)
+		require.NoError(t, err)
+	}
+	err = RecordLatency(rc, "handler", "start_flow", minute, minute.Add(time.Second))
+	require.NoError(t, err)
+
+	// nothing recorded in the next minute
+	stats, err := ReadLatencies(rc, minute.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(stats))
+
+	stats, err = ReadLatencies(rc, minute.Add(time.Second*30))
+	assert.NoError(t, err)
+	assert.Equal(t, []*LatencyStats{
+		{Queue: "handler", TaskType: "handle_contact_event", Count: 100, P50: time.Millisecond * 50, P95: time.Millisecond * 95, P99: time.Millisecond * 99},
+		{Queue: "handler", TaskType: "start_flow", Count: 1, P50: time.Second, P95: time.Second, P99: time.Second},
+		{Queue: "handler", TaskType: "", Count: 101, P50: time.Millisecond * 51, P95: time.Millisecond * 96, P99: time.Millisecond * 100},
+	}, stats)
+}
@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// the set on the standby of the contact queues we last copied to it, so that those emptied on the primary since can
+// be removed from the standby
+const mirroredContactQueuesKey = "mirrored_contact_queues"
+
+// MirrorTasks copies the passed in queues, their canary versions, the contact queues which their handle tasks will
+// read from, our scheduled tasks and our dead tasks to the passed in standby redis, replacing whatever the standby had
+// for them. Each call is a point in time copy, so tasks queued or popped after it are only reflected on the standby
+// after the next call. Tasks themselves are never read, only copied, so the cost of a call depends on the number of
+// queues rather than the number of tasks in them. Returns the number of keys copied.
+func MirrorTasks(rc redis.Conn, standby redis.Conn, queues []string) (int, error) {
+	keys := []string{scheduledKey, deadLetterKey}
+
+	for _, q := range mirroredQueues(queues) {
+		active := fmt.Sprintf(activePattern, q)
+		keys = append(keys, active)
+
+		// include org queues which only the standby still has so they get removed
+		seen := make(map[string]bool)
+		for _, conn := range []redis.Conn{rc, standby} {
+			orgs, err := redis.Strings(conn.Do("zrange", active, 0, -1))
+			if err != nil {
+				return 0, errors.Wrapf(err, "error getting active queues for: %s", q)
+			}
+			for _, org := range orgs {
+				if !seen[org] {
+					keys = append(keys, fmt.Sprintf("%s:%s", q, org))
+					seen[org] = true
+				}
+			}
+		}
+	}
+
+	// contact queues are created by anything which queues contact events, including courier, so find them by name
+	// rather than by reading the handle tasks which point to them
+	contactQueues, err := scanKeys(rc, contactQueueMatch)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error finding contact queues")
+	}
+	current := make(map[string]bool, len(contactQueues))
+	for _, key := range contactQueues {
+		current[key] = true
+	}
+
+	// include contact queues we copied last time so those no longer needed are removed
+	previous, err := redis.Strings(standby.Do("smembers", mirroredContactQueuesKey))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error reading mirrored contact queues")
+	}
+	for _, key := range previous {
+		if !current[key] {
+			keys = append(keys, key)
+		}
+	}
+	keys = append(keys, contactQueues...)
+
+	// dump everything in one round trip
+	for _, key := range keys {
+		rc.Send("dump", key)
+	}
+	if err := rc.Flush(); err != nil {
+		return 0, errors.Wrapf(err, "error dumping keys")
+	}
+
+	copied := 0
+	for _, key := range keys {
+		dumped, err := rc.Receive()
+		if err != nil {
+			return 0, errors.Wrapf(err, "error dumping key: %s", key)
+		}
+
+		if dumped == nil {
+			standby.Send("del", key)
+		} else {
+			standby.Send("restore", key, 0, dumped, "REPLACE")
+			copied++
+		}
+	}
+
+	standby.Send("del", mirroredContactQueuesKey)
+	if len(contactQueues) > 0 {
+		standby.Send("sadd", redis.Args{mirroredContactQueuesKey}.AddFlat(contactQueues)...)
+	}
+
+	_, err = standby.Do("")
+	if err != nil {
+		return 0, errors.Wrapf(err, "error writing to standby")
+	}
+
+	return copied, nil
+}
+
+// returns all the keys matching the passed in pattern, using scan so that redis isn't blocked while it looks
+func scanKeys(rc redis.Conn, match string) ([]string, error) {
+	keys := make([]string, 0)
+	cursor := 0
+	for {
+		values, err := redis.Values(rc.Do("scan", cursor, "match", match, "count", 1000))
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []string
+		if _, err := redis.Scan(values, &cursor, &batch); err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+// returns the passed in queues along with their base and canary versions, so tasks are mirrored wherever they are routed
+func mirroredQueues(queues []string) []string {
+	seen := make(map[string]bool)
+	all := make([]string, 0, len(queues)*2)
+	for _, q := range queues {
+		for _, v := range []string{BaseQueue(q), CanaryQueue(q)} {
+			if !seen[v] {
+				all = append(all, v)
+				seen[v] = true
+			}
+		}
+	}
+	return all
+}
@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorTasks(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	require.NoError(t, err)
+	defer rc.Close()
+
+	standby, err := redis.Dial("tcp", "localhost:6379", redis.DialDatabase(14))
+	require.NoError(t, err)
+	defer standby.Close()
+
+	rc.Do("del", "mirror:active", "mirror:1", "mirror:2", "mirror_canary:active", "mirror_canary:3", scheduledKey, deadLetterKey)
+	standby.Do("del", "mirror:active", "mirror:1", "mirror:2", "mirror:3", "mirror_canary:active", "mirror_canary:3", "c:1:10", "c:1:11", scheduledKey, deadLetterKey, mirroredContactQueuesKey)
+
+	// clear out any contact queues left by other tests
+	leftover, err := scanKeys(rc, contactQueueMatch)
+	require.NoError(t, err)
+	for _, key := range leftover {
+		rc.Do("del", key)
+	}
+
+	// standby has a queue the primary no longer has
+	standby.Do("zadd", "mirror:3", 1, "old")
+	standby.Do("zadd", "mirror:active", 0, 3)
+
+	AddTask(rc, "mirror", "campaign", 1, "task1", DefaultPriority)
+	AddTask(rc, "mirror", "campaign", 2, "task2", DefaultPriority)
+	AddTask(rc, "mirror", "campaign", 2, "task3", DefaultPriority)
+	ScheduleTask(rc, "mirror", "campaign", 1, "task4", DefaultPriority, time.Now().Add(time.Hour))
+
+	// a handle task and the events in the contact queue it will read
+	AddTask(rc, "mirror", HandleContactEvent, 1, map[string]int{"contact_id": 10}, DefaultPriority)
+	rc.Do("rpush", "c:1:10", "event1", "event2")
+
+	// a task routed to the canary version of the queue
+	SetCanaryRouting(&CanaryRouting{OrgIDs: map[int]bool{3: true}})
+	AddTask(rc, "mirror", "campaign", 3, "task5", DefaultPriority)
+	SetCanaryRouting(nil)
+
+	copied, err := MirrorTasks(rc, standby, []string{"mirror"})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, copied)
+
+	events, err := redis.Strings(standby.Do("lrange", "c:1:10", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"event1", "event2"}, events)
+
+	canary, err := Size(standby, "mirror_canary")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, canary)
+
+	// standby now has the same queues as the primary
+	size, err := Size(standby, "mirror")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+
+	exists, err := redis.Bool(standby.Do("exists", "mirror:3"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	scheduled, err := redis.Int(standby.Do("zcard", scheduledKey))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, scheduled)
+
+	// and tasks can be popped from it
+	task, err := PopNextTask(standby, "mirror")
+	assert.NoError(t, err)
+	assert.Equal(t, `"task1"`, string(task.Task))
+
+	// once the contact's events have been handled, they're removed from the standby too
+	rc.Do("del", "c:1:10")
+	_, err = MirrorTasks(rc, standby, []string{"mirror"})
+	assert.NoError(t, err)
+
+	exists, err = redis.Bool(standby.Do("exists", "c:1:10"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	rc.Do("del", "mirror:active", "mirror:1", "mirror:2", "mirror_canary:active", "mirror_canary:3", scheduledKey)
+	standby.Do("del", "mirror:active", "mirror:1", "mirror:2", "mirror_canary:active", "mirror_canary:3", scheduledKey, mirroredContactQueuesKey)
+}
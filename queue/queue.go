@@ -7,15 +7,18 @@ import (
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/goflow/utils/uuids"
 	"github.com/pkg/errors"
 )
 
 // Task is a utility struct for encoding a task
 type Task struct {
+	ID         string          `json:"id,omitempty"`
 	Type       string          `json:"type"`
 	OrgID      int             `json:"org_id"`
 	Task       json.RawMessage `json:"task"`
 	QueuedOn   time.Time       `json:"queued_on"`
+	Priority   Priority        `json:"priority,omitempty"`
 	ErrorCount int             `json:"error_count,omitempty"`
 }
 
@@ -23,8 +26,11 @@ type Task struct {
 type Priority int
 
 const (
-	queuePattern  = "%s:%d"
-	activePattern = "%s:active"
+	queuePattern        = "%s:%d"
+	activePattern       = "%s:active"
+	scheduledKey        = "scheduled_tasks"
+	contactQueuePattern = "c:%d:%d"
+	contactQueueMatch   = "c:*"
 
 	// DefaultPriority is the default priority for tasks
 	DefaultPriority = Priority(0)
@@ -50,6 +56,9 @@ const (
 	// FireCampaignEvent is our type for firing a campaign event
 	FireCampaignEvent = "fire_campaign_event"
 
+	// ScheduleCampaignEvent is our type for scheduling a campaign event for all the contacts in its group
+	ScheduleCampaignEvent = "schedule_campaign_event"
+
 	// HandleContactEvent is our task for event handling
 	HandleContactEvent = "handle_contact_event"
 
@@ -64,6 +73,18 @@ const (
 
 	// InterruptSessions is our task type to interrupt a set of sessions
 	InterruptSessions = "interrupt_sessions"
+
+	// AnonymizeContacts is our task type to anonymize a set of contacts
+	AnonymizeContacts = "anonymize_contacts"
+
+	// PushFlowResults is our task type to push the results of a completed run to an HTTP endpoint
+	PushFlowResults = "push_flow_results"
+
+	// SendEmail is our task type to send an email from a flow through its org's SMTP server
+	SendEmail = "send_email"
+
+	// CheckFlowSessions is our task type to check whether the sessions in a flow can continue in its latest revision
+	CheckFlowSessions = "check_flow_sessions"
 )
 
 // Size returns the number of tasks for the passed in queue
@@ -87,32 +108,187 @@ func Size(rc redis.Conn, queue string) (int, error) {
 	return size, nil
 }
 
+// ContactQueue returns the key of the list of events waiting to be handled for the passed in contact
+func ContactQueue(orgID int, contactID int64) string {
+	return fmt.Sprintf(contactQueuePattern, orgID, contactID)
+}
+
+// AddContactEvent adds the passed in event to the queue of events for the passed in contact, and queues a task to
+// handle that contact's events. If front is true the event is handled before any others already queued for the contact.
+func AddContactEvent(rc redis.Conn, contactID int64, event *Task, front bool) error {
+	if event.ID == "" {
+		event.ID = string(uuids.New())
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrapf(err, "error marshalling contact event")
+	}
+
+	// first push the event on our contact queue
+	push := "rpush"
+	if front {
+		push = "lpush"
+	}
+	_, err = rc.Do(push, ContactQueue(event.OrgID, contactID), eventJSON)
+	if err != nil {
+		return errors.Wrapf(err, "error adding contact event")
+	}
+
+	logContactEvent(contactID, event)
+
+	// then add a handle task for that contact
+	err = AddTask(rc, HandlerQueue, HandleContactEvent, event.OrgID, map[string]int64{"contact_id": contactID}, DefaultPriority)
+	if err != nil {
+		return errors.Wrapf(err, "error adding handle event task")
+	}
+	return nil
+}
+
 // AddTask adds the passed in task to our queue for execution
 func AddTask(rc redis.Conn, queue string, taskType string, orgID int, task interface{}, priority Priority) error {
-	score := strconv.FormatFloat(float64(time.Now().UnixNano()/int64(time.Microsecond))/float64(1000000)+float64(priority), 'f', 6, 64)
+	payload, err := newTask(taskType, orgID, task)
+	if err != nil {
+		return err
+	}
 
+	return addTask(rc, queue, payload, priority)
+}
+
+// newTask creates a new task of the passed in type with the passed in body
+func newTask(taskType string, orgID int, task interface{}) (*Task, error) {
 	taskBody, err := json.Marshal(task)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	payload := &Task{
+	return &Task{
+		ID:       string(uuids.New()),
 		Type:     taskType,
 		OrgID:    orgID,
 		Task:     taskBody,
 		QueuedOn: time.Now(),
+	}, nil
+}
+
+// addTask adds the passed in task payload to the passed in queue, or its canary version if the task is routed there
+func addTask(rc redis.Conn, queue string, payload *Task, priority Priority) error {
+	queue, score, jsonPayload, err := prepareTask(queue, payload, priority)
+	if err != nil {
+		return err
+	}
+
+	rc.Send("zadd", fmt.Sprintf(queuePattern, queue, payload.OrgID), score, jsonPayload)
+	rc.Send("zincrby", fmt.Sprintf(activePattern, queue), 0, payload.OrgID)
+	_, err = rc.Do("")
+	if err != nil {
+		return err
 	}
+
+	logTask(queue, payload, priority)
+	return nil
+}
+
+// prepareTask routes the passed in task payload, returning the queue it should be added to, its score in that queue
+// and its JSON
+func prepareTask(queue string, payload *Task, priority Priority) (string, string, []byte, error) {
+	queue = routeTask(queue, payload)
+	payload.Priority = priority
+
+	score := strconv.FormatFloat(float64(time.Now().UnixNano()/int64(time.Microsecond))/float64(1000000)+float64(priority), 'f', 6, 64)
+
 	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return queue, score, jsonPayload, nil
+}
+
+// scheduledTask is a task which will be added to a queue at a later time
+type scheduledTask struct {
+	Queue    string   `json:"queue"`
+	Priority Priority `json:"priority"`
+	Task     *Task    `json:"task"`
+}
+
+// ScheduleTask schedules the passed in task to be added to our queue at the passed in time, it will be
+// queued by the first call to QueueScheduledTasks after that time
+func ScheduleTask(rc redis.Conn, queue string, taskType string, orgID int, task interface{}, priority Priority, queueOn time.Time) error {
+	payload, err := newTask(taskType, orgID, task)
 	if err != nil {
 		return err
 	}
 
-	rc.Send("zadd", fmt.Sprintf(queuePattern, queue, orgID), score, jsonPayload)
-	rc.Send("zincrby", fmt.Sprintf(activePattern, queue), 0, orgID)
-	_, err = rc.Do("")
+	jsonScheduled, err := json.Marshal(&scheduledTask{Queue: queue, Priority: priority, Task: payload})
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.Do("zadd", scheduledKey, queueOn.Unix(), jsonScheduled)
 	return err
 }
 
+var queueScheduledTask = redis.NewScript(3, `-- KEYS: [ScheduledKey, QueueKey, ActiveKey], ARGV: [Scheduled, Score, Task, OrgID]
+	-- remove it first, if someone else already removed it then they are the ones who will queue it
+	if redis.call("zrem", KEYS[1], ARGV[1]) == 0 then
+		return 0
+	end
+
+	redis.call("zadd", KEYS[2], ARGV[2], ARGV[3])
+	redis.call("zincrby", KEYS[3], 0, ARGV[4])
+	return 1
+`)
+
+// QueueScheduledTasks adds all the scheduled tasks which are due as of the passed in time to their queues,
+// returning the number of tasks queued. Each task is removed from the scheduled tasks and added to its queue
+// atomically so that it can't be lost or queued twice.
+func QueueScheduledTasks(rc redis.Conn, now time.Time) (int, error) {
+	due, err := redis.Strings(rc.Do("zrangebyscore", scheduledKey, 0, now.Unix(), "LIMIT", 0, 1000))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error reading scheduled tasks")
+	}
+
+	queued := 0
+	for _, d := range due {
+		scheduled := &scheduledTask{}
+		err = json.Unmarshal([]byte(d), scheduled)
+		if err != nil {
+			// this can never be queued so remove it
+			rc.Do("zrem", scheduledKey, d)
+			return queued, errors.Wrapf(err, "error unmarshalling scheduled task: %s", d)
+		}
+
+		scheduled.Task.QueuedOn = now
+		queue, score, jsonPayload, err := prepareTask(scheduled.Queue, scheduled.Task, scheduled.Priority)
+		if err != nil {
+			return queued, errors.Wrapf(err, "error preparing scheduled task")
+		}
+
+		added, err := redis.Int(queueScheduledTask.Do(rc, scheduledKey, fmt.Sprintf(queuePattern, queue, scheduled.Task.OrgID), fmt.Sprintf(activePattern, queue), d, score, jsonPayload, scheduled.Task.OrgID))
+		if err != nil {
+			return queued, errors.Wrapf(err, "error queuing scheduled task")
+		}
+		if added == 0 {
+			continue
+		}
+
+		logTask(queue, scheduled.Task, scheduled.Priority)
+		queued++
+	}
+
+	return queued, nil
+}
+
+// PacedDelay returns how long the batch at the passed in index should be delayed so that no more than
+// perMinute items are started each minute. Zero or negative values of perMinute mean no pacing.
+func PacedDelay(batchIndex int, batchSize int, perMinute int) time.Duration {
+	if perMinute <= 0 {
+		return 0
+	}
+	return time.Duration(float64(batchIndex*batchSize) / float64(perMinute) * float64(time.Minute))
+}
+
 var popTask = redis.NewScript(1, `-- KEYS: [QueueName]
     -- first get what is the active queue
 	local result = redis.call("zrange", KEYS[1] .. ":active", 0, 0, "WITHSCORES")
@@ -3,6 +3,7 @@ package queue
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
@@ -75,3 +76,69 @@ func TestQueues(t *testing.T) {
 		assert.Equal(t, tc.Size, size, "%d: mismatch", i)
 	}
 }
+
+func TestScheduledTasks(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", scheduledKey)
+
+	now := time.Now()
+
+	err = ScheduleTask(rc, "test", "campaign", 1, "task1", DefaultPriority, now.Add(time.Minute))
+	assert.NoError(t, err)
+	err = ScheduleTask(rc, "test", "campaign", 1, "task2", DefaultPriority, now.Add(time.Minute*2))
+	assert.NoError(t, err)
+
+	// nothing is due yet
+	queued, err := QueueScheduledTasks(rc, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queued)
+
+	size, err := Size(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, size)
+
+	// first task becomes due
+	queued, err = QueueScheduledTasks(rc, now.Add(time.Second*90))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	task, err := PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, `"task1"`, string(task.Task))
+
+	// and then the second
+	queued, err = QueueScheduledTasks(rc, now.Add(time.Minute*3))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	task, err = PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, `"task2"`, string(task.Task))
+
+	// nothing left scheduled and queuing again doesn't queue anything twice
+	count, err := redis.Int(rc.Do("zcard", scheduledKey))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	queued, err = QueueScheduledTasks(rc, now.Add(time.Minute*3))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queued)
+
+	// scheduled tasks which can't be read are removed
+	rc.Do("zadd", scheduledKey, now.Unix(), "xxx")
+
+	_, err = QueueScheduledTasks(rc, now.Add(time.Minute*3))
+	assert.EqualError(t, err, "error unmarshalling scheduled task: xxx: invalid character 'x' looking for beginning of value")
+
+	count, err = redis.Int(rc.Do("zcard", scheduledKey))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestPacedDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), PacedDelay(0, 100, 1000))
+	assert.Equal(t, time.Duration(0), PacedDelay(5, 100, 0))
+	assert.Equal(t, time.Second*6, PacedDelay(1, 100, 1000))
+	assert.Equal(t, time.Minute*2, PacedDelay(2, 50, 50))
+}
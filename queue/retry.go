@@ -0,0 +1,192 @@
+package queue
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	deadLetterKey  = "dead_tasks"
+	deadLetterSize = 10000
+)
+
+// RetryPolicy describes how tasks of a type which fail are retried
+type RetryPolicy struct {
+	// the total number of attempts including the first, so 1 means a failed task is never retried
+	MaxAttempts int
+
+	// the delay before the first retry, which is multiplied by Multiplier for each subsequent retry up to MaxBackoff
+	Backoff    time.Duration
+	Multiplier float64
+	MaxBackoff time.Duration
+
+	// the fraction of each delay that is randomly added or removed, so that tasks which failed together don't all
+	// retry together, e.g. 0.2 means a 60 second delay could be anywhere from 48 to 72 seconds
+	Jitter float64
+
+	// whether tasks which exhaust their attempts are kept in the dead letter list rather than dropped
+	DeadLetter bool
+}
+
+// DefaultRetryPolicy is the policy for task types which don't register their own, such tasks are never retried
+var DefaultRetryPolicy = &RetryPolicy{MaxAttempts: 1}
+
+var retryPolicies = make(map[string]*RetryPolicy)
+
+// RegisterRetryPolicy registers the retry policy for the passed in task type
+func RegisterRetryPolicy(taskType string, policy *RetryPolicy) {
+	retryPolicies[taskType] = policy
+}
+
+// RetryPolicyFor returns the retry policy for the passed in task type
+func RetryPolicyFor(taskType string) *RetryPolicy {
+	policy, found := retryPolicies[taskType]
+	if !found {
+		return DefaultRetryPolicy
+	}
+	return policy
+}
+
+// Delay returns how long to wait before the passed in retry, where 1 is the first retry
+func (p *RetryPolicy) Delay(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.Backoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// DeadTask is a task which failed and exhausted its retries
+type DeadTask struct {
+	ID       string    `json:"-"`
+	Queue    string    `json:"queue"`
+	Task     *Task     `json:"task"`
+	Error    string    `json:"error"`
+	FailedOn time.Time `json:"failed_on"`
+}
+
+// RetryTask handles the failure of the passed in task from the passed in queue. If its retry policy allows another
+// attempt then it's scheduled to be queued again with its original priority after the policy's delay. Otherwise it's added to the dead letter
+// list if the policy requires. Returns whether the task will be retried.
+func RetryTask(rc redis.Conn, queue string, task *Task, taskErr error) (bool, error) {
+	policy := RetryPolicyFor(task.Type)
+
+	task.ErrorCount++
+
+	if task.ErrorCount < policy.MaxAttempts {
+		queueOn := time.Now().Add(policy.Delay(task.ErrorCount))
+
+		jsonScheduled, err := json.Marshal(&scheduledTask{Queue: queue, Priority: task.Priority, Task: task})
+		if err != nil {
+			return false, err
+		}
+
+		_, err = rc.Do("zadd", scheduledKey, queueOn.Unix(), jsonScheduled)
+		if err != nil {
+			return false, errors.Wrapf(err, "error scheduling retry of %s task", task.Type)
+		}
+		return true, nil
+	}
+
+	if policy.DeadLetter {
+		jsonDead, err := json.Marshal(&DeadTask{Queue: queue, Task: task, Error: taskErr.Error(), FailedOn: time.Now()})
+		if err != nil {
+			return false, err
+		}
+
+		rc.Send("lpush", deadLetterKey, jsonDead)
+		rc.Send("ltrim", deadLetterKey, 0, deadLetterSize-1)
+		_, err = rc.Do("")
+		if err != nil {
+			return false, errors.Wrapf(err, "error adding %s task to dead letters", task.Type)
+		}
+	}
+
+	return false, nil
+}
+
+// CountDeadTasks returns the number of tasks in the dead letter list
+func CountDeadTasks(rc redis.Conn) (int, error) {
+	count, err := redis.Int(rc.Do("llen", deadLetterKey))
+	return count, errors.Wrapf(err, "error counting dead tasks")
+}
+
+// ReadDeadTasks returns up to the passed in number of the most recent tasks in the dead letter list
+func ReadDeadTasks(rc redis.Conn, count int) ([]*DeadTask, error) {
+	values, err := redis.Strings(rc.Do("lrange", deadLetterKey, 0, count-1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading dead tasks")
+	}
+
+	dead := make([]*DeadTask, 0, len(values))
+	for _, v := range values {
+		d := &DeadTask{}
+		if err := json.Unmarshal([]byte(v), d); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling dead task: %s", v)
+		}
+		d.ID = deadTaskID(v)
+		dead = append(dead, d)
+	}
+	return dead, nil
+}
+
+// RequeueDeadTask removes the task with the passed in id from the dead letter list and queues it again with its error
+// count reset. Returns false if there is no such task, e.g. it was already requeued.
+func RequeueDeadTask(rc redis.Conn, id string) (bool, error) {
+	values, err := redis.Strings(rc.Do("lrange", deadLetterKey, 0, -1))
+	if err != nil {
+		return false, errors.Wrapf(err, "error reading dead tasks")
+	}
+
+	for _, v := range values {
+		if deadTaskID(v) != id {
+			continue
+		}
+
+		// remove it first, if someone else already removed it then they are the ones who will requeue it
+		removed, err := redis.Int(rc.Do("lrem", deadLetterKey, 1, v))
+		if err != nil {
+			return false, errors.Wrapf(err, "error removing dead task")
+		}
+		if removed == 0 {
+			return false, nil
+		}
+
+		d := &DeadTask{}
+		if err := json.Unmarshal([]byte(v), d); err != nil {
+			return false, errors.Wrapf(err, "error unmarshalling dead task: %s", v)
+		}
+
+		d.Task.ErrorCount = 0
+		d.Task.QueuedOn = time.Now()
+		if err := addTask(rc, d.Queue, d.Task, DefaultPriority); err != nil {
+			return false, errors.Wrapf(err, "error requeuing dead %s task", d.Task.Type)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// dead tasks are identified by a hash of their JSON as they have no ids of their own
+func deadTaskID(value string) string {
+	hash := sha1.Sum([]byte(value))
+	return hex.EncodeToString(hash[:8])
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5, Backoff: time.Second * 30, Multiplier: 2, MaxBackoff: time.Minute * 2}
+
+	assert.Equal(t, time.Second*30, policy.Delay(1))
+	assert.Equal(t, time.Second*60, policy.Delay(2))
+	assert.Equal(t, time.Second*120, policy.Delay(3))
+	assert.Equal(t, time.Second*120, policy.Delay(4))
+
+	// jitter keeps delays within the fraction either side
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(1)
+		assert.True(t, delay >= time.Second*24 && delay <= time.Second*36, "delay %s out of range", delay)
+	}
+
+	// no multiplier means constant backoff
+	policy = &RetryPolicy{MaxAttempts: 3, Backoff: time.Second * 10}
+	assert.Equal(t, time.Second*10, policy.Delay(3))
+}
+
+func TestRetryTask(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	require.NoError(t, err)
+	rc.Do("del", scheduledKey, deadLetterKey, "test:active", "test:1", "test:2")
+
+	RegisterRetryPolicy("test_retried", &RetryPolicy{MaxAttempts: 2, Backoff: time.Minute, DeadLetter: true})
+	defer delete(retryPolicies, "test_retried")
+
+	// task types without a policy aren't retried or dead lettered
+	task, _ := newTask("test_unretried", 1, "task1")
+	retrying, err := RetryTask(rc, "test", task, errors.New("boom"))
+	assert.NoError(t, err)
+	assert.False(t, retrying)
+	assertZCount(t, rc, scheduledKey, 0)
+
+	// first failure is scheduled for a retry
+	task, _ = newTask("test_retried", 1, "task2")
+	require.NoError(t, addTask(rc, "test", task, HighPriority))
+	task, err = PopNextTask(rc, "test")
+	require.NoError(t, err)
+
+	retrying, err = RetryTask(rc, "test", task, errors.New("boom"))
+	assert.NoError(t, err)
+	assert.True(t, retrying)
+	assert.Equal(t, 1, task.ErrorCount)
+	assertZCount(t, rc, scheduledKey, 1)
+
+	// not due yet
+	queued, err := QueueScheduledTasks(rc, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queued)
+
+	queued, err = QueueScheduledTasks(rc, time.Now().Add(time.Minute*2))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	retried, err := PopNextTask(rc, "test")
+	require.NoError(t, err)
+	require.NotNil(t, retried)
+	assert.Equal(t, "test_retried", retried.Type)
+	assert.Equal(t, 1, retried.ErrorCount)
+	assert.Equal(t, HighPriority, retried.Priority)
+
+	// second failure exhausts its attempts and is dead lettered
+	retrying, err = RetryTask(rc, "test", retried, errors.New("boom again"))
+	assert.NoError(t, err)
+	assert.False(t, retrying)
+	assertZCount(t, rc, scheduledKey, 0)
+
+	dead, err := redis.Strings(rc.Do("lrange", deadLetterKey, 0, -1))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(dead))
+
+	deadTask := &DeadTask{}
+	require.NoError(t, json.Unmarshal([]byte(dead[0]), deadTask))
+	assert.Equal(t, "test", deadTask.Queue)
+	assert.Equal(t, "boom again", deadTask.Error)
+	assert.Equal(t, 2, deadTask.Task.ErrorCount)
+
+	count, err := CountDeadTasks(rc)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	deadTasks, err := ReadDeadTasks(rc, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(deadTasks))
+	assert.Equal(t, "boom again", deadTasks[0].Error)
+	assert.Equal(t, 16, len(deadTasks[0].ID))
+
+	// dead tasks can be requeued once
+	requeued, err := RequeueDeadTask(rc, "0123456789abcdef")
+	require.NoError(t, err)
+	assert.False(t, requeued)
+
+	requeued, err = RequeueDeadTask(rc, deadTasks[0].ID)
+	require.NoError(t, err)
+	assert.True(t, requeued)
+
+	requeued, err = RequeueDeadTask(rc, deadTasks[0].ID)
+	require.NoError(t, err)
+	assert.False(t, requeued)
+
+	count, err = CountDeadTasks(rc)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	retried, err = PopNextTask(rc, "test")
+	require.NoError(t, err)
+	require.NotNil(t, retried)
+	assert.Equal(t, "test_retried", retried.Type)
+	assert.Equal(t, 0, retried.ErrorCount)
+}
+
+func assertZCount(t *testing.T, rc redis.Conn, key string, expected int) {
+	count, err := redis.Int(rc.Do("zcard", key))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, count)
+}
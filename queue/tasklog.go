@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TaskLogEntry is a line in the task log, one is written for every task added to a queue and every event added to a
+// contact's queue by AddContactEvent. Tasks to handle contact events aren't logged as replaying their events queues them.
+//
+//   {
+//     "id": "3d4e5a2b-8f2a-4d1f-8a4c-6e0b5f8d9c7a",
+//     "queue": "batch",
+//     "type": "start_flow",
+//     "org_id": 1,
+//     "priority": 0,
+//     "queued_on": "2020-04-15T12:00:00.123456Z",
+//     "logged_on": "2020-04-15T12:00:00.123789Z",
+//     "task": {"flow_id": 123, "contact_ids": [1234]}
+//   }
+//
+// Entries for contact events have the id of the contact instead of a queue and priority.
+type TaskLogEntry struct {
+	ID        string          `json:"id"`
+	Queue     string          `json:"queue,omitempty"`
+	ContactID int64           `json:"contact_id,omitempty"`
+	Type      string          `json:"type"`
+	OrgID     int             `json:"org_id"`
+	Priority  Priority        `json:"priority"`
+	QueuedOn  time.Time       `json:"queued_on"`
+	LoggedOn  time.Time       `json:"logged_on"`
+	Task      json.RawMessage `json:"task"`
+}
+
+// how many entries can be waiting to be written before further entries are dropped
+const taskLogBuffer = 10000
+
+// our task log writer, entries are queued on its channel so that queuing tasks never waits on the log's file
+type taskLogWriter struct {
+	entries chan []byte
+	done    chan struct{}
+}
+
+var taskLog *taskLogWriter
+var taskLogMutex sync.RWMutex
+
+// SetTaskLog sets where entries for queued tasks are written, nil to disable. Entries waiting to be written to the
+// previous log are written before this returns.
+func SetTaskLog(w io.Writer) {
+	taskLogMutex.Lock()
+	defer taskLogMutex.Unlock()
+
+	if taskLog != nil {
+		close(taskLog.entries)
+		<-taskLog.done
+		taskLog = nil
+	}
+
+	if w != nil {
+		taskLog = &taskLogWriter{entries: make(chan []byte, taskLogBuffer), done: make(chan struct{})}
+		go taskLog.write(w)
+	}
+}
+
+func (l *taskLogWriter) write(w io.Writer) {
+	defer close(l.done)
+
+	for line := range l.entries {
+		if _, err := w.Write(line); err != nil {
+			logrus.WithError(err).Error("error writing to task log")
+		}
+	}
+}
+
+// logs the passed in task if we have a task log, failures are logged but don't fail queuing
+func logTask(queue string, payload *Task, priority Priority) {
+	if payload.Type == HandleContactEvent {
+		return
+	}
+
+	writeTaskLog(&TaskLogEntry{
+		ID:       payload.ID,
+		Queue:    queue,
+		Type:     payload.Type,
+		OrgID:    payload.OrgID,
+		Priority: priority,
+		QueuedOn: payload.QueuedOn,
+		LoggedOn: time.Now(),
+		Task:     payload.Task,
+	})
+}
+
+// logs the passed in contact event if we have a task log
+func logContactEvent(contactID int64, event *Task) {
+	writeTaskLog(&TaskLogEntry{
+		ID:        event.ID,
+		ContactID: contactID,
+		Type:      event.Type,
+		OrgID:     event.OrgID,
+		QueuedOn:  event.QueuedOn,
+		LoggedOn:  time.Now(),
+		Task:      event.Task,
+	})
+}
+
+func writeTaskLog(entry *TaskLogEntry) {
+	taskLogMutex.RLock()
+	defer taskLogMutex.RUnlock()
+
+	if taskLog == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logrus.WithError(err).WithField("task_type", entry.Type).Error("error marshalling task log entry")
+		return
+	}
+
+	select {
+	case taskLog.entries <- append(line, '\n'):
+	default:
+		logrus.WithField("task_type", entry.Type).WithField("task_id", entry.ID).Error("task log buffer full, dropping entry")
+	}
+}
+
+// ReadTaskLog reads the entries from the passed in task log for tasks queued in the passed in time window. Tasks
+// queued more than once in the window, e.g. retries, are only returned once.
+func ReadTaskLog(r io.Reader, from time.Time, to time.Time) ([]*TaskLogEntry, error) {
+	entries := make([]*TaskLogEntry, 0)
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		entry := &TaskLogEntry{}
+		err := json.Unmarshal(scanner.Bytes(), entry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading task log entry: %s", scanner.Text())
+		}
+
+		if entry.QueuedOn.Before(from) || !entry.QueuedOn.Before(to) || seen[entry.ID] {
+			continue
+		}
+		seen[entry.ID] = true
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "error reading task log")
+	}
+
+	return entries, nil
+}
+
+// ReplayTasks adds the tasks for the passed in task log entries back to their queues, and the events for contacts back
+// to their contact queues
+func ReplayTasks(rc redis.Conn, entries []*TaskLogEntry) error {
+	for _, e := range entries {
+		payload := &Task{
+			ID:       e.ID,
+			Type:     e.Type,
+			OrgID:    e.OrgID,
+			Task:     e.Task,
+			QueuedOn: time.Now(),
+		}
+
+		var err error
+		if e.ContactID != 0 {
+			err = AddContactEvent(rc, e.ContactID, payload, false)
+		} else {
+			err = addTask(rc, e.Queue, payload, e.Priority)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error replaying %s task for org %d", e.Type, e.OrgID)
+		}
+	}
+	return nil
+}
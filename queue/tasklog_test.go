@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskLog(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	require.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "test:2", "handler:active", "handler:1", "c:1:10")
+
+	log := &bytes.Buffer{}
+	SetTaskLog(log)
+	defer SetTaskLog(nil)
+
+	start := time.Now()
+
+	require.NoError(t, AddTask(rc, "test", "campaign", 1, "task1", DefaultPriority))
+	require.NoError(t, AddTask(rc, "test", "campaign", 2, "task2", HighPriority))
+	require.NoError(t, AddContactEvent(rc, 10, &Task{Type: "msg_event", OrgID: 1, Task: []byte(`{"text":"hi"}`), QueuedOn: time.Now()}, false))
+
+	// a retry of a task is the same task
+	retry, _ := newTask("campaign", 1, "task3")
+	require.NoError(t, addTask(rc, "test", retry, DefaultPriority))
+	require.NoError(t, addTask(rc, "test", retry, DefaultPriority))
+
+	end := time.Now()
+	time.Sleep(time.Millisecond * 10)
+
+	require.NoError(t, AddTask(rc, "test", "campaign", 1, "task4", DefaultPriority))
+
+	// wait for everything to be written
+	SetTaskLog(nil)
+	contents := log.Bytes()
+
+	// read everything, tasks queued twice are only read once and handle tasks aren't logged at all
+	entries, err := ReadTaskLog(bytes.NewReader(contents), start, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 5, len(entries))
+	assert.Equal(t, "test", entries[0].Queue)
+	assert.Equal(t, "campaign", entries[0].Type)
+	assert.Equal(t, 1, entries[0].OrgID)
+	assert.Equal(t, `"task1"`, string(entries[0].Task))
+	assert.Equal(t, 2, entries[1].OrgID)
+	assert.Equal(t, HighPriority, entries[1].Priority)
+	assert.NotEqual(t, entries[0].ID, entries[1].ID)
+	assert.Equal(t, int64(10), entries[2].ContactID)
+	assert.Equal(t, "msg_event", entries[2].Type)
+	assert.Equal(t, retry.ID, entries[3].ID)
+
+	// read just the first window
+	entries, err = ReadTaskLog(bytes.NewReader(contents), start, end)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(entries))
+
+	// simulate losing our queues and replay that window
+	rc.Do("del", "test:active", "test:1", "test:2", "handler:active", "handler:1", "c:1:10")
+
+	err = ReplayTasks(rc, entries)
+	require.NoError(t, err)
+
+	size, err := Size(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, size)
+
+	// the contact event is back on its contact queue with a task to handle it
+	events, err := redis.Int(rc.Do("llen", "c:1:10"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, events)
+
+	size, err = Size(rc, HandlerQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, size)
+
+	// invalid log lines are an error
+	_, err = ReadTaskLog(bytes.NewReader([]byte("xyz\n")), start, end)
+	assert.Error(t, err)
+
+	rc.Do("del", "test:active", "test:1", "test:2", "handler:active", "handler:1", "c:1:10")
+}
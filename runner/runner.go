@@ -11,6 +11,7 @@ import (
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/librato"
+	"github.com/nyaruka/mailroom/config"
 	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/locker"
 	"github.com/nyaruka/mailroom/models"
@@ -50,6 +51,9 @@ type StartOptions struct {
 
 	// TriggerBuilder is the builder that will be used to build a trigger for each contact started in the flow
 	TriggerBuilder TriggerBuilder
+
+	// SuppressionWindow is how long after being started in this flow contacts should be skipped by other starts, 0 to never skip
+	SuppressionWindow time.Duration
 }
 
 // TriggerBuilder defines the interface for building a trigger for the passed in contact
@@ -60,7 +64,7 @@ func ResumeFlow(ctx context.Context, db *sqlx.DB, rp *redis.Pool, org *models.Or
 	start := time.Now()
 
 	// does the flow this session is part of still exist?
-	flow, err := org.FlowByID(session.CurrentFlowID())
+	flow, err := org.SessionFlowByID(session.CurrentFlowID())
 	if err != nil {
 		// if this flow just isn't available anymore, log this error
 		if err == models.ErrNotFound {
@@ -70,6 +74,14 @@ func ResumeFlow(ctx context.Context, db *sqlx.DB, rp *redis.Pool, org *models.Or
 		return nil, errors.Wrapf(err, "error loading session flow: %d", session.CurrentFlowID())
 	}
 
+	// sessions being left to finish in a soft deleted flow need assets which can still load that flow
+	if !flow.IsActive() {
+		sa, err = models.ResumeSessionAssets(org, flow)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating session assets for resume")
+		}
+	}
+
 	// validate our flow
 	err = validateFlow(sa, flow.UUID())
 	if err != nil {
@@ -213,6 +225,11 @@ func StartFlowBatch(
 	options.TriggerBuilder = triggerBuilder
 	options.CommitHook = updateStartID
 
+	// starts by other flows are part of those flows so aren't collapsed like API and scheduled starts
+	if batch.ParentSummary() == nil {
+		options.SuppressionWindow = time.Second * time.Duration(config.Mailroom.StartSuppressionWindow)
+	}
+
 	sessions, err := StartFlow(ctx, db, rp, org, flow, batch.ContactIDs(), options)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error starting flow batch")
@@ -424,6 +441,38 @@ func StartFlow(
 		}
 	}
 
+	// contacts which have been started, which we only track for releasing duplicate start claims
+	started := make(map[models.ContactID]bool)
+
+	// filter out anybody who was started in this flow by another start within our suppression window
+	if options.SuppressionWindow > 0 && len(includedContacts) > 0 {
+		rc := rp.Get()
+		allowed, err := SuppressDuplicateStarts(rc, org.OrgID(), flow.ID(), includedContacts, options.SuppressionWindow)
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error suppressing duplicate starts for flow: %d", flow.ID())
+		}
+		includedContacts = allowed
+
+		// release the claims of any contacts we don't end up starting, e.g. because of an error, so that retries of
+		// this start don't skip them
+		defer func() {
+			unstarted := make([]models.ContactID, 0)
+			for _, c := range allowed {
+				if !started[c] {
+					unstarted = append(unstarted, c)
+				}
+			}
+
+			rc := rp.Get()
+			defer rc.Close()
+
+			if err := ReleaseDuplicateStarts(rc, org.OrgID(), flow.ID(), unstarted); err != nil {
+				logrus.WithError(err).WithField("flow_id", flow.ID()).Error("error releasing duplicate start claims")
+			}
+		}()
+	}
+
 	// no contacts left? we are done
 	if len(includedContacts) == 0 {
 		return nil, nil
@@ -506,6 +555,7 @@ func StartFlow(
 		// append all the sessions that were started
 		for _, s := range ss {
 			sessions = append(sessions, s)
+			started[s.ContactID()] = true
 		}
 
 		// release all our locks
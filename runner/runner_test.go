@@ -10,6 +10,7 @@ import (
 	"github.com/nyaruka/goflow/flows/resumes"
 	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/config"
 	_ "github.com/nyaruka/mailroom/hooks"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/testsuite"
@@ -178,6 +179,60 @@ func TestBatchStart(t *testing.T) {
 	}
 }
 
+func TestSuppressDuplicateStarts(t *testing.T) {
+	testsuite.Reset()
+	db := testsuite.DB()
+	ctx := testsuite.CTX()
+	rp := testsuite.RP()
+	rc := testsuite.RC()
+	defer rc.Close()
+
+	// no window means no suppression
+	allowed, err := SuppressDuplicateStarts(rc, models.Org1, models.SingleMessageFlowID, []models.ContactID{models.CathyID}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{models.CathyID}, allowed)
+
+	allowed, err = SuppressDuplicateStarts(rc, models.Org1, models.SingleMessageFlowID, []models.ContactID{models.CathyID}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{models.CathyID}, allowed)
+
+	// cathy has now been started in this flow so is suppressed, but not in other flows
+	allowed, err = SuppressDuplicateStarts(rc, models.Org1, models.SingleMessageFlowID, []models.ContactID{models.CathyID, models.BobID}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{models.BobID}, allowed)
+
+	allowed, err = SuppressDuplicateStarts(rc, models.Org1, models.FavoritesFlowID, []models.ContactID{models.CathyID}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{models.CathyID}, allowed)
+
+	// releasing the claim on a contact which wasn't started after all lets them be started again
+	err = ReleaseDuplicateStarts(rc, models.Org1, models.SingleMessageFlowID, []models.ContactID{models.CathyID})
+	assert.NoError(t, err)
+
+	allowed, err = SuppressDuplicateStarts(rc, models.Org1, models.SingleMessageFlowID, []models.ContactID{models.CathyID, models.BobID}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{models.CathyID}, allowed)
+
+	// batch starts are suppressed when the window is configured
+	config.Mailroom.StartSuppressionWindow = 60
+	defer func() { config.Mailroom.StartSuppressionWindow = 0 }()
+
+	contactIDs := []models.ContactID{models.CathyID, models.BobID, models.GeorgeID}
+	start := models.NewFlowStart(models.Org1, models.MessagingFlow, models.SingleMessageFlowID, true, true).WithContactIDs(contactIDs)
+	batch := start.CreateBatch(contactIDs)
+	batch.SetIsLast(true)
+
+	sessions, err := StartFlowBatch(ctx, db, rp, batch)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(sessions))
+	assert.Equal(t, models.GeorgeID, sessions[0].ContactID())
+
+	// and a retry of the same start is collapsed entirely
+	sessions, err = StartFlowBatch(ctx, db, rp, batch)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(sessions))
+}
+
 func TestContactRuns(t *testing.T) {
 	testsuite.Reset()
 	db := testsuite.DB()
@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+)
+
+const startSuppressionKeyPattern = "start_suppress:%d:%d:%d"
+
+// SuppressDuplicateStarts returns which of the passed in contacts haven't been started in the passed in flow within
+// the passed in window, recording that they have been so that repeated starts within the window are collapsed. This
+// stops double texted keywords or retried API calls from starting contacts twice. Claims are made before contacts are
+// started so that concurrent starts are collapsed too, so callers must release the claims of any contacts which they
+// then fail to start, otherwise retries of the start would skip them.
+func SuppressDuplicateStarts(rc redis.Conn, orgID models.OrgID, flowID models.FlowID, contactIDs []models.ContactID, window time.Duration) ([]models.ContactID, error) {
+	if window <= 0 || len(contactIDs) == 0 {
+		return contactIDs, nil
+	}
+
+	// try to claim a key for each contact, pipelining so that large batches only need one round trip
+	for _, contactID := range contactIDs {
+		key := fmt.Sprintf(startSuppressionKeyPattern, orgID, flowID, contactID)
+		rc.Send("set", key, "1", "ex", int(window/time.Second), "nx")
+	}
+	if err := rc.Flush(); err != nil {
+		return nil, errors.Wrapf(err, "error checking for duplicate starts")
+	}
+
+	allowed := make([]models.ContactID, 0, len(contactIDs))
+	for _, contactID := range contactIDs {
+		set, err := redis.String(rc.Receive())
+		if err != nil && err != redis.ErrNil {
+			return nil, errors.Wrapf(err, "error checking for duplicate starts")
+		}
+
+		// only contacts whose keys didn't already exist are started
+		if set == "OK" {
+			allowed = append(allowed, contactID)
+		}
+	}
+
+	return allowed, nil
+}
+
+// ReleaseDuplicateStarts releases the claims made by SuppressDuplicateStarts for the passed in contacts, which weren't
+// started after all
+func ReleaseDuplicateStarts(rc redis.Conn, orgID models.OrgID, flowID models.FlowID, contactIDs []models.ContactID) error {
+	if len(contactIDs) == 0 {
+		return nil
+	}
+
+	keys := make([]interface{}, len(contactIDs))
+	for i, contactID := range contactIDs {
+		keys[i] = fmt.Sprintf(startSuppressionKeyPattern, orgID, flowID, contactID)
+	}
+
+	_, err := rc.Do("del", keys...)
+	return errors.Wrapf(err, "error releasing duplicate start claims")
+}
@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// the key of the advisory lock held while migrating so that instances starting together don't race to create tables
+const migrateLockKey = 72617670
+
+// SQL creates the tables which mailroom owns. RapidPro manages the rest of the database but doesn't know about these,
+// so they're created by mailroom when it starts if they don't exist.
+const SQL = `
+CREATE TABLE IF NOT EXISTS payments_transfer (
+    id serial PRIMARY KEY,
+    uuid uuid NOT NULL UNIQUE,
+    org_id integer NOT NULL REFERENCES orgs_org(id),
+    contact_id integer NOT NULL REFERENCES contacts_contact(id),
+    idempotency_key character varying(32) NOT NULL,
+    transfer jsonb NOT NULL,
+    created_on timestamp with time zone NOT NULL,
+    UNIQUE (org_id, idempotency_key)
+);
+CREATE INDEX IF NOT EXISTS payments_transfer_contact_id ON payments_transfer(org_id, contact_id, created_on DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS orgs_orgusagecount (
+    id bigserial PRIMARY KEY,
+    org_id integer NOT NULL REFERENCES orgs_org(id),
+    period character varying(7) NOT NULL,
+    counter character varying(32) NOT NULL,
+    count bigint NOT NULL,
+    is_squashed boolean NOT NULL
+);
+CREATE INDEX IF NOT EXISTS orgs_orgusagecount_org_period ON orgs_orgusagecount(org_id, period, counter);
+CREATE INDEX IF NOT EXISTS orgs_orgusagecount_unsquashed ON orgs_orgusagecount(org_id, period, counter) WHERE NOT is_squashed;
+
+CREATE TABLE IF NOT EXISTS flows_flowsplitcount (
+    id bigserial PRIMARY KEY,
+    flow_id integer NOT NULL REFERENCES flows_flow(id),
+    node_uuid uuid NOT NULL,
+    category_uuid uuid NOT NULL,
+    counter character varying(16) NOT NULL,
+    count bigint NOT NULL,
+    is_squashed boolean NOT NULL
+);
+CREATE INDEX IF NOT EXISTS flows_flowsplitcount_flow ON flows_flowsplitcount(flow_id, node_uuid, category_uuid, counter);
+CREATE INDEX IF NOT EXISTS flows_flowsplitcount_unsquashed ON flows_flowsplitcount(flow_id, node_uuid, category_uuid, counter) WHERE NOT is_squashed;
+`
+
+// Migrate creates the tables which mailroom owns if they don't exist
+func Migrate(ctx context.Context, db *sqlx.DB) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error starting transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrateLockKey); err != nil {
+		return errors.Wrapf(err, "error locking schema")
+	}
+	if _, err := tx.ExecContext(ctx, SQL); err != nil {
+		return errors.Wrapf(err, "error creating tables")
+	}
+
+	return errors.Wrapf(tx.Commit(), "error committing schema")
+}
@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/antlr/antlr4/runtime/Go/antlr"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/contactql/gen"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/utils/dates"
 	"github.com/olivere/elastic"
@@ -18,11 +21,93 @@ import (
 func ParseQuery(env envs.Environment, resolver contactql.FieldResolverFunc, query string) (*contactql.ContactQuery, error) {
 	parsed, err := contactql.ParseQuery(query, env.RedactionPolicy(), resolver)
 	if err != nil {
-		return nil, NewError(err.Error())
+		e := NewError(err.Error())
+		e.start, e.end = errorOffsets(env, resolver, query)
+		return nil, e
 	}
 	return parsed, nil
 }
 
+// locates the part of the passed in query which failed to parse using the positions of its tokens, returning its start
+// and end as character offsets, or -1s if it can't be found. For syntax errors that's the offending token, and for
+// conditions that's either the property key if it can't be resolved or the whole condition if it's otherwise invalid.
+func errorOffsets(env envs.Environment, resolver contactql.FieldResolverFunc, query string) (int, int) {
+	lexer := gen.NewContactQLLexer(antlr.NewInputStream(query))
+	parser := gen.NewContactQLParser(antlr.NewCommonTokenStream(lexer, 0))
+	syntaxErrors := &syntaxErrorListener{DefaultErrorListener: antlr.NewDefaultErrorListener()}
+	parser.RemoveErrorListeners()
+	parser.AddErrorListener(syntaxErrors)
+	tree := parser.Parse()
+
+	if token := syntaxErrors.offending; token != nil {
+		if token.GetTokenType() == antlr.TokenEOF {
+			end := utf8.RuneCountInString(query)
+			return end, end
+		}
+		return token.GetStart(), token.GetStop() + 1
+	}
+
+	// otherwise find the first condition which isn't valid by itself
+	conditions := &invalidConditionFinder{env: env, resolver: resolver, query: []rune(query), start: -1, end: -1}
+	antlr.ParseTreeWalkerDefault.Walk(conditions, tree)
+	return conditions.start, conditions.end
+}
+
+// records the token which caused the first syntax error
+type syntaxErrorListener struct {
+	*antlr.DefaultErrorListener
+
+	offending antlr.Token
+}
+
+func (l *syntaxErrorListener) SyntaxError(recognizer antlr.Recognizer, offendingSymbol interface{}, line, column int, msg string, e antlr.RecognitionException) {
+	if l.offending == nil {
+		l.offending, _ = offendingSymbol.(antlr.Token)
+	}
+}
+
+// finds the first condition in a query which fails to parse when it's parsed by itself
+type invalidConditionFinder struct {
+	*gen.BaseContactQLListener
+
+	env      envs.Environment
+	resolver contactql.FieldResolverFunc
+	query    []rune
+	start    int
+	end      int
+}
+
+func (f *invalidConditionFinder) EnterCondition(ctx *gen.ConditionContext) {
+	if f.start >= 0 || f.isValid(f.text(ctx.GetStart(), ctx.GetStop())) {
+		return
+	}
+
+	// if the property can't be used in a condition which is always valid, then the property is the problem
+	key := ctx.TEXT().GetSymbol()
+	if !f.isValid(f.text(key, key) + ` = ""`) {
+		f.start, f.end = key.GetStart(), key.GetStop()+1
+	} else {
+		f.start, f.end = ctx.GetStart().GetStart(), ctx.GetStop().GetStop()+1
+	}
+}
+
+func (f *invalidConditionFinder) EnterImplicitCondition(ctx *gen.ImplicitConditionContext) {
+	if f.start >= 0 || f.isValid(f.text(ctx.GetStart(), ctx.GetStop())) {
+		return
+	}
+	f.start, f.end = ctx.GetStart().GetStart(), ctx.GetStop().GetStop()+1
+}
+
+// returns the text of the query between the passed in tokens
+func (f *invalidConditionFinder) text(start antlr.Token, stop antlr.Token) string {
+	return string(f.query[start.GetStart() : stop.GetStop()+1])
+}
+
+func (f *invalidConditionFinder) isValid(condition string) bool {
+	_, err := contactql.ParseQuery(condition, f.env.RedactionPolicy(), f.resolver)
+	return err == nil
+}
+
 // ToElasticQuery converts a contactql query to an Elastic query returning the normalized view as well as the elastic query
 func ToElasticQuery(env envs.Environment, resolver contactql.FieldResolverFunc, query *contactql.ContactQuery) (elastic.Query, error) {
 	eq, err := nodeToElasticQuery(env, resolver, query.Root())
@@ -35,37 +120,79 @@ func ToElasticQuery(env envs.Environment, resolver contactql.FieldResolverFunc,
 
 // FieldDependencies returns all the field this query is dependent on. This includes attributes such as "id" and "name"
 func FieldDependencies(query *contactql.ContactQuery) []string {
+	seen := make(map[string]bool)
+	for _, c := range queryConditions(query) {
+		seen[c.PropertyKey()] = true
+	}
+	return sortedKeys(seen)
+}
+
+// QueryMetadata is what a parsed query refers to, split into contact attributes, URN schemes and custom fields
+type QueryMetadata struct {
+	Attributes []string `json:"attributes"`
+	Schemes    []string `json:"schemes"`
+	Fields     []string `json:"fields"`
+}
+
+// ParseQueryMetadata returns the attributes, URN schemes and custom fields the passed in query refers to
+func ParseQueryMetadata(query *contactql.ContactQuery) *QueryMetadata {
+	attributes := make(map[string]bool)
+	schemes := make(map[string]bool)
+	fields := make(map[string]bool)
+
+	for _, c := range queryConditions(query) {
+		switch c.PropertyType() {
+		case contactql.PropertyTypeAttribute:
+			attributes[c.PropertyKey()] = true
+		case contactql.PropertyTypeScheme:
+			schemes[c.PropertyKey()] = true
+		case contactql.PropertyTypeField:
+			fields[c.PropertyKey()] = true
+		}
+	}
+
+	return &QueryMetadata{
+		Attributes: sortedKeys(attributes),
+		Schemes:    sortedKeys(schemes),
+		Fields:     sortedKeys(fields),
+	}
+}
+
+// returns all the conditions in the passed in query
+func queryConditions(query *contactql.ContactQuery) []*contactql.Condition {
+	conditions := make([]*contactql.Condition, 0)
 	if query == nil {
-		return []string{}
+		return conditions
 	}
 
-	seen := make(map[string]bool)
-	var appendFields func(node contactql.QueryNode, seen map[string]bool)
-	appendFields = func(node contactql.QueryNode, seen map[string]bool) {
+	var appendConditions func(node contactql.QueryNode)
+	appendConditions = func(node contactql.QueryNode) {
 		switch n := node.(type) {
 		case *contactql.BoolCombination:
 			for _, c := range n.Children() {
-				appendFields(c, seen)
+				appendConditions(c)
 			}
 
 		case *contactql.Condition:
-			seen[n.PropertyKey()] = true
+			conditions = append(conditions, n)
 
 		default:
 			panic(fmt.Sprintf("unknown type in contactql query: %v", n))
 		}
 	}
 
-	appendFields(query.Root(), seen)
-	fields := make([]string, 0, len(seen))
-	for k := range seen {
-		fields = append(fields, k)
-	}
-
-	// order to make deterministic
-	sort.Strings(fields)
+	appendConditions(query.Root())
+	return conditions
+}
 
-	return fields
+// returns the keys of the passed in set, ordered to make deterministic
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // ToElasticFieldSort returns the FieldSort for the passed in field
@@ -343,12 +470,19 @@ func conditionToElasticQuery(env envs.Environment, resolver contactql.FieldResol
 // Error is used when an error is in the parsing of a field or query format
 type Error struct {
 	error string
+	start int
+	end   int
 }
 
 func (e *Error) Error() string {
 	return e.error
 }
 
+// Offsets returns the start and end character offsets in the query of what caused this error, or -1s if unknown
+func (e *Error) Offsets() (int, int) {
+	return e.start, e.end
+}
+
 func NewError(err string, args ...interface{}) *Error {
-	return &Error{fmt.Sprintf(err, args...)}
+	return &Error{error: fmt.Sprintf(err, args...), start: -1, end: -1}
 }
@@ -108,6 +108,57 @@ func TestQueryTerms(t *testing.T) {
 
 }
 
+func TestParseQueryMetadata(t *testing.T) {
+	resolver := buildResolver()
+	env := envs.NewBuilder().Build()
+
+	parsed, err := ParseQuery(env, resolver, `name = joe or AGE > 10 and tel = "+250788382382" and language = eng`)
+	assert.NoError(t, err)
+
+	assert.Equal(t, &QueryMetadata{
+		Attributes: []string{"language", "name"},
+		Schemes:    []string{"tel"},
+		Fields:     []string{"age"},
+	}, ParseQueryMetadata(parsed))
+
+	assert.Equal(t, &QueryMetadata{Attributes: []string{}, Schemes: []string{}, Fields: []string{}}, ParseQueryMetadata(nil))
+}
+
+func TestErrorOffsets(t *testing.T) {
+	env := envs.NewBuilder().Build()
+	resolver := buildResolver()
+
+	tcs := []struct {
+		Query string
+		Start int
+		End   int
+	}{
+		{"birthday = tomorrow", 0, 8},
+		{"age > 10 AND Birthday = tomorrow", 13, 21},
+		{"name = \"José\" AND xyz = 1", 18, 21},
+		{"name = xyz AND xyz = 1", 15, 18},
+		{"age > 10 AND name ~ \"a\"", 13, 23},
+		{"color > 10", 0, 10},
+		{"age >", 5, 5},
+		{"age > 10 )", 9, 10},
+		{"age > 10", -1, -1},
+	}
+
+	for _, tc := range tcs {
+		start, end := errorOffsets(env, resolver, tc.Query)
+		assert.Equal(t, tc.Start, start, "start mismatch for query: %s", tc.Query)
+		assert.Equal(t, tc.End, end, "end mismatch for query: %s", tc.Query)
+	}
+
+	// errors from parsing have offsets
+	_, err := ParseQuery(envs.NewBuilder().Build(), buildResolver(), "age > 10 AND xyz = 1")
+	assert.Error(t, err)
+
+	start, end := err.(*Error).Offsets()
+	assert.Equal(t, 13, start)
+	assert.Equal(t, 16, end)
+}
+
 func TestElasticQuery(t *testing.T) {
 	resolver := buildResolver()
 
@@ -0,0 +1,91 @@
+package anonymize
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/locker"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.AddTaskFunction(queue.AnonymizeContacts, handleAnonymizeContacts)
+}
+
+// AnonymizeContactsTask is our task for anonymizing contacts, e.g. to honor a deletion request
+//
+//   {
+//     "contact_ids": [12345, 23456]
+//   }
+//
+type AnonymizeContactsTask struct {
+	ContactIDs []models.ContactID `json:"contact_ids"`
+}
+
+// handleAnonymizeContacts anonymizes the contacts in the passed in task
+func handleAnonymizeContacts(ctx context.Context, mr *mailroom.Mailroom, task *queue.Task) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*10)
+	defer cancel()
+
+	if task.Type != queue.AnonymizeContacts {
+		return errors.Errorf("unknown event type passed to anonymize worker: %s", task.Type)
+	}
+	anonTask := &AnonymizeContactsTask{}
+	err := json.Unmarshal(task.Task, anonTask)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshalling anonymize task: %s", string(task.Task))
+	}
+
+	orgID := models.OrgID(task.OrgID)
+
+	// lock our contacts so no session can write anything back to them while we anonymize them
+	for _, contactID := range anonTask.ContactIDs {
+		lockID := models.ContactLock(orgID, contactID)
+		lock, err := locker.GrabLock(mr.RP, lockID, time.Minute*10, time.Minute)
+		if err != nil {
+			return errors.Wrapf(err, "error acquiring lock for contact %d", contactID)
+		}
+		if lock == "" {
+			return errors.Errorf("unable to acquire lock for contact %d in timeout period", contactID)
+		}
+		defer locker.ReleaseLock(mr.RP, lockID, lock)
+	}
+
+	err = models.AnonymizeContacts(ctx, mr.DB, orgID, anonTask.ContactIDs)
+	if err != nil {
+		return errors.Wrapf(err, "error anonymizing contacts")
+	}
+
+	// remove the contacts from the index right away rather than waiting for the indexer to see they're inactive
+	err = deindexContacts(ctx, mr.ElasticClient, orgID, anonTask.ContactIDs)
+	if err != nil {
+		logrus.WithError(err).WithField("org_id", orgID).Error("error removing anonymized contacts from index")
+	}
+
+	return nil
+}
+
+// deindexContacts removes the passed in contacts from the contacts index
+func deindexContacts(ctx context.Context, client *elastic.Client, orgID models.OrgID, contactIDs []models.ContactID) error {
+	if client == nil {
+		return errors.Errorf("no elastic client available")
+	}
+
+	ids := make([]interface{}, len(contactIDs))
+	for i := range contactIDs {
+		ids[i] = contactIDs[i]
+	}
+
+	_, err := client.DeleteByQuery("contacts").
+		Routing(strconv.FormatInt(int64(orgID), 10)).
+		Query(elastic.NewTermsQuery("id", ids...)).
+		Do(ctx)
+	return err
+}
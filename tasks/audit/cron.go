@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/librato"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/doctor"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	auditLock = "audit_orgs"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartAuditCron)
+}
+
+// StartAuditCron starts our cron job of auditing a sample of orgs every hour, if sampling is configured
+func StartAuditCron(mr *mailroom.Mailroom) error {
+	if mr.Config.AuditOrgs <= 0 {
+		return nil
+	}
+
+	cron.StartCron(mr.Quit, mr.RP, auditLock, time.Hour,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*30)
+			defer cancel()
+			return auditOrgs(ctx, mr.DB, mr.RP, mr.ElasticClient, mr.Config, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+const selectSampleOrgsSQL = `
+SELECT
+	id
+FROM
+	orgs_org
+WHERE
+	is_active = TRUE
+ORDER BY
+	random()
+LIMIT
+	$1
+`
+
+// auditOrgs cross-checks the data of a random sample of orgs, recording and logging any discrepancies found
+func auditOrgs(ctx context.Context, db *sqlx.DB, rp *redis.Pool, es *elastic.Client, cfg *config.Config, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "org_auditor").WithField("lock", lockValue)
+	start := time.Now()
+
+	orgIDs := make([]models.OrgID, 0, cfg.AuditOrgs)
+	err := db.SelectContext(ctx, &orgIDs, selectSampleOrgsSQL, cfg.AuditOrgs)
+	if err != nil {
+		return errors.Wrapf(err, "error selecting orgs to audit")
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	discrepancies := 0
+	for _, orgID := range orgIDs {
+		audit, err := doctor.AuditOrg(ctx, db, es, orgID, cfg.AuditRepair)
+		if err != nil {
+			log.WithError(err).WithField("org_id", orgID).Error("error auditing org")
+			continue
+		}
+
+		for _, d := range audit.Discrepancies {
+			log.WithFields(logrus.Fields{
+				"org_id":   orgID,
+				"audit":    d.Audit,
+				"subject":  d.Subject,
+				"expected": d.Expected,
+				"actual":   d.Actual,
+				"repaired": d.Repaired,
+			}).Warn("org data discrepancy")
+		}
+		discrepancies += len(audit.Discrepancies)
+
+		err = doctor.RecordOrgAudit(rc, audit)
+		if err != nil {
+			return err
+		}
+	}
+
+	librato.Gauge("mr.audit_discrepancies", float64(discrepancies))
+
+	log.WithField("elapsed", time.Since(start)).WithField("orgs", len(orgIDs)).WithField("discrepancies", discrepancies).Info("audited orgs")
+	return nil
+}
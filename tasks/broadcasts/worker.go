@@ -23,6 +23,10 @@ const (
 func init() {
 	mailroom.AddTaskFunction(queue.SendBroadcast, handleSendBroadcast)
 	mailroom.AddTaskFunction(queue.SendBroadcastBatch, handleSendBroadcastBatch)
+
+	// a retried batch would message again the contacts it reached before failing, so failed batches are only kept as
+	// dead tasks for an admin to decide what to do with
+	queue.RegisterRetryPolicy(queue.SendBroadcastBatch, &queue.RetryPolicy{MaxAttempts: 1, DeadLetter: true})
 }
 
 // handleSendBroadcast creates all the batches of contacts that need to be sent to
@@ -94,6 +98,15 @@ func CreateBroadcastBatches(ctx context.Context, db *sqlx.DB, rp *redis.Pool, bc
 	rc := rp.Get()
 	defer rc.Close()
 
+	// if this broadcast is paced, we use smaller batches when needed so they can be spread out evenly
+	batchSize := startBatchSize
+	if bcast.Pace() > 0 && bcast.Pace() < batchSize {
+		batchSize = bcast.Pace()
+	}
+
+	now := time.Now()
+	batchIndex := 0
+
 	contacts := make([]models.ContactID, 0, 100)
 
 	// utility functions for queueing the current set of contacts
@@ -113,16 +126,23 @@ func CreateBroadcastBatches(ctx context.Context, db *sqlx.DB, rp *redis.Pool, bc
 			batch.SetURNs(urnContacts)
 		}
 
-		err = queue.AddTask(rc, q, queue.SendBroadcastBatch, int(bcast.OrgID()), batch, queue.DefaultPriority)
+		// paced batches after the first are scheduled to be queued later
+		delay := queue.PacedDelay(batchIndex, batchSize, bcast.Pace())
+		if delay > 0 {
+			err = queue.ScheduleTask(rc, q, queue.SendBroadcastBatch, int(bcast.OrgID()), batch, queue.DefaultPriority, now.Add(delay))
+		} else {
+			err = queue.AddTask(rc, q, queue.SendBroadcastBatch, int(bcast.OrgID()), batch, queue.DefaultPriority)
+		}
 		if err != nil {
 			logrus.WithError(err).Error("error while queuing broadcast batch")
 		}
 		contacts = make([]models.ContactID, 0, 100)
+		batchIndex++
 	}
 
 	// build up batches of contacts to start
 	for c := range contactIDs {
-		if len(contacts) == startBatchSize {
+		if len(contacts) == batchSize {
 			queueBatch(false)
 		}
 		contacts = append(contacts, c)
@@ -181,10 +201,15 @@ func SendBroadcastBatch(ctx context.Context, db *sqlx.DB, rp *redis.Pool, bcast
 		return errors.Wrapf(err, "error creating broadcast messages")
 	}
 
-	// and queue them to courier for sending
 	rc := rp.Get()
 	defer rc.Close()
 
+	// if sending is paused for this org, record our messages as failed instead of sending them
+	if paused, err := models.FailMessagesIfSendingPaused(ctx, db, rc, bcast.OrgID(), msgs); paused || err != nil {
+		return err
+	}
+
+	// and queue them to courier for sending
 	err = courier.QueueMessages(rc, msgs)
 	if err != nil {
 		return errors.Wrapf(err, "error queuing broadcast messages")
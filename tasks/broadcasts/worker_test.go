@@ -239,3 +239,121 @@ func TestBroadcastTask(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+func TestBroadcastChannelAndVariables(t *testing.T) {
+	testsuite.Reset()
+	ctx := testsuite.CTX()
+	rp := testsuite.RP()
+	db := testsuite.DB()
+	rc := testsuite.RC()
+	defer rc.Close()
+
+	eng := envs.Language("eng")
+	translations := map[envs.Language]*models.BroadcastTranslation{
+		eng: &models.BroadcastTranslation{Text: "Hi @contact.first_name, see you on @variables.day"},
+	}
+
+	bcast := models.NewBroadcast(models.Org1, models.NilBroadcastID, translations, models.TemplateStateUnevaluated, eng, nil, []models.ContactID{models.CathyID}, nil).
+		WithChannelID(models.NexmoChannelID).
+		WithVariables(map[string]string{"day": "Monday"})
+
+	err := models.InsertBroadcast(ctx, db, bcast)
+	assert.NoError(t, err)
+	assert.NotEqual(t, models.NilBroadcastID, bcast.BroadcastID())
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_broadcast WHERE id = $1 AND channel_id = $2 AND variables->>'day' = 'Monday'`, []interface{}{bcast.BroadcastID(), models.NexmoChannelID}, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_broadcast_contacts WHERE broadcast_id = $1`, []interface{}{bcast.BroadcastID()}, 1)
+
+	// a broadcast can only be inserted once
+	err = models.InsertBroadcast(ctx, db, bcast)
+	assert.Error(t, err)
+
+	// and URNs must already exist
+	newURNBcast := models.NewBroadcast(models.Org1, models.NilBroadcastID, translations, models.TemplateStateUnevaluated, eng, []urns.URN{"tel:+250788555555"}, nil, nil)
+	err = models.InsertBroadcast(ctx, db, newURNBcast)
+	assert.EqualError(t, err, "attempt to insert new broadcast with URNs that do not have id: tel:+250788555555")
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_broadcast WHERE id > $1`, []interface{}{bcast.BroadcastID()}, 0)
+
+	// round trip our broadcast through a task like the API does
+	bcastJSON, err := json.Marshal(bcast)
+	assert.NoError(t, err)
+	bcast = &models.Broadcast{}
+	assert.NoError(t, json.Unmarshal(bcastJSON, bcast))
+
+	err = CreateBroadcastBatches(ctx, db, rp, bcast)
+	assert.NoError(t, err)
+
+	task, err := queue.PopNextTask(rc, queue.HandlerQueue)
+	assert.NoError(t, err)
+	assert.NotNil(t, task)
+
+	batch := &models.BroadcastBatch{}
+	assert.NoError(t, json.Unmarshal(task.Task, batch))
+	assert.Equal(t, models.NexmoChannelID, batch.ChannelID())
+	assert.Equal(t, map[string]string{"day": "Monday"}, batch.Variables())
+
+	err = SendBroadcastBatch(ctx, db, rp, batch)
+	assert.NoError(t, err)
+
+	// message is sent with our preferred channel and the variables are substituted
+	testsuite.AssertQueryCount(t, db,
+		`SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND broadcast_id = $2 AND channel_id = $3 AND text = 'Hi Cathy, see you on Monday'`,
+		[]interface{}{models.CathyID, bcast.BroadcastID(), models.NexmoChannelID}, 1)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_broadcast WHERE id = $1 AND status = 'S'`, []interface{}{bcast.BroadcastID()}, 1)
+}
+
+func TestBroadcastFailover(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	// twilio is down and has nexmo as its backup
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'NX' WHERE id = $1`, models.NexmoChannelID)
+	db.MustExec(`UPDATE channels_channel SET config = (COALESCE(config, '{}')::jsonb || jsonb_build_object('backup_channel_uuid', $2::text))::text WHERE id = $1`, models.TwilioChannelID, models.NexmoChannelUUID)
+	models.FlushCache()
+
+	_, err := models.OpenChannelIncident(rc, &models.ChannelIncident{ChannelID: models.TwilioChannelID, OrgID: models.Org1, Reason: "down", OpenedOn: time.Now()})
+	assert.NoError(t, err)
+
+	eng := envs.Language("eng")
+	translations := map[envs.Language]*models.BroadcastTranslation{eng: &models.BroadcastTranslation{Text: "Hello"}}
+	bcast := models.NewBroadcast(models.Org1, models.NilBroadcastID, translations, models.TemplateStateEvaluated, eng, nil, []models.ContactID{models.CathyID}, nil).
+		WithChannelID(models.TwilioChannelID)
+
+	err = models.InsertBroadcast(ctx, db, bcast)
+	assert.NoError(t, err)
+
+	err = SendBroadcastBatch(ctx, db, rp, bcast.CreateBatch([]models.ContactID{models.CathyID}))
+	assert.NoError(t, err)
+
+	// message goes out on the backup channel
+	testsuite.AssertQueryCount(t, db,
+		`SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND broadcast_id = $2 AND channel_id = $3`,
+		[]interface{}{models.CathyID, bcast.BroadcastID(), models.NexmoChannelID}, 1)
+}
+
+func TestBroadcastRouting(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+
+	// twilio and nexmo share a region but twilio doesn't take any routed sends
+	db.MustExec(`UPDATE channels_channel SET config = (COALESCE(config, '{}')::jsonb || '{"routing_region": "east", "routing_weight": 0}')::text WHERE id = $1`, models.TwilioChannelID)
+	db.MustExec(`UPDATE channels_channel SET config = (COALESCE(config, '{}')::jsonb || '{"routing_region": "east"}')::text WHERE id = $1`, models.NexmoChannelID)
+	models.FlushCache()
+
+	eng := envs.Language("eng")
+	translations := map[envs.Language]*models.BroadcastTranslation{eng: &models.BroadcastTranslation{Text: "Hello"}}
+	bcast := models.NewBroadcast(models.Org1, models.NilBroadcastID, translations, models.TemplateStateEvaluated, eng, nil, []models.ContactID{models.CathyID}, nil).
+		WithChannelID(models.TwilioChannelID)
+
+	err := models.InsertBroadcast(ctx, db, bcast)
+	assert.NoError(t, err)
+
+	err = SendBroadcastBatch(ctx, db, rp, bcast.CreateBatch([]models.ContactID{models.CathyID}))
+	assert.NoError(t, err)
+
+	// message is routed to the other channel in the region
+	testsuite.AssertQueryCount(t, db,
+		`SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND broadcast_id = $2 AND channel_id = $3`,
+		[]interface{}{models.CathyID, bcast.BroadcastID(), models.NexmoChannelID}, 1)
+}
@@ -84,3 +84,38 @@ func TestIVRCampaigns(t *testing.T) {
 
 	assert.Equal(t, task.Type, queue.StartIVRFlowBatch)
 }
+
+func TestScheduleCampaignEvent(t *testing.T) {
+	testsuite.Reset()
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+
+	// give every doctor a joined date in the future, except cathy
+	db.MustExec(
+		`UPDATE contacts_contact SET fields = COALESCE(fields, '{}'::jsonb) || jsonb_build_object(
+			(SELECT uuid FROM contacts_contactfield WHERE org_id = 1 AND key = 'joined')::text,
+			jsonb_build_object('text', '2029-09-15T12:00:00+00:00', 'datetime', '2029-09-15T12:00:00+00:00')
+		) WHERE id IN (SELECT contact_id FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1) AND id != $2`,
+		models.DoctorsGroupID, models.CathyID,
+	)
+
+	// an existing unfired fire for this event is replaced, but fired ones are left alone
+	db.MustExec(`INSERT INTO campaigns_eventfire(scheduled, contact_id, event_id) VALUES (NOW(), $1, $2)`, models.CathyID, models.RemindersEvent1ID)
+	db.MustExec(`INSERT INTO campaigns_eventfire(scheduled, fired, contact_id, event_id) VALUES (NOW(), NOW(), $1, $2)`, models.GeorgeID, models.RemindersEvent1ID)
+
+	err := scheduleCampaignEvent(ctx, db, models.Org1, models.RemindersEvent1ID)
+	assert.NoError(t, err)
+
+	var doctors int
+	err = db.Get(&doctors, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1 AND contact_id != $2`, models.DoctorsGroupID, models.CathyID)
+	assert.NoError(t, err)
+	assert.True(t, doctors > 0)
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1 AND fired IS NULL`, []interface{}{models.RemindersEvent1ID}, doctors)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1 AND contact_id = $2`, []interface{}{models.RemindersEvent1ID, models.CathyID}, 0)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1 AND fired IS NOT NULL`, []interface{}{models.RemindersEvent1ID}, 1)
+
+	// scheduling an event which doesn't exist is a noop
+	err = scheduleCampaignEvent(ctx, db, models.Org1, models.CampaignEventID(123456))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,69 @@
+package campaigns
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.AddTaskFunction(queue.ScheduleCampaignEvent, handleScheduleCampaignEvent)
+}
+
+// ScheduleCampaignEventTask is our task for scheduling a campaign event for all the contacts in its campaign's group,
+// queued when an event is created or changed
+//
+//   {
+//     "campaign_event_id": 12345
+//   }
+//
+type ScheduleCampaignEventTask struct {
+	CampaignEventID models.CampaignEventID `json:"campaign_event_id"`
+}
+
+// handleScheduleCampaignEvent schedules the event in the passed in task
+func handleScheduleCampaignEvent(ctx context.Context, mr *mailroom.Mailroom, task *queue.Task) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*30)
+	defer cancel()
+
+	if task.Type != queue.ScheduleCampaignEvent {
+		return errors.Errorf("unknown event type passed to schedule campaign event worker: %s", task.Type)
+	}
+	scheduleTask := &ScheduleCampaignEventTask{}
+	err := json.Unmarshal(task.Task, scheduleTask)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshalling schedule campaign event task: %s", string(task.Task))
+	}
+
+	return scheduleCampaignEvent(ctx, mr.DB, models.OrgID(task.OrgID), scheduleTask.CampaignEventID)
+}
+
+// scheduleCampaignEvent recalculates the fires of the passed in campaign event
+func scheduleCampaignEvent(ctx context.Context, db *sqlx.DB, orgID models.OrgID, eventID models.CampaignEventID) error {
+	// the event has likely only just been created or changed so we don't use cached assets
+	org, err := models.NewOrgAssets(ctx, db, orgID, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error loading org assets")
+	}
+
+	event := org.CampaignEventByID(eventID)
+	if event == nil {
+		logrus.WithField("org_id", orgID).WithField("event_id", eventID).Info("skipping scheduling of campaign event, event no longer active")
+		return nil
+	}
+
+	sa, err := models.NewSessionAssets(org)
+	if err != nil {
+		return errors.Wrapf(err, "error creating session assets")
+	}
+
+	_, err = models.ScheduleCampaignEvent(ctx, db, org, sa, event)
+	return err
+}
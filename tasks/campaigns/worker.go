@@ -20,6 +20,11 @@ import (
 
 func init() {
 	mailroom.AddTaskFunction(queue.FireCampaignEvent, HandleCampaignEvent)
+
+	// fires are only marked as fired once handled so a retried batch only starts contacts which weren't started
+	queue.RegisterRetryPolicy(queue.FireCampaignEvent, &queue.RetryPolicy{
+		MaxAttempts: 5, Backoff: time.Second * 30, Multiplier: 2, MaxBackoff: time.Minute * 10, Jitter: 0.2, DeadLetter: true,
+	})
 }
 
 // HandleCampaignEvent is called by mailroom when a campaign event task is ready to be processed.
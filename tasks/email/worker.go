@@ -0,0 +1,71 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mail.v2"
+)
+
+func init() {
+	mailroom.AddTaskFunction(queue.SendEmail, handleSendEmail)
+
+	// SMTP servers are external and often rate limit so give them a while to come back before we give up on an email
+	queue.RegisterRetryPolicy(queue.SendEmail, &queue.RetryPolicy{
+		MaxAttempts: 5, Backoff: time.Minute, Multiplier: 2, MaxBackoff: time.Minute * 30, Jitter: 0.2, DeadLetter: true,
+	})
+}
+
+// handleSendEmail sends an email queued by a flow through its org's SMTP server
+func handleSendEmail(ctx context.Context, mr *mailroom.Mailroom, task *queue.Task) error {
+	if task.Type != queue.SendEmail {
+		return errors.Errorf("unknown event type passed to send email worker: %s", task.Type)
+	}
+	emailTask := &models.EmailTask{}
+	err := json.Unmarshal(task.Task, emailTask)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshalling send email task: %s", string(task.Task))
+	}
+
+	org, err := models.GetOrgAssets(ctx, mr.DB, models.OrgID(task.OrgID))
+	if err != nil {
+		return errors.Wrapf(err, "error loading org assets")
+	}
+
+	smtp, err := org.Org().SMTPConfig()
+	if err != nil {
+		return errors.Wrapf(err, "error loading SMTP configuration for org: %d", task.OrgID)
+	}
+
+	err = sendEmail(smtp, emailTask)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("org_id", task.OrgID).WithField("to", emailTask.To).Debug("email sent")
+	return nil
+}
+
+// sendEmail sends the passed in email through the passed in SMTP server
+func sendEmail(smtp *models.SMTPConfig, email *models.EmailTask) error {
+	d := mail.NewDialer(smtp.Host, smtp.Port, smtp.Username, smtp.Password)
+	d.Timeout = time.Second * 15
+
+	return errors.Wrapf(d.DialAndSend(newMessage(smtp, email)), "error sending email")
+}
+
+// newMessage creates the message for the passed in email
+func newMessage(smtp *models.SMTPConfig, email *models.EmailTask) *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("From", smtp.From)
+	m.SetHeader("To", email.To...)
+	m.SetHeader("Subject", email.Subject)
+	m.SetBody("text/plain", email.Body)
+	return m
+}
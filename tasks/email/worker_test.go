@@ -0,0 +1,18 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMessage(t *testing.T) {
+	smtp := &models.SMTPConfig{Host: "smtp.example.com", Port: 587, Username: "bob", Password: "pass123", From: "flows@example.com"}
+	email := &models.EmailTask{To: []string{"cathy@example.com", "bob@example.com"}, Subject: "Order received", Body: "Thanks for your order"}
+
+	m := newMessage(smtp, email)
+	assert.Equal(t, []string{"flows@example.com"}, m.GetHeader("From"))
+	assert.Equal(t, []string{"cathy@example.com", "bob@example.com"}, m.GetHeader("To"))
+	assert.Equal(t, []string{"Order received"}, m.GetHeader("Subject"))
+}
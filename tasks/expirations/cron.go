@@ -51,6 +51,9 @@ func expireRuns(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName strin
 	expiredRuns := make([]models.FlowRunID, 0, expireBatchSize)
 	expiredSessions := make([]models.SessionID, 0, expireBatchSize)
 
+	// and sessions whose flows are configured to exit rather than continue a parent run
+	exitedSessions := make([]models.SessionID, 0, expireBatchSize)
+
 	// select our expired runs
 	rows, err := db.QueryxContext(ctx, selectExpiredRunsSQL)
 	if err != nil {
@@ -86,6 +89,21 @@ func expireRuns(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName strin
 			continue
 		}
 
+		// flow is configured to exit rather than continue the parent, expire the whole session
+		if expiration.OnExpire != nil && *expiration.OnExpire == models.FlowOnExpireExit {
+			exitedSessions = append(exitedSessions, expiration.SessionID)
+
+			if len(exitedSessions) == expireBatchSize {
+				err = expireSessions(ctx, db, exitedSessions)
+				if err != nil {
+					return errors.Wrapf(err, "error expiring sessions")
+				}
+				exitedSessions = exitedSessions[:0]
+			}
+
+			continue
+		}
+
 		// need to continue this session and flow, create a task for that
 		taskID := fmt.Sprintf("%d:%s", expiration.RunID, expiration.ExpiresOn.Format(time.RFC3339))
 		queued, err := marker.HasTask(rc, markerGroup, taskID)
@@ -120,10 +138,33 @@ func expireRuns(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName strin
 		}
 	}
 
+	if len(exitedSessions) > 0 {
+		err = expireSessions(ctx, db, exitedSessions)
+		if err != nil {
+			return errors.Wrapf(err, "error expiring sessions")
+		}
+	}
+
 	log.WithField("elapsed", time.Since(start)).WithField("count", count).Info("expirations complete")
 	return nil
 }
 
+// expires the passed in sessions and all their active runs
+func expireSessions(ctx context.Context, db *sqlx.DB, sessionIDs []models.SessionID) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error starting transaction to expire sessions")
+	}
+
+	err = models.ExitSessions(ctx, tx, sessionIDs, models.ExitExpired, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 const selectExpiredRunsSQL = `
 	SELECT
 		fr.org_id as org_id,
@@ -132,10 +173,12 @@ const selectExpiredRunsSQL = `
 		fr.id as run_id,
 		fr.parent_uuid as parent_uuid,
 		fr.session_id as session_id,
-		fr.expires_on as expires_on
+		fr.expires_on as expires_on,
+		COALESCE(f.metadata, '{}')::jsonb->>'on_expire' as on_expire
 	FROM
 		flows_flowrun fr
 		JOIN orgs_org o ON fr.org_id = o.id
+		JOIN flows_flow f ON fr.flow_id = f.id
 	WHERE
 		fr.is_active = TRUE AND
 		fr.expires_on < NOW() AND
@@ -154,4 +197,5 @@ type RunExpiration struct {
 	ParentUUID *flows.RunUUID   `db:"parent_uuid"`
 	SessionID  models.SessionID `db:"session_id"`
 	ExpiresOn  time.Time        `db:"expires_on"`
+	OnExpire   *string          `db:"on_expire"`
 }
@@ -93,3 +93,40 @@ func TestExpirations(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, task)
 }
+
+func TestExpirationsWithExit(t *testing.T) {
+	ctx := testsuite.CTX()
+	rp := testsuite.RP()
+	rc := testsuite.RC()
+	defer rc.Close()
+	db := testsuite.DB()
+
+	// the child flow is configured to exit the whole session when it expires
+	db.MustExec(`UPDATE flows_flow SET metadata = '{"on_expire": "exit"}' WHERE id = $1`, models.PickNumberFlowID)
+	defer db.MustExec(`UPDATE flows_flow SET metadata = NULL WHERE id = $1`, models.PickNumberFlowID)
+
+	var s1 models.SessionID
+	err := db.Get(&s1, `INSERT INTO flows_flowsession(uuid, org_id, status, responded, contact_id, created_on) VALUES ($1, 1, 'W', TRUE, $2, NOW()) RETURNING id;`, uuids.New(), models.BobID)
+	assert.NoError(t, err)
+
+	// parent run
+	db.MustExec(`INSERT INTO flows_flowrun(session_id, status, uuid, is_active, created_on, modified_on, responded, contact_id, flow_id, org_id, expires_on) VALUES($1, $2, '0e1b5e8d-8e4b-4c0e-8f2a-0a6a1a8d3c51', TRUE, NOW(), NOW(), TRUE, $3, $4, 1, NOW() + interval '1' day);`, s1, models.RunStatusWaiting, models.BobID, models.FavoritesFlowID)
+
+	// child run which has expired
+	db.MustExec(`INSERT INTO flows_flowrun(session_id, status, parent_uuid, uuid, is_active, created_on, modified_on, responded, contact_id, flow_id, org_id, expires_on) VALUES($1, $2, '0e1b5e8d-8e4b-4c0e-8f2a-0a6a1a8d3c51', '5b9e6f1c-1e36-4b6f-9a43-1f0a3a6f2d7e', TRUE, NOW(), NOW(), TRUE, $3, $4, 1, NOW());`, s1, models.RunStatusWaiting, models.BobID, models.PickNumberFlowID)
+
+	time.Sleep(10 * time.Millisecond)
+
+	err = expireRuns(ctx, db, rp, expirationLock, "foo")
+	assert.NoError(t, err)
+
+	// both runs and the session are expired without continuing the parent
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowrun WHERE is_active = TRUE AND contact_id = $1;`, []interface{}{models.BobID}, 0)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowrun WHERE exit_type = 'E' AND status = 'X' AND contact_id = $1;`, []interface{}{models.BobID}, 2)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE status = 'X' AND contact_id = $1;`, []interface{}{models.BobID}, 1)
+
+	// and no task was queued to continue it
+	task, err := queue.PopNextTask(rc, queue.HandlerQueue)
+	assert.NoError(t, err)
+	assert.Nil(t, task)
+}
@@ -0,0 +1,51 @@
+package fields
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	squashLock = "squash_field_usage"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartSquashCron)
+}
+
+// StartSquashCron starts our cron job of squashing field usage every fifteen minutes
+func StartSquashCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, squashLock, time.Minute*15,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancel()
+			return squashFieldUsage(ctx, mr.DB, mr.RP, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// squashFieldUsage recalculates the field fill counts for any orgs which have had fields set since our last run
+func squashFieldUsage(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "field_usage").WithField("lock", lockValue)
+	start := time.Now()
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	count, err := models.SquashFieldUsage(ctx, db, rc)
+	if err != nil {
+		return errors.Wrapf(err, "error squashing field usage")
+	}
+
+	log.WithField("elapsed", time.Since(start)).WithField("orgs", count).Info("squashed field usage")
+	return nil
+}
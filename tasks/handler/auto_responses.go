@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/courier"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// sendAutoResponse replies to the passed in message with the passed in auto response, without starting or resuming
+// any session, and marks the message as handled
+func sendAutoResponse(ctx context.Context, db *sqlx.DB, rp *redis.Pool, org *models.OrgAssets, channel *models.Channel, contact *models.Contact, event *MsgEvent, response *models.AutoResponse, topup models.TopupID) error {
+	rc := rp.Get()
+	defer rc.Close()
+
+	// if the channel has a region our reply may go out on another channel in that region, and if the channel is down
+	// it may go out on its backup channel
+	channel, err := models.SendChannel(rc, org, channel, event.URN.Scheme())
+	if err != nil {
+		return errors.Wrapf(err, "error routing auto response")
+	}
+
+	text := response.Localize(contact.Language(), org.Env().DefaultLanguage())
+	out := flows.NewMsgOut(event.URN, channel.ChannelReference(), text, nil, nil, nil, flows.NilMsgTopic)
+
+	msg, err := models.NewOutgoingMsg(org.OrgID(), channel, contact.ID(), out, time.Now())
+	if err != nil {
+		return errors.Wrapf(err, "error creating auto response message")
+	}
+	msg.SetResponseTo(models.MsgID(event.MsgID), event.MsgExternalID)
+
+	// our reply needs its own credit
+	replyTopup, err := models.DecrementOrgCredits(ctx, db, rc, org.OrgID(), 1)
+	if err != nil {
+		return errors.Wrapf(err, "error calculating topup for auto response")
+	}
+	msg.SetTopup(replyTopup)
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error starting transaction")
+	}
+
+	err = models.UpdateMessage(ctx, tx, event.MsgID, models.MsgStatusHandled, models.VisibilityVisible, models.TypeInbox, topup)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "error marking message as handled")
+	}
+
+	err = models.InsertMessages(ctx, tx, []*models.Msg{msg})
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "error inserting auto response message")
+	}
+
+	// without credits our reply waits as pending like any other message
+	if replyTopup == models.NilTopupID {
+		err = models.MarkMessagesPending(ctx, tx, []*models.Msg{msg})
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "error marking auto response as pending")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "error committing auto response")
+	}
+
+	// android channels will pick up our reply when they next sync
+	if replyTopup == models.NilTopupID || channel.Type() == models.ChannelTypeAndroid {
+		return nil
+	}
+
+	// if sending is paused for this org, record our reply as failed instead of sending it
+	if paused, err := models.FailMessagesIfSendingPaused(ctx, db, rc, org.OrgID(), []*models.Msg{msg}); paused || err != nil {
+		return err
+	}
+
+	// not being able to queue our reply isn't the end of the world, mark it as pending so it gets queued later
+	if err := courier.QueueMessages(rc, []*models.Msg{msg}); err != nil {
+		logrus.WithError(err).WithField("msg_id", msg.ID()).Error("error queuing auto response")
+
+		return models.MarkMessagesPending(ctx, db, []*models.Msg{msg})
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/resumes"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/goflow"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/runner"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CallbackEvent is an external system calling back to resume a run which is waiting for it
+type CallbackEvent struct {
+	ContactID models.ContactID `json:"contact_id"`
+	OrgID     models.OrgID     `json:"org_id"`
+	SessionID models.SessionID `json:"session_id"`
+	RunUUID   flows.RunUUID    `json:"run_uuid"`
+	StepUUID  flows.StepUUID   `json:"step_uuid"`
+	Payload   string           `json:"payload"`
+}
+
+// the key used to claim callbacks so that each can only be used once
+const callbackClaimKey = "callback_claimed:%s:%s"
+
+// NewCallbackTask creates a new event task for the passed in callback to the passed in waiting run
+func NewCallbackTask(run *models.WaitingRun, callback *goflow.Callback, payload string) *queue.Task {
+	event := &CallbackEvent{
+		ContactID: run.ContactID,
+		OrgID:     run.OrgID,
+		SessionID: run.SessionID,
+		RunUUID:   callback.RunUUID,
+		StepUUID:  callback.StepUUID,
+		Payload:   payload,
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+
+	return &queue.Task{
+		Type:     CallbackEventType,
+		OrgID:    int(run.OrgID),
+		Task:     eventJSON,
+		QueuedOn: time.Now(),
+	}
+}
+
+// ClaimCallback claims the passed in callback, returning false if it has already been claimed. Claims last until the
+// callback expires, after which it can't be used anyway.
+func ClaimCallback(rc redis.Conn, callback *goflow.Callback) (bool, error) {
+	ttl := int(time.Until(callback.ExpiresOn)/time.Second) + 1
+	claimed, err := redis.String(rc.Do("set", fmt.Sprintf(callbackClaimKey, callback.RunUUID, callback.StepUUID), "1", "EX", ttl, "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "error claiming callback")
+	}
+	return claimed == "OK", nil
+}
+
+// ReleaseCallback releases the claim on the passed in callback so that it can be used again, e.g. if it couldn't be queued
+func ReleaseCallback(rc redis.Conn, callback *goflow.Callback) error {
+	_, err := rc.Do("del", fmt.Sprintf(callbackClaimKey, callback.RunUUID, callback.StepUUID))
+	return errors.Wrapf(err, "error releasing callback")
+}
+
+// LoadCallbackSession loads the contact of the passed in waiting run and their active session, returning a nil session
+// if that session isn't waiting for the passed in callback, e.g. because the run has since waited again or the session
+// is now waiting in a child run
+func LoadCallbackSession(ctx context.Context, db *sqlx.DB, org *models.OrgAssets, run *models.WaitingRun, callback *goflow.Callback) (*flows.Contact, *models.Session, error) {
+	contacts, err := models.LoadContacts(ctx, db, org, []models.ContactID{run.ContactID})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error loading contact")
+	}
+
+	// contact has been deleted or is blocked
+	if len(contacts) == 0 || contacts[0].IsBlocked() {
+		return nil, nil, nil
+	}
+
+	sa, err := models.GetSessionAssets(org)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "unable to load session assets")
+	}
+
+	contact, err := contacts[0].FlowContact(org, sa)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error creating flow contact")
+	}
+
+	session, err := models.ActiveSessionForContact(ctx, db, org, models.MessagingFlow, contact)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error loading active session for contact")
+	}
+	if session == nil || session.ID() != run.SessionID {
+		return contact, nil, nil
+	}
+
+	fs, err := session.FlowSession(sa, org.Env())
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error reading session")
+	}
+	if !callback.IsWaitingFor(fs) {
+		return contact, nil, nil
+	}
+
+	return contact, session, nil
+}
+
+// handleCallbackEvent resumes the run the callback is for with its payload as the input, if it's still waiting
+func handleCallbackEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *CallbackEvent) error {
+	log := logrus.WithField("contact_id", event.ContactID).WithField("session_id", event.SessionID).WithField("run_uuid", event.RunUUID)
+
+	org, err := models.GetOrgAssets(ctx, db, event.OrgID)
+	if err != nil {
+		return errors.Wrapf(err, "error loading org")
+	}
+
+	// check the run is still waiting, the contact may have replied or the run expired since the callback was queued
+	run, err := models.LoadWaitingRun(ctx, db, event.RunUUID)
+	if err != nil {
+		return errors.Wrapf(err, "error loading run")
+	}
+	if run == nil || run.SessionID != event.SessionID {
+		log.Info("ignoring callback, run no longer waiting")
+		return nil
+	}
+
+	callback := &goflow.Callback{RunUUID: event.RunUUID, StepUUID: event.StepUUID}
+	contact, session, err := LoadCallbackSession(ctx, db, org, run, callback)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		log.Info("ignoring callback, session no longer waiting for it")
+		return nil
+	}
+
+	sa, err := models.GetSessionAssets(org)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load session assets")
+	}
+
+	// the payload becomes the input to the waiting run, so flows can route on it or parse it with json()
+	msg := flows.NewMsgIn(flows.MsgUUID(uuids.New()), urns.NilURN, nil, event.Payload, nil)
+	resume := resumes.NewMsg(org.Env(), contact, msg)
+
+	_, err = runner.ResumeFlow(ctx, db, rp, org, sa, session, resume, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error resuming flow for callback")
+	}
+
+	log.Info("resumed run from callback")
+	return nil
+}
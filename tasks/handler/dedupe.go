@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const dedupeKeyPattern = "msg_dedupe:%d:%s"
+
+// checkDuplicateMsg returns whether the passed in message event has already been seen. Messages are matched by their
+// channel and external id within extWindow if they have one, otherwise by a hash of their URN and content within
+// hashWindow. Contacts often send the same reply to different questions, so hashWindow should only be long enough to
+// catch carrier retries. If the message hasn't been seen, it is recorded so that later copies will be treated as
+// duplicates.
+func checkDuplicateMsg(rc redis.Conn, event *MsgEvent, extWindow, hashWindow time.Duration) (bool, error) {
+	window := extWindow
+	if event.MsgExternalID == "" {
+		window = hashWindow
+	}
+	if window <= 0 {
+		return false, nil
+	}
+
+	key := fmt.Sprintf(dedupeKeyPattern, event.ChannelID, msgDedupeID(event))
+	msgID := fmt.Sprintf("%d", event.MsgID)
+
+	// try to claim this key for our message
+	set, err := redis.String(rc.Do("set", key, msgID, "px", int(window/time.Millisecond), "nx"))
+	if err == nil && set == "OK" {
+		return false, nil
+	}
+	if err != nil && err != redis.ErrNil {
+		return false, errors.Wrapf(err, "error checking for duplicate message")
+	}
+
+	// key already exists, if it was set by this same message (IE we are retrying) then this isn't a duplicate
+	existing, err := redis.String(rc.Do("get", key))
+	if err != nil && err != redis.ErrNil {
+		return false, errors.Wrapf(err, "error reading duplicate message key")
+	}
+
+	return existing != msgID, nil
+}
+
+// msgDedupeID returns the identifier we use to match copies of the passed in message
+func msgDedupeID(event *MsgEvent) string {
+	if event.MsgExternalID != "" {
+		return "ext:" + string(event.MsgExternalID)
+	}
+
+	hash := sha1.New()
+	hash.Write([]byte(event.URN.Identity().String()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(event.Text))
+	for _, a := range event.Attachments {
+		hash.Write([]byte{0})
+		hash.Write([]byte(strings.TrimSpace(string(a))))
+	}
+	return "hash:" + hex.EncodeToString(hash.Sum(nil))
+}
@@ -10,9 +10,11 @@ import (
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/utils/uuids"
 	_ "github.com/nyaruka/mailroom/hooks"
+	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/queue"
 	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/null"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/sirupsen/logrus"
@@ -138,7 +140,7 @@ func TestMsgEvents(t *testing.T) {
 		task, err = queue.PopNextTask(rc, queue.HandlerQueue)
 		assert.NoError(t, err, "%d: error popping next task", i)
 
-		err = handleContactEvent(ctx, db, rp, task)
+		err = handleContactEvent(ctx, db, rp, nil, task)
 		assert.NoError(t, err, "%d: error when handling event", i)
 
 		// if we are meant to have a response
@@ -175,7 +177,7 @@ func TestMsgEvents(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		task, _ = queue.PopNextTask(rc, queue.HandlerQueue)
 		assert.NotNil(t, task)
-		err := handleContactEvent(ctx, db, rp, task)
+		err := handleContactEvent(ctx, db, rp, nil, task)
 		assert.NoError(t, err)
 	}
 
@@ -193,7 +195,7 @@ func TestMsgEvents(t *testing.T) {
 	AddHandleTask(rc, models.Org2FredID, task)
 	task, _ = queue.PopNextTask(rc, queue.HandlerQueue)
 	assert.NotNil(t, task)
-	err = handleContactEvent(ctx, db, rp, task)
+	err = handleContactEvent(ctx, db, rp, nil, task)
 	assert.NoError(t, err)
 
 	// should get our catch all trigger
@@ -212,7 +214,7 @@ func TestMsgEvents(t *testing.T) {
 	task = makeMsgTask(models.Org2, models.Org2ChannelID, models.Org2FredID, models.Org2FredURN, models.Org2FredURNID, "start")
 	AddHandleTask(rc, models.Org2FredID, task)
 	task, _ = queue.PopNextTask(rc, queue.HandlerQueue)
-	err = handleContactEvent(ctx, db, rp, task)
+	err = handleContactEvent(ctx, db, rp, nil, task)
 	assert.NoError(t, err)
 
 	db.Get(&text, `SELECT text FROM msgs_msg WHERE contact_id = $1 AND direction = 'O' AND created_on > $2 ORDER BY id DESC LIMIT 1`, models.Org2FredID, previous)
@@ -287,7 +289,7 @@ func TestChannelEvents(t *testing.T) {
 		task, err = queue.PopNextTask(rc, queue.HandlerQueue)
 		assert.NoError(t, err, "%d: error popping next task", i)
 
-		err = handleContactEvent(ctx, db, rp, task)
+		err = handleContactEvent(ctx, db, rp, nil, task)
 		assert.NoError(t, err, "%d: error when handling event", i)
 
 		// if we are meant to have a response
@@ -330,7 +332,7 @@ func TestStopEvent(t *testing.T) {
 	task, err = queue.PopNextTask(rc, queue.HandlerQueue)
 	assert.NoError(t, err, "error popping next task")
 
-	err = handleContactEvent(ctx, db, rp, task)
+	err = handleContactEvent(ctx, db, rp, nil, task)
 	assert.NoError(t, err, "error when handling event")
 
 	// check that only george is in our group
@@ -458,7 +460,7 @@ func TestTimedEvents(t *testing.T) {
 		task, err = queue.PopNextTask(rc, queue.HandlerQueue)
 		assert.NoError(t, err, "%d: error popping next task", i)
 
-		err = handleContactEvent(ctx, db, rp, task)
+		err = handleContactEvent(ctx, db, rp, nil, task)
 		assert.NoError(t, err, "%d: error when handling event", i)
 
 		var text string
@@ -477,3 +479,213 @@ func TestTimedEvents(t *testing.T) {
 		last = time.Now()
 	}
 }
+
+func TestCallbackEvents(t *testing.T) {
+	testsuite.Reset()
+	db := testsuite.DB()
+	rp := testsuite.RP()
+	ctx := testsuite.CTX()
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	db.MustExec(
+		`INSERT INTO triggers_trigger(is_active, created_on, modified_on, keyword, is_archived, 
+									  flow_id, trigger_type, match_type, created_by_id, modified_by_id, org_id)
+		VALUES(TRUE, now(), now(), 'start', false, $1, 'K', 'O', 1, 1, 1) RETURNING id`,
+		models.FavoritesFlowID,
+	)
+
+	models.FlushCache()
+
+	handle := func(contactID models.ContactID, task *queue.Task) {
+		err := AddHandleTask(rc, contactID, task)
+		assert.NoError(t, err)
+
+		task, err = queue.PopNextTask(rc, queue.HandlerQueue)
+		assert.NoError(t, err)
+
+		err = handleContactEvent(ctx, db, rp, nil, task)
+		assert.NoError(t, err)
+	}
+
+	// start cathy in the favorites flow so that she's waiting
+	eventJSON, err := json.Marshal(&MsgEvent{
+		ContactID: models.CathyID,
+		OrgID:     models.Org1,
+		ChannelID: models.TwitterChannelID,
+		MsgID:     flows.MsgID(1),
+		MsgUUID:   flows.MsgUUID(uuids.New()),
+		URN:       models.CathyURN,
+		URNID:     models.CathyURNID,
+		Text:      "start",
+	})
+	assert.NoError(t, err)
+	handle(models.CathyID, &queue.Task{Type: MsgEventType, OrgID: int(models.Org1), Task: eventJSON})
+
+	var runUUID flows.RunUUID
+	var stepUUID flows.StepUUID
+	err = db.QueryRow(`SELECT uuid, path::jsonb->-1->>'uuid' FROM flows_flowrun WHERE contact_id = $1 AND status = 'W'`, models.CathyID).Scan(&runUUID, &stepUUID)
+	assert.NoError(t, err)
+
+	run, err := models.LoadWaitingRun(ctx, db, runUUID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CathyID, run.ContactID)
+
+	callback := &goflow.Callback{RunUUID: runUUID, StepUUID: stepUUID}
+
+	// a callback resumes the run with its payload as input
+	last := time.Now()
+	handle(models.CathyID, NewCallbackTask(run, callback, "blue"))
+
+	testsuite.AssertQueryCount(t, db,
+		`SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND created_on > $2 AND direction = 'O' AND text = 'Good choice, I like Blue too! What is your favorite beer?'`,
+		[]interface{}{models.CathyID, last}, 1)
+
+	// the same callback doesn't resume the run at its next wait
+	last = time.Now()
+	handle(models.CathyID, NewCallbackTask(run, callback, "Mutzig"))
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND created_on > $2`, []interface{}{models.CathyID, last}, 0)
+
+	// a callback for a run which isn't waiting is ignored
+	handle(models.CathyID, NewCallbackTask(run, &goflow.Callback{RunUUID: flows.RunUUID(uuids.New()), StepUUID: stepUUID}, "Mutzig"))
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND created_on > $2`, []interface{}{models.CathyID, last}, 0)
+
+	// as is one for a session which has since ended
+	err = db.QueryRow(`SELECT path::jsonb->-1->>'uuid' FROM flows_flowrun WHERE uuid = $1`, runUUID).Scan(&stepUUID)
+	assert.NoError(t, err)
+
+	db.MustExec(`UPDATE flows_flowsession SET status = 'I' WHERE contact_id = $1`, models.CathyID)
+	handle(models.CathyID, NewCallbackTask(run, &goflow.Callback{RunUUID: runUUID, StepUUID: stepUUID}, "Mutzig"))
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND created_on > $2`, []interface{}{models.CathyID, last}, 0)
+}
+
+func TestClaimCallback(t *testing.T) {
+	testsuite.Reset()
+	rc := testsuite.RC()
+	defer rc.Close()
+
+	callback := &goflow.Callback{RunUUID: flows.RunUUID(uuids.New()), StepUUID: flows.StepUUID(uuids.New()), ExpiresOn: time.Now().Add(time.Hour)}
+
+	claimed, err := ClaimCallback(rc, callback)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	// callbacks can only be claimed once
+	claimed, err = ClaimCallback(rc, callback)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	// unless released
+	assert.NoError(t, ReleaseCallback(rc, callback))
+	claimed, err = ClaimCallback(rc, callback)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+}
+
+func TestDuplicateMsgs(t *testing.T) {
+	testsuite.Reset()
+	rc := testsuite.RC()
+	defer rc.Close()
+
+	newEvent := func(msgID flows.MsgID, externalID null.String, text string) *MsgEvent {
+		return &MsgEvent{
+			ContactID:     models.CathyID,
+			OrgID:         models.Org1,
+			ChannelID:     models.TwitterChannelID,
+			MsgID:         msgID,
+			MsgExternalID: externalID,
+			URN:           models.CathyURN,
+			URNID:         models.CathyURNID,
+			Text:          text,
+		}
+	}
+
+	tcs := []struct {
+		Event *MsgEvent
+		Dupe  bool
+	}{
+		{newEvent(1, "ext1", "hello"), false},
+		{newEvent(1, "ext1", "hello"), false}, // retry of same message
+		{newEvent(2, "ext1", "hello"), true},  // same external id
+		{newEvent(3, "ext2", "hello"), false}, // different external id, same text
+		{newEvent(4, "", "hi there"), false},
+		{newEvent(5, "", "hi there"), true}, // no external id, same content
+		{newEvent(6, "", "hi there!"), false},
+	}
+
+	for i, tc := range tcs {
+		dupe, err := checkDuplicateMsg(rc, tc.Event, time.Minute, time.Second)
+		assert.NoError(t, err, "%d: unexpected error", i)
+		assert.Equal(t, tc.Dupe, dupe, "%d: dupe mismatch", i)
+	}
+
+	// the same reply to another question after the hash window isn't a duplicate, but a resend by external id still is
+	time.Sleep(1100 * time.Millisecond)
+
+	dupe, err := checkDuplicateMsg(rc, newEvent(8, "", "hi there"), time.Minute, time.Second)
+	assert.NoError(t, err)
+	assert.False(t, dupe)
+
+	dupe, err = checkDuplicateMsg(rc, newEvent(9, "ext1", "hello"), time.Minute, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, dupe)
+
+	// a zero window disables deduping
+	dupe, err = checkDuplicateMsg(rc, newEvent(7, "ext1", "hello"), 0, 0)
+	assert.NoError(t, err)
+	assert.False(t, dupe)
+
+	dupe, err = checkDuplicateMsg(rc, newEvent(10, "", "hi there"), time.Minute, 0)
+	assert.NoError(t, err)
+	assert.False(t, dupe)
+}
+
+func TestAutoResponses(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	// a keyword trigger for the same keyword shouldn't fire
+	db.MustExec(
+		`INSERT INTO triggers_trigger(is_active, created_on, modified_on, keyword, is_archived, 
+									  flow_id, trigger_type, match_type, created_by_id, modified_by_id, org_id)
+		VALUES(TRUE, now(), now(), 'info', false, $1, 'K', 'O', 1, 1, 1) RETURNING id`, models.FavoritesFlowID)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"auto_responses": [{"keyword": "info", "base_language": "eng", "text": {"eng": "Visit example.com"}}]}' WHERE id = $1`, models.Org1)
+	models.FlushCache()
+
+	event := &MsgEvent{
+		ContactID: models.CathyID,
+		OrgID:     models.Org1,
+		ChannelID: models.TwitterChannelID,
+		MsgID:     flows.MsgID(1),
+		MsgUUID:   flows.MsgUUID(uuids.New()),
+		URN:       models.CathyURN,
+		URNID:     models.CathyURNID,
+		Text:      "INFO",
+	}
+	eventJSON, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	err = AddHandleTask(rc, models.CathyID, &queue.Task{Type: MsgEventType, OrgID: int(models.Org1), Task: eventJSON})
+	assert.NoError(t, err)
+
+	task, err := queue.PopNextTask(rc, queue.HandlerQueue)
+	assert.NoError(t, err)
+
+	err = handleContactEvent(ctx, db, rp, nil, task)
+	assert.NoError(t, err)
+
+	// our reply is recorded and queued to courier
+	testsuite.AssertQueryCount(t, db,
+		`SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND direction = 'O' AND text = 'Visit example.com' AND response_to_id = 1`,
+		[]interface{}{models.CathyID}, 1,
+	)
+
+	// but no session was started
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE contact_id = $1`, []interface{}{models.CathyID}, 0)
+}
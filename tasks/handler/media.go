@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/s3utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRehostBytes is the largest attachment we will download to re-host
+const maxRehostBytes = 1024 * 1024 * 50
+
+var mediaHTTPClient = &http.Client{Timeout: time.Duration(60 * time.Second)}
+
+// rehostAttachments downloads the attachments of the passed in message event if it's from a channel whose media
+// URLs expire and writes them to our S3 bucket, updating the message and event with their new URLs. Attachments
+// which can't be downloaded are left as they are.
+func rehostAttachments(ctx context.Context, db models.Queryer, s3Client s3iface.S3API, channel *models.Channel, event *MsgEvent) error {
+	if s3Client == nil || len(event.Attachments) == 0 || !shouldRehostMedia(channel) {
+		return nil
+	}
+
+	rehosted := make([]utils.Attachment, len(event.Attachments))
+	changed := false
+
+	for i, attachment := range event.Attachments {
+		rehosted[i] = attachment
+
+		// geo attachments are just coordinates and anything already in our bucket doesn't need re-hosting
+		if attachment.ContentType() == "geo" || strings.Contains(attachment.URL(), config.Mailroom.S3MediaBucket) {
+			continue
+		}
+
+		newAttachment, err := rehostAttachment(ctx, s3Client, event.OrgID, attachment)
+		if err != nil {
+			logrus.WithError(err).WithField("msg_id", event.MsgID).WithField("url", attachment.URL()).Error("error re-hosting attachment")
+			continue
+		}
+
+		rehosted[i] = newAttachment
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	err := models.UpdateMessageAttachments(ctx, db, event.MsgID, rehosted)
+	if err != nil {
+		return errors.Wrapf(err, "error updating re-hosted attachments")
+	}
+
+	event.Attachments = rehosted
+	return nil
+}
+
+// returns whether incoming media on the passed in channel needs to be re-hosted
+func shouldRehostMedia(channel *models.Channel) bool {
+	for _, t := range strings.Split(config.Mailroom.RehostMediaChannelTypes, ",") {
+		if models.ChannelType(strings.TrimSpace(t)) == channel.Type() {
+			return true
+		}
+	}
+	return false
+}
+
+// downloads the passed in attachment and writes it to S3, returning the attachment with its new URL
+func rehostAttachment(ctx context.Context, s3Client s3iface.S3API, orgID models.OrgID, attachment utils.Attachment) (utils.Attachment, error) {
+	req, err := http.NewRequest(http.MethodGet, attachment.URL(), nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating request")
+	}
+
+	resp, err := mediaHTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrapf(err, "error downloading attachment")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("error downloading attachment, got status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRehostBytes+1))
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading attachment")
+	}
+	if len(body) > maxRehostBytes {
+		return "", errors.Errorf("attachment is larger than %d bytes", maxRehostBytes)
+	}
+
+	contentType := attachment.ContentType()
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	// filename is based on a new UUID, keeping the extension of the original
+	filename := string(uuids.New()) + path.Ext(strings.SplitN(path.Base(attachment.URL()), "?", 2)[0])
+	path := filepath.Join(config.Mailroom.S3MediaPrefix, fmt.Sprintf("%d", orgID), filename[:4], filename[4:8], filename)
+	if !strings.HasPrefix(path, "/") {
+		path = fmt.Sprintf("/%s", path)
+	}
+
+	url, err := s3utils.PutS3File(s3Client, config.Mailroom.S3MediaBucket, path, contentType, body)
+	if err != nil {
+		return "", errors.Wrapf(err, "error writing attachment to S3")
+	}
+
+	return utils.Attachment(contentType + ":" + url), nil
+}
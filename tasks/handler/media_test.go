@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockS3 records the keys of the objects written to it
+type mockS3 struct {
+	s3iface.S3API
+	keys []string
+}
+
+func (m *mockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	m.keys = append(m.keys, aws.StringValue(input.Key))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestRehostAttachments(t *testing.T) {
+	ctx, db, _ := testsuite.Reset()
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/expired.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("image data"))
+	}))
+	defer provider.Close()
+
+	org, err := models.GetOrgAssets(ctx, db, models.Org1)
+	require.NoError(t, err)
+
+	defer func() { config.Mailroom.RehostMediaChannelTypes = "WA,TG" }()
+	config.Mailroom.RehostMediaChannelTypes = "WA," + string(org.ChannelByID(models.TwitterChannelID).Type())
+
+	var msgID flows.MsgID
+	err = db.Get(&msgID,
+		`INSERT INTO msgs_msg(uuid, org_id, channel_id, contact_id, contact_urn_id, text, direction, status, created_on, visibility, msg_count, error_count, next_attempt)
+		VALUES($1, $2, $3, $4, $5, 'hi', 'I', 'P', NOW(), 'V', 1, 0, NOW()) RETURNING id`,
+		uuids.New(), models.Org1, models.TwitterChannelID, models.CathyID, models.CathyURNID)
+	require.NoError(t, err)
+
+	s3Client := &mockS3{}
+	event := &MsgEvent{
+		OrgID: models.Org1,
+		MsgID: msgID,
+		Attachments: []utils.Attachment{
+			utils.Attachment("image/jpeg:" + provider.URL + "/photo.jpg?token=123"),
+			utils.Attachment("image/jpeg:" + provider.URL + "/expired.jpg"),
+			utils.Attachment("geo:-1.23,4.56"),
+		},
+	}
+
+	// nothing re-hosted for channel types not configured
+	err = rehostAttachments(ctx, db, s3Client, org.ChannelByID(models.TwilioChannelID), event)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(s3Client.keys))
+
+	err = rehostAttachments(ctx, db, s3Client, org.ChannelByID(models.TwitterChannelID), event)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(s3Client.keys))
+	assert.Regexp(t, `^/media/1/\w{4}/\w{4}/[\w-]+\.jpg$`, s3Client.keys[0])
+
+	// attachments which couldn't be downloaded are left as they are
+	assert.Equal(t, "https://mailroom-media.s3.amazonaws.com"+s3Client.keys[0], event.Attachments[0].URL())
+	assert.Equal(t, "image/jpeg", event.Attachments[0].ContentType())
+	assert.Equal(t, utils.Attachment("image/jpeg:"+provider.URL+"/expired.jpg"), event.Attachments[1])
+	assert.Equal(t, utils.Attachment("geo:-1.23,4.56"), event.Attachments[2])
+
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM msgs_msg WHERE id = $1 AND attachments[1] = $2`, []interface{}{msgID, string(event.Attachments[0])}, 1)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/gocommon/urns"
@@ -16,6 +17,7 @@ import (
 	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/librato"
 	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/config"
 	"github.com/nyaruka/mailroom/locker"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/queue"
@@ -34,6 +36,7 @@ const (
 	MsgEventType             = "msg_event"
 	ExpirationEventType      = "expiration_event"
 	TimeoutEventType         = "timeout_event"
+	CallbackEventType        = "callback_event"
 )
 
 func init() {
@@ -48,42 +51,16 @@ func AddHandleTask(rc redis.Conn, contactID models.ContactID, task *queue.Task)
 // addHandleTask adds a single task for the passed in contact. `front` specifies whether the task
 // should be inserted in front of all other tasks for that contact
 func addHandleTask(rc redis.Conn, contactID models.ContactID, task *queue.Task, front bool) error {
-	// marshal our task
-	taskJSON, err := json.Marshal(task)
-	if err != nil {
-		return errors.Wrapf(err, "error marshalling contact task")
-	}
-
-	// first push the event on our contact queue
-	contactQ := fmt.Sprintf("c:%d:%d", task.OrgID, contactID)
-	if front {
-		_, err = redis.Int64(rc.Do("lpush", contactQ, string(taskJSON)))
-
-	} else {
-		_, err = redis.Int64(rc.Do("rpush", contactQ, string(taskJSON)))
-	}
-	if err != nil {
-		return errors.Wrapf(err, "error adding contact event")
-	}
-
-	// create our contact event
-	contactTask := &HandleEventTask{ContactID: contactID}
-
-	// then add a handle task for that contact
-	err = queue.AddTask(rc, queue.HandlerQueue, queue.HandleContactEvent, task.OrgID, contactTask, queue.DefaultPriority)
-	if err != nil {
-		return errors.Wrapf(err, "error adding handle event task")
-	}
-	return nil
+	return queue.AddContactEvent(rc, int64(contactID), task, front)
 }
 
 func handleEvent(ctx context.Context, mr *mailroom.Mailroom, task *queue.Task) error {
-	return handleContactEvent(ctx, mr.DB, mr.RP, task)
+	return handleContactEvent(ctx, mr.DB, mr.RP, mr.S3Client, task)
 }
 
 // handleContactEvent is called when an event comes in for a contact.  to make sure we don't get into
 // a situation of being off by one, this task ingests and handles all the events for a contact, one by one
-func handleContactEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, task *queue.Task) error {
+func handleContactEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, s3Client s3iface.S3API, task *queue.Task) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
 	defer cancel()
 
@@ -105,7 +82,7 @@ func handleContactEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, task *
 	defer locker.ReleaseLock(rp, lockID, lock)
 
 	// read all the events for this contact, one by one
-	contactQ := fmt.Sprintf("c:%d:%d", task.OrgID, eventTask.ContactID)
+	contactQ := queue.ContactQueue(task.OrgID, int64(eventTask.ContactID))
 	for {
 		// pop the next event off this contacts queue
 		rc := rp.Get()
@@ -156,7 +133,7 @@ func handleContactEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, task *
 			if err != nil {
 				return errors.Wrapf(err, "error unmarshalling msg event: %s", event)
 			}
-			err = handleMsgEvent(ctx, db, rp, msg)
+			err = handleMsgEvent(ctx, db, rp, s3Client, msg)
 
 		case TimeoutEventType, ExpirationEventType:
 			evt := &TimedEvent{}
@@ -166,6 +143,14 @@ func handleContactEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, task *
 			}
 			err = handleTimedEvent(ctx, db, rp, contactEvent.Type, evt)
 
+		case CallbackEventType:
+			evt := &CallbackEvent{}
+			err = json.Unmarshal(contactEvent.Task, evt)
+			if err != nil {
+				return errors.Wrapf(err, "error unmarshalling callback event: %s", event)
+			}
+			err = handleCallbackEvent(ctx, db, rp, evt)
+
 		default:
 			return errors.Errorf("unknown contact event type: %s", contactEvent.Type)
 		}
@@ -469,28 +454,45 @@ func handleStopEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *St
 }
 
 // handleMsgEvent is called when a new message arrives from a contact
-func handleMsgEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *MsgEvent) error {
+func handleMsgEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, s3Client s3iface.S3API, event *MsgEvent) error {
+	// carriers sometimes resend messages, ignore any we've already handled
+	rc := rp.Get()
+	dupe, err := checkDuplicateMsg(rc, event, time.Second*time.Duration(config.Mailroom.MsgDedupeWindow), time.Second*time.Duration(config.Mailroom.MsgDedupeHashWindow))
+	rc.Close()
+	if err != nil {
+		return errors.Wrapf(err, "error checking for duplicate message")
+	}
+	if dupe {
+		logrus.WithField("msg_id", event.MsgID).WithField("contact_id", event.ContactID).WithField("external_id", event.MsgExternalID).Info("ignoring duplicate incoming message")
+		err := models.UpdateMessage(ctx, db, event.MsgID, models.MsgStatusHandled, models.VisibilityArchived, models.TypeInbox, models.NilTopupID)
+		if err != nil {
+			return errors.Wrapf(err, "error marking duplicate message as handled")
+		}
+		return nil
+	}
+
 	org, err := models.GetOrgAssets(ctx, db, event.OrgID)
 	if err != nil {
 		return errors.Wrapf(err, "error loading org")
 	}
 
 	// find the topup for this message
-	rc := rp.Get()
+	rc = rp.Get()
 	topup, err := models.DecrementOrgCredits(ctx, db, rc, event.OrgID, 1)
-	rc.Close()
 	if err != nil {
+		rc.Close()
 		return errors.Wrapf(err, "error calculating topup for msg")
 	}
+	rc.Close()
 
-	// load our contact
-	contacts, err := models.LoadContacts(ctx, db, org, []models.ContactID{event.ContactID})
+	// load our contact, which for bursts of messages from the same contact can come from a cached snapshot
+	modelContact, err := models.LoadCachedContact(ctx, db, rp, org, event.ContactID, time.Second*time.Duration(config.Mailroom.ContactCacheTTL))
 	if err != nil {
 		return errors.Wrapf(err, "error loading contact")
 	}
 
 	// contact has been deleted, ignore this message but mark it as handled
-	if len(contacts) == 0 {
+	if modelContact == nil {
 		err := models.UpdateMessage(ctx, db, event.MsgID, models.MsgStatusHandled, models.VisibilityArchived, models.TypeInbox, topup)
 		if err != nil {
 			return errors.Wrapf(err, "error updating message for deleted contact")
@@ -504,8 +506,6 @@ func handleMsgEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *Msg
 		return errors.Wrapf(err, "unable to load session assets")
 	}
 
-	modelContact := contacts[0]
-
 	// load the channel for this message
 	channel := org.ChannelByID(event.ChannelID)
 
@@ -532,6 +532,17 @@ func handleMsgEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *Msg
 		return nil
 	}
 
+	// usage isn't worth failing over, log and move on
+	if err := models.IncrementOrgUsage(ctx, db, event.OrgID, models.UsageMsgsHandled, 1); err != nil {
+		logrus.WithError(err).WithField("org_id", event.OrgID).Error("error incrementing msg usage")
+	}
+
+	// download any attachments which are hosted by the provider and will expire
+	err = rehostAttachments(ctx, db, s3Client, channel, event)
+	if err != nil {
+		return errors.Wrapf(err, "error re-hosting attachments")
+	}
+
 	// stopped contact? they are unstopped if they send us an incoming message
 	newContact := event.NewContact
 	if modelContact.IsStopped() {
@@ -551,6 +562,22 @@ func handleMsgEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *Msg
 		}
 	}
 
+	// contacts without a language get the language of their message if the org detects languages, so that they're
+	// sent localized flows and campaigns from now on
+	languageChanged, err := models.InferContactLanguage(ctx, db, org, contact, event.Text)
+	if err != nil {
+		return errors.Wrapf(err, "error inferring contact language")
+	}
+	if languageChanged != nil {
+		logrus.WithField("contact_uuid", contact.UUID()).WithField("event_type", languageChanged.Type()).WithField("language", languageChanged.Language).Info("contact language inferred from message")
+	}
+
+	// org auto responses take precedence over triggers and any active session
+	response := org.FindMatchingAutoResponse(event.Text)
+	if response != nil {
+		return sendAutoResponse(ctx, db, rp, org, channel, modelContact, event, response, topup)
+	}
+
 	// find any matching triggers
 	trigger := models.FindMatchingMsgTrigger(org, contact, event.Text)
 
@@ -563,7 +590,7 @@ func handleMsgEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *Msg
 	// we have a session and it has an active flow, check whether we should honor triggers
 	var flow *models.Flow
 	if session != nil && session.CurrentFlowID() != models.NilFlowID {
-		flow, err = org.FlowByID(session.CurrentFlowID())
+		flow, err = org.SessionFlowByID(session.CurrentFlowID())
 
 		// flow this session is in is gone, interrupt our session and reset it
 		if err == models.ErrNotFound {
@@ -576,7 +603,20 @@ func handleMsgEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *Msg
 		}
 	}
 
-	msgIn := flows.NewMsgIn(event.MsgUUID, event.URN, channel.ChannelReference(), event.Text, event.Attachments)
+	// if the contact is replying with a number from a menu we sent them in place of quick replies, their input is
+	// the option they chose
+	text := event.Text
+	if session != nil && flow != nil {
+		choice, err := models.MenuChoice(ctx, db, modelContact.ID(), event.Text)
+		if err != nil {
+			return errors.Wrapf(err, "error checking for menu choice")
+		}
+		if choice != "" {
+			text = choice
+		}
+	}
+
+	msgIn := flows.NewMsgIn(event.MsgUUID, event.URN, channel.ChannelReference(), text, event.Attachments)
 	msgIn.SetExternalID(string(event.MsgExternalID))
 	msgIn.SetID(event.MsgID)
 
@@ -617,10 +657,29 @@ func handleMsgEvent(ctx context.Context, db *sqlx.DB, rp *redis.Pool, event *Msg
 				return nil
 			}
 
+			// if this contact was started in this flow moments ago, e.g. by a double texted keyword, ignore this trigger
+			rc = rp.Get()
+			allowed, err := runner.SuppressDuplicateStarts(rc, org.OrgID(), flow.ID(), []models.ContactID{modelContact.ID()}, time.Second*time.Duration(config.Mailroom.StartSuppressionWindow))
+			rc.Close()
+			if err != nil {
+				return errors.Wrapf(err, "error checking for duplicate start")
+			}
+			if len(allowed) == 0 {
+				logrus.WithField("contact_id", modelContact.ID()).WithField("flow_id", flow.ID()).Info("ignoring trigger, contact already started in flow within suppression window")
+				return models.UpdateMessage(ctx, db, event.MsgID, models.MsgStatusHandled, models.VisibilityVisible, models.TypeFlow, topup)
+			}
+
 			// otherwise build the trigger and start the flow directly
 			trigger := triggers.NewMsg(org.Env(), flow.FlowReference(), contact, msgIn, trigger.Match())
 			_, err = runner.StartFlowForContacts(ctx, db, rp, org, sa, flow, []flows.Trigger{trigger}, hook, true)
 			if err != nil {
+				// release our claim so that a retry of this message isn't suppressed
+				rc = rp.Get()
+				releaseErr := runner.ReleaseDuplicateStarts(rc, org.OrgID(), flow.ID(), allowed)
+				rc.Close()
+				if releaseErr != nil {
+					logrus.WithError(releaseErr).WithField("contact_id", modelContact.ID()).Error("error releasing duplicate start claim")
+				}
 				return errors.Wrapf(err, "error starting flow for contact")
 			}
 			return nil
@@ -3,6 +3,7 @@ package interrupts
 import (
 	"context"
 	"encoding/json"
+	"sort"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -11,6 +12,7 @@ import (
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/queue"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 func init() {
@@ -23,6 +25,9 @@ type InterruptSessionsTask struct {
 	ContactIDs []models.ContactID `json:"contact_ids,omitempty"`
 	ChannelIDs []models.ChannelID `json:"channel_ids,omitempty"`
 	FlowIDs    []models.FlowID    `json:"flow_ids,omitempty"`
+
+	// if set, the sessions that would be interrupted are resolved and logged but not interrupted
+	DryRun bool `json:"dry_run,omitempty"`
 }
 
 const activeSessionIDsForChannelsSQL = `
@@ -71,11 +76,12 @@ func handleInterruptSessions(ctx context.Context, mr *mailroom.Mailroom, task *q
 		return errors.Wrapf(err, "error unmarshalling interrupt task: %s", string(task.Task))
 	}
 
-	return interruptSessions(ctx, mr.DB, intTask)
+	_, err = interruptSessions(ctx, mr.DB, intTask)
+	return err
 }
 
-// InterruptSessions interrupts all the passed in sessions
-func interruptSessions(ctx context.Context, db *sqlx.DB, task *InterruptSessionsTask) error {
+// ResolveSessionIDs returns the ids of the sessions which the passed in task would interrupt, in ascending order
+func ResolveSessionIDs(ctx context.Context, db *sqlx.DB, task *InterruptSessionsTask) ([]models.SessionID, error) {
 	sessionIDs := make(map[models.SessionID]bool)
 	for _, sid := range task.SessionIDs {
 		sessionIDs[sid] = true
@@ -87,7 +93,7 @@ func interruptSessions(ctx context.Context, db *sqlx.DB, task *InterruptSessions
 
 		err := db.SelectContext(ctx, &channelSessionIDs, activeSessionIDsForChannelsSQL, pq.Array(task.ChannelIDs))
 		if err != nil {
-			return errors.Wrapf(err, "error selecting sessions for channels")
+			return nil, errors.Wrapf(err, "error selecting sessions for channels")
 		}
 
 		for _, sid := range channelSessionIDs {
@@ -101,7 +107,7 @@ func interruptSessions(ctx context.Context, db *sqlx.DB, task *InterruptSessions
 
 		err := db.SelectContext(ctx, &contactSessionIDs, activeSessionIDsForContactsSQL, pq.Array(task.ContactIDs))
 		if err != nil {
-			return errors.Wrapf(err, "error selecting sessions for contacts")
+			return nil, errors.Wrapf(err, "error selecting sessions for contacts")
 		}
 
 		for _, sid := range contactSessionIDs {
@@ -115,7 +121,7 @@ func interruptSessions(ctx context.Context, db *sqlx.DB, task *InterruptSessions
 
 		err := db.SelectContext(ctx, &flowSessionIDs, activeSessionIDsForFlowsSQL, pq.Array(task.FlowIDs))
 		if err != nil {
-			return errors.Wrapf(err, "error selecting sessions for flows")
+			return nil, errors.Wrapf(err, "error selecting sessions for flows")
 		}
 
 		for _, sid := range flowSessionIDs {
@@ -127,11 +133,28 @@ func interruptSessions(ctx context.Context, db *sqlx.DB, task *InterruptSessions
 	for id := range sessionIDs {
 		uniqueSessionIDs = append(uniqueSessionIDs, id)
 	}
+	sort.Slice(uniqueSessionIDs, func(i, j int) bool { return uniqueSessionIDs[i] < uniqueSessionIDs[j] })
+
+	return uniqueSessionIDs, nil
+}
+
+// interruptSessions interrupts all the passed in sessions, returning the ids of the sessions which were interrupted,
+// or for a dry run, which would have been
+func interruptSessions(ctx context.Context, db *sqlx.DB, task *InterruptSessionsTask) ([]models.SessionID, error) {
+	sessionIDs, err := ResolveSessionIDs(ctx, db, task)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.DryRun {
+		logrus.WithField("session_ids", sessionIDs).WithField("count", len(sessionIDs)).Info("dry run, not interrupting sessions")
+		return sessionIDs, nil
+	}
 
 	// interrupt all sessions and their associated runs
-	err := models.ExitSessions(ctx, db, uniqueSessionIDs, models.ExitInterrupted, time.Now())
+	err = models.ExitSessions(ctx, db, sessionIDs, models.ExitInterrupted, time.Now())
 	if err != nil {
-		return errors.Wrapf(err, "error interrupting sessions")
+		return nil, errors.Wrapf(err, "error interrupting sessions")
 	}
-	return nil
+	return sessionIDs, nil
 }
@@ -3,6 +3,7 @@ package interrupts
 import (
 	"testing"
 
+	"github.com/lib/pq"
 	"github.com/nyaruka/goflow/utils/uuids"
 	_ "github.com/nyaruka/mailroom/hooks"
 	"github.com/nyaruka/mailroom/models"
@@ -100,9 +101,29 @@ func TestInterrupts(t *testing.T) {
 			FlowIDs:    tc.FlowIDs,
 		}
 
+		expectedIDs := make([]models.SessionID, 0, 5)
+		for j, status := range tc.StatusesAfter {
+			if status == "I" {
+				expectedIDs = append(expectedIDs, sessionIDs[j])
+			}
+		}
+
+		// a dry run of the same task returns the sessions which would be interrupted but changes nothing
+		wouldInterrupt, err := interruptSessions(ctx, db, &InterruptSessionsTask{
+			SessionIDs: task.SessionIDs,
+			ContactIDs: task.ContactIDs,
+			ChannelIDs: task.ChannelIDs,
+			FlowIDs:    task.FlowIDs,
+			DryRun:     true,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, expectedIDs, wouldInterrupt, "%d: dry run sessions mismatch", i)
+		testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowsession WHERE id = ANY($1) AND status = 'W'`, []interface{}{pq.Array(sessionIDs)}, 5, "%d: dry run interrupted sessions", i)
+
 		// execute it
-		err := interruptSessions(ctx, db, task)
+		interrupted, err := interruptSessions(ctx, db, task)
 		assert.NoError(t, err)
+		assert.Equal(t, expectedIDs, interrupted, "%d: interrupted sessions mismatch", i)
 
 		// check session statuses are as expected
 		for j, sID := range sessionIDs {
@@ -18,6 +18,9 @@ import (
 
 func init() {
 	mailroom.AddTaskFunction(queue.StartIVRFlowBatch, handleFlowStartTask)
+
+	// never retried as contacts already called by the batch would be called again
+	queue.RegisterRetryPolicy(queue.StartIVRFlowBatch, &queue.RetryPolicy{MaxAttempts: 1, DeadLetter: true})
 }
 
 func handleFlowStartTask(ctx context.Context, mr *mailroom.Mailroom, task *queue.Task) error {
@@ -9,6 +9,7 @@ import (
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/mailroom/config"
 	"github.com/nyaruka/mailroom/ivr"
@@ -91,7 +92,7 @@ func (c *MockClient) WriteSessionResponse(session *models.Session, resumeURL str
 	return nil
 }
 
-func (c *MockClient) WriteErrorResponse(w http.ResponseWriter, err error) error {
+func (c *MockClient) WriteErrorResponse(w http.ResponseWriter, msg string, err error) error {
 	return nil
 }
 
@@ -99,6 +100,10 @@ func (c *MockClient) WriteEmptyResponse(w http.ResponseWriter, msg string) error
 	return nil
 }
 
+func (c *MockClient) WriteRetryResponse(prompt string, resumeURL string, wait flows.ActivatedWait, w http.ResponseWriter) error {
+	return nil
+}
+
 func (c *MockClient) InputForRequest(r *http.Request) (string, utils.Attachment, error) {
 	return "", ivr.NilAttachment, nil
 }
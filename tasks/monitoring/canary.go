@@ -0,0 +1,105 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/librato"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	canaryLock = "canary_monitor"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartCanaryCron)
+}
+
+// StartCanaryCron starts our cron job of reporting task outcomes and comparing canary tasks with the rest every minute
+func StartCanaryCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, canaryLock, time.Minute,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			_, err := compareCanary(ctx, mr.RP, time.Now())
+			return err
+		},
+	)
+	return nil
+}
+
+// canaryComparison is how the tasks of a type handled from a canary queue in a minute compare with the tasks of the
+// same type handled from its base queue
+type canaryComparison struct {
+	Queue    string
+	TaskType string
+	Canary   *queue.OutcomeStats
+	Base     *queue.OutcomeStats
+}
+
+// compareCanary reports the task outcomes of the minute before the passed in time, and compares the outcomes of tasks
+// handled from canary queues with those of the same types handled from their base queues
+func compareCanary(ctx context.Context, rp *redis.Pool, now time.Time) ([]*canaryComparison, error) {
+	log := logrus.WithField("comp", "canary_monitor")
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	stats, err := queue.ReadOutcomes(rc, now.Add(-time.Minute))
+	if err != nil {
+		return nil, err
+	}
+
+	base := make(map[string]*queue.OutcomeStats)
+	for _, s := range stats {
+		taskType := s.TaskType
+		if taskType == "" {
+			taskType = "all"
+		}
+
+		librato.Gauge(fmt.Sprintf("mr.tasks.%s.%s.count", s.Queue, taskType), float64(s.Count))
+		librato.Gauge(fmt.Sprintf("mr.tasks.%s.%s.error_rate", s.Queue, taskType), s.ErrorRate())
+		librato.Gauge(fmt.Sprintf("mr.tasks.%s.%s.mean_ms", s.Queue, taskType), float64(s.MeanElapsed/time.Millisecond))
+
+		if !queue.IsCanary(s.Queue) {
+			base[s.Queue+":"+s.TaskType] = s
+		}
+	}
+
+	comparisons := make([]*canaryComparison, 0)
+	for _, s := range stats {
+		if !queue.IsCanary(s.Queue) {
+			continue
+		}
+
+		c := &canaryComparison{
+			Queue:    queue.BaseQueue(s.Queue),
+			TaskType: s.TaskType,
+			Canary:   s,
+			Base:     base[queue.BaseQueue(s.Queue)+":"+s.TaskType],
+		}
+		comparisons = append(comparisons, c)
+
+		fields := logrus.Fields{
+			"queue":               c.Queue,
+			"task_type":           c.TaskType,
+			"canary_count":        s.Count,
+			"canary_error_rate":   s.ErrorRate(),
+			"canary_mean_elapsed": s.MeanElapsed,
+		}
+		if c.Base != nil {
+			fields["base_count"] = c.Base.Count
+			fields["base_error_rate"] = c.Base.ErrorRate()
+			fields["base_mean_elapsed"] = c.Base.MeanElapsed
+		}
+		log.WithFields(fields).Info("canary comparison")
+	}
+
+	return comparisons, nil
+}
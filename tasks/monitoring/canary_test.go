@@ -0,0 +1,44 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareCanary(t *testing.T) {
+	ctx, _, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	handled := time.Date(2020, 4, 15, 12, 0, 30, 0, time.UTC)
+	canaryQueue := queue.CanaryQueue(queue.HandlerQueue)
+
+	require.NoError(t, queue.RecordOutcome(rc, queue.HandlerQueue, queue.HandleContactEvent, handled, time.Millisecond*10, false))
+	require.NoError(t, queue.RecordOutcome(rc, canaryQueue, queue.HandleContactEvent, handled, time.Millisecond*20, true))
+	require.NoError(t, queue.RecordOutcome(rc, canaryQueue, queue.StartFlow, handled, time.Millisecond*20, false))
+
+	comparisons, err := compareCanary(ctx, rp, handled.Add(time.Minute))
+	require.NoError(t, err)
+
+	// one for each canary task type and one for the canary queue as a whole
+	require.Equal(t, 3, len(comparisons))
+
+	assert.Equal(t, queue.HandlerQueue, comparisons[0].Queue)
+	assert.Equal(t, queue.HandleContactEvent, comparisons[0].TaskType)
+	assert.Equal(t, 1.0, comparisons[0].Canary.ErrorRate())
+	require.NotNil(t, comparisons[0].Base)
+	assert.Equal(t, 0.0, comparisons[0].Base.ErrorRate())
+
+	// no flow starts were handled from the base queue to compare with
+	assert.Equal(t, queue.StartFlow, comparisons[1].TaskType)
+	assert.Nil(t, comparisons[1].Base)
+
+	assert.Equal(t, "", comparisons[2].TaskType)
+	assert.Equal(t, 2, comparisons[2].Canary.Count)
+	assert.Equal(t, 1, comparisons[2].Base.Count)
+}
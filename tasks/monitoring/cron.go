@@ -0,0 +1,156 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mail.v2"
+)
+
+const (
+	monitorLock = "channel_monitor"
+
+	// androidMaxSilence is how long an Android channel can go without syncing before we consider it dead
+	androidMaxSilence = time.Hour
+
+	// errorsWindow is how far back we look at outgoing messages when calculating channel error rates
+	errorsWindow = time.Minute * 30
+
+	// a channel needs to have sent at least this many messages in our window, most of which failed, to be dead
+	errorsMinMsgs  = 20
+	errorsDeadRate = 0.9
+
+	// the name our notification emails are sent from
+	notificationFrom = "Mailroom"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartMonitorCron)
+}
+
+// StartMonitorCron starts our cron job of checking for dead channels every five minutes
+func StartMonitorCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, monitorLock, time.Minute*5,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancel()
+			return checkChannels(ctx, mr.DB, mr.RP, mr.Config.SMTPServer, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// checkChannels opens incidents for channels which appear to be dead, and resolves the incidents of channels which
+// have recovered, notifying org admins of both
+func checkChannels(ctx context.Context, db *sqlx.DB, rp *redis.Pool, smtpServer string, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "channel_monitor").WithField("lock", lockValue)
+	start := time.Now()
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	dead, err := models.FindDeadChannels(ctx, db, start.Add(-androidMaxSilence), start.Add(-errorsWindow), errorsMinMsgs, errorsDeadRate)
+	if err != nil {
+		return errors.Wrapf(err, "error finding dead channels")
+	}
+
+	incidents, err := models.GetChannelIncidents(rc)
+	if err != nil {
+		return errors.Wrapf(err, "error loading channel incidents")
+	}
+
+	opened, resolved := 0, 0
+	isDead := make(map[models.ChannelID]bool, len(dead))
+
+	for _, p := range dead {
+		isDead[p.ChannelID] = true
+
+		incident := &models.ChannelIncident{
+			ChannelID:   p.ChannelID,
+			ChannelUUID: p.ChannelUUID,
+			ChannelName: p.ChannelName,
+			OrgID:       p.OrgID,
+			Reason:      p.Reason,
+			OpenedOn:    start,
+		}
+		isNew, err := models.OpenChannelIncident(rc, incident)
+		if err != nil {
+			return err
+		}
+		if isNew {
+			opened++
+			log.WithField("org_id", p.OrgID).WithField("channel_uuid", p.ChannelUUID).WithField("reason", p.Reason).Warn("channel incident opened")
+
+			subject := fmt.Sprintf("Your channel %s appears to be down", p.ChannelName)
+			body := fmt.Sprintf("We haven't been able to use your channel %s (%s) since %s: %s.\n\nAny backup channel configured for it will be used for sends until it recovers.", p.ChannelName, p.ChannelUUID, start.UTC().Format(time.RFC1123), p.Reason)
+			notifyAdmins(ctx, db, smtpServer, p.OrgID, subject, body)
+		}
+	}
+
+	for channelID, incident := range incidents {
+		if isDead[channelID] {
+			continue
+		}
+
+		if err := models.ResolveChannelIncident(rc, channelID); err != nil {
+			return err
+		}
+		resolved++
+		log.WithField("org_id", incident.OrgID).WithField("channel_uuid", incident.ChannelUUID).Info("channel incident resolved")
+
+		subject := fmt.Sprintf("Your channel %s has recovered", incident.ChannelName)
+		body := fmt.Sprintf("Your channel %s (%s) which appeared to be down since %s has recovered.", incident.ChannelName, incident.ChannelUUID, incident.OpenedOn.UTC().Format(time.RFC1123))
+		notifyAdmins(ctx, db, smtpServer, incident.OrgID, subject, body)
+	}
+
+	log.WithField("elapsed", time.Since(start)).WithField("opened", opened).WithField("resolved", resolved).Info("checked channels")
+	return nil
+}
+
+// notifyAdmins emails the admins of the passed in org, failures are logged but otherwise ignored
+func notifyAdmins(ctx context.Context, db *sqlx.DB, smtpServer string, orgID models.OrgID, subject string, body string) {
+	log := logrus.WithField("comp", "channel_monitor").WithField("org_id", orgID)
+
+	if smtpServer == "" {
+		log.Debug("no SMTP server configured, not notifying admins")
+		return
+	}
+
+	emails, err := models.GetOrgAdminEmails(ctx, db, orgID)
+	if err != nil {
+		log.WithError(err).Error("error loading admin emails")
+		return
+	}
+	if len(emails) == 0 {
+		return
+	}
+
+	if err := sendEmail(smtpServer, emails, subject, body); err != nil {
+		log.WithError(err).Error("error notifying admins")
+	}
+}
+
+// sendEmail sends an email using the passed in SMTP URL, e.g. smtp://user%40password@server:port/?from=foo%40gmail.com
+func sendEmail(smtpServer string, to []string, subject string, body string) error {
+	smtp, err := models.ParseSMTPConfig(smtpServer)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse smtp config")
+	}
+
+	m := mail.NewMessage()
+	m.SetAddressHeader("From", smtp.From, notificationFrom)
+	m.SetHeader("To", to...)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/plain", body)
+
+	d := mail.NewDialer(smtp.Host, smtp.Port, smtp.Username, smtp.Password)
+	return errors.Wrapf(d.DialAndSend(m), "error sending email")
+}
@@ -0,0 +1,46 @@
+package monitoring
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckChannels(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	// make nexmo an Android channel which hasn't synced in a while
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'A', last_seen = NOW() - INTERVAL '2 hours' WHERE id = $1`, models.NexmoChannelID)
+
+	err := checkChannels(ctx, db, rp, "", "test", "test")
+	assert.NoError(t, err)
+
+	incidents, err := models.GetChannelIncidents(rc)
+	require.NoError(t, err)
+	require.Contains(t, incidents, models.NexmoChannelID)
+	assert.Equal(t, models.NexmoChannelUUID, incidents[models.NexmoChannelID].ChannelUUID)
+	assert.Equal(t, models.Org1, incidents[models.NexmoChannelID].OrgID)
+
+	// checking again leaves the incident open
+	err = checkChannels(ctx, db, rp, "", "test", "test")
+	assert.NoError(t, err)
+
+	incidents, err = models.GetChannelIncidents(rc)
+	require.NoError(t, err)
+	assert.Contains(t, incidents, models.NexmoChannelID)
+
+	// once it syncs again the incident is resolved
+	db.MustExec(`UPDATE channels_channel SET last_seen = NOW() WHERE id = $1`, models.NexmoChannelID)
+
+	err = checkChannels(ctx, db, rp, "", "test", "test")
+	assert.NoError(t, err)
+
+	incidents, err = models.GetChannelIncidents(rc)
+	require.NoError(t, err)
+	assert.NotContains(t, incidents, models.NexmoChannelID)
+}
@@ -0,0 +1,208 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/librato"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	latencyLock = "latency_monitor"
+
+	sloBreachesKey = "latency_slo_breaches"
+	sloIncidentKey = "latency_slo_incident"
+)
+
+var sloHTTPClient = &http.Client{Timeout: time.Duration(10 * time.Second)}
+
+func init() {
+	mailroom.AddInitFunction(StartLatencyCron)
+}
+
+// StartLatencyCron starts our cron job of reporting task latencies and checking them against our SLO every minute
+func StartLatencyCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, latencyLock, time.Minute,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			return checkLatency(ctx, mr.RP, mr.Config, time.Now())
+		},
+	)
+	return nil
+}
+
+// latencyIncident is an open breach of our latency SLO
+type latencyIncident struct {
+	Reason   string    `json:"reason"`
+	OpenedOn time.Time `json:"opened_on"`
+}
+
+// checkLatency reports the task latencies of the minute before the passed in time, and if an SLO is configured, checks
+// the latency of handler tasks against it. An incident is opened once the SLO has been breached for enough consecutive
+// minutes, and resolved by the first minute it isn't breached.
+func checkLatency(ctx context.Context, rp *redis.Pool, cfg *config.Config, now time.Time) error {
+	log := logrus.WithField("comp", "latency_monitor")
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	stats, err := queue.ReadLatencies(rc, now.Add(-time.Minute))
+	if err != nil {
+		return err
+	}
+
+	var handlerStats *queue.LatencyStats
+
+	for _, s := range stats {
+		taskType := s.TaskType
+		if taskType == "" {
+			taskType = "all"
+			if s.Queue == queue.HandlerQueue {
+				handlerStats = s
+			}
+		}
+
+		log.WithFields(logrus.Fields{
+			"queue":     s.Queue,
+			"task_type": taskType,
+			"count":     s.Count,
+			"p50":       s.P50,
+			"p95":       s.P95,
+			"p99":       s.P99,
+		}).Info("task latency")
+
+		librato.Gauge(fmt.Sprintf("mr.latency.%s.%s.p95_ms", s.Queue, taskType), float64(s.P95/time.Millisecond))
+		librato.Gauge(fmt.Sprintf("mr.latency.%s.%s.p99_ms", s.Queue, taskType), float64(s.P99/time.Millisecond))
+	}
+
+	if cfg.LatencySLO <= 0 {
+		return nil
+	}
+
+	slo := time.Duration(cfg.LatencySLO) * time.Millisecond
+	reason := ""
+
+	if handlerStats != nil {
+		if handlerStats.P95 > slo {
+			reason = fmt.Sprintf("p95 latency of handler tasks was %s, above the SLO of %s", handlerStats.P95, slo)
+		}
+	} else {
+		// no tasks being started is only a problem if there are tasks waiting
+		size, err := queue.Size(rc, queue.HandlerQueue)
+		if err != nil {
+			return err
+		}
+		if size > 0 {
+			reason = fmt.Sprintf("no handler tasks were started while %d were queued", size)
+		}
+	}
+
+	if reason == "" {
+		return resolveLatencyIncident(ctx, rc, cfg, now)
+	}
+
+	breaches, err := redis.Int(rc.Do("incr", sloBreachesKey))
+	if err != nil {
+		return errors.Wrapf(err, "error recording latency SLO breach")
+	}
+	rc.Do("expire", sloBreachesKey, 3600)
+
+	log.WithField("breaches", breaches).Warn(reason)
+
+	if breaches < cfg.LatencySLOMinutes {
+		return nil
+	}
+
+	incident := &latencyIncident{Reason: reason, OpenedOn: now}
+	incidentJSON, err := json.Marshal(incident)
+	if err != nil {
+		return err
+	}
+
+	opened, err := redis.Bool(rc.Do("setnx", sloIncidentKey, incidentJSON))
+	if err != nil {
+		return errors.Wrapf(err, "error opening latency SLO incident")
+	}
+	if opened {
+		log.WithField("breaches", breaches).Errorf("latency SLO incident opened: %s", reason)
+		notifySLOWebhook(ctx, cfg.LatencySLOWebhook, map[string]interface{}{"status": "opened", "reason": reason, "opened_on": now})
+	}
+	return nil
+}
+
+// resets our count of breaches and resolves any open incident
+func resolveLatencyIncident(ctx context.Context, rc redis.Conn, cfg *config.Config, now time.Time) error {
+	if _, err := rc.Do("del", sloBreachesKey); err != nil {
+		return errors.Wrapf(err, "error resetting latency SLO breaches")
+	}
+
+	incidentJSON, err := redis.Bytes(rc.Do("get", sloIncidentKey))
+	if err == redis.ErrNil {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error reading latency SLO incident")
+	}
+
+	incident := &latencyIncident{}
+	if err := json.Unmarshal(incidentJSON, incident); err != nil {
+		return errors.Wrapf(err, "error unmarshalling latency SLO incident")
+	}
+
+	if _, err := rc.Do("del", sloIncidentKey); err != nil {
+		return errors.Wrapf(err, "error resolving latency SLO incident")
+	}
+
+	logrus.WithField("comp", "latency_monitor").WithField("opened_on", incident.OpenedOn).Info("latency SLO incident resolved")
+	notifySLOWebhook(ctx, cfg.LatencySLOWebhook, map[string]interface{}{"status": "resolved", "reason": incident.Reason, "opened_on": incident.OpenedOn, "resolved_on": now})
+	return nil
+}
+
+// notifySLOWebhook posts the passed in payload to the passed in URL, failures are logged but otherwise ignored
+func notifySLOWebhook(ctx context.Context, url string, payload map[string]interface{}) {
+	if url == "" {
+		return
+	}
+	log := logrus.WithField("comp", "latency_monitor").WithField("url", url)
+
+	payload["incident"] = "latency_slo"
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.WithError(err).Error("error marshalling SLO webhook payload")
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.WithError(err).Error("error creating SLO webhook request")
+		return
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sloHTTPClient.Do(req)
+	if err != nil {
+		log.WithError(err).Error("error calling SLO webhook")
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		log.WithField("status", resp.StatusCode).Error("SLO webhook returned error status")
+	}
+}
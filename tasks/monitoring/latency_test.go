@@ -0,0 +1,87 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLatency(t *testing.T) {
+	ctx, _, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	notifications := make([]map[string]interface{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := make(map[string]interface{})
+		json.NewDecoder(r.Body).Decode(&payload)
+		notifications = append(notifications, payload)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{LatencySLO: 100, LatencySLOMinutes: 2, LatencySLOWebhook: server.URL}
+	start := time.Date(2020, 4, 15, 12, 0, 0, 0, time.UTC)
+
+	// checks the minute after one in which a handler task waited the passed in time to be started
+	checkMinute := func(minute int, latency time.Duration) {
+		started := start.Add(time.Duration(minute)*time.Minute + time.Second*30)
+		err := queue.RecordLatency(rc, queue.HandlerQueue, queue.HandleContactEvent, started.Add(-latency), started)
+		require.NoError(t, err)
+
+		err = checkLatency(ctx, rp, cfg, start.Add(time.Duration(minute+1)*time.Minute))
+		require.NoError(t, err)
+	}
+	incidentOpen := func() bool {
+		open, err := redis.Bool(rc.Do("exists", sloIncidentKey))
+		require.NoError(t, err)
+		return open
+	}
+
+	// latency within the SLO
+	checkMinute(0, time.Millisecond*50)
+	assert.False(t, incidentOpen())
+
+	// one minute of breaching the SLO isn't enough to open an incident
+	checkMinute(1, time.Millisecond*500)
+	assert.False(t, incidentOpen())
+	assert.Equal(t, 0, len(notifications))
+
+	// but two is
+	checkMinute(2, time.Millisecond*500)
+	assert.True(t, incidentOpen())
+	require.Equal(t, 1, len(notifications))
+	assert.Equal(t, "latency_slo", notifications[0]["incident"])
+	assert.Equal(t, "opened", notifications[0]["status"])
+	assert.Equal(t, "p95 latency of handler tasks was 500ms, above the SLO of 100ms", notifications[0]["reason"])
+
+	// further breaches don't open another
+	checkMinute(3, time.Millisecond*500)
+	assert.True(t, incidentOpen())
+	assert.Equal(t, 1, len(notifications))
+
+	// and the first minute within the SLO resolves it
+	checkMinute(4, time.Millisecond*20)
+	assert.False(t, incidentOpen())
+	require.Equal(t, 2, len(notifications))
+	assert.Equal(t, "resolved", notifications[1]["status"])
+
+	// a minute with no tasks started while some are queued is also a breach
+	err := queue.AddTask(rc, queue.HandlerQueue, queue.HandleContactEvent, 1, map[string]string{}, queue.DefaultPriority)
+	require.NoError(t, err)
+
+	err = checkLatency(ctx, rp, cfg, start.Add(time.Minute*10))
+	require.NoError(t, err)
+
+	breaches, err := redis.Int(rc.Do("get", sloBreachesKey))
+	require.NoError(t, err)
+	assert.Equal(t, 1, breaches)
+}
@@ -0,0 +1,51 @@
+package msgviews
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	countsLock = "msg_view_counts"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartCountsCron)
+}
+
+// StartCountsCron starts our cron job of updating the counts of saved message views every minute
+func StartCountsCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, countsLock, time.Minute,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancel()
+			return updateCounts(ctx, mr.DB, mr.RP, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// updateCounts adds new messages to the counts of all saved message views
+func updateCounts(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "msg_views_cron").WithField("lock", lockValue)
+	start := time.Now()
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	updated, err := models.UpdateMsgViewCounts(ctx, db, rc)
+	if err != nil {
+		return errors.Wrapf(err, "error updating msg view counts")
+	}
+
+	log.WithField("elapsed", time.Since(start)).WithField("views", updated).Info("updated msg view counts")
+	return nil
+}
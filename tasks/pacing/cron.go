@@ -0,0 +1,49 @@
+package pacing
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pacingLock = "queue_scheduled_tasks"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartPacingCron)
+}
+
+// StartPacingCron starts our cron job of queuing scheduled tasks, such as the batches of paced starts and broadcasts
+func StartPacingCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, pacingLock, time.Second*15,
+		func(lockName string, lockValue string) error {
+			return queueScheduledTasks(mr.RP, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// queueScheduledTasks adds any scheduled tasks which are now due to their queues
+func queueScheduledTasks(rp *redis.Pool, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "pacing_cron").WithField("lock", lockValue)
+	start := time.Now()
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	queued, err := queue.QueueScheduledTasks(rc, start)
+	if err != nil {
+		return errors.Wrapf(err, "error queuing scheduled tasks")
+	}
+
+	if queued > 0 {
+		log.WithField("elapsed", time.Since(start)).WithField("queued", queued).Info("queued scheduled tasks")
+	}
+	return nil
+}
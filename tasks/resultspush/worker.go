@@ -0,0 +1,76 @@
+package resultspush
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.AddTaskFunction(queue.PushFlowResults, handlePushFlowResults)
+
+	// endpoints are external so give them a few chances to come back before we give up on a push
+	queue.RegisterRetryPolicy(queue.PushFlowResults, &queue.RetryPolicy{
+		MaxAttempts: 4, Backoff: time.Minute, Multiplier: 3, MaxBackoff: time.Minute * 30, Jitter: 0.2, DeadLetter: true,
+	})
+}
+
+var pushHTTPClient = &http.Client{Timeout: time.Duration(15 * time.Second)}
+
+// handlePushFlowResults pushes the rendered results of a completed run to its endpoint
+func handlePushFlowResults(ctx context.Context, mr *mailroom.Mailroom, task *queue.Task) error {
+	if task.Type != queue.PushFlowResults {
+		return errors.Errorf("unknown event type passed to results push worker: %s", task.Type)
+	}
+	pushTask := &models.ResultsPushTask{}
+	err := json.Unmarshal(task.Task, pushTask)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshalling results push task: %s", string(task.Task))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	return pushResults(ctx, pushTask)
+}
+
+// pushResults POSTs the body of the passed in push to its URL, any response other than a 2XX is a failure
+func pushResults(ctx context.Context, push *models.ResultsPushTask) error {
+	req, err := http.NewRequest(http.MethodPost, push.URL, strings.NewReader(push.Body))
+	if err != nil {
+		return errors.Wrapf(err, "error creating results push request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mailroom/"+config.Mailroom.Version)
+	for k, v := range push.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := pushHTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error pushing results for run: %s", push.RunUUID)
+	}
+	defer resp.Body.Close()
+
+	// read the body so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("results push for run %s returned status %d", push.RunUUID, resp.StatusCode)
+	}
+
+	logrus.WithField("flow_uuid", push.FlowUUID).WithField("run_uuid", push.RunUUID).WithField("url", push.URL).Debug("pushed flow results")
+	return nil
+}
@@ -0,0 +1,58 @@
+package resultspush
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushResults(t *testing.T) {
+	ctx := testsuite.CTX()
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(body))
+
+		if r.URL.Path == "/fhir/QuestionnaireResponse" {
+			assert.Equal(t, "application/fhir+json", r.Header.Get("Content-Type"))
+			assert.Equal(t, "Bearer sesame", r.Header.Get("Authorization"))
+		} else {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		}
+
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	push := &models.ResultsPushTask{
+		FlowUUID: "9de3663f-c5c5-4c92-9f45-ecbc09abcc85",
+		RunUUID:  "4f0a8a3f-2b6e-4a1f-9d7b-2a3c8e5f1d90",
+		URL:      server.URL + "/results",
+		Body:     `{"age": "23"}`,
+	}
+	err := pushResults(ctx, push)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"age": "23"}`}, received)
+
+	// pushes can have their own headers
+	push.URL = server.URL + "/fhir/QuestionnaireResponse"
+	push.Headers = map[string]string{"Content-Type": "application/fhir+json", "Authorization": "Bearer sesame"}
+	err = pushResults(ctx, push)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(received))
+
+	// non 2XX responses are errors so that the task is retried
+	push.URL = server.URL + "/fail"
+	err = pushResults(ctx, push)
+	assert.EqualError(t, err, "results push for run 4f0a8a3f-2b6e-4a1f-9d7b-2a3c8e5f1d90 returned status 503")
+}
@@ -0,0 +1,54 @@
+package revisions
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pruneLock = "prune_flow_revisions"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartPruneCron)
+}
+
+// StartPruneCron starts our cron job of pruning old flow revisions every hour, if a retention policy is configured
+func StartPruneCron(mr *mailroom.Mailroom) error {
+	if mr.Config.FlowRevisionsKeepLast <= 0 {
+		return nil
+	}
+
+	cron.StartCron(mr.Quit, mr.RP, pruneLock, time.Hour,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*30)
+			defer cancel()
+			return pruneRevisions(ctx, mr.DB, mr.Config, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// pruneRevisions deletes the revisions of flows which aren't kept by our retention policy
+func pruneRevisions(ctx context.Context, db *sqlx.DB, cfg *config.Config, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "revisions_pruner").WithField("lock", lockValue)
+	start := time.Now()
+
+	retention := &models.FlowRevisionRetention{KeepLast: cfg.FlowRevisionsKeepLast, KeepDays: cfg.FlowRevisionsKeepDays}
+
+	deleted, err := models.PruneFlowRevisions(ctx, db, retention)
+	if err != nil {
+		return errors.Wrapf(err, "error pruning flow revisions")
+	}
+
+	log.WithField("elapsed", time.Since(start)).WithField("deleted", deleted).Info("pruned flow revisions")
+	return nil
+}
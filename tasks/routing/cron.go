@@ -0,0 +1,54 @@
+package routing
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	errorRatesLock = "channel_error_rates"
+
+	// errorRatesWindow is how far back we look at outgoing messages when calculating channel error rates
+	errorRatesWindow = time.Minute * 15
+)
+
+func init() {
+	mailroom.AddInitFunction(StartErrorRatesCron)
+}
+
+// StartErrorRatesCron starts our cron job of calculating the error rates of channels used for routing every minute
+func StartErrorRatesCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, errorRatesLock, time.Minute,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			return updateErrorRates(ctx, mr.DB, mr.RP, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// updateErrorRates recalculates the recent error rates of channels which have a routing region
+func updateErrorRates(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "routing_cron").WithField("lock", lockValue)
+	start := time.Now()
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	updated, err := models.UpdateChannelErrorRates(ctx, db, rc, start.Add(-errorRatesWindow))
+	if err != nil {
+		return errors.Wrapf(err, "error updating channel error rates")
+	}
+
+	log.WithField("elapsed", time.Since(start)).WithField("channels", updated).Debug("updated channel error rates")
+	return nil
+}
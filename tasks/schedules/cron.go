@@ -55,6 +55,7 @@ func checkSchedules(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName s
 	broadcasts := 0
 	triggers := 0
 	noops := 0
+	skipped := 0
 
 	for _, s := range unfired {
 		log := log.WithField("schedule_id", s.ID())
@@ -74,6 +75,24 @@ func checkSchedules(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName s
 			continue
 		}
 
+		// if this schedule is paused, don't fire it. Repeating schedules skip this fire and one-off schedules are left
+		// to fire when resumed.
+		paused, err := models.IsSchedulePaused(rc, s.OrgID(), s.ID())
+		if err != nil {
+			log.WithError(err).Error("error checking whether schedule is paused")
+			continue
+		}
+		if paused {
+			if nextFire != nil {
+				err = s.UpdateNextFire(ctx, db, nextFire)
+				if err != nil {
+					log.WithError(err).Error("error skipping fire for paused schedule")
+				}
+			}
+			skipped++
+			continue
+		}
+
 		// open a transaction for committing all the items for this fire
 		tx, err := db.BeginTxx(ctx, nil)
 		if err != nil {
@@ -148,6 +167,7 @@ func checkSchedules(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName s
 		"broadcasts": broadcasts,
 		"triggers":   triggers,
 		"noops":      noops,
+		"skipped":    skipped,
 		"elapsed":    time.Since(start),
 	}).Info("fired schedules")
 
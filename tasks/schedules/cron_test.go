@@ -126,3 +126,61 @@ func TestCheckSchedules(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, task)
 }
+
+func TestPausedSchedules(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	insertSchedule := func(period string) models.ScheduleID {
+		var scheduleID models.ScheduleID
+		err := db.Get(
+			&scheduleID,
+			`INSERT INTO schedules_schedule(is_active, repeat_period, repeat_hour_of_day, repeat_minute_of_hour, created_on, modified_on, next_fire, created_by_id, modified_by_id, org_id)
+				VALUES(TRUE, $1, 12, 0, NOW(), NOW(), NOW()- INTERVAL '1 DAY', 1, 1, $2) RETURNING id`,
+			period, models.Org1,
+		)
+		assert.NoError(t, err)
+
+		db.MustExec(
+			`INSERT INTO triggers_trigger(is_active, created_on, modified_on, is_archived, trigger_type, created_by_id, modified_by_id, org_id, flow_id, schedule_id)
+				VALUES(TRUE, NOW(), NOW(), FALSE, 'S', 1, 1, $1, $2, $3)`,
+			models.Org1, models.FavoritesFlowID, scheduleID,
+		)
+		return scheduleID
+	}
+
+	oneOff := insertSchedule("O")
+	daily := insertSchedule("D")
+
+	// pause all of the org's schedules
+	err := models.SetSchedulesPaused(rc, models.Org1, nil, true)
+	assert.NoError(t, err)
+
+	err = checkSchedules(ctx, db, rp, "lock", "lock")
+	assert.NoError(t, err)
+
+	// nothing fired, one-off schedule still due, daily schedule skipped to its next fire
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowstart`, nil, 0)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM schedules_schedule WHERE id = $1 AND next_fire < NOW() AND last_fire IS NULL`, []interface{}{oneOff}, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM schedules_schedule WHERE id = $1 AND next_fire > NOW() AND last_fire IS NULL`, []interface{}{daily}, 1)
+
+	// resume the org but pause the one-off schedule individually
+	err = models.SetSchedulesPaused(rc, models.Org1, nil, false)
+	assert.NoError(t, err)
+	err = models.SetSchedulesPaused(rc, models.Org1, []models.ScheduleID{oneOff}, true)
+	assert.NoError(t, err)
+
+	err = checkSchedules(ctx, db, rp, "lock", "lock")
+	assert.NoError(t, err)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowstart`, nil, 0)
+
+	// resume it and it fires
+	err = models.SetSchedulesPaused(rc, models.Org1, []models.ScheduleID{oneOff}, false)
+	assert.NoError(t, err)
+
+	err = checkSchedules(ctx, db, rp, "lock", "lock")
+	assert.NoError(t, err)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowstart`, nil, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM schedules_schedule WHERE id = $1 AND next_fire IS NULL AND last_fire IS NOT NULL`, []interface{}{oneOff}, 1)
+}
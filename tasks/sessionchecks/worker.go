@@ -0,0 +1,67 @@
+package sessionchecks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.AddTaskFunction(queue.CheckFlowSessions, handleCheckFlowSessions)
+}
+
+// CheckFlowSessionsTask is our task for checking whether the sessions in a flow can continue in its latest revision,
+// queued when a flow is saved
+//
+//   {
+//     "flow_uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+//     "interrupt": true
+//   }
+//
+type CheckFlowSessionsTask struct {
+	FlowUUID  assets.FlowUUID `json:"flow_uuid"`
+	Interrupt bool            `json:"interrupt"`
+}
+
+// handleCheckFlowSessions checks the sessions in the flow of the passed in task and saves the result
+func handleCheckFlowSessions(ctx context.Context, mr *mailroom.Mailroom, task *queue.Task) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*30)
+	defer cancel()
+
+	if task.Type != queue.CheckFlowSessions {
+		return errors.Errorf("unknown event type passed to check flow sessions worker: %s", task.Type)
+	}
+	checkTask := &CheckFlowSessionsTask{}
+	err := json.Unmarshal(task.Task, checkTask)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshalling check flow sessions task: %s", string(task.Task))
+	}
+
+	rc := mr.RP.Get()
+	defer rc.Close()
+
+	return checkFlowSessions(ctx, mr.DB, rc, models.OrgID(task.OrgID), checkTask)
+}
+
+// checkFlowSessions checks the sessions in the flow of the passed in task, saving the result so it can be fetched
+func checkFlowSessions(ctx context.Context, db *sqlx.DB, rc redis.Conn, orgID models.OrgID, task *CheckFlowSessionsTask) error {
+	check, err := models.CheckFlowSessions(ctx, db, orgID, task.FlowUUID, task.Interrupt)
+	if err == models.ErrNotFound {
+		logrus.WithField("org_id", orgID).WithField("flow_uuid", task.FlowUUID).Info("skipping check of flow sessions, flow no longer active")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error checking flow sessions")
+	}
+
+	return models.SaveFlowSessionsCheck(rc, orgID, check)
+}
@@ -0,0 +1,33 @@
+package sessionchecks
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFlowSessions(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	err := checkFlowSessions(ctx, db, rc, models.Org1, &CheckFlowSessionsTask{FlowUUID: models.FavoritesFlowUUID})
+	require.NoError(t, err)
+
+	check, err := models.GetFlowSessionsCheck(rc, models.Org1, models.FavoritesFlowUUID)
+	require.NoError(t, err)
+	assert.Equal(t, models.FavoritesFlowUUID, check.FlowUUID)
+	assert.Equal(t, 0, len(check.Incompatible))
+
+	// flows which don't exist are skipped and nothing is saved for them
+	err = checkFlowSessions(ctx, db, rc, models.Org1, &CheckFlowSessionsTask{FlowUUID: "a45a1f63-6ecd-4b6c-9e3f-2cb4d0b7ac1f"})
+	require.NoError(t, err)
+
+	check, err = models.GetFlowSessionsCheck(rc, models.Org1, "a45a1f63-6ecd-4b6c-9e3f-2cb4d0b7ac1f")
+	require.NoError(t, err)
+	assert.Nil(t, check)
+}
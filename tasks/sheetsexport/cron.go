@@ -0,0 +1,271 @@
+package sheetsexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sheetsExportLock = "sheets_export"
+	appendBatchSize  = 500
+
+	tokenKey    = "sheets_export_token:%d"
+	backoffKey  = "sheets_export_backoff:%d"
+	failuresKey = "sheets_export_failures:%d"
+
+	initialBackoff = time.Minute
+	maxBackoff     = time.Hour
+)
+
+// the Google endpoints we use, which tests can point elsewhere
+var googleTokenURL = "https://oauth2.googleapis.com/token"
+var sheetsAPIURL = "https://sheets.googleapis.com/v4/spreadsheets"
+
+var sheetsHTTPClient = &http.Client{Timeout: time.Duration(30 * time.Second)}
+
+// returned by the sheets API when an org is making too many requests
+var errQuotaExceeded = errors.New("sheets API quota exceeded")
+
+func init() {
+	mailroom.AddInitFunction(StartSheetsExportCron)
+}
+
+// StartSheetsExportCron starts our cron job of appending queued rows to their sheets every 30 seconds
+func StartSheetsExportCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, sheetsExportLock, time.Second*30,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancel()
+			return exportSheets(ctx, mr.DB, mr.RP)
+		},
+	)
+	return nil
+}
+
+// exportSheets appends the rows queued for each flow to its sheet, in batches. Orgs whose appends fail, e.g. because
+// they've exceeded their quota, are backed off exponentially and their rows stay queued until they succeed.
+func exportSheets(ctx context.Context, db *sqlx.DB, rp *redis.Pool) error {
+	rc := rp.Get()
+	defer rc.Close()
+
+	pending, err := models.PendingSheetsExports(rc)
+	if err != nil {
+		return err
+	}
+
+	for orgID, flowUUIDs := range pending {
+		log := logrus.WithField("comp", "sheets_export").WithField("org_id", orgID)
+
+		backingOff, err := redis.Bool(rc.Do("exists", fmt.Sprintf(backoffKey, orgID)))
+		if err != nil {
+			return errors.Wrapf(err, "error checking backoff for org: %d", orgID)
+		}
+		if backingOff {
+			continue
+		}
+
+		org, err := models.GetOrgAssets(ctx, db, orgID)
+		if err != nil {
+			return errors.Wrapf(err, "error loading org assets for org: %d", orgID)
+		}
+
+		err = exportOrgSheets(ctx, rc, org, flowUUIDs)
+		if err != nil {
+			log.WithError(err).Error("error exporting to sheets")
+
+			delay, err := backOff(rc, orgID)
+			if err != nil {
+				return err
+			}
+			log.WithField("delay", delay).Info("backing off sheets exports")
+			continue
+		}
+
+		if _, err := rc.Do("del", fmt.Sprintf(failuresKey, orgID)); err != nil {
+			return errors.Wrapf(err, "error resetting failures for org: %d", orgID)
+		}
+	}
+
+	return nil
+}
+
+// appends the rows queued for each of the passed in flows in the passed in org
+func exportOrgSheets(ctx context.Context, rc redis.Conn, org *models.OrgAssets, flowUUIDs []assets.FlowUUID) error {
+	credentials := org.Org().SheetsCredentials()
+
+	for _, flowUUID := range flowUUIDs {
+		export := org.Org().SheetsExport(flowUUID)
+
+		for {
+			rows, err := models.ReadSheetsExportRows(rc, org.OrgID(), flowUUID, appendBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			// exports which have been removed since their rows were queued just drop them
+			if export == nil {
+				logrus.WithField("org_id", org.OrgID()).WithField("flow_uuid", flowUUID).WithField("rows", len(rows)).Warn("dropping rows for sheets export which no longer exists")
+			} else {
+				token, err := accessToken(ctx, rc, org.OrgID(), credentials)
+				if err != nil {
+					return err
+				}
+
+				values := make([][]string, len(rows))
+				for i, r := range rows {
+					values[i] = r.Values
+				}
+
+				err = appendRows(ctx, rc, org.OrgID(), token, export, values)
+				if err != nil {
+					return errors.Wrapf(err, "error appending rows for flow: %s", flowUUID)
+				}
+			}
+
+			err = models.TrimSheetsExportRows(rc, org.OrgID(), flowUUID, len(rows))
+			if err != nil {
+				return err
+			}
+			if len(rows) < appendBatchSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// records another failure for the passed in org and backs it off for twice as long as last time
+func backOff(rc redis.Conn, orgID models.OrgID) (time.Duration, error) {
+	failures, err := redis.Int(rc.Do("incr", fmt.Sprintf(failuresKey, orgID)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error recording failure for org: %d", orgID)
+	}
+	rc.Do("expire", fmt.Sprintf(failuresKey, orgID), int(maxBackoff.Seconds())*24)
+
+	delay := initialBackoff
+	for i := 1; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	_, err = rc.Do("set", fmt.Sprintf(backoffKey, orgID), failures, "ex", int(delay.Seconds()))
+	return delay, errors.Wrapf(err, "error backing off org: %d", orgID)
+}
+
+// returns an access token for the passed in org, refreshing it using its credentials if our cached one has expired
+func accessToken(ctx context.Context, rc redis.Conn, orgID models.OrgID, credentials *models.SheetsCredentials) (string, error) {
+	if credentials == nil {
+		return "", errors.Errorf("no sheets credentials configured for org: %d", orgID)
+	}
+
+	token, err := redis.String(rc.Do("get", fmt.Sprintf(tokenKey, orgID)))
+	if err != nil && err != redis.ErrNil {
+		return "", errors.Wrapf(err, "error reading access token for org: %d", orgID)
+	}
+	if token != "" {
+		return token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    []string{"refresh_token"},
+		"client_id":     []string{credentials.ClientID},
+		"client_secret": []string{credentials.ClientSecret},
+		"refresh_token": []string{credentials.RefreshToken},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, googleTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating token request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := sheetsHTTPClient.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "error refreshing access token for org: %d", orgID)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return "", errors.Errorf("refreshing access token for org %d returned status %d", orgID, resp.StatusCode)
+	}
+
+	refreshed := &struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(refreshed); err != nil || refreshed.AccessToken == "" {
+		return "", errors.Errorf("invalid access token response for org: %d", orgID)
+	}
+
+	// cache the token until shortly before it expires
+	if refreshed.ExpiresIn > 60 {
+		rc.Do("set", fmt.Sprintf(tokenKey, orgID), refreshed.AccessToken, "ex", refreshed.ExpiresIn-60)
+	}
+
+	return refreshed.AccessToken, nil
+}
+
+// appends the passed in rows to the sheet of the passed in export
+func appendRows(ctx context.Context, rc redis.Conn, orgID models.OrgID, token string, export *models.SheetsExport, values [][]string) error {
+	body, err := json.Marshal(map[string]interface{}{"values": values})
+	if err != nil {
+		return err
+	}
+
+	appendURL := fmt.Sprintf("%s/%s/values/%s:append?valueInputOption=RAW&insertDataOption=INSERT_ROWS", sheetsAPIURL, url.PathEscape(export.SpreadsheetID), url.PathEscape(export.Range()))
+
+	req, err := http.NewRequest(http.MethodPost, appendURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "error creating append request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := sheetsHTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error appending rows to spreadsheet: %s", export.SpreadsheetID)
+	}
+	defer resp.Body.Close()
+
+	// read the body so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return errQuotaExceeded
+	case resp.StatusCode == http.StatusUnauthorized:
+		// our token may have been revoked so get a new one next time
+		rc.Do("del", fmt.Sprintf(tokenKey, orgID))
+		return errors.Errorf("appending rows to spreadsheet %s returned status %d", export.SpreadsheetID, resp.StatusCode)
+	case resp.StatusCode/100 != 2:
+		return errors.Errorf("appending rows to spreadsheet %s returned status %d", export.SpreadsheetID, resp.StatusCode)
+	}
+
+	logrus.WithField("org_id", orgID).WithField("spreadsheet_id", export.SpreadsheetID).WithField("rows", len(values)).Debug("appended rows to sheet")
+	return nil
+}
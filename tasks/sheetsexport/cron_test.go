@@ -0,0 +1,122 @@
+package sheetsexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportSheets(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	rc := rp.Get()
+	defer rc.Close()
+
+	tokens := 0
+	quotaExceeded := false
+	var appended [][][]string
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			assert.Equal(t, "abcd", r.Form.Get("refresh_token"))
+			tokens++
+			w.Write([]byte(`{"access_token": "token1", "expires_in": 3600}`))
+			return
+		}
+
+		assert.Equal(t, "Bearer token1", r.Header.Get("Authorization"))
+		if quotaExceeded {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		body := &struct {
+			Values [][]string `json:"values"`
+		}{}
+		json.NewDecoder(r.Body).Decode(body)
+		appended = append(appended, body.Values)
+		paths = append(paths, r.URL.EscapedPath())
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	googleTokenURL = server.URL + "/token"
+	sheetsAPIURL = server.URL + "/sheets"
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"sheets_export": {
+		"client_id": "1234", "client_secret": "sesame", "refresh_token": "abcd",
+		"flows": {"9de3663f-c5c5-4c92-9f45-ecbc09abcc85": {"spreadsheet_id": "sheet1", "sheet": "Results", "columns": ["@contact.name"]}}
+	}}' WHERE id = $1`, models.Org1)
+	models.FlushCache()
+
+	queueRows := func(n int) {
+		for i := 0; i < n; i++ {
+			err := models.QueueSheetsExportRow(rc, &models.SheetsExportRow{OrgID: models.Org1, FlowUUID: models.FavoritesFlowUUID, Values: []string{fmt.Sprintf("row %d", i)}})
+			require.NoError(t, err)
+		}
+	}
+
+	// rows are appended in batches
+	queueRows(appendBatchSize + 2)
+
+	err := exportSheets(ctx, db, rp)
+	require.NoError(t, err)
+	assert.Equal(t, 1, tokens)
+	require.Equal(t, 2, len(appended))
+	assert.Equal(t, appendBatchSize, len(appended[0]))
+	assert.Equal(t, []string{"row 0"}, appended[0][0])
+	assert.Equal(t, [][]string{{fmt.Sprintf("row %d", appendBatchSize)}, {fmt.Sprintf("row %d", appendBatchSize+1)}}, appended[1])
+	assert.Equal(t, "/sheets/sheet1/values/%27Results%27%21A:A:append", paths[0])
+
+	pending, err := models.PendingSheetsExports(rc)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(pending))
+
+	// if we exceed our quota, rows stay queued and the org is backed off
+	quotaExceeded = true
+	queueRows(3)
+
+	err = exportSheets(ctx, db, rp)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(appended))
+
+	ttl, err := redis.Int(rc.Do("ttl", fmt.Sprintf(backoffKey, models.Org1)))
+	require.NoError(t, err)
+	assert.True(t, ttl > 50 && ttl <= 60)
+
+	rows, err := models.ReadSheetsExportRows(rc, models.Org1, models.FavoritesFlowUUID, appendBatchSize)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(rows))
+
+	// while backed off, nothing is attempted
+	quotaExceeded = false
+	err = exportSheets(ctx, db, rp)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(appended))
+
+	// a second failure backs off for twice as long
+	delay, err := backOff(rc, models.Org1)
+	require.NoError(t, err)
+	assert.Equal(t, initialBackoff*2, delay)
+
+	// once the backoff is over, the rows are appended using our cached token
+	rc.Do("del", fmt.Sprintf(backoffKey, models.Org1))
+
+	err = exportSheets(ctx, db, rp)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(appended))
+	assert.Equal(t, 1, tokens)
+
+	failures, err := redis.Int(rc.Do("exists", fmt.Sprintf(failuresKey, models.Org1)))
+	require.NoError(t, err)
+	assert.Equal(t, 0, failures)
+}
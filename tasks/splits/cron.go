@@ -0,0 +1,47 @@
+package splits
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	squashLock = "squash_split_counts"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartSquashCron)
+}
+
+// StartSquashCron starts our cron job of squashing random split counts every fifteen minutes
+func StartSquashCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, squashLock, time.Minute*15,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancel()
+			return squashSplitCounts(ctx, mr.DB, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// squashSplitCounts squashes the random split counts which have been incremented since our last run
+func squashSplitCounts(ctx context.Context, db *sqlx.DB, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "split_counts").WithField("lock", lockValue)
+	start := time.Now()
+
+	count, err := models.SquashSplitCounts(ctx, db)
+	if err != nil {
+		return errors.Wrapf(err, "error squashing split counts")
+	}
+
+	log.WithField("elapsed", time.Since(start)).WithField("counters", count).Info("squashed split counts")
+	return nil
+}
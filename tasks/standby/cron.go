@@ -0,0 +1,64 @@
+package standby
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	mirrorLock = "mirror_tasks"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartMirrorCron)
+}
+
+// StartMirrorCron starts our cron job of mirroring queued and scheduled tasks to our standby redis, if we have one
+func StartMirrorCron(mr *mailroom.Mailroom) error {
+	if mr.Config.StandbyRedis == "" {
+		return nil
+	}
+
+	standby := &redis.Pool{
+		Wait:        true,
+		MaxActive:   2,
+		MaxIdle:     1,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(mr.Config.StandbyRedis)
+		},
+	}
+
+	cron.StartCron(mr.Quit, mr.RP, mirrorLock, time.Second*10,
+		func(lockName string, lockValue string) error {
+			return mirrorTasks(mr.RP, standby, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// mirrorTasks copies our task queues and scheduled tasks to the standby
+func mirrorTasks(rp *redis.Pool, standby *redis.Pool, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "standby_cron").WithField("lock", lockValue)
+	start := time.Now()
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	sc := standby.Get()
+	defer sc.Close()
+
+	copied, err := queue.MirrorTasks(rc, sc, []string{queue.BatchQueue, queue.HandlerQueue})
+	if err != nil {
+		return errors.Wrapf(err, "error mirroring tasks to standby")
+	}
+
+	log.WithField("elapsed", time.Since(start)).WithField("copied", copied).Debug("mirrored tasks to standby")
+	return nil
+}
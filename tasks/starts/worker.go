@@ -9,7 +9,6 @@ import (
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
-	"github.com/lib/pq"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom"
 	"github.com/nyaruka/mailroom/models"
@@ -27,6 +26,10 @@ const (
 func init() {
 	mailroom.AddTaskFunction(queue.StartFlow, handleFlowStart)
 	mailroom.AddTaskFunction(queue.StartFlowBatch, handleFlowStartBatch)
+
+	// batches aren't retried as contacts started before a failure would be started again, but failed batches are kept
+	// as dead tasks so they can be inspected
+	queue.RegisterRetryPolicy(queue.StartFlowBatch, &queue.RetryPolicy{MaxAttempts: 1, DeadLetter: true})
 }
 
 // handleFlowStart creates all the batches of contacts to start in a flow
@@ -94,25 +97,7 @@ func CreateFlowBatches(ctx context.Context, db *sqlx.DB, rp *redis.Pool, ec *ela
 		contactIDs[newID] = true
 	}
 
-	// now add all the ids for our groups
-	if len(start.GroupIDs()) > 0 {
-		rows, err := db.QueryxContext(ctx, `SELECT contact_id FROM contacts_contactgroup_contacts WHERE contactgroup_id = ANY($1)`, pq.Array(start.GroupIDs()))
-		if err != nil {
-			return errors.Wrapf(err, "error selecting contacts for groups")
-		}
-		defer rows.Close()
-
-		var contactID models.ContactID
-		for rows.Next() {
-			err := rows.Scan(&contactID)
-			if err != nil {
-				return errors.Wrapf(err, "error scanning contact id")
-			}
-			contactIDs[contactID] = true
-		}
-	}
-
-	// finally, if we have a query, add the contacts that match that as well
+	// if we have a query, add the contacts that match that as well
 	if start.Query() != "" {
 		matches, err := models.ContactIDsForQuery(ctx, ec, org, start.Query())
 		if err != nil {
@@ -124,17 +109,32 @@ func CreateFlowBatches(ctx context.Context, db *sqlx.DB, rp *redis.Pool, ec *ela
 		}
 	}
 
+	// group members are streamed from the database rather than being loaded into our set, as the groups of the largest
+	// orgs can have millions of contacts, so count them and any other contacts which aren't in the groups
+	otherIDs := make([]models.ContactID, 0, len(contactIDs))
+	for id := range contactIDs {
+		otherIDs = append(otherIDs, id)
+	}
+
+	contactCount := len(otherIDs)
+	if len(start.GroupIDs()) > 0 {
+		contactCount, err = models.CountContactIDsForGroupIDs(ctx, db, start.GroupIDs(), otherIDs)
+		if err != nil {
+			return errors.Wrapf(err, "error counting contacts for start: %d", start.ID())
+		}
+	}
+
 	rc := rp.Get()
 	defer rc.Close()
 
 	// mark our start as starting, last task will mark as complete
-	err = models.MarkStartStarted(ctx, db, start.ID(), len(contactIDs))
+	err = models.MarkStartStarted(ctx, db, start.ID(), contactCount)
 	if err != nil {
 		return errors.Wrapf(err, "error marking start as started")
 	}
 
 	// if there are no contacts to start, mark our start as complete, we are done
-	if len(contactIDs) == 0 {
+	if contactCount == 0 {
 		err = models.MarkStartComplete(ctx, db, start.ID())
 		if err != nil {
 			return errors.Wrapf(err, "error marking start as complete")
@@ -144,7 +144,7 @@ func CreateFlowBatches(ctx context.Context, db *sqlx.DB, rp *redis.Pool, ec *ela
 
 	// by default we start in the batch queue unless we have two or fewer contacts
 	q := queue.BatchQueue
-	if len(contactIDs) <= 2 {
+	if contactCount <= 2 {
 		q = queue.HandlerQueue
 	}
 
@@ -154,29 +154,63 @@ func CreateFlowBatches(ctx context.Context, db *sqlx.DB, rp *redis.Pool, ec *ela
 		taskType = queue.StartIVRFlowBatch
 	}
 
+	// if this start is paced, we use smaller batches when needed so they can be spread out evenly
+	batchSize := startBatchSize
+	if start.Pace() > 0 && start.Pace() < batchSize {
+		batchSize = start.Pace()
+	}
+
+	now := time.Now()
+	batchIndex := 0
+
 	contacts := make([]models.ContactID, 0, 100)
 	queueBatch := func(last bool) {
 		batch := start.CreateBatch(contacts)
 		batch.SetIsLast(last)
-		err = queue.AddTask(rc, q, taskType, int(start.OrgID()), batch, queue.DefaultPriority)
+
+		// paced batches after the first are scheduled to be queued later
+		delay := queue.PacedDelay(batchIndex, batchSize, start.Pace())
+		if delay > 0 {
+			err = queue.ScheduleTask(rc, q, taskType, int(start.OrgID()), batch, queue.DefaultPriority, now.Add(delay))
+		} else {
+			err = queue.AddTask(rc, q, taskType, int(start.OrgID()), batch, queue.DefaultPriority)
+		}
 		if err != nil {
 			// TODO: is continuing the right thing here? what do we do if redis is down? (panic!)
 			logrus.WithError(err).WithField("start_id", start.ID()).Error("error while queuing start")
 		}
 		contacts = make([]models.ContactID, 0, 100)
+		batchIndex++
 	}
 
 	// build up batches of contacts to start
-	for c := range contactIDs {
-		if len(contacts) == startBatchSize {
+	addContact := func(c models.ContactID) error {
+		if len(contacts) == batchSize {
 			queueBatch(false)
 		}
 		contacts = append(contacts, c)
+		return nil
 	}
 
-	// queue our last batch
+	if len(start.GroupIDs()) > 0 {
+		err = models.IterateContactIDsForGroupIDs(ctx, db, start.GroupIDs(), otherIDs, addContact)
+		if err != nil {
+			return errors.Wrapf(err, "error iterating contacts for start: %d", start.ID())
+		}
+	} else {
+		for _, c := range otherIDs {
+			addContact(c)
+		}
+	}
+
+	// queue our last batch, or if the groups were emptied since we counted them, mark our start as complete
 	if len(contacts) > 0 {
 		queueBatch(true)
+	} else if batchIndex == 0 {
+		err = models.MarkStartComplete(ctx, db, start.ID())
+		if err != nil {
+			return errors.Wrapf(err, "error marking start as complete")
+		}
 	}
 
 	return nil
@@ -64,17 +64,31 @@ func dumpStats(ctx context.Context, db *sqlx.DB, rp *redis.Pool, lockName string
 		logrus.WithError(err).Error("error calculating handler queue size")
 	}
 
+	// and of the canary queues so we notice if there are no canary instances handling them
+	canaryBatchSize, err := queue.Size(rc, queue.CanaryQueue(queue.BatchQueue))
+	if err != nil {
+		logrus.WithError(err).Error("error calculating canary batch queue size")
+	}
+	canaryHandlerSize, err := queue.Size(rc, queue.CanaryQueue(queue.HandlerQueue))
+	if err != nil {
+		logrus.WithError(err).Error("error calculating canary handler queue size")
+	}
+
 	logrus.WithFields(logrus.Fields{
-		"db_idle":      stats.Idle,
-		"db_busy":      stats.InUse,
-		"db_waiting":   stats.WaitCount - waitCount,
-		"db_wait":      stats.WaitDuration - waitDuration,
-		"batch_size":   batchSize,
-		"handler_size": handlerSize,
+		"db_idle":             stats.Idle,
+		"db_busy":             stats.InUse,
+		"db_waiting":          stats.WaitCount - waitCount,
+		"db_wait":             stats.WaitDuration - waitDuration,
+		"batch_size":          batchSize,
+		"handler_size":        handlerSize,
+		"canary_batch_size":   canaryBatchSize,
+		"canary_handler_size": canaryHandlerSize,
 	}).Info("current stats")
 
 	librato.Gauge("mr.handler_queue", float64(handlerSize))
 	librato.Gauge("mr.batch_queue", float64(batchSize))
+	librato.Gauge("mr.canary_handler_queue", float64(canaryHandlerSize))
+	librato.Gauge("mr.canary_batch_queue", float64(canaryBatchSize))
 	librato.Gauge("mr.db_busy", float64(stats.InUse))
 	librato.Gauge("mr.db_idle", float64(stats.Idle))
 	librato.Gauge("mr.db_waiting", float64(stats.WaitCount-waitCount))
@@ -0,0 +1,47 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	squashLock = "squash_org_usage"
+)
+
+func init() {
+	mailroom.AddInitFunction(StartSquashCron)
+}
+
+// StartSquashCron starts our cron job of squashing org usage counts every fifteen minutes
+func StartSquashCron(mr *mailroom.Mailroom) error {
+	cron.StartCron(mr.Quit, mr.RP, squashLock, time.Minute*15,
+		func(lockName string, lockValue string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancel()
+			return squashOrgUsage(ctx, mr.DB, lockName, lockValue)
+		},
+	)
+	return nil
+}
+
+// squashOrgUsage squashes the usage counts which have been incremented since our last run
+func squashOrgUsage(ctx context.Context, db *sqlx.DB, lockName string, lockValue string) error {
+	log := logrus.WithField("comp", "org_usage").WithField("lock", lockValue)
+	start := time.Now()
+
+	count, err := models.SquashOrgUsage(ctx, db)
+	if err != nil {
+		return errors.Wrapf(err, "error squashing org usage")
+	}
+
+	log.WithField("elapsed", time.Since(start)).WithField("counters", count).Info("squashed org usage")
+	return nil
+}
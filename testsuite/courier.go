@@ -0,0 +1,131 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// CourierBatch is a batch of messages queued for courier on a channel
+type CourierBatch struct {
+	ChannelUUID  string
+	HighPriority bool
+	Msgs         []map[string]interface{}
+}
+
+// FakeCourier consumes the message batches queued for courier in redis, the way courier does, and records them so
+// that tests can assert what was queued without a running courier
+type FakeCourier struct {
+	rp      *redis.Pool
+	batches []*CourierBatch
+}
+
+// NewFakeCourier creates a new fake courier which consumes from the passed in redis pool
+func NewFakeCourier(rp *redis.Pool) *FakeCourier {
+	return &FakeCourier{rp: rp, batches: make([]*CourierBatch, 0)}
+}
+
+// Sync consumes all the batches currently queued for courier, high priority batches first for each queue
+func (c *FakeCourier) Sync() error {
+	rc := c.rp.Get()
+	defer rc.Close()
+
+	queues, err := redis.Strings(rc.Do("ZRANGE", "msgs:active", 0, -1))
+	if err != nil {
+		return errors.Wrapf(err, "error reading active courier queues")
+	}
+
+	for _, queue := range queues {
+		// queue names are like msgs:uuid|tps
+		channelUUID := strings.SplitN(strings.TrimPrefix(queue, "msgs:"), "|", 2)[0]
+
+		for _, highPriority := range []bool{true, false} {
+			priorityQueue := queue + "/0"
+			if highPriority {
+				priorityQueue = queue + "/1"
+			}
+
+			values, err := redis.Strings(rc.Do("ZRANGE", priorityQueue, 0, -1))
+			if err != nil {
+				return errors.Wrapf(err, "error reading courier queue %s", priorityQueue)
+			}
+
+			for _, value := range values {
+				batch := &CourierBatch{ChannelUUID: channelUUID, HighPriority: highPriority}
+				if err := json.Unmarshal([]byte(value), &batch.Msgs); err != nil {
+					return errors.Wrapf(err, "error unmarshalling batch queued on %s", priorityQueue)
+				}
+				c.batches = append(c.batches, batch)
+			}
+
+			if _, err := rc.Do("DEL", priorityQueue); err != nil {
+				return errors.Wrapf(err, "error removing courier queue %s", priorityQueue)
+			}
+		}
+
+		if _, err := rc.Do("ZREM", "msgs:active", queue); err != nil {
+			return errors.Wrapf(err, "error removing active courier queue %s", queue)
+		}
+	}
+
+	return nil
+}
+
+// Batches syncs and returns all the batches consumed so far
+func (c *FakeCourier) Batches() ([]*CourierBatch, error) {
+	err := c.Sync()
+	return c.batches, err
+}
+
+// Reset forgets all the batches consumed so far
+func (c *FakeCourier) Reset() {
+	c.batches = make([]*CourierBatch, 0)
+}
+
+// AssertMsgQueued asserts that a message with the passed in text has been queued on the passed in channel
+func (c *FakeCourier) AssertMsgQueued(t *testing.T, channelUUID string, text string, msgAndArgs ...interface{}) bool {
+	batches, err := c.Batches()
+	if !assert.NoError(t, err) {
+		return false
+	}
+
+	queued := make([]string, 0)
+	for _, b := range batches {
+		if b.ChannelUUID == channelUUID {
+			for _, m := range b.Msgs {
+				if m["text"] == text {
+					return true
+				}
+				queued = append(queued, fmt.Sprintf("%v", m["text"]))
+			}
+		}
+	}
+
+	return assert.Fail(t, fmt.Sprintf("no msg with text '%s' queued on channel %s, queued: %v", text, channelUUID, queued), msgAndArgs...)
+}
+
+// AssertBatchSize asserts the sizes, in order, of the batches queued on the passed in channel
+func (c *FakeCourier) AssertBatchSize(t *testing.T, channelUUID string, sizes ...int) bool {
+	batches, err := c.Batches()
+	if !assert.NoError(t, err) {
+		return false
+	}
+
+	if sizes == nil {
+		sizes = []int{}
+	}
+
+	actual := make([]int, 0)
+	for _, b := range batches {
+		if b.ChannelUUID == channelUUID {
+			actual = append(actual, len(b.Msgs))
+		}
+	}
+
+	return assert.Equal(t, sizes, actual, "unexpected batch sizes queued on channel %s", channelUUID)
+}
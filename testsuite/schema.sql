@@ -0,0 +1,25 @@
+-- Tables and columns used by mailroom which RapidPro creates in migrations newer than our mailroom_test.dump. These are
+-- created after the dump is restored, and can be removed from here when the dump is next regenerated. Tables which
+-- mailroom owns aren't created by RapidPro at all and are created by the schema package instead.
+
+CREATE TABLE IF NOT EXISTS contacts_contactnote (
+    id serial PRIMARY KEY,
+    uuid uuid NOT NULL UNIQUE,
+    org_id integer NOT NULL REFERENCES orgs_org(id),
+    contact_id integer NOT NULL REFERENCES contacts_contact(id),
+    user_id integer NOT NULL,
+    text text NOT NULL,
+    created_on timestamp with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS contacts_contactnote_org_created ON contacts_contactnote(org_id, created_on DESC, id DESC);
+CREATE INDEX IF NOT EXISTS contacts_contactnote_contact_created ON contacts_contactnote(contact_id, created_on DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS flows_flow_template_dependencies (
+    id serial PRIMARY KEY,
+    flow_id integer NOT NULL REFERENCES flows_flow(id),
+    template_id integer NOT NULL REFERENCES templates_template(id),
+    UNIQUE (flow_id, template_id)
+);
+CREATE INDEX IF NOT EXISTS flows_flow_template_dependencies_template_id ON flows_flow_template_dependencies(template_id);
+
+ALTER TABLE msgs_broadcast ADD COLUMN IF NOT EXISTS variables jsonb NULL;
@@ -3,6 +3,7 @@ package testsuite
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/nyaruka/mailroom/schema"
+
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
@@ -45,6 +48,18 @@ func ResetDB() {
 	}
 
 	mustExec("pg_restore", "-h", "localhost", "-d", "mailroom_test", "-U", "mailroom_test", path.Join(dir, "./mailroom_test.dump"))
+
+	// then create any tables which are newer than our dump
+	newer, err := ioutil.ReadFile(path.Join(dir, "./testsuite/schema.sql"))
+	if err != nil {
+		panic(fmt.Sprintf("error reading test schema: %s", err))
+	}
+	db.MustExec(string(newer))
+
+	// and the tables which mailroom owns
+	if err := schema.Migrate(context.Background(), db); err != nil {
+		panic(fmt.Sprintf("error migrating schema: %s", err))
+	}
 }
 
 // DB returns an open test database pool
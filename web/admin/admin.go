@@ -0,0 +1,243 @@
+package admin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nyaruka/mailroom/cron"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// how many of the most recent dead tasks we show
+	maxDeadTasks = 50
+)
+
+func init() {
+	web.RegisterRoute(http.MethodGet, "/mr/admin", requireAdmin(handleIndex))
+	web.RegisterRoute(http.MethodPost, "/mr/admin/dead_tasks/requeue", requireAdmin(handleRequeueDeadTask))
+	web.RegisterRoute(http.MethodPost, "/mr/admin/org_cache/flush", requireAdmin(handleFlushOrgCache))
+}
+
+// requireAdmin wraps a handler to require HTTP basic authentication with our auth token as the password, and for
+// forms posted to it to include our CSRF token, so that other sites can't make an admin's browser post to us
+func requireAdmin(handler web.Handler) web.Handler {
+	return func(ctx context.Context, s *web.Server, r *http.Request, w http.ResponseWriter) error {
+		if s.Config.AuthToken != "" {
+			_, password, _ := r.BasicAuth()
+			if subtle.ConstantTimeCompare([]byte(password), []byte(s.Config.AuthToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="mailroom"`)
+				http.Error(w, "invalid or missing credentials", http.StatusUnauthorized)
+				return nil
+			}
+		}
+
+		if r.Method == http.MethodPost && subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(csrfToken(s))) != 1 {
+			http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+			return nil
+		}
+
+		return handler(ctx, s, r, w)
+	}
+}
+
+// our CSRF token is derived from our auth token so it's the same across instances and restarts
+func csrfToken(s *web.Server) string {
+	mac := hmac.New(sha256.New, []byte(s.Config.AuthToken))
+	mac.Write([]byte("mailroom-admin"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type queueDepth struct {
+	Name string
+	Size int
+}
+
+type indexPage struct {
+	Host         string
+	Version      string
+	Now          time.Time
+	CSRF         string
+	Message      string
+	Queues       []*queueDepth
+	DeadCount    int
+	DeadTasks    []*queue.DeadTask
+	CronRuns     []*cron.Run
+	CachedOrgs   []*models.CachedOrg
+	MaxDeadTasks int
+}
+
+// Shows queue depths, recent dead tasks, when crons last ran and the org assets cached by this instance.
+//
+//   GET /mr/admin
+//
+func handleIndex(ctx context.Context, s *web.Server, r *http.Request, w http.ResponseWriter) error {
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	host, _ := os.Hostname()
+	page := &indexPage{
+		Host:         host,
+		Version:      s.Config.Version,
+		Now:          time.Now(),
+		CSRF:         csrfToken(s),
+		Message:      r.URL.Query().Get("message"),
+		MaxDeadTasks: maxDeadTasks,
+	}
+
+	for _, q := range []string{queue.HandlerQueue, queue.BatchQueue, queue.CanaryQueue(queue.HandlerQueue), queue.CanaryQueue(queue.BatchQueue)} {
+		size, err := queue.Size(rc, q)
+		if err != nil {
+			return err
+		}
+		page.Queues = append(page.Queues, &queueDepth{Name: q, Size: size})
+	}
+
+	var err error
+	page.DeadCount, err = queue.CountDeadTasks(rc)
+	if err != nil {
+		return err
+	}
+
+	page.DeadTasks, err = queue.ReadDeadTasks(rc, maxDeadTasks)
+	if err != nil {
+		return err
+	}
+
+	page.CronRuns, err = cron.LastRuns(rc)
+	if err != nil {
+		return err
+	}
+
+	page.CachedOrgs = models.CachedOrgs()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	return errors.Wrapf(indexTemplate.Execute(w, page), "error rendering admin page")
+}
+
+// Requeues a dead task with its error count reset.
+//
+//   POST /mr/admin/dead_tasks/requeue
+//   id=0123456789abcdef&csrf=...
+//
+func handleRequeueDeadTask(ctx context.Context, s *web.Server, r *http.Request, w http.ResponseWriter) error {
+	id := r.PostFormValue("id")
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	requeued, err := queue.RequeueDeadTask(rc, id)
+	if err != nil {
+		return err
+	}
+
+	message := "task requeued"
+	if !requeued {
+		message = "task not found, it may have already been requeued"
+	}
+
+	logrus.WithField("comp", "admin").WithField("dead_task_id", id).WithField("requeued", requeued).Info("dead task requeue requested")
+	redirectToIndex(w, r, message)
+	return nil
+}
+
+// Flushes the cached assets of an org from this instance.
+//
+//   POST /mr/admin/org_cache/flush
+//   org_id=1&csrf=...
+//
+func handleFlushOrgCache(ctx context.Context, s *web.Server, r *http.Request, w http.ResponseWriter) error {
+	orgID, err := strconv.Atoi(r.PostFormValue("org_id"))
+	if err != nil {
+		http.Error(w, "invalid org id", http.StatusBadRequest)
+		return nil
+	}
+
+	models.FlushOrgCache(models.OrgID(orgID))
+
+	logrus.WithField("comp", "admin").WithField("org_id", orgID).Info("org cache flushed")
+	redirectToIndex(w, r, "org cache flushed")
+	return nil
+}
+
+func redirectToIndex(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/mr/admin?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Mailroom Admin</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 20px; }
+table { border-collapse: collapse; margin-bottom: 30px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+.message { background: #ffd; padding: 8px; margin-bottom: 20px; }
+.error { color: #a00; }
+pre { margin: 0; max-width: 600px; white-space: pre-wrap; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>Mailroom Admin</h1>
+<p>{{.Host}} running {{.Version}} at {{.Now.Format "2006-01-02 15:04:05 MST"}}</p>
+{{if .Message}}<div class="message">{{.Message}}</div>{{end}}
+
+<h2>Queues</h2>
+<table>
+<tr><th>Queue</th><th>Tasks</th></tr>
+{{range .Queues}}<tr><td>{{.Name}}</td><td>{{.Size}}</td></tr>
+{{end}}</table>
+
+<h2>Dead Tasks ({{.DeadCount}}{{if gt .DeadCount .MaxDeadTasks}}, most recent {{.MaxDeadTasks}} shown{{end}})</h2>
+<table>
+<tr><th>Failed</th><th>Queue</th><th>Type</th><th>Org</th><th>Error</th><th>Task</th><th></th></tr>
+{{range .DeadTasks}}<tr>
+<td>{{ago .FailedOn}}</td><td>{{.Queue}}</td><td>{{.Task.Type}}</td><td>{{.Task.OrgID}}</td>
+<td class="error">{{.Error}}</td><td><pre>{{printf "%s" .Task.Task}}</pre></td>
+<td><form method="post" action="/mr/admin/dead_tasks/requeue"><input type="hidden" name="csrf" value="{{$.CSRF}}"><input type="hidden" name="id" value="{{.ID}}"><button type="submit">Retry</button></form></td>
+</tr>
+{{else}}<tr><td colspan="7">none</td></tr>
+{{end}}</table>
+
+<h2>Crons</h2>
+<table>
+<tr><th>Cron</th><th>Last Run</th><th>Elapsed</th><th>Error</th></tr>
+{{range .CronRuns}}<tr><td>{{.Name}}</td><td>{{ago .Started}}</td><td>{{.Elapsed}}</td><td class="error">{{.Error}}</td></tr>
+{{else}}<tr><td colspan="4">none</td></tr>
+{{end}}</table>
+
+<h2>Org Cache (this instance)</h2>
+<table>
+<tr><th>Org</th><th>Built</th><th>Locations Built</th><th>Flows Loaded</th><th></th></tr>
+{{range .CachedOrgs}}<tr>
+<td>{{.OrgID}}</td><td>{{ago .BuiltAt}}</td><td>{{ago .LocationsBuiltAt}}</td><td>{{.FlowsLoaded}}</td>
+<td><form method="post" action="/mr/admin/org_cache/flush"><input type="hidden" name="csrf" value="{{$.CSRF}}"><input type="hidden" name="org_id" value="{{.OrgID}}"><button type="submit">Flush</button></form></td>
+</tr>
+{{else}}<tr><td colspan="5">none</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin(t *testing.T) {
+	testsuite.Reset()
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+	rp := testsuite.RP()
+	rc := testsuite.RC()
+	defer rc.Close()
+	wg := &sync.WaitGroup{}
+
+	cfg := *config.Mailroom
+	cfg.AuthToken = "sesame"
+
+	server := web.NewServer(ctx, &cfg, db, rp, nil, nil, wg)
+	server.Start()
+
+	// give our server time to start
+	time.Sleep(time.Second)
+
+	defer server.Stop()
+
+	// add a dead task
+	queue.RegisterRetryPolicy("test_admin", &queue.RetryPolicy{MaxAttempts: 1, DeadLetter: true})
+	task := &queue.Task{Type: "test_admin", OrgID: int(models.Org1), Task: []byte(`{"foo": "bar"}`), QueuedOn: time.Now()}
+	_, err := queue.RetryTask(rc, queue.BatchQueue, task, errors.New("boom"))
+	require.NoError(t, err)
+
+	deadTasks, err := queue.ReadDeadTasks(rc, 1)
+	require.NoError(t, err)
+
+	// don't follow redirects so we can check them
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }}
+
+	request := func(method string, path string, password string, form url.Values) (int, string) {
+		req, err := http.NewRequest(method, "http://localhost:8090"+path, strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusSeeOther {
+			return resp.StatusCode, resp.Header.Get("Location")
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	status, _ := request("GET", "/mr/admin", "", nil)
+	assert.Equal(t, 401, status)
+
+	status, _ = request("GET", "/mr/admin", "open sesame", nil)
+	assert.Equal(t, 401, status)
+
+	status, body := request("GET", "/mr/admin", "sesame", nil)
+	assert.Equal(t, 200, status)
+	assert.Contains(t, body, "handler_canary")
+	assert.Contains(t, body, "test_admin")
+	assert.Contains(t, body, "boom")
+
+	// posts need our CSRF token
+	status, _ = request("POST", "/mr/admin/dead_tasks/requeue", "sesame", url.Values{"id": {deadTasks[0].ID}})
+	assert.Equal(t, 403, status)
+
+	csrf := csrfToken(server)
+
+	status, location := request("POST", "/mr/admin/dead_tasks/requeue", "sesame", url.Values{"id": {deadTasks[0].ID}, "csrf": {csrf}})
+	assert.Equal(t, 303, status)
+	assert.Equal(t, "/mr/admin?message=task+requeued", location)
+
+	count, err := queue.CountDeadTasks(rc)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	requeued, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	require.NotNil(t, requeued)
+	assert.Equal(t, "test_admin", requeued.Type)
+
+	status, location = request("POST", "/mr/admin/dead_tasks/requeue", "sesame", url.Values{"id": {deadTasks[0].ID}, "csrf": {csrf}})
+	assert.Equal(t, 303, status)
+	assert.Equal(t, "/mr/admin?message=task+not+found%2C+it+may+have+already+been+requeued", location)
+
+	// flush an org from our cache
+	_, err = models.GetOrgAssets(ctx, db, models.Org1)
+	require.NoError(t, err)
+
+	status, _ = request("POST", "/mr/admin/org_cache/flush", "sesame", url.Values{"org_id": {"1"}, "csrf": {csrf}})
+	assert.Equal(t, 303, status)
+
+	for _, o := range models.CachedOrgs() {
+		assert.NotEqual(t, models.Org1, o.OrgID)
+	}
+}
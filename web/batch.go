@@ -0,0 +1,142 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxBatchConcurrency is how many sub-requests of a batch are executed at the same time
+	maxBatchConcurrency = 5
+
+	batchPattern = "/mr/batch"
+)
+
+func init() {
+	RegisterJSONRoute(http.MethodPost, batchPattern, RequireAuthToken(handleBatch))
+}
+
+// Executes a batch of up to 100 requests to other endpoints, returning the status and response of each. Sub-requests
+// are executed concurrently so their order of execution isn't guaranteed, but results are returned in the
+// same order as requests. Org assets are cached so sub-requests for the same org share a single load.
+//
+//   {
+//     "requests": [
+//       {"method": "POST", "path": "/mr/contact/search", "body": {"org_id": 1, "group_uuid": "985a83fe-2e9f-478d-a3ec-fa602d5e7ddd", "query": "age > 10"}},
+//       {"method": "POST", "path": "/mr/field/usage", "body": {"org_id": 1}}
+//     ]
+//   }
+//
+type batchRequest struct {
+	Requests []*batchSubRequest `json:"requests" validate:"required,min=1,max=100,dive"`
+}
+
+type batchSubRequest struct {
+	Method string          `json:"method"  validate:"required"`
+	Path   string          `json:"path"    validate:"required"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// Response for a batch request, results are in the same order as the requests
+//
+//   {
+//     "results": [
+//       {"status": 200, "response": {"query": "age > 10", "contact_ids": [1, 2], ...}},
+//       {"status": 400, "response": {"error": "request failed validation: ...", "details": {...}}}
+//     ]
+//   }
+//
+type batchResponse struct {
+	Results []*batchResult `json:"results"`
+}
+
+type batchResult struct {
+	Status   int         `json:"status"`
+	Response interface{} `json:"response"`
+}
+
+// handles a batch of requests to other endpoints
+func handleBatch(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+	request := &batchRequest{}
+	if status, err := ReadAndValidateJSON(r, request, DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	results := make([]*batchResult, len(request.Requests))
+	sem := make(chan bool, maxBatchConcurrency)
+	wg := sync.WaitGroup{}
+
+	for i, sub := range request.Requests {
+		wg.Add(1)
+		sem <- true
+
+		go func(i int, sub *batchSubRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// a panic in one sub-request fails only that sub-request, as our recovery middleware can't catch panics
+			// in other goroutines
+			defer func() {
+				if rvr := recover(); rvr != nil {
+					debug.PrintStack()
+					logrus.WithError(errors.New(fmt.Sprint(rvr))).WithField("path", sub.Path).Error("recovered from panic in batch sub-request")
+					results[i] = &batchResult{http.StatusInternalServerError, newErrorResponse(errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)}
+				}
+			}()
+
+			results[i] = executeBatchSubRequest(ctx, s, r, sub)
+		}(i, sub)
+	}
+
+	wg.Wait()
+
+	return &batchResponse{Results: results}, http.StatusOK, nil
+}
+
+// executes a single sub-request of a batch by calling the handler of the matching route directly
+func executeBatchSubRequest(ctx context.Context, s *Server, parent *http.Request, sub *batchSubRequest) *batchResult {
+	route := findJSONRoute(sub.Method, sub.Path)
+	if route == nil || route.pattern == batchPattern {
+		return &batchResult{http.StatusNotFound, newErrorResponse(errors.Errorf("not found: %s %s", sub.Method, sub.Path), http.StatusNotFound)}
+	}
+
+	r, err := http.NewRequestWithContext(ctx, sub.Method, sub.Path, bytes.NewReader(sub.Body))
+	if err != nil {
+		return &batchResult{http.StatusBadRequest, newErrorResponse(errors.Wrapf(err, "invalid request"), http.StatusBadRequest)}
+	}
+	r.Header.Set("Authorization", parent.Header.Get("Authorization"))
+	r.Header.Set("Content-Type", "application/json")
+
+	value, status, err := route.handler(ctx, s, r)
+	if err != nil {
+		logrus.WithError(err).WithField("path", sub.Path).Error("error handling batch sub-request")
+		return &batchResult{http.StatusInternalServerError, newErrorResponse(err, http.StatusInternalServerError)}
+	}
+
+	asError, isError := value.(error)
+	if isError {
+		value = newErrorResponse(asError, status)
+	}
+
+	return &batchResult{status, value}
+}
+
+// finds the registered JSON route with the passed in method and pattern
+func findJSONRoute(method, path string) *jsonRoute {
+	for _, route := range jsonRoutes {
+		if route.method == method && route.pattern == path {
+			return route
+		}
+	}
+	return nil
+}
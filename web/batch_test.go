@@ -0,0 +1,66 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	ctx := testsuite.CTX()
+
+	RegisterJSONRoute(http.MethodPost, "/mr/test/echo", func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		body := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return errors.Wrapf(err, "bad body"), http.StatusBadRequest, nil
+		}
+		return body, http.StatusOK, nil
+	})
+	RegisterJSONRoute(http.MethodPost, "/mr/test/panic", func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		panic("boom")
+	})
+
+	server := &Server{CTX: ctx, Config: config.Mailroom}
+
+	r, err := http.NewRequest(http.MethodPost, "/mr/batch", bytes.NewReader([]byte(`{
+		"requests": [
+			{"method": "POST", "path": "/mr/test/echo", "body": {"foo": "bar"}},
+			{"method": "POST", "path": "/mr/test/echo", "body": "nope"},
+			{"method": "GET", "path": "/mr/test/echo"},
+			{"method": "POST", "path": "/mr/batch", "body": {"requests": []}},
+			{"method": "POST", "path": "/mr/test/panic", "body": {}}
+		]
+	}`)))
+	require.NoError(t, err)
+
+	value, status, err := handleBatch(ctx, server, r)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	results := value.(*batchResponse).Results
+	assert.Equal(t, 5, len(results))
+	assert.Equal(t, http.StatusOK, results[0].Status)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, results[0].Response)
+	assert.Equal(t, http.StatusBadRequest, results[1].Status)
+	assert.Equal(t, http.StatusNotFound, results[2].Status)
+	assert.Equal(t, http.StatusNotFound, results[3].Status)
+	assert.Equal(t, http.StatusInternalServerError, results[4].Status)
+
+	// an empty batch fails validation
+	r, err = http.NewRequest(http.MethodPost, "/mr/batch", bytes.NewReader([]byte(`{"requests": []}`)))
+	require.NoError(t, err)
+
+	value, status, err = handleBatch(ctx, server, r)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, map[string]string{"requests": "must have a minimum of 1 items"}, value.(*Error).Details())
+}
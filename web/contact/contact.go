@@ -3,9 +3,13 @@ package contact
 import (
 	"context"
 	"net/http"
+	"strconv"
 
-	"github.com/nyaruka/goflow/assets"
-	"github.com/nyaruka/goflow/utils"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/client"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/search"
 	"github.com/nyaruka/mailroom/web"
@@ -13,61 +17,27 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/search", web.RequireAuthToken(handleSearch))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/parse_query", web.RequireAuthToken(handleParseQuery))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/search", web.RequireAuthToken(web.WithOrgAssets(handleSearch)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/parse_query", web.RequireAuthToken(web.WithOrgAssets(handleParseQuery)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/add_note", web.RequireAuthToken(web.WithIdempotency(web.WithOrgAssets(handleAddNote))))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/notes", web.RequireAuthToken(handleNotes))
 }
 
-// Searches the contacts for an org
-//
-//   {
-//     "org_id": 1,
-//     "group_uuid": "985a83fe-2e9f-478d-a3ec-fa602d5e7ddd",
-//     "query": "age > 10",
-//     "sort": "-age"
-//   }
-//
-type searchRequest struct {
-	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
-	GroupUUID assets.GroupUUID `json:"group_uuid" validate:"required"`
-	Query     string           `json:"query"`
-	PageSize  int              `json:"page_size"`
-	Offset    int              `json:"offset"`
-	Sort      string           `json:"sort"`
-}
-
-// Response for a contact search
-//
-// {
-//   "query": "age > 10",
-//   "contact_ids": [5,10,15],
-//   "fields": ["age"],
-//   "total": 3,
-//   "offset": 0
-// }
-type searchResponse struct {
-	Query      string             `json:"query"`
-	ContactIDs []models.ContactID `json:"contact_ids"`
-	Fields     []string           `json:"fields"`
-	Total      int64              `json:"total"`
-	Offset     int                `json:"offset"`
-	Sort       string             `json:"sort"`
-}
-
-// handles a contact search request
+// handles a contact search request, see client.ContactSearchRequest
 func handleSearch(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
-	request := &searchRequest{
+	request := &client.ContactSearchRequest{
 		Offset:   0,
 		PageSize: 50,
 		Sort:     "-created_on",
 	}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
 	}
 
 	// grab our org
-	org, err := models.GetOrgAssets(s.CTX, s.DB, request.OrgID)
-	if err != nil {
-		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
 	}
 
 	// Perform our search
@@ -77,7 +47,7 @@ func handleSearch(ctx context.Context, s *web.Server, r *http.Request) (interfac
 	if err != nil {
 		switch cause := errors.Cause(err).(type) {
 		case *search.Error:
-			return cause, http.StatusBadRequest, nil
+			return queryError(cause), http.StatusBadRequest, nil
 		default:
 			return nil, http.StatusInternalServerError, err
 		}
@@ -89,53 +59,93 @@ func handleSearch(ctx context.Context, s *web.Server, r *http.Request) (interfac
 		normalized = parsed.String()
 	}
 
+	contactIDs := make([]int64, len(hits))
+	for i, id := range hits {
+		contactIDs[i] = int64(id)
+	}
+
 	// build our response
-	response := &searchResponse{
+	response := &client.ContactSearchResponse{
 		Query:      normalized,
-		ContactIDs: hits,
+		ContactIDs: contactIDs,
 		Fields:     search.FieldDependencies(parsed),
+		Metadata:   queryMetadataForClient(parsed),
 		Total:      total,
 		Offset:     request.Offset,
 		Sort:       request.Sort,
 	}
 
+	if request.IncludeContacts {
+		response.Contacts, err = loadContactSummaries(ctx, s.DB, org, hits)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
 	return response, http.StatusOK, nil
 }
 
-// Request to parse the passed in query
-//
-//   {
-//     "org_id": 1,
-//     "query": "age > 10",
-//   }
-//
-type parseRequest struct {
-	OrgID models.OrgID `json:"org_id"     validate:"required"`
-	Query string       `json:"query"      validate:"required"`
+// loads summaries of the contacts with the passed in ids, in the same order, leaving out URNs if the org is anonymous
+func loadContactSummaries(ctx context.Context, db *sqlx.DB, org *models.OrgAssets, ids []models.ContactID) ([]*client.ContactSummary, error) {
+	contacts, err := models.LoadContacts(ctx, db, org, ids)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading contacts")
+	}
+
+	byID := make(map[models.ContactID]*models.Contact, len(contacts))
+	for _, c := range contacts {
+		byID[c.ID()] = c
+	}
+
+	redactURNs := org.Env().RedactionPolicy() == envs.RedactionPolicyURNs
+
+	summaries := make([]*client.ContactSummary, 0, len(ids))
+	for _, id := range ids {
+		c := byID[id]
+		if c == nil {
+			continue
+		}
+
+		summary := &client.ContactSummary{ID: int64(c.ID()), UUID: uuids.UUID(c.UUID()), Name: c.Name()}
+		if len(c.URNs()) > 0 && !redactURNs {
+			summary.URN = string(c.URNs()[0].Identity())
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
 }
 
-// Response for a parse query request
-//
-// {
-//   "query": "age > 10",
-//   "fields": ["age"]
-// }
-type parseResponse struct {
-	Query  string   `json:"query"`
-	Fields []string `json:"fields"`
+func queryMetadataForClient(parsed *contactql.ContactQuery) *client.ContactQueryMetadata {
+	metadata := search.ParseQueryMetadata(parsed)
+	return &client.ContactQueryMetadata{
+		Attributes: metadata.Attributes,
+		Schemes:    metadata.Schemes,
+		Fields:     metadata.Fields,
+	}
+}
+
+// creates a query syntax error which includes the character offsets of the error in the query if they're known,
+// so that editors can highlight where the problem is
+func queryError(err *search.Error) *web.Error {
+	e := web.NewError(web.ErrorCodeQuerySyntax, err)
+	start, end := err.Offsets()
+	if start >= 0 {
+		e.WithDetail("start", strconv.Itoa(start)).WithDetail("end", strconv.Itoa(end))
+	}
+	return e
 }
 
-// handles a query parsing request
+// handles a query parsing request, see client.ContactParseQueryRequest
 func handleParseQuery(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
-	request := &parseRequest{}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	request := &client.ContactParseQueryRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
 	}
 
 	// grab our org
-	org, err := models.GetOrgAssets(s.CTX, s.DB, request.OrgID)
-	if err != nil {
-		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
 	}
 
 	resolver := models.BuildFieldResolver(org)
@@ -144,7 +154,7 @@ func handleParseQuery(ctx context.Context, s *web.Server, r *http.Request) (inte
 	if err != nil {
 		switch cause := errors.Cause(err).(type) {
 		case *search.Error:
-			return cause, http.StatusBadRequest, nil
+			return queryError(cause), http.StatusBadRequest, nil
 		default:
 			return nil, http.StatusInternalServerError, err
 		}
@@ -156,10 +166,80 @@ func handleParseQuery(ctx context.Context, s *web.Server, r *http.Request) (inte
 	}
 
 	// build our response
-	response := &parseResponse{
-		Query:  normalized,
-		Fields: search.FieldDependencies(parsed),
+	response := &client.ContactParseQueryResponse{
+		Query:    normalized,
+		Fields:   search.FieldDependencies(parsed),
+		Metadata: queryMetadataForClient(parsed),
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// the most notes we return for a notes request
+const maxNotes = 100
+
+// handles a request to add a note to a contact, see client.ContactAddNoteRequest
+func handleAddNote(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.ContactAddNoteRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	note := models.NewContactNote(models.ContactID(request.ContactID), request.UserID, request.Text)
+
+	// the note is only inserted if its contact exists in this org
+	err := models.InsertContactNote(ctx, s.DB, org.OrgID(), note)
+	if err == models.ErrNotFound {
+		return errors.Errorf("no contact with id: %d", request.ContactID), http.StatusNotFound, nil
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return noteForClient(note), http.StatusOK, nil
+}
+
+// handles a request to list or search contact notes, see client.ContactNotesRequest
+func handleNotes(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.ContactNotesRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+	if request.ContactID == 0 && request.Text == "" {
+		return errors.New("request must include a contact or text to search for"), http.StatusBadRequest, nil
+	}
+
+	limit := request.Limit
+	if limit <= 0 || limit > maxNotes {
+		limit = maxNotes
+	}
+
+	notes, err := models.SearchContactNotes(ctx, s.DB, models.OrgID(request.OrgID), models.ContactID(request.ContactID), request.Text, limit)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	response := &client.ContactNotesResponse{Notes: make([]*client.ContactNote, len(notes))}
+	for i, n := range notes {
+		response.Notes[i] = noteForClient(n)
 	}
 
 	return response, http.StatusOK, nil
 }
+
+// converts a note to the type returned to clients
+func noteForClient(n *models.ContactNote) *client.ContactNote {
+	return &client.ContactNote{
+		Type:      n.Type,
+		UUID:      n.UUID,
+		CreatedOn: n.CreatedOn,
+		ContactID: int64(n.ContactID),
+		UserID:    n.UserID,
+		Text:      n.Text,
+	}
+}
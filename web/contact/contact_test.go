@@ -11,6 +11,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/client"
 	"github.com/nyaruka/mailroom/config"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/search"
@@ -30,14 +32,14 @@ func TestSearch(t *testing.T) {
 	es := search.NewMockElasticServer()
 	defer es.Close()
 
-	client, err := elastic.NewClient(
+	esClient, err := elastic.NewClient(
 		elastic.SetURL(es.URL()),
 		elastic.SetHealthcheck(false),
 		elastic.SetSniff(false),
 	)
 	assert.NoError(t, err)
 
-	server := web.NewServer(ctx, config.Mailroom, db, rp, nil, client, wg)
+	server := web.NewServer(ctx, config.Mailroom, db, rp, nil, esClient, wg)
 	server.Start()
 
 	// give our server time to start
@@ -79,7 +81,7 @@ func TestSearch(t *testing.T) {
 		Body       string
 		Status     int
 		Error      string
-		Hits       []models.ContactID
+		Hits       []int64
 		Query      string
 		Fields     []string
 		ESResponse string
@@ -102,7 +104,7 @@ func TestSearch(t *testing.T) {
 			fmt.Sprintf(`{"org_id": 1, "query": "Cathy", "group_uuid": "%s"}`, models.AllContactsGroupUUID),
 			200,
 			"",
-			[]models.ContactID{models.CathyID},
+			[]int64{int64(models.CathyID)},
 			`name ~ "Cathy"`,
 			[]string{"name"},
 			singleESResponse,
@@ -112,7 +114,7 @@ func TestSearch(t *testing.T) {
 			fmt.Sprintf(`{"org_id": 1, "query": "AGE = 10 and gender = M", "group_uuid": "%s"}`, models.AllContactsGroupUUID),
 			200,
 			"",
-			[]models.ContactID{models.CathyID},
+			[]int64{int64(models.CathyID)},
 			`age = 10 AND gender = "M"`,
 			[]string{"age", "gender"},
 			singleESResponse,
@@ -122,7 +124,7 @@ func TestSearch(t *testing.T) {
 			fmt.Sprintf(`{"org_id": 1, "query": "", "group_uuid": "%s"}`, models.AllContactsGroupUUID),
 			200,
 			"",
-			[]models.ContactID{models.CathyID},
+			[]int64{int64(models.CathyID)},
 			``,
 			[]string{},
 			singleESResponse,
@@ -150,7 +152,7 @@ func TestSearch(t *testing.T) {
 
 		// on 200 responses parse them
 		if resp.StatusCode == 200 {
-			r := &searchResponse{}
+			r := &client.ContactSearchResponse{}
 			err = json.Unmarshal(content, r)
 			assert.NoError(t, err)
 			assert.Equal(t, tc.Hits, r.ContactIDs)
@@ -163,6 +165,22 @@ func TestSearch(t *testing.T) {
 			assert.Equal(t, tc.Error, r.Error)
 		}
 	}
+
+	// summaries of the matched contacts can be included, and the query metadata is always included
+	es.NextResponse = singleESResponse
+	body := fmt.Sprintf(`{"org_id": 1, "query": "name = Cathy AND tel = 250700000001", "group_uuid": "%s", "include_contacts": true}`, models.AllContactsGroupUUID)
+
+	resp, err := http.Post("http://localhost:8090/mr/contact/search", "application/json", bytes.NewReader([]byte(body)))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	r := &client.ContactSearchResponse{}
+	err = json.NewDecoder(resp.Body).Decode(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []*client.ContactSummary{
+		{ID: int64(models.CathyID), UUID: uuids.UUID(models.CathyUUID), Name: "Cathy", URN: "tel:+250700000001"},
+	}, r.Contacts)
+	assert.Equal(t, &client.ContactQueryMetadata{Attributes: []string{"name"}, Schemes: []string{"tel"}, Fields: []string{}}, r.Metadata)
 }
 
 func TestParse(t *testing.T) {
@@ -179,30 +197,37 @@ func TestParse(t *testing.T) {
 	defer server.Stop()
 
 	tcs := []struct {
-		URL    string
-		Method string
-		Body   string
-		Status int
-		Error  string
-		Query  string
-		Fields []string
+		URL     string
+		Method  string
+		Body    string
+		Status  int
+		Error   string
+		Details map[string]string
+		Query   string
+		Fields  []string
 	}{
 		{
 			"/mr/contact/parse_query", "GET",
 			"",
-			405, "illegal method: GET",
+			405, "illegal method: GET", nil,
 			"", nil,
 		},
 		{
 			"/mr/contact/parse_query", "POST",
 			`{"org_id": 1, "query": "birthday = tomorrow"}`,
-			400, "can't resolve 'birthday' to attribute, scheme or field",
+			400, "can't resolve 'birthday' to attribute, scheme or field", map[string]string{"start": "0", "end": "8"},
+			"", nil,
+		},
+		{
+			"/mr/contact/parse_query", "POST",
+			`{"org_id": 1, "query": "age > 10 AND birthday = tomorrow"}`,
+			400, "can't resolve 'birthday' to attribute, scheme or field", map[string]string{"start": "13", "end": "21"},
 			"", nil,
 		},
 		{
 			"/mr/contact/parse_query", "POST",
 			`{"org_id": 1, "query": "age > 10"}`,
-			200, "",
+			200, "", nil,
 			"age > 10", []string{"age"},
 		},
 	}
@@ -221,15 +246,19 @@ func TestParse(t *testing.T) {
 
 		// on 200 responses parse them
 		if resp.StatusCode == 200 {
-			r := &searchResponse{}
+			r := &client.ContactParseQueryResponse{}
 			err = json.Unmarshal(content, r)
 			assert.NoError(t, err)
 			assert.Equal(t, tc.Query, r.Query)
+			assert.Equal(t, tc.Fields, r.Metadata.Fields)
 		} else {
 			r := &web.ErrorResponse{}
 			err = json.Unmarshal(content, r)
 			assert.NoError(t, err)
 			assert.Equal(t, tc.Error, r.Error)
+			if tc.Details != nil {
+				assert.Equal(t, tc.Details, r.Details, "%d: unexpected error details", i)
+			}
 		}
 	}
 }
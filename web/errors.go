@@ -0,0 +1,148 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorCode is a machine readable code included in error responses so that clients can branch on the kind of
+// error without having to parse the message
+type ErrorCode string
+
+const (
+	// ErrorCodeInvalidRequest is used when the request body is missing, malformed or fails validation
+	ErrorCodeInvalidRequest = ErrorCode("invalid_request")
+
+	// ErrorCodeUnauthorized is used when the request isn't properly authenticated
+	ErrorCodeUnauthorized = ErrorCode("unauthorized")
+
+	// ErrorCodeNotFound is used when the endpoint or the thing requested doesn't exist
+	ErrorCodeNotFound = ErrorCode("not_found")
+
+	// ErrorCodeMethodNotAllowed is used when the endpoint doesn't support the request method
+	ErrorCodeMethodNotAllowed = ErrorCode("method_not_allowed")
+
+	// ErrorCodeUnprocessable is used when the request is valid but what it contains can't be processed
+	ErrorCodeUnprocessable = ErrorCode("unprocessable")
+
+	// ErrorCodeConflict is used when the request conflicts with another request, e.g. one in progress with the same
+	// idempotency key
+	ErrorCodeConflict = ErrorCode("conflict")
+
+	// ErrorCodeQuerySyntax is used when a contact query can't be parsed
+	ErrorCodeQuerySyntax = ErrorCode("query_syntax")
+
+	// ErrorCodeAssetMissing is used when a flow references assets which don't exist in the org
+	ErrorCodeAssetMissing = ErrorCode("asset_missing")
+
+	// ErrorCodeRateLimited is used when the caller has made too many requests and should retry later
+	ErrorCodeRateLimited = ErrorCode("rate_limited")
+
+	// ErrorCodeServerError is used when something went wrong on our side
+	ErrorCodeServerError = ErrorCode("server_error")
+)
+
+// Error is an error with a code and optional field level details which handlers can return to control the
+// error response
+type Error struct {
+	code       ErrorCode
+	err        error
+	details    map[string]string
+	retryable  bool
+	retryAfter time.Duration
+}
+
+// NewError creates a new error with the passed in code
+func NewError(code ErrorCode, err error) *Error {
+	return &Error{code: code, err: err}
+}
+
+// WithDetail adds a detail for the passed in field to this error
+func (e *Error) WithDetail(field string, detail string) *Error {
+	if e.details == nil {
+		e.details = make(map[string]string)
+	}
+	e.details[field] = detail
+	return e
+}
+
+// WithRetryable sets whether the client can expect a retry of the same request to succeed
+func (e *Error) WithRetryable(retryable bool) *Error {
+	e.retryable = retryable
+	return e
+}
+
+// WithRetryAfter sets how long the client should wait before retrying, which is returned in a Retry-After header
+func (e *Error) WithRetryAfter(retryAfter time.Duration) *Error {
+	e.retryAfter = retryAfter
+	return e.WithRetryable(true)
+}
+
+func (e *Error) Code() ErrorCode            { return e.code }
+func (e *Error) Details() map[string]string { return e.details }
+func (e *Error) Retryable() bool            { return e.retryable }
+func (e *Error) RetryAfter() time.Duration  { return e.retryAfter }
+func (e *Error) Error() string              { return e.err.Error() }
+
+// ErrorResponse is the type for our error responses
+//
+//   {
+//     "error": "can't resolve 'xyz' to attribute, scheme or field",
+//     "code": "query_syntax",
+//     "retryable": false
+//   }
+//
+type ErrorResponse struct {
+	Error     string            `json:"error"`
+	Code      ErrorCode         `json:"code,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retryable bool              `json:"retryable"`
+}
+
+// NewErrorResponse creates a new error response from the passed in error
+func NewErrorResponse(err error) *ErrorResponse {
+	r := &ErrorResponse{Error: err.Error()}
+
+	coded, isCoded := errors.Cause(err).(*Error)
+	if isCoded {
+		r.Code = coded.Code()
+		r.Details = coded.Details()
+		r.Retryable = coded.Retryable()
+	}
+	return r
+}
+
+// newErrorResponse creates a new error response from the passed in error, using the passed in status to
+// determine the code if the error doesn't have one
+func newErrorResponse(err error, status int) *ErrorResponse {
+	r := NewErrorResponse(err)
+	if r.Code == "" {
+		r.Code = errorCodeForStatus(status)
+		r.Retryable = status >= 500
+	}
+	return r
+}
+
+// returns the default error code for the passed in status
+func errorCodeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrorCodeMethodNotAllowed
+	case http.StatusUnprocessableEntity:
+		return ErrorCodeUnprocessable
+	case http.StatusTooManyRequests:
+		return ErrorCodeRateLimited
+	}
+	if status < 500 {
+		return ErrorCodeInvalidRequest
+	}
+	return ErrorCodeServerError
+}
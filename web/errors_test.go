@@ -0,0 +1,30 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResponses(t *testing.T) {
+	// plain errors get a code from the status
+	r := newErrorResponse(errors.New("bad things"), http.StatusBadRequest)
+	assert.Equal(t, &ErrorResponse{Error: "bad things", Code: ErrorCodeInvalidRequest}, r)
+
+	r = newErrorResponse(errors.New("db down"), http.StatusInternalServerError)
+	assert.Equal(t, &ErrorResponse{Error: "db down", Code: ErrorCodeServerError, Retryable: true}, r)
+
+	// coded errors keep their code and details, even when wrapped
+	err := NewError(ErrorCodeQuerySyntax, errors.New("can't resolve 'xyz'")).WithDetail("query", "xyz")
+	r = newErrorResponse(errors.Wrap(err, "search failed"), http.StatusBadRequest)
+	assert.Equal(t, &ErrorResponse{
+		Error:   "search failed: can't resolve 'xyz'",
+		Code:    ErrorCodeQuerySyntax,
+		Details: map[string]string{"query": "xyz"},
+	}, r)
+
+	r = NewErrorResponse(NewError(ErrorCodeServerError, errors.New("try later")).WithRetryable(true))
+	assert.Equal(t, &ErrorResponse{Error: "try later", Code: ErrorCodeServerError, Retryable: true}, r)
+}
@@ -4,35 +4,34 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/excellent"
+	"github.com/nyaruka/goflow/excellent/types"
+	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/definition/legacy/expressions"
-	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/client"
+	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/web"
 
 	"github.com/pkg/errors"
 )
 
+// the most templates and contacts which can be evaluated in one request
+const (
+	maxEvaluateTemplates = 100
+	maxEvaluateContacts  = 100
+)
+
 func init() {
 	web.RegisterJSONRoute(http.MethodPost, "/mr/expression/migrate", web.RequireAuthToken(handleMigrate))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/expression/evaluate", web.RequireAuthToken(web.WithOrgAssets(handleEvaluate)))
 }
 
-// Migrates a legacy expression to the new flow definition specification
-//
-//   {
-//     "expression": "@contact.age"
-//   }
-//
-type migrateRequest struct {
-	Expression string `json:"expression" validate:"required"`
-}
-
-type migrateResponse struct {
-	Migrated string `json:"migrated"`
-}
-
+// handles a request to migrate an expression, see client.ExpressionMigrateRequest
 func handleMigrate(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
-	request := &migrateRequest{}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	request := &client.ExpressionMigrateRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
 	}
 
 	migrated, err := expressions.MigrateTemplate(request.Expression, nil)
@@ -40,5 +39,89 @@ func handleMigrate(ctx context.Context, s *web.Server, r *http.Request) (interfa
 		return errors.Wrapf(err, "unable to migrate expression"), http.StatusUnprocessableEntity, nil
 	}
 
-	return &migrateResponse{migrated}, http.StatusOK, nil
+	return &client.ExpressionMigrateResponse{Migrated: migrated}, http.StatusOK, nil
+}
+
+// handles a request to evaluate templates against contacts, see client.ExpressionEvaluateRequest
+func handleEvaluate(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.ExpressionEvaluateRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	numContacts := len(request.ContactIDs) + len(request.Contacts)
+	if numContacts == 0 {
+		return errors.New("request must include contacts to evaluate against"), http.StatusBadRequest, nil
+	}
+	if len(request.Templates) > maxEvaluateTemplates || numContacts > maxEvaluateContacts {
+		return errors.Errorf("requests can evaluate at most %d templates against %d contacts", maxEvaluateTemplates, maxEvaluateContacts), http.StatusBadRequest, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	sa, err := models.NewSessionAssets(org)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to get session assets")
+	}
+
+	contacts := make([]*flows.Contact, 0, numContacts)
+
+	if len(request.ContactIDs) > 0 {
+		contactIDs := make([]models.ContactID, len(request.ContactIDs))
+		for i, id := range request.ContactIDs {
+			contactIDs[i] = models.ContactID(id)
+		}
+
+		dbContacts, err := models.LoadContacts(ctx, s.DB, org, contactIDs)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error loading contacts")
+		}
+		for _, c := range dbContacts {
+			contact, err := c.FlowContact(org, sa)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.Wrapf(err, "error creating flow contact")
+			}
+			contacts = append(contacts, contact)
+		}
+	}
+
+	for i, data := range request.Contacts {
+		contact, err := flows.ReadContact(sa, data, assets.IgnoreMissing)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read contact %d", i), http.StatusBadRequest, nil
+		}
+		contacts = append(contacts, contact)
+	}
+
+	response := &client.ExpressionEvaluateResponse{Results: make([]*client.ExpressionEvaluateResult, len(contacts))}
+
+	for i, contact := range contacts {
+		templateCtx := types.NewXObject(map[string]types.XValue{
+			"contact": flows.Context(org.Env(), contact),
+			"fields":  flows.Context(org.Env(), contact.Fields()),
+			"globals": flows.Context(org.Env(), sa.Globals()),
+			"urns":    flows.ContextFunc(org.Env(), contact.URNs().MapContext),
+		})
+
+		result := &client.ExpressionEvaluateResult{
+			ContactUUID: contact.UUID(),
+			ContactName: contact.Name(),
+			Outputs:     make([]*client.ExpressionEvaluateOutput, len(request.Templates)),
+		}
+
+		for j, template := range request.Templates {
+			output, err := excellent.EvaluateTemplate(org.Env(), templateCtx, template, nil)
+			result.Outputs[j] = &client.ExpressionEvaluateOutput{Output: output}
+			if err != nil {
+				result.Outputs[j].Error = err.Error()
+			}
+		}
+
+		response.Results[i] = result
+	}
+
+	return response, http.StatusOK, nil
 }
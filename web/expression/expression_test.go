@@ -42,10 +42,22 @@ func TestServer(t *testing.T) {
 		Status   int
 		Response string
 	}{
-		{URL: "/mr/expression/migrate", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET"}`},
+		{URL: "/mr/expression/migrate", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
 		{URL: "/mr/expression/migrate", Method: "POST", Body: `{"expression":"@contact.age"}`, Status: 200, Response: `{"migrated":"@fields.age"}`},
 		{URL: "/mr/expression/migrate", Method: "POST", Body: `{"expression":"@(UPPER(contact.tel))"}`, Status: 200, Response: `{"migrated":"@(upper(format_urn(urns.tel)))"}`},
-		{URL: "/mr/expression/migrate", Method: "POST", Body: `{"expression":"@(+)"}`, Status: 422, Response: `{"error":"unable to migrate expression: error evaluating @(+): syntax error at +"}`},
+		{URL: "/mr/expression/migrate", Method: "POST", Body: `{"expression":"@(+)"}`, Status: 422, Response: `{"error":"unable to migrate expression: error evaluating @(+): syntax error at +", "code": "unprocessable", "retryable": false}`},
+
+		{URL: "/mr/expression/evaluate", Method: "POST", Body: `{"org_id": 1, "templates": ["Hi @contact.name"]}`, Status: 400, Response: `{"error": "request must include contacts to evaluate against", "code": "invalid_request", "retryable": false}`},
+		{
+			URL:    "/mr/expression/evaluate",
+			Method: "POST",
+			Body:   `{"org_id": 1, "templates": ["Hi @contact.name", "@(upper(contact.name))"], "contact_ids": [10000], "contacts": [{"uuid": "ba96bf7f-bc2a-4873-a7c7-254d1927c4e3", "name": "Ann", "created_on": "2020-01-01T00:00:00Z"}]}`,
+			Status: 200,
+			Response: `{"results": [
+				{"contact_uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf", "contact_name": "Cathy", "outputs": [{"output": "Hi Cathy"}, {"output": "CATHY"}]},
+				{"contact_uuid": "ba96bf7f-bc2a-4873-a7c7-254d1927c4e3", "contact_name": "Ann", "outputs": [{"output": "Hi Ann"}, {"output": "ANN"}]}
+			]}`,
+		},
 	}
 
 	for _, tc := range tcs {
@@ -0,0 +1,70 @@
+package field
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/client"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/field/usage", web.RequireAuthToken(web.WithOrgAssets(handleUsage)))
+}
+
+// response for a field usage request, see client.Client.GetFieldUsage. Abandoned fields are suggested for removal. Fill
+// counts are those of the last time they were counted, which is given by counted_on.
+//
+// {
+//   "fields": [
+//     {
+//       "key": "age",
+//       "name": "Age",
+//       "value_type": "number",
+//       "filled": 12,
+//       "fill_rate": 0.4,
+//       "last_used_on": "2019-10-01T12:30:00Z",
+//       "abandoned": false
+//     }
+//   ],
+//   "suggestions": ["nickname"],
+//   "counted_on": "2019-10-01T12:15:00.123456Z"
+// }
+type usageResponse struct {
+	Fields      []*models.FieldUsage `json:"fields"`
+	Suggestions []string             `json:"suggestions"`
+	CountedOn   time.Time            `json:"counted_on"`
+}
+
+// handles a request for field usage statistics, see client.FieldUsageRequest
+func handleUsage(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FieldUsageRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	usages, countedOn, err := models.GetFieldUsage(ctx, s.DB, rc, org, time.Now())
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error calculating field usage")
+	}
+
+	suggestions := make([]string, 0)
+	for _, u := range usages {
+		if u.Abandoned {
+			suggestions = append(suggestions, u.Key)
+		}
+	}
+
+	return &usageResponse{Fields: usages, Suggestions: suggestions, CountedOn: countedOn}, http.StatusOK, nil
+}
@@ -4,133 +4,316 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/nyaruka/goflow/flows"
-	"github.com/nyaruka/goflow/utils"
-	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/client"
 	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/search"
+	"github.com/nyaruka/mailroom/tasks/sessionchecks"
 	"github.com/nyaruka/mailroom/web"
 
 	"github.com/Masterminds/semver"
-	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/migrate", web.RequireAuthToken(handleMigrate))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/inspect", web.RequireAuthToken(handleInspect))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/clone", web.RequireAuthToken(handleClone))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/migrate", web.RequireAuthToken(web.WithOrgAssets(handleMigrate)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/migrate_bulk", web.RequireAuthToken(handleMigrateBulk))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/inspect", web.RequireAuthToken(web.WithOrgAssets(handleInspect)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/validate", web.RequireAuthToken(handleValidate))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/clone", web.RequireAuthToken(web.WithOrgAssets(handleClone)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/diff", web.RequireAuthToken(handleDiff))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/changelog", web.RequireAuthToken(handleChangelog))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/templates", web.RequireAuthToken(handleTemplates))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/split_stats", web.RequireAuthToken(web.WithOrgAssets(handleSplitStats)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/results_summary", web.RequireAuthToken(web.WithOrgAssets(handleResultsSummary)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/funnel", web.RequireAuthToken(web.WithOrgAssets(handleFunnel)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/schedule_start", web.RequireAuthToken(web.WithIdempotency(web.WithOrgAssets(handleScheduleStart))))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/start", web.RequireAuthToken(web.WithIdempotency(web.WithOrgAssets(handleStart))))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/check_sessions", web.RequireAuthToken(handleCheckSessions))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/check_sessions_result", web.RequireAuthToken(handleCheckSessionsResult))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/delete", web.RequireAuthToken(web.WithIdempotency(handleDelete)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/restore", web.RequireAuthToken(web.WithIdempotency(handleRestore)))
 }
 
-// Migrates a legacy flow to the new flow definition specification
-//
-//   {
-//     "flow": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "action_sets": [], ...},
-//     "to_version": "13.0.0"
-//   }
-//
-type migrateRequest struct {
-	Flow      json.RawMessage `json:"flow" validate:"required"`
-	ToVersion *semver.Version `json:"to_version"`
+// handles a request to migrate a flow, see client.FlowMigrateRequest
+func handleMigrate(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowMigrateRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	org, _ := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+
+	migrated, err := migrateFlow(org, request.Flow, request.ToVersion)
+	if err != nil {
+		return err, http.StatusUnprocessableEntity, nil
+	}
+
+	return migrated, http.StatusOK, nil
 }
 
-func handleMigrate(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
-	request := &migrateRequest{}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+// bulk migrations can have many flows so get a larger body limit than other endpoints, which also means we load the
+// org ourselves rather than using web.WithOrgAssets which only reads the org from bodies within the default limit
+var migrateBulkLimits = &web.BodyLimits{MaxBytes: 32 * web.MaxRequestBytes, MaxArrayItems: 10000}
+
+// handles a request to migrate many flows, see client.FlowMigrateBulkRequest
+func handleMigrateBulk(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowMigrateBulkRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, migrateBulkLimits); err != nil {
+		return err, status, nil
+	}
+
+	var org *models.OrgAssets
+	if request.OrgID != 0 {
+		var err error
+		org, err = models.GetOrgAssets(s.CTX, s.DB, models.OrgID(request.OrgID))
+		if err != nil {
+			return web.OrgAssetsError(models.OrgID(request.OrgID), err)
+		}
+	}
+
+	response := &client.FlowMigrateBulkResponse{Results: make([]*client.FlowMigrateResult, len(request.Flows))}
+
+	for i, flow := range request.Flows {
+		migrated, err := migrateFlow(org, flow, request.ToVersion)
+		if err != nil {
+			response.Results[i] = &client.FlowMigrateResult{Error: err.Error()}
+		} else {
+			response.Results[i] = &client.FlowMigrateResult{Flow: migrated}
+		}
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// migrates the passed in flow definition to the passed in version, or if that's nil, to the version pinned by the
+// passed in org if there is one, and checks that the result can be read
+func migrateFlow(org *models.OrgAssets, definition json.RawMessage, toVersion *semver.Version) (json.RawMessage, error) {
+	if toVersion == nil && org != nil {
+		toVersion = goflow.MigrationTarget(org.Org().FlowSpecVersion())
 	}
 
 	// do a JSON to JSON migration of the definition
-	migrated, err := goflow.MigrateDefinition(request.Flow, request.ToVersion)
+	migrated, err := goflow.MigrateDefinition(definition, toVersion)
 	if err != nil {
-		return errors.Wrapf(err, "unable to migrate flow"), http.StatusUnprocessableEntity, nil
+		return nil, errors.Wrapf(err, "unable to migrate flow")
 	}
 
 	// try to read result to check that it's valid
 	_, err = goflow.ReadFlow(migrated)
 	if err != nil {
-		return errors.Wrapf(err, "unable to read migrated flow"), http.StatusUnprocessableEntity, nil
+		return nil, errors.Wrapf(err, "unable to read migrated flow")
 	}
 
-	return migrated, http.StatusOK, nil
-}
-
-// Inspects a flow, and returns metadata including the possible results generated by the flow,
-// and dependencies in the flow. If `validate_with_org_id` is specified then the cloned flow
-// will be validated against the assets of that org.
-//
-//   {
-//     "flow": { "uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]},
-//     "validate_with_org_id": 1
-//   }
-//
-type inspectRequest struct {
-	Flow              json.RawMessage `json:"flow" validate:"required"`
-	ValidateWithOrgID models.OrgID    `json:"validate_with_org_id"`
+	return migrated, nil
 }
 
+// handles a request to inspect a flow, see client.FlowInspectRequest
 func handleInspect(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
-	request := &inspectRequest{}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	request := &client.FlowInspectRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
 	}
 
-	flow, err := goflow.ReadFlow(request.Flow)
+	org, _ := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+
+	// if we have an org, inspect the flow as it would be saved by that org
+	definition := request.Flow
+	if org != nil {
+		var err error
+		definition, err = migrateFlow(org, definition, nil)
+		if err != nil {
+			return err, http.StatusUnprocessableEntity, nil
+		}
+	}
+
+	flow, err := goflow.ReadFlow(definition)
 	if err != nil {
 		return errors.Wrapf(err, "unable to read flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	// if we have an org ID, do asset validation
-	if request.ValidateWithOrgID != models.NilOrgID {
-		result, status, err := checkDependencies(s.CTX, s.DB, request.ValidateWithOrgID, flow)
+	if request.ValidateWithOrgID != 0 {
+		result, status, err := checkDependencies(ctx, s, models.OrgID(request.ValidateWithOrgID), flow)
 		if result != nil || err != nil {
 			return result, status, err
 		}
 	}
 
-	return flow.Inspect(), http.StatusOK, nil
+	// marshal the engine's inspection of the flow so that we can add to it
+	inspectionJSON, err := json.Marshal(flow.Inspect())
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error marshalling inspection")
+	}
+	inspection := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(inspectionJSON, &inspection); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error unmarshalling inspection")
+	}
+	result := make(map[string]interface{}, len(inspection)+2)
+	for k, v := range inspection {
+		result[k] = v
+	}
+
+	if request.ValidateWithOrgID != 0 {
+		if org == nil {
+			return web.ErrMissingOrg, http.StatusBadRequest, nil
+		}
+
+		usage, err := loadDependencyUsage(ctx, s, org, flow, inspection["dependencies"])
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		result["dependency_usage"] = usage
+	}
+
+	if request.CheckMsgLengths {
+		lengths, err := checkMsgLengths(org, flow, s.Config.MsgSegmentsWarning)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		result["msg_lengths"] = lengths
+	}
+
+	return result, http.StatusOK, nil
+}
+
+// loads the usage of the passed in dependencies of a flow, as inspected by the engine, by other flows in the org
+func loadDependencyUsage(ctx context.Context, s *web.Server, org *models.OrgAssets, flow flows.Flow, dependenciesJSON json.RawMessage) (map[models.FlowDependencyType][]*models.FlowDependencyUsage, error) {
+	usage := map[models.FlowDependencyType][]*models.FlowDependencyUsage{
+		models.FlowDependencyChannels:  {},
+		models.FlowDependencyFields:    {},
+		models.FlowDependencyGroups:    {},
+		models.FlowDependencyLabels:    {},
+		models.FlowDependencyTemplates: {},
+	}
+
+	if dependenciesJSON != nil {
+		dependencies := make(map[models.FlowDependencyType][]*models.FlowDependencyUsage)
+		if err := json.Unmarshal(dependenciesJSON, &dependencies); err != nil {
+			return nil, errors.Wrapf(err, "error reading flow dependencies")
+		}
+		for depType, deps := range dependencies {
+			if _, counted := usage[depType]; counted {
+				usage[depType] = deps
+			}
+		}
+	}
+
+	if err := models.LoadFlowDependencyUsage(ctx, s.DB, org, flow.UUID(), usage); err != nil {
+		return nil, errors.Wrapf(err, "error loading flow dependency usage")
+	}
+	return usage, nil
+}
+
+// the length of a message sent by a flow in one of its languages
+type msgLength struct {
+	NodeUUID   flows.NodeUUID   `json:"node_uuid"`
+	ActionUUID flows.ActionUUID `json:"action_uuid"`
+	Language   string           `json:"language"`
+	*models.MsgLength
+}
+
+// checks the length of every message sent by the passed in flow, in each of its languages
+func checkMsgLengths(org *models.OrgAssets, flow flows.Flow, maxSegments int) ([]*msgLength, error) {
+	templates, err := goflow.ExtractTemplates(flow)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error extracting templates")
+	}
+
+	lengths := make([]*msgLength, 0)
+	for _, t := range templates {
+		if t.Field != "text" || !isMsgAction(flow.GetNode(t.NodeUUID), t.ActionUUID) {
+			continue
+		}
+
+		language := t.Language
+		if language == "" {
+			language = string(flow.Language())
+		}
+
+		lengths = append(lengths, &msgLength{
+			NodeUUID:   t.NodeUUID,
+			ActionUUID: t.ActionUUID,
+			Language:   language,
+			MsgLength:  models.CheckMsgLength(org, t.Template, maxSegments),
+		})
+	}
+	return lengths, nil
+}
+
+// whether the action with the passed in UUID in the passed in node sends a text message
+func isMsgAction(node flows.Node, actionUUID flows.ActionUUID) bool {
+	if node == nil {
+		return false
+	}
+	for _, a := range node.Actions() {
+		if a.UUID() == actionUUID {
+			return a.Type() == "send_msg" || a.Type() == "send_broadcast"
+		}
+	}
+	return false
 }
 
-// Clones a flow, replacing all UUIDs with either the given mapping or new random UUIDs.
-// If `validate_with_org_id` is specified then the cloned flow will be validated against
-// the assets of that org.
-//
-//   {
-//     "dependency_mapping": {
-//       "4ee4189e-0c06-4b00-b54f-5621329de947": "db31d23f-65b8-4518-b0f6-45638bfbbbf2",
-//       "723e62d8-a544-448f-8590-1dfd0fccfcd4": "f1fd861c-9e75-4376-a829-dcf76db6e721"
-//     },
-//     "flow": { "uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]},
-//     "validate_with_org_id": 1
-//   }
-//
-type cloneRequest struct {
-	DependencyMapping map[uuids.UUID]uuids.UUID `json:"dependency_mapping"`
-	Flow              json.RawMessage           `json:"flow" validate:"required"`
-	ValidateWithOrgID models.OrgID              `json:"validate_with_org_id"`
+// handles a request to validate a flow, see client.FlowValidateRequest
+func handleValidate(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowValidateRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	var sa flows.SessionAssets
+	if request.ValidateWithOrgID != 0 {
+		var err error
+		sa, err = loadFreshSessionAssets(ctx, s, models.OrgID(request.ValidateWithOrgID))
+		if err != nil {
+			return web.OrgAssetsError(models.OrgID(request.ValidateWithOrgID), err)
+		}
+	}
+
+	problems, err := goflow.ValidateDefinition(request.Flow, sa)
+	if err != nil {
+		return err, http.StatusUnprocessableEntity, nil
+	}
+
+	return map[string]interface{}{"problems": problems}, http.StatusOK, nil
 }
 
+// handles a request to clone a flow, see client.FlowCloneRequest
 func handleClone(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
-	request := &cloneRequest{}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	request := &client.FlowCloneRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	// if we have an org, clone the flow as it would be saved by that org
+	definition := request.Flow
+	if org, _ := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets); org != nil {
+		var err error
+		definition, err = migrateFlow(org, definition, nil)
+		if err != nil {
+			return err, http.StatusUnprocessableEntity, nil
+		}
 	}
 
 	// try to clone the flow definition
-	cloneJSON, err := goflow.CloneDefinition(request.Flow, request.DependencyMapping)
+	cloneJSON, err := goflow.CloneDefinition(definition, request.DependencyMapping)
 	if err != nil {
 		return errors.Wrapf(err, "unable to read flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	// if we have an org ID, do asset validation on the new clone
-	if request.ValidateWithOrgID != models.NilOrgID {
+	if request.ValidateWithOrgID != 0 {
 		clone, err := goflow.ReadFlow(cloneJSON)
 		if err != nil {
 			return errors.Wrapf(err, "unable to clone flow"), http.StatusUnprocessableEntity, nil
 		}
 
-		result, status, err := checkDependencies(s.CTX, s.DB, request.ValidateWithOrgID, clone)
+		result, status, err := checkDependencies(ctx, s, models.OrgID(request.ValidateWithOrgID), clone)
 		if result != nil || err != nil {
 			return result, status, err
 		}
@@ -139,20 +322,474 @@ func handleClone(ctx context.Context, s *web.Server, r *http.Request) (interface
 	return cloneJSON, http.StatusOK, nil
 }
 
-func checkDependencies(ctx context.Context, db *sqlx.DB, orgID models.OrgID, flow flows.Flow) (interface{}, int, error) {
-	org, err := models.NewOrgAssets(ctx, db, orgID, nil)
+// handles a request to diff two revisions of a flow, see client.FlowDiffRequest
+func handleDiff(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowDiffRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	from, err := goflow.ReadFlow(request.From)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read from flow"), http.StatusUnprocessableEntity, nil
+	}
+	to, err := goflow.ReadFlow(request.To)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read to flow"), http.StatusUnprocessableEntity, nil
+	}
+
+	diff, err := goflow.DiffFlows(from, to)
 	if err != nil {
-		return nil, 0, err
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error diffing flows")
+	}
+
+	return diff, http.StatusOK, nil
+}
+
+// the default and maximum number of revisions in a page of a flow changelog
+const (
+	defaultChangelogLimit = 20
+	maxChangelogLimit     = 100
+)
+
+// handles a request for the changelog of a flow, see client.FlowChangelogRequest
+func handleChangelog(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowChangelogRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	limit := request.Limit
+	if limit <= 0 {
+		limit = defaultChangelogLimit
+	} else if limit > maxChangelogLimit {
+		limit = maxChangelogLimit
 	}
 
-	sa, err := models.NewSessionAssets(org)
+	// load one more revision than we return so we can diff the last one against it
+	revisions, err := models.LoadFlowRevisions(ctx, s.DB, models.OrgID(request.OrgID), request.FlowUUID, request.Before, limit+1)
 	if err != nil {
-		return nil, 0, err
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error loading flow revisions")
+	}
+
+	response := &client.FlowChangelogResponse{Revisions: make([]*client.FlowChangelogEntry, 0, limit)}
+
+	for i, rev := range revisions {
+		if i == limit {
+			response.Next = revisions[i-1].Revision
+			break
+		}
+
+		entry := &client.FlowChangelogEntry{Revision: rev.Revision, SpecVersion: rev.SpecVersion, CreatedOn: rev.CreatedOn}
+		if rev.CreatedBy != nil {
+			entry.CreatedBy = &client.FlowChangelogAuthor{ID: rev.CreatedBy.ID, Email: rev.CreatedBy.Email, Name: rev.CreatedBy.Name}
+		}
+		if i+1 < len(revisions) {
+			entry.Diff = diffRevisions(revisions[i+1], rev)
+		}
+
+		response.Revisions = append(response.Revisions, entry)
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// diffs two revisions of a flow, returning nil if either can't be read
+func diffRevisions(from *models.FlowRevision, to *models.FlowRevision) json.RawMessage {
+	fromFlow, err := goflow.ReadFlow(from.Definition)
+	if err != nil {
+		return nil
+	}
+	toFlow, err := goflow.ReadFlow(to.Definition)
+	if err != nil {
+		return nil
+	}
+
+	diff, err := goflow.DiffFlows(fromFlow, toFlow)
+	if err != nil {
+		return nil
+	}
+
+	diffJSON, _ := json.Marshal(diff)
+	return diffJSON
+}
+
+// handles a request to extract the templates in a flow, see client.FlowTemplatesRequest
+func handleTemplates(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowTemplatesRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	flow, err := goflow.ReadFlow(request.Flow)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read flow"), http.StatusUnprocessableEntity, nil
+	}
+
+	templates, err := goflow.ExtractTemplates(flow)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error extracting templates")
+	}
+
+	return map[string]interface{}{"templates": templates}, http.StatusOK, nil
+}
+
+// checks the dependencies of the passed in flow against the assets of the passed in org, returning the response if
+// any are missing
+func checkDependencies(ctx context.Context, s *web.Server, orgID models.OrgID, flow flows.Flow) (interface{}, int, error) {
+	sa, err := loadFreshSessionAssets(ctx, s, orgID)
+	if err != nil {
+		return web.OrgAssetsError(orgID, err)
 	}
 
 	if err := flow.CheckDependencies(sa, nil); err != nil {
-		return errors.Wrapf(err, "flow failed validation"), http.StatusUnprocessableEntity, nil
+		return web.NewError(web.ErrorCodeAssetMissing, errors.Wrapf(err, "flow failed validation")), http.StatusUnprocessableEntity, nil
 	}
 
 	return nil, 0, nil
 }
+
+// loads session assets for the passed in org without using the org cache, as flows are often validated right after
+// the assets they depend on have been created
+func loadFreshSessionAssets(ctx context.Context, s *web.Server, orgID models.OrgID) (flows.SessionAssets, error) {
+	org, err := models.NewOrgAssets(ctx, s.DB, orgID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewSessionAssets(org)
+}
+
+// response for a split stats request, see client.Client.GetFlowSplitStats
+type splitStatsResponse struct {
+	Splits []*models.SplitStats `json:"splits"`
+}
+
+// handles a request for the split stats of a flow, see client.FlowSplitStatsRequest
+func handleSplitStats(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowSplitStatsRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	flow, err := org.Flow(request.FlowUUID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load flow"), http.StatusNotFound, nil
+	}
+
+	splits, err := models.GetSplitStats(ctx, s.DB, flow.(*models.Flow))
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error reading split stats")
+	}
+
+	return &splitStatsResponse{Splits: splits}, http.StatusOK, nil
+}
+
+// handles a request for the results summary of a flow, see client.FlowResultsSummaryRequest
+func handleResultsSummary(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowResultsSummaryRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	flow, err := org.Flow(request.FlowUUID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load flow"), http.StatusNotFound, nil
+	}
+
+	summary, err := models.GetFlowResultsSummary(ctx, s.DB, flow.(*models.Flow).ID(), request.Since, request.Until)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error reading results summary")
+	}
+
+	return summary, http.StatusOK, nil
+}
+
+// response for a funnel request, see client.Client.GetFlowFunnel
+type funnelResponse struct {
+	Funnel     *models.FlowFunnel `json:"funnel"`
+	Comparison *models.FlowFunnel `json:"comparison,omitempty"`
+}
+
+// handles a request for the funnel of a flow, see client.FlowFunnelRequest
+func handleFunnel(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowFunnelRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	if !request.Since.Before(request.Until) {
+		return errors.New("since must be before until"), http.StatusBadRequest, nil
+	}
+	if (request.CompareSince == nil) != (request.CompareUntil == nil) {
+		return errors.New("compare_since and compare_until must be given together"), http.StatusBadRequest, nil
+	}
+	if request.CompareSince != nil && !request.CompareSince.Before(*request.CompareUntil) {
+		return errors.New("compare_since must be before compare_until"), http.StatusBadRequest, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	flow, err := org.Flow(request.FlowUUID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load flow"), http.StatusNotFound, nil
+	}
+	flowID := flow.(*models.Flow).ID()
+
+	response := &funnelResponse{}
+
+	response.Funnel, err = models.GetFlowFunnel(ctx, s.DB, flowID, request.NodeUUIDs, request.Since, request.Until)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error reading funnel")
+	}
+
+	if request.CompareSince != nil {
+		response.Comparison, err = models.GetFlowFunnel(ctx, s.DB, flowID, request.NodeUUIDs, *request.CompareSince, *request.CompareUntil)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error reading comparison funnel")
+		}
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// handles a request to schedule a flow start, see client.FlowScheduleStartRequest
+func handleScheduleStart(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowScheduleStartRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	if len(request.ContactIDs) == 0 && len(request.GroupIDs) == 0 {
+		return errors.New("request must include contacts or groups to start"), http.StatusBadRequest, nil
+	}
+	if !request.FireOn.After(time.Now()) {
+		return errors.Errorf("fire_on must be in the future"), http.StatusBadRequest, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	flow, err := org.Flow(request.FlowUUID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load flow"), http.StatusNotFound, nil
+	}
+
+	groupIDs := make([]models.GroupID, len(request.GroupIDs))
+	for i, id := range request.GroupIDs {
+		groupIDs[i] = models.GroupID(id)
+		if org.GroupByID(groupIDs[i]) == nil {
+			return errors.Errorf("no group with id: %d", id), http.StatusNotFound, nil
+		}
+	}
+
+	contactIDs := make([]models.ContactID, len(request.ContactIDs))
+	for i, id := range request.ContactIDs {
+		contactIDs[i] = models.ContactID(id)
+	}
+
+	scheduleID, triggerID, err := models.InsertScheduledFlowStart(ctx, s.DB, org.OrgID(), request.UserID, flow.(*models.Flow).ID(), request.FireOn, contactIDs, groupIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error scheduling flow start")
+	}
+
+	logrus.WithField("org_id", request.OrgID).WithField("flow_uuid", request.FlowUUID).WithField("schedule_id", scheduleID).WithField("fire_on", request.FireOn).Info("flow start scheduled")
+
+	return &client.FlowScheduleStartResponse{ScheduleID: int64(scheduleID), TriggerID: int64(triggerID), FireOn: request.FireOn.UTC()}, http.StatusOK, nil
+}
+
+// handles a request to start contacts in a flow, see client.FlowStartRequest
+func handleStart(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowStartRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	if len(request.ContactIDs) == 0 && len(request.GroupIDs) == 0 && len(request.URNs) == 0 && request.Query == "" {
+		return errors.New("request must include contacts, groups, URNs or a query to start"), http.StatusBadRequest, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	flow, err := org.Flow(request.FlowUUID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load flow"), http.StatusNotFound, nil
+	}
+
+	groupIDs := make([]models.GroupID, len(request.GroupIDs))
+	for i, id := range request.GroupIDs {
+		groupIDs[i] = models.GroupID(id)
+		if org.GroupByID(groupIDs[i]) == nil {
+			return errors.Errorf("no group with id: %d", id), http.StatusNotFound, nil
+		}
+	}
+
+	contactIDs := make([]models.ContactID, len(request.ContactIDs))
+	for i, id := range request.ContactIDs {
+		contactIDs[i] = models.ContactID(id)
+	}
+
+	// contacts in other orgs are ignored
+	contactIDs, err = models.FilterContactIDsByOrg(ctx, s.DB, org.OrgID(), contactIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error filtering contacts")
+	}
+
+	for _, urn := range request.URNs {
+		if err := urn.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid URN: %s", urn), http.StatusBadRequest, nil
+		}
+	}
+
+	// check the query now so that the caller finds out about syntax errors rather than the start failing later
+	if request.Query != "" {
+		_, err := search.ParseQuery(org.Env(), models.BuildFieldResolver(org), request.Query)
+		if err != nil {
+			switch cause := errors.Cause(err).(type) {
+			case *search.Error:
+				return web.NewError(web.ErrorCodeQuerySyntax, cause), http.StatusBadRequest, nil
+			default:
+				return nil, http.StatusInternalServerError, err
+			}
+		}
+	}
+
+	start := models.NewFlowStart(org.OrgID(), flow.(*models.Flow).FlowType(), flow.(*models.Flow).ID(), models.RestartParticipants(request.RestartParticipants), models.IncludeActive(request.IncludeActive)).
+		WithContactIDs(contactIDs).
+		WithGroupIDs(groupIDs).
+		WithURNs(request.URNs).
+		WithQuery(request.Query).
+		WithExtra(request.Extra)
+
+	err = models.InsertFlowStarts(ctx, s.DB, []*models.FlowStart{start})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error inserting flow start")
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	// the start task resolves the contacts and creates the batches which are started by workers
+	err = queue.AddTask(rc, queue.BatchQueue, queue.StartFlow, int(org.OrgID()), start, queue.DefaultPriority)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queuing flow start")
+	}
+
+	logrus.WithField("org_id", request.OrgID).WithField("flow_uuid", request.FlowUUID).WithField("start_id", start.ID()).Info("flow start queued")
+
+	return &client.FlowStartResponse{StartID: int64(start.ID()), StartUUID: start.UUID()}, http.StatusOK, nil
+}
+
+// handles a request to check the sessions in a flow against its latest revision, see client.FlowCheckSessionsRequest
+func handleCheckSessions(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowCheckSessionsRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	// loading the output of every session in the flow can take a while so the check is done by a worker
+	task := &sessionchecks.CheckFlowSessionsTask{FlowUUID: request.FlowUUID, Interrupt: request.Interrupt}
+	err := queue.AddTask(rc, queue.BatchQueue, queue.CheckFlowSessions, request.OrgID, task, queue.DefaultPriority)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queuing check of flow sessions")
+	}
+
+	return map[string]interface{}{}, http.StatusOK, nil
+}
+
+// handles a request for the result of the last check of the sessions in a flow, see client.FlowCheckSessionsResultRequest
+func handleCheckSessionsResult(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowCheckSessionsResultRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	check, err := models.GetFlowSessionsCheck(rc, models.OrgID(request.OrgID), request.FlowUUID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error fetching check of flow sessions")
+	}
+	if check == nil {
+		return errors.Errorf("no recent check of sessions in flow with uuid: %s", request.FlowUUID), http.StatusNotFound, nil
+	}
+
+	response := &client.FlowCheckSessionsResultResponse{
+		FlowUUID:     check.FlowUUID,
+		Compatible:   check.Compatible,
+		Incompatible: make([]*client.IncompatibleSession, len(check.Incompatible)),
+		Interrupted:  check.Interrupted,
+		CheckedOn:    check.CheckedOn,
+	}
+	for i, f := range check.Incompatible {
+		response.Incompatible[i] = &client.IncompatibleSession{
+			SessionID: int64(f.SessionID),
+			ContactID: int64(f.ContactID),
+			NodeUUID:  string(f.NodeUUID),
+			Reason:    f.Reason,
+		}
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// handles a request to soft delete a flow, see client.FlowDeleteRequest
+func handleDelete(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowDeleteRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	interrupted, err := models.SoftDeleteFlow(ctx, s.DB, models.OrgID(request.OrgID), request.FlowUUID, request.Interrupt)
+	if err == models.ErrNotFound {
+		return errors.Errorf("no active flow with uuid: %s", request.FlowUUID), http.StatusNotFound, nil
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error deleting flow")
+	}
+
+	logrus.WithField("org_id", request.OrgID).WithField("flow_uuid", request.FlowUUID).WithField("interrupted", interrupted).Info("flow soft deleted")
+
+	return &client.FlowDeleteResponse{Interrupted: interrupted}, http.StatusOK, nil
+}
+
+// handles a request to restore a soft deleted flow, see client.FlowRestoreRequest
+func handleRestore(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.FlowRestoreRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	err := models.RestoreFlow(ctx, s.DB, models.OrgID(request.OrgID), request.FlowUUID)
+	if err == models.ErrNotFound {
+		return errors.Errorf("no deleted flow with uuid: %s", request.FlowUUID), http.StatusNotFound, nil
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error restoring flow")
+	}
+
+	logrus.WithField("org_id", request.OrgID).WithField("flow_uuid", request.FlowUUID).Info("flow restored")
+
+	return map[string]interface{}{}, http.StatusOK, nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/nyaruka/goflow/test"
 	"github.com/nyaruka/goflow/utils/uuids"
 	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/queue"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/web"
 
@@ -45,13 +46,16 @@ func TestServer(t *testing.T) {
 		ResponseFile    string
 		ResponsePattern string
 	}{
-		{URL: "/mr/flow/migrate", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET"}`},
+		{URL: "/mr/flow/migrate", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
 		{URL: "/mr/flow/migrate", Method: "POST", BodyFile: "migrate_minimal_v13.json", Status: 200, ResponseFile: "migrate_minimal_v13.response.json"},
 		{URL: "/mr/flow/migrate", Method: "POST", BodyFile: "migrate_minimal_legacy.json", Status: 200, ResponseFile: "migrate_minimal_legacy.response.json"},
 		{URL: "/mr/flow/migrate", Method: "POST", BodyFile: "migrate_legacy_with_version.json", Status: 200, ResponseFile: "migrate_legacy_with_version.response.json"},
-		{URL: "/mr/flow/migrate", Method: "POST", BodyFile: "migrate_invalid_v13.json", Status: 422, Response: `{"error": "unable to read migrated flow: unable to read node: field 'uuid' is required"}`},
+		{URL: "/mr/flow/migrate", Method: "POST", BodyFile: "migrate_invalid_v13.json", Status: 422, Response: `{"error": "unable to read migrated flow: unable to read node: field 'uuid' is required", "code": "unprocessable", "retryable": false}`},
 
-		{URL: "/mr/flow/inspect", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET"}`},
+		{URL: "/mr/flow/migrate_bulk", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/migrate_bulk", Method: "POST", BodyFile: "migrate_bulk.json", Status: 200, ResponseFile: "migrate_bulk.response.json"},
+
+		{URL: "/mr/flow/inspect", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
 		{URL: "/mr/flow/inspect", Method: "POST", BodyFile: "inspect_valid_legacy.json", Status: 200, ResponseFile: "inspect_valid_legacy.response.json"},
 		{URL: "/mr/flow/inspect", Method: "POST", BodyFile: "inspect_invalid_legacy.json", Status: 422, ResponseFile: "inspect_invalid_legacy.response.json"},
 		{URL: "/mr/flow/inspect", Method: "POST", BodyFile: "inspect_valid.json", Status: 200, ResponseFile: "inspect_valid.response.json"},
@@ -59,12 +63,48 @@ func TestServer(t *testing.T) {
 		{URL: "/mr/flow/inspect", Method: "POST", BodyFile: "inspect_valid_without_org.json", Status: 200, ResponseFile: "inspect_valid_without_org.response.json"},
 		{URL: "/mr/flow/inspect", Method: "POST", BodyFile: "inspect_invalid_without_org.json", Status: 200, ResponseFile: "inspect_invalid_without_org.response.json"},
 		{URL: "/mr/flow/inspect", Method: "POST", BodyFile: "inspect_legacy_single_msg.json", Status: 200, ResponseFile: "inspect_legacy_single_msg.response.json"},
+		{URL: "/mr/flow/inspect", Method: "POST", BodyFile: "inspect_msg_lengths.json", Status: 200, ResponseFile: "inspect_msg_lengths.response.json"},
+
+		{URL: "/mr/flow/validate", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/validate", Method: "POST", BodyFile: "inspect_valid.json", Status: 200, Response: `{"problems": []}`},
+		{URL: "/mr/flow/validate", Method: "POST", BodyFile: "validate_invalid.json", Status: 200, ResponsePattern: `"type":\s*"missing_dependency",\s*"node_uuid":\s*"6fde1a09-3997-47dd-aff0-92e8aff3a642",\s*"action_uuid":\s*"23337aa9-0d3d-4e70-876e-9a2633d1e5e4"`},
+		{URL: "/mr/flow/validate", Method: "POST", BodyFile: "validate_invalid.json", Status: 200, ResponsePattern: `destination 55fbef81-4151-4589-9f0a-8e5c44f6b5a3 of exit\[uuid=d3f3f024-a90e-43a5-bd5a-7056f5bea699\] isn't a known node`},
 
-		{URL: "/mr/flow/clone", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET"}`},
+		{URL: "/mr/flow/clone", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
 		{URL: "/mr/flow/clone", Method: "POST", BodyFile: "clone_valid.json", Status: 200, ResponsePattern: `"uuid": "1cf84575-ee14-4253-88b6-e3675c04a066"`},
-		{URL: "/mr/flow/clone", Method: "POST", BodyFile: "clone_struct_invalid.json", Status: 422, Response: `{"error": "unable to clone flow: unable to read node: field 'uuid' is required"}`},
+		{URL: "/mr/flow/clone", Method: "POST", BodyFile: "clone_struct_invalid.json", Status: 422, Response: `{"error": "unable to clone flow: unable to read node: field 'uuid' is required", "code": "unprocessable", "retryable": false}`},
 		{URL: "/mr/flow/clone", Method: "POST", BodyFile: "clone_missing_dep_mapping.json", Status: 422, ResponsePattern: `group\[uuid=[-0-9a-f]{36},name=Testers\]`},
-		{URL: "/mr/flow/clone", Method: "POST", BodyFile: "clone_valid_bad_org.json", Status: 500, Response: `{"error": "error loading environment for org 167733: no org with id: 167733"}`},
+		{URL: "/mr/flow/clone", Method: "POST", BodyFile: "clone_valid_bad_org.json", Status: 404, Response: `{"error": "no org with id: 167733", "code": "not_found", "details": {"org_id": "does not exist"}, "retryable": false}`},
+
+		{URL: "/mr/flow/diff", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/diff", Method: "POST", BodyFile: "diff_valid.json", Status: 200, ResponseFile: "diff_valid.response.json"},
+		{URL: "/mr/flow/diff", Method: "POST", BodyFile: "diff_invalid.json", Status: 422, Response: `{"error": "unable to read to flow: unable to read node: field 'uuid' is required", "code": "unprocessable", "retryable": false}`},
+
+		{URL: "/mr/flow/changelog", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/changelog", Method: "POST", BodyFile: "changelog_favorites.json", Status: 200, ResponsePattern: `"revisions":\s*\[\s*\{\s*"revision":\s*\d+,\s*"spec_version":`},
+
+		{URL: "/mr/flow/templates", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/templates", Method: "POST", BodyFile: "templates_valid.json", Status: 200, ResponseFile: "templates_valid.response.json"},
+		{URL: "/mr/flow/templates", Method: "POST", BodyFile: "migrate_invalid_v13.json", Status: 422, Response: `{"error": "unable to read flow: unable to read node: field 'uuid' is required", "code": "unprocessable", "retryable": false}`},
+
+		{URL: "/mr/flow/funnel", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/funnel", Method: "POST", BodyFile: "funnel_favorites.json", Status: 200, ResponseFile: "funnel_favorites.response.json"},
+		{URL: "/mr/flow/funnel", Method: "POST", BodyFile: "funnel_invalid_range.json", Status: 400, Response: `{"error": "since must be before until", "code": "invalid_request", "retryable": false}`},
+
+		{URL: "/mr/flow/start", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/start", Method: "POST", BodyFile: "start_favorites.json", Status: 200, ResponsePattern: `"start_id":\s*\d+,\s*"start_uuid":\s*"[-0-9a-f]{36}"`},
+		{URL: "/mr/flow/start", Method: "POST", BodyFile: "start_invalid_query.json", Status: 400, Response: `{"error": "can't resolve 'birthday' to attribute, scheme or field", "code": "query_syntax", "retryable": false}`},
+		{URL: "/mr/flow/start", Method: "POST", BodyFile: "start_no_recipients.json", Status: 400, Response: `{"error": "request must include contacts, groups, URNs or a query to start", "code": "invalid_request", "retryable": false}`},
+
+		{URL: "/mr/flow/check_sessions", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/check_sessions", Method: "POST", BodyFile: "check_sessions_favorites.json", Status: 200, Response: `{}`},
+		{URL: "/mr/flow/check_sessions_result", Method: "POST", BodyFile: "check_sessions_result_favorites.json", Status: 404, Response: `{"error": "no recent check of sessions in flow with uuid: 9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "code": "not_found", "retryable": false}`},
+
+		{URL: "/mr/flow/delete", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{URL: "/mr/flow/delete", Method: "POST", BodyFile: "delete_favorites.json", Status: 200, Response: `{"interrupted": 0}`},
+		{URL: "/mr/flow/delete", Method: "POST", BodyFile: "delete_favorites.json", Status: 404, Response: `{"error": "no active flow with uuid: 9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "code": "not_found", "retryable": false}`},
+		{URL: "/mr/flow/restore", Method: "POST", BodyFile: "restore_favorites.json", Status: 200, Response: `{}`},
+		{URL: "/mr/flow/restore", Method: "POST", BodyFile: "restore_favorites.json", Status: 404, Response: `{"error": "no deleted flow with uuid: 9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "code": "not_found", "retryable": false}`},
 	}
 
 	for _, tc := range tcs {
@@ -102,4 +142,16 @@ func TestServer(t *testing.T) {
 			test.AssertEqualJSON(t, []byte(tc.Response), content, "response mismatch in %s", testID)
 		}
 	}
+
+	// only the valid start was created and queued
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowstart WHERE query = 'age > 10' AND restart_participants = TRUE AND status = 'P'`, nil, 1)
+	testsuite.AssertQueryCount(t, db, `SELECT count(*) FROM flows_flowstart_groups WHERE contactgroup_id = 10000`, nil, 1)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	task, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, queue.StartFlow, task.Type)
 }
@@ -0,0 +1,162 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// IdempotencyKeyHeader is the header clients can set to make retries of a request safe
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// idempotencyWindow is how long we remember the response to a request with an idempotency key
+	idempotencyWindow = time.Hour * 24
+
+	// idempotencyClaimTimeout is how long a key is claimed by a request being handled, after which the request is
+	// assumed to have died and the key can be used again
+	idempotencyClaimTimeout = time.Minute * 5
+
+	idempotencyPattern = "idempotency:%s"
+)
+
+// idempotentResponse is what we store in redis for a request with an idempotency key, the status is zero whilst the
+// request is being handled
+type idempotentResponse struct {
+	BodyHash string          `json:"body_hash"`
+	Status   int             `json:"status,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// WithIdempotency wraps a handler so that if the request includes an idempotency key, the response is cached
+// and returned for any later request with the same key, path and authorization, without calling the handler again.
+// Keys are claimed before the handler is called so concurrent requests with the same key are rejected with a 409,
+// and reusing a key with a different body is rejected with a 422. Only successful and client error responses are
+// cached, so server errors can be retried. It should wrap any other middleware except authentication, e.g.
+// WithOrgAssets, so that a retried request gets the cached response without loading anything.
+func WithIdempotency(handler JSONHandler) JSONHandler {
+	return func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+		if idempotencyKey == "" {
+			return handler(ctx, s, r)
+		}
+
+		// scope our key to this endpoint and caller so keys can't collide across clients
+		hash := sha1.Sum([]byte(r.URL.Path + "|" + r.Header.Get("authorization") + "|" + idempotencyKey))
+		key := fmt.Sprintf(idempotencyPattern, hex.EncodeToString(hash[:]))
+
+		bodyHash, err := readBodyHash(r)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		rc := s.RP.Get()
+		defer rc.Close()
+
+		// try to claim this key for this request
+		claim, err := json.Marshal(&idempotentResponse{BodyHash: bodyHash})
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error serializing idempotency claim")
+		}
+		claimed, err := redis.String(rc.Do("set", key, claim, "EX", int(idempotencyClaimTimeout/time.Second), "NX"))
+		if err != nil && err != redis.ErrNil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error claiming idempotency key")
+		}
+
+		// someone else has the key, either a request being handled or one that has been
+		if claimed != "OK" {
+			return previousIdempotentResponse(rc, key, bodyHash)
+		}
+
+		value, status, err := handler(ctx, s, r)
+		if err != nil || status >= 500 {
+			if _, delErr := rc.Do("del", key); delErr != nil {
+				logrus.WithError(delErr).WithField("path", r.URL.Path).Error("error releasing idempotency key")
+			}
+			return value, status, err
+		}
+
+		asError, isError := value.(error)
+		if isError {
+			value = newErrorResponse(asError, status)
+		}
+
+		// the request has been handled at this point so failing to cache the response is logged but not returned
+		err = cacheIdempotentResponse(rc, key, bodyHash, status, value)
+		if err != nil {
+			logrus.WithError(err).WithField("path", r.URL.Path).Error("error caching response for idempotency key")
+		}
+
+		return value, status, nil
+	}
+}
+
+// returns the response for a request whose idempotency key is already claimed
+func previousIdempotentResponse(rc redis.Conn, key string, bodyHash string) (interface{}, int, error) {
+	cached, err := redis.Bytes(rc.Do("get", key))
+	if err == redis.ErrNil {
+		// the other request failed and released the key in the meantime
+		return NewError(ErrorCodeConflict, errors.New("request with this idempotency key failed, retry it")).WithRetryable(true), http.StatusConflict, nil
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error looking up idempotency key")
+	}
+
+	previous := &idempotentResponse{}
+	if err := json.Unmarshal(cached, previous); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error unmarshalling cached response")
+	}
+
+	if previous.BodyHash != bodyHash {
+		return NewError(ErrorCodeUnprocessable, errors.New("idempotency key has already been used with a different request body")), http.StatusUnprocessableEntity, nil
+	}
+	if previous.Status == 0 {
+		return NewError(ErrorCodeConflict, errors.New("request with this idempotency key is already being handled")).WithRetryAfter(time.Second), http.StatusConflict, nil
+	}
+	return previous.Response, previous.Status, nil
+}
+
+// returns a hash of the body of the passed in request, leaving the body to be read again by the handler
+func readBodyHash(r *http.Request) (string, error) {
+	if r.Body == nil {
+		return "", nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxRequestBytes+1))
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to read request body")
+	}
+
+	// put the body back for our handler, including anything past what we read which it will reject anyway
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	hash := sha1.Sum(body)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// caches the passed in response under the passed in key
+func cacheIdempotentResponse(rc redis.Conn, key string, bodyHash string, status int, value interface{}) error {
+	response, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "error serializing response")
+	}
+
+	toCache, err := json.Marshal(&idempotentResponse{BodyHash: bodyHash, Status: status, Response: response})
+	if err != nil {
+		return errors.Wrapf(err, "error serializing cached response")
+	}
+
+	_, err = rc.Do("set", key, toCache, "EX", int(idempotencyWindow/time.Second))
+	return err
+}
@@ -0,0 +1,101 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithIdempotency(t *testing.T) {
+	ctx, _, rp := testsuite.Reset()
+	server := &Server{CTX: ctx, RP: rp, Config: config.Mailroom}
+
+	calls := 0
+	var inHandler func()
+	handler := WithIdempotency(func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		calls++
+		if inHandler != nil {
+			inHandler()
+		}
+
+		// handlers can still read the body
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if r.URL.Path == "/mr/test/fail" {
+			return errors.New("boom"), http.StatusServiceUnavailable, nil
+		}
+		return map[string]interface{}{"calls": calls, "body": string(body)}, http.StatusOK, nil
+	})
+
+	callWithBody := func(path, key, body string) (string, int) {
+		r, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		require.NoError(t, err)
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+
+		value, status, err := handler(ctx, server, r)
+		require.NoError(t, err)
+
+		if asError, isError := value.(error); isError {
+			value = newErrorResponse(asError, status)
+		}
+
+		serialized, err := json.Marshal(value)
+		require.NoError(t, err)
+		return string(serialized), status
+	}
+	call := func(path, key string) (string, int) {
+		return callWithBody(path, key, `{}`)
+	}
+
+	// no key, handler called every time
+	value, status := call("/mr/test/ok", "")
+	assert.Equal(t, `{"body":"{}","calls":1}`, value)
+	assert.Equal(t, http.StatusOK, status)
+	value, _ = call("/mr/test/ok", "")
+	assert.Equal(t, `{"body":"{}","calls":2}`, value)
+
+	// with a key, second call gets the cached response
+	value, _ = call("/mr/test/ok", "abc")
+	assert.Equal(t, `{"body":"{}","calls":3}`, value)
+	value, status = call("/mr/test/ok", "abc")
+	assert.Equal(t, `{"body":"{}","calls":3}`, value)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 3, calls)
+
+	// unless the body is different
+	_, status = callWithBody("/mr/test/ok", "abc", `{"foo": "bar"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, 3, calls)
+
+	// different key is a different request
+	value, _ = call("/mr/test/ok", "def")
+	assert.Equal(t, `{"body":"{}","calls":4}`, value)
+
+	// a request with the same key as one still being handled is rejected
+	inHandler = func() {
+		inHandler = nil
+		_, status := call("/mr/test/ok", "ghi")
+		assert.Equal(t, http.StatusConflict, status)
+	}
+	value, _ = call("/mr/test/ok", "ghi")
+	assert.Equal(t, `{"body":"{}","calls":5}`, value)
+	assert.Equal(t, 5, calls)
+
+	// server errors aren't cached
+	call("/mr/test/fail", "abc")
+	_, status = call("/mr/test/fail", "abc")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, 7, calls)
+}
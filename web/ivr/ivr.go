@@ -25,9 +25,9 @@ import (
 )
 
 func init() {
-	web.RegisterRoute(http.MethodPost, "/mr/ivr/c/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/handle", handleFlow)
-	web.RegisterRoute(http.MethodPost, "/mr/ivr/c/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/status", handleStatus)
-	web.RegisterRoute(http.MethodPost, "/mr/ivr/c/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/incoming", handleIncomingCall)
+	web.RegisterRateLimitedRoute(http.MethodPost, "/mr/ivr/c/{channel_uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/handle", handleFlow)
+	web.RegisterRateLimitedRoute(http.MethodPost, "/mr/ivr/c/{channel_uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/status", handleStatus)
+	web.RegisterRateLimitedRoute(http.MethodPost, "/mr/ivr/c/{channel_uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/incoming", handleIncomingCall)
 }
 
 // TODO: creation of requests is awkward, would be nice to figure out how to unify how all that works
@@ -46,7 +46,7 @@ func handleIncomingCall(ctx context.Context, s *web.Server, r *http.Request, raw
 	w := middleware.NewWrapResponseWriter(rawW, r.ProtoMajor)
 	w.Tee(responseTrace)
 
-	channelUUID := assets.ChannelUUID(chi.URLParam(r, "uuid"))
+	channelUUID := assets.ChannelUUID(chi.URLParam(r, "channel_uuid"))
 
 	// load the org id for this UUID (we could load the entire channel here but we want to take the same paths through everything else)
 	orgID, err := models.OrgIDForChannelUUID(ctx, s.DB, channelUUID)
@@ -101,43 +101,46 @@ func handleIncomingCall(ctx context.Context, s *web.Server, r *http.Request, raw
 		return writeClientError(w, errors.Wrapf(err, "unable to load client for channel: %s", channelUUID))
 	}
 
+	// we don't know who is calling yet so errors are spoken in the org's default language
+	errorMsg := ivr.ErrorMessage(org, nil)
+
 	// validate this request's signature
 	err = client.ValidateRequestSignature(r)
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "request failed signature validation"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "request failed signature validation"))
 	}
 
 	// build our session assets
 	sa, err := models.GetSessionAssets(org)
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "unable to load assets"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "unable to load assets"))
 	}
 
 	// lookup the URN of the caller
 	urn, err := client.URNForRequest(r)
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "unable to find URN in request"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "unable to find URN in request"))
 	}
 
 	// get the contact id for this URN
 	ids, err := models.ContactIDsFromURNs(ctx, s.DB, org, sa, []urns.URN{urn})
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "unable to load contact by urn"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "unable to load contact by urn"))
 	}
 	contactID, found := ids[urn]
 	if !found {
-		return client.WriteErrorResponse(w, errors.Errorf("no contact for urn: %s", urn))
+		return client.WriteErrorResponse(w, errorMsg, errors.Errorf("no contact for urn: %s", urn))
 	}
 
 	urn, err = models.URNForURN(ctx, s.DB, org, urn)
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "unable to load urn"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "unable to load urn"))
 	}
 
 	// urn ID
 	urnID := models.GetURNID(urn)
 	if urnID == models.NilURNID {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "unable to get id for URN"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "unable to get id for URN"))
 	}
 
 	// we first create an incoming call channel event and see if that matches
@@ -145,7 +148,7 @@ func handleIncomingCall(ctx context.Context, s *web.Server, r *http.Request, raw
 
 	externalID, err := client.CallIDForRequest(r)
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "unable to get external id from request"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "unable to get external id from request"))
 	}
 
 	// create our connection
@@ -154,14 +157,14 @@ func handleIncomingCall(ctx context.Context, s *web.Server, r *http.Request, raw
 		models.ConnectionDirectionIn, models.ConnectionStatusInProgress, externalID,
 	)
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "error creating ivr connection"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "error creating ivr connection"))
 	}
 
 	// try to handle this event
 	session, err := handler.HandleChannelEvent(ctx, s.DB, s.RP, models.MOCallEventType, event, conn)
 	if err != nil {
 		logrus.WithError(err).WithField("http_request", r).Error("error handling incoming call")
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "error handling incoming call"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "error handling incoming call"))
 	}
 
 	// we got a session back so we have an active call trigger
@@ -183,14 +186,14 @@ func handleIncomingCall(ctx context.Context, s *web.Server, r *http.Request, raw
 	event = models.NewChannelEvent(models.MOMissEventType, org.OrgID(), channel.ID(), contactID, urnID, nil, false)
 	err = event.Insert(ctx, s.DB)
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "error inserting channel event"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "error inserting channel event"))
 	}
 
 	// try to handle it, this time looking for a missed call event
 	session, err = handler.HandleChannelEvent(ctx, s.DB, s.RP, models.MOMissEventType, event, nil)
 	if err != nil {
 		logrus.WithError(err).WithField("http_request", r).Error("error handling missed call")
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "error handling missed call"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "error handling missed call"))
 	}
 
 	// write our empty response
@@ -316,22 +319,28 @@ func handleFlow(ctx context.Context, s *web.Server, r *http.Request, rawW http.R
 		return writeClientError(w, errors.Wrapf(err, "request failed signature validation"))
 	}
 
+	// errors are spoken in the org's default language until we've loaded the contact
+	errorMsg := ivr.ErrorMessage(org, nil)
+
 	// load our contact
 	contacts, err := models.LoadContacts(ctx, s.DB, org, []models.ContactID{conn.ContactID()})
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "no such contact"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "no such contact"))
 	}
 	if len(contacts) == 0 {
-		return client.WriteErrorResponse(w, errors.Errorf("no contact width id: %d", conn.ContactID()))
+		return client.WriteErrorResponse(w, errorMsg, errors.Errorf("no contact width id: %d", conn.ContactID()))
 	}
 	if contacts[0].IsStopped() || contacts[0].IsBlocked() {
-		return client.WriteErrorResponse(w, errors.Errorf("no contact width id: %d", conn.ContactID()))
+		return client.WriteErrorResponse(w, errorMsg, errors.Errorf("no contact width id: %d", conn.ContactID()))
 	}
 
+	// from here on errors can be spoken in the contact's language
+	errorMsg = ivr.ErrorMessage(org, contacts[0])
+
 	// load the URN for this connection
 	urn, err := models.URNForID(ctx, s.DB, org, conn.ContactURNID())
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Errorf("unable to find connection urn: %d", conn.ContactURNID()))
+		return client.WriteErrorResponse(w, errorMsg, errors.Errorf("unable to find connection urn: %d", conn.ContactURNID()))
 	}
 
 	// make sure our URN is indeed present on our contact, no funny business
@@ -342,7 +351,7 @@ func handleFlow(ctx context.Context, s *web.Server, r *http.Request, rawW http.R
 		}
 	}
 	if !found {
-		return client.WriteErrorResponse(w, errors.Errorf("unable to find URN: %s on contact: %d", urn, conn.ContactID()))
+		return client.WriteErrorResponse(w, errorMsg, errors.Errorf("unable to find URN: %s on contact: %d", urn, conn.ContactID()))
 	}
 
 	resumeURL := buildResumeURL(channel, conn, urn)
@@ -370,13 +379,13 @@ func handleFlow(ctx context.Context, s *web.Server, r *http.Request, rawW http.R
 		)
 
 	default:
-		err = client.WriteErrorResponse(w, errors.Errorf("unknown action: %s", request.Action))
+		err = client.WriteErrorResponse(w, errorMsg, errors.Errorf("unknown action: %s", request.Action))
 	}
 
 	// had an error? mark our connection as errored and log it
 	if err != nil {
 		logrus.WithError(err).WithField("http_request", r).Error("error while handling IVR")
-		return ivr.WriteErrorResponse(ctx, s.DB, client, conn, w, err)
+		return ivr.WriteErrorResponse(ctx, s.DB, client, conn, w, errorMsg, err)
 	}
 
 	return nil
@@ -400,7 +409,7 @@ func handleStatus(ctx context.Context, s *web.Server, r *http.Request, rawW http
 
 	start := time.Now()
 
-	channelUUID := assets.ChannelUUID(chi.URLParam(r, "uuid"))
+	channelUUID := assets.ChannelUUID(chi.URLParam(r, "channel_uuid"))
 
 	// load the org id for this UUID (we could load the entire channel here but we want to take the same paths through everything else)
 	orgID, err := models.OrgIDForChannelUUID(ctx, s.DB, channelUUID)
@@ -432,10 +441,12 @@ func handleStatus(ctx context.Context, s *web.Server, r *http.Request, rawW http
 		return writeClientError(w, errors.Wrapf(err, "request failed signature validation"))
 	}
 
+	errorMsg := ivr.ErrorMessage(org, nil)
+
 	// get our external id
 	externalID, err := client.CallIDForRequest(r)
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "unable to get call id for request"))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "unable to get call id for request"))
 	}
 
 	// load our connection
@@ -444,7 +455,7 @@ func handleStatus(ctx context.Context, s *web.Server, r *http.Request, rawW http
 		return client.WriteEmptyResponse(w, "unknown connection, ignoring")
 	}
 	if err != nil {
-		return client.WriteErrorResponse(w, errors.Wrapf(err, "unable to load channel connection with id: %s", externalID))
+		return client.WriteErrorResponse(w, errorMsg, errors.Wrapf(err, "unable to load channel connection with id: %s", externalID))
 	}
 
 	// create a channel log for this request and connection
@@ -482,7 +493,7 @@ func handleStatus(ctx context.Context, s *web.Server, r *http.Request, rawW http
 	// had an error? mark our connection as errored and log it
 	if err != nil {
 		logrus.WithError(err).WithField("http_request", r).Error("error while handling status")
-		return ivr.WriteErrorResponse(ctx, s.DB, client, conn, w, err)
+		return ivr.WriteErrorResponse(ctx, s.DB, client, conn, w, errorMsg, err)
 	}
 
 	return nil
@@ -0,0 +1,156 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+)
+
+// ErrorCodeRequestTooLarge is used when a request body or one of its arrays exceeds the endpoint's limits
+const ErrorCodeRequestTooLarge = ErrorCode("request_too_large")
+
+// BodyLimits are the limits on the size of a JSON request body for an endpoint
+type BodyLimits struct {
+	MaxBytes      int64
+	MaxArrayItems int
+}
+
+// DefaultBodyLimits are the limits used by endpoints which don't need their own
+var DefaultBodyLimits = &BodyLimits{MaxBytes: MaxRequestBytes, MaxArrayItems: 10000}
+
+// ReadAndValidateJSON reads the JSON body of the passed in request into the passed in struct and validates it. The body
+// is held in memory while it's decoded, so it's our bytes limit which bounds how much memory a request can use. Arrays
+// are checked against our items limit as the body is read, so a request with an oversized array is rejected as soon as
+// the array passes the limit, without reading the rest of the body. On failure it returns the error and
+// status to respond with, which is 413 and an error with the offending field if the request exceeds our limits, and 400
+// with the problem with each field in the details if it fails validation.
+func ReadAndValidateJSON(r *http.Request, request interface{}, limits *BodyLimits) (int, error) {
+	buffer := &bytes.Buffer{}
+	body := io.TeeReader(io.LimitReader(r.Body, limits.MaxBytes+1), buffer)
+
+	field, exceeded, err := checkJSONLimits(body, limits.MaxArrayItems)
+
+	if exceeded {
+		return http.StatusRequestEntityTooLarge, NewError(ErrorCodeRequestTooLarge, errors.Errorf("field '%s' exceeds limit of %d items", field, limits.MaxArrayItems)).WithDetail(field, "too many items")
+	}
+	if int64(buffer.Len()) > limits.MaxBytes {
+		return http.StatusRequestEntityTooLarge, NewError(ErrorCodeRequestTooLarge, errors.Errorf("request body exceeds limit of %d bytes", limits.MaxBytes))
+	}
+	if err != nil {
+		return http.StatusBadRequest, errors.Wrapf(err, "request failed validation")
+	}
+
+	// decode from the bytes we've already read rather than copying them again
+	if err := json.Unmarshal(buffer.Bytes(), request); err != nil {
+		return validationError(err)
+	}
+	if err := utils.Validate(request); err != nil {
+		return validationError(err)
+	}
+	return 0, nil
+}
+
+// matches the validation errors from utils.Validate, e.g. "field 'org_id' is required"
+var validationErrorRegex = regexp.MustCompile(`^field '([^']+)' (.+)$`)
+
+// returns the status and error to respond with for the passed in error from reading and validating a request. Requests
+// which are valid JSON but have missing or invalid fields also get the problem with each field in the details.
+func validationError(err error) (int, error) {
+	coded := NewError(ErrorCodeInvalidRequest, errors.Wrapf(err, "request failed validation"))
+
+	switch typed := err.(type) {
+	case utils.ValidationErrors:
+		for _, fieldErr := range typed {
+			if match := validationErrorRegex.FindStringSubmatch(fieldErr.Error()); match != nil {
+				coded.WithDetail(match[1], match[2])
+			}
+		}
+	case *json.UnmarshalTypeError:
+		if typed.Field != "" {
+			coded.WithDetail(typed.Field, fmt.Sprintf("can't be a %s", typed.Value))
+		}
+	}
+
+	return http.StatusBadRequest, coded
+}
+
+// a JSON object or array that we are inside of while streaming a JSON document
+type jsonContainer struct {
+	isArray   bool
+	items     int
+	key       string
+	expectKey bool
+}
+
+// checkJSONLimits streams through the passed in JSON document, stopping at the first array with more than the
+// passed in number of items and returning the path of the field containing it
+func checkJSONLimits(body io.Reader, maxArrayItems int) (string, bool, error) {
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	stack := make([]*jsonContainer, 0, 8)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+
+		var parent *jsonContainer
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+
+		delim, isDelim := token.(json.Delim)
+		if isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		// object keys aren't values so just record them
+		if key, isString := token.(string); isString && parent != nil && !parent.isArray && parent.expectKey {
+			parent.key = key
+			parent.expectKey = false
+			continue
+		}
+
+		// this token starts a new value in its parent
+		if parent != nil {
+			if parent.isArray {
+				parent.items++
+				if parent.items > maxArrayItems {
+					return jsonPath(stack), true, nil
+				}
+			} else {
+				parent.expectKey = true
+			}
+		}
+
+		if isDelim {
+			stack = append(stack, &jsonContainer{isArray: delim == '[', expectKey: delim == '{'})
+		}
+	}
+}
+
+// returns the path of object keys to the innermost container in the passed in stack
+func jsonPath(stack []*jsonContainer) string {
+	keys := make([]string, 0, len(stack))
+	for _, c := range stack {
+		if !c.isArray && c.key != "" {
+			keys = append(keys, c.key)
+		}
+	}
+	if len(keys) == 0 {
+		return "$"
+	}
+	return strings.Join(keys, ".")
+}
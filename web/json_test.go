@@ -0,0 +1,62 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAndValidateJSON(t *testing.T) {
+	type testRequest struct {
+		OrgID      int   `json:"org_id"      validate:"required"`
+		ContactIDs []int `json:"contact_ids"`
+		Nested     struct {
+			Items []interface{} `json:"items"`
+		} `json:"nested"`
+	}
+
+	limits := &BodyLimits{MaxBytes: 100, MaxArrayItems: 3}
+
+	tcs := []struct {
+		body    string
+		status  int
+		err     string
+		details map[string]string
+	}{
+		{`{"org_id": 1, "contact_ids": [1, 2, 3]}`, 0, "", nil},
+		{`{"org_id": 1, "contact_ids": [1, 2, 3, 4]}`, 413, "field 'contact_ids' exceeds limit of 3 items", nil},
+		{`{"org_id": 1, "nested": {"items": [[1, 2, 3], {"a": [1]}, 3]}}`, 0, "", nil},
+		{`{"org_id": 1, "nested": {"items": [[1, 2, 3, 4]]}}`, 413, "field 'nested.items' exceeds limit of 3 items", nil},
+		{`[1, 2, 3, 4]`, 413, "field '$' exceeds limit of 3 items", nil},
+		{`{"org_id": 1, "contact_ids": [` + strings.Repeat("1, ", 30) + `1]}`, 413, "field 'contact_ids' exceeds limit of 3 items", nil},
+		{`{"org_id": 1, "other": "` + strings.Repeat("x", 100) + `"}`, 413, "request body exceeds limit of 100 bytes", nil},
+		{`{"org_id": `, 400, "request failed validation", nil},
+		{`{"contact_ids": []}`, 400, "request failed validation: field 'org_id' is required", map[string]string{"org_id": "is required"}},
+		{`{"org_id": "1"}`, 400, "request failed validation", map[string]string{"org_id": "can't be a string"}},
+	}
+
+	for _, tc := range tcs {
+		r, err := http.NewRequest(http.MethodPost, "/mr/test", strings.NewReader(tc.body))
+		require.NoError(t, err)
+
+		request := &testRequest{}
+		status, err := ReadAndValidateJSON(r, request, limits)
+
+		assert.Equal(t, tc.status, status, "status mismatch for %s", tc.body)
+		if tc.err != "" {
+			require.Error(t, err, "expected error for %s", tc.body)
+			assert.True(t, strings.HasPrefix(err.Error(), tc.err), "error mismatch for %s: %s", tc.body, err)
+
+			if tc.details != nil {
+				coded, isCoded := err.(*Error)
+				require.True(t, isCoded, "expected coded error for %s", tc.body)
+				assert.Equal(t, tc.details, coded.Details(), "details mismatch for %s", tc.body)
+			}
+		} else {
+			assert.NoError(t, err, "unexpected error for %s", tc.body)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package msg
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/client"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/view/save", web.RequireAuthToken(handleSaveView))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/view/delete", web.RequireAuthToken(handleDeleteView))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/view/list", web.RequireAuthToken(handleListViews))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/view/msgs", web.RequireAuthToken(handleViewMsgs))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/check_length", web.RequireAuthToken(web.WithOrgAssets(handleCheckLength)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/broadcast", web.RequireAuthToken(web.WithIdempotency(web.WithOrgAssets(handleBroadcast))))
+}
+
+// handles a request to save a message view, see client.MsgViewSaveRequest
+func handleSaveView(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.MsgViewSaveRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	orgID := models.OrgID(request.OrgID)
+	view := &models.MsgView{UUID: request.UUID, Name: request.Name, Filter: filterFromClient(request.Filter)}
+	if view.UUID == "" {
+		view.UUID = uuids.New()
+	}
+
+	if err := models.CountMsgView(ctx, s.DB, orgID, view); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error counting view msgs")
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	if err := models.SaveMsgView(rc, orgID, view); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return viewForClient(view), http.StatusOK, nil
+}
+
+// handles a request to delete a message view, see client.MsgViewDeleteRequest
+func handleDeleteView(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.MsgViewDeleteRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	if err := models.DeleteMsgView(rc, models.OrgID(request.OrgID), request.UUID); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return map[string]interface{}{}, http.StatusOK, nil
+}
+
+// handles a request to list message views, see client.MsgViewListRequest
+func handleListViews(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.MsgViewListRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	views, err := models.GetMsgViews(rc, models.OrgID(request.OrgID))
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	response := &client.MsgViewListResponse{Views: make([]*client.MsgView, len(views))}
+	for i, v := range views {
+		response.Views[i] = viewForClient(v)
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// handles a request for the messages in a view, see client.MsgViewMsgsRequest
+func handleViewMsgs(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.MsgViewMsgsRequest{Limit: 50}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	orgID := models.OrgID(request.OrgID)
+
+	rc := s.RP.Get()
+	view, err := models.GetMsgView(rc, orgID, request.UUID)
+	rc.Close()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if view == nil {
+		return errors.Errorf("no such view: %s", request.UUID), http.StatusNotFound, nil
+	}
+
+	ids, err := models.SelectFilteredMsgIDs(ctx, s.DB, orgID, view.Filter, flows.MsgID(request.BeforeID), request.Limit)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error selecting view msgs")
+	}
+
+	response := &client.MsgViewMsgsResponse{MsgIDs: make([]int64, len(ids))}
+	for i, id := range ids {
+		response.MsgIDs[i] = int64(id)
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// converts a filter from a client request to a message filter
+func filterFromClient(f *client.MsgFilter) *models.MsgFilter {
+	filter := &models.MsgFilter{
+		Text:      f.Text,
+		FlowID:    models.FlowID(f.FlowID),
+		After:     f.After,
+		Before:    f.Before,
+		Unhandled: f.Unhandled,
+	}
+	for _, id := range f.LabelIDs {
+		filter.LabelIDs = append(filter.LabelIDs, models.LabelID(id))
+	}
+	for _, id := range f.GroupIDs {
+		filter.GroupIDs = append(filter.GroupIDs, models.GroupID(id))
+	}
+	return filter
+}
+
+// converts a message view to the type returned to clients
+func viewForClient(v *models.MsgView) *client.MsgView {
+	filter := &client.MsgFilter{
+		Text:      v.Filter.Text,
+		FlowID:    int64(v.Filter.FlowID),
+		After:     v.Filter.After,
+		Before:    v.Filter.Before,
+		Unhandled: v.Filter.Unhandled,
+	}
+	for _, id := range v.Filter.LabelIDs {
+		filter.LabelIDs = append(filter.LabelIDs, int64(id))
+	}
+	for _, id := range v.Filter.GroupIDs {
+		filter.GroupIDs = append(filter.GroupIDs, int64(id))
+	}
+	return &client.MsgView{UUID: v.UUID, Name: v.Name, Filter: filter, Count: v.Count}
+}
+
+// response for a check length request, see client.Client.CheckMsgLength
+type checkLengthResponse struct {
+	Translations map[string]*models.MsgLength `json:"translations"`
+}
+
+// handles a request to check the length of a message, see client.MsgCheckLengthRequest
+func handleCheckLength(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.MsgCheckLengthRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	org, _ := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+
+	response := &checkLengthResponse{Translations: make(map[string]*models.MsgLength, len(request.Translations))}
+	for lang, text := range request.Translations {
+		response.Translations[lang] = models.CheckMsgLength(org, text, s.Config.MsgSegmentsWarning)
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// handles a request to send a broadcast, see client.MsgBroadcastRequest
+func handleBroadcast(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.MsgBroadcastRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	if len(request.ContactIDs) == 0 && len(request.GroupIDs) == 0 && len(request.URNs) == 0 {
+		return errors.New("request must include contacts, groups or URNs to send to"), http.StatusBadRequest, nil
+	}
+	if request.Translations[request.BaseLanguage] == nil {
+		return errors.Errorf("no translation for base language: %s", request.BaseLanguage), http.StatusBadRequest, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	translations := make(map[envs.Language]*models.BroadcastTranslation, len(request.Translations))
+	for lang, t := range request.Translations {
+		attachments := make([]utils.Attachment, len(t.Attachments))
+		for i, a := range t.Attachments {
+			attachments[i] = utils.Attachment(a)
+		}
+		translations[lang] = &models.BroadcastTranslation{Text: t.Text, Attachments: attachments, QuickReplies: t.QuickReplies}
+	}
+
+	groupIDs := make([]models.GroupID, len(request.GroupIDs))
+	for i, id := range request.GroupIDs {
+		groupIDs[i] = models.GroupID(id)
+		if org.GroupByID(groupIDs[i]) == nil {
+			return errors.Errorf("no group with id: %d", id), http.StatusNotFound, nil
+		}
+	}
+
+	contactIDs := make([]models.ContactID, len(request.ContactIDs))
+	for i, id := range request.ContactIDs {
+		contactIDs[i] = models.ContactID(id)
+	}
+
+	for _, urn := range request.URNs {
+		if err := urn.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid URN: %s", urn), http.StatusBadRequest, nil
+		}
+	}
+
+	channelID := models.NilChannelID
+	if request.ChannelUUID != "" {
+		channel := org.ChannelByUUID(request.ChannelUUID)
+		if channel == nil {
+			return errors.Errorf("no channel with uuid: %s", request.ChannelUUID), http.StatusNotFound, nil
+		}
+		channelID = channel.ID()
+	}
+
+	// URNs are recorded against the broadcast by id, so create contacts for any which don't exist yet
+	bcastURNs := make([]urns.URN, len(request.URNs))
+	if len(request.URNs) > 0 {
+		sa, err := models.NewSessionAssets(org)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error creating session assets")
+		}
+
+		_, err = models.ContactIDsFromURNs(ctx, s.DB, org, sa, request.URNs)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error creating contacts for URNs")
+		}
+
+		for i, urn := range request.URNs {
+			bcastURNs[i], err = models.URNForURN(ctx, s.DB, org, urn)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.Wrapf(err, "error loading URN: %s", urn)
+			}
+		}
+	}
+
+	bcast := models.NewBroadcast(org.OrgID(), models.NilBroadcastID, translations, models.TemplateStateUnevaluated, request.BaseLanguage, bcastURNs, contactIDs, groupIDs).
+		WithChannelID(channelID).
+		WithVariables(request.Variables)
+
+	err := models.InsertBroadcast(ctx, s.DB, bcast)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error inserting broadcast")
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	// the broadcast task resolves the contacts and creates the batches which are sent by workers
+	err = queue.AddTask(rc, queue.BatchQueue, queue.SendBroadcast, int(org.OrgID()), bcast, queue.DefaultPriority)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queuing broadcast")
+	}
+
+	logrus.WithField("org_id", request.OrgID).WithField("broadcast_id", bcast.BroadcastID()).Info("broadcast queued")
+
+	return &client.MsgBroadcastResponse{BroadcastID: int64(bcast.BroadcastID())}, http.StatusOK, nil
+}
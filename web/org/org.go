@@ -0,0 +1,194 @@
+package org
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/client"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/tasks/campaigns"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/pause_sending", web.RequireAuthToken(web.WithIdempotency(handlePauseSending)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/pause_schedules", web.RequireAuthToken(web.WithIdempotency(handlePauseSchedules)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/usage", web.RequireAuthToken(handleUsage))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/webhook_health", web.RequireAuthToken(handleWebhookHealth))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/export_promotion", web.RequireAuthToken(handleExportPromotion))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/apply_promotion", web.RequireAuthToken(web.WithOrgAssets(handleApplyPromotion)))
+}
+
+// handles a request to pause or unpause sending, see client.OrgPauseSendingRequest
+func handlePauseSending(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.OrgPauseSendingRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	orgID := models.OrgID(request.OrgID)
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	err := models.SetSendingPaused(rc, orgID, request.Paused)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error updating sending paused")
+	}
+
+	logrus.WithField("org_id", request.OrgID).WithField("paused", request.Paused).Warn("automated sending pause updated")
+
+	// report back our effective state, which may still be paused if sending is paused globally
+	paused, err := models.IsSendingPaused(rc, orgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error checking sending paused")
+	}
+
+	return &client.OrgPauseSendingResponse{OrgID: request.OrgID, Paused: paused}, http.StatusOK, nil
+}
+
+// handles a request to pause or resume schedules, see client.OrgPauseSchedulesRequest
+func handlePauseSchedules(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.OrgPauseSchedulesRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	scheduleIDs := make([]models.ScheduleID, len(request.ScheduleIDs))
+	for i, id := range request.ScheduleIDs {
+		scheduleIDs[i] = models.ScheduleID(id)
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	err := models.SetSchedulesPaused(rc, models.OrgID(request.OrgID), scheduleIDs, request.Paused)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error updating schedules paused")
+	}
+
+	logrus.WithField("org_id", request.OrgID).WithField("schedule_ids", request.ScheduleIDs).WithField("paused", request.Paused).Info("schedules pause updated")
+
+	return &client.OrgPauseSchedulesResponse{OrgID: request.OrgID, ScheduleIDs: request.ScheduleIDs, Paused: request.Paused}, http.StatusOK, nil
+}
+
+// handles a request for the usage of an org, see client.OrgUsageRequest
+func handleUsage(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.OrgUsageRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	period := request.Period
+	if period == "" {
+		period = models.UsagePeriod(time.Now())
+	} else if _, err := time.Parse(models.UsagePeriodLayout, period); err != nil {
+		return errors.Errorf("invalid period: %s", period), http.StatusBadRequest, nil
+	}
+
+	usage, err := models.GetOrgUsage(ctx, s.DB, models.OrgID(request.OrgID), period)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error reading usage")
+	}
+
+	response := &client.OrgUsageResponse{OrgID: request.OrgID, Period: period, Usage: make(map[string]int, len(usage))}
+	for counter, count := range usage {
+		response.Usage[string(counter)] = count
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// response for a webhook health request, see client.Client.GetOrgWebhookHealth
+type webhookHealthResponse struct {
+	OrgID int                     `json:"org_id"`
+	Day   string                  `json:"day"`
+	Hosts []*models.WebhookHealth `json:"hosts"`
+}
+
+// handles a request for the webhook health of an org, see client.OrgWebhookHealthRequest
+func handleWebhookHealth(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.OrgWebhookHealthRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	day := request.Day
+	if day == "" {
+		day = time.Now().UTC().Format(models.WebhookHealthDayLayout)
+	} else if _, err := time.Parse(models.WebhookHealthDayLayout, day); err != nil {
+		return errors.Errorf("invalid day: %s", day), http.StatusBadRequest, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	hosts, err := models.GetWebhookHealth(rc, models.OrgID(request.OrgID), day)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error reading webhook health")
+	}
+
+	return &webhookHealthResponse{OrgID: request.OrgID, Day: day, Hosts: hosts}, http.StatusOK, nil
+}
+
+// handles a request to export a promotion package, see client.OrgExportPromotionRequest
+func handleExportPromotion(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.OrgExportPromotionRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	pkg, err := models.ExportPromotion(ctx, s.DB, models.OrgID(request.OrgID), request.Since)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error exporting promotion")
+	}
+
+	return pkg, http.StatusOK, nil
+}
+
+// handles a request to apply a promotion package, see client.OrgApplyPromotionRequest
+func handleApplyPromotion(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.OrgApplyPromotionRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	pkg := &models.PromotionPackage{}
+	if err := json.Unmarshal(request.Package, pkg); err != nil {
+		return errors.Wrapf(err, "unable to read promotion package"), http.StatusBadRequest, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+	if pkg.SourceOrgID == org.OrgID() {
+		return errors.New("can't apply a promotion package to the org it was exported from"), http.StatusBadRequest, nil
+	}
+
+	result, err := models.ApplyPromotion(ctx, s.DB, org, request.UserID, pkg, request.DryRun)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error applying promotion")
+	}
+
+	if len(result.ScheduleEventIDs) > 0 {
+		rc := s.RP.Get()
+		defer rc.Close()
+
+		// created and changed campaign events need their fires recalculated
+		for _, eventID := range result.ScheduleEventIDs {
+			task := &campaigns.ScheduleCampaignEventTask{CampaignEventID: eventID}
+			err := queue.AddTask(rc, queue.BatchQueue, queue.ScheduleCampaignEvent, int(org.OrgID()), task, queue.DefaultPriority)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queuing scheduling of campaign event")
+			}
+		}
+	}
+
+	return result, http.StatusOK, nil
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/models"
+	"github.com/pkg/errors"
+)
+
+// the fields of a request body which we recognize as the org the request is for
+type orgRequest struct {
+	OrgID             models.OrgID `json:"org_id"`
+	ValidateWithOrgID models.OrgID `json:"validate_with_org_id"`
+}
+
+// WithOrgAssets wraps a handler so that if the request body contains an org id, the (possibly cached) assets for
+// that org are loaded before the handler is called and made available to it in the context under OrgAssetsKey
+func WithOrgAssets(handler JSONHandler) JSONHandler {
+	return func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		orgID, err := readRequestOrgID(r)
+		if err != nil {
+			return err, http.StatusBadRequest, nil
+		}
+
+		if orgID != models.NilOrgID {
+			org, err := models.GetOrgAssets(s.CTX, s.DB, orgID)
+			if err != nil {
+				return OrgAssetsError(orgID, err)
+			}
+			ctx = context.WithValue(ctx, OrgAssetsKey, org)
+		}
+
+		return handler(ctx, s, r)
+	}
+}
+
+// ErrMissingOrg is returned by handlers which need org assets when the request didn't include an org
+var ErrMissingOrg = NewError(ErrorCodeInvalidRequest, errors.New("request must include an org_id")).WithDetail("org_id", "is required")
+
+// OrgAssetsError returns the response for an error loading the assets of the passed in org, which is a 404 that
+// clients shouldn't retry if the org doesn't exist
+func OrgAssetsError(orgID models.OrgID, err error) (interface{}, int, error) {
+	if errors.Cause(err) == models.ErrNotFound {
+		return NewError(ErrorCodeNotFound, errors.Errorf("no org with id: %d", orgID)).WithDetail("org_id", "does not exist"), http.StatusNotFound, nil
+	}
+	return nil, http.StatusInternalServerError, err
+}
+
+// reads the org id from the passed in request's body if it has one, leaving the body to be read again by handlers
+func readRequestOrgID(r *http.Request) (models.OrgID, error) {
+	if r.Body == nil {
+		return models.NilOrgID, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxRequestBytes))
+	if err != nil {
+		return models.NilOrgID, errors.Wrapf(err, "unable to read request body")
+	}
+
+	// put the body back for our handler to read and validate, including anything past what we read as endpoints can
+	// have their own limits
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	// if the body isn't valid JSON we leave it to the handler to report that
+	request := &orgRequest{}
+	json.Unmarshal(body, request)
+
+	if request.OrgID != models.NilOrgID {
+		return request.OrgID, nil
+	}
+	return request.ValidateWithOrgID, nil
+}
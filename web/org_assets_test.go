@@ -0,0 +1,64 @@
+package web
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithOrgAssets(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+	server := &Server{CTX: ctx, DB: db, RP: rp, Config: config.Mailroom}
+
+	var org *models.OrgAssets
+	var body string
+	handler := WithOrgAssets(func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		org, _ = ctx.Value(OrgAssetsKey).(*models.OrgAssets)
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		return nil, http.StatusOK, nil
+	})
+
+	call := func(body string) (int, error) {
+		r, err := http.NewRequest(http.MethodPost, "/mr/test", strings.NewReader(body))
+		require.NoError(t, err)
+		_, status, err := handler(ctx, server, r)
+		return status, err
+	}
+
+	status, err := call(`{"org_id": 1, "query": "age > 10"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, models.Org1, org.OrgID())
+	assert.Equal(t, `{"org_id": 1, "query": "age > 10"}`, body) // handler can still read the body
+
+	_, err = call(`{"validate_with_org_id": 2}`)
+	assert.NoError(t, err)
+	assert.Equal(t, models.Org2, org.OrgID())
+
+	// no org id or invalid JSON, handler called without assets
+	_, err = call(`{"flow": {}}`)
+	assert.NoError(t, err)
+	assert.Nil(t, org)
+
+	_, err = call(`{"org_id": `)
+	assert.NoError(t, err)
+	assert.Nil(t, org)
+
+	// org that doesn't exist
+	r, err := http.NewRequest(http.MethodPost, "/mr/test", strings.NewReader(`{"org_id": 167733}`))
+	require.NoError(t, err)
+	value, status, err := handler(ctx, server, r)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.EqualError(t, value.(error), "no org with id: 167733")
+}
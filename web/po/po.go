@@ -0,0 +1,66 @@
+package po
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/mailroom/client"
+	"github.com/nyaruka/mailroom/goflow"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+// the limits on requests, which can include many flows
+var poLimits = &web.BodyLimits{MaxBytes: 32 * web.MaxRequestBytes, MaxArrayItems: 10000}
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/po/export", web.RequireAuthToken(handleExport))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/po/import", web.RequireAuthToken(handleImport))
+}
+
+// handles a request to export the translatable strings in flows, see client.POExportRequest
+func handleExport(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.POExportRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, poLimits); err != nil {
+		return err, status, nil
+	}
+
+	po, err := goflow.ExtractTranslations(request.Flows, request.Language)
+	if err != nil {
+		return errors.Wrapf(err, "unable to extract translations"), http.StatusUnprocessableEntity, nil
+	}
+
+	b := &strings.Builder{}
+	if err := po.Write(b); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error writing PO file")
+	}
+
+	return &client.POExportResponse{PO: b.String()}, http.StatusOK, nil
+}
+
+// handles a request to import the translations in a PO file into flows, see client.POImportRequest
+func handleImport(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.POImportRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, poLimits); err != nil {
+		return err, status, nil
+	}
+
+	po, err := goflow.ReadPO(strings.NewReader(request.PO))
+	if err != nil {
+		return errors.Wrapf(err, "unable to read PO file"), http.StatusUnprocessableEntity, nil
+	}
+
+	updated, applied, conflicts, err := goflow.ApplyTranslations(request.Flows, po, request.Language, request.Overwrite)
+	if err != nil {
+		return errors.Wrapf(err, "unable to apply translations"), http.StatusUnprocessableEntity, nil
+	}
+
+	response := &client.POImportResponse{Flows: updated, Applied: applied, Conflicts: make([]*client.POImportConflict, len(conflicts))}
+	for i, c := range conflicts {
+		response.Conflicts[i] = &client.POImportConflict{Reference: c.Reference, MsgID: c.MsgID, MsgStr: c.MsgStr, Reason: c.Reason}
+	}
+
+	return response, http.StatusOK, nil
+}
@@ -0,0 +1,111 @@
+package po
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/client"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFlow = `{"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "Test", "spec_version": "13.0.0", "type": "messaging", "language": "eng", "nodes": [{"uuid": "9b9d4b8e-0a0e-4a2b-9b63-1f5d1b5d1e01", "actions": [{"uuid": "e97cd6d5-3354-4dbd-85bc-6c1f87849eec", "type": "send_msg", "text": "Hi there"}], "exits": [{"uuid": "0fd3b2e2-6e53-4b2b-8b4e-2d0e8f2b3a01"}]}]}`
+
+func TestServer(t *testing.T) {
+	testsuite.Reset()
+	ctx := testsuite.CTX()
+	db := testsuite.DB()
+	rp := testsuite.RP()
+	wg := &sync.WaitGroup{}
+
+	server := web.NewServer(ctx, config.Mailroom, db, rp, nil, nil, wg)
+	server.Start()
+
+	// give our server time to start
+	time.Sleep(time.Second)
+
+	defer server.Stop()
+
+	tcs := []struct {
+		URL      string
+		Method   string
+		Body     string
+		Status   int
+		Response string
+	}{
+		{URL: "/mr/po/export", Method: "GET", Status: 405, Response: `{"error": "illegal method: GET", "code": "method_not_allowed", "retryable": false}`},
+		{
+			URL:      "/mr/po/export",
+			Method:   "POST",
+			Body:     fmt.Sprintf(`{"flows": [%s], "language": "spa"}`, testFlow),
+			Status:   200,
+			Response: `{"po": "# Generated by mailroom\nmsgid \"\"\nmsgstr \"\"\n\"Content-Type: text/plain; charset=UTF-8\\n\"\n\"Language: spa\\n\"\n\n#: 502c3ee4-3249-4dee-8e71-c62070667d52/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/text:0\nmsgid \"Hi there\"\nmsgstr \"\"\n"}`,
+		},
+		{
+			URL:      "/mr/po/export",
+			Method:   "POST",
+			Body:     fmt.Sprintf(`{"flows": [%s], "language": "eng"}`, testFlow),
+			Status:   422,
+			Response: `{"error": "unable to extract translations: eng is the base language of flow 502c3ee4-3249-4dee-8e71-c62070667d52", "code": "unprocessable", "retryable": false}`,
+		},
+		{
+			URL:      "/mr/po/import",
+			Method:   "POST",
+			Body:     fmt.Sprintf(`{"flows": [%s], "language": "spa", "po": "msgid \"Hi"}`, testFlow),
+			Status:   422,
+			Response: `{"error": "unable to read PO file: error on line 1: invalid string: \"Hi", "code": "unprocessable", "retryable": false}`,
+		},
+		{
+			URL:      "/mr/po/import",
+			Method:   "POST",
+			Body:     fmt.Sprintf(`{"flows": [%s], "language": "eng", "po": "msgid \"Hi there\"\nmsgstr \"Hola\""}`, testFlow),
+			Status:   422,
+			Response: `{"error": "unable to apply translations: eng is the base language of flow 502c3ee4-3249-4dee-8e71-c62070667d52", "code": "unprocessable", "retryable": false}`,
+		},
+	}
+
+	for _, tc := range tcs {
+		testID := fmt.Sprintf("%s %s %s", tc.Method, tc.URL, tc.Body)
+
+		req, err := http.NewRequest(tc.Method, "http://localhost:8090"+tc.URL, strings.NewReader(tc.Body))
+		assert.NoError(t, err, "error creating request in %s", testID)
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err, "error making request in %s", testID)
+
+		content, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err, "error reading body in %s", testID)
+
+		assert.Equal(t, tc.Status, resp.StatusCode, "unexpected status in %s (response=%s)", testID, content)
+
+		test.AssertEqualJSON(t, []byte(tc.Response), content, "response mismatch in %s", testID)
+	}
+
+	// importing a translation applies it to the flow
+	body := fmt.Sprintf(`{"flows": [%s], "language": "spa", "po": "#: 502c3ee4-3249-4dee-8e71-c62070667d52/e97cd6d5-3354-4dbd-85bc-6c1f87849eec/text:0\nmsgid \"Hi there\"\nmsgstr \"Hola\""}`, testFlow)
+	resp, err := http.Post("http://localhost:8090/mr/po/import", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+
+	response := &client.POImportResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(response))
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 1, response.Applied)
+	assert.Equal(t, 0, len(response.Conflicts))
+
+	flow := &struct {
+		Localization map[string]map[string]map[string][]string `json:"localization"`
+	}{}
+	require.NoError(t, json.Unmarshal(response.Flows[0], flow))
+	assert.Equal(t, []string{"Hola"}, flow.Localization["spa"]["e97cd6d5-3354-4dbd-85bc-6c1f87849eec"]["text"])
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nyaruka/goflow/utils/uuids"
+	"github.com/nyaruka/mailroom/models"
+
+	"github.com/go-chi/chi"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// rateLimitWindow is the sliding window over which requests are counted
+	rateLimitWindow = time.Minute
+
+	// channelUUIDParam is the URL parameter which identifies the channel of an unauthenticated route, e.g. IVR callbacks
+	channelUUIDParam = "channel_uuid"
+
+	tokenRateLimitPattern   = "web_rate:token:%s:%s"
+	channelRateLimitPattern = "web_rate:channel:%s:%s"
+	addressRateLimitPattern = "web_rate:address:%s:%s"
+	orgRateLimitPattern     = "web_rate:org:%d:%s"
+)
+
+var checkRateLimit = redis.NewScript(1, `-- KEYS: [Key] ARGV: [Now, Window, Limit, RequestID]
+	local now = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+
+	-- forget about requests which have left our window
+	redis.call("zremrangebyscore", KEYS[1], "-inf", now - window)
+
+	-- over our limit? return how long until the oldest request leaves the window
+	if redis.call("zcard", KEYS[1]) >= tonumber(ARGV[3]) then
+		local oldest = redis.call("zrange", KEYS[1], 0, 0, "WITHSCORES")
+		return tonumber(oldest[2]) + window - now
+	end
+
+	redis.call("zadd", KEYS[1], now, ARGV[4])
+	redis.call("pexpire", KEYS[1], window)
+	return 0
+`)
+
+// WithRateLimits wraps a handler for the route with the passed in pattern so that requests to it are limited to the
+// configured number per minute for each caller and each org, using a sliding window in redis. Callers are identified by
+// their authorization token, or for unauthenticated routes by their channel or remote address. Requests over a limit
+// get a 429 response with a Retry-After header. If redis can't be reached, requests are allowed through.
+func WithRateLimits(pattern string, handler JSONHandler) JSONHandler {
+	return func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		limited, err := checkRateLimits(s, r, pattern)
+		if err != nil {
+			return err, http.StatusBadRequest, nil
+		}
+		if limited != nil {
+			return limited, http.StatusTooManyRequests, nil
+		}
+
+		return handler(ctx, s, r)
+	}
+}
+
+// withHandlerRateLimits is the same as WithRateLimits for handlers which write their own responses
+func withHandlerRateLimits(pattern string, handler Handler) Handler {
+	return func(ctx context.Context, s *Server, r *http.Request, w http.ResponseWriter) error {
+		limited, err := checkRateLimits(s, r, pattern)
+		if err != nil {
+			return writeJSONError(w, err, http.StatusBadRequest)
+		}
+		if limited != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(limited.RetryAfter())))
+			return writeJSONError(w, limited, http.StatusTooManyRequests)
+		}
+
+		return handler(ctx, s, r, w)
+	}
+}
+
+// checks the caller and org limits for the passed in request, returning an error to respond with if either is exceeded
+func checkRateLimits(s *Server, r *http.Request, pattern string) (*Error, error) {
+	if s.Config.WebTokenRateLimit <= 0 && s.Config.WebOrgRateLimit <= 0 {
+		return nil, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	if s.Config.WebTokenRateLimit > 0 {
+		if limited := checkRequestRateLimit(rc, r, callerRateLimitKey(r, pattern), s.Config.WebTokenRateLimit); limited != nil {
+			return limited, nil
+		}
+	}
+
+	if s.Config.WebOrgRateLimit > 0 {
+		orgID, err := readRequestOrgID(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if orgID != models.NilOrgID {
+			key := fmt.Sprintf(orgRateLimitPattern, orgID, pattern)
+
+			if limited := checkRequestRateLimit(rc, r, key, s.Config.WebOrgRateLimit); limited != nil {
+				return limited, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// returns the key of the bucket for the caller of the passed in request on the route with the passed in pattern
+func callerRateLimitKey(r *http.Request, pattern string) string {
+	// tokens are hashed so they don't end up in redis
+	if auth := r.Header.Get("authorization"); auth != "" {
+		hash := sha1.Sum([]byte(auth))
+		return fmt.Sprintf(tokenRateLimitPattern, hex.EncodeToString(hash[:]), pattern)
+	}
+
+	// requests made outside of the router, e.g. batched requests, won't have a route context
+	if rctx, _ := r.Context().Value(chi.RouteCtxKey).(*chi.Context); rctx != nil {
+		if channelUUID := rctx.URLParam(channelUUIDParam); channelUUID != "" {
+			return fmt.Sprintf(channelRateLimitPattern, channelUUID, pattern)
+		}
+	}
+
+	// remote addresses have already been replaced by any X-Forwarded-For or X-Real-IP header by our middleware
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		address = r.RemoteAddr
+	}
+	return fmt.Sprintf(addressRateLimitPattern, address, pattern)
+}
+
+// counts a request against the limit with the passed in key, returning an error to respond with if it's over the limit
+func checkRequestRateLimit(rc redis.Conn, r *http.Request, key string, limit int) *Error {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	window := int64(rateLimitWindow / time.Millisecond)
+
+	wait, err := redis.Int64(checkRateLimit.Do(rc, key, now, window, limit, string(uuids.New())))
+	if err != nil {
+		logrus.WithError(err).WithField("path", r.URL.Path).Error("error checking rate limit, allowing request")
+		return nil
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	retryAfter := time.Duration(wait) * time.Millisecond
+
+	return NewError(ErrorCodeRateLimited, errors.Errorf("rate limit of %d requests per minute exceeded", limit)).
+		WithDetail("retry_after", strconv.Itoa(retryAfterSeconds(retryAfter))).
+		WithRetryAfter(retryAfter)
+}
+
+// returns the passed in duration as a number of whole seconds for a Retry-After header, rounding up
+func retryAfterSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/nyaruka/mailroom/config"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRateLimits(t *testing.T) {
+	ctx, db, rp := testsuite.Reset()
+
+	cfg := *config.Mailroom
+	cfg.WebTokenRateLimit = 3
+	cfg.WebOrgRateLimit = 2
+	server := &Server{CTX: ctx, DB: db, RP: rp, Config: &cfg}
+
+	calls := 0
+	handler := WithRateLimits("/mr/test", func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		calls++
+		return map[string]int{"calls": calls}, http.StatusOK, nil
+	})
+
+	call := func(token, body string) (interface{}, int) {
+		r, err := http.NewRequest(http.MethodPost, "/mr/test", strings.NewReader(body))
+		require.NoError(t, err)
+		r.Header.Set("Authorization", "Token "+token)
+
+		value, status, err := handler(ctx, server, r)
+		require.NoError(t, err)
+		return value, status
+	}
+
+	// org 1 can make 2 requests
+	_, status := call("abc", `{"org_id": 1}`)
+	assert.Equal(t, http.StatusOK, status)
+	_, status = call("abc", `{"org_id": 1}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	value, status := call("def", `{"org_id": 1}`)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, 2, calls)
+
+	limited, isLimited := value.(*Error)
+	require.True(t, isLimited)
+	assert.Equal(t, ErrorCodeRateLimited, limited.Code())
+	assert.True(t, limited.Retryable())
+	assert.True(t, limited.RetryAfter() > 0)
+	assert.Equal(t, "60", limited.Details()["retry_after"])
+
+	// other orgs are counted separately but token abc has now used up its 3 requests
+	_, status = call("abc", `{"org_id": 2}`)
+	assert.Equal(t, http.StatusOK, status)
+	_, status = call("abc", `{"org_id": 2}`)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	// requests without an org are only limited by token
+	_, status = call("def", `{}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 4, calls)
+
+	// other routes are counted separately
+	otherHandler := WithRateLimits("/mr/other", func(ctx context.Context, s *Server, r *http.Request) (interface{}, int, error) {
+		return map[string]string{}, http.StatusOK, nil
+	})
+	r, err := http.NewRequest(http.MethodPost, "/mr/other", strings.NewReader(`{"org_id": 1}`))
+	require.NoError(t, err)
+	r.Header.Set("Authorization", "Token abc")
+	_, status, err = otherHandler(ctx, server, r)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	// unauthenticated requests are counted by remote address
+	callAnon := func(address string) int {
+		r, err := http.NewRequest(http.MethodPost, "/mr/test", strings.NewReader(`{}`))
+		require.NoError(t, err)
+		r.RemoteAddr = address
+
+		_, status, err := handler(ctx, server, r)
+		require.NoError(t, err)
+		return status
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, callAnon("10.0.0.1:1234"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, callAnon("10.0.0.1:5678"))
+	assert.Equal(t, http.StatusOK, callAnon("10.0.0.2:1234"))
+
+	// no limits configured, nothing limited
+	server.Config = config.Mailroom
+	_, status = call("abc", `{"org_id": 1}`)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestCallerRateLimitKey(t *testing.T) {
+	newRequest := func(auth, address, channelUUID string) *http.Request {
+		r, _ := http.NewRequest(http.MethodPost, "/mr/test", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		r.RemoteAddr = address
+		if channelUUID != "" {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("channel_uuid", channelUUID)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		}
+		return r
+	}
+
+	assert.Equal(t, "web_rate:token:a4501b2dd03639a593edc3374bdb3771eea1bb04:/mr/test", callerRateLimitKey(newRequest("Token abc", "10.0.0.1:1234", ""), "/mr/test"))
+	assert.Equal(t, "web_rate:channel:74729f45-7f29-4868-9dc4-90e491e3c7d8:/mr/ivr", callerRateLimitKey(newRequest("", "10.0.0.1:1234", "74729f45-7f29-4868-9dc4-90e491e3c7d8"), "/mr/ivr"))
+	assert.Equal(t, "web_rate:address:10.0.0.1:/mr/test", callerRateLimitKey(newRequest("", "10.0.0.1:1234", ""), "/mr/test"))
+	assert.Equal(t, "web_rate:address:10.0.0.1:/mr/test", callerRateLimitKey(newRequest("", "10.0.0.1", ""), "/mr/test"))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +30,9 @@ const (
 	// UserIDKey is our context key for user id
 	UserIDKey = "user_id"
 
+	// OrgAssetsKey is our context key for org assets
+	OrgAssetsKey = "org_assets"
+
 	// MaxRequestBytes is the max body size our web server will accept
 	MaxRequestBytes int64 = 1048576
 )
@@ -52,14 +56,21 @@ type route struct {
 
 var routes = make([]*route, 0)
 
+// RegisterJSONRoute registers a JSON handler for the passed in method and pattern, requests to which are rate limited
 func RegisterJSONRoute(method string, pattern string, handler JSONHandler) {
-	jsonRoutes = append(jsonRoutes, &jsonRoute{method, pattern, handler})
+	jsonRoutes = append(jsonRoutes, &jsonRoute{method, pattern, WithRateLimits(pattern, handler)})
 }
 
 func RegisterRoute(method string, pattern string, handler Handler) {
 	routes = append(routes, &route{method, pattern, handler})
 }
 
+// RegisterRateLimitedRoute registers a handler which writes its own responses for the passed in method and pattern,
+// requests to which are rate limited like JSON routes
+func RegisterRateLimitedRoute(method string, pattern string, handler Handler) {
+	routes = append(routes, &route{method, pattern, withHandlerRateLimits(pattern, handler)})
+}
+
 // NewServer creates a new web server, it will need to be started after being created
 func NewServer(ctx context.Context, config *config.Config, db *sqlx.DB, rp *redis.Pool, s3Client s3iface.S3API, elasticClient *elastic.Client, wg *sync.WaitGroup) *Server {
 	s := &Server{
@@ -182,12 +193,17 @@ func (s *Server) WrapJSONHandler(handler JSONHandler) http.HandlerFunc {
 
 		// handler errored (a hard error)
 		if err != nil {
-			value = NewErrorResponse(err)
+			value = newErrorResponse(err, http.StatusInternalServerError)
 		} else {
 			// handler returned an error to use as a the response
 			asError, isError := value.(error)
 			if isError {
-				value = NewErrorResponse(asError)
+				value = newErrorResponse(asError, status)
+
+				coded, isCoded := errors.Cause(asError).(*Error)
+				if isCoded && coded.RetryAfter() > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(coded.RetryAfter())))
+				}
 			}
 		}
 
@@ -221,12 +237,25 @@ func (s *Server) WrapHandler(handler Handler) http.HandlerFunc {
 
 		logrus.WithError(err).WithField("http_request", r).Error("error handling request")
 		w.WriteHeader(http.StatusInternalServerError)
-		serialized, _ := json.Marshal(NewErrorResponse(err))
+		serialized, _ := json.Marshal(newErrorResponse(err, http.StatusInternalServerError))
 		w.Write(serialized)
 		return
 	}
 }
 
+// writes the passed in error as a JSON error response with the passed in status
+func writeJSONError(w http.ResponseWriter, err error, status int) error {
+	serialized, serr := json.Marshal(newErrorResponse(err, status))
+	if serr != nil {
+		return errors.Wrapf(serr, "error serializing error")
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(serialized)
+	return errors.Wrapf(err, "error writing error")
+}
+
 // Start starts our web server, listening for new requests
 func (s *Server) Start() {
 	// start serving HTTP
@@ -284,13 +313,3 @@ type Server struct {
 
 	httpServer *http.Server
 }
-
-// ErrorResponse is the type for our error responses, it just contains a single error field
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
-
-// NewErrorResponse creates a new error response from the passed in errro
-func NewErrorResponse(err error) *ErrorResponse {
-	return &ErrorResponse{err.Error()}
-}
@@ -0,0 +1,176 @@
+package session
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/nyaruka/mailroom/client"
+	"github.com/nyaruka/mailroom/goflow"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/queue"
+	"github.com/nyaruka/mailroom/tasks/handler"
+	"github.com/nyaruka/mailroom/tasks/interrupts"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/session/debug", web.RequireAuthToken(handleDebug))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/session/interrupt", web.RequireAuthToken(web.WithOrgAssets(handleInterrupt)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/session/callback/{token}", handleCallback)
+}
+
+// handles a request for a debug view of a session, see client.SessionDebugRequest
+func handleDebug(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.SessionDebugRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+	if request.SessionUUID == "" && request.RunUUID == "" {
+		return errors.Errorf("request must include a session_uuid or run_uuid"), http.StatusBadRequest, nil
+	}
+
+	debug, err := models.LoadSessionDebug(ctx, s.DB, models.OrgID(request.OrgID), request.SessionUUID, request.RunUUID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error loading session")
+	}
+	if debug == nil {
+		return errors.Errorf("no such session in org"), http.StatusNotFound, nil
+	}
+
+	return debug, http.StatusOK, nil
+}
+
+// handles a request to interrupt sessions, see client.SessionInterruptRequest
+func handleInterrupt(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.SessionInterruptRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+	if len(request.ContactIDs) == 0 && len(request.ChannelIDs) == 0 && len(request.FlowIDs) == 0 {
+		return errors.New("request must include contacts, channels or flows to interrupt"), http.StatusBadRequest, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	// channels and flows must belong to the org, and contacts which don't are ignored
+	task := &interrupts.InterruptSessionsTask{}
+	for _, id := range request.ChannelIDs {
+		if org.ChannelByID(models.ChannelID(id)) == nil {
+			return errors.Errorf("no channel with id: %d", id), http.StatusNotFound, nil
+		}
+		task.ChannelIDs = append(task.ChannelIDs, models.ChannelID(id))
+	}
+	for _, id := range request.FlowIDs {
+		if _, err := org.FlowByID(models.FlowID(id)); err != nil {
+			return errors.Errorf("no flow with id: %d", id), http.StatusNotFound, nil
+		}
+		task.FlowIDs = append(task.FlowIDs, models.FlowID(id))
+	}
+
+	contactIDs := make([]models.ContactID, len(request.ContactIDs))
+	for i, id := range request.ContactIDs {
+		contactIDs[i] = models.ContactID(id)
+	}
+	contactIDs, err := models.FilterContactIDsByOrg(ctx, s.DB, org.OrgID(), contactIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error filtering contacts")
+	}
+	task.ContactIDs = contactIDs
+
+	sessionIDs, err := interrupts.ResolveSessionIDs(ctx, s.DB, task)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error resolving sessions")
+	}
+
+	response := &client.SessionInterruptResponse{SessionIDs: make([]int64, len(sessionIDs)), DryRun: request.DryRun}
+	for i, id := range sessionIDs {
+		response.SessionIDs[i] = int64(id)
+	}
+
+	if request.DryRun || len(sessionIDs) == 0 {
+		return response, http.StatusOK, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	// interrupt exactly the sessions we've returned
+	err = queue.AddTask(rc, queue.BatchQueue, queue.InterruptSessions, int(org.OrgID()), &interrupts.InterruptSessionsTask{SessionIDs: sessionIDs}, queue.DefaultPriority)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queuing interrupt of sessions")
+	}
+
+	logrus.WithField("org_id", request.OrgID).WithField("count", len(sessionIDs)).Info("sessions interrupt queued")
+
+	return response, http.StatusOK, nil
+}
+
+// handles a callback to resume a run which is waiting for an external system, such as one confirming a payment. Webhook
+// calls which include the X-Mailroom-Callback header are sent the callback URL for the run in that header, and posting
+// to that URL once resumes the run with the request body as its input, if the run is waiting at the wait which followed
+// the call. The URL is signed so this endpoint doesn't require an auth token.
+func handleCallback(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	callback, err := goflow.ParseCallbackToken(chi.URLParam(r, "token"))
+	if err != nil {
+		return err, http.StatusNotFound, nil
+	}
+
+	payload, err := ioutil.ReadAll(io.LimitReader(r.Body, web.MaxRequestBytes+1))
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error reading callback body")
+	}
+	if int64(len(payload)) > web.MaxRequestBytes {
+		return errors.Errorf("callback body exceeds %d bytes", web.MaxRequestBytes), http.StatusRequestEntityTooLarge, nil
+	}
+
+	run, err := models.LoadWaitingRun(ctx, s.DB, callback.RunUUID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error loading run")
+	}
+	if run == nil {
+		return web.NewError(web.ErrorCodeNotFound, errors.Errorf("run %s is not waiting", callback.RunUUID)), http.StatusNotFound, nil
+	}
+
+	org, err := models.GetOrgAssets(ctx, s.DB, run.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error loading org assets")
+	}
+
+	_, session, err := handler.LoadCallbackSession(ctx, s.DB, org, run, callback)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if session == nil {
+		return web.NewError(web.ErrorCodeNotFound, errors.Errorf("run %s is not waiting for this callback", callback.RunUUID)), http.StatusNotFound, nil
+	}
+
+	rc := s.RP.Get()
+	defer rc.Close()
+
+	claimed, err := handler.ClaimCallback(rc, callback)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if !claimed {
+		return errors.Errorf("callback has already been used"), http.StatusConflict, nil
+	}
+
+	// resuming is queued for the contact so that it's handled in order with their messages
+	err = handler.AddHandleTask(rc, run.ContactID, handler.NewCallbackTask(run, callback, string(payload)))
+	if err != nil {
+		handler.ReleaseCallback(rc, callback)
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queuing callback")
+	}
+
+	logrus.WithField("org_id", run.OrgID).WithField("contact_id", run.ContactID).WithField("run_uuid", callback.RunUUID).Info("run callback queued")
+
+	return &client.SessionCallbackResponse{Status: "queued"}, http.StatusOK, nil
+}
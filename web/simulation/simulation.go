@@ -14,7 +14,7 @@ import (
 	"github.com/nyaruka/goflow/flows/events"
 	"github.com/nyaruka/goflow/flows/resumes"
 	"github.com/nyaruka/goflow/flows/triggers"
-	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/client"
 	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/web"
@@ -24,6 +24,7 @@ import (
 func init() {
 	web.RegisterJSONRoute(http.MethodPost, "/mr/sim/start", web.RequireAuthToken(handleStart))
 	web.RegisterJSONRoute(http.MethodPost, "/mr/sim/resume", web.RequireAuthToken(handleResume))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/sim/transcript", web.RequireAuthToken(handleTranscript))
 }
 
 type flowDefinition struct {
@@ -37,7 +38,10 @@ type sessionRequest struct {
 	Flows  []flowDefinition `json:"flows"`
 	Assets struct {
 		Channels []*types.Channel `json:"channels"`
+		Fields   []*types.Field   `json:"fields"`
+		Groups   []*types.Group   `json:"groups"`
 	} `json:"assets"`
+	Stubs *goflow.SimulatorStubs `json:"stubs"`
 }
 
 type simulationResponse struct {
@@ -61,7 +65,10 @@ func newSimulationResponse(session flows.Session, sprint flows.Sprint) *simulati
 	return &simulationResponse{Session: session, Events: sprint.Events(), Context: context}
 }
 
-// Starts a new engine session
+// Starts a new engine session. Flow definitions and assets in the request are layered over the org's real assets so
+// that unsaved flow revisions, test channels and draft fields and groups can be simulated. Stubs in the request are
+// used as the responses of webhooks, classifiers and airtime transfers. Webhook calls and classifications which aren't
+// stubbed fail so that no external calls are made, unless passthrough is set.
 //
 //   {
 //     "org_id": 1,
@@ -71,7 +78,17 @@ func newSimulationResponse(session flows.Session, sprint flows.Sprint) *simulati
 //        "legacy_definition": "legacy definition",
 //     },.. ],
 //     "trigger": {...},
-//     "assets": {...}
+//     "assets": {
+//       "channels": [...],
+//       "fields": [{"uuid": "f1b5aea6-6586-41c7-9020-1a6326cc6565", "key": "nickname", "name": "Nickname", "type": "text"}],
+//       "groups": [{"uuid": "5e9d8fab-5e7e-4f51-b533-261af5dea70d", "name": "VIPs", "query": "nickname != \"\""}]
+//     },
+//     "stubs": {
+//       "webhooks": {"http://example.com/lookup": {"status": 200, "body": "{\"name\": \"Bob\"}"}},
+//       "classifications": {"097e026c-ae79-4740-af67-656dbedf0263": {"intents": [{"name": "book_flight", "confidence": 0.9}]}},
+//       "airtime": {"error": "insufficient balance"},
+//       "passthrough": false
+//     }
 //   }
 //
 type startRequest struct {
@@ -99,17 +116,17 @@ func handleSimulationEvents(ctx context.Context, db models.Queryer, org *models.
 	return models.InsertWebhookEvents(ctx, db, wes)
 }
 
-// handles a request to /start
+// handles a request to /start, see client.SimStartRequest
 func handleStart(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
 	request := &startRequest{}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return nil, http.StatusBadRequest, errors.Wrapf(err, "request failed validation")
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return nil, status, err
 	}
 
 	// grab our org
 	org, err := models.NewOrgAssets(s.CTX, s.DB, request.OrgID, nil)
 	if err != nil {
-		return nil, http.StatusBadRequest, errors.Wrapf(err, "unable to load org assets")
+		return web.OrgAssetsError(request.OrgID, err)
 	}
 
 	// for each of our passed in definitions
@@ -121,10 +138,16 @@ func handleStart(ctx context.Context, s *web.Server, r *http.Request) (interface
 		}
 	}
 
-	// populate any test channels
+	// populate any test channels and draft fields and groups
 	for _, channel := range request.Assets.Channels {
 		org.AddTestChannel(channel)
 	}
+	for _, field := range request.Assets.Fields {
+		org.AddTestField(field)
+	}
+	for _, group := range request.Assets.Groups {
+		org.AddTestGroup(group)
+	}
 
 	// build our session
 	sa, err := models.NewSessionAssets(org)
@@ -138,13 +161,13 @@ func handleStart(ctx context.Context, s *web.Server, r *http.Request) (interface
 		return nil, http.StatusBadRequest, errors.Wrapf(err, "unable to read trigger")
 	}
 
-	return triggerFlow(ctx, s.DB, org, sa, trigger)
+	return triggerFlow(ctx, s.DB, org, sa, goflow.StubbedSimulator(request.Stubs), trigger)
 }
 
 // triggerFlow creates a new session with the passed in trigger, returning our standard response
-func triggerFlow(ctx context.Context, db *sqlx.DB, org *models.OrgAssets, sa flows.SessionAssets, trigger flows.Trigger) (interface{}, int, error) {
+func triggerFlow(ctx context.Context, db *sqlx.DB, org *models.OrgAssets, sa flows.SessionAssets, simulator flows.Engine, trigger flows.Trigger) (interface{}, int, error) {
 	// start our flow session
-	session, sprint, err := goflow.Simulator().NewSession(sa, trigger)
+	session, sprint, err := simulator.NewSession(sa, trigger)
 	if err != nil {
 		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error starting session")
 	}
@@ -168,7 +191,8 @@ func triggerFlow(ctx context.Context, db *sqlx.DB, org *models.OrgAssets, sa flo
 //     },.. ],
 //     "session": {"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "runs": [...], ...},
 //     "resume": {...},
-//     "assets": {...}
+//     "assets": {...},
+//     "stubs": {...}
 //   }
 //
 type resumeRequest struct {
@@ -178,16 +202,17 @@ type resumeRequest struct {
 	Resume  json.RawMessage `json:"resume" validate:"required"`
 }
 
+// handles a request to /resume, see client.SimResumeRequest
 func handleResume(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
 	request := &resumeRequest{}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return nil, http.StatusBadRequest, err
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return nil, status, err
 	}
 
 	// grab our org
 	org, err := models.NewOrgAssets(s.CTX, s.DB, request.OrgID, nil)
 	if err != nil {
-		return nil, http.StatusBadRequest, err
+		return web.OrgAssetsError(request.OrgID, err)
 	}
 
 	// for each of our passed in definitions
@@ -199,10 +224,16 @@ func handleResume(ctx context.Context, s *web.Server, r *http.Request) (interfac
 		}
 	}
 
-	// populate any test channels
+	// populate any test channels and draft fields and groups
 	for _, channel := range request.Assets.Channels {
 		org.AddTestChannel(channel)
 	}
+	for _, field := range request.Assets.Fields {
+		org.AddTestField(field)
+	}
+	for _, group := range request.Assets.Groups {
+		org.AddTestGroup(group)
+	}
 
 	// build our session
 	sa, err := models.NewSessionAssets(org)
@@ -210,7 +241,9 @@ func handleResume(ctx context.Context, s *web.Server, r *http.Request) (interfac
 		return nil, http.StatusInternalServerError, err
 	}
 
-	session, err := goflow.Simulator().ReadSession(sa, request.Session, assets.IgnoreMissing)
+	simulator := goflow.StubbedSimulator(request.Stubs)
+
+	session, err := simulator.ReadSession(sa, request.Session, assets.IgnoreMissing)
 	if err != nil {
 		return nil, http.StatusBadRequest, err
 	}
@@ -246,7 +279,7 @@ func handleResume(ctx context.Context, s *web.Server, r *http.Request) (interfac
 
 				if triggeredFlow != nil {
 					trigger := triggers.NewMsg(org.Env(), triggeredFlow.FlowReference(), resume.Contact(), msgResume.Msg(), trigger.Match())
-					return triggerFlow(ctx, s.DB, org, sa, trigger)
+					return triggerFlow(ctx, s.DB, org, sa, simulator, trigger)
 				}
 			}
 		}
@@ -271,23 +304,57 @@ func handleResume(ctx context.Context, s *web.Server, r *http.Request) (interfac
 	return newSimulationResponse(session, sprint), http.StatusOK, nil
 }
 
-// populateFlow takes care of setting the definition for the flow with the passed in UUID according to the passed in definitions
+// response for a transcript request, see client.Client.SimulationTranscript
+type transcriptResponse struct {
+	Transcript *Transcript `json:"transcript"`
+	HTML       string      `json:"html,omitempty"`
+}
+
+// handles a request to /transcript, see client.SimTranscriptRequest
+func handleTranscript(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.SimTranscriptRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	transcript, err := NewTranscript(request.Session)
+	if err != nil {
+		return err, http.StatusBadRequest, nil
+	}
+
+	response := &transcriptResponse{Transcript: transcript}
+	if request.HTML {
+		response.HTML, err = transcript.HTML()
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// populateFlow takes care of setting the definition for the flow with the passed in UUID according to the passed in definitions,
+// migrated to the flow spec version pinned by the org if it has one
 func populateFlow(org *models.OrgAssets, uuid assets.FlowUUID, flowDef json.RawMessage, legacyFlowDef json.RawMessage) error {
 	f, err := org.Flow(uuid)
 	if err != nil {
 		return errors.Wrapf(err, "unable to find flow with uuid: %s", uuid)
 	}
 
-	flow := f.(*models.Flow)
-	if flowDef != nil {
-		flow.SetDefinition(flowDef)
-		return nil
+	definition := flowDef
+	if definition == nil {
+		definition = legacyFlowDef
+	}
+	if definition == nil {
+		return errors.Errorf("missing definition or legacy_definition for flow: %s", uuid)
 	}
 
-	if legacyFlowDef != nil {
-		flow.SetDefinition(legacyFlowDef)
-		return nil
+	// simulate the flow as it would be saved by this org
+	migrated, err := goflow.MigrateDefinition(definition, goflow.MigrationTarget(org.Org().FlowSpecVersion()))
+	if err != nil {
+		return errors.Wrapf(err, "unable to migrate flow with uuid: %s", uuid)
 	}
 
-	return errors.Errorf("missing definition or legacy_definition for flow: %s", uuid)
+	f.(*models.Flow).SetDefinition(migrated)
+	return nil
 }
@@ -247,6 +247,87 @@ const (
 			]
 		}
 	}`
+
+	stubbedStartBody = `
+	{
+		"org_id": 1,
+		"trigger": {
+			"contact": {
+				"created_on": "2000-01-01T00:00:00.000000000-00:00",
+				"fields": {},
+				"id": 1234567,
+				"language": "eng",
+				"name": "Ben Haggerty",
+				"timezone": "America/Guayaquil",
+				"urns": [
+					"tel:+12065551212"
+				],
+				"uuid": "ba96bf7f-bc2a-4873-a7c7-254d1927c4e3"
+			},
+			"environment": {
+				"allowed_languages": [
+					"eng",
+					"fra"
+				],
+				"date_format": "YYYY-MM-DD",
+				"default_language": "eng",
+				"time_format": "hh:mm",
+				"timezone": "America/Los_Angeles"
+			},
+			"flow": {
+				"name": "Favorites",
+				"uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85"
+			},
+			"triggered_on": "2000-01-01T00:00:00.000000000-00:00",
+			"type": "manual"
+		},
+		"flows": [
+			{
+				"uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85",
+				"definition": {
+					"uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85",
+					"name": "Webhook Lookup",
+					"spec_version": "13.1.0",
+					"language": "eng",
+					"type": "messaging",
+					"revision": 1,
+					"expire_after_minutes": 10080,
+					"localization": {},
+					"nodes": [
+						{
+							"uuid": "6f3a8a4e-2bb2-4e44-9dd4-8f3bdbb0a3a6",
+							"actions": [
+								{
+									"uuid": "2f4a3c1e-8d0b-4d1a-9b9e-5d4b7f0e6c11",
+									"type": "call_webhook",
+									"method": "GET",
+									"url": "http://example.com/lookup",
+									"headers": {},
+									"body": "",
+									"result_name": "Lookup"
+								},
+								{
+									"uuid": "b5a4ee3a-91b4-4c8f-8f6b-3c0f6f3a9d2e",
+									"type": "send_msg",
+									"text": "Lookup was @results.lookup.category"
+								}
+							],
+							"exits": [
+								{
+									"uuid": "d2b6ac3a-0f1e-4a4f-9e1a-7b6e5c8f2a90"
+								}
+							]
+						}
+					]
+				}
+			}
+		],
+		"stubs": {
+			"webhooks": {
+				"http://example.com/lookup": {"status": 200, "body": "{\"name\": \"Bob\"}"}
+			}
+		}
+	}`
 )
 
 func TestServer(t *testing.T) {
@@ -296,6 +377,7 @@ func TestServer(t *testing.T) {
 		{"/mr/sim/start", "POST", startBody, 200, "What is your favorite color?"},
 		{"/mr/sim/resume", "POST", triggerResumeBody, 200, "it is time to consult with your patients"},
 		{"/mr/sim/resume", "POST", resumeBody, 200, "it is time to consult with your patients"},
+		{"/mr/sim/start", "POST", stubbedStartBody, 200, "Lookup was Success"},
 	}
 
 	for i, tc := range tcs {
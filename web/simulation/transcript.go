@@ -0,0 +1,207 @@
+package simulation
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"sort"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/pkg/errors"
+)
+
+// Transcript is a shareable record of a simulated conversation, e.g. to attach to a test case or bug report
+type Transcript struct {
+	SessionUUID flows.SessionUUID   `json:"session_uuid"`
+	Status      string              `json:"status"`
+	Contact     string              `json:"contact"`
+	Entries     []*TranscriptEntry  `json:"entries"`
+	Results     []*TranscriptResult `json:"results"`
+}
+
+// TranscriptEntry is a single thing which happened in a simulated conversation
+type TranscriptEntry struct {
+	Type         string    `json:"type"`
+	CreatedOn    time.Time `json:"created_on"`
+	Flow         string    `json:"flow"`
+	Text         string    `json:"text,omitempty"`
+	Attachments  []string  `json:"attachments,omitempty"`
+	QuickReplies []string  `json:"quick_replies,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	ElapsedMS    int       `json:"elapsed_ms,omitempty"`
+}
+
+// TranscriptResult is a result set in a simulated conversation
+type TranscriptResult struct {
+	Flow      string    `json:"flow"`
+	Name      string    `json:"name"`
+	Value     string    `json:"value"`
+	Category  string    `json:"category"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// the entry types in a transcript
+const (
+	transcriptMsgIn       = "msg_in"
+	transcriptMsgOut      = "msg_out"
+	transcriptFlowEntered = "flow_entered"
+	transcriptWebhook     = "webhook"
+	transcriptError       = "error"
+)
+
+// the subset of a session's JSON we need to build a transcript
+type transcriptSession struct {
+	UUID    flows.SessionUUID `json:"uuid"`
+	Status  string            `json:"status"`
+	Contact struct {
+		Name string `json:"name"`
+	} `json:"contact"`
+	Runs []struct {
+		Flow struct {
+			Name string `json:"name"`
+		} `json:"flow"`
+		Events  []*transcriptEvent           `json:"events"`
+		Results map[string]*TranscriptResult `json:"results"`
+	} `json:"runs"`
+}
+
+// the subset of an event's JSON we include in a transcript
+type transcriptEvent struct {
+	Type      string    `json:"type"`
+	CreatedOn time.Time `json:"created_on"`
+	Text      string    `json:"text"`
+	Msg       *struct {
+		Text         string   `json:"text"`
+		Attachments  []string `json:"attachments"`
+		QuickReplies []string `json:"quick_replies"`
+	} `json:"msg"`
+	Flow *struct {
+		Name string `json:"name"`
+	} `json:"flow"`
+	URL        string `json:"url"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code"`
+	ElapsedMS  int    `json:"elapsed_ms"`
+}
+
+// NewTranscript builds a transcript from the passed in session JSON as returned by the simulator
+func NewTranscript(sessionJSON json.RawMessage) (*Transcript, error) {
+	session := &transcriptSession{}
+	if err := json.Unmarshal(sessionJSON, session); err != nil {
+		return nil, errors.Wrapf(err, "error reading session")
+	}
+
+	transcript := &Transcript{
+		SessionUUID: session.UUID,
+		Status:      session.Status,
+		Contact:     session.Contact.Name,
+		Entries:     make([]*TranscriptEntry, 0),
+		Results:     make([]*TranscriptResult, 0),
+	}
+
+	for _, r := range session.Runs {
+		for _, e := range r.Events {
+			entry := &TranscriptEntry{CreatedOn: e.CreatedOn, Flow: r.Flow.Name}
+
+			switch e.Type {
+			case events.TypeMsgReceived, events.TypeMsgCreated, events.TypeIVRCreated:
+				if e.Msg == nil {
+					continue
+				}
+				entry.Type = transcriptMsgOut
+				if e.Type == events.TypeMsgReceived {
+					entry.Type = transcriptMsgIn
+				}
+				entry.Text = e.Msg.Text
+				entry.Attachments = e.Msg.Attachments
+				entry.QuickReplies = e.Msg.QuickReplies
+			case events.TypeFlowEntered:
+				entry.Type = transcriptFlowEntered
+
+				// entries are attributed to the flow being entered rather than the one doing the entering
+				if e.Flow != nil {
+					entry.Flow = e.Flow.Name
+				}
+			case events.TypeWebhookCalled:
+				entry.Type = transcriptWebhook
+				entry.URL = e.URL
+				entry.Status = e.Status
+				entry.StatusCode = e.StatusCode
+				entry.ElapsedMS = e.ElapsedMS
+			case events.TypeError:
+				entry.Type = transcriptError
+				entry.Text = e.Text
+			default:
+				continue
+			}
+
+			transcript.Entries = append(transcript.Entries, entry)
+		}
+
+		for _, result := range r.Results {
+			result.Flow = r.Flow.Name
+			transcript.Results = append(transcript.Results, result)
+		}
+	}
+
+	// entries which happened at the same time stay in the order of their runs and events
+	sort.SliceStable(transcript.Entries, func(i, j int) bool {
+		return transcript.Entries[i].CreatedOn.Before(transcript.Entries[j].CreatedOn)
+	})
+
+	// results come from maps so we use their flow and name to order results which were set at the same time
+	sort.Slice(transcript.Results, func(i, j int) bool {
+		ri, rj := transcript.Results[i], transcript.Results[j]
+		if !ri.CreatedOn.Equal(rj.CreatedOn) {
+			return ri.CreatedOn.Before(rj.CreatedOn)
+		}
+		if ri.Flow != rj.Flow {
+			return ri.Flow < rj.Flow
+		}
+		return ri.Name < rj.Name
+	})
+
+	return transcript, nil
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Simulation {{.SessionUUID}}</title>
+</head>
+<body>
+<h1>Simulation with {{.Contact}}</h1>
+<p>Session {{.SessionUUID}} ({{.Status}})</p>
+<table class="transcript">
+{{range .Entries}}<tr class="{{.Type}}">
+<td>{{.CreatedOn.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.Flow}}</td>
+<td>{{if eq .Type "msg_in"}}&larr; {{.Text}}{{else if eq .Type "msg_out"}}&rarr; {{.Text}}{{if .QuickReplies}} [{{range $i, $q := .QuickReplies}}{{if $i}} | {{end}}{{$q}}{{end}}]{{end}}{{else if eq .Type "flow_entered"}}entered flow{{else if eq .Type "webhook"}}called {{.URL}}: {{.Status}} {{.StatusCode}} in {{.ElapsedMS}}ms{{else}}error: {{.Text}}{{end}}{{range .Attachments}}<br>{{.}}{{end}}</td>
+</tr>
+{{end}}</table>
+<h2>Results</h2>
+<table class="results">
+{{range .Results}}<tr>
+<td>{{.Flow}}</td>
+<td>{{.Name}}</td>
+<td>{{.Value}}</td>
+<td>{{.Category}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// HTML renders this transcript as a standalone HTML document
+func (t *Transcript) HTML() (string, error) {
+	out := &bytes.Buffer{}
+	if err := transcriptTemplate.Execute(out, t); err != nil {
+		return "", errors.Wrapf(err, "error rendering transcript")
+	}
+	return out.String(), nil
+}
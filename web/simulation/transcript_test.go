@@ -0,0 +1,73 @@
+package simulation
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscript(t *testing.T) {
+	session := json.RawMessage(`{
+		"uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0",
+		"status": "completed",
+		"contact": {"uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf", "name": "Ben Haggerty"},
+		"runs": [
+			{
+				"flow": {"uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "name": "Favorites"},
+				"events": [
+					{"type": "msg_created", "created_on": "2020-04-15T12:00:00Z", "msg": {"text": "What is your <b>favorite</b> color?", "quick_replies": ["red", "blue"]}},
+					{"type": "msg_received", "created_on": "2020-04-15T12:00:05Z", "msg": {"text": "red"}},
+					{"type": "run_result_changed", "created_on": "2020-04-15T12:00:05Z", "name": "Color", "value": "red"},
+					{"type": "webhook_called", "created_on": "2020-04-15T12:00:06Z", "url": "http://example.com", "status": "success", "status_code": 200, "elapsed_ms": 12},
+					{"type": "flow_entered", "created_on": "2020-04-15T12:00:07Z", "flow": {"uuid": "5890fe3a-f204-4661-b74d-025be4ee019c", "name": "Survey"}}
+				],
+				"results": {
+					"color": {"name": "Color", "value": "red", "category": "Red", "created_on": "2020-04-15T12:00:05Z"},
+					"size": {"name": "Size", "value": "large", "category": "Large", "created_on": "2020-04-15T12:00:06Z"},
+					"shape": {"name": "Shape", "value": "round", "category": "Round", "created_on": "2020-04-15T12:00:06Z"},
+					"age": {"name": "Age", "value": "12", "category": "Young", "created_on": "2020-04-15T12:00:06Z"}
+				}
+			},
+			{
+				"flow": {"uuid": "5890fe3a-f204-4661-b74d-025be4ee019c", "name": "Survey"},
+				"events": [
+					{"type": "error", "created_on": "2020-04-15T12:00:08Z", "text": "missing field"}
+				]
+			}
+		]
+	}`)
+
+	transcript, err := NewTranscript(session)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Ben Haggerty", transcript.Contact)
+	assert.Equal(t, "completed", transcript.Status)
+
+	types := make([]string, 0)
+	for _, e := range transcript.Entries {
+		types = append(types, e.Type+":"+e.Flow)
+	}
+	assert.Equal(t, []string{"msg_out:Favorites", "msg_in:Favorites", "webhook:Favorites", "flow_entered:Survey", "error:Survey"}, types)
+	assert.Equal(t, []string{"red", "blue"}, transcript.Entries[0].QuickReplies)
+	assert.Equal(t, 200, transcript.Entries[2].StatusCode)
+
+	assert.Equal(t, &TranscriptResult{Flow: "Favorites", Name: "Color", Value: "red", Category: "Red", CreatedOn: transcript.Results[0].CreatedOn}, transcript.Results[0])
+
+	// results set at the same time are ordered by name
+	names := make([]string, 0)
+	for _, r := range transcript.Results {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"Color", "Age", "Shape", "Size"}, names)
+
+	// our HTML escapes message content
+	html, err := transcript.HTML()
+	assert.NoError(t, err)
+	assert.Contains(t, html, "What is your &lt;b&gt;favorite&lt;/b&gt; color?")
+	assert.Contains(t, html, "called http://example.com: success 200 in 12ms")
+
+	_, err = NewTranscript(json.RawMessage(`[]`))
+	assert.Error(t, err)
+}
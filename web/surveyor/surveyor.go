@@ -2,7 +2,6 @@ package surveyor
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/nyaruka/goflow/assets"
@@ -13,7 +12,7 @@ import (
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/engine"
 	"github.com/nyaruka/goflow/flows/events"
-	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/client"
 	"github.com/nyaruka/mailroom/goflow"
 	"github.com/nyaruka/mailroom/models"
 	"github.com/nyaruka/mailroom/web"
@@ -21,39 +20,14 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/surveyor/submit", web.RequireUserToken(handleSubmit))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/surveyor/submit", web.RequireUserToken(web.WithIdempotency(handleSubmit)))
 }
 
-// Represents a surveyor submission
-//
-//   {
-//     "session": {...},
-//     "events": [{...}],
-//     "modifiers": [{...}]
-//   }
-//
-type submitRequest struct {
-	Session   json.RawMessage   `json:"session"    validate:"required"`
-	Events    []json.RawMessage `json:"events"`
-	Modifiers []json.RawMessage `json:"modifiers"`
-}
-
-type submitResponse struct {
-	Session struct {
-		ID     models.SessionID     `json:"id"`
-		Status models.SessionStatus `json:"status"`
-	} `json:"session"`
-	Contact struct {
-		ID   flows.ContactID   `json:"id"`
-		UUID flows.ContactUUID `json:"uuid"`
-	} `json:"contact"`
-}
-
-// handles a surveyor request
+// handles a surveyor request, see client.SurveyorSubmitRequest
 func handleSubmit(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
-	request := &submitRequest{}
-	if err := utils.UnmarshalAndValidateWithLimit(r.Body, request, web.MaxRequestBytes); err != nil {
-		return nil, http.StatusBadRequest, errors.Wrapf(err, "request failed validation")
+	request := &client.SurveyorSubmitRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
 	}
 
 	// grab our org
@@ -187,9 +161,9 @@ func handleSubmit(ctx context.Context, s *web.Server, r *http.Request) (interfac
 		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error committing post commit hooks")
 	}
 
-	response := &submitResponse{}
-	response.Session.ID = sessions[0].ID()
-	response.Session.Status = sessions[0].Status()
+	response := &client.SurveyorSubmitResponse{}
+	response.Session.ID = int64(sessions[0].ID())
+	response.Session.Status = string(sessions[0].Status())
 	response.Contact.ID = flowContact.ID()
 	response.Contact.UUID = flowContact.UUID()
 
@@ -0,0 +1,46 @@
+package trigger
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/client"
+	"github.com/nyaruka/mailroom/models"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/trigger/conflicts", web.RequireAuthToken(web.WithOrgAssets(handleConflicts)))
+}
+
+// handles a request to check a prospective trigger for conflicts, see client.TriggerConflictsRequest
+func handleConflicts(ctx context.Context, s *web.Server, r *http.Request) (interface{}, int, error) {
+	request := &client.TriggerConflictsRequest{}
+	if status, err := web.ReadAndValidateJSON(r, request, web.DefaultBodyLimits); err != nil {
+		return err, status, nil
+	}
+
+	if models.TriggerType(request.TriggerType) == models.KeywordTriggerType && request.Keyword == "" {
+		return errors.New("keyword triggers require a keyword"), http.StatusBadRequest, nil
+	}
+
+	org, hasOrg := ctx.Value(web.OrgAssetsKey).(*models.OrgAssets)
+	if !hasOrg {
+		return web.ErrMissingOrg, http.StatusBadRequest, nil
+	}
+
+	groupIDs := make([]models.GroupID, len(request.GroupIDs))
+	for i, id := range request.GroupIDs {
+		groupIDs[i] = models.GroupID(id)
+	}
+
+	trigger := models.NewTrigger(models.TriggerType(request.TriggerType), request.Keyword, models.MatchType(request.MatchType), models.ChannelID(request.ChannelID), request.ReferrerID, groupIDs)
+
+	response := &client.TriggerConflictsResponse{Conflicts: make([]*client.TriggerConflict, 0)}
+	for _, c := range models.FindTriggerConflicts(org, trigger) {
+		response.Conflicts = append(response.Conflicts, &client.TriggerConflict{TriggerID: int(c.TriggerID), FlowID: int(c.FlowID), Type: string(c.Type)})
+	}
+
+	return response, http.StatusOK, nil
+}
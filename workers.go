@@ -76,6 +76,13 @@ func (f *Foreman) Assign() {
 
 		// otherwise, grab the next task and assign it to a worker
 		case worker := <-f.availableWorkers:
+			// batch tasks can load a lot of contacts so don't start any more while we're low on memory
+			if queue.BaseQueue(f.queue) == queue.BatchQueue && f.mr.memory.IsHigh() {
+				f.availableWorkers <- worker
+				time.Sleep(time.Second)
+				continue
+			}
+
 			// see if we have a task to work on
 			rc := f.mr.RP.Get()
 			task, err := queue.PopNextTask(rc, f.queue)
@@ -176,11 +183,38 @@ func (w *Worker) handleTask(task *queue.Task) {
 	log.Info("starting handling of task")
 	start := time.Now()
 
+	// record how long the task waited to be started, retries having waited on purpose aren't counted
+	if task.ErrorCount == 0 && !task.QueuedOn.IsZero() {
+		rc := w.foreman.mr.RP.Get()
+		err := queue.RecordLatency(rc, w.foreman.queue, task.Type, task.QueuedOn, start)
+		rc.Close()
+		if err != nil {
+			log.WithError(err).Error("error recording task latency")
+		}
+	}
+
 	taskFunc, found := taskFunctions[task.Type]
 	if found {
 		err := taskFunc(context.Background(), w.foreman.mr, task)
+
+		// record how the task went so that versions handling canary queues can be compared with the rest
+		rc := w.foreman.mr.RP.Get()
+		outcomeErr := queue.RecordOutcome(rc, w.foreman.queue, task.Type, time.Now(), time.Since(start), err != nil)
+		rc.Close()
+		if outcomeErr != nil {
+			log.WithError(outcomeErr).Error("error recording task outcome")
+		}
+
 		if err != nil {
-			log.WithError(err).WithField("task", string(task.Task)).WithField("task_type", task.Type).WithField("org_id", task.OrgID).Error("error running task")
+			// retry our task if its policy allows it
+			rc := w.foreman.mr.RP.Get()
+			retrying, retryErr := queue.RetryTask(rc, w.foreman.queue, task, err)
+			rc.Close()
+			if retryErr != nil {
+				log.WithError(retryErr).Error("error retrying task")
+			}
+
+			log.WithError(err).WithField("task", string(task.Task)).WithField("error_count", task.ErrorCount).WithField("retrying", retrying).Error("error running task")
 		}
 	} else {
 		log.Error("unable to find function for task type")